@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v3"
+)
+
+const configFileFlag = "config-file"
+
+// redacted replaces values of secret flags in the printed configuration.
+const redacted = "<redacted>"
+
+// secretFlags contains flags with credentials, which are redacted when the configuration is printed.
+var secretFlags = map[string]bool{
+	"nest-client-secret":   true,
+	"nest-refresh-token":   true,
+	"owm-auth":             true,
+	"homekit-pin":          true,
+	"snmp-community":       true,
+	"webhook-header":       true,
+	"alert-pushover-token": true,
+	"alert-pushover-user":  true,
+	"alert-telegram-token": true,
+	"alert-ntfy-url":       true,
+	"alert-smtp-password":  true,
+}
+
+var configPrint *kingpin.CmdClause
+
+// addConfigCommands registers the "config" command with its subcommands.
+func addConfigCommands() {
+	configCmd := kingpin.Command("config", "Inspect the configuration.")
+	configPrint = configCmd.Command("print", "Print the effective configuration, merged from flags, environment variables, config files and defaults, with secrets redacted.")
+}
+
+// configLoader sets values of flags from config files given by the --config-file flag or its environment variable.
+// Values from config files are used as defaults of the flags, so flags and environment variables take precedence.
+type configLoader struct {
+	app      *kingpin.Application
+	args     []string
+	defaults map[string][]string
+}
+
+// newConfigLoader creates a configLoader for flags of the application parsed from the arguments. It must be created
+// before config files are loaded, so it keeps the original defaults of the flags.
+func newConfigLoader(app *kingpin.Application, args []string) *configLoader {
+	defaults := make(map[string][]string)
+	for _, flag := range app.Model().Flags {
+		defaults[flag.Name] = flag.Default
+	}
+
+	return &configLoader{app: app, args: args, defaults: defaults}
+}
+
+// load reads the config files and sets their values as defaults of the flags. It must be called before the flags
+// are parsed.
+func (l *configLoader) load() error {
+	values, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	l.apply(values)
+	return nil
+}
+
+// reload reads the config files again and parses the arguments, updating values of flags which aren't set by the
+// arguments or environment variables. Flags removed from the config files get their original defaults back.
+func (l *configLoader) reload() error {
+	values, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range l.app.Model().Flags {
+		resetFlag(flag.Value)
+		l.app.GetFlag(flag.Name).Default(l.defaults[flag.Name]...)
+	}
+	l.apply(values)
+
+	_, err = l.app.Parse(l.args)
+	return err
+}
+
+// read returns the values of flags from all config files. Values from later files override earlier ones.
+func (l *configLoader) read() (map[string][]string, error) {
+	values := make(map[string][]string)
+	for _, path := range configFilePaths(l.app, l.args) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading config file: %v", err)
+		}
+
+		fileValues, err := parseConfig(l.app, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+func (l *configLoader) apply(values map[string][]string) {
+	for name, value := range values {
+		l.app.GetFlag(name).Default(value...)
+	}
+}
+
+// configFilePaths returns the paths of config files from the arguments or the environment.
+func configFilePaths(app *kingpin.Application, args []string) []string {
+	var paths []string
+	for i, arg := range args {
+		if arg == "--"+configFileFlag && i+1 < len(args) {
+			paths = append(paths, args[i+1])
+		}
+		if strings.HasPrefix(arg, "--"+configFileFlag+"=") {
+			paths = append(paths, strings.TrimPrefix(arg, "--"+configFileFlag+"="))
+		}
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+
+	// Like other repeatable flags, the environment variable contains one value per line.
+	for _, path := range strings.Split(os.Getenv(envarName(app, configFileFlag)), "\n") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// parseConfig returns values of flags from the YAML config. Repeatable flags accept lists and map flags accept
+// mappings.
+func parseConfig(app *kingpin.Application, data []byte) (map[string][]string, error) {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed parsing config file: %v", err)
+	}
+
+	flagValues := make(map[string][]string)
+	for name, value := range values {
+		if app.GetFlag(name) == nil || name == configFileFlag {
+			return nil, fmt.Errorf("unknown key in config file: %s", name)
+		}
+
+		converted, err := configValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s in config file: %v", name, err)
+		}
+		flagValues[name] = converted
+	}
+
+	return flagValues, nil
+}
+
+// resetFlag clears the value of the flag before the arguments are parsed again. Otherwise repeatable flags would
+// keep their previous values, just like flags without a default which are no longer set.
+func resetFlag(value kingpin.Value) {
+	getter, ok := value.(kingpin.Getter)
+	if !ok {
+		return
+	}
+
+	switch v := getter.Get().(type) {
+	case *[]string:
+		*v = nil
+	case *[]int:
+		*v = nil
+	case map[string]string:
+		for key := range v {
+			delete(v, key)
+		}
+	case bool:
+		value.Set("false")
+	case string:
+		// Enums reject empty strings, but they always have a default.
+		value.Set("")
+	}
+}
+
+// configValues converts a YAML value into flag values.
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return nil, fmt.Errorf("nested mappings aren't supported")
+			}
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case map[string]interface{}:
+		var values []string
+		for key, item := range v {
+			values = append(values, fmt.Sprintf("%s=%v", key, item))
+		}
+		sort.Strings(values)
+		return values, nil
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// printConfig prints values of all flags as YAML, in the format of the config file. Secrets are redacted.
+func printConfig(app *kingpin.Application, w io.Writer) error {
+	values := make(map[string]interface{})
+	for _, flag := range app.Model().Flags {
+		if flag.Hidden || flag.Name == "help" || flag.Name == "version" || flag.Name == configFileFlag {
+			continue
+		}
+
+		value := flagValue(flag.Value)
+		if secretFlags[flag.Name] && !isEmpty(value) {
+			value = redacted
+		}
+		values[flag.Name] = value
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// flagValue returns the value of the flag: a list for repeatable flags, a map for map flags, booleans and numbers as
+// they are and a string otherwise.
+func flagValue(value kingpin.Value) interface{} {
+	getter, ok := value.(kingpin.Getter)
+	if !ok {
+		return value.String()
+	}
+
+	switch v := getter.Get().(type) {
+	case *[]string:
+		return append([]string{}, *v...)
+	case []string:
+		return append([]string{}, v...)
+	case map[string]string:
+		return v
+	case bool, int, float64:
+		return v
+	default:
+		return value.String()
+	}
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case []string:
+		return len(v) == 0
+	case map[string]string:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// envarName returns the name of the environment variable of the flag, as set by kingpin DefaultEnvars.
+func envarName(app *kingpin.Application, flag string) string {
+	return strings.ToUpper(strings.Replace(app.Name+"_"+flag, "-", "_", -1))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type testFlags struct {
+	app       *kingpin.Application
+	projectID *string
+	secret    *string
+	timeout   *int
+	tags      *[]string
+	aliases   *map[string]string
+}
+
+func newTestApp() testFlags {
+	app := kingpin.New("pronestheus", "").DefaultEnvars()
+	app.Flag(configFileFlag, "").Strings()
+
+	return testFlags{
+		app:       app,
+		projectID: app.Flag("nest-project-id", "").String(),
+		secret:    app.Flag("nest-client-secret", "").String(),
+		timeout:   app.Flag("scrape-timeout", "").Default("5000").Int(),
+		tags:      app.Flag("statsd-tag", "").Strings(),
+		aliases:   app.Flag("nest-alias", "").StringMap(),
+	}
+}
+
+// writeConfig writes the config into a temporary file and returns its path.
+func writeConfig(t *testing.T, config string) string {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+	return path
+}
+
+const testConfig = `
+nest-project-id: file
+nest-client-secret: secret
+scrape-timeout: 3000
+statsd-tag: [env:home, site:main]
+nest-alias:
+  DEVICE_1: hall
+`
+
+func TestLoadConfig(t *testing.T) {
+	f := newTestApp()
+	args := []string{"--config-file", writeConfig(t, testConfig), "--scrape-timeout=4000"}
+	assert.NoError(t, newConfigLoader(f.app, args).load())
+
+	os.Setenv("PRONESTHEUS_NEST_PROJECT_ID", "env")
+	defer os.Unsetenv("PRONESTHEUS_NEST_PROJECT_ID")
+
+	_, err := f.app.Parse(args)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "env", *f.projectID, "environment variables override the config file")
+	assert.Equal(t, 4000, *f.timeout, "flags override the config file")
+	assert.Equal(t, "secret", *f.secret)
+	assert.Equal(t, []string{"env:home", "site:main"}, *f.tags)
+	assert.Equal(t, map[string]string{"DEVICE_1": "hall"}, *f.aliases)
+}
+
+func TestLoadConfigFiles(t *testing.T) {
+	f := newTestApp()
+	args := []string{
+		"--config-file", writeConfig(t, testConfig),
+		"--config-file=" + writeConfig(t, "nest-client-secret: from-secret"),
+	}
+	assert.NoError(t, newConfigLoader(f.app, args).load())
+
+	_, err := f.app.Parse(args)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "file", *f.projectID)
+	assert.Equal(t, "from-secret", *f.secret, "later files override earlier ones")
+}
+
+func TestReloadConfig(t *testing.T) {
+	f := newTestApp()
+	path := writeConfig(t, testConfig)
+	args := []string{"--config-file", path, "--nest-alias", "DEVICE_2=attic"}
+
+	loader := newConfigLoader(f.app, args)
+	assert.NoError(t, loader.load())
+	_, err := f.app.Parse(args)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"DEVICE_2": "attic"}, *f.aliases)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("nest-client-secret: rotated\nstatsd-tag: [env:home]"), 0644))
+	assert.NoError(t, loader.reload())
+
+	assert.Equal(t, "rotated", *f.secret)
+	assert.Equal(t, []string{"env:home"}, *f.tags, "repeatable flags aren't appended to")
+	assert.Equal(t, "", *f.projectID, "removed keys are cleared")
+	assert.Equal(t, 5000, *f.timeout, "removed keys get their defaults back")
+	assert.Equal(t, map[string]string{"DEVICE_2": "attic"}, *f.aliases, "flags still override the config file")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("nest-project: abc"), 0644))
+	assert.Error(t, loader.reload())
+	assert.Equal(t, "rotated", *f.secret, "invalid config files don't change the values")
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "unknown key", config: "nest-project: abc", want: "unknown key in config file: nest-project"},
+		{name: "config file key", config: "config-file: other.yaml", want: "unknown key in config file: config-file"},
+		{name: "invalid YAML", config: "nest-project-id: [abc", want: "failed parsing config file"},
+		{name: "nested mapping", config: "statsd-tag: [{env: home}]", want: "invalid value of statsd-tag in config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(newTestApp().app, []byte(tt.config))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	err := newConfigLoader(newTestApp().app, []string{"--config-file", filepath.Join("missing", "config.yaml")}).load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed reading config file")
+}
+
+func TestConfigFilePaths(t *testing.T) {
+	app := newTestApp().app
+	assert.Equal(t, []string{"a.yaml"}, configFilePaths(app, []string{"serve", "--config-file", "a.yaml"}))
+	assert.Equal(t, []string{"a.yaml", "b.yaml"}, configFilePaths(app, []string{"--config-file", "a.yaml", "--config-file=b.yaml"}))
+
+	os.Setenv("PRONESTHEUS_CONFIG_FILE", "c.yaml\nd.yaml")
+	defer os.Unsetenv("PRONESTHEUS_CONFIG_FILE")
+	assert.Equal(t, []string{"c.yaml", "d.yaml"}, configFilePaths(app, nil))
+}
+
+func TestPrintConfig(t *testing.T) {
+	f := newTestApp()
+	args := []string{"--config-file", writeConfig(t, testConfig)}
+	assert.NoError(t, newConfigLoader(f.app, args).load())
+	_, err := f.app.Parse(args)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, printConfig(f.app, &out))
+	assert.Equal(t, `nest-alias:
+    DEVICE_1: hall
+nest-client-secret: <redacted>
+nest-project-id: file
+scrape-timeout: 3000
+statsd-tag:
+    - env:home
+    - site:main
+`, out.String())
+
+	// The printed configuration can be used as a config file.
+	_, err = parseConfig(newTestApp().app, out.Bytes())
+	assert.NoError(t, err)
+}
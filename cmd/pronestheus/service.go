@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"pronestheus/pkg"
+	"time"
+
+	"github.com/kardianos/service"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	serviceInstall   *kingpin.CmdClause
+	serviceUninstall *kingpin.CmdClause
+	serviceStart     *kingpin.CmdClause
+	serviceStop      *kingpin.CmdClause
+	serviceRun       *kingpin.CmdClause
+)
+
+// addServiceCommands registers the "service" command with its subcommands.
+func addServiceCommands() {
+	serviceCmd := kingpin.Command("service", "Manage ProNestheus as a native system service (Windows service, launchd or systemd).")
+	serviceInstall = serviceCmd.Command("install", "Install the service. Flags passed along are used when the service starts.")
+	serviceUninstall = serviceCmd.Command("uninstall", "Uninstall the service.")
+	serviceStart = serviceCmd.Command("start", "Start the installed service.")
+	serviceStop = serviceCmd.Command("stop", "Stop the installed service.")
+	serviceRun = serviceCmd.Command("run", "Run the exporter under the service manager. Used by the installed service.")
+}
+
+// program implements the service.Interface, running the exporter in the background.
+type program struct {
+	exporter *pkg.Exporter
+	errs     chan error
+}
+
+// Start implements the service.Interface. It must not block, so the exporter runs in a separate goroutine.
+func (p *program) Start(s service.Service) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	exporter, err := pkg.NewExporter(cfg)
+	if err != nil {
+		return err
+	}
+
+	p.exporter = exporter
+	p.errs = make(chan error, 1)
+
+	go func() {
+		p.errs <- exporter.Run()
+	}()
+
+	return nil
+}
+
+// Stop implements the service.Interface.
+func (p *program) Stop(s service.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return p.exporter.Shutdown(ctx)
+}
+
+// runService handles the "service" subcommands.
+func runService(command string) error {
+	svcConfig := &service.Config{
+		Name:        "pronestheus",
+		DisplayName: "ProNestheus",
+		Description: "Nest Thermostat Prometheus Exporter",
+		Arguments:   serviceArgs(os.Args[1:]),
+	}
+
+	svc, err := service.New(&program{}, svcConfig)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case serviceInstall.FullCommand():
+		err = svc.Install()
+	case serviceUninstall.FullCommand():
+		err = svc.Uninstall()
+	case serviceStart.FullCommand():
+		err = svc.Start()
+	case serviceStop.FullCommand():
+		err = svc.Stop()
+	case serviceRun.FullCommand():
+		return svc.Run()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Service %s: done\n", command)
+	return nil
+}
+
+// serviceArgs returns the arguments for the installed service: all flags given on the command line,
+// followed by the "service run" command.
+func serviceArgs(args []string) []string {
+	var flags []string
+	for _, arg := range args {
+		if arg == "service" || arg == "install" {
+			continue
+		}
+		flags = append(flags, arg)
+	}
+
+	return append(flags, "service", "run")
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+var errInvalidSampleRate = errors.New("access log sample rate must be between 0 and 1")
+
+// accessLog logs requests served by the handler. A share of requests given by the sample rate is logged, and requests
+// slower than the threshold are always logged, so slow scrapes are visible without logging every scrape.
+type accessLog struct {
+	handler    http.Handler
+	logger     log.Logger
+	sampleRate float64
+	slow       time.Duration
+	random     func() float64
+	now        func() time.Time
+}
+
+// newAccessLog creates the access log from the config. It returns nil if it's disabled. The handler is set when the
+// server starts.
+func newAccessLog(cfg *ExporterConfig, logger log.Logger) (*accessLog, error) {
+	a := &accessLog{
+		logger: logger,
+		random: rand.Float64,
+		now:    time.Now,
+	}
+
+	if cfg.AccessLogSampleRate != nil {
+		a.sampleRate = *cfg.AccessLogSampleRate
+	}
+	if a.sampleRate < 0 || a.sampleRate > 1 {
+		return nil, errInvalidSampleRate
+	}
+
+	if cfg.AccessLogSlowThreshold != nil {
+		a.slow = *cfg.AccessLogSlowThreshold
+	}
+
+	if a.sampleRate == 0 && a.slow <= 0 {
+		return nil, nil
+	}
+
+	return a, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *accessLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := a.now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	a.handler.ServeHTTP(rec, r)
+
+	duration := a.now().Sub(start)
+	slow := a.slow > 0 && duration >= a.slow
+	if !slow && (a.sampleRate == 0 || a.random() >= a.sampleRate) {
+		return
+	}
+
+	level := "info"
+	if slow {
+		level = "warn"
+	}
+
+	a.logger.Log(
+		"level", level,
+		"msg", "HTTP request",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"remote", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"status", rec.status,
+		"bytes", rec.bytes,
+		"duration", duration,
+		"slow", slow,
+	)
+}
+
+// statusRecorder records the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface, which streamed responses need.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	sampleRate, slow := 0.5, time.Second
+
+	a, err := newAccessLog(&ExporterConfig{AccessLogSampleRate: &sampleRate, AccessLogSlowThreshold: &slow}, log.NewLogfmtLogger(&buf))
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	duration, random := 10*time.Millisecond, 0.7
+	// Every request takes the duration.
+	a.now = func() time.Time {
+		now = now.Add(duration)
+		return now
+	}
+	a.random = func() float64 { return random }
+	a.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("User-Agent", "Prometheus/2.24.0")
+
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Empty(t, buf.String(), "requests outside the sample aren't logged")
+
+	random = 0.2
+	a.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "level=info msg=\"HTTP request\" method=GET path=/metrics remote=192.0.2.1:1234 user_agent=Prometheus/2.24.0 status=404 bytes=9 duration=10ms slow=false\n", buf.String())
+
+	buf.Reset()
+	random, duration = 0.7, 2*time.Second
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	assert.Contains(t, buf.String(), "level=warn", "slow requests are always logged")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAccessLogDisabled(t *testing.T) {
+	a, err := newAccessLog(&ExporterConfig{}, log.NewNopLogger())
+	assert.NoError(t, err)
+	assert.Nil(t, a)
+
+	sampleRate := 1.5
+	_, err = newAccessLog(&ExporterConfig{AccessLogSampleRate: &sampleRate}, log.NewNopLogger())
+	assert.Equal(t, errInvalidSampleRate, err)
+}
@@ -0,0 +1,271 @@
+// Package alert evaluates simple threshold rules against thermostat readings and sends notifications, for setups
+// without Prometheus and Alertmanager.
+//
+// A rule compares a reading of every thermostat with a threshold, eg. "ambient_temperature_celsius < 5 for 30m".
+// When the comparison holds for the whole duration, the rule fires and a notification is sent once. Another
+// notification is sent when the comparison stops holding.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// queueSize limits the number of notifications waiting to be sent, newer ones are dropped when it's full.
+const queueSize = 64
+
+var (
+	errInvalidRule   = errors.New("invalid alert rule; expected format: \"METRIC OPERATOR THRESHOLD [for DURATION]\"")
+	errInvalidMetric = errors.New("invalid alert metric")
+	errNoNotifiers   = errors.New("alert rules require at least one notifier")
+)
+
+// metrics returns the values of readings rules can compare, by name.
+var metrics = map[string]func(therm *nest.Thermostat) float64{
+	"ambient_temperature_celsius":  func(therm *nest.Thermostat) float64 { return therm.AmbientTemp },
+	"setpoint_temperature_celsius": func(therm *nest.Thermostat) float64 { return therm.SetpointTemp },
+	"humidity_percent":             func(therm *nest.Thermostat) float64 { return therm.Humidity },
+	"heating":                      func(therm *nest.Thermostat) float64 { return boolToFloat(therm.Status == "HEATING") },
+	"online":                       func(therm *nest.Thermostat) float64 { return boolToFloat(therm.Connectivity != "OFFLINE") },
+}
+
+// comparators are the operators rules can use, by symbol.
+var comparators = map[string]func(value, threshold float64) bool{
+	"<":  func(value, threshold float64) bool { return value < threshold },
+	"<=": func(value, threshold float64) bool { return value <= threshold },
+	">":  func(value, threshold float64) bool { return value > threshold },
+	">=": func(value, threshold float64) bool { return value >= threshold },
+	"==": func(value, threshold float64) bool { return value == threshold },
+	"!=": func(value, threshold float64) bool { return value != threshold },
+}
+
+// Rule fires when the metric of a thermostat compared with the threshold holds for the duration.
+type Rule struct {
+	Metric     string
+	Comparator string
+	Threshold  float64
+	Duration   time.Duration
+}
+
+// ParseRule parses a rule in the "METRIC OPERATOR THRESHOLD [for DURATION]" format, eg. "online == 0 for 1h".
+func ParseRule(rule string) (Rule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 3 && (len(fields) != 5 || fields[3] != "for") {
+		return Rule{}, errors.Wrap(errInvalidRule, rule)
+	}
+
+	if _, ok := metrics[fields[0]]; !ok {
+		return Rule{}, errors.Wrap(errInvalidMetric, fmt.Sprintf("%s; valid values: [%s]", fields[0], strings.Join(metricNames(), ", ")))
+	}
+
+	if _, ok := comparators[fields[1]]; !ok {
+		return Rule{}, errors.Wrap(errInvalidRule, rule)
+	}
+
+	threshold, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return Rule{}, errors.Wrap(errInvalidRule, rule)
+	}
+
+	r := Rule{Metric: fields[0], Comparator: fields[1], Threshold: threshold}
+	if len(fields) == 5 {
+		if r.Duration, err = time.ParseDuration(fields[4]); err != nil {
+			return Rule{}, errors.Wrap(errInvalidRule, rule)
+		}
+	}
+
+	return r, nil
+}
+
+// String returns the rule in the format accepted by ParseRule.
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s %s %s", r.Metric, r.Comparator, strconv.FormatFloat(r.Threshold, 'f', -1, 64))
+	if r.Duration > 0 {
+		s += " for " + formatDuration(r.Duration)
+	}
+	return s
+}
+
+// Match returns the reading of the thermostat compared by the rule, and whether the comparison holds. The duration
+// isn't taken into account.
+func (r Rule) Match(therm *nest.Thermostat) (float64, bool) {
+	value := metrics[r.Metric](therm)
+	return value, comparators[r.Comparator](value, r.Threshold)
+}
+
+// Notifier sends notifications, eg. push messages or e-mails.
+type Notifier interface {
+	Notify(ctx context.Context, title, message string) error
+}
+
+// Config provides the configuration necessary to create the Engine.
+// Logger is optional, if it's nil the Engine doesn't log anything.
+type Config struct {
+	Logger    log.Logger
+	Rules     []Rule
+	Notifiers []Notifier
+}
+
+// notification is a message waiting to be sent.
+type notification struct {
+	title   string
+	message string
+}
+
+// state tracks a rule for a thermostat.
+type state struct {
+	since  time.Time
+	firing bool
+}
+
+// Engine evaluates rules on every collection and sends notifications when they fire or resolve.
+type Engine struct {
+	logger    log.Logger
+	rules     []Rule
+	notifiers []Notifier
+	queue     chan notification
+
+	mu     sync.Mutex
+	states map[string]*state
+	now    func() time.Time
+}
+
+// New creates an Engine using the given Config. It returns an error if there are rules but no notifiers.
+func New(cfg Config) (*Engine, error) {
+	if len(cfg.Rules) > 0 && len(cfg.Notifiers) == 0 {
+		return nil, errNoNotifiers
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	return &Engine{
+		logger:    cfg.Logger,
+		rules:     cfg.Rules,
+		notifiers: cfg.Notifiers,
+		queue:     make(chan notification, queueSize),
+		states:    make(map[string]*state),
+		now:       time.Now,
+	}, nil
+}
+
+// Listener returns a nest.Listener evaluating the rules against the readings.
+func (e *Engine) Listener() nest.Listener {
+	return e.Evaluate
+}
+
+// Evaluate evaluates the rules against the readings and queues notifications of rules which fired or resolved.
+func (e *Engine) Evaluate(thermostats []*nest.Thermostat) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, rule := range e.rules {
+		for _, therm := range thermostats {
+			key := rule.String() + "\x00" + therm.ID
+			value, matched := rule.Match(therm)
+			st, ok := e.states[key]
+
+			if !matched {
+				if ok && st.firing {
+					e.enqueue(notification{
+						title:   fmt.Sprintf("[RESOLVED] %s: %s", name(therm), rule),
+						message: fmt.Sprintf("%s of %s is %s.", rule.Metric, name(therm), formatFloat(value)),
+					})
+				}
+				delete(e.states, key)
+				continue
+			}
+
+			if !ok {
+				st = &state{since: now}
+				e.states[key] = st
+			}
+
+			if !st.firing && now.Sub(st.since) >= rule.Duration {
+				st.firing = true
+				e.enqueue(notification{
+					title:   fmt.Sprintf("[FIRING] %s: %s", name(therm), rule),
+					message: fmt.Sprintf("%s of %s is %s since %s.", rule.Metric, name(therm), formatFloat(value), st.since.Format(time.RFC3339)),
+				})
+			}
+		}
+	}
+}
+
+// Run sends queued notifications with all notifiers until the context is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-e.queue:
+			for _, notifier := range e.notifiers {
+				if err := notifier.Notify(ctx, n.title, n.message); err != nil {
+					e.logger.Log("level", "error", "message", "Failed sending alert notification", "stack", errors.WithStack(err))
+					continue
+				}
+				e.logger.Log("level", "info", "message", "Sent alert notification", "title", n.title)
+			}
+		}
+	}
+}
+
+func (e *Engine) enqueue(n notification) {
+	select {
+	case e.queue <- n:
+	default:
+		e.logger.Log("level", "warn", "message", "Alert notification queue is full, dropping notification", "title", n.title)
+	}
+}
+
+// name returns the custom name of the thermostat, or its device ID if it doesn't have one.
+func name(therm *nest.Thermostat) string {
+	if therm.Label != "" {
+		return therm.Label
+	}
+	return therm.DeviceID
+}
+
+func metricNames() []string {
+	var names []string
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatDuration formats the duration without trailing zero units, eg. 30m instead of 30m0s.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type fakeNotifier struct {
+	mu     sync.Mutex
+	titles []string
+	sent   chan struct{}
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, title, _ string) error {
+	n.mu.Lock()
+	n.titles = append(n.titles, title)
+	n.mu.Unlock()
+	n.sent <- struct{}{}
+	return nil
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    Rule
+		wantErr error
+	}{
+		{
+			rule: "ambient_temperature_celsius < 5 for 30m",
+			want: Rule{Metric: "ambient_temperature_celsius", Comparator: "<", Threshold: 5, Duration: 30 * time.Minute},
+		}, {
+			rule: "online == 0",
+			want: Rule{Metric: "online", Comparator: "==", Threshold: 0},
+		}, {
+			rule: "humidity_percent >= 62.5 for 2h",
+			want: Rule{Metric: "humidity_percent", Comparator: ">=", Threshold: 62.5, Duration: 2 * time.Hour},
+		}, {
+			rule:    "pressure > 1000",
+			wantErr: errInvalidMetric,
+		}, {
+			rule:    "humidity_percent => 60",
+			wantErr: errInvalidRule,
+		}, {
+			rule:    "humidity_percent > high",
+			wantErr: errInvalidRule,
+		}, {
+			rule:    "humidity_percent > 60 during 1h",
+			wantErr: errInvalidRule,
+		}, {
+			rule:    "humidity_percent > 60 for ever",
+			wantErr: errInvalidRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseRule(tt.rule)
+			assert.True(t, errors.Is(err, tt.wantErr))
+			assert.Equal(t, tt.want, got)
+			if err == nil {
+				assert.Equal(t, tt.rule, got.String())
+			}
+		})
+	}
+}
+
+func TestNoNotifiers(t *testing.T) {
+	_, err := New(Config{Rules: []Rule{{Metric: "online", Comparator: "==", Threshold: 0}}})
+	assert.True(t, errors.Is(err, errNoNotifiers))
+}
+
+func TestEvaluate(t *testing.T) {
+	rule, err := ParseRule("ambient_temperature_celsius < 5 for 30m")
+	assert.NoError(t, err)
+
+	e, err := New(Config{Rules: []Rule{rule}, Notifiers: []Notifier{&fakeNotifier{}}})
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	evaluate := func(temp float64, after time.Duration) string {
+		now = now.Add(after)
+		e.Evaluate([]*nest.Thermostat{{ID: "THERMOSTAT", DeviceID: "DEVICE_ID", Label: "Cellar", AmbientTemp: temp}})
+		select {
+		case n := <-e.queue:
+			return n.title
+		default:
+			return ""
+		}
+	}
+
+	assert.Equal(t, "", evaluate(4, 0), "pending")
+	assert.Equal(t, "", evaluate(6, 20*time.Minute), "recovered before firing")
+	assert.Equal(t, "", evaluate(4, 10*time.Minute), "pending again")
+	assert.Equal(t, "", evaluate(4, 20*time.Minute), "still pending")
+	assert.Equal(t, "[FIRING] Cellar: ambient_temperature_celsius < 5 for 30m", evaluate(3, 10*time.Minute))
+	assert.Equal(t, "", evaluate(3, 10*time.Minute), "fired only once")
+	assert.Equal(t, "[RESOLVED] Cellar: ambient_temperature_celsius < 5 for 30m", evaluate(7, 10*time.Minute))
+	assert.Equal(t, "", evaluate(8, 10*time.Minute), "resolved only once")
+}
+
+func TestOffline(t *testing.T) {
+	rule, err := ParseRule("online == 0")
+	assert.NoError(t, err)
+
+	e, err := New(Config{Rules: []Rule{rule}, Notifiers: []Notifier{&fakeNotifier{}}})
+	assert.NoError(t, err)
+
+	e.Evaluate([]*nest.Thermostat{
+		{ID: "ONLINE", DeviceID: "ONLINE", Connectivity: "ONLINE"},
+		{ID: "UNKNOWN", DeviceID: "UNKNOWN"},
+		{ID: "OFFLINE", DeviceID: "OFFLINE", Connectivity: "OFFLINE"},
+	})
+
+	assert.Len(t, e.queue, 1)
+	assert.Equal(t, "[FIRING] OFFLINE: online == 0", (<-e.queue).title)
+}
+
+func TestRun(t *testing.T) {
+	rule, err := ParseRule("heating == 1")
+	assert.NoError(t, err)
+
+	first := &fakeNotifier{sent: make(chan struct{}, 1)}
+	second := &fakeNotifier{sent: make(chan struct{}, 1)}
+	e, err := New(Config{Rules: []Rule{rule}, Notifiers: []Notifier{first, second}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Evaluate([]*nest.Thermostat{{ID: "THERMOSTAT", DeviceID: "DEVICE_ID", Status: "HEATING"}})
+
+	for _, n := range []*fakeNotifier{first, second} {
+		select {
+		case <-n.sent:
+			n.mu.Lock()
+			assert.Equal(t, []string{"[FIRING] DEVICE_ID: heating == 1"}, n.titles)
+			n.mu.Unlock()
+		case <-time.After(time.Second):
+			t.Fatal("notification wasn't sent")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxErrorBodySize limits the part of error responses included in errors.
+const maxErrorBodySize = 512
+
+var (
+	errFailedNotifying = errors.New("failed sending notification")
+	errNon2xxResponse  = errors.New("notification service returned non-2xx response")
+)
+
+// Pushover sends notifications with the Pushover API.
+type Pushover struct {
+	url    string
+	token  string
+	user   string
+	client *http.Client
+}
+
+// NewPushover creates a Pushover notifier using the application token and the user or group key.
+func NewPushover(token, user string, client *http.Client) *Pushover {
+	return &Pushover{
+		url:    "https://api.pushover.net/1/messages.json",
+		token:  token,
+		user:   user,
+		client: client,
+	}
+}
+
+// Notify sends a Pushover message.
+func (p *Pushover) Notify(ctx context.Context, title, message string) error {
+	form := url.Values{"token": {p.token}, "user": {p.user}, "title": {title}, "message": {message}}
+	req, err := http.NewRequest(http.MethodPost, p.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(errFailedNotifying, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return do(ctx, p.client, req)
+}
+
+// Telegram sends notifications with a Telegram bot.
+type Telegram struct {
+	url    string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegram creates a Telegram notifier sending messages with the bot to the chat.
+func NewTelegram(token, chatID string, client *http.Client) *Telegram {
+	return &Telegram{
+		url:    "https://api.telegram.org/bot" + token + "/sendMessage",
+		chatID: chatID,
+		client: client,
+	}
+}
+
+// Notify sends a Telegram message.
+func (t *Telegram) Notify(ctx context.Context, title, message string) error {
+	form := url.Values{"chat_id": {t.chatID}, "text": {title + "\n" + message}}
+	req, err := http.NewRequest(http.MethodPost, t.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(errFailedNotifying, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return do(ctx, t.client, req)
+}
+
+// Ntfy sends notifications to a ntfy topic.
+type Ntfy struct {
+	url    string
+	client *http.Client
+}
+
+// NewNtfy creates a ntfy notifier publishing to the topic URL, eg. https://ntfy.sh/my-nest-alerts.
+func NewNtfy(topicURL string, client *http.Client) *Ntfy {
+	return &Ntfy{
+		url:    topicURL,
+		client: client,
+	}
+}
+
+// Notify publishes a ntfy message.
+func (n *Ntfy) Notify(ctx context.Context, title, message string) error {
+	req, err := http.NewRequest(http.MethodPost, n.url, strings.NewReader(message))
+	if err != nil {
+		return errors.Wrap(errFailedNotifying, err.Error())
+	}
+	req.Header.Set("Title", title)
+
+	return do(ctx, n.client, req)
+}
+
+// SMTP sends notifications as e-mails.
+type SMTP struct {
+	addr     string
+	from     string
+	to       []string
+	auth     smtp.Auth
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTP creates an SMTP notifier sending e-mails through the server at addr, eg. smtp.gmail.com:587. PLAIN
+// authentication is used if the username isn't empty, the server must support STARTTLS for it.
+func NewSMTP(addr, from string, to []string, username, password string) *SMTP {
+	s := &SMTP{
+		addr:     addr,
+		from:     from,
+		to:       to,
+		sendMail: smtp.SendMail,
+	}
+
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return s
+}
+
+// Notify sends an e-mail with the title as the subject. The context is ignored, net/smtp doesn't support it.
+func (s *SMTP) Notify(_ context.Context, title, message string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", title)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(message, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := s.sendMail(s.addr, s.auth, s.from, s.to, msg.Bytes()); err != nil {
+		return errors.Wrap(errFailedNotifying, err.Error())
+	}
+
+	return nil
+}
+
+// do sends the request and returns an error if the response isn't 2xx.
+func do(ctx context.Context, client *http.Client, req *http.Request) error {
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(errFailedNotifying, err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return errors.Wrap(errNon2xxResponse, fmt.Sprintf("%s: %s", res.Status, bytes.TrimSpace(body)))
+	}
+	io.Copy(ioutil.Discard, res.Body)
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func newServer(status int) (*httptest.Server, chan request) {
+	received := make(chan request, 1)
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- request{header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"ok":false}`))
+	}))
+
+	return serv, received
+}
+
+func TestPushover(t *testing.T) {
+	serv, received := newServer(http.StatusOK)
+	defer serv.Close()
+
+	p := NewPushover("TOKEN", "USER", &http.Client{Timeout: time.Second})
+	p.url = serv.URL
+
+	assert.NoError(t, p.Notify(context.Background(), "Title", "Message"))
+	assert.Equal(t, "message=Message&title=Title&token=TOKEN&user=USER", (<-received).body)
+}
+
+func TestTelegram(t *testing.T) {
+	serv, received := newServer(http.StatusOK)
+	defer serv.Close()
+
+	tg := NewTelegram("BOT_TOKEN", "CHAT_ID", &http.Client{Timeout: time.Second})
+	assert.Equal(t, "https://api.telegram.org/botBOT_TOKEN/sendMessage", tg.url)
+	tg.url = serv.URL
+
+	assert.NoError(t, tg.Notify(context.Background(), "Title", "Message"))
+	assert.Equal(t, "chat_id=CHAT_ID&text=Title%0AMessage", (<-received).body)
+}
+
+func TestNtfy(t *testing.T) {
+	serv, received := newServer(http.StatusOK)
+	defer serv.Close()
+
+	n := NewNtfy(serv.URL+"/nest-alerts", &http.Client{Timeout: time.Second})
+	assert.NoError(t, n.Notify(context.Background(), "Title", "Message"))
+
+	req := <-received
+	assert.Equal(t, "Title", req.header.Get("Title"))
+	assert.Equal(t, "Message", req.body)
+}
+
+func TestNon2xxResponse(t *testing.T) {
+	serv, _ := newServer(http.StatusBadRequest)
+	defer serv.Close()
+
+	err := NewNtfy(serv.URL, &http.Client{Timeout: time.Second}).Notify(context.Background(), "Title", "Message")
+	assert.True(t, errors.Is(err, errNon2xxResponse))
+	assert.Contains(t, err.Error(), `400 Bad Request: {"ok":false}`)
+}
+
+func TestSMTP(t *testing.T) {
+	s := NewSMTP("smtp.example.com:587", "nest@example.com", []string{"me@example.com", "you@example.com"}, "user", "password")
+
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	s.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		assert.NotNil(t, a)
+		return nil
+	}
+
+	assert.NoError(t, s.Notify(context.Background(), "Title", "First line\nSecond line"))
+	assert.Equal(t, "smtp.example.com:587", gotAddr)
+	assert.Equal(t, "nest@example.com", gotFrom)
+	assert.Equal(t, []string{"me@example.com", "you@example.com"}, gotTo)
+	assert.Contains(t, string(gotMsg), "To: me@example.com, you@example.com\r\nSubject: Title\r\n")
+	assert.Contains(t, string(gotMsg), "\r\n\r\nFirst line\r\nSecond line\r\n")
+}
@@ -0,0 +1,188 @@
+// Package anomaly flags thermostat readings which deviate from their recent history, eg. because of a failing sensor
+// or an HVAC fault.
+//
+// The ambient temperature and humidity of every thermostat are tracked with an exponentially weighted moving average
+// (EWMA) and variance. Each new reading is scored with its z-score against the average and variance of the readings
+// before it, and flagged as an anomaly if the absolute z-score reaches the threshold. Scores are only computed after
+// a warm-up of readings, as the variance of a few readings means little.
+package anomaly
+
+import (
+	"math"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+const (
+	// DefaultThreshold is the absolute z-score from which readings are anomalies.
+	DefaultThreshold = 3.0
+
+	// DefaultAlpha is the weight of a new reading in the moving average and variance.
+	DefaultAlpha = 0.05
+
+	// warmup is the number of readings tracked before they're scored.
+	warmup = 30
+)
+
+// readings are the tracked readings, with their minimum standard deviation: readings are rounded by thermostats, so
+// a stable reading would otherwise make the slightest change an anomaly.
+var readings = []struct {
+	name         string
+	minDeviation float64
+	value        func(therm *nest.Thermostat) float64
+}{
+	{"temperature", 0.2, func(therm *nest.Thermostat) float64 { return therm.AmbientTemp }},
+	{"humidity", 1, func(therm *nest.Thermostat) float64 { return therm.Humidity }},
+}
+
+var errInvalidParameters = errors.New("invalid anomaly detection parameters; expected positive threshold and smoothing factor up to 1")
+
+// Config provides the configuration necessary to create the Detector. Logger is optional, if it's nil the Detector
+// doesn't log anything. Threshold and Alpha default to DefaultThreshold and DefaultAlpha. Labels identify thermostats
+// in the anomaly metrics, besides the reading label.
+type Config struct {
+	Logger    log.Logger
+	Threshold float64
+	Alpha     float64
+	Labels    nest.MetricLabels
+}
+
+// Detector scores readings of thermostats and exports the scores.
+type Detector struct {
+	logger    log.Logger
+	threshold float64
+	alpha     float64
+	labels    nest.MetricLabels
+
+	mu          sync.Mutex
+	thermostats map[string]*history
+
+	anomaly *prometheus.Desc
+	score   *prometheus.Desc
+}
+
+// history contains the moving statistics of the readings of a thermostat.
+type history struct {
+	therm *nest.Thermostat
+	stats map[string]*ewma
+}
+
+// ewma is the exponentially weighted moving average and variance of a reading, with the score of the latest one.
+type ewma struct {
+	count    int
+	mean     float64
+	variance float64
+	score    float64
+}
+
+// New creates a Detector using the given Config. It returns an error if the threshold is negative or the smoothing
+// factor isn't between 0 and 1.
+func New(cfg Config) (*Detector, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+	if cfg.Alpha == 0 {
+		cfg.Alpha = DefaultAlpha
+	}
+	if cfg.Threshold < 0 || cfg.Alpha < 0 || cfg.Alpha > 1 {
+		return nil, errInvalidParameters
+	}
+
+	labels := cfg.Labels.Names("reading")
+	return &Detector{
+		logger:      cfg.Logger,
+		threshold:   cfg.Threshold,
+		alpha:       cfg.Alpha,
+		labels:      cfg.Labels,
+		thermostats: make(map[string]*history),
+		anomaly:     prometheus.NewDesc("nest_reading_anomaly", "Whether the latest reading deviates from the moving average by at least the threshold.", labels, nil),
+		score:       prometheus.NewDesc("nest_reading_anomaly_score", "Z-score of the latest reading against the moving average and variance of the readings before it.", labels, nil),
+	}, nil
+}
+
+// Listener returns a nest.Listener scoring new readings of thermostats. Register it with nest.WithUpdateListener,
+// so readings aren't scored twice.
+func (d *Detector) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		for _, therm := range thermostats {
+			h, ok := d.thermostats[therm.ID]
+			if !ok {
+				h = &history{stats: make(map[string]*ewma)}
+				d.thermostats[therm.ID] = h
+			}
+			h.therm = therm
+
+			for _, r := range readings {
+				s, ok := h.stats[r.name]
+				if !ok {
+					s = &ewma{}
+					h.stats[r.name] = s
+				}
+
+				s.add(r.value(therm), d.alpha, r.minDeviation)
+				if math.Abs(s.score) >= d.threshold {
+					d.logger.Log("level", "warn", "message", "Anomalous thermostat reading", "id", therm.ID, "reading", r.name, "value", r.value(therm), "score", s.score)
+				}
+			}
+		}
+	}
+}
+
+// add scores the value against the statistics of the previous values, and then updates them.
+func (s *ewma) add(value, alpha, minDeviation float64) {
+	if s.count == 0 {
+		s.mean = value
+	}
+
+	s.score = 0
+	if s.count >= warmup {
+		s.score = (value - s.mean) / math.Max(math.Sqrt(s.variance), minDeviation)
+	}
+
+	diff := value - s.mean
+	incr := alpha * diff
+	s.mean += incr
+	s.variance = (1 - alpha) * (s.variance + diff*incr)
+	s.count++
+}
+
+// Describe implements the prometheus.Collector interface.
+func (d *Detector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.anomaly
+	ch <- d.score
+}
+
+// Collect implements the prometheus.Collector interface. Readings are only exported after the warm-up.
+func (d *Detector) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, h := range d.thermostats {
+		for name, s := range h.stats {
+			if s.count <= warmup {
+				continue
+			}
+
+			anomaly := 0.0
+			if math.Abs(s.score) >= d.threshold {
+				anomaly = 1
+			}
+
+			labels := d.labels.Values(h.therm, name)
+			ch <- prometheus.MustNewConstMetric(d.anomaly, prometheus.GaugeValue, anomaly, labels...)
+			ch <- prometheus.MustNewConstMetric(d.score, prometheus.GaugeValue, s.score, labels...)
+		}
+	}
+}
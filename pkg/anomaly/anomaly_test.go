@@ -0,0 +1,71 @@
+package anomaly
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func thermostat(temp, humidity float64, at time.Time) []*nest.Thermostat {
+	return []*nest.Thermostat{{
+		ID:          "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:    "DEVICE_ID",
+		Label:       "Living-Room",
+		AmbientTemp: temp,
+		Humidity:    humidity,
+		UpdatedAt:   at,
+	}}
+}
+
+func TestDetector(t *testing.T) {
+	d, err := New(Config{})
+	assert.NoError(t, err)
+	listener := d.Listener()
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < warmup; i++ {
+		temp := 20.0
+		if i%2 == 1 {
+			temp = 20.5
+		}
+		listener(thermostat(temp, 45, now.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.Equal(t, 0, testutil.CollectAndCount(d), "readings aren't scored during the warm-up")
+
+	now = now.Add(warmup * time.Minute)
+	listener(thermostat(20.5, 45, now))
+	assert.Equal(t, 4, testutil.CollectAndCount(d), "anomaly and score of both readings")
+
+	// A sensor failing to -40°C is an anomaly, the stable humidity isn't.
+	listener(thermostat(-40, 45, now.Add(time.Minute)))
+	expected := `
+# HELP nest_reading_anomaly Whether the latest reading deviates from the moving average by at least the threshold.
+# TYPE nest_reading_anomaly gauge
+nest_reading_anomaly{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room",reading="humidity"} 0
+nest_reading_anomaly{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room",reading="temperature"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(expected), "nest_reading_anomaly"))
+}
+
+func TestEWMA(t *testing.T) {
+	s := &ewma{}
+	for i := 0; i < 1000; i++ {
+		s.add(20, DefaultAlpha, 0.2)
+	}
+	assert.InDelta(t, 20, s.mean, 0.001)
+	assert.InDelta(t, 0, s.variance, 0.001)
+
+	// The minimum deviation keeps stable readings from making the slightest change an anomaly.
+	s.add(20.1, DefaultAlpha, 0.2)
+	assert.InDelta(t, 0.5, s.score, 0.001)
+}
+
+func TestInvalidParameters(t *testing.T) {
+	_, err := New(Config{Alpha: 2})
+	assert.Equal(t, errInvalidParameters, err)
+}
@@ -0,0 +1,255 @@
+// Package api serves the current readings of thermostats and weather as JSON, for scripts and home dashboards which
+// don't parse the Prometheus text format. Updates of readings are also pushed to clients as Server-Sent Events.
+//
+// The Server doesn't call any API itself. It keeps the latest readings passed to its listeners by the collectors,
+// so requests don't consume the Device Access quota.
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+// Paths of the endpoints served by the Server.
+const (
+	ThermostatsPath = "/api/v1/thermostats"
+	WeatherPath     = "/api/v1/weather"
+	StreamPath      = "/stream"
+)
+
+// Names of events sent to the stream.
+const (
+	thermostatsEvent = "thermostats"
+	weatherEvent     = "weather"
+)
+
+const (
+	// keepAliveInterval is how often a comment is sent to idle streams, so proxies don't close them.
+	keepAliveInterval = 30 * time.Second
+	// clientBuffer is the number of events buffered for a stream. Slow clients miss events when it's full.
+	clientBuffer = 16
+)
+
+// Weather is the current weather in the JSON response. Temperature is always in Celsius, like temperatures
+// of thermostats.
+type Weather struct {
+	Temperature float64   `json:"temperature_celsius"`
+	Humidity    float64   `json:"humidity_percent"`
+	Pressure    float64   `json:"pressure_hectopascal"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Config provides the configuration of the Server. ID returns the id of a thermostat in responses and events, it
+// should apply the same id policy as the Nest collector. If it's nil, the resource name of the thermostat is used.
+type Config struct {
+	ID func(therm *nest.Thermostat) string
+}
+
+// Server serves the latest readings.
+type Server struct {
+	id          func(therm *nest.Thermostat) string
+	mu          sync.RWMutex
+	thermostats []*nest.Thermostat
+	weather     *Weather
+	mux         *http.ServeMux
+
+	clients   map[chan []byte]struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	keepAlive time.Duration
+}
+
+// New creates a Server without any readings.
+func New(cfg Config) *Server {
+	if cfg.ID == nil {
+		cfg.ID = func(therm *nest.Thermostat) string { return therm.ID }
+	}
+
+	s := &Server{
+		id:          cfg.ID,
+		thermostats: []*nest.Thermostat{},
+		mux:         http.NewServeMux(),
+		clients:     make(map[chan []byte]struct{}),
+		done:        make(chan struct{}),
+		keepAlive:   keepAliveInterval,
+	}
+
+	s.mux.HandleFunc(ThermostatsPath, s.serveThermostats)
+	s.mux.HandleFunc(WeatherPath, s.serveWeather)
+	s.mux.HandleFunc(StreamPath, s.serveStream)
+
+	return s
+}
+
+// ThermostatListener returns a nest.Listener updating readings of thermostats.
+func (s *Server) ThermostatListener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.thermostats = thermostats
+		s.broadcast(thermostatsEvent, s.published(thermostats))
+	}
+}
+
+// WeatherListener returns a weather.Listener updating the weather.
+func (s *Server) WeatherListener() weather.Listener {
+	return func(w *weather.Weather) {
+		temp := units.ToCelsius(w.Temperature, w.Unit)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.weather = &Weather{
+			Temperature: temp,
+			Humidity:    w.Humidity,
+			Pressure:    w.Pressure,
+			UpdatedAt:   w.UpdatedAt,
+		}
+		s.broadcast(weatherEvent, s.weather)
+	}
+}
+
+// Thermostats returns the latest readings of thermostats, with their resource names, so they can be used to execute
+// commands. They must not be modified.
+func (s *Server) Thermostats() []*nest.Thermostat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.thermostats
+}
+
+// Weather returns the current weather, or nil until the first collection.
+func (s *Server) Weather() *Weather {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.weather
+}
+
+// Close ends all streams, so they don't block the graceful shutdown of the HTTP server.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// serveThermostats writes readings of all thermostats as a JSON array. It's empty until the first collection.
+func (s *Server) serveThermostats(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	thermostats := s.thermostats
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, s.published(thermostats))
+}
+
+// published returns copies of the readings with the id returned by the id function of the Config.
+func (s *Server) published(thermostats []*nest.Thermostat) []*nest.Thermostat {
+	result := make([]*nest.Thermostat, 0, len(thermostats))
+	for _, therm := range thermostats {
+		result = append(result, therm.WithID(s.id(therm)))
+	}
+	return result
+}
+
+// serveWeather writes the current weather as a JSON object. It responds with 404 until the first collection or if
+// the weather isn't collected at all.
+func (s *Server) serveWeather(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	current := s.weather
+	s.mu.RUnlock()
+
+	if current == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no weather readings available"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, current)
+}
+
+// serveStream sends readings as Server-Sent Events: "thermostats" with the same data as ThermostatsPath and "weather"
+// with the same data as WeatherPath. The current readings are sent right after connecting, then every update.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events := make(chan []byte, clientBuffer)
+
+	s.mu.Lock()
+	events <- formatEvent(thermostatsEvent, s.thermostats)
+	if s.weather != nil {
+		events <- formatEvent(weatherEvent, s.weather)
+	}
+	s.clients[events] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, events)
+		s.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			w.Write(event)
+		case <-ticker.C:
+			w.Write([]byte(": keep-alive\n\n"))
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// broadcast sends the event to all streams. It must be called with the mutex held.
+func (s *Server) broadcast(name string, v interface{}) {
+	if len(s.clients) == 0 {
+		return
+	}
+
+	event := formatEvent(name, v)
+	for client := range s.clients {
+		select {
+		case client <- event:
+		default:
+			// Don't block collections because of a slow client.
+		}
+	}
+}
+
+// formatEvent formats a Server-Sent Event with the JSON encoded data.
+func formatEvent(name string, v interface{}) []byte {
+	data, _ := json.Marshal(v)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", name, data)
+	return buf.Bytes()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
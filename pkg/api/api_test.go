@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+)
+
+var updatedAt = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		thermostats []*nest.Thermostat
+		weather     *weather.Weather
+		path        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:     "no thermostat readings",
+			path:     ThermostatsPath,
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		}, {
+			name: "thermostat readings",
+			thermostats: []*nest.Thermostat{{
+				ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+				DeviceID:     "DEVICE_ID",
+				Label:        "Thermostat",
+				Room:         "Living Room",
+				AmbientTemp:  20.5,
+				SetpointTemp: 19,
+				Humidity:     45,
+				Status:       "HEATING",
+				Mode:         "HEAT",
+				UpdatedAt:    updatedAt,
+			}},
+			path:     ThermostatsPath,
+			wantCode: http.StatusOK,
+			wantBody: `[{"id":"enterprises/PROJECT_ID/devices/DEVICE_ID","device_id":"DEVICE_ID","label":"Thermostat","room":"Living Room","ambient_temperature_celsius":20.5,"setpoint_temperature_celsius":19,"humidity_percent":45,"hvac_status":"HEATING","mode":"HEAT","temperature_scale":"","connectivity":"","updated_at":"2020-01-01T00:00:00Z"}]`,
+		}, {
+			name:     "no weather readings",
+			path:     WeatherPath,
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":"no weather readings available"}`,
+		}, {
+			name:     "weather in celsius",
+			weather:  &weather.Weather{Temperature: 20.26, Humidity: 88, Pressure: 1021, Unit: "celsius", UpdatedAt: updatedAt},
+			path:     WeatherPath,
+			wantCode: http.StatusOK,
+			wantBody: `{"temperature_celsius":20.26,"humidity_percent":88,"pressure_hectopascal":1021,"updated_at":"2020-01-01T00:00:00Z"}`,
+		}, {
+			name:     "weather in fahrenheit",
+			weather:  &weather.Weather{Temperature: 68, Humidity: 88, Pressure: 1021, Unit: "fahrenheit", UpdatedAt: updatedAt},
+			path:     WeatherPath,
+			wantCode: http.StatusOK,
+			wantBody: `{"temperature_celsius":20,"humidity_percent":88,"pressure_hectopascal":1021,"updated_at":"2020-01-01T00:00:00Z"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{})
+			if tt.thermostats != nil {
+				s.ThermostatListener()(tt.thermostats)
+			}
+			if tt.weather != nil {
+				s.WeatherListener()(tt.weather)
+			}
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := New(Config{})
+	s.keepAlive = 10 * time.Millisecond
+	s.ThermostatListener()([]*nest.Thermostat{{DeviceID: "DEVICE_ID", AmbientTemp: 20}})
+
+	serv := httptest.NewServer(s)
+	defer serv.Close()
+
+	res, err := http.Get(serv.URL + StreamPath)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	r := bufio.NewReader(res.Body)
+
+	// Current readings are sent right after connecting.
+	assert.Equal(t, "event: thermostats\n", readLine(t, r))
+	assert.Contains(t, readLine(t, r), `"device_id":"DEVICE_ID","label":"","room":"","ambient_temperature_celsius":20`)
+	assert.Equal(t, "\n", readLine(t, r))
+
+	// Idle streams receive comments.
+	assert.Equal(t, ": keep-alive\n", readLine(t, r))
+	assert.Equal(t, "\n", readLine(t, r))
+
+	s.WeatherListener()(&weather.Weather{Temperature: 10, Unit: "celsius", UpdatedAt: updatedAt})
+	for line := readLine(t, r); line != "event: weather\n"; line = readLine(t, r) {
+	}
+	assert.Equal(t, `data: {"temperature_celsius":10,"humidity_percent":0,"pressure_hectopascal":0,"updated_at":"2020-01-01T00:00:00Z"}`+"\n", readLine(t, r))
+
+	// Closing the server ends the stream.
+	s.Close()
+	for {
+		if _, err := r.ReadString('\n'); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	therm := &nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID", DeviceID: "DEVICE_ID"}
+	s := New(Config{ID: func(therm *nest.Thermostat) string { return nest.IDLabel(nest.IDShort, therm.ID) }})
+	s.ThermostatListener()([]*nest.Thermostat{therm})
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ThermostatsPath, nil))
+
+	assert.Contains(t, w.Body.String(), `"id":"DEVICE_ID"`)
+	// Commands are executed with the resource name.
+	assert.Equal(t, "enterprises/PROJECT_ID/devices/DEVICE_ID", s.Thermostats()[0].ID)
+}
+
+func readLine(t *testing.T, r *bufio.Reader) string {
+	line, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	return line
+}
@@ -0,0 +1,185 @@
+// Package archiver appends thermostat readings to local CSV files, for archiving raw data independently of
+// the retention of the time series database.
+//
+// Readings are appended to "pronestheus.csv" in the archive directory. When the file exceeds the maximum size,
+// it's renamed to "pronestheus-<timestamp>.csv" and a new one is started. The oldest rotated files are removed
+// when there are more than the maximum number of them.
+package archiver
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+const (
+	currentFile    = "pronestheus.csv"
+	rotatedPattern = "pronestheus-*.csv"
+	rotatedLayout  = "20060102T150405.000000000"
+)
+
+var (
+	errFailedOpening  = errors.New("failed opening archive file")
+	errFailedWriting  = errors.New("failed writing archive file")
+	errFailedRotating = errors.New("failed rotating archive file")
+)
+
+// header contains the names of CSV columns. Reading columns match the generic format of the backfill command.
+var header = []string{
+	"timestamp", "id", "device_id", "label",
+	"ambient_temperature_celsius", "setpoint_temperature_celsius", "humidity_percent", "hvac_status", "mode",
+}
+
+// Config provides the configuration necessary to create the Archiver.
+// Logger is optional, if it's nil the Archiver doesn't log anything. MaxSize and MaxFiles are unlimited if 0.
+type Config struct {
+	Logger   log.Logger
+	Dir      string
+	MaxSize  int64
+	MaxFiles int
+}
+
+// Archiver appends readings to CSV files with rotation.
+type Archiver struct {
+	mu       sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	logger   log.Logger
+	now      func() time.Time
+}
+
+// New creates an Archiver using the given Config, creating the archive directory if necessary.
+func New(cfg Config) (*Archiver, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	return &Archiver{
+		dir:      cfg.Dir,
+		maxSize:  cfg.MaxSize,
+		maxFiles: cfg.MaxFiles,
+		logger:   cfg.Logger,
+		now:      time.Now,
+	}, nil
+}
+
+// Listener returns a nest.Listener archiving readings, logging errors instead of returning them.
+func (a *Archiver) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		if err := a.Write(thermostats); err != nil {
+			a.logger.Log("level", "error", "message", "Failed archiving readings", "stack", errors.WithStack(err))
+		}
+	}
+}
+
+// Write appends a row for every reading to the current archive file, rotating it first if it's too big.
+func (a *Archiver) Write(thermostats []*nest.Thermostat) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.rotate(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(a.dir, currentFile)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(errFailedOpening, err.Error())
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(header)
+	}
+
+	for _, therm := range thermostats {
+		timestamp := therm.UpdatedAt
+		if timestamp.IsZero() {
+			timestamp = a.now()
+		}
+
+		w.Write([]string{
+			timestamp.UTC().Format(time.RFC3339),
+			therm.ID,
+			therm.DeviceID,
+			therm.Label,
+			formatFloat(therm.AmbientTemp),
+			formatFloat(therm.SetpointTemp),
+			formatFloat(therm.Humidity),
+			therm.Status,
+			therm.Mode,
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	return nil
+}
+
+// rotate renames the current file if it exceeds the maximum size and removes the oldest rotated files.
+func (a *Archiver) rotate() error {
+	if a.maxSize <= 0 {
+		return nil
+	}
+
+	path := filepath.Join(a.dir, currentFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.Size() < a.maxSize) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(errFailedRotating, err.Error())
+	}
+
+	rotated := filepath.Join(a.dir, "pronestheus-"+a.now().UTC().Format(rotatedLayout)+".csv")
+	if err := os.Rename(path, rotated); err != nil {
+		return errors.Wrap(errFailedRotating, err.Error())
+	}
+
+	if a.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(a.dir, rotatedPattern))
+	if err != nil {
+		return errors.Wrap(errFailedRotating, err.Error())
+	}
+
+	// Timestamps in names make the lexical order chronological.
+	sort.Strings(files)
+	for len(files) > a.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return errors.Wrap(errFailedRotating, err.Error())
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,73 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var reading = &nest.Thermostat{
+	ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+	DeviceID:     "DEVICE_ID",
+	Label:        "Living Room",
+	AmbientTemp:  20.5,
+	SetpointTemp: 19,
+	Humidity:     45,
+	Status:       "HEATING",
+	Mode:         "HEAT",
+	UpdatedAt:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archiver")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, err := New(Config{Dir: dir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, a.Write([]*nest.Thermostat{reading}))
+	assert.NoError(t, a.Write([]*nest.Thermostat{reading}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, currentFile))
+	assert.NoError(t, err)
+
+	row := "2020-01-01T00:00:00Z,enterprises/PROJECT_ID/devices/DEVICE_ID,DEVICE_ID,Living Room,20.5,19,45,HEATING,HEAT\n"
+	assert.Equal(t, "timestamp,id,device_id,label,ambient_temperature_celsius,setpoint_temperature_celsius,humidity_percent,hvac_status,mode\n"+row+row, string(data))
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archiver")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, err := New(Config{Dir: dir, MaxSize: 1, MaxFiles: 2})
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, a.Write([]*nest.Thermostat{reading}))
+	}
+
+	// Every write exceeds the maximum size, so all but the current one are rotated and only the newest two are kept.
+	rotated, err := filepath.Glob(filepath.Join(dir, rotatedPattern))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "pronestheus-20200101T000002.000000000.csv"),
+		filepath.Join(dir, "pronestheus-20200101T000003.000000000.csv"),
+	}, rotated)
+
+	_, err = os.Stat(filepath.Join(dir, currentFile))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"pronestheus/pkg/collectors/awair"
+)
+
+// registerAwairCollector registers the collector of Awair devices if any device is configured.
+func (e *Exporter) registerAwairCollector(cfg *ExporterConfig) error {
+	if cfg.AwairDevices == nil || len(*cfg.AwairDevices) == 0 {
+		return nil
+	}
+
+	awairCfg, err := awairConfig(cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	awairCollector, err := awair.NewWithContext(e.ctx, awairCfg)
+	if err != nil {
+		return err
+	}
+
+	return e.register(cfg, "awair", awairCollector)
+}
+
+// awairConfig converts the ExporterConfig into the Awair collector Config.
+func awairConfig(cfg *ExporterConfig, logger log.Logger) (awair.Config, error) {
+	awairCfg := awair.Config{
+		Logger:    logger,
+		Timeout:   int(cfg.collectorTimeout("awair") / time.Millisecond),
+		Transport: cfg.transport(nil),
+	}
+
+	for _, text := range *cfg.AwairDevices {
+		device, err := awair.ParseDevice(text)
+		if err != nil {
+			return awairCfg, err
+		}
+		awairCfg.Devices = append(awairCfg.Devices, device)
+	}
+
+	return awairCfg, nil
+}
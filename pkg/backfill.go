@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/backfill"
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/importers/takeout"
+)
+
+// Backfill converts historical thermostat readings into OpenMetrics written to out. Paths are either Google Takeout
+// archives (zip files or extracted directories) or CSV files. Dates and times of Takeout files are interpreted
+// in the timezone.
+//
+// Readings from CSV files belong to a single thermostat with the given device ID and label. Thermostats from Takeout
+// archives are identified by their device IDs, labelled with their aliases, the given label or the device ID.
+// Labels should match the live metrics of the thermostats, so the imported data continues them.
+func Backfill(cfg *ExporterConfig, paths []string, deviceID string, label string, timezone string, out io.Writer) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return errors.Wrap(errInvalidValue, "timezone: "+err.Error())
+	}
+
+	var series []backfill.Series
+	var readings []backfill.Reading
+
+	for _, path := range paths {
+		if isArchive(path) {
+			archive, err := takeout.Open(path, loc)
+			if err != nil {
+				return err
+			}
+
+			for _, device := range archive.Devices {
+				series = append(series, backfillSeries(cfg, device.ID, deviceLabel(cfg, device.ID, label), backfill.FromTakeout(device)))
+			}
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		fileReadings, err := backfill.ReadCSV(f, loc)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+
+		readings = append(readings, fileReadings...)
+	}
+
+	if len(readings) > 0 {
+		if deviceID == "" || label == "" {
+			return errors.Wrap(errMissingValue, "device-id and label are required for CSV files")
+		}
+		series = append(series, backfillSeries(cfg, deviceID, label, readings))
+	}
+
+	unit := ""
+	if cfg.NestUnit != nil {
+		unit = *cfg.NestUnit
+	}
+
+	return backfill.WriteOpenMetrics(out, series, unit)
+}
+
+// isArchive returns true if the path is a directory or a zip file.
+func isArchive(path string) bool {
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// deviceLabel returns the label of the thermostat from a Takeout archive: its alias if configured, the given label
+// or its device ID.
+func deviceLabel(cfg *ExporterConfig, deviceID string, label string) string {
+	if cfg.NestAliases != nil {
+		if alias, ok := (*cfg.NestAliases)[deviceID]; ok {
+			return alias
+		}
+	}
+
+	if label != "" {
+		return label
+	}
+
+	return deviceID
+}
+
+func backfillSeries(cfg *ExporterConfig, deviceID string, label string, readings []backfill.Reading) backfill.Series {
+	series := backfill.Series{
+		ID:       deviceID,
+		DeviceID: deviceID,
+		Label:    label,
+		Readings: readings,
+	}
+
+	if cfg.NestProjectID != nil && *cfg.NestProjectID != "" {
+		series.ID = "enterprises/" + *cfg.NestProjectID + "/devices/" + deviceID
+	}
+	series.ID = nest.IDLabel(cfg.idPolicy(), series.ID)
+	if cfg.idPolicy() == nest.IDNone {
+		series.ID = ""
+	}
+
+	return series
+}
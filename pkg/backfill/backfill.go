@@ -0,0 +1,245 @@
+// Package backfill converts historical thermostat readings into the OpenMetrics text format, which can be imported
+// into Prometheus with "promtool tsdb create-blocks-from openmetrics".
+//
+// Readings come either from Google Takeout archives, parsed by the takeout package, or from CSV files.
+// Two CSV layouts are supported, detected by the header:
+//
+// Google Takeout sensor files (eg. "2020-01-sensors.csv"), with local date and time of every reading:
+//
+//	Date,Time,avg(temp),avg(humidity)
+//	2020-01-01,00:00,20.5,45.0
+//
+// Generic files with RFC 3339 timestamps and any of the thermostat readings:
+//
+//	timestamp,ambient_temperature_celsius,setpoint_temperature_celsius,humidity_percent
+//	2020-01-01T00:00:00Z,20.5,19.0,45.0
+package backfill
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/importers/takeout"
+	"pronestheus/pkg/units"
+)
+
+var (
+	errUnknownFormat  = errors.New("unknown CSV format; expected Google Takeout sensors or generic timestamp columns")
+	errFailedReading  = errors.New("failed reading CSV file")
+	errInvalidReading = errors.New("invalid reading")
+)
+
+// Reading kinds, named after the thermostat metrics without the "nest_" prefix and the unit.
+const (
+	ambientTemp  = "ambient_temperature"
+	setpointTemp = "setpoint_temperature"
+	humidity     = "humidity_percent"
+	heating      = "heating"
+)
+
+// columns maps CSV column names to reading kinds.
+var columns = map[string]string{
+	"avg(temp)":                    ambientTemp,
+	"avg(humidity)":                humidity,
+	"ambient_temperature_celsius":  ambientTemp,
+	"setpoint_temperature_celsius": setpointTemp,
+	"humidity_percent":             humidity,
+}
+
+// Reading is a single historical reading of a thermostat. Temperatures are in Celsius.
+type Reading struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// ReadCSV reads historical readings from a CSV file. Local dates and times of Google Takeout files are interpreted
+// in the given location. Empty cells are skipped.
+func ReadCSV(r io.Reader, loc *time.Location) ([]Reading, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(errFailedReading, err.Error())
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(errFailedReading, err.Error())
+	}
+
+	if len(rows) == 0 {
+		return nil, errUnknownFormat
+	}
+
+	header := rows[0]
+	if takeout.IsSensorsHeader(header) {
+		thermostats, err := takeout.ParseSensors(bytes.NewReader(data), "", loc)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidReading, err.Error())
+		}
+		return FromThermostats(thermostats), nil
+	}
+
+	parseTime, err := timeParser(header, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var readings []Reading
+	for i, row := range rows[1:] {
+		t, err := parseTime(row)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidReading, fmt.Sprintf("line %d: %s", i+2, err))
+		}
+
+		reading := Reading{Time: t, Values: make(map[string]float64)}
+		for col, name := range header {
+			kind, ok := columns[strings.TrimSpace(name)]
+			if !ok || col >= len(row) || strings.TrimSpace(row[col]) == "" {
+				continue
+			}
+
+			value, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64)
+			if err != nil {
+				return nil, errors.Wrap(errInvalidReading, fmt.Sprintf("line %d: %s", i+2, err))
+			}
+			reading.Values[kind] = value
+		}
+
+		readings = append(readings, reading)
+	}
+
+	return readings, nil
+}
+
+// timeParser returns the function parsing the time of a row, depending on the columns in the header.
+func timeParser(header []string, loc *time.Location) (func(row []string) (time.Time, error), error) {
+	for i, name := range header {
+		if strings.TrimSpace(name) == "timestamp" {
+			return func(row []string) (time.Time, error) {
+				return time.Parse(time.RFC3339, row[i])
+			}, nil
+		}
+	}
+
+	return nil, errUnknownFormat
+}
+
+// FromThermostats converts readings of the thermostat model into backfill readings, using the time of the reading.
+// NaN values are skipped.
+func FromThermostats(thermostats []*nest.Thermostat) []Reading {
+	var readings []Reading
+	for _, therm := range thermostats {
+		reading := Reading{Time: therm.UpdatedAt, Values: make(map[string]float64)}
+		if !math.IsNaN(therm.AmbientTemp) {
+			reading.Values[ambientTemp] = therm.AmbientTemp
+		}
+		if !math.IsNaN(therm.Humidity) {
+			reading.Values[humidity] = therm.Humidity
+		}
+		readings = append(readings, reading)
+	}
+	return readings
+}
+
+// FromTakeout converts the history of a thermostat from a Takeout archive into backfill readings.
+// Heating cycles are converted into heating state changes at their start and end.
+func FromTakeout(device *takeout.Device) []Reading {
+	readings := FromThermostats(device.Readings)
+	for _, cycle := range device.Cycles {
+		if !cycle.Heating {
+			continue
+		}
+		readings = append(readings,
+			Reading{Time: cycle.Start, Values: map[string]float64{heating: 1}},
+			Reading{Time: cycle.End, Values: map[string]float64{heating: 0}},
+		)
+	}
+	return readings
+}
+
+// Series contains the readings of a thermostat. Labels should match the ones of the live metrics,
+// so the backfilled data continues the existing series. The id label is omitted if ID is empty.
+type Series struct {
+	ID       string
+	DeviceID string
+	Label    string
+	Readings []Reading
+}
+
+// family describes a metric family written by WriteOpenMetrics.
+type family struct {
+	name string
+	help string
+	kind string
+	unit string
+}
+
+// WriteOpenMetrics writes the readings of all series as OpenMetrics gauges in the given temperature unit: celsius,
+// fahrenheit, kelvin or both. Readings are sorted by time, as required by promtool.
+func WriteOpenMetrics(w io.Writer, series []Series, unit string) error {
+	exported, err := units.Parse(unit)
+	if err != nil {
+		return err
+	}
+
+	var families []family
+	for _, u := range exported {
+		families = append(families,
+			family{"nest_ambient_temperature_" + u, "Inside temperature.", ambientTemp, u},
+			family{"nest_setpoint_temperature_" + u, "Setpoint temperature.", setpointTemp, u},
+		)
+	}
+	families = append(families,
+		family{"nest_humidity_percent", "Inside humidity.", humidity, ""},
+		family{"nest_heating", "Is thermostat heating.", heating, ""},
+	)
+
+	sorted := make([][]Reading, len(series))
+	for i, s := range series {
+		sorted[i] = make([]Reading, len(s.Readings))
+		copy(sorted[i], s.Readings)
+		sort.SliceStable(sorted[i], func(a, b int) bool { return sorted[i][a].Time.Before(sorted[i][b].Time) })
+	}
+
+	// All series of a metric family must be written together.
+	for _, family := range families {
+		header := false
+		for i, s := range series {
+			labels := fmt.Sprintf(`{device_id=%q,label=%q}`, s.DeviceID, s.Label)
+			if s.ID != "" {
+				labels = fmt.Sprintf(`{id=%q,device_id=%q,label=%q}`, s.ID, s.DeviceID, s.Label)
+			}
+
+			for _, reading := range sorted[i] {
+				value, ok := reading.Values[family.kind]
+				if !ok {
+					continue
+				}
+
+				if !header {
+					fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", family.name, family.help, family.name)
+					header = true
+				}
+
+				if family.unit != "" {
+					value = units.FromCelsius(value, family.unit)
+				}
+
+				fmt.Fprintf(w, "%s%s %s %d\n", family.name, labels, strconv.FormatFloat(value, 'f', -1, 64), reading.Time.Unix())
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "# EOF")
+	return err
+}
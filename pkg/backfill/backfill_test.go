@@ -0,0 +1,131 @@
+package backfill
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/units"
+)
+
+func TestReadCSV(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Reading
+		wantErr error
+	}{
+		{
+			name: "google takeout",
+			csv:  "Date,Time,avg(temp),avg(humidity)\n2020-01-01,00:00,20.5,45.0\n2020-01-01,00:15,,46\n",
+			want: []Reading{
+				{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, amsterdam), Values: map[string]float64{ambientTemp: 20.5, humidity: 45}},
+				{Time: time.Date(2020, 1, 1, 0, 15, 0, 0, amsterdam), Values: map[string]float64{humidity: 46}},
+			},
+		}, {
+			name: "generic",
+			csv:  "timestamp,ambient_temperature_celsius,setpoint_temperature_celsius,humidity_percent,ignored\n2020-01-01T00:00:00Z,20.5,19,45,x\n",
+			want: []Reading{
+				{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Values: map[string]float64{ambientTemp: 20.5, setpointTemp: 19, humidity: 45}},
+			},
+		}, {
+			name:    "unknown format",
+			csv:     "when,temp\n2020,20\n",
+			wantErr: errUnknownFormat,
+		}, {
+			name:    "empty file",
+			csv:     "",
+			wantErr: errUnknownFormat,
+		}, {
+			name:    "invalid time",
+			csv:     "Date,Time,avg(temp)\n2020-01-01,noon,20\n",
+			wantErr: errInvalidReading,
+		}, {
+			name:    "invalid value",
+			csv:     "Date,Time,avg(temp)\n2020-01-01,12:00,warm\n",
+			wantErr: errInvalidReading,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			readings, err := ReadCSV(strings.NewReader(test.csv), amsterdam)
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, len(test.want), len(readings))
+			for i := range test.want {
+				assert.True(t, test.want[i].Time.Equal(readings[i].Time))
+				assert.Equal(t, test.want[i].Values, readings[i].Values)
+			}
+		})
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	series := Series{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID", DeviceID: "DEVICE_ID", Label: "Living-Room"}
+	series.Readings = []Reading{
+		{Time: time.Unix(1577837700, 0), Values: map[string]float64{ambientTemp: 21, humidity: 46}},
+		{Time: time.Unix(1577836800, 0), Values: map[string]float64{ambientTemp: 20.5, humidity: 45}},
+	}
+
+	var out bytes.Buffer
+	err := WriteOpenMetrics(&out, []Series{series}, "both")
+	assert.NoError(t, err)
+
+	labels := `{id="enterprises/PROJECT_ID/devices/DEVICE_ID",device_id="DEVICE_ID",label="Living-Room"}`
+	assert.Equal(t, `# HELP nest_ambient_temperature_celsius Inside temperature.
+# TYPE nest_ambient_temperature_celsius gauge
+nest_ambient_temperature_celsius`+labels+` 20.5 1577836800
+nest_ambient_temperature_celsius`+labels+` 21 1577837700
+# HELP nest_ambient_temperature_fahrenheit Inside temperature.
+# TYPE nest_ambient_temperature_fahrenheit gauge
+nest_ambient_temperature_fahrenheit`+labels+` 68.9 1577836800
+nest_ambient_temperature_fahrenheit`+labels+` 69.8 1577837700
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent`+labels+` 45 1577836800
+nest_humidity_percent`+labels+` 46 1577837700
+# EOF
+`, out.String())
+
+	out.Reset()
+	err = WriteOpenMetrics(&out, []Series{series}, "kelvin")
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "nest_ambient_temperature_kelvin"+labels+" 293.65 1577836800\n")
+
+	err = WriteOpenMetrics(&out, []Series{series}, "rankine")
+	assert.True(t, errors.Is(err, units.ErrInvalidUnit))
+}
+
+func TestWriteOpenMetricsMultipleSeries(t *testing.T) {
+	series := []Series{
+		{ID: "A", DeviceID: "A", Label: "a", Readings: []Reading{{Time: time.Unix(10, 0), Values: map[string]float64{ambientTemp: 20, heating: 1}}}},
+		{DeviceID: "B", Label: "b", Readings: []Reading{{Time: time.Unix(10, 0), Values: map[string]float64{ambientTemp: 18}}}},
+	}
+
+	var out bytes.Buffer
+	err := WriteOpenMetrics(&out, series, "celsius")
+	assert.NoError(t, err)
+
+	// Series of the same family must be written together, the id label is omitted without ID.
+	assert.Equal(t, `# HELP nest_ambient_temperature_celsius Inside temperature.
+# TYPE nest_ambient_temperature_celsius gauge
+nest_ambient_temperature_celsius{id="A",device_id="A",label="a"} 20 10
+nest_ambient_temperature_celsius{device_id="B",label="b"} 18 10
+# HELP nest_heating Is thermostat heating.
+# TYPE nest_heating gauge
+nest_heating{id="A",device_id="A",label="a"} 1 10
+# EOF
+`, out.String())
+}
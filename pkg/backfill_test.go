@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "2020-01-sensors.csv")
+	err = ioutil.WriteFile(file, []byte("Date,Time,avg(temp),avg(humidity)\n2020-01-01,00:00,20.5,45.0\n"), 0644)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	err = Backfill(testConfig(), []string{file}, "DEVICE_ID", "Living-Room", "UTC", &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), `nest_ambient_temperature_celsius{id="enterprises/dummy/devices/DEVICE_ID",device_id="DEVICE_ID",label="Living-Room"} 20.5 1577836800`)
+
+	err = Backfill(testConfig(), []string{file}, "DEVICE_ID", "Living-Room", "Mars/Olympus_Mons", &out)
+	assert.Error(t, err)
+
+	err = Backfill(testConfig(), []string{file}, "", "", "UTC", &out)
+	assert.True(t, errors.Is(err, errMissingValue))
+}
+
+func TestBackfillTakeout(t *testing.T) {
+	cfg := testConfig()
+	cfg.NestAliases = &map[string]string{"DEVICE_1": "Living-Room"}
+
+	var out bytes.Buffer
+	err := Backfill(cfg, []string{"importers/takeout/testdata"}, "", "", "UTC", &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), `nest_ambient_temperature_celsius{id="enterprises/dummy/devices/DEVICE_1",device_id="DEVICE_1",label="Living-Room"} 20.5 1577836800`)
+	assert.Contains(t, out.String(), `nest_ambient_temperature_celsius{id="enterprises/dummy/devices/DEVICE_2",device_id="DEVICE_2",label="DEVICE_2"} 19 1580558400`)
+	assert.Contains(t, out.String(), `nest_heating{id="enterprises/dummy/devices/DEVICE_1",device_id="DEVICE_1",label="Living-Room"} 1 1577858400`)
+}
@@ -0,0 +1,246 @@
+// Package balance computes the difference between inside and outside temperatures and estimates the balance point
+// of the building: the outside temperature below which it needs heating.
+//
+// Readings of every thermostat in the HEAT or HEATCOOL mode are paired with the latest outside temperature and
+// aggregated into hourly buckets with the mean temperatures and the share of readings with the thermostat heating,
+// which approximates the heating runtime. Over a rolling window, the heating runtime is fitted with a linear
+// regression of the inside-outside differential. The differential at which the fitted runtime drops to zero,
+// subtracted from the mean inside temperature, is the balance point.
+package balance
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+const (
+	// DefaultWindow is the time range of readings used to estimate the balance point.
+	DefaultWindow = 7 * 24 * time.Hour
+
+	// DefaultMinHours is the number of hourly buckets needed to estimate the balance point.
+	DefaultMinHours = 24
+
+	// maxWeatherAge is the age after which the outside temperature is too old to be paired with readings.
+	maxWeatherAge = 2 * time.Hour
+)
+
+// Config provides the configuration necessary to create the Analyzer. Logger is optional, if it's nil the Analyzer
+// doesn't log anything. Unit is the temperature unit of metrics: celsius (default), fahrenheit, kelvin or both. Window and
+// MinHours default to DefaultWindow and DefaultMinHours. Labels identify thermostats in the balance point metrics.
+type Config struct {
+	Logger   log.Logger
+	Unit     string
+	Window   time.Duration
+	MinHours int
+	Labels   nest.MetricLabels
+}
+
+// Analyzer collects readings of thermostats and the weather and exports the computed metrics.
+type Analyzer struct {
+	logger   log.Logger
+	units    []string
+	window   time.Duration
+	minHours int
+	labels   nest.MetricLabels
+	now      func() time.Time
+
+	mu          sync.Mutex
+	outside     *weather.Weather
+	thermostats map[string]*history
+
+	differential map[string]*prometheus.Desc
+	balancePoint map[string]*prometheus.Desc
+	hours        *prometheus.Desc
+}
+
+// history contains the latest reading and hourly buckets of a thermostat, ordered by time.
+type history struct {
+	therm   *nest.Thermostat
+	buckets []*bucket
+}
+
+// bucket aggregates readings of a thermostat within an hour.
+type bucket struct {
+	start   time.Time
+	inside  float64
+	outside float64
+	heating float64
+	count   float64
+}
+
+// New creates an Analyzer using the given Config.
+func New(cfg Config) (*Analyzer, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultWindow
+	}
+
+	if cfg.MinHours <= 0 {
+		cfg.MinHours = DefaultMinHours
+	}
+
+	exported, err := units.Parse(cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analyzer{
+		logger:       cfg.Logger,
+		units:        exported,
+		window:       cfg.Window,
+		minHours:     cfg.MinHours,
+		labels:       cfg.Labels,
+		now:          time.Now,
+		thermostats:  make(map[string]*history),
+		differential: make(map[string]*prometheus.Desc),
+		balancePoint: make(map[string]*prometheus.Desc),
+		hours:        prometheus.NewDesc("nest_balance_point_hours", "Number of hours of heating readings the balance point is estimated from.", cfg.Labels.Names(), nil),
+	}
+
+	for _, unit := range exported {
+		a.differential[unit] = prometheus.NewDesc("nest_temperature_differential_"+unit, "Difference between the inside and outside temperature.", cfg.Labels.Names(), nil)
+		a.balancePoint[unit] = prometheus.NewDesc("nest_balance_point_"+unit, "Estimated outside temperature below which the building needs heating.", cfg.Labels.Names(), nil)
+	}
+
+	return a, nil
+}
+
+// WeatherListener returns a weather.Listener keeping the latest outside temperature.
+func (a *Analyzer) WeatherListener() weather.Listener {
+	return func(w *weather.Weather) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.outside = w
+	}
+}
+
+// ThermostatListener returns a nest.Listener adding readings of thermostats to their hourly buckets.
+func (a *Analyzer) ThermostatListener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		now := a.now()
+		outside, ok := a.outsideTemp(now)
+
+		for _, therm := range thermostats {
+			h, found := a.thermostats[therm.ID]
+			if !found {
+				h = &history{}
+				a.thermostats[therm.ID] = h
+			}
+			h.therm = therm
+
+			if ok && (therm.Mode == "HEAT" || therm.Mode == "HEATCOOL") {
+				h.add(now, therm, outside)
+			}
+			h.prune(now.Add(-a.window))
+		}
+	}
+}
+
+// outsideTemp returns the latest outside temperature in Celsius, unless it's missing or outdated.
+func (a *Analyzer) outsideTemp(now time.Time) (float64, bool) {
+	if a.outside == nil || now.Sub(a.outside.UpdatedAt) > maxWeatherAge {
+		return 0, false
+	}
+
+	return units.ToCelsius(a.outside.Temperature, a.outside.Unit), true
+}
+
+func (h *history) add(now time.Time, therm *nest.Thermostat, outside float64) {
+	start := now.Truncate(time.Hour)
+	if len(h.buckets) == 0 || h.buckets[len(h.buckets)-1].start != start {
+		h.buckets = append(h.buckets, &bucket{start: start})
+	}
+
+	b := h.buckets[len(h.buckets)-1]
+	b.inside += therm.AmbientTemp
+	b.outside += outside
+	if therm.Status == "HEATING" {
+		b.heating++
+	}
+	b.count++
+}
+
+// prune drops buckets which started before the cutoff.
+func (h *history) prune(cutoff time.Time) {
+	i := sort.Search(len(h.buckets), func(i int) bool { return !h.buckets[i].start.Before(cutoff) })
+	h.buckets = h.buckets[i:]
+}
+
+// balancePoint estimates the balance point from the buckets in Celsius. It returns false if there aren't enough
+// buckets, or the heating runtime doesn't grow with the differential.
+func (h *history) balancePoint(minHours int) (float64, bool) {
+	if len(h.buckets) < minHours {
+		return 0, false
+	}
+
+	var sumX, sumY, sumInside float64
+	n := float64(len(h.buckets))
+	for _, b := range h.buckets {
+		sumX += (b.inside - b.outside) / b.count
+		sumY += b.heating / b.count
+		sumInside += b.inside / b.count
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, variance float64
+	for _, b := range h.buckets {
+		dx := (b.inside-b.outside)/b.count - meanX
+		covariance += dx * (b.heating/b.count - meanY)
+		variance += dx * dx
+	}
+
+	if variance == 0 || covariance <= 0 {
+		return 0, false
+	}
+
+	slope := covariance / variance
+	intercept := meanY - slope*meanX
+
+	// The runtime is zero at the differential -intercept/slope.
+	return sumInside/n + intercept/slope, true
+}
+
+// Describe implements the prometheus.Collector interface.
+func (a *Analyzer) Describe(ch chan<- *prometheus.Desc) {
+	for _, unit := range a.units {
+		ch <- a.differential[unit]
+		ch <- a.balancePoint[unit]
+	}
+	ch <- a.hours
+}
+
+// Collect implements the prometheus.Collector interface.
+func (a *Analyzer) Collect(ch chan<- prometheus.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	outside, ok := a.outsideTemp(a.now())
+	for _, h := range a.thermostats {
+		labels := a.labels.Values(h.therm)
+
+		balancePoint, estimated := h.balancePoint(a.minHours)
+		for _, unit := range a.units {
+			if ok {
+				ch <- prometheus.MustNewConstMetric(a.differential[unit], prometheus.GaugeValue, units.DiffFromCelsius(h.therm.AmbientTemp-outside, unit), labels...)
+			}
+			if estimated {
+				ch <- prometheus.MustNewConstMetric(a.balancePoint[unit], prometheus.GaugeValue, units.FromCelsius(balancePoint, unit), labels...)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(a.hours, prometheus.GaugeValue, float64(len(h.buckets)), labels...)
+	}
+}
@@ -0,0 +1,132 @@
+package balance
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// simulate feeds the analyzer with hourly readings of a building with the balance point at 15°C, kept at 20°C inside:
+// the heating runs for a fifteenth of the time for every degree below the balance point.
+func simulate(a *Analyzer, hours int, mode string) {
+	for hour := 0; hour < hours; hour++ {
+		outside := 1.5 * float64(hour%10)
+		heating := int(10 - outside/1.5)
+
+		for i := 0; i < 10; i++ {
+			now := start.Add(time.Duration(hour)*time.Hour + time.Duration(i)*5*time.Minute)
+			a.now = func() time.Time { return now }
+
+			status := "OFF"
+			if i < heating {
+				status = "HEATING"
+			}
+
+			a.WeatherListener()(&weather.Weather{Temperature: outside, Unit: units.Celsius, UpdatedAt: now})
+			a.ThermostatListener()([]*nest.Thermostat{{
+				ID:          "enterprises/PROJECT_ID/devices/DEVICE_ID",
+				DeviceID:    "DEVICE_ID",
+				Label:       "Living Room",
+				AmbientTemp: 20,
+				Status:      status,
+				Mode:        mode,
+			}})
+		}
+	}
+}
+
+func TestBalancePoint(t *testing.T) {
+	a, err := New(Config{Labels: nest.MetricLabels{Label: func(therm *nest.Thermostat) string { return strings.Replace(therm.Label, " ", "-", -1) }}})
+	assert.NoError(t, err)
+
+	simulate(a, 30, "HEAT")
+
+	// The last outside temperature is 1.5 * (29 % 10) = 13.5.
+	expected := `
+# HELP nest_balance_point_celsius Estimated outside temperature below which the building needs heating.
+# TYPE nest_balance_point_celsius gauge
+nest_balance_point_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 15
+# HELP nest_balance_point_hours Number of hours of heating readings the balance point is estimated from.
+# TYPE nest_balance_point_hours gauge
+nest_balance_point_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 30
+# HELP nest_temperature_differential_celsius Difference between the inside and outside temperature.
+# TYPE nest_temperature_differential_celsius gauge
+nest_temperature_differential_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 6.5
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected)))
+}
+
+func TestBalancePointFahrenheit(t *testing.T) {
+	a, err := New(Config{Unit: units.Fahrenheit})
+	assert.NoError(t, err)
+
+	simulate(a, 30, "HEATCOOL")
+
+	expected := `
+# HELP nest_balance_point_fahrenheit Estimated outside temperature below which the building needs heating.
+# TYPE nest_balance_point_fahrenheit gauge
+nest_balance_point_fahrenheit{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"} 59
+# HELP nest_temperature_differential_fahrenheit Difference between the inside and outside temperature.
+# TYPE nest_temperature_differential_fahrenheit gauge
+nest_temperature_differential_fahrenheit{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"} 11.7
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected), "nest_balance_point_fahrenheit", "nest_temperature_differential_fahrenheit"))
+}
+
+func TestNotEnoughReadings(t *testing.T) {
+	a, err := New(Config{})
+	assert.NoError(t, err)
+
+	simulate(a, 10, "HEAT")
+	assert.Equal(t, 0, testutil.CollectAndCount(a, "nest_balance_point_celsius"), "the balance point needs a day of readings")
+
+	a, err = New(Config{})
+	assert.NoError(t, err)
+
+	simulate(a, 30, "OFF")
+	expected := `
+# HELP nest_balance_point_hours Number of hours of heating readings the balance point is estimated from.
+# TYPE nest_balance_point_hours gauge
+nest_balance_point_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected), "nest_balance_point_hours", "nest_balance_point_celsius"), "readings without heating aren't used")
+}
+
+func TestWindow(t *testing.T) {
+	a, err := New(Config{Window: 12 * time.Hour, MinHours: 5})
+	assert.NoError(t, err)
+
+	simulate(a, 30, "HEAT")
+	assert.Len(t, a.thermostats["enterprises/PROJECT_ID/devices/DEVICE_ID"].buckets, 12)
+}
+
+func TestOutdatedWeather(t *testing.T) {
+	a, err := New(Config{})
+	assert.NoError(t, err)
+
+	a.WeatherListener()(&weather.Weather{Temperature: 5, Unit: units.Celsius, UpdatedAt: start})
+	a.now = func() time.Time { return start.Add(3 * time.Hour) }
+	a.ThermostatListener()([]*nest.Thermostat{{ID: "1", Label: "Bedroom", AmbientTemp: 18, Mode: "HEAT"}})
+
+	expected := `
+# HELP nest_balance_point_hours Number of hours of heating readings the balance point is estimated from.
+# TYPE nest_balance_point_hours gauge
+nest_balance_point_hours{device_id="",id="1",label="Bedroom"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected)))
+}
+
+func TestInvalidUnit(t *testing.T) {
+	_, err := New(Config{Unit: "rankine"})
+	assert.True(t, errors.Is(err, units.ErrInvalidUnit))
+}
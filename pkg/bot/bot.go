@@ -0,0 +1,146 @@
+// Package bot answers chat messages with thermostat readings and, if the control API is enabled, changes settings,
+// for households living in chat apps rather than Grafana.
+//
+// The Bot replies to commands: "temp" (or "temp?") lists the latest readings, "set DEVICE SETTINGS", eg.
+// "set Living-Room 20.5", changes settings like the set command and "help" lists the commands. Only allowlisted
+// chats get replies, messages of other chats are ignored. Telegram messages are received by long polling and Discord
+// slash commands with the interactions endpoint served by the Discord handler.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/control"
+)
+
+const helpText = `Commands:
+temp - latest readings of all thermostats
+set DEVICE SETTINGS - change settings, eg. "set Living-Room 20.5" or "set Living-Room eco"
+help - this help`
+
+var errNoAllowedChats = errors.New("the bot requires at least one allowed chat")
+
+// Config provides the configuration necessary to create the Bot. Logger is optional, if it's nil the Bot doesn't log
+// anything. Thermostats returns the latest readings and Label the label of a thermostat. Controller is optional, if
+// it's nil the Bot doesn't change settings. AllowedChats are the IDs of chats the Bot replies to.
+type Config struct {
+	Logger       log.Logger
+	Thermostats  func() []*nest.Thermostat
+	Label        func(*nest.Thermostat) string
+	Controller   control.Controller
+	AllowedChats []string
+}
+
+// Bot replies to chat messages.
+type Bot struct {
+	cfg     Config
+	allowed map[string]bool
+}
+
+// New creates a Bot using the given Config. It returns an error if there are no allowed chats.
+func New(cfg Config) (*Bot, error) {
+	if len(cfg.AllowedChats) == 0 {
+		return nil, errNoAllowedChats
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	allowed := make(map[string]bool, len(cfg.AllowedChats))
+	for _, chat := range cfg.AllowedChats {
+		allowed[chat] = true
+	}
+
+	return &Bot{cfg: cfg, allowed: allowed}, nil
+}
+
+// Reply returns the reply to the message of the chat. It returns false if the chat isn't allowed, then nothing should
+// be replied. Commands may start with a slash and, like in Telegram groups, end with the bot name, eg. "/temp@my_bot".
+func (b *Bot) Reply(ctx context.Context, chat, message string) (string, bool) {
+	if !b.allowed[chat] {
+		b.cfg.Logger.Log("level", "warn", "message", "Ignored message of a chat which isn't allowed", "chat", chat)
+		return "", false
+	}
+
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return helpText, true
+	}
+
+	command := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	if i := strings.Index(command, "@"); i >= 0 {
+		command = command[:i]
+	}
+
+	switch strings.TrimSuffix(command, "?") {
+	case "temp", "status":
+		return b.readings(), true
+	case "set":
+		return b.set(ctx, fields[1:]), true
+	default:
+		return helpText, true
+	}
+}
+
+// readings returns a line with the latest readings of every thermostat.
+func (b *Bot) readings() string {
+	thermostats := b.cfg.Thermostats()
+	if len(thermostats) == 0 {
+		return "No readings yet."
+	}
+
+	lines := make([]string, 0, len(thermostats))
+	for _, therm := range thermostats {
+		line := fmt.Sprintf("%s: %s°C, setpoint %s°C, humidity %s%%, %s", b.cfg.Label(therm),
+			formatFloat(therm.AmbientTemp), formatFloat(therm.SetpointTemp), formatFloat(therm.Humidity), therm.Mode)
+		if therm.Status != "" && therm.Status != "OFF" {
+			line += ", " + strings.ToLower(therm.Status)
+		}
+		if therm.Connectivity == "OFFLINE" {
+			line += ", offline"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// set changes the settings of the thermostat given as the first argument.
+func (b *Bot) set(ctx context.Context, args []string) string {
+	if b.cfg.Controller == nil {
+		return "Control is disabled."
+	}
+	if len(args) < 2 {
+		return "Usage: set DEVICE SETTINGS, eg. \"set Living-Room 20.5\""
+	}
+
+	req, err := control.ParseSettings(args[0], args[1:])
+	if err != nil {
+		return err.Error()
+	}
+
+	therm, err := control.Find(b.cfg.Thermostats(), req.Device, b.cfg.Label)
+	if err != nil {
+		return err.Error()
+	}
+
+	result, err := control.Apply(ctx, b.cfg.Controller, therm, req)
+	if err != nil {
+		b.cfg.Logger.Log("level", "error", "message", "Failed changing thermostat settings", "id", therm.ID, "stack", errors.WithStack(err))
+		return "Failed: " + err.Error()
+	}
+
+	b.cfg.Logger.Log("level", "info", "message", "Changed thermostat settings", "id", therm.ID, "applied", strings.Join(result.Applied, ", "))
+	return fmt.Sprintf("Set %s on %s.", strings.Join(result.Applied, ", "), b.cfg.Label(therm))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type fakeController struct {
+	commands []string
+	err      error
+}
+
+func (c *fakeController) record(command string) error {
+	c.commands = append(c.commands, command)
+	return c.err
+}
+
+func (c *fakeController) SetEcoMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s eco %s", id, mode))
+}
+
+func (c *fakeController) SetMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s mode %s", id, mode))
+}
+
+func (c *fakeController) SetHeat(_ context.Context, id string, celsius float64) error {
+	return c.record(fmt.Sprintf("%s heat %g", id, celsius))
+}
+
+var thermostats = []*nest.Thermostat{
+	{ID: "enterprises/PROJECT_ID/devices/LIVING", DeviceID: "LIVING", Label: "Living Room", AmbientTemp: 20.24, SetpointTemp: 19.5, Humidity: 57, Mode: "HEAT", Status: "HEATING", Connectivity: "ONLINE"},
+	{ID: "enterprises/PROJECT_ID/devices/BED", DeviceID: "BED", Label: "Bedroom", AmbientTemp: 17, SetpointTemp: 16, Humidity: 60, Mode: "ECO", Status: "OFF", Connectivity: "OFFLINE"},
+}
+
+func testBot(t *testing.T, controller *fakeController) *Bot {
+	cfg := Config{
+		Thermostats:  func() []*nest.Thermostat { return thermostats },
+		Label:        func(therm *nest.Thermostat) string { return strings.Replace(therm.Label, " ", "-", -1) },
+		AllowedChats: []string{"42"},
+	}
+	if controller != nil {
+		cfg.Controller = controller
+	}
+
+	b, err := New(cfg)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestReply(t *testing.T) {
+	controller := &fakeController{}
+	b := testBot(t, controller)
+
+	reply, ok := b.Reply(context.Background(), "42", "temp?")
+	assert.True(t, ok)
+	assert.Equal(t, "Living-Room: 20.2°C, setpoint 19.5°C, humidity 57.0%, HEAT, heating\nBedroom: 17.0°C, setpoint 16.0°C, humidity 60.0%, ECO, offline", reply)
+
+	reply, ok = b.Reply(context.Background(), "42", "/temp@pronestheus_bot")
+	assert.True(t, ok)
+	assert.Contains(t, reply, "Living-Room: 20.2°C")
+
+	reply, _ = b.Reply(context.Background(), "42", "set living-room heat 20.5")
+	assert.Equal(t, "Set mode HEAT, setpoint 20.5°C on Living-Room.", reply)
+	assert.Equal(t, []string{
+		"enterprises/PROJECT_ID/devices/LIVING mode HEAT",
+		"enterprises/PROJECT_ID/devices/LIVING heat 20.5",
+	}, controller.commands)
+
+	reply, _ = b.Reply(context.Background(), "42", "set Kitchen 20")
+	assert.Contains(t, reply, "unknown thermostat")
+
+	reply, _ = b.Reply(context.Background(), "42", "set Bedroom warm")
+	assert.Contains(t, reply, "invalid setting")
+
+	controller.err = errors.New("FAILED_PRECONDITION")
+	reply, _ = b.Reply(context.Background(), "42", "set Bedroom 18")
+	assert.Equal(t, "Failed: FAILED_PRECONDITION", reply)
+
+	reply, _ = b.Reply(context.Background(), "42", "hello")
+	assert.Equal(t, helpText, reply)
+
+	_, ok = b.Reply(context.Background(), "7", "temp")
+	assert.False(t, ok)
+}
+
+func TestReplyWithoutControl(t *testing.T) {
+	b := testBot(t, nil)
+
+	reply, _ := b.Reply(context.Background(), "42", "set Living-Room 20.5")
+	assert.Equal(t, "Control is disabled.", reply)
+
+	_, err := New(Config{})
+	assert.True(t, errors.Is(err, errNoAllowedChats))
+}
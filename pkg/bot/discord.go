@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DiscordPath is the path of the Discord interactions endpoint.
+const DiscordPath = "/bot/discord"
+
+// Discord interaction and response types.
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+	responsePong       = 1
+	responseMessage    = 4
+)
+
+// ephemeral is the flag of messages only shown to the user who sent the command.
+const ephemeral = 64
+
+// maxInteractionSize limits the size of interaction requests.
+const maxInteractionSize = 64 * 1024
+
+var errInvalidPublicKey = errors.New("invalid Discord public key; expected the hex encoded key of the application")
+
+// Discord serves the interactions endpoint of a Discord application, replying to the slash commands of the Bot.
+// Requests must be signed with the key of the application.
+type Discord struct {
+	publicKey ed25519.PublicKey
+	bot       *Bot
+}
+
+// NewDiscord creates a Discord handler verifying requests with the hex encoded public key of the application.
+func NewDiscord(publicKey string, bot *Bot) (*Discord, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errInvalidPublicKey
+	}
+
+	return &Discord{publicKey: key, bot: bot}, nil
+}
+
+// interaction is a Discord interaction: a ping or a slash command with its options.
+type interaction struct {
+	Type      int    `json:"type"`
+	ChannelID string `json:"channel_id"`
+	Data      struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (d *Discord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxInteractionSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+	if err != nil || !ed25519.Verify(d.publicKey, append([]byte(timestamp), body...), signature) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	var in interaction
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch in.Type {
+	case interactionPing:
+		writeResponse(w, map[string]interface{}{"type": responsePong})
+
+	case interactionCommand:
+		// Options are passed in order, so the command reads like a message, eg. "set Living-Room 20.5".
+		message := []string{in.Data.Name}
+		for _, option := range in.Data.Options {
+			message = append(message, fmt.Sprint(option.Value))
+		}
+
+		data := map[string]interface{}{}
+		if reply, ok := d.bot.Reply(r.Context(), in.ChannelID, strings.Join(message, " ")); ok {
+			data["content"] = reply
+		} else {
+			data["content"] = "This channel isn't allowed."
+			data["flags"] = ephemeral
+		}
+		writeResponse(w, map[string]interface{}{"type": responseMessage, "data": data})
+
+	default:
+		http.Error(w, "unsupported interaction type", http.StatusBadRequest)
+	}
+}
+
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
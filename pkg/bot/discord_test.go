@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscord(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	discord, err := NewDiscord(hex.EncodeToString(publicKey), testBot(t, &fakeController{}))
+	assert.NoError(t, err)
+
+	request := func(body string, key ed25519.PrivateKey) *httptest.ResponseRecorder {
+		timestamp := "1600000000"
+		req := httptest.NewRequest(http.MethodPost, DiscordPath, strings.NewReader(body))
+		req.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body))))
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		w := httptest.NewRecorder()
+		discord.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(`{"type":1}`, privateKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"type":1}`, w.Body.String())
+
+	w = request(`{"type":2,"channel_id":"42","data":{"name":"set","options":[{"name":"device","value":"Living-Room"},{"name":"settings","value":"20.5"}]}}`, privateKey)
+	assert.JSONEq(t, `{"type":4,"data":{"content":"Set setpoint 20.5°C on Living-Room."}}`, w.Body.String())
+
+	w = request(`{"type":2,"channel_id":"7","data":{"name":"temp"}}`, privateKey)
+	assert.JSONEq(t, `{"type":4,"data":{"content":"This channel isn't allowed.","flags":64}}`, w.Body.String())
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	w = request(`{"type":1}`, otherKey)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = request(`{"type":3}`, privateKey)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	_, err = NewDiscord("invalid", nil)
+	assert.True(t, errors.Is(err, errInvalidPublicKey))
+}
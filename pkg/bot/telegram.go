@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// pollTimeout is how long Telegram holds getUpdates requests open waiting for messages.
+const pollTimeout = 30 * time.Second
+
+// retryInterval is the time to wait after a failed getUpdates request.
+var retryInterval = 10 * time.Second
+
+var (
+	errFailedPolling   = errors.New("failed polling Telegram updates")
+	errFailedReplying  = errors.New("failed replying to Telegram message")
+	errTelegramFailure = errors.New("failed Telegram API call")
+)
+
+// Telegram receives messages of a Telegram bot by long polling and sends the replies of the Bot.
+type Telegram struct {
+	url    string
+	bot    *Bot
+	client *http.Client
+	logger log.Logger
+	offset int64
+}
+
+// NewTelegram creates a Telegram poller for the bot token. The HTTP client must not time out before the poll timeout
+// of 30 seconds.
+func NewTelegram(token string, bot *Bot, client *http.Client, logger log.Logger) *Telegram {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return &Telegram{
+		url:    "https://api.telegram.org/bot" + token,
+		bot:    bot,
+		client: client,
+		logger: logger,
+	}
+}
+
+// update is a Telegram update with a message.
+type update struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// Run polls updates and replies to messages until the context is cancelled.
+func (t *Telegram) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		updates, err := t.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			t.logger.Log("level", "error", "message", "Failed polling Telegram updates", "stack", errors.WithStack(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			t.offset = u.UpdateID + 1
+			if u.Message == nil || u.Message.Text == "" {
+				continue
+			}
+
+			chat := strconv.FormatInt(u.Message.Chat.ID, 10)
+			reply, ok := t.bot.Reply(ctx, chat, u.Message.Text)
+			if !ok {
+				continue
+			}
+			if err := t.send(ctx, chat, reply); err != nil {
+				t.logger.Log("level", "error", "message", "Failed replying to Telegram message", "chat", chat, "stack", errors.WithStack(err))
+			}
+		}
+	}
+}
+
+// poll returns the updates after the offset, waiting for them up to the poll timeout.
+func (t *Telegram) poll(ctx context.Context) ([]update, error) {
+	query := url.Values{
+		"offset":          {strconv.FormatInt(t.offset, 10)},
+		"timeout":         {strconv.Itoa(int(pollTimeout / time.Second))},
+		"allowed_updates": {`["message"]`},
+	}
+
+	var updates []update
+	if err := t.call(ctx, "getUpdates", query, &updates); err != nil {
+		return nil, errors.Wrap(errFailedPolling, err.Error())
+	}
+	return updates, nil
+}
+
+// send sends the text as a message to the chat.
+func (t *Telegram) send(ctx context.Context, chat, text string) error {
+	if err := t.call(ctx, "sendMessage", url.Values{"chat_id": {chat}, "text": {text}}, nil); err != nil {
+		return errors.Wrap(errFailedReplying, err.Error())
+	}
+	return nil
+}
+
+// call calls the method of the Bot API with the form and decodes its result.
+func (t *Telegram) call(ctx context.Context, method string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, t.url+"/"+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		// Errors of the client contain the URL, with the bot token.
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return errors.Wrap(errTelegramFailure, res.Status)
+	}
+	if !body.OK {
+		return errors.Wrap(errTelegramFailure, body.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body.Result, result)
+}
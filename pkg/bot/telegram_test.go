@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegram(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		offsets []string
+		sent    = make(chan url.Values, 2)
+	)
+
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/botTOKEN/getUpdates":
+			mu.Lock()
+			offsets = append(offsets, r.Form.Get("offset"))
+			first := len(offsets) == 1
+			mu.Unlock()
+
+			if !first {
+				w.Write([]byte(`{"ok":true,"result":[]}`))
+				return
+			}
+			w.Write([]byte(`{"ok":true,"result":[
+				{"update_id":10,"message":{"chat":{"id":42},"text":"temp?"}},
+				{"update_id":11,"message":{"chat":{"id":7},"text":"temp?"}},
+				{"update_id":12,"edited_message":{"chat":{"id":42},"text":"temp"}}
+			]}`))
+		case "/botTOKEN/sendMessage":
+			sent <- r.Form
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"ok":false,"description":"Not Found"}`))
+		}
+	}))
+	defer serv.Close()
+
+	telegram := NewTelegram("TOKEN", testBot(t, nil), serv.Client(), nil)
+	telegram.url = serv.URL + "/botTOKEN"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go telegram.Run(ctx)
+
+	form := <-sent
+	assert.Equal(t, "42", form.Get("chat_id"))
+	assert.Contains(t, form.Get("text"), "Living-Room: 20.2°C")
+
+	select {
+	case form := <-sent:
+		t.Errorf("unexpected reply to chat %s", form.Get("chat_id"))
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"0", "13"}, offsets[:2])
+}
+
+func TestTelegramError(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+	}))
+	defer serv.Close()
+
+	telegram := NewTelegram("TOKEN", testBot(t, nil), serv.Client(), nil)
+	telegram.url = serv.URL + "/botTOKEN"
+
+	_, err := telegram.poll(context.Background())
+	assert.True(t, errors.Is(err, errFailedPolling))
+	assert.Contains(t, err.Error(), "Unauthorized")
+}
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/breaker"
+)
+
+// setupBreakers creates circuit breakers for the Nest and OpenWeatherMap APIs, unless they're disabled with zero
+// failures. Breakers outlive collectors, so an API stays skipped across reloads.
+func (e *Exporter) setupBreakers(cfg *ExporterConfig) error {
+	if cfg.BreakerFailures == nil || *cfg.BreakerFailures <= 0 {
+		return nil
+	}
+
+	e.breakers = make(map[string]*breaker.Breaker)
+	for _, name := range []string{"nest", "weather"} {
+		breakerCfg := breaker.Config{Logger: e.logger, Name: name, Failures: *cfg.BreakerFailures}
+		if cfg.BreakerCooldown != nil {
+			breakerCfg.Cooldown = *cfg.BreakerCooldown
+		}
+
+		b := breaker.New(breakerCfg)
+		if !cfg.exporterMetricsDisabled() {
+			if err := prometheus.Register(b); err != nil {
+				return err
+			}
+		}
+		e.breakers[name] = b
+	}
+
+	return nil
+}
+
+// breakerTransport returns the base transport guarded by the circuit breaker of the API, or the base transport if
+// circuit breakers are disabled.
+func (e *Exporter) breakerTransport(name string, base http.RoundTripper) http.RoundTripper {
+	b, ok := e.breakers[name]
+	if !ok {
+		return base
+	}
+	return b.Transport(base)
+}
@@ -0,0 +1,200 @@
+// Package breaker stops calling APIs which keep failing.
+//
+// During an outage of the Nest or OpenWeatherMap API every request waits for its timeout, so scrapes pile up behind
+// slow failures. After a number of consecutive failures the Breaker opens and rejects requests immediately, so
+// collectors report up=0 without waiting. Once the cool-down passes a single trial request is let through: if it
+// succeeds the Breaker closes again, otherwise it stays open for another cool-down.
+package breaker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultCooldown is the time requests are rejected after the Breaker opens.
+const DefaultCooldown = time.Minute
+
+// ErrOpen is returned instead of sending requests while the Breaker is open.
+var ErrOpen = errors.New("circuit breaker is open, skipping API request")
+
+// State is the state of a Breaker, exported as the value of the state metric.
+type State int
+
+const (
+	// Closed lets all requests through.
+	Closed State = iota
+	// Open rejects all requests until the cool-down passes.
+	Open
+	// HalfOpen lets a single trial request through, deciding whether the Breaker closes.
+	HalfOpen
+)
+
+// Config provides the configuration necessary to create the Breaker. Logger is optional, if it's nil the Breaker
+// doesn't log anything. Name identifies the API in logs and metrics. The Breaker opens after Failures consecutive
+// failed requests. Cooldown defaults to DefaultCooldown.
+type Config struct {
+	Logger   log.Logger
+	Name     string
+	Failures int
+	Cooldown time.Duration
+}
+
+// Breaker counts consecutive failures of an API and rejects requests while the API is considered down.
+type Breaker struct {
+	logger   log.Logger
+	name     string
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	consecutive int
+	openedAt    time.Time
+	trial       bool
+	rejected    float64
+
+	stateDesc    *prometheus.Desc
+	rejectedDesc *prometheus.Desc
+}
+
+// New creates a Breaker using the given Config.
+func New(cfg Config) *Breaker {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Failures < 1 {
+		cfg.Failures = 1
+	}
+
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+
+	labels := prometheus.Labels{"api": cfg.Name}
+	return &Breaker{
+		logger:       cfg.Logger,
+		name:         cfg.Name,
+		failures:     cfg.Failures,
+		cooldown:     cfg.Cooldown,
+		now:          time.Now,
+		stateDesc:    prometheus.NewDesc("pronestheus_circuit_breaker_state", "State of the circuit breaker of the API: 0 closed, 1 open, 2 half-open.", nil, labels),
+		rejectedDesc: prometheus.NewDesc("pronestheus_circuit_breaker_rejected_requests_total", "API requests rejected while the circuit breaker was open.", nil, labels),
+	}
+}
+
+// State returns the current state of the Breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns ErrOpen if the request must be rejected. Once the cool-down passes, the first request is the trial.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.state = HalfOpen
+	}
+
+	if b.state == Closed || (b.state == HalfOpen && !b.trial) {
+		b.trial = b.state == HalfOpen
+		return nil
+	}
+
+	b.rejected++
+	return ErrOpen
+}
+
+// success closes the Breaker.
+func (b *Breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != Closed {
+		b.logger.Log("level", "info", "message", "Circuit breaker closed, API recovered", "api", b.name)
+	}
+	b.state = Closed
+	b.consecutive = 0
+	b.trial = false
+}
+
+// failure counts a failed request, opening the Breaker once there are enough consecutive failures or if the trial
+// request failed.
+func (b *Breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutive++
+	b.trial = false
+	if b.state == HalfOpen || (b.state == Closed && b.consecutive >= b.failures) {
+		b.logger.Log("level", "warn", "message", "Circuit breaker opened, skipping API requests", "api", b.name, "failures", b.consecutive, "cooldown", b.cooldown)
+		b.state = Open
+		b.openedAt = b.now()
+	}
+}
+
+// abort releases the trial of a request which neither succeeded nor failed, so the next request becomes the trial.
+func (b *Breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Transport returns a transport sending requests with the base transport, or with http.DefaultTransport if it's nil,
+// while the Breaker allows it. Transport errors and 429 or 5xx responses are failures, requests cancelled by the
+// caller don't count.
+func (b *Breaker) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{breaker: b, base: base}
+}
+
+type transport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		return nil, errors.Wrap(err, t.breaker.name)
+	}
+
+	res, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		t.breaker.abort()
+	case err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		t.breaker.failure()
+	default:
+		t.breaker.success()
+	}
+
+	return res, err
+}
+
+// Describe implements the prometheus.Collector interface.
+func (b *Breaker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.stateDesc
+	ch <- b.rejectedDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (b *Breaker) Collect(ch chan<- prometheus.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(b.stateDesc, prometheus.GaugeValue, float64(b.state))
+	ch <- prometheus.MustNewConstMetric(b.rejectedDesc, prometheus.CounterValue, b.rejected)
+}
@@ -0,0 +1,110 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	var requests, status int32 = 0, http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	b := New(Config{Name: "weather", Failures: 3, Cooldown: time.Minute})
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	client := &http.Client{Transport: b.Transport(nil)}
+
+	get := func() error {
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, get(), "failed responses are returned while the breaker is closed")
+	}
+	assert.Equal(t, Open, b.State())
+
+	err := get()
+	assert.True(t, errors.Is(err, ErrOpen))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests), "requests are rejected while the breaker is open")
+
+	// The trial request after the cool-down fails, so the breaker opens for another cool-down.
+	now = now.Add(time.Minute)
+	assert.NoError(t, get())
+	assert.Equal(t, Open, b.State())
+	assert.True(t, errors.Is(get(), ErrOpen))
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	now = now.Add(time.Minute)
+	assert.NoError(t, get())
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+
+	expected := `
+# HELP pronestheus_circuit_breaker_rejected_requests_total API requests rejected while the circuit breaker was open.
+# TYPE pronestheus_circuit_breaker_rejected_requests_total counter
+pronestheus_circuit_breaker_rejected_requests_total{api="weather"} 2
+# HELP pronestheus_circuit_breaker_state State of the circuit breaker of the API: 0 closed, 1 open, 2 half-open.
+# TYPE pronestheus_circuit_breaker_state gauge
+pronestheus_circuit_breaker_state{api="weather"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(b, strings.NewReader(expected)))
+}
+
+func TestHalfOpen(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	b := New(Config{Name: "nest", Failures: 1})
+	b.failure()
+	b.openedAt = b.openedAt.Add(-DefaultCooldown)
+	client := &http.Client{Transport: b.Transport(nil)}
+
+	done := make(chan error)
+	go func() {
+		_, err := client.Get(server.URL)
+		done <- err
+	}()
+
+	assert.Eventually(t, func() bool { return b.State() == HalfOpen }, time.Second, time.Millisecond)
+	_, err := client.Get(server.URL)
+	assert.True(t, errors.Is(err, ErrOpen), "only one trial request is let through")
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestCancelledRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	b := New(Config{Name: "nest", Failures: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: b.Transport(nil)}).Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, Closed, b.State(), "requests cancelled by the caller aren't failures")
+}
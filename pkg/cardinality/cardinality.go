@@ -0,0 +1,199 @@
+// Package cardinality limits the number of series exported per metric family.
+//
+// A misused label configuration, eg. a label policy keeping unique names, or many devices can make families grow
+// beyond what a small Prometheus instance handles. The Gatherer counts the series of every family and warns when a
+// family exceeds the limit. Optionally it truncates the family: the series over the limit are summed into a single
+// series whose label values are all _overflow, so sum aggregations stay correct while the cardinality is capped.
+package cardinality
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Overflow is the label value of the series summing the series over the limit of a truncated family.
+const Overflow = "_overflow"
+
+// Config provides the configuration necessary to create the Gatherer.
+// Logger is optional, if it's nil the Gatherer doesn't log anything. With Report, the total number of series and the
+// number of series over the limit of each family exceeding it are added to the gathered families, as
+// pronestheus_series and pronestheus_series_over_limit.
+type Config struct {
+	Logger    log.Logger
+	MaxSeries int
+	Truncate  bool
+	Report    bool
+}
+
+// Gatherer limits the number of series of the families of the wrapped gatherer.
+type Gatherer struct {
+	gatherer  prometheus.Gatherer
+	logger    log.Logger
+	maxSeries int
+	truncate  bool
+	report    bool
+
+	mu       sync.Mutex
+	exceeded map[string]bool
+}
+
+// NewGatherer creates a Gatherer using the given Config. Families aren't limited if MaxSeries is 0.
+func NewGatherer(gatherer prometheus.Gatherer, cfg Config) *Gatherer {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	return &Gatherer{
+		gatherer:  gatherer,
+		logger:    cfg.Logger,
+		maxSeries: cfg.MaxSeries,
+		truncate:  cfg.Truncate,
+		report:    cfg.Report,
+		exceeded:  make(map[string]bool),
+	}
+}
+
+// Gather implements the prometheus.Gatherer interface. Families are sorted by name, like the ones of registries.
+func (g *Gatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	if g.maxSeries <= 0 {
+		return families, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var total int
+	overLimit := make(map[string]int)
+	for i, family := range families {
+		series := len(family.GetMetric())
+		total += series
+
+		name := family.GetName()
+		if series <= g.maxSeries {
+			if g.exceeded[name] {
+				g.logger.Log("level", "info", "message", "Metric family is within the series limit again", "family", name, "series", series, "limit", g.maxSeries)
+				delete(g.exceeded, name)
+			}
+			continue
+		}
+
+		overLimit[name] = series - g.maxSeries
+		if !g.exceeded[name] {
+			g.logger.Log("level", "warn", "message", "Metric family exceeds the series limit, check the label configuration", "family", name, "series", series, "limit", g.maxSeries, "truncated", g.truncate)
+			g.exceeded[name] = true
+		}
+
+		if g.truncate {
+			families[i] = truncated(family, g.maxSeries)
+		}
+	}
+
+	if g.report {
+		families = append(families, g.reportFamilies(total, overLimit)...)
+		sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	}
+
+	return families, err
+}
+
+// truncated returns a copy of the family with its first max-1 series, and the series over them summed into a series
+// with _overflow label values. Only counters, gauges and untyped metrics can be summed, other families are returned
+// unchanged.
+func truncated(family *dto.MetricFamily, max int) *dto.MetricFamily {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+	default:
+		return family
+	}
+
+	if max < 1 {
+		max = 1
+	}
+	kept := family.GetMetric()[:max-1]
+	dropped := family.GetMetric()[max-1:]
+
+	var sum float64
+	for _, metric := range dropped {
+		sum += metricValue(family.GetType(), metric)
+	}
+
+	overflowValue := Overflow
+	overflow := &dto.Metric{}
+	for _, label := range dropped[0].GetLabel() {
+		overflow.Label = append(overflow.Label, &dto.LabelPair{Name: label.Name, Value: &overflowValue})
+	}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		overflow.Counter = &dto.Counter{Value: &sum}
+	case dto.MetricType_GAUGE:
+		overflow.Gauge = &dto.Gauge{Value: &sum}
+	default:
+		overflow.Untyped = &dto.Untyped{Value: &sum}
+	}
+
+	metrics := make([]*dto.Metric, 0, max)
+	metrics = append(append(metrics, kept...), overflow)
+
+	// Like registries, the series are sorted by their label values.
+	sort.SliceStable(metrics, func(i, j int) bool { return less(metrics[i].GetLabel(), metrics[j].GetLabel()) })
+	return &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type, Metric: metrics}
+}
+
+// less returns true if the label values a sort before the label values b, compared label by label.
+func less(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+	return len(a) < len(b)
+}
+
+func metricValue(typ dto.MetricType, metric *dto.Metric) float64 {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		return metric.GetGauge().GetValue()
+	default:
+		return metric.GetUntyped().GetValue()
+	}
+}
+
+// reportFamilies returns the families reporting the total number of series and the series over the limit.
+func (g *Gatherer) reportFamilies(total int, overLimit map[string]int) []*dto.MetricFamily {
+	gauge := dto.MetricType_GAUGE
+	name, help, value := "pronestheus_series", "Number of series exported by the exporter, before truncation.", float64(total)
+	families := []*dto.MetricFamily{{
+		Name:   &name,
+		Help:   &help,
+		Type:   &gauge,
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &value}}},
+	}}
+
+	if len(overLimit) == 0 {
+		return families
+	}
+
+	names := make([]string, 0, len(overLimit))
+	for name := range overLimit {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overName, overHelp, label := "pronestheus_series_over_limit", "Number of series of the metric family over the series limit.", "family"
+	family := &dto.MetricFamily{Name: &overName, Help: &overHelp, Type: &gauge}
+	for _, name := range names {
+		name, value := name, float64(overLimit[name])
+		family.Metric = append(family.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{{Name: &label, Value: &name}},
+			Gauge: &dto.Gauge{Value: &value},
+		})
+	}
+	return append(families, family)
+}
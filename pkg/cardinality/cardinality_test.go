@@ -0,0 +1,74 @@
+package cardinality
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	temp := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "nest_ambient_temperature_celsius", Help: "Inside temperature."}, []string{"id", "label"})
+	for i, label := range []string{"attic", "bedroom", "hall", "kitchen", "office"} {
+		temp.WithLabelValues(string(rune('a'+i)), label).Set(float64(20 + i))
+	}
+	registry.MustRegister(temp)
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_up", Help: "Was talking to Nest API successful."})
+	up.Set(1)
+	registry.MustRegister(up)
+
+	return registry
+}
+
+func TestGatherer(t *testing.T) {
+	g := NewGatherer(testRegistry(), Config{MaxSeries: 3, Report: true})
+
+	expected := `
+# HELP nest_ambient_temperature_celsius Inside temperature.
+# TYPE nest_ambient_temperature_celsius gauge
+nest_ambient_temperature_celsius{id="a",label="attic"} 20
+nest_ambient_temperature_celsius{id="b",label="bedroom"} 21
+nest_ambient_temperature_celsius{id="c",label="hall"} 22
+nest_ambient_temperature_celsius{id="d",label="kitchen"} 23
+nest_ambient_temperature_celsius{id="e",label="office"} 24
+# HELP nest_up Was talking to Nest API successful.
+# TYPE nest_up gauge
+nest_up 1
+# HELP pronestheus_series Number of series exported by the exporter, before truncation.
+# TYPE pronestheus_series gauge
+pronestheus_series 6
+# HELP pronestheus_series_over_limit Number of series of the metric family over the series limit.
+# TYPE pronestheus_series_over_limit gauge
+pronestheus_series_over_limit{family="nest_ambient_temperature_celsius"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(g, strings.NewReader(expected)), "families over the limit are only reported")
+}
+
+func TestGathererTruncate(t *testing.T) {
+	g := NewGatherer(testRegistry(), Config{MaxSeries: 3, Truncate: true})
+
+	expected := `
+# HELP nest_ambient_temperature_celsius Inside temperature.
+# TYPE nest_ambient_temperature_celsius gauge
+nest_ambient_temperature_celsius{id="a",label="attic"} 20
+nest_ambient_temperature_celsius{id="b",label="bedroom"} 21
+nest_ambient_temperature_celsius{id="_overflow",label="_overflow"} 69
+# HELP nest_up Was talking to Nest API successful.
+# TYPE nest_up gauge
+nest_up 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(g, strings.NewReader(expected)), "series over the limit are summed")
+}
+
+func TestGathererDisabled(t *testing.T) {
+	g := NewGatherer(testRegistry(), Config{Truncate: true, Report: true})
+
+	count, err := testutil.GatherAndCount(g)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, count)
+}
@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+)
+
+var (
+	errMissingValue = errors.New("missing required configuration value")
+	errInvalidValue = errors.New("invalid configuration value")
+	errCheckFailed  = errors.New("configuration check failed")
+)
+
+// Validate checks if all required configuration values are set and have valid format.
+// Credentials aren't required in the simulation mode and the sandbox environment, OAuth2 client and refresh token aren't required when
+// authenticating with Application Default Credentials.
+func (cfg *ExporterConfig) Validate() error {
+	if cfg.offline() {
+		return nil
+	}
+
+	type requiredValue struct {
+		flag  string
+		value *string
+	}
+
+	required := []requiredValue{
+		{"nest-project-id", cfg.NestProjectID},
+	}
+
+	if !cfg.defaultCredentials() {
+		required = append(required,
+			requiredValue{"nest-client-id", cfg.NestOAuthClientID},
+			requiredValue{"nest-client-secret", cfg.NestOAuthClientSecret},
+			requiredValue{"nest-refresh-token", cfg.NestRefreshToken},
+		)
+	}
+
+	for _, r := range required {
+		if r.value == nil || *r.value == "" {
+			return errors.Wrap(errMissingValue, r.flag)
+		}
+	}
+
+	if _, err := url.ParseRequestURI(*cfg.NestURL); err != nil {
+		return errors.Wrap(errInvalidValue, "nest-url: "+err.Error())
+	}
+
+	if *cfg.WeatherToken != "" {
+		if _, err := url.ParseRequestURI(*cfg.WeatherURL); err != nil {
+			return errors.Wrap(errInvalidValue, "owm-url: "+err.Error())
+		}
+	}
+
+	if *cfg.Timeout <= 0 {
+		return errors.Wrap(errInvalidValue, "scrape-timeout must be greater than 0")
+	}
+
+	return nil
+}
+
+// Hints how to fix failed checks which aren't errors of the Nest API, those come with their own hints.
+const (
+	tokenHint       = "the refresh token expired or was revoked, or doesn't belong to the OAuth client; refresh tokens of OAuth apps in the Testing publishing status expire after 7 days"
+	thermostatsHint = "no thermostat is shared with the Device Access project, select the thermostats again in the Partner Connections Manager"
+	weatherHint     = "check --owm-auth and --owm-location, new OpenWeatherMap API keys can take a couple of hours to activate"
+)
+
+// Check validates the configuration and verifies it against the remote APIs: it refreshes the OAuth2 access token,
+// checks access to the Device Access project by listing its devices, looks for thermostats among them and fetches
+// the current weather. The results are printed to out as a checklist, with hints how to fix failed checks. Checks
+// depending on a failed check are skipped. It returns an error if any of the checks fails.
+func Check(cfg *ExporterConfig, out io.Writer) error {
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(out, "[FAIL] Configuration: %s\n", err)
+		return errCheckFailed
+	}
+	fmt.Fprintln(out, "[OK]   Configuration is valid")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	nestOK := checkNest(ctx, cfg, out)
+	weatherOK := checkWeather(ctx, cfg, out)
+	if !nestOK || !weatherOK {
+		return errCheckFailed
+	}
+
+	return nil
+}
+
+// checkNest refreshes the OAuth2 access token, lists devices of the Device Access project and looks for thermostats,
+// printing the results to out. It returns false if any of the checks fails.
+func checkNest(ctx context.Context, cfg *ExporterConfig, out io.Writer) bool {
+	nestCollector, err := nest.New(*cfg.NestProjectID, nestOptions(cfg, nil)...)
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] Nest collector: %s\n", err)
+		return false
+	}
+
+	token, err := nestCollector.Token()
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] OAuth2 token refresh: %s\n", err)
+		if !cfg.defaultCredentials() && errors.Is(err, nest.ErrAuth) {
+			printHint(out, tokenHint)
+		}
+		fmt.Fprintln(out, "[SKIP] Nest devices list needs an access token")
+		return false
+	}
+	if token.Expiry.IsZero() {
+		fmt.Fprintln(out, "[OK]   OAuth2 access token is valid")
+	} else {
+		fmt.Fprintf(out, "[OK]   OAuth2 access token is valid until %s\n", token.Expiry.Format(time.RFC3339))
+	}
+
+	devices, err := nestCollector.Devices(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] Nest devices list: %s\n", err)
+		var apiErr *nest.APIError
+		if errors.As(err, &apiErr) && apiErr.Hint() != "" {
+			printHint(out, apiErr.Hint())
+		}
+		return false
+	}
+	fmt.Fprintf(out, "[OK]   Device Access project %s is accessible, found %d devices\n", *cfg.NestProjectID, len(devices))
+
+	thermostats := 0
+	for _, device := range devices {
+		fmt.Fprintf(out, "       %s (%s) in %q\n", device.ID, device.Type, device.Room)
+		for _, trait := range device.Traits {
+			fmt.Fprintf(out, "         - %s\n", trait)
+		}
+		if device.IsThermostat() {
+			thermostats++
+		}
+	}
+
+	if thermostats == 0 {
+		fmt.Fprintln(out, "[FAIL] Thermostats: none of the devices is a thermostat")
+		printHint(out, thermostatsHint)
+		return false
+	}
+	fmt.Fprintf(out, "[OK]   Found %d thermostats\n", thermostats)
+
+	return true
+}
+
+// checkWeather fetches the current weather if the OpenWeatherMap collector is enabled, printing the result to out.
+// It returns false if the check fails.
+func checkWeather(ctx context.Context, cfg *ExporterConfig, out io.Writer) bool {
+	if *cfg.WeatherToken == "" {
+		fmt.Fprintln(out, "[SKIP] OpenWeatherMap API token is not set")
+		return true
+	}
+
+	opts, err := weatherOptions(cfg, nil)
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] Weather collector: %s\n", err)
+		return false
+	}
+
+	weatherCollector, err := weather.New(*cfg.WeatherToken, *cfg.WeatherLocation, opts...)
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] Weather collector: %s\n", err)
+		return false
+	}
+
+	reading, err := weatherCollector.Weather(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "[FAIL] OpenWeatherMap API: %s\n", err)
+		printHint(out, weatherHint)
+		return false
+	}
+	fmt.Fprintf(out, "[OK]   OpenWeatherMap API responded, current temperature: %.1f\n", reading.Temperature)
+
+	return true
+}
+
+// printHint prints the hint how to fix a failed check, indented below the check.
+func printHint(out io.Writer, hint string) {
+	fmt.Fprintf(out, "       Hint: %s\n", hint)
+}
+
+// SelfTest runs the checks of Check before the exporter starts if it's enabled, printing the checklist to out. Failed
+// checks only stop the exporter with FailFast, otherwise it starts anyway, eg. to report the APIs down until they
+// recover.
+func SelfTest(cfg *ExporterConfig, out io.Writer) error {
+	if cfg.SelfTest == nil || !*cfg.SelfTest {
+		return nil
+	}
+
+	err := Check(cfg, out)
+	if err != nil && cfg.FailFast != nil && *cfg.FailFast {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"pronestheus/test"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	empty := ""
+	invalidURL := "https/////this.is.not.a.valid.url"
+	zero := 0
+	adc := "adc"
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *ExporterConfig)
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			modify:  func(cfg *ExporterConfig) {},
+			wantErr: nil,
+		}, {
+			name:    "missing project id",
+			modify:  func(cfg *ExporterConfig) { cfg.NestProjectID = &empty },
+			wantErr: errMissingValue,
+		}, {
+			name:    "missing refresh token",
+			modify:  func(cfg *ExporterConfig) { cfg.NestRefreshToken = &empty },
+			wantErr: errMissingValue,
+		}, {
+			name: "missing refresh token with default credentials",
+			modify: func(cfg *ExporterConfig) {
+				cfg.NestAuth = &adc
+				cfg.NestRefreshToken = &empty
+				cfg.NestOAuthClientID = &empty
+			},
+			wantErr: nil,
+		}, {
+			name: "missing project id with default credentials",
+			modify: func(cfg *ExporterConfig) {
+				cfg.NestAuth = &adc
+				cfg.NestProjectID = &empty
+			},
+			wantErr: errMissingValue,
+		}, {
+			name:    "invalid nest url",
+			modify:  func(cfg *ExporterConfig) { cfg.NestURL = &invalidURL },
+			wantErr: errInvalidValue,
+		}, {
+			name:    "invalid weather url",
+			modify:  func(cfg *ExporterConfig) { cfg.WeatherURL = &invalidURL },
+			wantErr: errInvalidValue,
+		}, {
+			name: "invalid weather url without weather token",
+			modify: func(cfg *ExporterConfig) {
+				cfg.WeatherURL = &invalidURL
+				cfg.WeatherToken = &empty
+			},
+			wantErr: nil,
+		}, {
+			name:    "zero timeout",
+			modify:  func(cfg *ExporterConfig) { cfg.Timeout = &zero },
+			wantErr: errInvalidValue,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig()
+			test.modify(cfg)
+
+			err := cfg.Validate()
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	nestServ := test.NestServer()
+	weatherServ := test.WeatherServerMetric()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+
+	var out bytes.Buffer
+	err := Check(cfg, &out)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "[OK]   Device Access project dummy is accessible, found 1 devices")
+	assert.Contains(t, out.String(), `enterprises/PROJECT_ID/devices/DEVICE_ID (sdm.devices.types.THERMOSTAT) in "Living Room"`)
+	assert.Contains(t, out.String(), "- sdm.devices.traits.ThermostatHvac")
+	assert.Contains(t, out.String(), "[OK]   Found 1 thermostats")
+	assert.Contains(t, out.String(), "current temperature: 20.3")
+}
+
+func TestCheckFailed(t *testing.T) {
+	nestServ := test.NestServerInvalidToken()
+	weatherServ := test.WeatherServerInvalidToken()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+
+	var out bytes.Buffer
+	err := Check(cfg, &out)
+
+	assert.True(t, errors.Is(err, errCheckFailed))
+	assert.Contains(t, out.String(), "[FAIL] Nest devices list")
+	assert.Contains(t, out.String(), "Hint: the access token was rejected")
+	assert.Contains(t, out.String(), "[FAIL] OpenWeatherMap API", "the weather is checked after the Nest API failed")
+	assert.Contains(t, out.String(), "Hint: check --owm-auth")
+}
+
+func TestSelfTest(t *testing.T) {
+	nestServ := test.NestServerInvalidToken()
+	enabled := true
+	disabled := false
+	empty := ""
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherToken = &empty
+	cfg.SelfTest = &enabled
+	cfg.FailFast = &disabled
+
+	var out bytes.Buffer
+	assert.NoError(t, SelfTest(cfg, &out), "the exporter starts after failed checks without --fail-fast")
+	assert.Contains(t, out.String(), "[FAIL] Nest devices list")
+
+	cfg.FailFast = &enabled
+	assert.True(t, errors.Is(SelfTest(cfg, &out), errCheckFailed))
+
+	out.Reset()
+	cfg.SelfTest = &disabled
+	assert.NoError(t, SelfTest(cfg, &out))
+	assert.Empty(t, out.String())
+}
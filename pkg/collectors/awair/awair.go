@@ -0,0 +1,194 @@
+package awair
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+)
+
+// latestPath is the path of the latest readings in the local API.
+const latestPath = "/air-data/latest"
+
+var (
+	errInvalidDevice     = errors.New("invalid Awair device; expected NAME=URL, eg. living-room=http://192.168.1.20")
+	errNon200Response    = errors.New("awair local API responded with non-200 code")
+	errFailedRequest     = errors.New("failed Awair local API request")
+	errFailedReadingBody = errors.New("failed reading Awair local API response body")
+	errInvalidResponse   = errors.New("invalid Awair local API response")
+)
+
+// readings are the exported readings of the local API by JSON key.
+var readings = []struct {
+	key  string
+	name string
+	help string
+}{
+	{"score", "score", "Awair score of the air quality, from 0 (bad) to 100 (good)."},
+	{"temp", "temperature_celsius", "Temperature measured by the Awair device."},
+	{"humid", "humidity_percent", "Relative humidity measured by the Awair device."},
+	{"co2", "co2_ppm", "Carbon dioxide concentration measured by the Awair device."},
+	{"voc", "voc_ppb", "Total volatile organic compounds concentration measured by the Awair device."},
+	{"pm25", "pm25_micrograms_per_cubic_meter", "Concentration of fine particulate matter (PM2.5) measured by the Awair device."},
+	{"lux", "illuminance_lux", "Illuminance measured by the Awair device."},
+	{"spl_a", "noise_dba", "A-weighted sound pressure level measured by the Awair device."},
+}
+
+// Device is an Awair device with the local API enabled. URL is the base URL of the device, eg. http://192.168.1.20.
+type Device struct {
+	Name string
+	URL  string
+}
+
+// ParseDevice parses a device given as NAME=URL.
+func ParseDevice(text string) (Device, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Device{}, errors.Wrap(errInvalidDevice, text)
+	}
+
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return Device{}, errors.Wrap(errInvalidDevice, err.Error())
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Device{}, errors.Wrap(errInvalidDevice, text)
+	}
+
+	return Device{Name: parts[0], URL: strings.TrimRight(u.String(), "/")}, nil
+}
+
+// Config provides the configuration necessary to create the Collector.
+// Logger is optional, if it's nil the Collector doesn't log anything.
+type Config struct {
+	Logger    log.Logger
+	Timeout   int
+	Devices   []Device
+	Transport http.RoundTripper
+}
+
+// Collector implements the Collector interface, collecting readings of Awair devices.
+type Collector struct {
+	ctx     context.Context
+	client  *httpx.Client
+	logger  log.Logger
+	devices []Device
+	metrics *Metrics
+}
+
+// Metrics contains the metrics collected by the Collector.
+type Metrics struct {
+	up       *prometheus.Desc
+	readings map[string]*prometheus.Desc
+}
+
+// New creates a Collector using the given Config.
+func New(cfg Config) (*Collector, error) {
+	return NewWithContext(context.Background(), cfg)
+}
+
+// NewWithContext creates a Collector using the given Config.
+// The context controls the lifetime of the collector, cancelling it aborts all in-flight requests.
+func NewWithContext(ctx context.Context, cfg Config) (*Collector, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	client := httpx.New(httpx.Config{
+		Transport:    cfg.Transport,
+		Timeout:      time.Duration(cfg.Timeout) * time.Millisecond,
+		Errors:       httpx.Errors{Request: errFailedRequest, ReadingBody: errFailedReadingBody, Non200: errNon200Response},
+		Requests:     "awair_api_requests_total",
+		RequestsHelp: "Awair local API requests by status code, or error if they weren't answered.",
+	})
+
+	collector := &Collector{
+		ctx:     ctx,
+		client:  client,
+		logger:  cfg.Logger,
+		devices: cfg.Devices,
+		metrics: buildMetrics(),
+	}
+
+	return collector, nil
+}
+
+func buildMetrics() *Metrics {
+	metrics := &Metrics{
+		up:       prometheus.NewDesc(strings.Join([]string{"awair", "up"}, "_"), "Was talking to the Awair local API successful.", []string{"device"}, nil),
+		readings: make(map[string]*prometheus.Desc),
+	}
+
+	for _, r := range readings {
+		metrics.readings[r.key] = prometheus.NewDesc(strings.Join([]string{"awair", r.name}, "_"), r.help, []string{"device"}, nil)
+	}
+
+	return metrics
+}
+
+// Describe implements the prometheus.Describe interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metrics.up
+	for _, r := range readings {
+		ch <- c.metrics.readings[r.key]
+	}
+	c.client.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface. Devices are read concurrently, a failing device doesn't
+// affect the others.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	defer c.client.Collect(ch)
+
+	var wg sync.WaitGroup
+	for _, device := range c.devices {
+		wg.Add(1)
+		go func(device Device) {
+			defer wg.Done()
+			c.collectDevice(ch, device)
+		}(device)
+	}
+	wg.Wait()
+}
+
+func (c *Collector) collectDevice(ch chan<- prometheus.Metric, device Device) {
+	body, err := c.get(c.ctx, device)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 0, device.Name)
+		c.logger.Log("level", "error", "message", "Failed collecting Awair data", "device", device.Name, "stack", errors.WithStack(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 1, device.Name)
+
+	for _, r := range readings {
+		value := gjson.GetBytes(body, r.key)
+		if value.Type != gjson.Number {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics.readings[r.key], prometheus.GaugeValue, value.Float(), device.Name)
+	}
+}
+
+// get returns the latest readings of the device.
+func (c *Collector) get(ctx context.Context, device Device) ([]byte, error) {
+	body, err := c.client.Get(ctx, device.URL+latestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !gjson.ValidBytes(body) {
+		return nil, errInvalidResponse
+	}
+
+	return body, nil
+}
@@ -0,0 +1,98 @@
+package awair
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func awairServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/element" + latestPath:
+			fmt.Fprint(w, `{"timestamp": "2021-03-01T10:00:00.000Z", "score": 88, "dew_point": 9.46, "temp": 21.55, "humid": 46.27, "abs_humid": 8.83, "co2": 612, "co2_est": 400, "voc": 187, "voc_baseline": 2430164, "pm25": 3, "pm10_est": 4}`)
+		case "/omni" + latestPath:
+			fmt.Fprint(w, `{"timestamp": "2021-03-01T10:00:00.000Z", "score": 92, "temp": 20.1, "humid": 40, "co2": 480, "voc": 95, "pm25": 1, "lux": 250.5, "spl_a": 42.3}`)
+		case "/broken" + latestPath:
+			fmt.Fprint(w, "<html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestParseDevice(t *testing.T) {
+	device, err := ParseDevice("living-room=http://192.168.1.20/")
+	assert.NoError(t, err)
+	assert.Equal(t, Device{Name: "living-room", URL: "http://192.168.1.20"}, device)
+
+	for _, invalid := range []string{"http://192.168.1.20", "=http://192.168.1.20", "office=192.168.1.20"} {
+		_, err := ParseDevice(invalid)
+		assert.True(t, errors.Is(err, errInvalidDevice), invalid)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := awairServer()
+	defer server.Close()
+
+	c, err := New(Config{
+		Devices: []Device{
+			{Name: "living-room", URL: server.URL + "/element"},
+			{Name: "office", URL: server.URL + "/omni"},
+			{Name: "broken", URL: server.URL + "/broken"},
+			{Name: "missing", URL: server.URL + "/missing"},
+		},
+	})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP awair_api_requests_total Awair local API requests by status code, or error if they weren't answered.
+# TYPE awair_api_requests_total counter
+awair_api_requests_total{code="200"} 3
+awair_api_requests_total{code="404"} 1
+# HELP awair_co2_ppm Carbon dioxide concentration measured by the Awair device.
+# TYPE awair_co2_ppm gauge
+awair_co2_ppm{device="living-room"} 612
+awair_co2_ppm{device="office"} 480
+# HELP awair_humidity_percent Relative humidity measured by the Awair device.
+# TYPE awair_humidity_percent gauge
+awair_humidity_percent{device="living-room"} 46.27
+awair_humidity_percent{device="office"} 40
+# HELP awair_illuminance_lux Illuminance measured by the Awair device.
+# TYPE awair_illuminance_lux gauge
+awair_illuminance_lux{device="office"} 250.5
+# HELP awair_noise_dba A-weighted sound pressure level measured by the Awair device.
+# TYPE awair_noise_dba gauge
+awair_noise_dba{device="office"} 42.3
+# HELP awair_pm25_micrograms_per_cubic_meter Concentration of fine particulate matter (PM2.5) measured by the Awair device.
+# TYPE awair_pm25_micrograms_per_cubic_meter gauge
+awair_pm25_micrograms_per_cubic_meter{device="living-room"} 3
+awair_pm25_micrograms_per_cubic_meter{device="office"} 1
+# HELP awair_score Awair score of the air quality, from 0 (bad) to 100 (good).
+# TYPE awair_score gauge
+awair_score{device="living-room"} 88
+awair_score{device="office"} 92
+# HELP awair_temperature_celsius Temperature measured by the Awair device.
+# TYPE awair_temperature_celsius gauge
+awair_temperature_celsius{device="living-room"} 21.55
+awair_temperature_celsius{device="office"} 20.1
+# HELP awair_up Was talking to the Awair local API successful.
+# TYPE awair_up gauge
+awair_up{device="broken"} 0
+awair_up{device="living-room"} 1
+awair_up{device="missing"} 0
+awair_up{device="office"} 1
+# HELP awair_voc_ppb Total volatile organic compounds concentration measured by the Awair device.
+# TYPE awair_voc_ppb gauge
+awair_voc_ppb{device="living-room"} 187
+awair_voc_ppb{device="office"} 95
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
@@ -0,0 +1,25 @@
+// Package awair implements a Prometheus collector for Awair air quality monitors, read with their local API, as
+// indoor air quality pairs naturally with the readings of thermostats.
+//
+// The local API must be enabled per device in the Awair Home app, under Awair+ > Awair APIs > Local API. The latest
+// readings are then served on http://DEVICE/air-data/latest. Devices are given as NAME=URL, where NAME is the value of
+// the "device" label:
+//
+//	device, err := awair.ParseDevice("living-room=http://192.168.1.20")
+//	if err != nil {
+//		return err
+//	}
+//
+//	collector, err := awair.New(awair.Config{
+//		Devices: []awair.Device{device},
+//		Timeout: 5000,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+//
+// Readings the device doesn't have, eg. the illuminance of the Element, aren't exported.
+package awair
@@ -0,0 +1,191 @@
+// Package httpx contains the HTTP plumbing shared by collectors calling provider APIs: a Client sending requests with
+// a timeout, retrying transient failures and counting requests by status code, and a Throttle limiting the rate and
+// concurrency of requests. Errors are wrapped with the sentinel errors of the collector, so they keep naming the
+// provider.
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/metricsutil"
+)
+
+// DefaultRetryDelay is the delay before the first retry of a transient failure, doubled for every further retry.
+const DefaultRetryDelay = 500 * time.Millisecond
+
+// codeError is the code label of requests failed without a response.
+const codeError = "error"
+
+// Errors are the sentinel errors of a collector wrapping failed requests.
+type Errors struct {
+	// Request wraps requests which couldn't be sent or weren't answered.
+	Request error
+	// ReadingBody wraps responses whose body couldn't be read.
+	ReadingBody error
+	// Non200 wraps responses of Get with other status codes than 200.
+	Non200 error
+}
+
+// Config provides the configuration necessary to create the Client. Transport defaults to http.DefaultTransport.
+// Timeout limits every attempt of a request, zero means no timeout. Transient failures, requests which weren't
+// answered and responses with the 429, 502, 503 or 504 status codes, are retried up to Retries times, waiting
+// RetryDelay, DefaultRetryDelay by default, and twice as long before every further retry. Requests are counted by
+// status code in the counter named Requests, unless it's empty.
+type Config struct {
+	Transport  http.RoundTripper
+	Timeout    time.Duration
+	Retries    int
+	RetryDelay time.Duration
+	Errors     Errors
+
+	Requests     string
+	RequestsHelp string
+}
+
+// Client sends requests of a collector. It's a prometheus.Collector exporting the request counter, which the
+// collector should describe and collect with its own metrics.
+type Client struct {
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+	errs       Errors
+	requests   *metricsutil.LabeledCounter
+}
+
+// New creates a Client using the given Config.
+func New(cfg Config) *Client {
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+
+	c := &Client{
+		client:     &http.Client{Transport: cfg.Transport, Timeout: cfg.Timeout},
+		retries:    cfg.Retries,
+		retryDelay: cfg.RetryDelay,
+		errs:       cfg.Errors,
+	}
+	if cfg.Requests != "" {
+		c.requests = metricsutil.NewLabeledCounter(cfg.Requests, cfg.RequestsHelp, "code")
+	}
+	return c
+}
+
+// Get requests the URL and returns the body of a 200 response.
+func (c *Client) Get(ctx context.Context, rawurl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, errors.Wrap(c.errs.Request, err.Error())
+	}
+
+	res, body, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Wrap(c.errs.Non200, fmt.Sprintf("code: %d", res.StatusCode))
+	}
+	return body, nil
+}
+
+// Do sends the request, retrying transient failures, and returns the last response with its body, which is already
+// closed. Responses with any status code are returned without an error. Only requests without a body are retried,
+// requests failed by a Throttle aren't, as they couldn't be sent before their deadline anyway.
+func (c *Client) Do(req *http.Request) (*http.Response, []byte, error) {
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		res, body, err := c.do(req)
+		if attempt >= c.retries || req.Body != nil || !transient(res) || errors.Is(err, ErrThrottled) || req.Context().Err() != nil {
+			return res, body, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return res, body, err
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	res, err := c.client.Do(req)
+	if err != nil {
+		c.count(codeError)
+		return nil, nil, &requestError{sentinel: c.errs.Request, err: err}
+	}
+
+	defer res.Body.Close()
+	c.count(strconv.Itoa(res.StatusCode))
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return res, nil, errors.Wrap(c.errs.ReadingBody, err.Error())
+	}
+	return res, body, nil
+}
+
+// requestError wraps the error of a request which wasn't answered with the sentinel error of the collector. Unlike
+// errors.Wrap, it keeps the error in the chain, so collectors can tell its cause, eg. a timeout.
+type requestError struct {
+	sentinel error
+	err      error
+}
+
+func (e *requestError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+// Is returns true for the sentinel error.
+func (e *requestError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// Unwrap returns the error of the request.
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func (c *Client) count(code string) {
+	if c.requests != nil {
+		c.requests.Inc(code)
+	}
+}
+
+// transient returns true if the request failed without a response or the API is temporarily unavailable.
+func transient(res *http.Response) bool {
+	if res == nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Client) Describe(ch chan<- *prometheus.Desc) {
+	if c.requests != nil {
+		c.requests.Describe(ch)
+	}
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Client) Collect(ch chan<- prometheus.Metric) {
+	if c.requests != nil {
+		c.requests.Collect(ch)
+	}
+}
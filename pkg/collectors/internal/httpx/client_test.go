@@ -0,0 +1,131 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	errRequest     = errors.New("failed test API request")
+	errReadingBody = errors.New("failed reading test API response body")
+	errNon200      = errors.New("test API responded with non-200 code")
+)
+
+func newTestClient(retries int) *Client {
+	return New(Config{
+		Retries:      retries,
+		RetryDelay:   time.Millisecond,
+		Errors:       Errors{Request: errRequest, ReadingBody: errReadingBody, Non200: errNon200},
+		Requests:     "test_api_requests_total",
+		RequestsHelp: "Test API requests.",
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	var requests int32
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer serv.Close()
+
+	client := newTestClient(2)
+	body, err := client.Get(context.Background(), serv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "the transient failure is retried")
+
+	expected := `
+# HELP test_api_requests_total Test API requests.
+# TYPE test_api_requests_total counter
+test_api_requests_total{code="200"} 1
+test_api_requests_total{code="503"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(client, strings.NewReader(expected)))
+}
+
+func TestClientErrors(t *testing.T) {
+	var requests int32
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer serv.Close()
+
+	client := newTestClient(2)
+	_, err := client.Get(context.Background(), serv.URL)
+	assert.True(t, errors.Is(err, errNon200))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "other status codes aren't retried")
+
+	_, err = client.Get(context.Background(), "http://nonexisting.server")
+	assert.True(t, errors.Is(err, errRequest))
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr), "the cause of the failed request is kept")
+
+	expected := `
+# HELP test_api_requests_total Test API requests.
+# TYPE test_api_requests_total counter
+test_api_requests_total{code="401"} 1
+test_api_requests_total{code="error"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(client, strings.NewReader(expected)), "failed attempts are retried")
+}
+
+func TestClientCancelled(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serv.Close()
+
+	client := New(Config{Retries: 5, RetryDelay: time.Hour, Errors: Errors{Non200: errNon200}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Get(ctx, serv.URL)
+	assert.True(t, errors.Is(err, errNon200), "the last response is returned")
+	assert.True(t, time.Since(start) < time.Second, "retries are aborted with the context")
+}
+
+func TestClientThrottled(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer serv.Close()
+
+	client := New(Config{
+		Transport:    NewThrottle(nil, 0, 1, 1),
+		Retries:      2,
+		RetryDelay:   time.Millisecond,
+		Errors:       Errors{Request: errRequest, ReadingBody: errReadingBody, Non200: errNon200},
+		Requests:     "test_api_requests_total",
+		RequestsHelp: "Test API requests.",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Get(ctx, serv.URL)
+	assert.NoError(t, err)
+	_, err = client.Get(ctx, serv.URL)
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.True(t, errors.Is(err, errRequest))
+
+	expected := `
+# HELP test_api_requests_total Test API requests.
+# TYPE test_api_requests_total counter
+test_api_requests_total{code="200"} 1
+test_api_requests_total{code="error"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(client, strings.NewReader(expected)), "throttled requests aren't retried")
+}
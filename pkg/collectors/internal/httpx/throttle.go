@@ -0,0 +1,154 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrThrottled is returned instead of sending requests which can't be sent within the deadline of their context,
+// because of the rate limit or too many requests in flight.
+var ErrThrottled = errors.New("API request throttled, it couldn't be sent before its deadline")
+
+// Throttle bounds the number of concurrent API requests and their rate. Collectors use their own Throttle, eg. the
+// Nest collector one per Device Access project, so the limits apply per API account. Requests over the limits are queued until they can be sent, unless their
+// deadline would pass in the meantime, in which case they fail right away instead of using up the scrape timeout.
+type Throttle struct {
+	base http.RoundTripper
+	now  func() time.Time
+
+	// slots holds a token for every request in flight, it's nil if the concurrency isn't bounded.
+	slots chan struct{}
+
+	// interval is the time between requests at the rate limit, zero if the rate isn't limited. Up to burst requests
+	// can be sent at once after being idle.
+	interval time.Duration
+	burst    int
+
+	mu        sync.Mutex
+	next      time.Time
+	queued    float64
+	throttled float64
+	waited    time.Duration
+}
+
+// NewThrottle creates a Throttle sending at most concurrency requests at once and requestsPerMinute requests per
+// minute with the base transport, or with http.DefaultTransport if it's nil. Zero disables the respective limit.
+func NewThrottle(base http.RoundTripper, concurrency int, requestsPerMinute float64, burst int) *Throttle {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t := &Throttle{base: base, now: time.Now, burst: burst}
+	if concurrency > 0 {
+		t.slots = make(chan struct{}, concurrency)
+	}
+	if requestsPerMinute > 0 {
+		t.interval = time.Duration(float64(time.Minute) / requestsPerMinute)
+	}
+	if t.burst < 1 {
+		t.burst = 1
+	}
+	return t
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Throttle) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	at, err := t.reserve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.queued++
+	t.mu.Unlock()
+	start := t.now()
+
+	err = t.wait(ctx, at)
+
+	t.mu.Lock()
+	t.queued--
+	t.waited += t.now().Sub(start)
+	if err != nil {
+		t.throttled++
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if t.slots != nil {
+		defer func() { <-t.slots }()
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// reserve returns the time the request may be sent at the rate limit. Requests which would be sent after their
+// deadline don't take a turn and fail with ErrThrottled.
+func (t *Throttle) reserve(ctx context.Context) (time.Time, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if t.interval == 0 {
+		return now, nil
+	}
+
+	// Turns not taken while idle are kept up to the burst.
+	next := t.next
+	if earliest := now.Add(-time.Duration(t.burst-1) * t.interval); next.Before(earliest) {
+		next = earliest
+	}
+
+	at := next
+	if at.Before(now) {
+		at = now
+	}
+	if deadline, ok := ctx.Deadline(); ok && at.After(deadline) {
+		t.throttled++
+		return time.Time{}, errors.Wrapf(ErrThrottled, "next request at the rate limit in %s", at.Sub(now))
+	}
+
+	t.next = next.Add(t.interval)
+	return at, nil
+}
+
+// wait blocks until the reserved time and until fewer requests than the concurrency limit are in flight, taking
+// a slot. It returns ErrThrottled if the context is done before.
+func (t *Throttle) wait(ctx context.Context, at time.Time) error {
+	if delay := at.Sub(t.now()); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return errors.Wrap(ErrThrottled, ctx.Err().Error())
+		}
+	}
+
+	if t.slots == nil {
+		return nil
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ErrThrottled, ctx.Err().Error())
+	}
+}
+
+// State returns the number of requests waiting to be sent, the number of requests failed by the throttle and the
+// total time requests waited.
+func (t *Throttle) State() (queued, throttled float64, waited time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.queued, t.throttled, t.waited
+}
@@ -0,0 +1,77 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+)
+
+func TestThrottleRateLimit(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer serv.Close()
+
+	// 600 requests per minute are one every 100ms, the first two are sent at once.
+	client := &http.Client{Transport: NewThrottle(nil, 0, 600, 2)}
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serv.URL, nil)
+		res, err := client.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+	}
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "the third request waits for the rate limit")
+
+	// The next turn is after the deadline, so the request fails without waiting.
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, serv.URL, nil)
+	_, err := client.Do(req)
+	assert.True(t, errors.Is(err, ErrThrottled))
+
+	_, throttled, waited := client.Transport.(*Throttle).State()
+	assert.Equal(t, 1.0, throttled)
+	assert.True(t, waited > 0)
+}
+
+func TestThrottleConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer serv.Close()
+
+	client := &http.Client{Transport: NewThrottle(nil, 2, 0, 0)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(serv.URL)
+			assert.NoError(t, err)
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+	queued, throttled, _ := client.Transport.(*Throttle).State()
+	assert.Equal(t, 0.0, queued)
+	assert.Equal(t, 0.0, throttled)
+}
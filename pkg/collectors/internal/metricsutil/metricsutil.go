@@ -0,0 +1,68 @@
+// Package metricsutil contains helpers shared by collectors to name and export metrics.
+package metricsutil
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Name joins the parts of a metric name with underscores, eg. Name("nest", "solar", "up") is nest_solar_up.
+func Name(parts ...string) string {
+	return strings.Join(parts, "_")
+}
+
+// Bool returns the value of a boolean gauge: 1 if b is true, 0 otherwise.
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// LabeledCounter counts events by the value of a single label, eg. requests by status code. It's a collector
+// exporting the counts as const metrics, so it can be collected by the collector owning it.
+type LabeledCounter struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+// NewLabeledCounter creates a LabeledCounter of the counter named name, with the label.
+func NewLabeledCounter(name, help, label string) *LabeledCounter {
+	return &LabeledCounter{
+		desc:   prometheus.NewDesc(name, help, []string{label}, nil),
+		counts: make(map[string]float64),
+	}
+}
+
+// Inc increments the count of the label value.
+func (c *LabeledCounter) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[value]++
+}
+
+// Value returns the count of the label value.
+func (c *LabeledCounter) Value(value string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[value]
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *LabeledCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *LabeledCounter) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for value, count := range c.counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, count, value)
+	}
+}
@@ -0,0 +1,33 @@
+package metricsutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "nest_solar_up", Name("nest", "solar", "up"))
+	assert.Equal(t, 1.0, Bool(true))
+	assert.Equal(t, 0.0, Bool(false))
+}
+
+func TestLabeledCounter(t *testing.T) {
+	c := NewLabeledCounter("test_requests_total", "Test requests.", "code")
+	c.Inc("200")
+	c.Inc("200")
+	c.Inc("error")
+
+	assert.Equal(t, 2.0, c.Value("200"))
+	assert.Equal(t, 0.0, c.Value("404"))
+
+	expected := `
+# HELP test_requests_total Test requests.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="error"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
@@ -0,0 +1,25 @@
+// Package mqtt implements a Prometheus collector for values published to an MQTT broker, eg. readings of Zigbee
+// sensors bridged by Zigbee2MQTT, so they can be compared with the readings of thermostats.
+//
+// The collector keeps a subscription to the broker in the background with Collector.Run, and exports the latest
+// value of every gauge per topic. Gauges are given as NAME=TOPIC[:PATH]: TOPIC is an MQTT topic filter, which can
+// contain the + and # wildcards, and PATH is the path of the value in JSON messages, in the syntax of
+// github.com/tidwall/gjson. Messages are plain numbers if PATH is empty. For example, Zigbee2MQTT publishes
+// {"temperature": 21.5, "humidity": 45, "battery": 97} to zigbee2mqtt/FRIENDLY_NAME, so the gauge
+// "temperature_celsius=zigbee2mqtt/+:temperature" exports mqtt_temperature_celsius{topic="zigbee2mqtt/living-room"}.
+//
+// The collector subscribes with QoS 0 and MQTT 3.1.1, over TCP or TLS, with the Eclipse Paho client:
+//
+//	collector, err := mqtt.New(mqtt.Config{
+//		Broker: "tcp://mosquitto.local:1883",
+//		Gauges: []mqtt.Gauge{{Name: "temperature_celsius", Topic: "zigbee2mqtt/+", Path: "temperature"}},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//
+//	go collector.Run(ctx)
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+package mqtt
@@ -0,0 +1,446 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// DefaultExpiry is the time after which values which weren't published again are no longer exported. Battery
+	// powered Zigbee sensors only report changes, but most send a heartbeat at least hourly.
+	DefaultExpiry = time.Hour
+
+	// DefaultRetryDelay is the time to wait before reconnecting to the broker.
+	DefaultRetryDelay = 10 * time.Second
+
+	// DefaultKeepAlive is the keep alive interval of the connection.
+	DefaultKeepAlive = time.Minute
+
+	// disconnectQuiesce is the time in milliseconds to wait for pending work when disconnecting.
+	disconnectQuiesce = 250
+
+	// protocolVersion is MQTT 3.1.1. The client falls back to 3.1 on any refused connection otherwise.
+	protocolVersion = 4
+
+	// subackFailure is the return code of refused subscriptions in SUBACK packets.
+	subackFailure = 0x80
+)
+
+// metricName matches valid gauge names, which are prefixed with "mqtt_".
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var (
+	errInvalidGauge      = errors.New("invalid MQTT gauge; expected NAME=TOPIC[:PATH], eg. temperature_celsius=zigbee2mqtt/+:temperature")
+	errInvalidBroker     = errors.New("invalid MQTT broker; expected a URL like tcp://mosquitto:1883 or ssl://mosquitto:8883")
+	errMissingGauges     = errors.New("missing MQTT gauges; expected at least one NAME=TOPIC[:PATH]")
+	errInvalidExpiry     = errors.New("invalid MQTT expiry; expected a positive duration")
+	errFailedConnecting  = errors.New("failed connecting to MQTT broker")
+	errFailedSubscribing = errors.New("failed subscribing to MQTT topics")
+	errSubscribeRefused  = errors.New("mqtt broker refused the subscription")
+)
+
+// Gauge is a value exported from messages of the topics matching Topic, labelled with the topic of the message.
+// Path is the path of the value in JSON messages, in the syntax of github.com/tidwall/gjson. If it's empty,
+// messages are plain numbers.
+type Gauge struct {
+	Name  string
+	Topic string
+	Path  string
+}
+
+// ParseGauge parses a gauge given as NAME=TOPIC[:PATH].
+func ParseGauge(text string) (Gauge, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 || !metricName.MatchString(parts[0]) {
+		return Gauge{}, errors.Wrap(errInvalidGauge, text)
+	}
+
+	gauge := Gauge{Name: parts[0], Topic: parts[1]}
+	if i := strings.LastIndex(gauge.Topic, ":"); i >= 0 {
+		gauge.Topic, gauge.Path = gauge.Topic[:i], gauge.Topic[i+1:]
+	}
+
+	if !validFilter(gauge.Topic) {
+		return Gauge{}, errors.Wrap(errInvalidGauge, text)
+	}
+
+	return gauge, nil
+}
+
+// validFilter returns true if the topic filter is valid: wildcards must take a whole level, and # must be last.
+func validFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.ContainsAny(level, "+#") && len(level) > 1 {
+			return false
+		}
+		if level == "#" && i != len(levels)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns true if the topic matches the topic filter.
+func matches(filter, topic string) bool {
+	// Topics starting with $ are used by brokers for their own statistics, wildcards don't match them.
+	if strings.HasPrefix(topic, "$") && !strings.HasPrefix(filter, "$") {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// Config provides the configuration necessary to create the Collector. Logger is optional, if it's nil the Collector
+// doesn't log anything. Broker is the URL of the broker, with the tcp or mqtt scheme, or ssl, tls or mqtts for TLS,
+// and optionally the user name and password. ClientID defaults to a random identifier. Expiry, RetryDelay and
+// KeepAlive default to DefaultExpiry, DefaultRetryDelay and DefaultKeepAlive.
+type Config struct {
+	Logger     log.Logger
+	Broker     string
+	ClientID   string
+	Gauges     []Gauge
+	Expiry     time.Duration
+	RetryDelay time.Duration
+	KeepAlive  time.Duration
+	TLSConfig  *tls.Config
+}
+
+// Collector implements the prometheus.Collector interface, exporting the latest values published to the broker.
+type Collector struct {
+	logger     log.Logger
+	broker     string
+	tlsConfig  *tls.Config
+	username   string
+	password   string
+	clientID   string
+	gauges     []Gauge
+	topics     []string
+	expiry     time.Duration
+	retryDelay time.Duration
+	keepAlive  time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	connected bool
+	values    map[sample]value
+
+	up    *prometheus.Desc
+	descs map[string]*prometheus.Desc
+}
+
+// sample identifies the value of a gauge in a topic.
+type sample struct {
+	name  string
+	topic string
+}
+
+type value struct {
+	value float64
+	at    time.Time
+}
+
+// New creates a Collector using the given Config. It doesn't connect to the broker, see Run.
+func New(cfg Config) (*Collector, error) {
+	u, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidBroker, err.Error())
+	}
+
+	var port string
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		port = "1883"
+	case "ssl", "tls", "mqtts":
+		port = "8883"
+		if cfg.TLSConfig == nil {
+			cfg.TLSConfig = &tls.Config{}
+		}
+	default:
+		return nil, errors.Wrap(errInvalidBroker, cfg.Broker)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.Wrap(errInvalidBroker, cfg.Broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	if len(cfg.Gauges) == 0 {
+		return nil, errMissingGauges
+	}
+
+	if cfg.TLSConfig != nil && cfg.TLSConfig.ServerName == "" {
+		cfg.TLSConfig = cfg.TLSConfig.Clone()
+		cfg.TLSConfig.ServerName = u.Hostname()
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.ClientID == "" {
+		// MQTT 3.1.1 brokers only have to accept identifiers of up to 23 characters.
+		id := make([]byte, 4)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		cfg.ClientID = "pronestheus-" + hex.EncodeToString(id)
+	}
+
+	if cfg.Expiry == 0 {
+		cfg.Expiry = DefaultExpiry
+	}
+	if cfg.Expiry < 0 {
+		return nil, errInvalidExpiry
+	}
+
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = DefaultKeepAlive
+	}
+
+	c := &Collector{
+		logger:     cfg.Logger,
+		broker:     u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port),
+		tlsConfig:  cfg.TLSConfig,
+		clientID:   cfg.ClientID,
+		gauges:     cfg.Gauges,
+		expiry:     cfg.Expiry,
+		retryDelay: cfg.RetryDelay,
+		keepAlive:  cfg.KeepAlive,
+		now:        time.Now,
+		values:     make(map[sample]value),
+		up:         prometheus.NewDesc("mqtt_up", "Is the exporter subscribed to the MQTT broker.", nil, nil),
+		descs:      make(map[string]*prometheus.Desc),
+	}
+
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+
+	seen := make(map[string]bool)
+	for _, gauge := range cfg.Gauges {
+		if !seen[gauge.Topic] {
+			seen[gauge.Topic] = true
+			c.topics = append(c.topics, gauge.Topic)
+		}
+		if _, ok := c.descs[gauge.Name]; !ok {
+			c.descs[gauge.Name] = prometheus.NewDesc("mqtt_"+gauge.Name, "Latest value published to the MQTT topic.", []string{"topic"}, nil)
+		}
+	}
+
+	return c, nil
+}
+
+// Run keeps a subscription to the broker until the context is cancelled. The first connection is retried after the
+// retry delay, later ones are reconnected by the client, waiting at most the retry delay between attempts.
+func (c *Collector) Run(ctx context.Context) {
+	client := paho.NewClient(c.options())
+	defer c.setConnected(false)
+	defer client.Disconnect(disconnectQuiesce)
+
+	for {
+		err := c.connect(ctx, client)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		c.logger.Log("level", "error", "message", "MQTT connection failed, reconnecting", "broker", c.broker, "stack", errors.WithStack(err))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.retryDelay):
+		}
+	}
+
+	<-ctx.Done()
+}
+
+// options returns the options of the client. Topics are subscribed again on every connection, as sessions are clean.
+func (c *Collector) options() *paho.ClientOptions {
+	return paho.NewClientOptions().
+		AddBroker(c.broker).
+		SetClientID(c.clientID).
+		SetProtocolVersion(protocolVersion).
+		SetUsername(c.username).
+		SetPassword(c.password).
+		SetTLSConfig(c.tlsConfig).
+		SetKeepAlive(c.keepAlive).
+		SetConnectTimeout(c.keepAlive).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(c.retryDelay).
+		SetOnConnectHandler(c.subscribe).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			c.setConnected(false)
+			c.logger.Log("level", "error", "message", "MQTT connection lost, reconnecting", "broker", c.broker, "stack", errors.WithStack(err))
+		})
+}
+
+// connect connects the client to the broker, the subscription is made once it's connected.
+func (c *Collector) connect(ctx context.Context, client paho.Client) error {
+	token := client.Connect()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-token.Done():
+	}
+
+	if err := token.Error(); err != nil {
+		return errors.Wrap(errFailedConnecting, err.Error())
+	}
+	return nil
+}
+
+// subscribe subscribes to the topics with QoS 0 and checks the broker accepted them. It's called by the client on
+// every connection.
+func (c *Collector) subscribe(client paho.Client) {
+	filters := make(map[string]byte, len(c.topics))
+	for _, topic := range c.topics {
+		filters[topic] = 0
+	}
+
+	token := client.SubscribeMultiple(filters, func(_ paho.Client, msg paho.Message) {
+		c.handle(msg.Topic(), msg.Payload())
+	})
+	if err := c.subscribed(token); err != nil {
+		c.logger.Log("level", "error", "message", "MQTT subscription failed", "broker", c.broker, "stack", errors.WithStack(err))
+		return
+	}
+
+	c.setConnected(true)
+	c.logger.Log("level", "info", "message", "Subscribed to MQTT topics", "broker", c.broker, "topics", strings.Join(c.topics, ","))
+}
+
+// subscribed waits for the subscription and returns an error if it failed or the broker refused a topic.
+func (c *Collector) subscribed(token paho.Token) error {
+	if !token.WaitTimeout(c.keepAlive) {
+		return errors.Wrap(errFailedSubscribing, "timeout")
+	}
+	if err := token.Error(); err != nil {
+		return errors.Wrap(errFailedSubscribing, err.Error())
+	}
+
+	if subscribe, ok := token.(*paho.SubscribeToken); ok {
+		for _, topic := range c.topics {
+			if subscribe.Result()[topic] == subackFailure {
+				return errors.Wrap(errSubscribeRefused, topic)
+			}
+		}
+	}
+	return nil
+}
+
+// handle updates the values of the gauges matching the topic of the message. Messages without a value are skipped,
+// eg. Zigbee2MQTT publishes state changes of switches to the same topic as readings of sensors.
+func (c *Collector) handle(topic string, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for _, gauge := range c.gauges {
+		if !matches(gauge.Topic, topic) {
+			continue
+		}
+
+		v, ok := parseValue(payload, gauge.Path)
+		if !ok {
+			c.logger.Log("level", "debug", "message", "MQTT message without a numeric value", "topic", topic, "gauge", gauge.Name)
+			continue
+		}
+		c.values[sample{name: gauge.Name, topic: topic}] = value{value: v, at: now}
+	}
+}
+
+// parseValue returns the value at the path of a JSON message, or the plain number without a path. Booleans, eg. of
+// contact sensors, are 0 or 1.
+func parseValue(payload []byte, path string) (float64, bool) {
+	if path == "" {
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+		return v, err == nil
+	}
+
+	if !gjson.ValidBytes(payload) {
+		return 0, false
+	}
+
+	result := gjson.GetBytes(payload, path)
+	switch result.Type {
+	case gjson.Number:
+		return result.Float(), true
+	case gjson.True:
+		return 1, true
+	case gjson.False:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func (c *Collector) setConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = connected
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements the prometheus.Collector interface. Values older than the expiry are dropped.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	up := 0.0
+	if c.connected {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
+
+	cutoff := c.now().Add(-c.expiry)
+	for s, v := range c.values {
+		if v.at.Before(cutoff) {
+			delete(c.values, s)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.descs[s.name], prometheus.GaugeValue, v.value, s.topic)
+	}
+}
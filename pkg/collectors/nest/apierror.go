@@ -0,0 +1,75 @@
+package nest
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// unknownStatus is the status of error responses without a Google API error body, eg. from a proxy.
+const unknownStatus = "UNKNOWN"
+
+// hints are remediation hints for the most common statuses of error responses.
+var hints = map[string]string{
+	"UNAUTHENTICATED":     "the access token was rejected, check the OAuth client ID, client secret and refresh token",
+	"PERMISSION_DENIED":   "the account didn't grant access to the project or device, authorize the Device Access project again",
+	"NOT_FOUND":           "check the project ID, it's the Device Access project ID, not the Google Cloud one",
+	"RESOURCE_EXHAUSTED":  "the rate limit of the API was exceeded, call it less often, eg. by collecting on an interval",
+	"UNAVAILABLE":         "the API is temporarily unavailable, it usually recovers on its own",
+	"FAILED_PRECONDITION": "the device can't execute the command in its current mode",
+}
+
+// APIError is an error response of the Smart Device Management API. Status is the canonical error code of Google
+// APIs, eg. UNAUTHENTICATED or RESOURCE_EXHAUSTED, and Message the reason given by the API. errors.Is matches
+// APIErrors with their cause, eg. ErrAuth for UNAUTHENTICATED, and, being non-200 responses, with the non-200 response
+// error.
+type APIError struct {
+	Code    int
+	Status  string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: code: %d, status: %s, message: %s", errNon200Response, e.Code, e.Status, e.Message)
+}
+
+// Is returns true for the non-200 response error and for the cause of the error.
+func (e *APIError) Is(target error) bool {
+	if target == errNon200Response {
+		return true
+	}
+	cause := statusCause(e.Code, e.Status)
+	return cause != nil && target == cause
+}
+
+// Hint returns a hint how to fix the cause of the error, or an empty string if there's none for its status.
+func (e *APIError) Hint() string {
+	return hints[e.Status]
+}
+
+// apiError parses the error body of a non-200 response and counts the error by its status.
+func (c *Collector) apiError(code int, body []byte) *APIError {
+	if len(body) > maxErrorBodySize {
+		body = body[:maxErrorBodySize]
+	}
+
+	err := &APIError{
+		Code:    code,
+		Status:  gjson.GetBytes(body, "error.status").String(),
+		Message: gjson.GetBytes(body, "error.message").String(),
+	}
+	if err.Status == "" {
+		err.Status = unknownStatus
+	}
+	if err.Message == "" {
+		err.Message = string(bytes.TrimSpace(body))
+	}
+
+	c.errorsMu.Lock()
+	c.apiErrors[err.Status]++
+	c.errorsMu.Unlock()
+
+	return err
+}
@@ -0,0 +1,64 @@
+package nest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// maxErrorBodySize limits the part of error responses included in errors.
+const maxErrorBodySize = 512
+
+var errFailedCommand = errors.New("failed executing Nest API command")
+
+// SetMode sets the thermostat mode: HEAT, COOL, HEATCOOL or OFF. The eco mode is set separately with SetEcoMode.
+func (c *Collector) SetMode(ctx context.Context, id, mode string) error {
+	return c.ExecuteCommand(ctx, id, "sdm.devices.commands.ThermostatMode.SetMode", map[string]interface{}{"mode": mode})
+}
+
+// SetEcoMode sets the eco mode: MANUAL_ECO or OFF.
+func (c *Collector) SetEcoMode(ctx context.Context, id, mode string) error {
+	return c.ExecuteCommand(ctx, id, "sdm.devices.commands.ThermostatEco.SetMode", map[string]interface{}{"mode": mode})
+}
+
+// SetHeat sets the heating setpoint in Celsius. The thermostat must be in the HEAT mode.
+func (c *Collector) SetHeat(ctx context.Context, id string, celsius float64) error {
+	return c.ExecuteCommand(ctx, id, "sdm.devices.commands.ThermostatTemperatureSetpoint.SetHeat", map[string]interface{}{"heatCelsius": celsius})
+}
+
+// ExecuteCommand executes the command with the params on the thermostat with the given ID (its resource name).
+// See https://developers.google.com/nest/device-access/traits for the available commands. Commands of a read-only
+// Collector fail with ErrReadOnly.
+func (c *Collector) ExecuteCommand(ctx context.Context, id, command string, params map[string]interface{}) error {
+	if c.readOnly {
+		return errors.Wrap(ErrReadOnly, "command: "+command)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"command": command, "params": params})
+	if err != nil {
+		return errors.Wrap(errFailedCommand, err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path.Base(id)+":executeCommand", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(errFailedRequest, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, body, err := c.client.Do(req)
+	if err != nil {
+		return withCause(requestCause(err), err)
+	}
+
+	if res.StatusCode != 200 {
+		return errors.Wrap(c.apiError(res.StatusCode, body), "command: "+command)
+	}
+
+	c.logger.Log("level", "info", "message", "Executed Nest API command", "id", id, "command", command)
+
+	return nil
+}
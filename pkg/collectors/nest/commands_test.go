@@ -0,0 +1,95 @@
+package nest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	mock "pronestheus/test"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+)
+
+func TestCommands(t *testing.T) {
+	type request struct {
+		path string
+		body string
+	}
+
+	var requests []request
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, request{path: r.URL.Path, body: string(body)})
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	id := "enterprises/PROJECT_ID/devices/DEVICE_ID"
+	ctx := context.Background()
+	assert.NoError(t, c.SetEcoMode(ctx, id, "OFF"))
+	assert.NoError(t, c.SetMode(ctx, id, "HEAT"))
+	assert.NoError(t, c.SetHeat(ctx, id, 7.5))
+
+	path := "/enterprises/PROJECT_ID/devices/DEVICE_ID:executeCommand"
+	assert.Equal(t, []request{
+		{path: path, body: `{"command":"sdm.devices.commands.ThermostatEco.SetMode","params":{"mode":"OFF"}}`},
+		{path: path, body: `{"command":"sdm.devices.commands.ThermostatMode.SetMode","params":{"mode":"HEAT"}}`},
+		{path: path, body: `{"command":"sdm.devices.commands.ThermostatTemperatureSetpoint.SetHeat","params":{"heatCelsius":7.5}}`},
+	}, requests)
+}
+
+func TestFailedCommand(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"code": 400, "message": "Thermostat is in eco mode.", "status": "FAILED_PRECONDITION"}}`))
+	}))
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	err = c.SetHeat(context.Background(), "enterprises/PROJECT_ID/devices/DEVICE_ID", 7)
+	assert.True(t, errors.Is(err, errNon200Response))
+	assert.Contains(t, err.Error(), "Thermostat is in eco mode.")
+
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "FAILED_PRECONDITION", apiErr.Status)
+}
+
+func TestReadOnlyCommand(t *testing.T) {
+	var requests int
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("{}"))
+	}))
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()), WithReadOnly())
+	assert.NoError(t, err)
+
+	err = c.SetMode(context.Background(), "enterprises/PROJECT_ID/devices/DEVICE_ID", "HEAT")
+	assert.True(t, errors.Is(err, ErrReadOnly))
+	assert.Equal(t, 0, requests)
+}
+
+func TestReadOnlyScopes(t *testing.T) {
+	o := defaultOptions()
+	WithDefaultCredentials("https://www.googleapis.com/auth/pubsub")(o)
+	assert.Equal(t, []string{Scope, "https://www.googleapis.com/auth/pubsub"}, o.requestedScopes())
+
+	WithReadOnly()(o)
+	assert.Equal(t, []string{Scope, "https://www.googleapis.com/auth/pubsub"}, o.requestedScopes(), "without read-only scopes the scope allowing commands is requested")
+
+	WithReadOnly("https://proxy.example.com/auth/read")(o)
+	assert.Equal(t, []string{"https://proxy.example.com/auth/read", "https://www.googleapis.com/auth/pubsub"}, o.requestedScopes())
+}
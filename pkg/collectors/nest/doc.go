@@ -0,0 +1,24 @@
+// Package nest implements a Prometheus collector for thermostats available through the Google Smart Device Management API.
+//
+// The collector doesn't depend on any global state, so it can be embedded in any Go program and registered in its own
+// Prometheus registry:
+//
+//	collector, err := nest.New(projectID,
+//		nest.WithOAuthClient(clientID, clientSecret),
+//		nest.WithRefreshToken(refreshToken),
+//		nest.WithTimeout(5*time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+//
+// Instead of the OAuth2 client credentials, any oauth2.TokenSource can be provided using WithTokenSource.
+//
+// Readings can also be fetched directly, without going through Prometheus, using Collector.Thermostats.
+//
+// Device events published by Device Access to Pub/Sub can be passed to Collector.HandleEvent to keep the readings
+// up to date between API calls.
+package nest
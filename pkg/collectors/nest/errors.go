@@ -0,0 +1,110 @@
+package nest
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+)
+
+// Causes of errors returned by the Collector, so embedding applications can branch on them with errors.Is:
+//
+//	if errors.Is(err, nest.ErrAuth) {
+//		// Authorize the Device Access project again.
+//	}
+//
+// Errors with other causes, eg. connection failures, match none of them.
+var (
+	// ErrAuth is the cause of errors of rejected credentials: the access token couldn't be refreshed with the OAuth2
+	// client and refresh token, or the API responded with UNAUTHENTICATED or PERMISSION_DENIED.
+	ErrAuth = errors.New("nest API authentication failed")
+
+	// ErrRateLimited is the cause of errors of requests over the quota of the API, responded with RESOURCE_EXHAUSTED,
+	// or over the rate and concurrency limits of the Collector, which weren't sent.
+	ErrRateLimited = errors.New("nest API rate limit exceeded")
+
+	// ErrParse is the cause of errors of responses and events which couldn't be parsed.
+	ErrParse = errors.New("failed parsing Nest API response")
+
+	// ErrTimeout is the cause of errors of requests which didn't complete within the timeout of the Collector or
+	// the deadline of their context.
+	ErrTimeout = errors.New("nest API request timed out")
+
+	// ErrReadOnly is the cause of errors of commands rejected by a read-only Collector, which weren't sent.
+	ErrReadOnly = errors.New("nest collector is read-only")
+)
+
+// Error is an error of the Collector with a known cause. It prints the same as the underlying error, errors.Is
+// matches it with its cause as well as with the errors it wraps, and errors.As finds it, eg. to read the Cause.
+type Error struct {
+	Cause error
+	Err   error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true for the cause of the error.
+func (e *Error) Is(target error) bool {
+	return target == e.Cause
+}
+
+// withCause returns err with the cause, or err unchanged if the cause is nil.
+func withCause(cause, err error) error {
+	if cause == nil {
+		return err
+	}
+	return &Error{Cause: cause, Err: err}
+}
+
+// requestError wraps the error of a failed request into wrapper, keeping the cause of the failure.
+func requestError(wrapper, err error) error {
+	return withCause(requestCause(err), errors.Wrap(wrapper, err.Error()))
+}
+
+// requestCause returns the cause of the error of a request which got no response, or nil if it's unknown.
+func requestCause(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, httpx.ErrThrottled):
+		return ErrRateLimited
+	case errors.As(err, &retrieveErr):
+		// The token endpoint failing with other status codes, eg. 5xx, doesn't mean the credentials are wrong.
+		if code := retrieveErr.Response.StatusCode; code == http.StatusBadRequest || code == http.StatusUnauthorized {
+			return ErrAuth
+		}
+		if retrieveErr.Response.StatusCode == http.StatusTooManyRequests {
+			return ErrRateLimited
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	}
+	return nil
+}
+
+// statusCause returns the cause of an error response with the status, or nil if it's unknown.
+func statusCause(code int, status string) error {
+	switch {
+	case status == "UNAUTHENTICATED" || status == "PERMISSION_DENIED" || code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrAuth
+	case status == "RESOURCE_EXHAUSTED" || code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == "DEADLINE_EXCEEDED" || code == http.StatusGatewayTimeout:
+		return ErrTimeout
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	mock "pronestheus/test"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+)
+
+func TestErrorCauses(t *testing.T) {
+	slowServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slowServ.Close()
+
+	limitedServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"code": 429, "message": "Rate limited", "status": "RESOURCE_EXHAUSTED"}}`))
+	}))
+	defer limitedServ.Close()
+
+	tokenServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer tokenServ.Close()
+
+	tests := []struct {
+		name  string
+		url   string
+		opts  []Option
+		cause error
+	}{
+		{"unauthenticated", mock.NestServerInvalidToken().URL, []Option{WithToken(mock.ValidToken())}, ErrAuth},
+		{"revoked refresh token", mock.NestServer().URL, []Option{WithRefreshToken("REVOKED"), WithTokenURL(tokenServ.URL)}, ErrAuth},
+		{"resource exhausted", limitedServ.URL, []Option{WithToken(mock.ValidToken())}, ErrRateLimited},
+		{"throttled", mock.NestServer().URL, []Option{WithToken(mock.ValidToken()), WithRateLimit(1, 1)}, ErrRateLimited},
+		{"invalid response", mock.NestServerInvalidResponse().URL, []Option{WithToken(mock.ValidToken())}, ErrParse},
+		{"timeout", slowServ.URL, []Option{WithToken(mock.ValidToken()), WithTimeout(10 * time.Millisecond)}, ErrTimeout},
+	}
+
+	causes := []error{ErrAuth, ErrRateLimited, ErrParse, ErrTimeout}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New("PROJECT_ID", append(tt.opts, WithAPIURL(tt.url))...)
+			assert.NoError(t, err)
+
+			// The first request uses up the rate limit, the next one would be sent after the deadline.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err = c.Thermostats(ctx)
+			if tt.name == "throttled" {
+				_, err = c.Devices(ctx)
+			}
+
+			assert.Error(t, err)
+			for _, cause := range causes {
+				assert.Equal(t, cause == tt.cause, errors.Is(err, cause), "%s is caused by %s", err, cause)
+			}
+		})
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServerInvalidResponse().URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	var nestErr *Error
+	assert.True(t, errors.As(err, &nestErr))
+	assert.Equal(t, ErrParse, nestErr.Cause)
+	assert.True(t, errors.Is(err, errFailedUnmarshalling), "the underlying error is still matched")
+
+	assert.True(t, errors.Is(c.HandleEvent([]byte("{")), ErrParse))
+}
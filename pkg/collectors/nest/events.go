@@ -0,0 +1,159 @@
+package nest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+var errInvalidEvent = errors.New("invalid Nest event")
+
+// Event types, as exported in the type label of nest_events_received_total.
+const (
+	eventResourceUpdate = "resource_update"
+	eventRelationUpdate = "relation_update"
+	eventOther          = "other"
+)
+
+// Reasons of discarded events, as exported in the reason label of nest_events_discarded_total.
+const (
+	discardUnknownDevice = "unknown_device"
+	discardOutdated      = "outdated"
+	discardDuplicate     = "duplicate"
+)
+
+// eventStats counts events handled by HandleEvent, by type and by the reason they were discarded.
+type eventStats struct {
+	mu        sync.Mutex
+	received  map[string]float64
+	discarded map[string]float64
+}
+
+func newEventStats() *eventStats {
+	return &eventStats{
+		received:  map[string]float64{eventResourceUpdate: 0, eventRelationUpdate: 0, eventOther: 0},
+		discarded: map[string]float64{discardUnknownDevice: 0, discardOutdated: 0, discardDuplicate: 0},
+	}
+}
+
+// receive counts a received event of the type. Stats are nil unless event metrics are enabled.
+func (s *eventStats) receive(eventType string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.received[eventType]++
+	s.mu.Unlock()
+}
+
+// discard counts an event discarded for the reason.
+func (s *eventStats) discard(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.discarded[reason]++
+	s.mu.Unlock()
+}
+
+// HandleEvent updates the readings with a device event received from the Device Access Pub/Sub subscription.
+// Only thermostats already known from the API are updated, events of other devices are discarded. Events may be
+// delivered out of order or more than once: traits are only updated by events newer than the last change of the trait,
+// and events with the ID of an event already applied are discarded.
+//
+// See https://developers.google.com/nest/device-access/api/events for the format of events.
+func (c *Collector) HandleEvent(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return withCause(ErrParse, errors.Wrap(errInvalidEvent, "malformed JSON"))
+	}
+
+	event := gjson.ParseBytes(data)
+
+	// Relation events (eg. a device added to a room) don't contain readings.
+	update := event.Get("resourceUpdate")
+	if !update.Exists() {
+		if event.Get("relationUpdate").Exists() {
+			c.events.receive(eventRelationUpdate)
+		} else {
+			c.events.receive(eventOther)
+		}
+		return nil
+	}
+	c.events.receive(eventResourceUpdate)
+
+	timestamp, err := time.Parse(time.RFC3339Nano, event.Get("timestamp").String())
+	if err != nil {
+		return withCause(ErrParse, errors.Wrap(errInvalidEvent, err.Error()))
+	}
+
+	updated, thermostats, reason := c.applyEvent(event.Get("eventId").String(), update.Get("name").String(), timestamp, update.Get("traits"))
+	if updated == nil {
+		c.events.discard(reason)
+		return nil
+	}
+
+	c.tracker.update([]*Thermostat{updated}, time.Now())
+	c.notify(thermostats)
+	return nil
+}
+
+// applyEvent replaces the cached reading of the thermostat with a copy updated with the fresh traits from the event.
+// It returns the updated reading and readings of all thermostats, or nil and the reason if the event was discarded.
+func (c *Collector) applyEvent(eventID, id string, timestamp time.Time, traits gjson.Result) (*Thermostat, []*Thermostat, string) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	for i, therm := range c.cached {
+		if therm.ID != id {
+			continue
+		}
+
+		if c.order.duplicate(eventID) {
+			return nil, nil, discardDuplicate
+		}
+
+		traits, ok := c.order.fresh(id, timestamp, traits)
+		if !ok {
+			return nil, nil, discardOutdated
+		}
+
+		// Cached readings may be in use by concurrent scrapes, so they're never modified in place.
+		updated := *therm
+		modes := c.modes[id]
+		applyTraits(&updated, &modes, traits)
+		updated.Mode = modes.current()
+		if timestamp.After(updated.UpdatedAt) {
+			updated.UpdatedAt = timestamp
+		}
+		c.modes[id] = modes
+
+		cached := make([]*Thermostat, len(c.cached))
+		copy(cached, c.cached)
+		cached[i] = &updated
+		c.cached = cached
+
+		return &updated, cached, ""
+	}
+
+	return nil, nil, discardUnknownDevice
+}
+
+// collectEvents exports the number of handled events, if event metrics are enabled.
+func (c *Collector) collectEvents(ch chan<- prometheus.Metric) {
+	if c.events == nil {
+		return
+	}
+
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+
+	for eventType, count := range c.events.received {
+		ch <- prometheus.MustNewConstMetric(c.metrics.eventsReceived, prometheus.CounterValue, count, eventType)
+	}
+	for reason, count := range c.events.discarded {
+		ch <- prometheus.MustNewConstMetric(c.metrics.eventsDiscarded, prometheus.CounterValue, count, reason)
+	}
+}
@@ -0,0 +1,192 @@
+package nest
+
+import (
+	"context"
+	"path"
+	mock "pronestheus/test"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const deviceName = "enterprises/PROJECT_ID/devices/DEVICE_ID"
+
+// event returns an event updating the traits of the device. Events of the same device at the same time have the
+// same ID, like an event delivered twice.
+func event(timestamp string, name string, traits string) []byte {
+	return []byte(`{
+		"eventId": "` + path.Base(name) + "@" + timestamp + `",
+		"timestamp": "` + timestamp + `",
+		"resourceUpdate": {
+			"name": "` + name + `",
+			"traits": ` + traits + `
+		},
+		"userId": "USER_ID"
+	}`)
+}
+
+func TestHandleEvent(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour))
+	assert.NoError(t, err)
+
+	before, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	future := time.Now().Add(time.Minute).UTC()
+
+	err = c.HandleEvent(event(future.Format(time.RFC3339Nano), deviceName, `{
+		"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 22.5},
+		"sdm.devices.traits.ThermostatEco": {"mode": "MANUAL_ECO"}
+	}`))
+	assert.NoError(t, err)
+
+	after, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 22.5, after[0].AmbientTemp)
+	assert.Equal(t, "ECO", after[0].Mode)
+	assert.Equal(t, future, after[0].UpdatedAt)
+	// Traits missing in the event keep their values.
+	assert.Equal(t, before[0].Humidity, after[0].Humidity)
+	// Readings returned before the event must not change.
+	assert.Equal(t, 20.23999, before[0].AmbientTemp)
+
+	// Leaving the eco mode restores the thermostat mode.
+	err = c.HandleEvent(event(future.Add(time.Second).Format(time.RFC3339Nano), deviceName, `{
+		"sdm.devices.traits.ThermostatEco": {"mode": "OFF"}
+	}`))
+	assert.NoError(t, err)
+
+	after, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "HEAT", after[0].Mode)
+
+	transitions, _ := c.tracker.modeTransitions(deviceName)
+	assert.Equal(t, []transition{{from: "ECO", to: "HEAT"}, {from: "HEAT", to: "ECO"}}, transitions)
+}
+
+func TestIgnoredEvents(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour))
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	traits := `{"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 30}}`
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name: "stale event",
+			data: event(past, deviceName, traits),
+		}, {
+			name: "unknown device",
+			data: event(future, "enterprises/PROJECT_ID/devices/OTHER", traits),
+		}, {
+			name: "relation event",
+			data: []byte(`{"eventId":"EVENT_ID","timestamp":"` + future + `","relationUpdate":{"type":"CREATED"}}`),
+		}, {
+			name:    "invalid timestamp",
+			data:    event("yesterday", deviceName, traits),
+			wantErr: errInvalidEvent,
+		}, {
+			name:    "invalid JSON",
+			data:    []byte(`{"eventId":`),
+			wantErr: errInvalidEvent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := c.HandleEvent(test.data)
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			thermostats, err := c.Thermostats(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 20.23999, thermostats[0].AmbientTemp)
+		})
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour), WithTimestamps())
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	err = c.HandleEvent(event("2030-01-02T03:04:05Z", deviceName, `{"sdm.devices.traits.Humidity": {"ambientHumidityPercent": 61}}`))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 61 1893553445000
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_humidity_percent"))
+}
+
+func TestEventMetrics(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour), WithEventMetrics())
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	traits := `{"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 30}}`
+
+	assert.NoError(t, c.HandleEvent(event(future, deviceName, traits)))
+	assert.NoError(t, c.HandleEvent(event(future, deviceName, traits)))
+	assert.NoError(t, c.HandleEvent(event(past, deviceName, traits)))
+	assert.NoError(t, c.HandleEvent(event(future, "enterprises/PROJECT_ID/devices/OTHER", traits)))
+	assert.NoError(t, c.HandleEvent([]byte(`{"eventId":"EVENT_ID","timestamp":"`+future+`","relationUpdate":{"type":"CREATED"}}`)))
+	assert.Error(t, c.HandleEvent([]byte(`{"eventId":`)))
+
+	want := `
+# HELP nest_events_discarded_total Number of events with readings which were discarded, by reason.
+# TYPE nest_events_discarded_total counter
+nest_events_discarded_total{reason="duplicate"} 1
+nest_events_discarded_total{reason="outdated"} 1
+nest_events_discarded_total{reason="unknown_device"} 1
+# HELP nest_events_received_total Number of Device Access events received by type.
+# TYPE nest_events_received_total counter
+nest_events_received_total{type="other"} 0
+nest_events_received_total{type="relation_update"} 1
+nest_events_received_total{type="resource_update"} 4
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_events_received_total", "nest_events_discarded_total"))
+}
+
+func TestRestoreReadings(t *testing.T) {
+	var calls int32
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServerWithCounter(&calls).URL), WithToken(mock.ValidToken()), WithCache(time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, c.Readings())
+
+	updated := time.Now().Add(-time.Minute).UTC()
+	c.RestoreReadings([]*Thermostat{{ID: deviceName, DeviceID: "DEVICE_ID", Label: "Custom Name", AmbientTemp: 19, Mode: "ECO", UpdatedAt: updated}})
+
+	// Restored readings are cached, and events older than them are discarded.
+	assert.NoError(t, c.HandleEvent(event(updated.Add(-time.Second).Format(time.RFC3339Nano), deviceName, `{
+		"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 30}
+	}`)))
+	thermostats, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), calls)
+	assert.Equal(t, 19.0, thermostats[0].AmbientTemp)
+	assert.Equal(t, thermostats, c.Readings())
+}
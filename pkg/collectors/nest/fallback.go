@@ -0,0 +1,162 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// requiredTraits are the traits of thermostats the exported readings are based on. The setpoint isn't required, the
+// API omits it while the thermostat is off.
+var requiredTraits = []string{
+	"sdm.devices.traits.Info",
+	"sdm.devices.traits.Connectivity",
+	"sdm.devices.traits.Temperature",
+	"sdm.devices.traits.Humidity",
+	"sdm.devices.traits.ThermostatMode",
+	"sdm.devices.traits.ThermostatHvac",
+}
+
+// fetchedDevice is a response of the devices.get endpoint, reused until it's older than the fallback TTL.
+type fetchedDevice struct {
+	traits    gjson.Result
+	fetchedAt time.Time
+}
+
+// deviceFallback fetches thermostats missing required traits in the devices.list response individually.
+type deviceFallback struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	devices map[string]fetchedDevice
+	fetches map[string]float64
+}
+
+func newDeviceFallback(ttl time.Duration) *deviceFallback {
+	return &deviceFallback{
+		ttl:     ttl,
+		devices: make(map[string]fetchedDevice),
+		fetches: map[string]float64{"success": 0, "failure": 0, "cached": 0},
+	}
+}
+
+// missingTraits returns true if any of the required traits is missing in the traits of the device.
+func missingTraits(traits gjson.Result) bool {
+	for _, trait := range requiredTraits {
+		if !traits.Get(strings.Replace(trait, ".", "\\.", -1)).Exists() {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchMissingTraits returns the traits of thermostats in the devices.list response which lack required traits,
+// fetched concurrently from the devices.get endpoint, keyed by device name. Responses are reused for the fallback TTL.
+// Devices which couldn't be fetched are logged and left out, so their readings are based on the list response.
+func (c *Collector) fetchMissingTraits(ctx context.Context, devices gjson.Result) map[string]gjson.Result {
+	var names []string
+	devices.ForEach(func(_, device gjson.Result) bool {
+		if device.Get("type").String() == thermostatType && missingTraits(device.Get("traits")) {
+			names = append(names, device.Get("name").String())
+		}
+		return true
+	})
+
+	fetched := make(map[string]gjson.Result)
+	if len(names) == 0 {
+		return fetched
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		if traits, ok := c.fallback.cached(name); ok {
+			fetched[name] = traits
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			traits, err := c.getDevice(ctx, name)
+			c.fallback.store(name, traits, err)
+			if err != nil {
+				c.logger.Log("level", "warn", "message", "Failed fetching Nest device missing traits in the devices list", "device", name, "stack", errors.WithStack(err))
+				return
+			}
+
+			mu.Lock()
+			fetched[name] = traits
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	return fetched
+}
+
+// getDevice calls the devices.get endpoint of the API and returns the traits of the device.
+func (c *Collector) getDevice(ctx context.Context, name string) (gjson.Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+path.Base(name), nil)
+	if err != nil {
+		return gjson.Result{}, errors.Wrap(errFailedRequest, err.Error())
+	}
+
+	res, body, err := c.client.Do(req)
+	if err != nil {
+		return gjson.Result{}, withCause(requestCause(err), err)
+	}
+
+	if res.StatusCode != 200 {
+		return gjson.Result{}, c.apiError(res.StatusCode, body)
+	}
+
+	return gjson.GetBytes(body, "traits"), nil
+}
+
+// cached returns the traits of the device fetched within the TTL.
+func (f *deviceFallback) cached(name string) (gjson.Result, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	device, ok := f.devices[name]
+	if !ok || time.Since(device.fetchedAt) >= f.ttl {
+		return gjson.Result{}, false
+	}
+
+	f.fetches["cached"]++
+	return device.traits, true
+}
+
+// store counts the result of fetching the device and caches its traits if it succeeded.
+func (f *deviceFallback) store(name string, traits gjson.Result, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err != nil {
+		f.fetches["failure"]++
+		return
+	}
+
+	f.fetches["success"]++
+	f.devices[name] = fetchedDevice{traits: traits, fetchedAt: time.Now()}
+}
+
+// state returns the number of device fetches by result.
+func (f *deviceFallback) state() map[string]float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fetches := make(map[string]float64, len(f.fetches))
+	for result, count := range f.fetches {
+		fetches[result] = count
+	}
+	return fetches
+}
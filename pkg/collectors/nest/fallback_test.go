@@ -0,0 +1,90 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	mock "pronestheus/test"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+// incompleteListServer returns a mock API listing a complete thermostat and one lacking the temperature and HVAC
+// traits, which are returned by the devices.get endpoint of the latter. Device requests are counted in gets.
+func incompleteListServer(gets *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/enterprises/PROJECT_ID/devices/":
+			w.Write([]byte(`{"devices": [
+				{"name": "enterprises/PROJECT_ID/devices/COMPLETE", "type": "sdm.devices.types.THERMOSTAT", "traits": {
+					"sdm.devices.traits.Info": {"customName": "Complete"},
+					"sdm.devices.traits.Connectivity": {"status": "ONLINE"},
+					"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 20},
+					"sdm.devices.traits.Humidity": {"ambientHumidityPercent": 50},
+					"sdm.devices.traits.ThermostatMode": {"mode": "HEAT", "availableModes": ["HEAT", "OFF"]},
+					"sdm.devices.traits.ThermostatHvac": {"status": "OFF"}
+				}},
+				{"name": "enterprises/PROJECT_ID/devices/PARTIAL", "type": "sdm.devices.types.THERMOSTAT", "traits": {
+					"sdm.devices.traits.Info": {"customName": "Partial"},
+					"sdm.devices.traits.Connectivity": {"status": "ONLINE"},
+					"sdm.devices.traits.Humidity": {"ambientHumidityPercent": 40},
+					"sdm.devices.traits.ThermostatMode": {"mode": "HEAT", "availableModes": ["HEAT", "OFF"]}
+				}}
+			]}`))
+		case "/enterprises/PROJECT_ID/devices/PARTIAL":
+			atomic.AddInt32(gets, 1)
+			w.Write([]byte(`{"name": "enterprises/PROJECT_ID/devices/PARTIAL", "type": "sdm.devices.types.THERMOSTAT", "traits": {
+				"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 18.5},
+				"sdm.devices.traits.ThermostatHvac": {"status": "HEATING"}
+			}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestDeviceFallback(t *testing.T) {
+	var gets int32
+	serv := incompleteListServer(&gets)
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()), WithDeviceFallback(time.Minute))
+	assert.NoError(t, err)
+
+	thermostats, err := c.getNestReadings(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(thermostats))
+	assert.Equal(t, 18.5, thermostats[1].AmbientTemp, "traits missing in the list are fetched")
+	assert.Equal(t, "HEATING", thermostats[1].Status)
+	assert.Equal(t, 40.0, thermostats[1].Humidity, "traits of the list are kept")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets), "only incomplete devices are fetched")
+
+	// Fetched devices are reused within the TTL.
+	_, err = c.getNestReadings(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets))
+	assert.Equal(t, map[string]float64{"success": 1, "failure": 0, "cached": 1}, c.fallback.state())
+
+	devices, err := c.Devices(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(devices[1].Traits), "devices include fetched traits")
+}
+
+func TestDeviceFallbackDisabled(t *testing.T) {
+	var gets int32
+	serv := incompleteListServer(&gets)
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	thermostats, err := c.getNestReadings(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, thermostats[1].AmbientTemp)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&gets))
+	assert.Nil(t, c.fallback)
+}
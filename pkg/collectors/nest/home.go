@@ -0,0 +1,106 @@
+package nest
+
+import (
+	"math"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/metricsutil"
+	"pronestheus/pkg/units"
+)
+
+// homeMetrics contains the metrics aggregated across all thermostats.
+type homeMetrics struct {
+	ambientTempMin  map[string]*prometheus.Desc
+	ambientTempMax  map[string]*prometheus.Desc
+	ambientTempMean map[string]*prometheus.Desc
+	heating         *prometheus.Desc
+	cooling         *prometheus.Desc
+	thermostats     *prometheus.Desc
+	structureHome   *prometheus.Desc
+}
+
+func buildHomeMetrics(units []string) *homeMetrics {
+	metrics := &homeMetrics{
+		ambientTempMin:  make(map[string]*prometheus.Desc),
+		ambientTempMax:  make(map[string]*prometheus.Desc),
+		ambientTempMean: make(map[string]*prometheus.Desc),
+		heating:         prometheus.NewDesc("nest_home_heating", "Is any thermostat heating.", nil, nil),
+		cooling:         prometheus.NewDesc("nest_home_cooling", "Is any thermostat cooling.", nil, nil),
+		thermostats:     prometheus.NewDesc("nest_home_thermostats", "Number of thermostats.", nil, nil),
+		structureHome:   prometheus.NewDesc("nest_structure_home", "Is any thermostat of the structure out of eco mode, a proxy for anyone being home since Home/Away Assist switches all of them to eco mode while everyone is away.", []string{"structure"}, nil),
+	}
+
+	for _, unit := range units {
+		metrics.ambientTempMin[unit] = prometheus.NewDesc("nest_home_ambient_temperature_min_"+unit, "Lowest inside temperature across all thermostats.", nil, nil)
+		metrics.ambientTempMax[unit] = prometheus.NewDesc("nest_home_ambient_temperature_max_"+unit, "Highest inside temperature across all thermostats.", nil, nil)
+		metrics.ambientTempMean[unit] = prometheus.NewDesc("nest_home_ambient_temperature_mean_"+unit, "Mean inside temperature across all thermostats.", nil, nil)
+	}
+
+	return metrics
+}
+
+func (m *homeMetrics) describe(ch chan<- *prometheus.Desc, units []string) {
+	for _, unit := range units {
+		ch <- m.ambientTempMin[unit]
+		ch <- m.ambientTempMax[unit]
+		ch <- m.ambientTempMean[unit]
+	}
+	ch <- m.heating
+	ch <- m.cooling
+	ch <- m.thermostats
+	ch <- m.structureHome
+}
+
+// collectHome sends the metrics aggregated across all thermostats.
+func (c *Collector) collectHome(ch chan<- prometheus.Metric, thermostats []*Thermostat) {
+	m := c.metrics.home
+
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	heating, cooling := false, false
+	// home contains whether any thermostat of every structure isn't in eco mode.
+	home := make(map[string]bool)
+
+	for _, therm := range thermostats {
+		if therm.Structure != "" {
+			home[therm.Structure] = home[therm.Structure] || therm.Mode != "ECO"
+		}
+		min = math.Min(min, therm.AmbientTemp)
+		max = math.Max(max, therm.AmbientTemp)
+		sum += therm.AmbientTemp
+		heating = heating || therm.Status == "HEATING"
+		cooling = cooling || therm.Status == "COOLING"
+	}
+
+	ch <- prometheus.MustNewConstMetric(m.thermostats, prometheus.GaugeValue, float64(len(thermostats)))
+	ch <- prometheus.MustNewConstMetric(m.heating, prometheus.GaugeValue, metricsutil.Bool(heating))
+	ch <- prometheus.MustNewConstMetric(m.cooling, prometheus.GaugeValue, metricsutil.Bool(cooling))
+	for structure, anyone := range home {
+		ch <- prometheus.MustNewConstMetric(m.structureHome, prometheus.GaugeValue, metricsutil.Bool(anyone), structure)
+	}
+
+	if len(thermostats) == 0 {
+		return
+	}
+
+	mean := sum / float64(len(thermostats))
+	for _, unit := range c.units {
+		ch <- prometheus.MustNewConstMetric(m.ambientTempMin[unit], prometheus.GaugeValue, units.FromCelsius(min, unit))
+		ch <- prometheus.MustNewConstMetric(m.ambientTempMax[unit], prometheus.GaugeValue, units.FromCelsius(max, unit))
+		ch <- prometheus.MustNewConstMetric(m.ambientTempMean[unit], prometheus.GaugeValue, units.FromCelsius(mean, unit))
+	}
+}
+
+// structureID returns the ID of the structure from the resource name of a room, eg.
+// "enterprises/PROJECT_ID/structures/STRUCTURE_ID/rooms/ROOM_ID" -> "STRUCTURE_ID". It's empty if the name doesn't
+// contain a structure.
+func structureID(parent string) string {
+	parts := strings.Split(parent, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "structures" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package nest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// homeCollector collects only the home metrics of the given thermostats.
+type homeCollector struct {
+	c           *Collector
+	thermostats []*Thermostat
+}
+
+func (h homeCollector) Describe(ch chan<- *prometheus.Desc) {
+	h.c.metrics.home.describe(ch, h.c.units)
+}
+
+func (h homeCollector) Collect(ch chan<- prometheus.Metric) {
+	h.c.collectHome(ch, h.thermostats)
+}
+
+func TestHomeMetrics(t *testing.T) {
+	c, err := New("PROJECT_ID", WithUnit("both"))
+	assert.NoError(t, err)
+
+	thermostats := []*Thermostat{
+		{ID: "a", AmbientTemp: 18, Status: "OFF", Mode: "ECO", Structure: "HOME"},
+		{ID: "b", AmbientTemp: 20, Status: "HEATING", Mode: "HEAT", Structure: "HOME"},
+		{ID: "c", AmbientTemp: 22, Status: "OFF", Mode: "ECO", Structure: "CABIN"},
+	}
+
+	expected := `
+# HELP nest_home_ambient_temperature_max_celsius Highest inside temperature across all thermostats.
+# TYPE nest_home_ambient_temperature_max_celsius gauge
+nest_home_ambient_temperature_max_celsius 22
+# HELP nest_home_ambient_temperature_mean_celsius Mean inside temperature across all thermostats.
+# TYPE nest_home_ambient_temperature_mean_celsius gauge
+nest_home_ambient_temperature_mean_celsius 20
+# HELP nest_home_ambient_temperature_min_fahrenheit Lowest inside temperature across all thermostats.
+# TYPE nest_home_ambient_temperature_min_fahrenheit gauge
+nest_home_ambient_temperature_min_fahrenheit 64.4
+# HELP nest_home_cooling Is any thermostat cooling.
+# TYPE nest_home_cooling gauge
+nest_home_cooling 0
+# HELP nest_home_heating Is any thermostat heating.
+# TYPE nest_home_heating gauge
+nest_home_heating 1
+# HELP nest_home_thermostats Number of thermostats.
+# TYPE nest_home_thermostats gauge
+nest_home_thermostats 3
+# HELP nest_structure_home Is any thermostat of the structure out of eco mode, a proxy for anyone being home since Home/Away Assist switches all of them to eco mode while everyone is away.
+# TYPE nest_structure_home gauge
+nest_structure_home{structure="CABIN"} 0
+nest_structure_home{structure="HOME"} 1
+`
+
+	err = testutil.CollectAndCompare(homeCollector{c, thermostats}, strings.NewReader(expected),
+		"nest_home_ambient_temperature_max_celsius",
+		"nest_home_ambient_temperature_mean_celsius",
+		"nest_home_ambient_temperature_min_fahrenheit",
+		"nest_home_cooling",
+		"nest_home_heating",
+		"nest_home_thermostats",
+		"nest_structure_home",
+	)
+	assert.NoError(t, err)
+}
+
+func TestStructureID(t *testing.T) {
+	assert.Equal(t, "STRUCTURE_ID", structureID("enterprises/PROJECT_ID/structures/STRUCTURE_ID/rooms/ROOM_ID"))
+	assert.Equal(t, "", structureID(""))
+	assert.Equal(t, "", structureID("enterprises/PROJECT_ID/structures"))
+}
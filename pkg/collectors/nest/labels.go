@@ -0,0 +1,154 @@
+package nest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Label policies define how custom names of thermostats are normalized before they're used as label values.
+const (
+	// LabelDashes replaces spaces with dashes, eg. "Living Room" -> "Living-Room". It's the default policy.
+	LabelDashes = "dashes"
+	// LabelKeep keeps custom names as they are, eg. "Living Room" -> "Living Room".
+	LabelKeep = "keep"
+	// LabelLowercase replaces spaces with dashes and lowercases the name, eg. "Living Room" -> "living-room".
+	LabelLowercase = "lowercase"
+	// LabelSlugify transliterates the name to lowercase ASCII letters and digits separated with dashes,
+	// eg. "Salón de Estar 🛋" -> "salon-de-estar".
+	LabelSlugify = "slugify"
+)
+
+// ID policies select the value of the id label of thermostats, which is their resource name by default.
+const (
+	// IDFull keeps the resource name, eg. "enterprises/PROJECT_ID/devices/DEVICE_ID". It's the default policy.
+	IDFull = "full"
+	// IDShort uses the device ID, the last segment of the resource name, eg. "DEVICE_ID".
+	IDShort = "short"
+	// IDHash uses a hash of the resource name, stable across restarts but not revealing the project.
+	IDHash = "hash"
+	// IDNone omits the id label from metrics, thermostats are identified by their device_id label. Outputs other than
+	// metrics, like the JSON API, keep the resource name.
+	IDNone = "none"
+)
+
+// idHashLength is the number of hex digits of hashed ids.
+const idHashLength = 12
+
+// transliterations contains Latin letters which don't decompose into an ASCII letter and a diacritical mark.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'ø': "o", 'Ø': "o", 'œ': "oe", 'Œ': "oe",
+	'ł': "l", 'Ł': "l", 'đ': "d", 'Đ': "d", 'þ': "th", 'Þ': "th", 'ı': "i",
+}
+
+// labelNormalizer returns the function normalizing custom names according to the policy.
+func labelNormalizer(policy string) (func(string) string, error) {
+	var normalize func(string) string
+
+	switch policy {
+	case "", LabelDashes:
+		normalize = func(s string) string { return strings.Replace(s, " ", "-", -1) }
+	case LabelKeep:
+		normalize = func(s string) string { return s }
+	case LabelLowercase:
+		normalize = func(s string) string { return strings.ToLower(strings.Replace(s, " ", "-", -1)) }
+	case LabelSlugify:
+		normalize = slugify
+	default:
+		return nil, errInvalidLabelPolicy
+	}
+
+	// Label values must be valid UTF-8, otherwise the metric can't be created.
+	return func(s string) string {
+		return normalize(strings.ToValidUTF8(s, ""))
+	}, nil
+}
+
+// IDLabel returns the value of the id label of the thermostat with the resource name according to the policy.
+// Unknown policies keep the resource name.
+func IDLabel(policy, id string) string {
+	switch policy {
+	case IDShort:
+		return path.Base(id)
+	case IDHash:
+		sum := sha256.Sum256([]byte(id))
+		return hex.EncodeToString(sum[:])[:idHashLength]
+	default:
+		return id
+	}
+}
+
+// MetricLabels identifies thermostats in metrics with the "id", "device_id" and "label" labels. Packages deriving
+// metrics from readings take it in their configs, so their series match the ones of the Nest collector. The zero value
+// uses the resource name as the id and the custom name as the label.
+type MetricLabels struct {
+	// IDPolicy selects the value of the id label, see IDLabel. The label is omitted under IDNone.
+	IDPolicy string
+	// Label returns the value of the "label" label, eg. Collector.MetricLabel. The custom name is used if it's nil.
+	Label func(therm *Thermostat) string
+}
+
+// Names returns the names of the labels, followed by the extra names. Descriptors keep the slice, so it has no spare
+// capacity and appending to it doesn't change the labels of other descriptors.
+func (l MetricLabels) Names(extra ...string) []string {
+	names := []string{"id", "device_id", "label"}
+	if l.IDPolicy == IDNone {
+		names = names[1:]
+	}
+
+	return append(names[:len(names):len(names)], extra...)
+}
+
+// Values returns the values of the labels of the thermostat in the order of Names, followed by the extra values.
+func (l MetricLabels) Values(therm *Thermostat, extra ...string) []string {
+	label := therm.Label
+	if l.Label != nil {
+		label = l.Label(therm)
+	}
+
+	values := make([]string, 0, 3+len(extra))
+	if l.IDPolicy != IDNone {
+		values = append(values, IDLabel(l.IDPolicy, therm.ID))
+	}
+	values = append(values, therm.DeviceID, label)
+
+	return append(values, extra...)
+}
+
+// slugify converts the string into lowercase ASCII letters and digits. Letters with diacritics are replaced with their
+// base letters, any other characters are collapsed into single dashes.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		var chunk string
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			chunk = string(unicode.ToLower(r))
+		case transliterations[r] != "":
+			chunk = transliterations[r]
+		}
+
+		if chunk == "" {
+			dash = b.Len() > 0
+			continue
+		}
+
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteString(chunk)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package nest
+
+import (
+	mock "pronestheus/test"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLabelPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		input  string
+		want   string
+	}{
+		{LabelDashes, "Living Room", "Living-Room"},
+		{"", "Living Room", "Living-Room"},
+		{LabelKeep, "Living Room", "Living Room"},
+		{LabelKeep, "Salón 🛋", "Salón 🛋"},
+		{LabelKeep, "Bad \xff UTF-8", "Bad  UTF-8"},
+		{LabelLowercase, "Living Room", "living-room"},
+		{LabelLowercase, "Éntrée", "éntrée"},
+		{LabelSlugify, "Living Room", "living-room"},
+		{LabelSlugify, "Salón de Estar 🛋", "salon-de-estar"},
+		{LabelSlugify, "  Kid's room #2  ", "kid-s-room-2"},
+		{LabelSlugify, "Straße Øst", "strasse-ost"},
+		{LabelSlugify, "🔥", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy+" "+test.input, func(t *testing.T) {
+			normalize, err := labelNormalizer(test.policy)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, normalize(test.input))
+		})
+	}
+}
+
+func TestInvalidLabelPolicy(t *testing.T) {
+	_, err := labelNormalizer("uppercase")
+	assert.True(t, errors.Is(err, errInvalidLabelPolicy))
+
+	c, err := New("PROJECT_ID", WithLabelPolicy("uppercase"))
+	assert.Nil(t, c)
+	assert.True(t, errors.Is(err, errInvalidLabelPolicy))
+}
+
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantLbl string
+	}{
+		{
+			name:    "no alias",
+			wantLbl: "Custom-Name",
+		}, {
+			name:    "alias by device ID",
+			opts:    []Option{WithAliases(map[string]string{"DEVICE_ID": "Upstairs Hallway"})},
+			wantLbl: "Upstairs-Hallway",
+		}, {
+			name:    "alias by full name",
+			opts:    []Option{WithAliases(map[string]string{"enterprises/PROJECT_ID/devices/DEVICE_ID": "hallway"})},
+			wantLbl: "hallway",
+		}, {
+			name:    "alias of other device",
+			opts:    []Option{WithAliases(map[string]string{"OTHER_DEVICE": "hallway"})},
+			wantLbl: "Custom-Name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]Option{WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken())}, test.opts...)
+			c, err := New("PROJECT_ID", opts...)
+			assert.NoError(t, err)
+
+			want := `
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="` + test.wantLbl + `"} 57
+`
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_humidity_percent"))
+		})
+	}
+}
+
+func TestIDPolicies(t *testing.T) {
+	tests := []struct {
+		policy string
+		wantID string
+	}{
+		{policy: IDFull, wantID: "enterprises/PROJECT_ID/devices/DEVICE_ID"},
+		{policy: IDShort, wantID: "DEVICE_ID"},
+		{policy: IDHash, wantID: "041322010a5e"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithIDPolicy(test.policy))
+			assert.NoError(t, err)
+
+			want := `
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{device_id="DEVICE_ID",id="` + test.wantID + `",label="Custom-Name"} 57
+`
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_humidity_percent"))
+			assert.Equal(t, test.wantID, IDLabel(test.policy, "enterprises/PROJECT_ID/devices/DEVICE_ID"))
+		})
+	}
+
+	_, err := New("PROJECT_ID", WithIDPolicy("path"))
+	assert.True(t, errors.Is(err, errInvalidIDPolicy))
+}
+
+func TestIDNone(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithIDPolicy(IDNone))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{device_id="DEVICE_ID",label="Custom-Name"} 57
+# HELP nest_thermostat_mode Current mode of the thermostat, 1 for the current mode and 0 for the others.
+# TYPE nest_thermostat_mode gauge
+nest_thermostat_mode{device_id="DEVICE_ID",label="Custom-Name",mode="COOL"} 0
+nest_thermostat_mode{device_id="DEVICE_ID",label="Custom-Name",mode="ECO"} 0
+nest_thermostat_mode{device_id="DEVICE_ID",label="Custom-Name",mode="HEAT"} 1
+nest_thermostat_mode{device_id="DEVICE_ID",label="Custom-Name",mode="HEATCOOL"} 0
+nest_thermostat_mode{device_id="DEVICE_ID",label="Custom-Name",mode="OFF"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_humidity_percent", "nest_thermostat_mode"))
+}
+
+func TestMetricLabels(t *testing.T) {
+	therm := &Thermostat{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID", DeviceID: "DEVICE_ID", Label: "Living Room"}
+
+	var labels MetricLabels
+	assert.Equal(t, []string{"id", "device_id", "label", "action"}, labels.Names("action"))
+	assert.Equal(t, []string{"enterprises/PROJECT_ID/devices/DEVICE_ID", "DEVICE_ID", "Living Room", "heating"}, labels.Values(therm, "heating"))
+
+	labels = MetricLabels{IDPolicy: IDNone, Label: func(therm *Thermostat) string { return "Living-Room" }}
+	assert.Equal(t, []string{"device_id", "label"}, labels.Names())
+	assert.Equal(t, []string{"DEVICE_ID", "Living-Room"}, labels.Values(therm))
+
+	// Names are kept by descriptors, so appending to them must not change other names.
+	names := labels.Names()
+	first, second := append(names, "from"), append(names, "to")
+	assert.Equal(t, []string{"device_id", "label", "from"}, first)
+	assert.Equal(t, []string{"device_id", "label", "to"}, second)
+}
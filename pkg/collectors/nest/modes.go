@@ -0,0 +1,77 @@
+package nest
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/metricsutil"
+)
+
+// Representations of the current mode of thermostats.
+const (
+	// ModeMetricsStateSet exports nest_thermostat_mode with a "mode" label, 1 for the current mode and 0 for the
+	// others. It's the default representation.
+	ModeMetricsStateSet = "stateset"
+	// ModeMetricsBooleans exports a gauge for every mode, eg. nest_thermostat_mode_heat.
+	ModeMetricsBooleans = "booleans"
+	// ModeMetricsBoth exports both representations.
+	ModeMetricsBoth = "both"
+)
+
+// modes are the modes exported for every thermostat. ECO overrides the regular mode, so exactly one of them is
+// current for thermostats reporting their mode.
+var modes = []string{"HEAT", "COOL", "HEATCOOL", "ECO", "OFF"}
+
+// modeMetrics contains the descriptors of the current mode in the configured representations.
+type modeMetrics struct {
+	stateSet *prometheus.Desc
+	booleans map[string]*prometheus.Desc
+}
+
+func buildModeMetrics(representation string, labels []string) (*modeMetrics, error) {
+	m := &modeMetrics{}
+
+	switch representation {
+	case "", ModeMetricsStateSet, ModeMetricsBooleans, ModeMetricsBoth:
+	default:
+		return nil, errInvalidModeMetrics
+	}
+
+	if representation != ModeMetricsBooleans {
+		m.stateSet = prometheus.NewDesc("nest_thermostat_mode", "Current mode of the thermostat, 1 for the current mode and 0 for the others.", append(labels, "mode"), nil)
+	}
+
+	if representation == ModeMetricsBooleans || representation == ModeMetricsBoth {
+		m.booleans = make(map[string]*prometheus.Desc, len(modes))
+		for _, mode := range modes {
+			m.booleans[mode] = prometheus.NewDesc("nest_thermostat_mode_"+strings.ToLower(mode), "Is the thermostat in the "+mode+" mode.", labels, nil)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *modeMetrics) describe(ch chan<- *prometheus.Desc) {
+	if m.stateSet != nil {
+		ch <- m.stateSet
+	}
+	for _, mode := range modes {
+		if desc, ok := m.booleans[mode]; ok {
+			ch <- desc
+		}
+	}
+}
+
+// collectMode exports the current mode of the thermostat.
+func (c *Collector) collectMode(ch chan<- prometheus.Metric, therm *Thermostat, labels []string) {
+	for _, mode := range modes {
+		current := metricsutil.Bool(therm.Mode == mode)
+		if c.modeMetrics.stateSet != nil {
+			ch <- c.reading(therm, c.modeMetrics.stateSet, current, append(labels, mode))
+		}
+		if desc, ok := c.modeMetrics.booleans[mode]; ok {
+			ch <- c.reading(therm, desc, current, labels)
+		}
+	}
+}
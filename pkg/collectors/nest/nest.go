@@ -2,46 +2,152 @@ package nest
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tidwall/gjson"
+	"golang.org/x/sync/singleflight"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/endpoints"
 
 	"github.com/go-kit/kit/log"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+	"pronestheus/pkg/collectors/internal/metricsutil"
+	"pronestheus/pkg/units"
+	"pronestheus/pkg/useragent"
+)
+
+const (
+	thermostatType = "sdm.devices.types.THERMOSTAT"
+
+	// deviceTypePrefix is the prefix of device types, which is left out of the type label of discovered devices.
+	deviceTypePrefix = "sdm.devices.types."
+
+	// maxExtraLabels is the most labels a metric of a thermostat has besides id, device_id and label, the from and to
+	// modes of transitions.
+	maxExtraLabels = 2
 )
 
+// retries is the number of retries of transient Nest API failures, eg. when it's rate limited. Commands aren't retried.
+const retries = 2
+
+// retryDelay is the delay before the first retry, it's shortened by tests.
+var retryDelay = httpx.DefaultRetryDelay
+
 var (
 	errNon200Response      = errors.New("nest API responded with non-200 code")
-	errFailedParsingURL    = errors.New("failed parsing OpenWeatherMap API URL")
+	errFailedParsingURL    = errors.New("failed parsing Nest API URL")
 	errFailedUnmarshalling = errors.New("failed unmarshalling Nest API response body")
 	errFailedRequest       = errors.New("failed Nest API request")
 	errFailedReadingBody   = errors.New("failed reading Nest API response body")
+	errFailedTokenRefresh  = errors.New("failed refreshing OAuth2 access token")
+	errFailedCredentials   = errors.New("failed finding Google Application Default Credentials")
+	errInvalidLabelPolicy  = errors.New("invalid label policy; valid values: [dashes, keep, lowercase, slugify]")
+	errInvalidIDPolicy     = errors.New("invalid id policy; valid values: [full, short, hash, none]")
+	errInvalidModeMetrics  = errors.New("invalid mode metrics; valid values: [stateset, booleans, both]")
 )
 
 // Thermostat stores thermostat data received from Nest API.
+// Temperatures are always in Celsius, regardless of the exported unit.
 type Thermostat struct {
-	ID           string
-	Label        string
-	AmbientTemp  float64
-	SetpointTemp float64
-	Humidity     float64
-	Status       string
+	ID           string  `json:"id"`
+	DeviceID     string  `json:"device_id"`
+	Label        string  `json:"label"`
+	Room         string  `json:"room"`
+	AmbientTemp  float64 `json:"ambient_temperature_celsius"`
+	SetpointTemp float64 `json:"setpoint_temperature_celsius"`
+	Humidity     float64 `json:"humidity_percent"`
+	Status       string  `json:"hvac_status"`
+	Mode         string  `json:"mode"`
+
+	// Structure is the ID of the structure the thermostat is in, eg. STRUCTURE_ID. It's empty if the thermostat isn't
+	// assigned to a room.
+	Structure string `json:"structure,omitempty"`
+
+	// AvailableModes are the modes the thermostat can be set to, eg. HEAT, COOL, HEATCOOL and OFF. They're empty if
+	// the trait isn't reported.
+	AvailableModes []string `json:"available_modes,omitempty"`
+
+	// TemperatureScale is the scale shown on the thermostat: CELSIUS or FAHRENHEIT.
+	TemperatureScale string `json:"temperature_scale"`
+
+	// AvailableEcoModes are the eco modes the thermostat can be set to, eg. MANUAL_ECO and OFF. EcoHeatTemp and
+	// EcoCoolTemp are the eco setpoints in Celsius. They're empty if the ThermostatEco trait isn't reported.
+	AvailableEcoModes []string `json:"available_eco_modes,omitempty"`
+	EcoHeatTemp       float64  `json:"eco_heat_temperature_celsius,omitempty"`
+	EcoCoolTemp       float64  `json:"eco_cool_temperature_celsius,omitempty"`
+
+	// Connectivity is the status of the Connectivity trait: ONLINE or OFFLINE. It's empty if the trait isn't reported.
+	Connectivity string `json:"connectivity"`
+
+	// FanTimerMode is the mode of the fan timer of the Fan trait: ON or OFF. It's empty if the trait isn't reported.
+	// FanTimerTimeout is the time the fan timer stops the fan, it's nil unless the timer is on.
+	FanTimerMode    string     `json:"fan_timer_mode,omitempty"`
+	FanTimerTimeout *time.Time `json:"fan_timer_timeout,omitempty"`
+
+	// UpdatedAt is the time of the reading: either when it was fetched from the API or the timestamp of the event.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CanHeat returns true if the HVAC system can heat. Thermostats which don't report their available modes are
+// assumed to heat, as the exported setpoint is the heating one.
+func (t *Thermostat) CanHeat() bool {
+	return len(t.AvailableModes) == 0 || t.hasMode("HEAT") || t.hasMode("HEATCOOL")
+}
+
+// CanCool returns true if the HVAC system can cool.
+func (t *Thermostat) CanCool() bool {
+	return t.hasMode("COOL") || t.hasMode("HEATCOOL")
+}
+
+// WithID returns a copy of the reading with the ID replaced, eg. by the value of the id label, so outputs other than
+// metrics identify thermostats like the metrics do.
+func (t *Thermostat) WithID(id string) *Thermostat {
+	copied := *t
+	copied.ID = id
+	return &copied
+}
+
+func (t *Thermostat) hasMode(mode string) bool {
+	for _, m := range t.AvailableModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Device stores the description of a device received from Nest API.
+type Device struct {
+	ID     string   `json:"id"`
+	Type   string   `json:"type"`
+	Room   string   `json:"room"`
+	Traits []string `json:"traits"`
+}
+
+// IsThermostat returns true if the device is a thermostat, the only type of devices exported by the Collector.
+func (d *Device) IsThermostat() bool {
+	return d.Type == thermostatType
 }
 
 // Config provides the configuration necessary to create the Collector.
+// Logger is optional, if it's nil the Collector doesn't log anything.
+//
+// Deprecated: Config is kept for backward compatibility only, use New with Options instead.
 type Config struct {
 	Logger            log.Logger
 	Timeout           int
+	Unit              string
 	APIURL            string
 	OAuthClientID     string
 	OAuthClientSecret string
@@ -52,146 +158,874 @@ type Config struct {
 
 // Collector implements the Collector interface, collecting thermostats data from Nest API.
 type Collector struct {
-	client  *http.Client
-	url     string
-	logger  log.Logger
-	metrics *Metrics
+	ctx         context.Context
+	client      *httpx.Client
+	tokenSource oauth2.TokenSource
+	throttle    *httpx.Throttle
+	fallback    *deviceFallback
+	project     string
+	url         string
+	logger      log.Logger
+	units       []string
+	metrics     *Metrics
+	modeMetrics *modeMetrics
+
+	// readOnly rejects commands, see WithReadOnly.
+	readOnly bool
+
+	cacheTTL time.Duration
+	cacheMu  sync.Mutex
+	cached   []*Thermostat
+	cachedAt time.Time
+
+	group     singleflight.Group
+	coalesced uint64
+
+	tracker *tracker
+
+	normalizeLabel func(string) string
+	idPolicy       string
+	aliases        map[string]string
+
+	// order discards events delivered out of order or more than once, guarded by cacheMu.
+	order *eventOrder
+
+	// modes contains the thermostat mode and the eco mode of every thermostat, guarded by cacheMu.
+	// They're reported by separate traits, so events may update only one of them.
+	modes      map[string]modeState
+	timestamps bool
+	listeners  []Listener
+
+	// updateListeners are notified only with new readings. notified contains the time of the latest reading of every
+	// thermostat passed to them, guarded by notifiedMu.
+	updateListeners []Listener
+	notifiedMu      sync.Mutex
+	notified        map[string]time.Time
+
+	// schedule contains the expected setpoints, it's nil unless a schedule is declared.
+	schedule *schedule
+
+	// seen contains the latest successful reading of every thermostat, so the time of the last update is still
+	// exported, and the thermostat reported down, while the API fails.
+	seenMu sync.Mutex
+	seen   map[string]*Thermostat
+
+	// events counts events handled by HandleEvent, it's nil unless event metrics are enabled.
+	events *eventStats
+
+	// apiErrors counts error responses of the API by their status.
+	errorsMu  sync.Mutex
+	apiErrors map[string]float64
+
+	// discovered counts devices by type in the latest devices list, types which disappeared from it are kept at 0.
+	// It's nil until the devices are listed successfully.
+	discoveredMu sync.Mutex
+	discovered   map[string]float64
+}
+
+// Listener is notified with the current readings of all thermostats whenever they're updated.
+// Listeners are called synchronously, so they should return quickly and must not modify the readings.
+type Listener func(thermostats []*Thermostat)
+
+// modeState contains the thermostat mode and the eco mode, which together determine the mode of a thermostat.
+type modeState struct {
+	mode string
+	eco  bool
+}
+
+// current returns the effective mode of a thermostat. Eco mode overrides the regular thermostat mode.
+func (m modeState) current() string {
+	if m.eco {
+		return "ECO"
+	}
+	return m.mode
 }
 
 // Metrics contains the metrics collected by the Collector.
 type Metrics struct {
 	up           *prometheus.Desc
-	ambientTemp  *prometheus.Desc
-	setpointTemp *prometheus.Desc
+	apiUp        *prometheus.Desc
+	deviceUp     *prometheus.Desc
+	coalesced    *prometheus.Desc
+	apiErrors    *prometheus.Desc
+	discovered   *prometheus.Desc
+	ambientTemp  map[string]*prometheus.Desc
+	setpointTemp map[string]*prometheus.Desc
 	humidity     *prometheus.Desc
 	heating      *prometheus.Desc
+	capability   *prometheus.Desc
+
+	setpointChanges *prometheus.Desc
+	modeTransitions *prometheus.Desc
+	modeDuration    *prometheus.Desc
+	shortCycles     *prometheus.Desc
+	lastCycle       *prometheus.Desc
+
+	fanTimer        *prometheus.Desc
+	fanTimerTimeout *prometheus.Desc
+	fanOnlyRuntime  *prometheus.Desc
+
+	scheduleDeviation *prometheus.Desc
+	info              *prometheus.Desc
+	settingsInfo      *prometheus.Desc
+	ecoSetpoint       map[string]*prometheus.Desc
+	lastUpdate        *prometheus.Desc
+
+	tokenRefreshes *prometheus.Desc
+	tokenExpiry    *prometheus.Desc
+
+	requestsQueued    *prometheus.Desc
+	requestsThrottled *prometheus.Desc
+	throttleWait      *prometheus.Desc
+	deviceFetches     *prometheus.Desc
+
+	eventsReceived  *prometheus.Desc
+	eventsDiscarded *prometheus.Desc
+
+	home *homeMetrics
+}
+
+// NewFromConfig creates a Collector using the given Config.
+//
+// Deprecated: NewFromConfig is kept for backward compatibility only, use New with Options instead.
+func NewFromConfig(cfg Config) (*Collector, error) {
+	return New(cfg.ProjectID, configOptions(cfg)...)
+}
+
+// NewWithContext creates a Collector using the given Config. Cancelling the context aborts all in-flight API requests.
+//
+// Deprecated: NewWithContext is kept for backward compatibility only, use New with WithContext and other Options
+// instead.
+func NewWithContext(ctx context.Context, cfg Config) (*Collector, error) {
+	return New(cfg.ProjectID, append(configOptions(cfg), WithContext(ctx))...)
+}
+
+// configOptions returns the Options equivalent to the Config.
+func configOptions(cfg Config) []Option {
+	opts := []Option{
+		WithLogger(cfg.Logger),
+		WithTimeout(time.Duration(cfg.Timeout) * time.Millisecond),
+		WithUnit(cfg.Unit),
+		WithAPIURL(cfg.APIURL),
+		WithOAuthClient(cfg.OAuthClientID, cfg.OAuthClientSecret),
+		WithRefreshToken(cfg.RefreshToken),
+	}
+
+	if cfg.OAuthToken != nil {
+		opts = append(opts, WithToken(cfg.OAuthToken))
+	}
+
+	return opts
 }
 
-// New creates a Collector using the given Config.
-func New(cfg Config) (*Collector, error) {
-	if _, err := url.ParseRequestURI(cfg.APIURL); err != nil {
+// New creates a Collector for thermostats in the given Device Access project.
+func New(projectID string, opts ...Option) (*Collector, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if _, err := url.ParseRequestURI(o.apiURL); err != nil {
 		return nil, errors.Wrap(errFailedParsingURL, err.Error())
 	}
 
-	oauthConfig := &oauth2.Config{
-		ClientID:     cfg.OAuthClientID,
-		ClientSecret: cfg.OAuthClientSecret,
-		Scopes:       []string{"https://www.googleapis.com/auth/sdm.service"},
-		Endpoint:     endpoints.Google,
+	exported, err := units.Parse(o.unit)
+	if err != nil {
+		return nil, err
 	}
 
-	// If token is not provided we create a new one using RefreshToken. Using this token, the client will automatically
-	// get, and refresh, a valid access token for the API.
-	if cfg.OAuthToken == nil {
-		cfg.OAuthToken = &oauth2.Token{
-			TokenType:    "Bearer",
-			RefreshToken: cfg.RefreshToken,
+	normalizeLabel, err := labelNormalizer(o.labelPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.idPolicy {
+	case "":
+		o.idPolicy = IDFull
+	case IDFull, IDShort, IDHash, IDNone:
+	default:
+		return nil, errors.Wrap(errInvalidIDPolicy, o.idPolicy)
+	}
+
+	labels := MetricLabels{IDPolicy: o.idPolicy}.Names()
+	modeMetrics, err := buildModeMetrics(o.modeMetrics, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var sched *schedule
+	if len(o.schedule) > 0 {
+		if sched, err = parseSchedule(o.schedule, o.scheduleTimezone); err != nil {
+			return nil, err
 		}
 	}
 
-	client := oauthConfig.Client(context.Background(), cfg.OAuthToken)
-	client.Timeout = time.Duration(cfg.Timeout) * time.Millisecond
+	tokenSource, err := o.buildTokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := o.transport
+	if o.userAgent != "" {
+		transport = &useragent.Transport{Base: transport, UserAgent: o.userAgent}
+	}
+	throttle := httpx.NewThrottle(transport, o.maxConcurrent, o.rateLimit, o.rateBurst)
+
+	client := httpx.New(httpx.Config{
+		Transport:    &oauth2.Transport{Source: tokenSource, Base: throttle},
+		Timeout:      o.timeout,
+		Retries:      retries,
+		RetryDelay:   retryDelay,
+		Errors:       httpx.Errors{Request: errFailedRequest, ReadingBody: errFailedReadingBody, Non200: errNon200Response},
+		Requests:     "nest_api_requests_total",
+		RequestsHelp: "Nest API requests by status code, or error if they weren't answered.",
+	})
 
 	collector := &Collector{
-		client:  client,
-		url:     strings.TrimRight(cfg.APIURL, "/") + "/enterprises/" + cfg.ProjectID + "/devices/",
-		logger:  cfg.Logger,
-		metrics: buildMetrics(),
+		ctx:         o.ctx,
+		client:      client,
+		tokenSource: tokenSource,
+		throttle:    throttle,
+		project:     projectID,
+		url:         strings.TrimRight(o.apiURL, "/") + "/enterprises/" + projectID + "/devices/",
+		logger:      o.logger,
+		units:       exported,
+		metrics:     buildMetrics(exported, labels),
+		modeMetrics: modeMetrics,
+		cacheTTL:    o.cacheTTL,
+		tracker:     newTracker(o.shortCycle),
+		readOnly:    o.readOnly,
+
+		normalizeLabel:  normalizeLabel,
+		idPolicy:        o.idPolicy,
+		aliases:         o.aliases,
+		modes:           make(map[string]modeState),
+		order:           newEventOrder(),
+		timestamps:      o.timestamps,
+		listeners:       o.listeners,
+		updateListeners: o.updateListeners,
+		notified:        make(map[string]time.Time),
+		schedule:        sched,
+		seen:            make(map[string]*Thermostat),
+		apiErrors:       make(map[string]float64),
+	}
+
+	if o.fallback {
+		collector.fallback = newDeviceFallback(o.fallbackTTL)
+	}
+
+	if o.eventMetrics {
+		collector.events = newEventStats()
 	}
 
 	return collector, nil
 }
 
-func buildMetrics() *Metrics {
-	var nestLabels = []string{"id", "label"}
-	return &Metrics{
+func buildMetrics(units []string, nestLabels []string) *Metrics {
+	metrics := &Metrics{
 		up:           prometheus.NewDesc(strings.Join([]string{"nest", "up"}, "_"), "Was talking to Nest API successful.", nil, nil),
-		ambientTemp:  prometheus.NewDesc(strings.Join([]string{"nest", "ambient", "temperature", "celsius"}, "_"), "Inside temperature.", nestLabels, nil),
-		setpointTemp: prometheus.NewDesc(strings.Join([]string{"nest", "setpoint", "temperature", "celsius"}, "_"), "Setpoint temperature.", nestLabels, nil),
+		apiUp:        prometheus.NewDesc(strings.Join([]string{"nest", "api", "up"}, "_"), "Was talking to Nest API successful for the Device Access project.", []string{"project"}, nil),
+		deviceUp:     prometheus.NewDesc(strings.Join([]string{"nest", "device", "up"}, "_"), "Was the thermostat online in the latest readings.", nestLabels, nil),
+		coalesced:    prometheus.NewDesc(strings.Join([]string{"nest", "api", "requests", "coalesced", "total"}, "_"), "Number of scrapes which shared a Nest API request with a concurrent scrape.", nil, nil),
+		apiErrors:    prometheus.NewDesc(strings.Join([]string{"nest", "api", "errors", "total"}, "_"), "Number of error responses of Nest API by the status of the error.", []string{"status"}, nil),
+		discovered:   prometheus.NewDesc(strings.Join([]string{"nest", "devices", "discovered"}, "_"), "Number of devices in the latest devices list of the Device Access project by type.", []string{"type"}, nil),
+		ambientTemp:  make(map[string]*prometheus.Desc),
+		setpointTemp: make(map[string]*prometheus.Desc),
 		humidity:     prometheus.NewDesc(strings.Join([]string{"nest", "humidity", "percent"}, "_"), "Inside humidity.", nestLabels, nil),
 		heating:      prometheus.NewDesc(strings.Join([]string{"nest", "heating"}, "_"), "Is thermostat heating.", nestLabels, nil),
+		capability:   prometheus.NewDesc(strings.Join([]string{"nest", "thermostat", "capability"}, "_"), "Can the HVAC system of the thermostat heat or cool, according to its available modes.", append(nestLabels, "capability"), nil),
+
+		setpointChanges: prometheus.NewDesc(strings.Join([]string{"nest", "setpoint", "changes", "total"}, "_"), "Number of setpoint temperature changes.", append(nestLabels, "direction"), nil),
+		modeTransitions: prometheus.NewDesc(strings.Join([]string{"nest", "mode", "transitions", "total"}, "_"), "Number of thermostat mode transitions.", append(nestLabels, "from", "to"), nil),
+		modeDuration:    prometheus.NewDesc(strings.Join([]string{"nest", "mode", "duration", "seconds", "total"}, "_"), "Total time spent by the thermostat in each mode.", append(nestLabels, "mode"), nil),
+		shortCycles:     prometheus.NewDesc(strings.Join([]string{"nest", "hvac", "short", "cycles", "total"}, "_"), "Number of heating or cooling cycles shorter than the short cycle threshold.", nestLabels, nil),
+		lastCycle:       prometheus.NewDesc(strings.Join([]string{"nest", "hvac", "last", "cycle", "duration", "seconds"}, "_"), "Duration of the last completed heating or cooling cycle.", nestLabels, nil),
+
+		fanTimer:        prometheus.NewDesc(strings.Join([]string{"nest", "fan", "timer", "on"}, "_"), "Is the fan timer of the thermostat running the fan.", nestLabels, nil),
+		fanTimerTimeout: prometheus.NewDesc(strings.Join([]string{"nest", "fan", "timer", "timeout", "timestamp", "seconds"}, "_"), "Time the running fan timer stops the fan.", nestLabels, nil),
+		fanOnlyRuntime:  prometheus.NewDesc(strings.Join([]string{"nest", "fan", "only", "runtime", "seconds", "total"}, "_"), "Total time the fan timer ran the fan while the thermostat wasn't heating or cooling.", nestLabels, nil),
+
+		info:              prometheus.NewDesc(strings.Join([]string{"nest", "thermostat", "info"}, "_"), "Information about the thermostat, always 1.", append(nestLabels, "temperature_scale"), nil),
+		settingsInfo:      prometheus.NewDesc(strings.Join([]string{"nest", "thermostat", "settings", "info"}, "_"), "Settings of the thermostat reported by its traits, always 1. Settings which aren't reported are empty.", append(nestLabels, "available_modes", "available_eco_modes"), nil),
+		ecoSetpoint:       make(map[string]*prometheus.Desc),
+		scheduleDeviation: prometheus.NewDesc(strings.Join([]string{"nest", "schedule", "deviation", "degrees"}, "_"), "Difference between the setpoint temperature and the setpoint expected by the schedule.", nestLabels, nil),
+		lastUpdate:        prometheus.NewDesc(strings.Join([]string{"nest", "last", "update", "timestamp", "seconds"}, "_"), "Time of the latest reading of the thermostat, fetched from the API or received in an event.", nestLabels, nil),
+
+		tokenRefreshes: prometheus.NewDesc(strings.Join([]string{"nest", "oauth", "token", "refreshes", "total"}, "_"), "Number of OAuth2 access token refreshes by result.", []string{"result"}, nil),
+		tokenExpiry:    prometheus.NewDesc(strings.Join([]string{"nest", "oauth", "token", "expiry", "timestamp", "seconds"}, "_"), "Time the current OAuth2 access token expires.", nil, nil),
+
+		requestsQueued:    prometheus.NewDesc(strings.Join([]string{"nest", "api", "requests", "queued"}, "_"), "Number of Nest API requests waiting for the rate or concurrency limit.", nil, nil),
+		requestsThrottled: prometheus.NewDesc(strings.Join([]string{"nest", "api", "requests", "throttled", "total"}, "_"), "Number of Nest API requests failed because they couldn't be sent within their deadline.", nil, nil),
+		throttleWait:      prometheus.NewDesc(strings.Join([]string{"nest", "api", "throttle", "wait", "seconds", "total"}, "_"), "Total time Nest API requests waited for the rate or concurrency limit.", nil, nil),
+		deviceFetches:     prometheus.NewDesc(strings.Join([]string{"nest", "api", "device", "fetches", "total"}, "_"), "Number of thermostats fetched individually because the devices list lacked required traits, by result.", []string{"result"}, nil),
+
+		eventsReceived:  prometheus.NewDesc(strings.Join([]string{"nest", "events", "received", "total"}, "_"), "Number of Device Access events received by type.", []string{"type"}, nil),
+		eventsDiscarded: prometheus.NewDesc(strings.Join([]string{"nest", "events", "discarded", "total"}, "_"), "Number of events with readings which were discarded, by reason.", []string{"reason"}, nil),
+
+		home: buildHomeMetrics(units),
 	}
+
+	for _, unit := range units {
+		metrics.ambientTemp[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "ambient", "temperature", unit}, "_"), "Inside temperature.", nestLabels, nil)
+		metrics.setpointTemp[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "setpoint", "temperature", unit}, "_"), "Setpoint temperature.", nestLabels, nil)
+		metrics.ecoSetpoint[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "eco", "setpoint", "temperature", unit}, "_"), "Setpoint temperature of the eco mode by the setpoint: heat or cool.", append(nestLabels, "setpoint"), nil)
+	}
+
+	return metrics
 }
 
 // Describe implements the prometheus.Describe interface.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.metrics.up
-	ch <- c.metrics.ambientTemp
-	ch <- c.metrics.setpointTemp
+	ch <- c.metrics.apiUp
+	ch <- c.metrics.deviceUp
+	ch <- c.metrics.coalesced
+	ch <- c.metrics.apiErrors
+	ch <- c.metrics.discovered
+	ch <- c.metrics.tokenRefreshes
+	ch <- c.metrics.tokenExpiry
+	ch <- c.metrics.requestsQueued
+	ch <- c.metrics.requestsThrottled
+	ch <- c.metrics.throttleWait
+	c.client.Describe(ch)
+	if c.fallback != nil {
+		ch <- c.metrics.deviceFetches
+	}
+	if c.events != nil {
+		ch <- c.metrics.eventsReceived
+		ch <- c.metrics.eventsDiscarded
+	}
+	for _, unit := range c.units {
+		ch <- c.metrics.ambientTemp[unit]
+		ch <- c.metrics.setpointTemp[unit]
+		ch <- c.metrics.ecoSetpoint[unit]
+	}
 	ch <- c.metrics.humidity
 	ch <- c.metrics.heating
+	ch <- c.metrics.capability
+	c.modeMetrics.describe(ch)
+	ch <- c.metrics.setpointChanges
+	ch <- c.metrics.modeTransitions
+	ch <- c.metrics.modeDuration
+	ch <- c.metrics.shortCycles
+	ch <- c.metrics.lastCycle
+	ch <- c.metrics.fanTimer
+	ch <- c.metrics.fanTimerTimeout
+	ch <- c.metrics.fanOnlyRuntime
+	ch <- c.metrics.info
+	ch <- c.metrics.settingsInfo
+	ch <- c.metrics.lastUpdate
+	if c.schedule != nil {
+		ch <- c.metrics.scheduleDeviation
+	}
+	c.metrics.home.describe(ch, c.units)
 }
 
 // Collect implements the prometheus.Collector interface.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	thermostats, err := c.getNestReadings()
+	thermostats, err := c.Thermostats(c.ctx)
+
+	ch <- prometheus.MustNewConstMetric(c.metrics.coalesced, prometheus.CounterValue, float64(atomic.LoadUint64(&c.coalesced)))
+	c.collectAPIErrors(ch)
+	c.client.Collect(ch)
+	c.collectDiscovered(ch)
+	c.collectToken(ch)
+	c.collectThrottle(ch)
+	c.collectEvents(ch)
+
 	if err != nil {
 		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 0)
-		c.logger.Log("level", "error", "message", "Failed collecting Nest data", "stack", errors.WithStack(err))
+		ch <- prometheus.MustNewConstMetric(c.metrics.apiUp, prometheus.GaugeValue, 0, c.project)
+
+		keyvals := []interface{}{"level", "error", "message", "Failed collecting Nest data", "stack", errors.WithStack(err)}
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			keyvals = append(keyvals, "status", apiErr.Status, "reason", apiErr.Message, "hint", apiErr.Hint())
+		}
+		c.logger.Log(keyvals...)
+		c.collectDevices(ch, nil)
 		return
 	}
 
 	c.logger.Log("level", "debug", "message", "Successfully collected Nest data")
 
 	ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.metrics.apiUp, prometheus.GaugeValue, 1, c.project)
+
+	for _, therm := range thermostats {
+		labels := c.deviceLabels(therm)
+
+		// The setpoint and heating status of systems which can't heat would be permanent zeros.
+		canHeat := therm.CanHeat()
+		for _, unit := range c.units {
+			ch <- c.reading(therm, c.metrics.ambientTemp[unit], units.FromCelsius(therm.AmbientTemp, unit), labels)
+			if canHeat {
+				ch <- c.reading(therm, c.metrics.setpointTemp[unit], units.FromCelsius(therm.SetpointTemp, unit), labels)
+			}
+		}
+		ch <- c.reading(therm, c.metrics.humidity, therm.Humidity, labels)
+		if canHeat {
+			ch <- c.reading(therm, c.metrics.heating, metricsutil.Bool(therm.Status == "HEATING"), labels)
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics.info, prometheus.GaugeValue, 1, append(labels, therm.TemperatureScale)...)
+		if len(therm.AvailableModes) > 0 {
+			ch <- prometheus.MustNewConstMetric(c.metrics.capability, prometheus.GaugeValue, metricsutil.Bool(canHeat), append(labels, "heat")...)
+			ch <- prometheus.MustNewConstMetric(c.metrics.capability, prometheus.GaugeValue, metricsutil.Bool(therm.CanCool()), append(labels, "cool")...)
+		}
+		c.collectMode(ch, therm, labels)
+		c.collectSettings(ch, therm, labels)
+
+		for _, direction := range []string{directionUp, directionDown} {
+			ch <- prometheus.MustNewConstMetric(c.metrics.setpointChanges, prometheus.CounterValue, c.tracker.setpointChanges(therm.ID, direction), append(labels, direction)...)
+		}
+
+		transitions, counts := c.tracker.modeTransitions(therm.ID)
+		for i, tr := range transitions {
+			ch <- prometheus.MustNewConstMetric(c.metrics.modeTransitions, prometheus.CounterValue, counts[i], append(labels, tr.from, tr.to)...)
+		}
+
+		for mode, seconds := range c.tracker.modeDurations(therm.ID) {
+			ch <- prometheus.MustNewConstMetric(c.metrics.modeDuration, prometheus.CounterValue, seconds, append(labels, mode)...)
+		}
+
+		shortCycles, lastCycle, completed := c.tracker.cycles(therm.ID)
+		ch <- prometheus.MustNewConstMetric(c.metrics.shortCycles, prometheus.CounterValue, shortCycles, labels...)
+		if completed {
+			ch <- prometheus.MustNewConstMetric(c.metrics.lastCycle, prometheus.GaugeValue, lastCycle.Seconds(), labels...)
+		}
+
+		// Thermostats without a fan don't report the Fan trait.
+		if therm.FanTimerMode != "" {
+			ch <- c.reading(therm, c.metrics.fanTimer, metricsutil.Bool(therm.FanTimerMode == "ON"), labels)
+			if therm.FanTimerMode == "ON" && therm.FanTimerTimeout != nil {
+				ch <- prometheus.MustNewConstMetric(c.metrics.fanTimerTimeout, prometheus.GaugeValue, float64(therm.FanTimerTimeout.Unix()), labels...)
+			}
+			ch <- prometheus.MustNewConstMetric(c.metrics.fanOnlyRuntime, prometheus.CounterValue, c.tracker.fanOnlyRuntime(therm.ID), labels...)
+		}
+
+		// The setpoint is only meaningful while heating is on, in other modes the schedule isn't followed.
+		if c.schedule != nil && therm.Mode == "HEAT" {
+			if expected, ok := c.schedule.expected(therm.DeviceID, time.Now()); ok {
+				ch <- c.reading(therm, c.metrics.scheduleDeviation, units.FromCelsius(therm.SetpointTemp, c.units[0])-expected, labels)
+			}
+		}
+	}
+
+	c.collectHome(ch, thermostats)
+	c.collectDevices(ch, thermostats)
+}
+
+// collectAPIErrors exports the number of error responses of the API by status.
+func (c *Collector) collectAPIErrors(ch chan<- prometheus.Metric) {
+	c.errorsMu.Lock()
+	defer c.errorsMu.Unlock()
+
+	for status, count := range c.apiErrors {
+		ch <- prometheus.MustNewConstMetric(c.metrics.apiErrors, prometheus.CounterValue, count, status)
+	}
+}
 
+// collectDiscovered exports the number of devices by type in the latest devices list.
+func (c *Collector) collectDiscovered(ch chan<- prometheus.Metric) {
+	c.discoveredMu.Lock()
+	defer c.discoveredMu.Unlock()
+
+	for deviceType, count := range c.discovered {
+		ch <- prometheus.MustNewConstMetric(c.metrics.discovered, prometheus.GaugeValue, count, deviceType)
+	}
+}
+
+// discover counts the devices of the devices list by type.
+func (c *Collector) discover(devices gjson.Result) {
+	c.discoveredMu.Lock()
+	defer c.discoveredMu.Unlock()
+
+	if c.discovered == nil {
+		c.discovered = make(map[string]float64)
+	}
+	for deviceType := range c.discovered {
+		c.discovered[deviceType] = 0
+	}
+	devices.ForEach(func(_, device gjson.Result) bool {
+		c.discovered[strings.TrimPrefix(device.Get("type").String(), deviceTypePrefix)]++
+		return true
+	})
+}
+
+// collectToken exports the refreshes and the expiry of the access token, unless it comes from Application Default
+// Credentials or a token source set with WithTokenSource.
+func (c *Collector) collectToken(ch chan<- prometheus.Metric) {
+	source, ok := c.tokenSource.(*cachingTokenSource)
+	if !ok {
+		return
+	}
+
+	refreshes, expiry := source.state()
+	for result, count := range refreshes {
+		ch <- prometheus.MustNewConstMetric(c.metrics.tokenRefreshes, prometheus.CounterValue, count, result)
+	}
+	if !expiry.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.metrics.tokenExpiry, prometheus.GaugeValue, float64(expiry.Unix()))
+	}
+}
+
+// collectThrottle exports the requests queued and failed by the rate and concurrency limits.
+func (c *Collector) collectThrottle(ch chan<- prometheus.Metric) {
+	queued, throttled, waited := c.throttle.State()
+	ch <- prometheus.MustNewConstMetric(c.metrics.requestsQueued, prometheus.GaugeValue, queued)
+	ch <- prometheus.MustNewConstMetric(c.metrics.requestsThrottled, prometheus.CounterValue, throttled)
+	ch <- prometheus.MustNewConstMetric(c.metrics.throttleWait, prometheus.CounterValue, waited.Seconds())
+
+	if c.fallback != nil {
+		for result, count := range c.fallback.state() {
+			ch <- prometheus.MustNewConstMetric(c.metrics.deviceFetches, prometheus.CounterValue, count, result)
+		}
+	}
+}
+
+// collectDevices exports the time of the latest reading of every thermostat seen since the start and whether it's
+// up. Thermostats are down if they report being offline or are missing from the current readings, eg. because the
+// API failed or the thermostat was removed from the project.
+func (c *Collector) collectDevices(ch chan<- prometheus.Metric, thermostats []*Thermostat) {
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+
+	online := make(map[string]bool)
 	for _, therm := range thermostats {
-		labels := []string{therm.ID, strings.Replace(therm.Label, " ", "-", -1)}
+		if !therm.UpdatedAt.IsZero() {
+			c.seen[therm.ID] = therm
+		}
+		online[therm.ID] = therm.Connectivity != "OFFLINE"
+	}
+
+	for _, therm := range c.seen {
+		labels := c.deviceLabels(therm)
+		ch <- prometheus.MustNewConstMetric(c.metrics.lastUpdate, prometheus.GaugeValue, float64(therm.UpdatedAt.UnixNano())/1e9, labels...)
+		ch <- prometheus.MustNewConstMetric(c.metrics.deviceUp, prometheus.GaugeValue, metricsutil.Bool(online[therm.ID]), labels...)
+	}
+}
 
-		ch <- prometheus.MustNewConstMetric(c.metrics.ambientTemp, prometheus.GaugeValue, therm.AmbientTemp, labels...)
-		ch <- prometheus.MustNewConstMetric(c.metrics.setpointTemp, prometheus.GaugeValue, therm.SetpointTemp, labels...)
-		ch <- prometheus.MustNewConstMetric(c.metrics.humidity, prometheus.GaugeValue, therm.Humidity, labels...)
-		ch <- prometheus.MustNewConstMetric(c.metrics.heating, prometheus.GaugeValue, b2f(therm.Status == "HEATING"), labels...)
+// deviceLabels returns the id, device_id and label values of the thermostat, without the id under IDNone, with spare
+// capacity for the labels appended by metrics such as the mode or direction, so appending them doesn't allocate a slice
+// for every metric. Metrics copy the label values, so the spare capacity is reused by the next append.
+func (c *Collector) deviceLabels(therm *Thermostat) []string {
+	labels := make([]string, 0, 3+maxExtraLabels)
+	if c.idPolicy != IDNone {
+		labels = append(labels, c.MetricID(therm))
 	}
+	return append(labels, therm.DeviceID, c.MetricLabel(therm))
 }
 
-func (c *Collector) getNestReadings() (thermostats []*Thermostat, err error) {
-	res, err := c.client.Get(c.url)
+// reading returns a gauge with the thermostat reading. If timestamps are enabled, the metric carries the time
+// of the reading instead of the time of the scrape.
+func (c *Collector) reading(therm *Thermostat, desc *prometheus.Desc, value float64, labels []string) prometheus.Metric {
+	metric := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	if c.timestamps && !therm.UpdatedAt.IsZero() {
+		return prometheus.NewMetricWithTimestamp(therm.UpdatedAt, metric)
+	}
+	return metric
+}
+
+// MetricLabel returns the value of the label label of metrics of the thermostat, with aliases and the label policy
+// applied.
+func (c *Collector) MetricLabel(therm *Thermostat) string {
+	return c.normalizeLabel(c.alias(therm))
+}
+
+// MetricID returns the value of the id label of metrics of the thermostat, with the id policy applied.
+func (c *Collector) MetricID(therm *Thermostat) string {
+	return IDLabel(c.idPolicy, therm.ID)
+}
+
+// alias returns the alias configured for the thermostat, either by its short device ID or by its full name.
+// If there's no alias, the custom name of the thermostat is returned.
+func (c *Collector) alias(therm *Thermostat) string {
+	if alias, ok := c.aliases[therm.DeviceID]; ok {
+		return alias
+	}
+	if alias, ok := c.aliases[therm.ID]; ok {
+		return alias
+	}
+	return therm.Label
+}
+
+// Thermostats returns the current readings of all thermostats available in the Device Access project.
+// If the Collector was created with WithCache, readings younger than the cache TTL are returned without calling the API.
+// Concurrent calls share a single API request.
+func (c *Collector) Thermostats(ctx context.Context) ([]*Thermostat, error) {
+	if thermostats := c.cachedReadings(); thermostats != nil {
+		return thermostats, nil
+	}
+
+	// Only the first of concurrent callers executes the function, the rest wait for its result.
+	called := false
+	v, err, _ := c.group.Do("thermostats", func() (interface{}, error) {
+		called = true
+
+		thermostats, err := c.getNestReadings(ctx)
+		if err == nil {
+			now := time.Now()
+			for _, therm := range thermostats {
+				therm.UpdatedAt = now
+			}
+			c.cacheReadings(thermostats)
+			c.tracker.update(thermostats, now)
+			c.notify(thermostats)
+		}
+		return thermostats, err
+	})
+
+	if !called {
+		atomic.AddUint64(&c.coalesced, 1)
+	}
+
 	if err != nil {
-		return nil, errors.Wrap(errFailedRequest, err.Error())
+		return nil, err
 	}
 
-	if res.StatusCode != 200 {
-		return nil, errors.Wrap(errNon200Response, fmt.Sprintf("code: %d", res.StatusCode))
+	return v.([]*Thermostat), nil
+}
+
+// notify passes the readings to all listeners, and the new ones among them to update listeners.
+func (c *Collector) notify(thermostats []*Thermostat) {
+	for _, listener := range c.listeners {
+		listener(thermostats)
+	}
+
+	if len(c.updateListeners) == 0 {
+		return
+	}
+	updated := c.updated(thermostats)
+	if len(updated) == 0 {
+		return
+	}
+	for _, listener := range c.updateListeners {
+		listener(updated)
+	}
+}
+
+// updated returns the readings newer than the ones last passed to update listeners. Cached readings are passed to
+// notify again, eg. with readings of all thermostats after an event updated one of them, they aren't new readings.
+func (c *Collector) updated(thermostats []*Thermostat) []*Thermostat {
+	c.notifiedMu.Lock()
+	defer c.notifiedMu.Unlock()
+
+	var updated []*Thermostat
+	for _, therm := range thermostats {
+		if at, ok := c.notified[therm.ID]; ok && !therm.UpdatedAt.After(at) {
+			continue
+		}
+		c.notified[therm.ID] = therm.UpdatedAt
+		updated = append(updated, therm)
+	}
+	return updated
+}
+
+// cachedReadings returns the cached readings or nil if caching is disabled or readings are older than the cache TTL.
+func (c *Collector) cachedReadings() []*Thermostat {
+	if c.cacheTTL <= 0 {
+		return nil
 	}
 
-	defer res.Body.Close()
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if time.Since(c.cachedAt) < c.cacheTTL {
+		return c.cached
+	}
+
+	return nil
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+func (c *Collector) cacheReadings(thermostats []*Thermostat) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.cached = thermostats
+	c.cachedAt = time.Now()
+	for _, therm := range thermostats {
+		c.order.fetched(therm.ID, therm.UpdatedAt)
+	}
+}
+
+func (c *Collector) getNestReadings(ctx context.Context) (thermostats []*Thermostat, err error) {
+	devices, err := c.listDevices(ctx)
 	if err != nil {
-		return nil, errors.Wrap(errFailedReadingBody, err.Error())
+		return nil, err
+	}
+
+	var fetched map[string]gjson.Result
+	if c.fallback != nil {
+		fetched = c.fetchMissingTraits(ctx, devices)
 	}
 
 	// Iterate over the array of "devices" returned from the API and unmarshall them into Thermostat objects.
-	gjson.Get(string(body), "devices").ForEach(func(_, device gjson.Result) bool {
+	devices.ForEach(func(_, device gjson.Result) bool {
 		// Skip to next device if the current one is not a thermostat.
-		if device.Get("type").String() != "sdm.devices.types.THERMOSTAT" {
+		if device.Get("type").String() != thermostatType {
 			return true
 		}
 
 		thermostat := Thermostat{
-			ID:           device.Get("name").String(),
-			Label:        device.Get("traits.sdm\\.devices\\.traits\\.Info.customName").String(),
-			AmbientTemp:  device.Get("traits.sdm\\.devices\\.traits\\.Temperature.ambientTemperatureCelsius").Float(),
-			SetpointTemp: device.Get("traits.sdm\\.devices\\.traits\\.ThermostatTemperatureSetpoint.heatCelsius").Float(),
-			Humidity:     device.Get("traits.sdm\\.devices\\.traits\\.Humidity.ambientHumidityPercent").Float(),
-			Status:       device.Get("traits.sdm\\.devices\\.traits\\.ThermostatHvac.status").String(),
+			ID:       device.Get("name").String(),
+			DeviceID: path.Base(device.Get("name").String()),
+			Room:     device.Get("parentRelations.0.displayName").String(),
+		}
+		thermostat.Structure = structureID(device.Get("parentRelations.0.parent").String())
+
+		var modes modeState
+		applyTraits(&thermostat, &modes, device.Get("traits"))
+		if traits, ok := fetched[thermostat.ID]; ok {
+			applyTraits(&thermostat, &modes, traits)
 		}
+		thermostat.Mode = modes.current()
+
+		c.cacheMu.Lock()
+		c.modes[thermostat.ID] = modes
+		c.cacheMu.Unlock()
 
 		thermostats = append(thermostats, &thermostat)
 		return true
 	})
 
 	if len(thermostats) == 0 {
-		return nil, errors.Wrap(errFailedUnmarshalling, "no valid thermostats in devices list")
+		return nil, withCause(ErrParse, errors.Wrap(errFailedUnmarshalling, "no valid thermostats in devices list"))
 	}
 
 	return thermostats, nil
 }
 
-func b2f(b bool) float64 {
-	if b {
-		return 1
+// applyTraits updates the thermostat with the values of traits. Traits missing in the result are left unchanged,
+// so it can be used both for full device descriptions and for events containing only the changed traits.
+func applyTraits(therm *Thermostat, modes *modeState, traits gjson.Result) {
+	if v := traits.Get("sdm\\.devices\\.traits\\.Info.customName"); v.Exists() {
+		therm.Label = v.String()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Temperature.ambientTemperatureCelsius"); v.Exists() {
+		therm.AmbientTemp = v.Float()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatTemperatureSetpoint.heatCelsius"); v.Exists() {
+		therm.SetpointTemp = v.Float()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Humidity.ambientHumidityPercent"); v.Exists() {
+		therm.Humidity = v.Float()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatHvac.status"); v.Exists() {
+		therm.Status = v.String()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Settings.temperatureScale"); v.Exists() {
+		therm.TemperatureScale = v.String()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Connectivity.status"); v.Exists() {
+		therm.Connectivity = v.String()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Fan.timerMode"); v.Exists() {
+		therm.FanTimerMode = v.String()
+		therm.FanTimerTimeout = nil
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.Fan.timerTimeout"); v.Exists() && therm.FanTimerMode == "ON" {
+		if timeout, err := time.Parse(time.RFC3339, v.String()); err == nil {
+			therm.FanTimerTimeout = &timeout
+		}
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatMode.mode"); v.Exists() {
+		modes.mode = v.String()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatMode.availableModes"); v.Exists() {
+		therm.AvailableModes = nil
+		for _, mode := range v.Array() {
+			therm.AvailableModes = append(therm.AvailableModes, mode.String())
+		}
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatEco.availableModes"); v.Exists() {
+		therm.AvailableEcoModes = nil
+		for _, mode := range v.Array() {
+			therm.AvailableEcoModes = append(therm.AvailableEcoModes, mode.String())
+		}
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatEco.heatCelsius"); v.Exists() {
+		therm.EcoHeatTemp = v.Float()
+	}
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatEco.coolCelsius"); v.Exists() {
+		therm.EcoCoolTemp = v.Float()
+	}
+	// Eco mode is reported by a separate trait, but it overrides the regular thermostat mode.
+	if v := traits.Get("sdm\\.devices\\.traits\\.ThermostatEco.mode"); v.Exists() {
+		modes.eco = v.String() == "MANUAL_ECO"
+	}
+}
+
+// Devices returns all devices available in the Device Access project, including the ones which aren't thermostats.
+// With WithDeviceFallback, traits of thermostats fetched individually are included.
+func (c *Collector) Devices(ctx context.Context) ([]*Device, error) {
+	devices, err := c.listDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var fetched map[string]gjson.Result
+	if c.fallback != nil {
+		fetched = c.fetchMissingTraits(ctx, devices)
+	}
+
+	var result []*Device
+	devices.ForEach(func(_, device gjson.Result) bool {
+		d := &Device{
+			ID:   device.Get("name").String(),
+			Type: device.Get("type").String(),
+			Room: device.Get("parentRelations.0.displayName").String(),
+		}
+
+		traits := map[string]bool{}
+		addTraits := func(trait, _ gjson.Result) bool {
+			if !traits[trait.String()] {
+				traits[trait.String()] = true
+				d.Traits = append(d.Traits, trait.String())
+			}
+			return true
+		}
+		device.Get("traits").ForEach(addTraits)
+		if fetched, ok := fetched[d.ID]; ok {
+			fetched.ForEach(addTraits)
+		}
+		sort.Strings(d.Traits)
+
+		result = append(result, d)
+		return true
+	})
+
+	return result, nil
+}
+
+// Token returns a valid OAuth2 access token used to authenticate API requests, refreshing it if necessary.
+func (c *Collector) Token() (*oauth2.Token, error) {
+	token, err := c.tokenSource.Token()
+	if err != nil {
+		return nil, requestError(errFailedTokenRefresh, err)
+	}
+
+	return token, nil
+}
+
+// listDevices calls the devices.list endpoint of the API and returns the array of devices from the response.
+func (c *Collector) listDevices(ctx context.Context) (gjson.Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return gjson.Result{}, errors.Wrap(errFailedRequest, err.Error())
+	}
+
+	res, body, err := c.client.Do(req)
+	if err != nil {
+		return gjson.Result{}, withCause(requestCause(err), err)
+	}
+
+	if res.StatusCode != 200 {
+		return gjson.Result{}, c.apiError(res.StatusCode, body)
+	}
+
+	devices := gjson.GetBytes(body, "devices")
+	if gjson.ValidBytes(body) {
+		c.discover(devices)
 	}
-	return 0
+	return devices, nil
 }
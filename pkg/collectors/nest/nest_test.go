@@ -1,13 +1,31 @@
 package nest
 
 import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"pronestheus/pkg/units"
 	mock "pronestheus/test"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/assert"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+func init() {
+	retryDelay = time.Millisecond
+}
+
 func TestServerResponses(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -20,12 +38,22 @@ func TestServerResponses(t *testing.T) {
 			url:     mock.NestServer().URL,
 			wantErr: nil,
 			want: &Thermostat{
-				ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
-				Label:        "Custom Name",
-				AmbientTemp:  float64(20.23999),
-				SetpointTemp: float64(19.17838),
-				Humidity:     float64(57),
-				Status:       "OFF",
+				ID:                "enterprises/PROJECT_ID/devices/DEVICE_ID",
+				DeviceID:          "DEVICE_ID",
+				Label:             "Custom Name",
+				Room:              "Living Room",
+				AmbientTemp:       float64(20.23999),
+				SetpointTemp:      float64(19.17838),
+				Humidity:          float64(57),
+				Status:            "OFF",
+				Mode:              "HEAT",
+				Structure:         "STRUCTURE_ID",
+				AvailableModes:    []string{"HEAT", "OFF"},
+				TemperatureScale:  "CELSIUS",
+				AvailableEcoModes: []string{"OFF", "MANUAL_ECO"},
+				EcoHeatTemp:       float64(17.11803),
+				EcoCoolTemp:       float64(24.44443),
+				Connectivity:      "ONLINE",
 			},
 		}, {
 			name:    "invalid auth token",
@@ -47,13 +75,13 @@ func TestServerResponses(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			c, err := New(Config{
+			c, err := NewFromConfig(Config{
 				APIURL:     test.url,
 				OAuthToken: mock.ValidToken(),
 			})
 			assert.NoError(t, err)
 
-			thermostats, err := c.getNestReadings()
+			thermostats, err := c.getNestReadings(context.Background())
 
 			if test.wantErr != nil {
 				assert.Nil(t, thermostats)
@@ -89,7 +117,7 @@ func TestAPIURLParsing(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			c, err := New(Config{
+			c, err := NewFromConfig(Config{
 				APIURL: test.rawurl,
 			})
 
@@ -103,3 +131,563 @@ func TestAPIURLParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := NewWithContext(ctx, Config{APIURL: mock.NestServer().URL, OAuthToken: mock.ValidToken()})
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, c.ctx)
+}
+
+func TestEmbeddedRegistry(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(c))
+
+	count, err := testutil.GatherAndCount(registry, "nest_up", "nest_ambient_temperature_celsius")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestAPIErrors(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServerInvalidToken().URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	_, err = c.getNestReadings(context.Background())
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.Code)
+	assert.Equal(t, "UNAUTHENTICATED", apiErr.Status)
+	assert.Contains(t, apiErr.Message, "Request had invalid authentication credentials.")
+	assert.Contains(t, apiErr.Hint(), "refresh token")
+
+	expected := `
+# HELP nest_api_errors_total Number of error responses of Nest API by the status of the error.
+# TYPE nest_api_errors_total counter
+nest_api_errors_total{status="UNAUTHENTICATED"} 2
+`
+	// Collecting calls the API again, counting the error once more.
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_api_errors_total"))
+
+	// Error responses without a Google API error body are counted with the UNKNOWN status.
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream connect error", http.StatusBadGateway)
+	}))
+	defer serv.Close()
+
+	c, err = New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	_, err = c.getNestReadings(context.Background())
+	assert.True(t, errors.Is(err, errNon200Response))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "upstream connect error", apiErr.Message)
+	assert.Equal(t, 1.0, c.apiErrors[unknownStatus])
+
+	expected = `
+# HELP nest_api_requests_total Nest API requests by status code, or error if they weren't answered.
+# TYPE nest_api_requests_total counter
+nest_api_requests_total{code="502"} 3
+`
+	// The transient failure is retried, every attempt is counted.
+	assert.NoError(t, testutil.CollectAndCompare(c.client, strings.NewReader(expected)))
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantErr  error
+		wantSeen []string
+		wantMiss []string
+	}{
+		{
+			name:     "default unit",
+			opts:     nil,
+			wantSeen: []string{"nest_ambient_temperature_celsius", "nest_setpoint_temperature_celsius"},
+			wantMiss: []string{"nest_ambient_temperature_fahrenheit", "nest_thermostat_mode_heat"},
+		}, {
+			name:     "fahrenheit",
+			opts:     []Option{WithUnit("fahrenheit")},
+			wantSeen: []string{"nest_ambient_temperature_fahrenheit", "nest_setpoint_temperature_fahrenheit"},
+			wantMiss: []string{"nest_ambient_temperature_celsius"},
+		}, {
+			name:     "both units",
+			opts:     []Option{WithUnit("both")},
+			wantSeen: []string{"nest_ambient_temperature_celsius", "nest_ambient_temperature_fahrenheit"},
+		}, {
+			name:     "kelvin",
+			opts:     []Option{WithUnit("kelvin")},
+			wantSeen: []string{"nest_ambient_temperature_kelvin", "nest_setpoint_temperature_kelvin", "nest_home_ambient_temperature_mean_kelvin"},
+			wantMiss: []string{"nest_ambient_temperature_celsius"},
+		}, {
+			name:    "invalid unit",
+			opts:    []Option{WithUnit("rankine")},
+			wantErr: units.ErrInvalidUnit,
+		}, {
+			name:     "mode booleans",
+			opts:     []Option{WithModeMetrics(ModeMetricsBooleans)},
+			wantSeen: []string{"nest_thermostat_mode_heat", "nest_thermostat_mode_eco", "nest_thermostat_mode_off"},
+			wantMiss: []string{"nest_thermostat_mode"},
+		}, {
+			name:     "both mode representations",
+			opts:     []Option{WithModeMetrics(ModeMetricsBoth)},
+			wantSeen: []string{"nest_thermostat_mode_heat"},
+		}, {
+			name:    "invalid mode metrics",
+			opts:    []Option{WithModeMetrics("enum")},
+			wantErr: errInvalidModeMetrics,
+		}, {
+			name:    "invalid url",
+			opts:    []Option{WithAPIURL("https/////this.is.not.a.valid.url")},
+			wantErr: errFailedParsingURL,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]Option{WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken())}, test.opts...)
+			c, err := New("PROJECT_ID", opts...)
+
+			if test.wantErr != nil {
+				assert.Nil(t, c)
+				assert.True(t, errors.Is(err, test.wantErr))
+				return
+			}
+
+			assert.NoError(t, err)
+			for _, name := range test.wantSeen {
+				assert.Equal(t, 1, testutil.CollectAndCount(c, name), name)
+			}
+			for _, name := range test.wantMiss {
+				assert.Equal(t, 0, testutil.CollectAndCount(c, name), name)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	server := mock.NestServer()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()), WithCache(time.Hour))
+	assert.NoError(t, err)
+
+	first, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	// Readings must be served from the cache even though the server is gone.
+	server.Close()
+
+	second, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestConcurrentScrapes(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	valid := mock.NestServer()
+	defer valid.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		valid.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Thermostats(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+
+	// Give all goroutines time to join the in-flight request before the server responds.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, uint64(4), atomic.LoadUint64(&c.coalesced))
+}
+
+func TestDefaultCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pronestheus")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	credentials := filepath.Join(dir, "credentials.json")
+	err = ioutil.WriteFile(credentials, []byte(`{
+		"type": "authorized_user",
+		"client_id": "CLIENT_ID",
+		"client_secret": "CLIENT_SECRET",
+		"refresh_token": "REFRESH_TOKEN"
+	}`), 0600)
+	assert.NoError(t, err)
+
+	defer os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentials)
+	c, err := New("PROJECT_ID", WithDefaultCredentials())
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(dir, "missing.json"))
+	c, err = New("PROJECT_ID", WithDefaultCredentials())
+	assert.Nil(t, c)
+	assert.True(t, errors.Is(err, errFailedCredentials))
+}
+
+func TestUserAgent(t *testing.T) {
+	var mu sync.Mutex
+	userAgents := make(map[string]string)
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents[path.Base(r.URL.Path)] = r.UserAgent()
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			w.Write([]byte(`{"access_token": "ACCESS_TOKEN", "token_type": "Bearer", "expires_in": 3600}`))
+			return
+		}
+		w.Write([]byte(`{"devices": []}`))
+	}))
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithTokenURL(serv.URL+"/token"), WithOAuthClient("CLIENT_ID", "CLIENT_SECRET"),
+		WithRefreshToken("REFRESH_TOKEN"), WithUserAgent("pronestheus/1.2.0 (admin@example.com)"))
+	assert.NoError(t, err)
+
+	_, err = c.Devices(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"token":   "pronestheus/1.2.0 (admin@example.com)",
+		"devices": "pronestheus/1.2.0 (admin@example.com)",
+	}, userAgents)
+}
+
+func TestListeners(t *testing.T) {
+	var first, second [][]*Thermostat
+
+	c, err := New("PROJECT_ID",
+		WithAPIURL(mock.NestServer().URL),
+		WithToken(mock.ValidToken()),
+		WithCache(time.Hour),
+		WithListener(func(thermostats []*Thermostat) { first = append(first, thermostats) }),
+		WithListener(func(thermostats []*Thermostat) { second = append(second, thermostats) }),
+	)
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	// Cached readings aren't updates.
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	err = c.HandleEvent([]byte(`{
+		"timestamp": "2030-01-01T00:00:00Z",
+		"resourceUpdate": {
+			"name": "enterprises/PROJECT_ID/devices/DEVICE_ID",
+			"traits": {"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 25}}
+		}
+	}`))
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Len(t, first, 2)
+	assert.Equal(t, 20.23999, first[0][0].AmbientTemp)
+	assert.Equal(t, 25.0, first[1][0].AmbientTemp)
+}
+
+func TestInfo(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_thermostat_info Information about the thermostat, always 1.
+# TYPE nest_thermostat_info gauge
+nest_thermostat_info{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name",temperature_scale="CELSIUS"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_thermostat_info"))
+}
+
+func TestSettings(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	labels := `device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"`
+	want := `
+# HELP nest_eco_setpoint_temperature_celsius Setpoint temperature of the eco mode by the setpoint: heat or cool.
+# TYPE nest_eco_setpoint_temperature_celsius gauge
+nest_eco_setpoint_temperature_celsius{` + labels + `,setpoint="cool"} 24.44443
+nest_eco_setpoint_temperature_celsius{` + labels + `,setpoint="heat"} 17.11803
+# HELP nest_thermostat_settings_info Settings of the thermostat reported by its traits, always 1. Settings which aren't reported are empty.
+# TYPE nest_thermostat_settings_info gauge
+nest_thermostat_settings_info{available_eco_modes="MANUAL_ECO,OFF",available_modes="HEAT,OFF",` + labels + `} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_eco_setpoint_temperature_celsius", "nest_thermostat_settings_info"))
+}
+
+func TestModeMetrics(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithModeMetrics(ModeMetricsBoth))
+	assert.NoError(t, err)
+
+	labels := `device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"`
+	want := `
+# HELP nest_thermostat_mode Current mode of the thermostat, 1 for the current mode and 0 for the others.
+# TYPE nest_thermostat_mode gauge
+nest_thermostat_mode{` + labels + `,mode="COOL"} 0
+nest_thermostat_mode{` + labels + `,mode="ECO"} 0
+nest_thermostat_mode{` + labels + `,mode="HEAT"} 1
+nest_thermostat_mode{` + labels + `,mode="HEATCOOL"} 0
+nest_thermostat_mode{` + labels + `,mode="OFF"} 0
+# HELP nest_thermostat_mode_eco Is the thermostat in the ECO mode.
+# TYPE nest_thermostat_mode_eco gauge
+nest_thermostat_mode_eco{` + labels + `} 0
+# HELP nest_thermostat_mode_heat Is the thermostat in the HEAT mode.
+# TYPE nest_thermostat_mode_heat gauge
+nest_thermostat_mode_heat{` + labels + `} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_thermostat_mode", "nest_thermostat_mode_eco", "nest_thermostat_mode_heat"))
+}
+
+func TestLastUpdate(t *testing.T) {
+	server := mock.NestServer()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(c))
+
+	lastUpdate := func() float64 {
+		families, err := registry.Gather()
+		assert.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == "nest_last_update_timestamp_seconds" {
+				assert.Equal(t, 1, len(family.GetMetric()))
+				return family.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		t.Fatal("nest_last_update_timestamp_seconds is missing")
+		return 0
+	}
+
+	before := float64(time.Now().Unix())
+	updated := lastUpdate()
+	assert.True(t, updated >= before)
+
+	// The time of the last update is kept while the API fails.
+	server.Close()
+	assert.Equal(t, updated, lastUpdate())
+}
+
+func TestUp(t *testing.T) {
+	server := mock.NestServer()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_api_up Was talking to Nest API successful for the Device Access project.
+# TYPE nest_api_up gauge
+nest_api_up{project="PROJECT_ID"} 1
+# HELP nest_device_up Was the thermostat online in the latest readings.
+# TYPE nest_device_up gauge
+nest_device_up{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_api_up", "nest_device_up"))
+
+	// Thermostats seen before are down while the API fails.
+	server.Close()
+	want = `
+# HELP nest_api_up Was talking to Nest API successful for the Device Access project.
+# TYPE nest_api_up gauge
+nest_api_up{project="PROJECT_ID"} 0
+# HELP nest_device_up Was the thermostat online in the latest readings.
+# TYPE nest_device_up gauge
+nest_device_up{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_api_up", "nest_device_up"))
+}
+
+func TestDevicesDiscovered(t *testing.T) {
+	devices := `[
+		{"name": "enterprises/PROJECT_ID/devices/THERMOSTAT_ID", "type": "sdm.devices.types.THERMOSTAT", "traits": {}},
+		{"name": "enterprises/PROJECT_ID/devices/CAMERA_ID", "type": "sdm.devices.types.CAMERA", "traits": {}}
+	]`
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices": ` + devices + `}`))
+	}))
+	defer serv.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(serv.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_devices_discovered Number of devices in the latest devices list of the Device Access project by type.
+# TYPE nest_devices_discovered gauge
+nest_devices_discovered{type="CAMERA"} 1
+nest_devices_discovered{type="THERMOSTAT"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_devices_discovered"))
+
+	// Unlinked devices are counted as 0, the collection fails without thermostats.
+	devices = `[{"name": "enterprises/PROJECT_ID/devices/CAMERA_ID", "type": "sdm.devices.types.CAMERA", "traits": {}}]`
+	want = `
+# HELP nest_devices_discovered Number of devices in the latest devices list of the Device Access project by type.
+# TYPE nest_devices_discovered gauge
+nest_devices_discovered{type="CAMERA"} 1
+nest_devices_discovered{type="THERMOSTAT"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_devices_discovered"))
+}
+
+func TestCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices": [{
+			"name": "enterprises/PROJECT_ID/devices/COOLING",
+			"type": "sdm.devices.types.THERMOSTAT",
+			"traits": {
+				"sdm.devices.traits.Info": {"customName": "Office"},
+				"sdm.devices.traits.ThermostatMode": {"mode": "COOL", "availableModes": ["COOL", "OFF"]},
+				"sdm.devices.traits.ThermostatHvac": {"status": "COOLING"},
+				"sdm.devices.traits.ThermostatTemperatureSetpoint": {"coolCelsius": 24},
+				"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 26}
+			}
+		}, {
+			"name": "enterprises/PROJECT_ID/devices/HEATCOOL",
+			"type": "sdm.devices.types.THERMOSTAT",
+			"traits": {
+				"sdm.devices.traits.Info": {"customName": "Bedroom"},
+				"sdm.devices.traits.ThermostatMode": {"mode": "HEAT", "availableModes": ["HEAT", "COOL", "HEATCOOL", "OFF"]},
+				"sdm.devices.traits.ThermostatHvac": {"status": "HEATING"},
+				"sdm.devices.traits.ThermostatTemperatureSetpoint": {"heatCelsius": 21},
+				"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 19}
+			}
+		}]}`))
+	}))
+	defer server.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_heating Is thermostat heating.
+# TYPE nest_heating gauge
+nest_heating{device_id="HEATCOOL",id="enterprises/PROJECT_ID/devices/HEATCOOL",label="Bedroom"} 1
+# HELP nest_setpoint_temperature_celsius Setpoint temperature.
+# TYPE nest_setpoint_temperature_celsius gauge
+nest_setpoint_temperature_celsius{device_id="HEATCOOL",id="enterprises/PROJECT_ID/devices/HEATCOOL",label="Bedroom"} 21
+# HELP nest_thermostat_capability Can the HVAC system of the thermostat heat or cool, according to its available modes.
+# TYPE nest_thermostat_capability gauge
+nest_thermostat_capability{capability="cool",device_id="COOLING",id="enterprises/PROJECT_ID/devices/COOLING",label="Office"} 1
+nest_thermostat_capability{capability="cool",device_id="HEATCOOL",id="enterprises/PROJECT_ID/devices/HEATCOOL",label="Bedroom"} 1
+nest_thermostat_capability{capability="heat",device_id="COOLING",id="enterprises/PROJECT_ID/devices/COOLING",label="Office"} 0
+nest_thermostat_capability{capability="heat",device_id="HEATCOOL",id="enterprises/PROJECT_ID/devices/HEATCOOL",label="Bedroom"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_heating", "nest_setpoint_temperature_celsius", "nest_thermostat_capability"))
+
+	// Thermostats which don't report their available modes are assumed to heat.
+	assert.True(t, (&Thermostat{}).CanHeat())
+	assert.False(t, (&Thermostat{}).CanCool())
+}
+
+func BenchmarkCollect(b *testing.B) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour),
+		WithModeMetrics(ModeMetricsBoth))
+	assert.NoError(b, err)
+
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Collect(ch)
+	}
+	b.StopTimer()
+
+	close(ch)
+	<-done
+}
+
+func TestFanTimer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices": [{
+			"name": "enterprises/PROJECT_ID/devices/FAN",
+			"type": "sdm.devices.types.THERMOSTAT",
+			"traits": {
+				"sdm.devices.traits.Info": {"customName": "Hall"},
+				"sdm.devices.traits.ThermostatHvac": {"status": "OFF"},
+				"sdm.devices.traits.Fan": {"timerMode": "ON", "timerTimeout": "2019-05-10T03:22:54Z"}
+			}
+		}, {
+			"name": "enterprises/PROJECT_ID/devices/NOFAN",
+			"type": "sdm.devices.types.THERMOSTAT",
+			"traits": {
+				"sdm.devices.traits.Info": {"customName": "Office"},
+				"sdm.devices.traits.ThermostatHvac": {"status": "OFF"}
+			}
+		}]}`))
+	}))
+	defer server.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(server.URL), WithToken(mock.ValidToken()))
+	assert.NoError(t, err)
+
+	labels := `device_id="FAN",id="enterprises/PROJECT_ID/devices/FAN",label="Hall"`
+	want := `
+# HELP nest_fan_only_runtime_seconds_total Total time the fan timer ran the fan while the thermostat wasn't heating or cooling.
+# TYPE nest_fan_only_runtime_seconds_total counter
+nest_fan_only_runtime_seconds_total{` + labels + `} 0
+# HELP nest_fan_timer_on Is the fan timer of the thermostat running the fan.
+# TYPE nest_fan_timer_on gauge
+nest_fan_timer_on{` + labels + `} 1
+# HELP nest_fan_timer_timeout_timestamp_seconds Time the running fan timer stops the fan.
+# TYPE nest_fan_timer_timeout_timestamp_seconds gauge
+nest_fan_timer_timeout_timestamp_seconds{` + labels + `} 1.557458574e+09
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_fan_only_runtime_seconds_total", "nest_fan_timer_on", "nest_fan_timer_timeout_timestamp_seconds"))
+}
+
+func TestUpdateListeners(t *testing.T) {
+	var all, updates [][]*Thermostat
+
+	c, err := New("PROJECT_ID",
+		WithListener(func(thermostats []*Thermostat) { all = append(all, thermostats) }),
+		WithUpdateListener(func(thermostats []*Thermostat) { updates = append(updates, thermostats) }),
+	)
+	assert.NoError(t, err)
+
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	living := &Thermostat{ID: "enterprises/PROJECT_ID/devices/LIVING", UpdatedAt: now}
+	kitchen := &Thermostat{ID: "enterprises/PROJECT_ID/devices/KITCHEN", UpdatedAt: now}
+	c.notify([]*Thermostat{living, kitchen})
+
+	// An event updated the living room, the kitchen reading is cached.
+	updated := &Thermostat{ID: living.ID, UpdatedAt: now.Add(time.Minute)}
+	c.notify([]*Thermostat{updated, kitchen})
+	// Cached readings of all thermostats aren't updates.
+	c.notify([]*Thermostat{updated, kitchen})
+
+	assert.Equal(t, [][]*Thermostat{{living, kitchen}, {updated, kitchen}, {updated, kitchen}}, all)
+	assert.Equal(t, [][]*Thermostat{{living, kitchen}, {updated}}, updates)
+}
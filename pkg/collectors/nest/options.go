@@ -0,0 +1,371 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"golang.org/x/oauth2/google"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/units"
+	"pronestheus/pkg/useragent"
+)
+
+// DefaultAPIURL is the URL of the Google Smart Device Management API.
+const DefaultAPIURL = "https://smartdevicemanagement.googleapis.com/v1/"
+
+// Scope is the OAuth2 scope required to access the Smart Device Management API.
+const Scope = "https://www.googleapis.com/auth/sdm.service"
+
+// Option configures the Collector created by New.
+type Option func(*options)
+
+type options struct {
+	ctx               context.Context
+	logger            log.Logger
+	timeout           time.Duration
+	unit              string
+	apiURL            string
+	oauthClientID     string
+	oauthClientSecret string
+	refreshToken      string
+	token             *oauth2.Token
+	tokenSource       oauth2.TokenSource
+	cacheTTL          time.Duration
+	tokenURL          string
+	transport         http.RoundTripper
+	labelPolicy       string
+	idPolicy          string
+	modeMetrics       string
+	aliases           map[string]string
+	defaultCreds      bool
+	timestamps        bool
+	eventMetrics      bool
+	listeners         []Listener
+	updateListeners   []Listener
+	scopes            []string
+	readOnly          bool
+	readOnlyScopes    []string
+	schedule          []string
+	scheduleTimezone  string
+	shortCycle        time.Duration
+	userAgent         string
+	maxConcurrent     int
+	rateLimit         float64
+	rateBurst         int
+	fallback          bool
+	fallbackTTL       time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		ctx:         context.Background(),
+		logger:      log.NewNopLogger(),
+		timeout:     5 * time.Second,
+		unit:        units.Celsius,
+		apiURL:      DefaultAPIURL,
+		labelPolicy: LabelDashes,
+		idPolicy:    IDFull,
+		scopes:      []string{Scope},
+		shortCycle:  DefaultShortCycleThreshold,
+		rateBurst:   1,
+	}
+}
+
+// buildTokenSource returns the token source used to authenticate API requests.
+// An explicitly provided token source always takes precedence, followed by Application Default Credentials if enabled.
+// Otherwise, a token source refreshing the access token using the OAuth2 client credentials is created.
+func (o *options) buildTokenSource() (oauth2.TokenSource, error) {
+	if o.tokenSource != nil {
+		return o.tokenSource, nil
+	}
+
+	// Token requests don't use the transport of API calls, which may record responses.
+	ctx := o.ctx
+	if o.userAgent != "" {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: &useragent.Transport{UserAgent: o.userAgent}})
+	}
+
+	if o.defaultCreds {
+		creds, err := google.FindDefaultCredentials(ctx, o.requestedScopes()...)
+		if err != nil {
+			return nil, errors.Wrap(errFailedCredentials, err.Error())
+		}
+		return creds.TokenSource, nil
+	}
+
+	endpoint := endpoints.Google
+	if o.tokenURL != "" {
+		endpoint.TokenURL = o.tokenURL
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     o.oauthClientID,
+		ClientSecret: o.oauthClientSecret,
+		Scopes:       o.requestedScopes(),
+		Endpoint:     endpoint,
+	}
+
+	// If token is not provided we create a new one using RefreshToken. Using this token, the client will automatically
+	// get, and refresh, a valid access token for the API.
+	token := o.token
+	if token == nil {
+		token = &oauth2.Token{
+			TokenType:    "Bearer",
+			RefreshToken: o.refreshToken,
+		}
+	}
+
+	return newCachingTokenSource(ctx, oauthConfig, token, o.logger), nil
+}
+
+// requestedScopes returns the OAuth2 scopes requested for the access token: the read-only scopes of a read-only
+// Collector, if any, instead of the Smart Device Management scope, followed by additional scopes.
+func (o *options) requestedScopes() []string {
+	if !o.readOnly || len(o.readOnlyScopes) == 0 {
+		return o.scopes
+	}
+	return append(append([]string{}, o.readOnlyScopes...), o.scopes[1:]...)
+}
+
+// WithContext sets the context controlling the lifetime of the Collector. Cancelling it aborts all in-flight API requests.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger used by the Collector. By default, the Collector doesn't log anything.
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithTimeout sets the time to wait for Nest API to respond. Defaults to 5 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithUnit sets the unit of exported temperatures. Valid values are "celsius" (default), "fahrenheit", "kelvin" and
+// "both", which exports Celsius and Fahrenheit.
+func WithUnit(unit string) Option {
+	return func(o *options) {
+		o.unit = unit
+	}
+}
+
+// WithAPIURL sets the URL of the Nest API. Defaults to DefaultAPIURL.
+func WithAPIURL(apiURL string) Option {
+	return func(o *options) {
+		o.apiURL = apiURL
+	}
+}
+
+// WithOAuthClient sets the OAuth2 client credentials used to refresh the access token.
+func WithOAuthClient(clientID, clientSecret string) Option {
+	return func(o *options) {
+		o.oauthClientID = clientID
+		o.oauthClientSecret = clientSecret
+	}
+}
+
+// WithRefreshToken sets the OAuth2 refresh token used to get a valid access token.
+func WithRefreshToken(refreshToken string) Option {
+	return func(o *options) {
+		o.refreshToken = refreshToken
+	}
+}
+
+// WithToken sets the initial OAuth2 token. It's refreshed using the OAuth2 client credentials when it expires.
+func WithToken(token *oauth2.Token) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithTokenSource sets the token source used to authenticate API requests.
+// It takes precedence over WithOAuthClient, WithRefreshToken and WithToken.
+func WithTokenSource(tokenSource oauth2.TokenSource) Option {
+	return func(o *options) {
+		o.tokenSource = tokenSource
+	}
+}
+
+// WithCache makes the Collector reuse readings younger than ttl instead of calling the API on every collection.
+func WithCache(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithTokenURL overrides the URL of the Google OAuth2 token endpoint used to refresh the access token.
+func WithTokenURL(tokenURL string) Option {
+	return func(o *options) {
+		o.tokenURL = tokenURL
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to call the Nest API. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithMaxConcurrentRequests bounds the number of API requests in flight at once, eg. listing devices while commands
+// are executed. Further requests are queued until one finishes. Zero, the default, doesn't bound the concurrency.
+func WithMaxConcurrentRequests(n int) Option {
+	return func(o *options) {
+		o.maxConcurrent = n
+	}
+}
+
+// WithRateLimit limits API requests of the Device Access project to requestsPerMinute, allowing bursts of up to burst
+// requests after being idle, so the quota of the API isn't exceeded. Requests over the limit are queued, requests
+// which couldn't be sent before the deadline of their context fail right away. Zero, the default, doesn't limit
+// the rate.
+func WithRateLimit(requestsPerMinute float64, burst int) Option {
+	return func(o *options) {
+		o.rateLimit = requestsPerMinute
+		o.rateBurst = burst
+	}
+}
+
+// WithDeviceFallback fetches thermostats from the devices.get endpoint when the devices.list response lacks traits
+// the readings are based on, eg. the temperature or the HVAC status. Devices are fetched concurrently, and responses
+// are reused for ttl, so incomplete list responses don't cost an extra request per device on every scrape.
+func WithDeviceFallback(ttl time.Duration) Option {
+	return func(o *options) {
+		o.fallback = true
+		o.fallbackTTL = ttl
+	}
+}
+
+// WithUserAgent sets the User-Agent header of Nest API calls and OAuth2 token requests.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithLabelPolicy sets how custom names of thermostats are normalized in the "label" label.
+// Valid values are LabelDashes (default), LabelKeep, LabelLowercase and LabelSlugify.
+func WithLabelPolicy(policy string) Option {
+	return func(o *options) {
+		o.labelPolicy = policy
+	}
+}
+
+// WithIDPolicy sets the value of the "id" label. Valid values are IDFull (default), IDShort, IDHash and IDNone, which
+// omits the label.
+func WithIDPolicy(policy string) Option {
+	return func(o *options) {
+		o.idPolicy = policy
+	}
+}
+
+// WithModeMetrics sets how the current mode of thermostats is exported. Valid values are ModeMetricsStateSet
+// (default), ModeMetricsBooleans and ModeMetricsBoth.
+func WithModeMetrics(representation string) Option {
+	return func(o *options) {
+		o.modeMetrics = representation
+	}
+}
+
+// WithAliases sets stable aliases used in the "label" label instead of custom names of thermostats, so renaming
+// a thermostat in the Google Home app doesn't break dashboards and alerts. Aliases are keyed by the short device ID
+// (the last segment of the device name) or by the full device name. Aliases are normalized with the label policy.
+// The map is copied, so it can be changed after the collector is created.
+func WithAliases(aliases map[string]string) Option {
+	return func(o *options) {
+		o.aliases = make(map[string]string, len(aliases))
+		for id, alias := range aliases {
+			o.aliases[id] = alias
+		}
+	}
+}
+
+// WithDefaultCredentials authenticates API requests using Google Application Default Credentials instead of
+// the OAuth2 refresh token, eg. a service account key pointed to by GOOGLE_APPLICATION_CREDENTIALS or workload identity
+// on GKE. Additional scopes can be requested on top of the Smart Device Management scope.
+func WithDefaultCredentials(scopes ...string) Option {
+	return func(o *options) {
+		o.defaultCreds = true
+		o.scopes = append([]string{Scope}, scopes...)
+	}
+}
+
+// WithTimestamps attaches the time of the reading to exported thermostat readings, instead of leaving it
+// to Prometheus to use the time of the scrape. It's mostly useful with events received by HandleEvent.
+func WithTimestamps() Option {
+	return func(o *options) {
+		o.timestamps = true
+	}
+}
+
+// WithEventMetrics exports the number of events handled by HandleEvent by type, and of events dropped because
+// they were older than the current reading or of an unknown device.
+func WithEventMetrics() Option {
+	return func(o *options) {
+		o.eventMetrics = true
+	}
+}
+
+// WithSchedule declares the expected schedule of thermostats, exporting the deviation of their setpoint from it.
+// Entries have the "[DEVICE_ID@][DAYS ]HH:MM SETPOINT" format, eg. "mon-fri 06:30 21" or "DEVICE_ID@sat,sun 22:00 17".
+// Days are comma separated day names (sun, mon, ...) or ranges, every day is used if they're omitted. Entries
+// without a device ID apply to thermostats without their own entries. Times are in the timezone, eg. "Europe/Berlin",
+// which defaults to the local timezone. Setpoints are in the exported unit, or in Celsius if both units are exported.
+func WithSchedule(entries []string, timezone string) Option {
+	return func(o *options) {
+		o.schedule = entries
+		o.scheduleTimezone = timezone
+	}
+}
+
+// WithShortCycleThreshold sets the duration below which HVAC cycles are counted in nest_hvac_short_cycles_total.
+func WithShortCycleThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.shortCycle = threshold
+	}
+}
+
+// WithListener registers a listener notified about every update of readings: after each successful API call and
+// after each event applied by HandleEvent. Can be used multiple times to register several listeners.
+func WithListener(listener Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listener)
+	}
+}
+
+// WithUpdateListener registers a listener notified only with new readings: readings of thermostats whose UpdatedAt
+// advanced since they were last passed to update listeners. Cached readings, eg. of other thermostats after an event,
+// are left out, so listeners accumulating readings over time don't count them twice. Can be used multiple times.
+func WithUpdateListener(listener Listener) Option {
+	return func(o *options) {
+		o.updateListeners = append(o.updateListeners, listener)
+	}
+}
+
+// WithReadOnly makes the Collector reject commands with ErrReadOnly without calling the API, for least-privilege
+// deployments which only read thermostats. The Smart Device Management API has a single scope, Scope, which allows
+// commands as well, so the access token itself isn't narrowed unless scopes are given: they're requested instead of
+// Scope, eg. narrower scopes of a proxy of the API in front of the Device Access project. Scopes are requested with
+// Application Default Credentials; refresh tokens keep the scopes they were authorized with.
+func WithReadOnly(scopes ...string) Option {
+	return func(o *options) {
+		o.readOnly = true
+		o.readOnlyScopes = scopes
+	}
+}
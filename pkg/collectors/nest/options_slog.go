@@ -0,0 +1,16 @@
+//go:build go1.21
+// +build go1.21
+
+package nest
+
+import (
+	"log/slog"
+
+	"pronestheus/pkg/slogadapter"
+)
+
+// WithSlogLogger sets the slog logger used by the Collector instead of a go-kit one, see WithLogger. Requires
+// Go 1.21.
+func WithSlogLogger(logger *slog.Logger) Option {
+	return WithLogger(slogadapter.NewLogger(logger))
+}
@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package nest
+
+import (
+	"bytes"
+	"log/slog"
+	mock "pronestheus/test"
+	"testing"
+
+	"github.com/alecthomas/assert"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil)).With("project", "PROJECT_ID")
+
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServerInvalidToken().URL), WithToken(mock.ValidToken()), WithSlogLogger(logger))
+	assert.NoError(t, err)
+	testutil.CollectAndCount(c)
+
+	assert.Contains(t, buf.String(), `level=ERROR msg="Failed collecting Nest data" project=PROJECT_ID`)
+	assert.Contains(t, buf.String(), "status=UNAUTHENTICATED")
+}
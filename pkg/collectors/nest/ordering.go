@@ -0,0 +1,95 @@
+package nest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// eventIDRetention is how long IDs of applied events are remembered to discard redelivered events. Pub/Sub
+// redelivers messages which weren't acknowledged within their deadline, usually within seconds.
+const eventIDRetention = time.Hour
+
+// eventOrder orders events of every device, so events delivered out of order or more than once don't move readings
+// back. Events may contain only some traits, so the order is kept per trait: an older event still updates the traits
+// not changed by newer events. It's guarded by the cacheMu of the Collector.
+type eventOrder struct {
+	devices map[string]*traitTimes
+	applied map[string]time.Time
+	now     func() time.Time
+}
+
+// traitTimes contains the time of the last API reading of a device and timestamps of events which changed its traits
+// since then.
+type traitTimes struct {
+	fetched time.Time
+	traits  map[string]time.Time
+}
+
+func newEventOrder() *eventOrder {
+	return &eventOrder{
+		devices: make(map[string]*traitTimes),
+		applied: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// fetched resets the order of the device to the time of a reading from the API, which contains all traits.
+func (o *eventOrder) fetched(id string, at time.Time) {
+	o.devices[id] = &traitTimes{fetched: at, traits: make(map[string]time.Time)}
+}
+
+// duplicate returns true if the event with the ID was already applied, remembering it otherwise. Events without an ID
+// are never duplicates.
+func (o *eventOrder) duplicate(eventID string) bool {
+	if eventID == "" {
+		return false
+	}
+
+	now := o.now()
+	for id, at := range o.applied {
+		if now.Sub(at) > eventIDRetention {
+			delete(o.applied, id)
+		}
+	}
+
+	if _, ok := o.applied[eventID]; ok {
+		return true
+	}
+	o.applied[eventID] = now
+	return false
+}
+
+// fresh returns the traits of the event at the timestamp which are newer than the last change of each trait of the
+// device, as a JSON object. It returns false if all traits are outdated.
+func (o *eventOrder) fresh(id string, timestamp time.Time, traits gjson.Result) (gjson.Result, bool) {
+	times, ok := o.devices[id]
+	if !ok {
+		times = &traitTimes{traits: make(map[string]time.Time)}
+		o.devices[id] = times
+	}
+
+	var fields []string
+	count := 0
+	traits.ForEach(func(name, value gjson.Result) bool {
+		count++
+		last, ok := times.traits[name.String()]
+		if !ok {
+			last = times.fetched
+		}
+		if timestamp.Before(last) {
+			return true
+		}
+
+		times.traits[name.String()] = timestamp
+		fields = append(fields, name.Raw+":"+value.Raw)
+		return true
+	})
+
+	if len(fields) == 0 {
+		// Events without traits only update the time of the reading.
+		return gjson.Result{}, count == 0 && !timestamp.Before(times.fetched)
+	}
+	return gjson.Parse("{" + strings.Join(fields, ",") + "}"), true
+}
@@ -0,0 +1,60 @@
+package nest
+
+import (
+	"context"
+	mock "pronestheus/test"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestOutOfOrderEvents(t *testing.T) {
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithToken(mock.ValidToken()), WithCache(time.Hour))
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	first := time.Now().Add(time.Minute).UTC()
+	second := first.Add(time.Second)
+
+	// The newer event is delivered first.
+	assert.NoError(t, c.HandleEvent(event(second.Format(time.RFC3339Nano), deviceName, `{
+		"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 21}
+	}`)))
+	assert.NoError(t, c.HandleEvent(event(first.Format(time.RFC3339Nano), deviceName, `{
+		"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 20.5},
+		"sdm.devices.traits.Humidity": {"ambientHumidityPercent": 61}
+	}`)))
+
+	thermostats, err := c.Thermostats(context.Background())
+	assert.NoError(t, err)
+	// The older temperature is discarded, but the humidity wasn't changed by the newer event.
+	assert.Equal(t, 21.0, thermostats[0].AmbientTemp)
+	assert.Equal(t, 61.0, thermostats[0].Humidity)
+	assert.Equal(t, second, thermostats[0].UpdatedAt)
+}
+
+func TestEventOrder(t *testing.T) {
+	order := newEventOrder()
+	now := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	order.now = func() time.Time { return now }
+	order.fetched("DEVICE", now)
+
+	assert.False(t, order.duplicate("EVENT_1"))
+	assert.True(t, order.duplicate("EVENT_1"))
+	assert.False(t, order.duplicate(""))
+	assert.False(t, order.duplicate(""))
+
+	now = now.Add(eventIDRetention + time.Second)
+	assert.False(t, order.duplicate("EVENT_1"))
+
+	_, ok := order.fresh("DEVICE", now.Add(-2*eventIDRetention), gjson.Parse(`{"sdm.devices.traits.Humidity": {}}`))
+	assert.False(t, ok, "event older than the API reading")
+
+	// Events without traits are applied unless they're older than the API reading.
+	_, ok = order.fresh("DEVICE", now, gjson.Parse(`{}`))
+	assert.True(t, ok)
+}
@@ -0,0 +1,147 @@
+package nest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const minutesPerWeek = 7 * 24 * 60
+
+var (
+	errInvalidSchedule         = errors.New("invalid schedule entry; expected format: \"[DEVICE_ID@][DAYS ]HH:MM SETPOINT\"")
+	errInvalidScheduleTimezone = errors.New("invalid schedule timezone")
+)
+
+// weekdays maps abbreviated day names used in schedule entries to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// schedulePoint is a setpoint starting at a minute of the week, counted from Sunday midnight.
+type schedulePoint struct {
+	minute   int
+	setpoint float64
+}
+
+// schedule contains the expected setpoints of thermostats, by device ID. Points with an empty device ID apply to
+// thermostats without their own points.
+type schedule struct {
+	location *time.Location
+	points   map[string][]schedulePoint
+}
+
+// parseSchedule parses schedule entries in the "[DEVICE_ID@][DAYS ]HH:MM SETPOINT" format, eg. "mon-fri 06:30 21".
+// Days are comma separated day names or ranges, every day is used if they're omitted. Times are in the location,
+// which defaults to the local timezone.
+func parseSchedule(entries []string, location string) (*schedule, error) {
+	if location == "" {
+		location = "Local"
+	}
+
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidScheduleTimezone, err.Error())
+	}
+
+	s := &schedule{location: loc, points: make(map[string][]schedulePoint)}
+	for _, entry := range entries {
+		device, days, minute, setpoint, err := parseScheduleEntry(entry)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidSchedule, entry)
+		}
+
+		for day, ok := range days {
+			if ok {
+				s.points[device] = append(s.points[device], schedulePoint{minute: day*24*60 + minute, setpoint: setpoint})
+			}
+		}
+	}
+
+	for _, points := range s.points {
+		sort.Slice(points, func(i, j int) bool { return points[i].minute < points[j].minute })
+	}
+
+	return s, nil
+}
+
+func parseScheduleEntry(entry string) (device string, days [7]bool, minute int, setpoint float64, err error) {
+	if i := strings.Index(entry, "@"); i >= 0 {
+		device, entry = entry[:i], entry[i+1:]
+	}
+
+	fields := strings.Fields(entry)
+	switch len(fields) {
+	case 2:
+		days = [7]bool{true, true, true, true, true, true, true}
+	case 3:
+		if days, err = parseDays(fields[0]); err != nil {
+			return
+		}
+		fields = fields[1:]
+	default:
+		err = errInvalidSchedule
+		return
+	}
+
+	at, err := time.Parse("15:04", fields[0])
+	if err != nil {
+		return
+	}
+	minute = at.Hour()*60 + at.Minute()
+
+	setpoint, err = strconv.ParseFloat(fields[1], 64)
+	return
+}
+
+// parseDays parses comma separated day names or ranges, eg. "mon-fri" or "sat,sun".
+func parseDays(text string) (days [7]bool, err error) {
+	for _, part := range strings.Split(strings.ToLower(text), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, ok := weekdays[bounds[0]]
+		if !ok {
+			return days, errInvalidSchedule
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, ok = weekdays[bounds[1]]; !ok {
+				return days, errInvalidSchedule
+			}
+		}
+
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// expected returns the setpoint the thermostat is expected to have at the time: the setpoint of the latest point
+// before it, wrapping around the week. It returns false if the schedule doesn't apply to the thermostat.
+func (s *schedule) expected(deviceID string, t time.Time) (float64, bool) {
+	points, ok := s.points[deviceID]
+	if !ok {
+		points, ok = s.points[""]
+	}
+	if !ok || len(points) == 0 {
+		return 0, false
+	}
+
+	t = t.In(s.location)
+	minute := (int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute()) % minutesPerWeek
+
+	i := sort.Search(len(points), func(i int) bool { return points[i].minute > minute })
+	if i == 0 {
+		return points[len(points)-1].setpoint, true
+	}
+	return points[i-1].setpoint, true
+}
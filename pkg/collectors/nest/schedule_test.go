@@ -0,0 +1,111 @@
+package nest
+
+import (
+	"context"
+	mock "pronestheus/test"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScheduleExpected(t *testing.T) {
+	s, err := parseSchedule([]string{
+		"mon-fri 06:30 21",
+		"mon-fri 22:00 17",
+		"sat,sun 08:00 21",
+		"sat,sun 23:00 17",
+		"OFFICE@mon-fri 08:00 20",
+		"OFFICE@mon-fri 18:00 15",
+	}, "UTC")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		device string
+		time   string
+		want   float64
+	}{
+		{name: "before the first point of the week", time: "2020-01-05T07:00:00Z", want: 17},
+		{name: "weekend morning", time: "2020-01-05T08:00:00Z", want: 21},
+		{name: "sunday night", time: "2020-01-05T23:30:00Z", want: 17},
+		{name: "monday early morning", time: "2020-01-06T06:29:00Z", want: 17},
+		{name: "monday morning", time: "2020-01-06T06:30:00Z", want: 21},
+		{name: "friday night", time: "2020-01-10T22:15:00Z", want: 17},
+		{name: "saturday before the first point", time: "2020-01-11T07:59:00Z", want: 17},
+		{name: "device schedule", device: "OFFICE", time: "2020-01-06T12:00:00Z", want: 20},
+		{name: "device schedule on weekend", device: "OFFICE", time: "2020-01-11T12:00:00Z", want: 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.time)
+			assert.NoError(t, err)
+
+			got, ok := s.expected(tt.device, at)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScheduleTimezone(t *testing.T) {
+	s, err := parseSchedule([]string{"07:00 21", "22:00 17"}, "Europe/Berlin")
+	assert.NoError(t, err)
+
+	// 06:30 UTC is 07:30 in Berlin in winter.
+	got, _ := s.expected("DEVICE_ID", time.Date(2020, 1, 6, 6, 30, 0, 0, time.UTC))
+	assert.Equal(t, float64(21), got)
+}
+
+func TestScheduleOnlyForDevices(t *testing.T) {
+	s, err := parseSchedule([]string{"OFFICE@08:00 20"}, "UTC")
+	assert.NoError(t, err)
+
+	_, ok := s.expected("DEVICE_ID", time.Now())
+	assert.False(t, ok)
+}
+
+func TestInvalidSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		timezone string
+		wantErr  error
+	}{
+		{name: "missing setpoint", entries: []string{"07:00"}, wantErr: errInvalidSchedule},
+		{name: "invalid time", entries: []string{"7am 21"}, wantErr: errInvalidSchedule},
+		{name: "invalid setpoint", entries: []string{"07:00 warm"}, wantErr: errInvalidSchedule},
+		{name: "invalid day", entries: []string{"monday 07:00 21"}, wantErr: errInvalidSchedule},
+		{name: "invalid range", entries: []string{"mon-xyz 07:00 21"}, wantErr: errInvalidSchedule},
+		{name: "invalid timezone", entries: []string{"07:00 21"}, timezone: "Mars/Olympus", wantErr: errInvalidScheduleTimezone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("PROJECT_ID", WithToken(mock.ValidToken()), WithSchedule(tt.entries, tt.timezone))
+			assert.True(t, errors.Is(err, tt.wantErr))
+		})
+	}
+}
+
+func TestScheduleDeviation(t *testing.T) {
+	// The mock thermostat is in the HEAT mode with the setpoint 19.17838.
+	c, err := New("PROJECT_ID",
+		WithAPIURL(mock.NestServer().URL),
+		WithToken(mock.ValidToken()),
+		WithContext(context.Background()),
+		WithSchedule([]string{"00:00 20"}, "UTC"),
+	)
+	assert.NoError(t, err)
+
+	want := `
+# HELP nest_schedule_deviation_degrees Difference between the setpoint temperature and the setpoint expected by the schedule.
+# TYPE nest_schedule_deviation_degrees gauge
+nest_schedule_deviation_degrees{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} -0.8216199999999994
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(want), "nest_schedule_deviation_degrees"))
+}
@@ -0,0 +1,36 @@
+package nest
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/units"
+)
+
+// collectSettings exports the settings of the thermostat, so differences across thermostats can be spotted. The
+// Smart Device Management API only exposes the temperature scale of the display in the Settings trait, which is
+// already a label of nest_thermostat_info, the available modes and the eco setpoints. Other settings, like
+// the brightness of the display, aren't exposed.
+func (c *Collector) collectSettings(ch chan<- prometheus.Metric, therm *Thermostat, labels []string) {
+	ch <- prometheus.MustNewConstMetric(c.metrics.settingsInfo, prometheus.GaugeValue, 1,
+		append(labels, joinModes(therm.AvailableModes), joinModes(therm.AvailableEcoModes))...)
+
+	for _, unit := range c.units {
+		if therm.EcoHeatTemp != 0 {
+			ch <- c.reading(therm, c.metrics.ecoSetpoint[unit], units.FromCelsius(therm.EcoHeatTemp, unit), append(labels, "heat"))
+		}
+		if therm.EcoCoolTemp != 0 {
+			ch <- c.reading(therm, c.metrics.ecoSetpoint[unit], units.FromCelsius(therm.EcoCoolTemp, unit), append(labels, "cool"))
+		}
+	}
+}
+
+// joinModes returns the modes sorted and separated by commas, so the label value doesn't depend on the order the
+// API reports them in.
+func joinModes(modes []string) string {
+	sorted := append([]string(nil), modes...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
@@ -0,0 +1,124 @@
+package nest
+
+import "time"
+
+// State contains the counters derived by the Collector from consecutive readings, like the number of setpoint
+// changes or the time spent in each mode. It can be saved and restored, so counters survive restarts.
+type State struct {
+	Thermostats map[string]*ThermostatState `json:"thermostats"`
+}
+
+// ThermostatState contains the counters of a thermostat. ModeTransitions are counted by the source and target mode.
+type ThermostatState struct {
+	SetpointChanges  map[string]float64            `json:"setpoint_changes"`
+	ModeTransitions  map[string]map[string]float64 `json:"mode_transitions"`
+	ModeDurations    map[string]float64            `json:"mode_durations_seconds"`
+	ShortCycles      float64                       `json:"short_cycles"`
+	LastCycleSeconds float64                       `json:"last_cycle_seconds,omitempty"`
+	FanOnlySeconds   float64                       `json:"fan_only_seconds,omitempty"`
+}
+
+// State returns a copy of the counters of all thermostats.
+func (c *Collector) State() *State {
+	return c.tracker.state()
+}
+
+// Readings returns the latest readings of all thermostats, from the API or updated by events, or nil before the
+// first successful API call.
+func (c *Collector) Readings() []*Thermostat {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	return c.cached
+}
+
+// RestoreReadings replaces the latest readings with ones from another Collector, eg. returned by Readings. With
+// WithCache, they're returned without calling the API until the cache TTL passed since the latest of them.
+func (c *Collector) RestoreReadings(thermostats []*Thermostat) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.cached = thermostats
+	c.cachedAt = time.Time{}
+	for _, therm := range thermostats {
+		if therm.UpdatedAt.After(c.cachedAt) {
+			c.cachedAt = therm.UpdatedAt
+		}
+
+		// Only the effective mode is known, the mode under the eco mode is set by the next API call.
+		modes := modeState{mode: therm.Mode}
+		if therm.Mode == "ECO" {
+			modes = modeState{eco: true}
+		}
+		c.modes[therm.ID] = modes
+		c.order.fetched(therm.ID, therm.UpdatedAt)
+	}
+}
+
+// RestoreState replaces the counters of thermostats with the ones from the State. Counters continue from the
+// restored values with the next readings.
+func (c *Collector) RestoreState(s *State) {
+	c.tracker.restore(s)
+}
+
+func (t *tracker) state() *State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &State{Thermostats: make(map[string]*ThermostatState, len(t.devices))}
+	for id, state := range t.devices {
+		therm := &ThermostatState{
+			SetpointChanges: make(map[string]float64),
+			ModeTransitions: make(map[string]map[string]float64),
+			ModeDurations:   make(map[string]float64),
+			ShortCycles:     state.shortCycles,
+			FanOnlySeconds:  state.fanOnly,
+		}
+		for direction, count := range state.setpointChanges {
+			therm.SetpointChanges[direction] = count
+		}
+		for tr, count := range state.modeTransitions {
+			if therm.ModeTransitions[tr.from] == nil {
+				therm.ModeTransitions[tr.from] = make(map[string]float64)
+			}
+			therm.ModeTransitions[tr.from][tr.to] = count
+		}
+		for mode, seconds := range state.modeDurations {
+			therm.ModeDurations[mode] = seconds
+		}
+		if state.cycleCompleted {
+			therm.LastCycleSeconds = state.lastCycle.Seconds()
+		}
+		s.Thermostats[id] = therm
+	}
+
+	return s
+}
+
+func (t *tracker) restore(s *State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.devices = make(map[string]*deviceState, len(s.Thermostats))
+	for id, therm := range s.Thermostats {
+		state := newDeviceState()
+		for direction, count := range therm.SetpointChanges {
+			state.setpointChanges[direction] = count
+		}
+		for from, targets := range therm.ModeTransitions {
+			for to, count := range targets {
+				state.modeTransitions[transition{from: from, to: to}] = count
+			}
+		}
+		for mode, seconds := range therm.ModeDurations {
+			state.modeDurations[mode] = seconds
+		}
+		state.shortCycles = therm.ShortCycles
+		state.fanOnly = therm.FanOnlySeconds
+		if therm.LastCycleSeconds > 0 {
+			state.lastCycle = time.Duration(therm.LastCycleSeconds * float64(time.Second))
+			state.cycleCompleted = true
+		}
+		t.devices[id] = state
+	}
+}
@@ -0,0 +1,160 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// tokenRefreshWindow is the time before the expiry of the access token from which it's refreshed, so a failed
+	// refresh can be retried while the current token is still valid.
+	tokenRefreshWindow = 5 * time.Minute
+
+	// tokenClockSkew is the time before its expiry from which the access token isn't used anymore, in case the clock
+	// of the API is ahead of the local one.
+	tokenClockSkew = 30 * time.Second
+
+	// tokenRetryInterval is the time after a failed refresh before the next one, while the current token is valid.
+	tokenRetryInterval = 30 * time.Second
+
+	// tokenAttempts is the number of attempts of a refresh failing with transient errors.
+	tokenAttempts = 3
+
+	// tokenRetryDelay is the delay before the first retry of a refresh, doubled for every further retry.
+	tokenRetryDelay = 500 * time.Millisecond
+)
+
+// refreshFunc returns a new access token using the refresh token of the given token.
+type refreshFunc func(token *oauth2.Token) (*oauth2.Token, error)
+
+// cachingTokenSource caches the access token and refreshes it ahead of its expiry. Refreshes failing with transient
+// errors are retried with an exponential backoff. While the current token is still valid, failed refreshes are only
+// counted and logged, and retried on the retry interval, so they don't fail API calls.
+type cachingTokenSource struct {
+	refresh refreshFunc
+	logger  log.Logger
+	now     func() time.Time
+	sleep   func(time.Duration)
+
+	mu          sync.Mutex
+	token       *oauth2.Token
+	lastAttempt time.Time
+	refreshes   map[string]float64
+}
+
+// newCachingTokenSource creates a cachingTokenSource refreshing the token with the OAuth2 client config.
+func newCachingTokenSource(ctx context.Context, config *oauth2.Config, token *oauth2.Token, logger log.Logger) *cachingTokenSource {
+	refresh := func(token *oauth2.Token) (*oauth2.Token, error) {
+		// Without an access token, the token source of the config always refreshes it.
+		return config.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+	}
+
+	return &cachingTokenSource{
+		refresh:   refresh,
+		logger:    logger,
+		now:       time.Now,
+		sleep:     time.Sleep,
+		token:     token,
+		refreshes: map[string]float64{"success": 0, "failure": 0},
+	}
+}
+
+// Token implements the oauth2.TokenSource interface.
+func (s *cachingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if !s.needsRefresh(now) {
+		return s.token, nil
+	}
+	if s.usable(now) && now.Sub(s.lastAttempt) < tokenRetryInterval {
+		return s.token, nil
+	}
+
+	s.lastAttempt = now
+	token, err := s.refreshWithRetries()
+	if err != nil {
+		s.refreshes["failure"]++
+		if s.usable(s.now()) {
+			s.logger.Log("level", "warn", "message", "Failed refreshing OAuth2 access token, using the current one until it expires", "expiry", s.token.Expiry, "stack", errors.WithStack(err))
+			return s.token, nil
+		}
+		return nil, err
+	}
+
+	s.refreshes["success"]++
+	s.token = token
+	return token, nil
+}
+
+// refreshWithRetries refreshes the token, retrying transient errors. The caller must hold the lock.
+func (s *cachingTokenSource) refreshWithRetries() (*oauth2.Token, error) {
+	delay := tokenRetryDelay
+	for attempt := 1; ; attempt++ {
+		token, err := s.refresh(s.token)
+		if err == nil {
+			return token, nil
+		}
+		if attempt == tokenAttempts || !transient(err) {
+			return nil, err
+		}
+
+		s.logger.Log("level", "debug", "message", "Retrying OAuth2 access token refresh", "attempt", attempt, "stack", errors.WithStack(err))
+		s.sleep(delay)
+		delay *= 2
+	}
+}
+
+// needsRefresh returns true if there's no access token or it expires within the refresh window. The caller must hold
+// the lock.
+func (s *cachingTokenSource) needsRefresh(now time.Time) bool {
+	if s.token == nil || s.token.AccessToken == "" {
+		return true
+	}
+	return !s.token.Expiry.IsZero() && !now.Before(s.token.Expiry.Add(-tokenRefreshWindow))
+}
+
+// usable returns true if there's an access token which doesn't expire within the clock skew. The caller must hold
+// the lock.
+func (s *cachingTokenSource) usable(now time.Time) bool {
+	if s.token == nil || s.token.AccessToken == "" {
+		return false
+	}
+	return s.token.Expiry.IsZero() || now.Before(s.token.Expiry.Add(-tokenClockSkew))
+}
+
+// state returns the number of refreshes by result and the expiry of the current access token, which is zero if
+// there's none or it doesn't expire.
+func (s *cachingTokenSource) state() (map[string]float64, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refreshes := make(map[string]float64, len(s.refreshes))
+	for result, count := range s.refreshes {
+		refreshes[result] = count
+	}
+
+	var expiry time.Time
+	if s.token != nil && s.token.AccessToken != "" {
+		expiry = s.token.Expiry
+	}
+	return refreshes, expiry
+}
+
+// transient returns true if the refresh error may go away on retry: network errors, rate limiting and server errors.
+// Other responses of the token endpoint, eg. a revoked refresh token, fail again.
+func transient(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		code := retrieveErr.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package nest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	mock "pronestheus/test"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/oauth2"
+)
+
+// fakeRefresher returns access tokens valid for an hour from now, or the errors in order until they run out.
+type fakeRefresher struct {
+	now      time.Time
+	errs     []error
+	attempts int
+}
+
+func (f *fakeRefresher) refresh(token *oauth2.Token) (*oauth2.Token, error) {
+	f.attempts++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: "new", RefreshToken: token.RefreshToken, Expiry: f.now.Add(time.Hour)}, nil
+}
+
+// retrieveError returns an error of the token endpoint with the given status code.
+func retrieveError(code int) error {
+	return &oauth2.RetrieveError{Response: &http.Response{StatusCode: code, Status: http.StatusText(code)}}
+}
+
+func newTestTokenSource(f *fakeRefresher, token *oauth2.Token) *cachingTokenSource {
+	return &cachingTokenSource{
+		refresh:   f.refresh,
+		logger:    log.NewNopLogger(),
+		now:       func() time.Time { return f.now },
+		sleep:     func(time.Duration) {},
+		token:     token,
+		refreshes: map[string]float64{"success": 0, "failure": 0},
+	}
+}
+
+func TestTokenRefreshWindow(t *testing.T) {
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := &fakeRefresher{now: start}
+	s := newTestTokenSource(f, &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: start.Add(10 * time.Minute)})
+
+	token, err := s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "old", token.AccessToken, "tokens aren't refreshed before the refresh window")
+	assert.Equal(t, 0, f.attempts)
+
+	f.now = start.Add(6 * time.Minute)
+	token, err = s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token.AccessToken, "tokens are refreshed ahead of their expiry")
+	assert.Equal(t, "refresh", token.RefreshToken)
+}
+
+func TestTokenRefreshFailures(t *testing.T) {
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := &fakeRefresher{now: start, errs: []error{retrieveError(http.StatusServiceUnavailable), errors.New("connection reset")}}
+	s := newTestTokenSource(f, &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: start.Add(time.Minute)})
+
+	token, err := s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token.AccessToken, "transient errors are retried")
+	assert.Equal(t, 3, f.attempts)
+
+	// A revoked refresh token isn't retried, the current token is used while it's valid.
+	f.now = start.Add(56 * time.Minute)
+	f.errs = []error{retrieveError(http.StatusBadRequest)}
+	token, err = s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+	assert.Equal(t, 4, f.attempts)
+
+	// Failed refreshes are retried on the retry interval, not on every call.
+	f.errs = []error{retrieveError(http.StatusBadRequest), retrieveError(http.StatusBadRequest)}
+	_, err = s.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, f.attempts)
+
+	// Within the clock skew of the expiry the current token isn't used anymore.
+	f.now = start.Add(time.Hour - 10*time.Second)
+	_, err = s.Token()
+	assert.Error(t, err)
+	assert.Equal(t, 5, f.attempts)
+
+	refreshes, _ := s.state()
+	assert.Equal(t, map[string]float64{"success": 1, "failure": 2}, refreshes)
+}
+
+func TestTokenMetrics(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	tokenServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "ACCESS_TOKEN", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+	defer tokenServ.Close()
+
+	c, err := New("PROJECT_ID", WithAPIURL(mock.NestServer().URL), WithRefreshToken("REFRESH_TOKEN"), WithTokenURL(tokenServ.URL))
+	assert.NoError(t, err)
+
+	_, err = c.Thermostats(context.Background())
+	assert.NoError(t, err)
+
+	expected := `
+# HELP nest_oauth_token_refreshes_total Number of OAuth2 access token refreshes by result.
+# TYPE nest_oauth_token_refreshes_total counter
+nest_oauth_token_refreshes_total{result="failure"} 0
+nest_oauth_token_refreshes_total{result="success"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_oauth_token_refreshes_total"))
+
+	_, tokenExpiry := c.tokenSource.(*cachingTokenSource).state()
+	assert.False(t, tokenExpiry.Before(expiry), "the expiry is the time of the refresh plus expires_in")
+}
@@ -0,0 +1,238 @@
+package nest
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Directions of setpoint changes.
+const (
+	directionUp   = "up"
+	directionDown = "down"
+)
+
+// setpointTolerance is the smallest setpoint difference considered a change. It filters out rounding noise of the API.
+const setpointTolerance = 0.01
+
+// DefaultShortCycleThreshold is the duration below which an HVAC cycle is counted as a short cycle.
+const DefaultShortCycleThreshold = 5 * time.Minute
+
+// transition is a change of the thermostat mode.
+type transition struct {
+	from string
+	to   string
+}
+
+// deviceState stores the state of a thermostat tracked across collections.
+type deviceState struct {
+	updatedAt       time.Time
+	setpoint        float64
+	setpointChanges map[string]float64
+	mode            string
+	modeTransitions map[transition]float64
+	modeDurations   map[string]float64
+
+	// cycleStart is the time the current HVAC cycle started, it's zero when the HVAC is idle or when the start of
+	// the cycle wasn't observed.
+	cycleStart     time.Time
+	status         string
+	shortCycles    float64
+	lastCycle      time.Duration
+	cycleCompleted bool
+
+	// fanTimer is true if the fan timer was on in the previous reading.
+	fanTimer bool
+	fanOnly  float64
+}
+
+// tracker keeps the state of thermostats between collections to derive metrics which can't be computed from a single
+// reading, like the number of setpoint changes or time spent in each mode.
+type tracker struct {
+	mu                  sync.Mutex
+	devices             map[string]*deviceState
+	shortCycleThreshold time.Duration
+}
+
+func newTracker(shortCycleThreshold time.Duration) *tracker {
+	return &tracker{
+		devices:             make(map[string]*deviceState),
+		shortCycleThreshold: shortCycleThreshold,
+	}
+}
+
+func newDeviceState() *deviceState {
+	return &deviceState{
+		setpointChanges: map[string]float64{directionUp: 0, directionDown: 0},
+		modeTransitions: make(map[transition]float64),
+		modeDurations:   make(map[string]float64),
+	}
+}
+
+// active returns true if the HVAC status means the equipment is running.
+func active(status string) bool {
+	return status == "HEATING" || status == "COOLING"
+}
+
+// update compares the new readings, taken at the given time, with the tracked state and updates it.
+func (t *tracker) update(thermostats []*Thermostat, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, therm := range thermostats {
+		state, ok := t.devices[therm.ID]
+		if !ok {
+			state = newDeviceState()
+			t.devices[therm.ID] = state
+		}
+
+		// The first reading, or the first one after the counters were restored, only sets the tracked state.
+		if state.updatedAt.IsZero() {
+			state.updatedAt = now
+			state.setpoint = therm.SetpointTemp
+			state.mode = therm.Mode
+			state.status = therm.Status
+			state.fanTimer = therm.FanTimerMode == "ON"
+			if _, ok := state.modeDurations[therm.Mode]; !ok {
+				state.modeDurations[therm.Mode] = 0
+			}
+			continue
+		}
+
+		diff := therm.SetpointTemp - state.setpoint
+		if math.Abs(diff) >= setpointTolerance {
+			if diff > 0 {
+				state.setpointChanges[directionUp]++
+			} else {
+				state.setpointChanges[directionDown]++
+			}
+		}
+		state.setpoint = therm.SetpointTemp
+
+		// Time since the previous reading is attributed to the previous mode, we can't know when exactly it changed.
+		elapsed := now.Sub(state.updatedAt).Seconds()
+		state.modeDurations[state.mode] += elapsed
+		// The fan runs on its own only while the timer is on and the equipment is idle, otherwise the runtime is
+		// heating or cooling.
+		if state.fanTimer && !active(state.status) {
+			state.fanOnly += elapsed
+		}
+		state.fanTimer = therm.FanTimerMode == "ON"
+		if therm.Mode != state.mode {
+			state.modeTransitions[transition{from: state.mode, to: therm.Mode}]++
+			if _, ok := state.modeDurations[therm.Mode]; !ok {
+				state.modeDurations[therm.Mode] = 0
+			}
+		}
+		state.mode = therm.Mode
+		state.updatedAt = now
+
+		t.updateCycle(state, therm.Status, now)
+	}
+}
+
+// updateCycle tracks HVAC cycles from status transitions. A cycle lasts from the first reading with the equipment
+// running until the first reading with a different status, so its duration is only as precise as the interval of
+// readings. Cycles already running when the thermostat was first seen are ignored.
+func (t *tracker) updateCycle(state *deviceState, status string, now time.Time) {
+	if status == state.status {
+		return
+	}
+
+	if active(state.status) && !state.cycleStart.IsZero() {
+		state.lastCycle = now.Sub(state.cycleStart)
+		state.cycleCompleted = true
+		if state.lastCycle < t.shortCycleThreshold {
+			state.shortCycles++
+		}
+	}
+
+	state.cycleStart = time.Time{}
+	if active(status) {
+		state.cycleStart = now
+	}
+	state.status = status
+}
+
+// setpointChanges returns the number of setpoint changes of the thermostat in the given direction.
+func (t *tracker) setpointChanges(id string, direction string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.devices[id]
+	if !ok {
+		return 0
+	}
+
+	return state.setpointChanges[direction]
+}
+
+// modeTransitions returns the number of observed mode transitions of the thermostat, sorted by the source mode.
+func (t *tracker) modeTransitions(id string) ([]transition, []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.devices[id]
+	if !ok {
+		return nil, nil
+	}
+
+	var transitions []transition
+	for tr := range state.modeTransitions {
+		transitions = append(transitions, tr)
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		if transitions[i].from == transitions[j].from {
+			return transitions[i].to < transitions[j].to
+		}
+		return transitions[i].from < transitions[j].from
+	})
+
+	counts := make([]float64, len(transitions))
+	for i, tr := range transitions {
+		counts[i] = state.modeTransitions[tr]
+	}
+
+	return transitions, counts
+}
+
+// modeDurations returns the total number of seconds the thermostat spent in each observed mode.
+func (t *tracker) modeDurations(id string) map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	durations := make(map[string]float64)
+	if state, ok := t.devices[id]; ok {
+		for mode, seconds := range state.modeDurations {
+			durations[mode] = seconds
+		}
+	}
+
+	return durations
+}
+
+// cycles returns the number of short HVAC cycles of the thermostat and the duration of its last completed cycle.
+// The returned bool is false if no cycle was completed yet.
+func (t *tracker) cycles(id string) (float64, time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.devices[id]
+	if !ok {
+		return 0, 0, false
+	}
+
+	return state.shortCycles, state.lastCycle, state.cycleCompleted
+}
+
+// fanOnlyRuntime returns the total number of seconds the fan timer ran the fan while the thermostat was idle.
+func (t *tracker) fanOnlyRuntime(id string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state, ok := t.devices[id]; ok {
+		return state.fanOnly
+	}
+	return 0
+}
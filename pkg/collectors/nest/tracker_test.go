@@ -0,0 +1,111 @@
+package nest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestSetpointChanges(t *testing.T) {
+	tr := newTracker(DefaultShortCycleThreshold)
+
+	setpoints := []float64{19, 19, 20.5, 20.5, 18, 18.001, 19}
+	for _, setpoint := range setpoints {
+		tr.update([]*Thermostat{{ID: "a", SetpointTemp: setpoint}}, time.Now())
+	}
+
+	assert.Equal(t, float64(2), tr.setpointChanges("a", directionUp))
+	assert.Equal(t, float64(1), tr.setpointChanges("a", directionDown))
+	assert.Equal(t, float64(0), tr.setpointChanges("unknown", directionUp))
+}
+
+func TestModeTransitions(t *testing.T) {
+	tr := newTracker(DefaultShortCycleThreshold)
+	start := time.Now()
+
+	modes := []string{"HEAT", "HEAT", "ECO", "OFF", "HEAT"}
+	for i, mode := range modes {
+		tr.update([]*Thermostat{{ID: "a", Mode: mode}}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	transitions, counts := tr.modeTransitions("a")
+	assert.Equal(t, []transition{{"ECO", "OFF"}, {"HEAT", "ECO"}, {"OFF", "HEAT"}}, transitions)
+	assert.Equal(t, []float64{1, 1, 1}, counts)
+
+	assert.Equal(t, map[string]float64{"HEAT": 120, "ECO": 60, "OFF": 60}, tr.modeDurations("a"))
+}
+
+func TestCycles(t *testing.T) {
+	tr := newTracker(5 * time.Minute)
+	start := time.Now()
+
+	statuses := []string{"HEATING", "OFF", "HEATING", "OFF", "OFF", "HEATING", "HEATING", "HEATING", "HEATING", "HEATING", "HEATING", "OFF", "COOLING", "OFF"}
+	for i, status := range statuses {
+		tr.update([]*Thermostat{{ID: "a", Status: status}}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	shortCycles, last, ok := tr.cycles("a")
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), shortCycles, "the cycle running at startup isn't counted")
+	assert.Equal(t, time.Minute, last)
+
+	_, _, ok = tr.cycles("unknown")
+	assert.False(t, ok)
+}
+
+func TestFanOnlyRuntime(t *testing.T) {
+	tr := newTracker(DefaultShortCycleThreshold)
+	start := time.Now()
+
+	readings := []*Thermostat{
+		{ID: "a", Status: "OFF", FanTimerMode: "ON"},
+		{ID: "a", Status: "HEATING", FanTimerMode: "ON"},
+		{ID: "a", Status: "OFF", FanTimerMode: "ON"},
+		{ID: "a", Status: "OFF", FanTimerMode: "OFF"},
+		{ID: "a", Status: "OFF", FanTimerMode: "OFF"},
+	}
+	for i, therm := range readings {
+		tr.update([]*Thermostat{therm}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	assert.Equal(t, float64(120), tr.fanOnlyRuntime("a"), "time spent heating isn't fan-only runtime")
+	assert.Equal(t, float64(0), tr.fanOnlyRuntime("unknown"))
+
+	restored := newTracker(DefaultShortCycleThreshold)
+	restored.restore(tr.state())
+	assert.Equal(t, float64(120), restored.fanOnlyRuntime("a"))
+}
+
+func TestRestoreState(t *testing.T) {
+	tr := newTracker(DefaultShortCycleThreshold)
+	start := time.Now()
+
+	readings := []*Thermostat{
+		{ID: "a", Mode: "HEAT", Status: "OFF", SetpointTemp: 19},
+		{ID: "a", Mode: "HEAT", Status: "HEATING", SetpointTemp: 21},
+		{ID: "a", Mode: "ECO", Status: "OFF", SetpointTemp: 21},
+	}
+	for i, therm := range readings {
+		tr.update([]*Thermostat{therm}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	restored := newTracker(DefaultShortCycleThreshold)
+	restored.restore(tr.state())
+	assert.Equal(t, tr.state(), restored.state())
+
+	// The first reading after the restore doesn't change counters, even though the mode differs.
+	restored.update([]*Thermostat{{ID: "a", Mode: "HEAT", SetpointTemp: 18}}, start.Add(time.Hour))
+	restored.update([]*Thermostat{{ID: "a", Mode: "ECO", SetpointTemp: 18}}, start.Add(time.Hour+time.Minute))
+
+	assert.Equal(t, float64(1), restored.setpointChanges("a", directionUp))
+	transitions, counts := restored.modeTransitions("a")
+	assert.Equal(t, []transition{{"HEAT", "ECO"}}, transitions)
+	assert.Equal(t, []float64{2}, counts)
+	assert.Equal(t, map[string]float64{"HEAT": 180, "ECO": 0}, restored.modeDurations("a"))
+
+	shortCycles, last, ok := restored.cycles("a")
+	assert.True(t, ok)
+	assert.Equal(t, float64(1), shortCycles)
+	assert.Equal(t, time.Minute, last)
+}
@@ -0,0 +1,28 @@
+// Package sensor implements a Prometheus collector for local temperature sensors read over HTTP, eg. ESPHome
+// devices with the web server component, so reference sensors can be compared with the readings of thermostats.
+//
+// Every sensor is read from its own URL. The response is either a plain number, a JSON document with the reading at
+// the path given in the URL fragment, eg. "http://pi.local/api/climate#living.temperature", or an ESPHome sensor
+// state, eg. {"id": "sensor-temperature", "value": 21.5, "state": "21.5 °C"}. Readings are in Celsius, unless the
+// ESPHome state is in Fahrenheit.
+//
+// The collector doesn't depend on any global state, so it can be embedded in any Go program and registered in its own
+// Prometheus registry:
+//
+//	source, err := sensor.ParseSource("living-room=http://esphome-living-room.local/sensor/temperature")
+//	if err != nil {
+//		return err
+//	}
+//
+//	collector, err := sensor.New([]sensor.Source{source},
+//		sensor.WithTimeout(5*time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+//
+// Readings can also be fetched directly, without going through Prometheus, using Collector.Readings.
+package sensor
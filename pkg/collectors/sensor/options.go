@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"pronestheus/pkg/units"
+)
+
+// Option configures the Collector created by New.
+type Option func(*options)
+
+type options struct {
+	ctx       context.Context
+	logger    log.Logger
+	timeout   time.Duration
+	unit      string
+	transport http.RoundTripper
+}
+
+func defaultOptions() *options {
+	return &options{
+		ctx:     context.Background(),
+		logger:  log.NewNopLogger(),
+		timeout: 5 * time.Second,
+		unit:    units.Celsius,
+	}
+}
+
+// WithContext sets the context controlling the lifetime of the Collector. Cancelling it aborts all in-flight requests.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger used by the Collector. By default, the Collector doesn't log anything.
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithTimeout sets the time to wait for each sensor to respond. Defaults to 5 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithUnit sets the unit of exported temperatures. Valid values are "celsius" (default), "fahrenheit", "kelvin" and
+// "both", which exports Celsius and Fahrenheit.
+func WithUnit(unit string) Option {
+	return func(o *options) {
+		o.unit = unit
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to read sensors. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
@@ -0,0 +1,274 @@
+package sensor
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+	"pronestheus/pkg/units"
+)
+
+var (
+	errInvalidSource     = errors.New("invalid local sensor; expected NAME=URL, eg. living-room=http://esphome.local/sensor/temperature")
+	errNon200Response    = errors.New("local sensor responded with non-200 code")
+	errFailedRequest     = errors.New("failed local sensor request")
+	errFailedReadingBody = errors.New("failed reading local sensor response body")
+	errMissingReading    = errors.New("local sensor response doesn't contain a numeric reading")
+)
+
+// Source is a local sensor read over HTTP. Path is the path of the reading in a JSON response, in the syntax of
+// github.com/tidwall/gjson. If it's empty, the response is a plain number or an ESPHome sensor state.
+type Source struct {
+	Name string
+	URL  string
+	Path string
+}
+
+// ParseSource parses a sensor given as NAME=URL, where the fragment of the URL is the path of the reading.
+func ParseSource(text string) (Source, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Source{}, errors.Wrap(errInvalidSource, text)
+	}
+
+	u, err := url.Parse(parts[1])
+	if err != nil {
+		return Source{}, errors.Wrap(errInvalidSource, err.Error())
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Source{}, errors.Wrap(errInvalidSource, text)
+	}
+
+	path := u.Fragment
+	u.Fragment = ""
+	return Source{Name: parts[0], URL: u.String(), Path: path}, nil
+}
+
+// Reading is the temperature reported by a local sensor.
+type Reading struct {
+	Sensor string
+	// Temperature is always in Celsius, regardless of the exported unit.
+	Temperature float64
+	// UpdatedAt is the time the reading was fetched from the sensor.
+	UpdatedAt time.Time
+}
+
+// Config provides the configuration necessary to create the Collector.
+// Logger is optional, if it's nil the Collector doesn't log anything. Unit is the temperature unit of metrics:
+// celsius (default), fahrenheit, kelvin or both.
+//
+// Deprecated: Config is kept for backward compatibility only, use New with Options instead.
+type Config struct {
+	Logger    log.Logger
+	Timeout   int
+	Unit      string
+	Sources   []Source
+	Transport http.RoundTripper
+}
+
+// Collector implements the Collector interface, collecting readings of local sensors.
+type Collector struct {
+	ctx     context.Context
+	client  *httpx.Client
+	logger  log.Logger
+	sources []Source
+	units   []string
+	metrics *Metrics
+}
+
+// Metrics contains the metrics collected by the Collector.
+type Metrics struct {
+	up   *prometheus.Desc
+	temp map[string]*prometheus.Desc
+}
+
+// NewFromConfig creates a Collector using the given Config.
+//
+// Deprecated: NewFromConfig is kept for backward compatibility only, use New with Options instead.
+func NewFromConfig(cfg Config) (*Collector, error) {
+	return New(cfg.Sources, configOptions(cfg)...)
+}
+
+// NewWithContext creates a Collector using the given Config. Cancelling the context aborts all in-flight requests.
+//
+// Deprecated: NewWithContext is kept for backward compatibility only, use New with WithContext and other Options
+// instead.
+func NewWithContext(ctx context.Context, cfg Config) (*Collector, error) {
+	return New(cfg.Sources, append(configOptions(cfg), WithContext(ctx))...)
+}
+
+// configOptions returns the Options equivalent to the Config.
+func configOptions(cfg Config) []Option {
+	return []Option{
+		WithLogger(cfg.Logger),
+		WithTimeout(time.Duration(cfg.Timeout) * time.Millisecond),
+		WithUnit(cfg.Unit),
+		WithTransport(cfg.Transport),
+	}
+}
+
+// New creates a Collector reading the given local sensors.
+func New(sources []Source, opts ...Option) (*Collector, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	exported, err := units.Parse(o.unit)
+	if err != nil {
+		return nil, err
+	}
+
+	client := httpx.New(httpx.Config{
+		Transport:    o.transport,
+		Timeout:      o.timeout,
+		Errors:       httpx.Errors{Request: errFailedRequest, ReadingBody: errFailedReadingBody, Non200: errNon200Response},
+		Requests:     "local_sensor_requests_total",
+		RequestsHelp: "Local sensor requests by status code, or error if they weren't answered.",
+	})
+
+	collector := &Collector{
+		ctx:     o.ctx,
+		client:  client,
+		logger:  o.logger,
+		sources: sources,
+		units:   exported,
+		metrics: buildMetrics(exported),
+	}
+
+	return collector, nil
+}
+
+func buildMetrics(units []string) *Metrics {
+	metrics := &Metrics{
+		up:   prometheus.NewDesc(strings.Join([]string{"local", "sensor", "up"}, "_"), "Was reading the local sensor successful.", []string{"sensor"}, nil),
+		temp: make(map[string]*prometheus.Desc),
+	}
+
+	for _, unit := range units {
+		metrics.temp[unit] = prometheus.NewDesc(strings.Join([]string{"local", "sensor", "temperature", unit}, "_"), "Temperature reported by the local sensor.", []string{"sensor"}, nil)
+	}
+
+	return metrics
+}
+
+// Describe implements the prometheus.Describe interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metrics.up
+	for _, unit := range c.units {
+		ch <- c.metrics.temp[unit]
+	}
+	c.client.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface. Sensors are read concurrently, a failing sensor doesn't
+// affect the others.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	defer c.client.Collect(ch)
+
+	readings, errs := c.read(c.ctx)
+
+	for name, err := range errs {
+		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 0, name)
+		c.logger.Log("level", "error", "message", "Failed reading local sensor", "sensor", name, "stack", errors.WithStack(err))
+	}
+
+	for _, reading := range readings {
+		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 1, reading.Sensor)
+		for _, unit := range c.units {
+			ch <- prometheus.MustNewConstMetric(c.metrics.temp[unit], prometheus.GaugeValue, units.FromCelsius(reading.Temperature, unit), reading.Sensor)
+		}
+	}
+}
+
+// Readings returns the current readings of all sensors which could be read, ordered by sensor name. If any sensor
+// failed, the error of the first failed sensor by name is returned too.
+func (c *Collector) Readings(ctx context.Context) ([]*Reading, error) {
+	readings, errs := c.read(ctx)
+	sort.Slice(readings, func(i, j int) bool { return readings[i].Sensor < readings[j].Sensor })
+
+	if len(errs) == 0 {
+		return readings, nil
+	}
+
+	failed := make([]string, 0, len(errs))
+	for name := range errs {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	return readings, errors.Wrap(errs[failed[0]], failed[0])
+}
+
+// read reads all sensors concurrently, returning the readings and the errors of failed sensors by name.
+func (c *Collector) read(ctx context.Context) ([]*Reading, map[string]error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var readings []*Reading
+	errs := make(map[string]error)
+
+	for _, source := range c.sources {
+		wg.Add(1)
+		go func(source Source) {
+			defer wg.Done()
+
+			temp, err := c.get(ctx, source)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[source.Name] = err
+				return
+			}
+			readings = append(readings, &Reading{Sensor: source.Name, Temperature: temp, UpdatedAt: time.Now()})
+		}(source)
+	}
+
+	wg.Wait()
+	return readings, errs
+}
+
+// get reads the temperature of the sensor in Celsius.
+func (c *Collector) get(ctx context.Context, source Source) (float64, error) {
+	body, err := c.client.Get(ctx, source.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseReading(body, source.Path)
+}
+
+// parseReading returns the temperature in Celsius from the response body.
+func parseReading(body []byte, path string) (float64, error) {
+	if path != "" {
+		value := gjson.GetBytes(body, path)
+		if value.Type != gjson.Number {
+			return 0, errors.Wrap(errMissingReading, path)
+		}
+		return value.Float(), nil
+	}
+
+	if temp, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64); err == nil {
+		return temp, nil
+	}
+
+	// ESPHome sensor state.
+	value := gjson.GetBytes(body, "value")
+	if value.Type != gjson.Number {
+		return 0, errMissingReading
+	}
+	if strings.HasSuffix(gjson.GetBytes(body, "state").String(), "°F") {
+		return units.ToCelsius(value.Float(), units.Fahrenheit), nil
+	}
+	return value.Float(), nil
+}
@@ -0,0 +1,101 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func sensorServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/plain":
+			fmt.Fprintln(w, "21.25")
+		case "/esphome/celsius":
+			fmt.Fprint(w, `{"id": "sensor-temperature", "value": 20.5, "state": "20.5 °C"}`)
+		case "/esphome/fahrenheit":
+			fmt.Fprint(w, `{"id": "sensor-temperature", "value": 68, "state": "68.0 °F"}`)
+		case "/climate":
+			fmt.Fprint(w, `{"living": {"temperature": 19.75, "humidity": 45}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("living-room=http://pi.local/api/climate?room=1#living.temperature")
+	assert.NoError(t, err)
+	assert.Equal(t, Source{Name: "living-room", URL: "http://pi.local/api/climate?room=1", Path: "living.temperature"}, source)
+
+	for _, invalid := range []string{"http://pi.local", "=http://pi.local", "attic=not a url"} {
+		_, err := ParseSource(invalid)
+		assert.True(t, errors.Is(err, errInvalidSource), invalid)
+	}
+}
+
+func TestReadings(t *testing.T) {
+	server := sensorServer()
+	defer server.Close()
+
+	var sources []Source
+	for _, text := range []string{"plain=/plain", "celsius=/esphome/celsius", "fahrenheit=/esphome/fahrenheit", "climate=/climate#living.temperature"} {
+		parts := strings.SplitN(text, "=", 2)
+		source, err := ParseSource(parts[0] + "=" + server.URL + parts[1])
+		assert.NoError(t, err)
+		sources = append(sources, source)
+	}
+
+	c, err := New(sources)
+	assert.NoError(t, err)
+
+	readings, err := c.Readings(context.Background())
+	assert.NoError(t, err)
+
+	want := map[string]float64{"celsius": 20.5, "climate": 19.75, "fahrenheit": 20, "plain": 21.25}
+	assert.Len(t, readings, len(want))
+	for _, reading := range readings {
+		assert.Equal(t, want[reading.Sensor], reading.Temperature, reading.Sensor)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := sensorServer()
+	defer server.Close()
+
+	c, err := New([]Source{
+		{Name: "attic", URL: server.URL + "/missing"},
+		{Name: "living-room", URL: server.URL + "/plain"},
+		{Name: "humidity", URL: server.URL + "/climate", Path: "living.missing"},
+	}, WithUnit("both"))
+	assert.NoError(t, err)
+
+	expected := `
+# HELP local_sensor_requests_total Local sensor requests by status code, or error if they weren't answered.
+# TYPE local_sensor_requests_total counter
+local_sensor_requests_total{code="200"} 2
+local_sensor_requests_total{code="404"} 1
+# HELP local_sensor_temperature_celsius Temperature reported by the local sensor.
+# TYPE local_sensor_temperature_celsius gauge
+local_sensor_temperature_celsius{sensor="living-room"} 21.25
+# HELP local_sensor_temperature_fahrenheit Temperature reported by the local sensor.
+# TYPE local_sensor_temperature_fahrenheit gauge
+local_sensor_temperature_fahrenheit{sensor="living-room"} 70.25
+# HELP local_sensor_up Was reading the local sensor successful.
+# TYPE local_sensor_up gauge
+local_sensor_up{sensor="attic"} 0
+local_sensor_up{sensor="humidity"} 0
+local_sensor_up{sensor="living-room"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)), "failing sensors don't affect the others")
+
+	_, err = c.Readings(context.Background())
+	assert.True(t, errors.Is(err, errNon200Response), "the error of the first failed sensor is returned")
+}
@@ -0,0 +1,18 @@
+// Package solar implements a Prometheus collector for solar radiation and cloud cover reported by Open-Meteo API,
+// so solar gains can be correlated with inside temperatures. Open-Meteo doesn't require an API key.
+//
+// The collector doesn't depend on any global state, so it can be embedded in any Go program and registered in its own
+// Prometheus registry:
+//
+//	collector, err := solar.New(52.37, 4.89,
+//		solar.WithTimeout(5*time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+//
+// Readings can also be fetched directly, without going through Prometheus, using Collector.Radiation.
+package solar
@@ -0,0 +1,69 @@
+package solar
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// DefaultAPIURL is the URL of the Open-Meteo forecast API, which serves the current conditions.
+const DefaultAPIURL = "https://api.open-meteo.com/v1/forecast"
+
+// Option configures the Collector created by New.
+type Option func(*options)
+
+type options struct {
+	ctx       context.Context
+	logger    log.Logger
+	timeout   time.Duration
+	apiURL    string
+	transport http.RoundTripper
+}
+
+func defaultOptions() *options {
+	return &options{
+		ctx:     context.Background(),
+		logger:  log.NewNopLogger(),
+		timeout: 5 * time.Second,
+		apiURL:  DefaultAPIURL,
+	}
+}
+
+// WithContext sets the context controlling the lifetime of the Collector. Cancelling it aborts all in-flight API requests.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger used by the Collector. By default, the Collector doesn't log anything.
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithTimeout sets the time to wait for Open-Meteo API to respond. Defaults to 5 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithAPIURL sets the URL of the Open-Meteo forecast API. Defaults to DefaultAPIURL.
+func WithAPIURL(apiURL string) Option {
+	return func(o *options) {
+		o.apiURL = apiURL
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to call Open-Meteo API. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
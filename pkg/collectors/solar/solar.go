@@ -0,0 +1,207 @@
+package solar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+)
+
+// variables are the current conditions requested from the API.
+const variables = "shortwave_radiation,direct_radiation,diffuse_radiation,cloud_cover"
+
+// retries is the number of retries of transient Open-Meteo API failures, eg. when it's rate limited.
+const retries = 2
+
+var (
+	errNon200Response      = errors.New("open-Meteo API responded with non-200 code")
+	errFailedParsingURL    = errors.New("failed parsing Open-Meteo API URL")
+	errInvalidLocation     = errors.New("invalid location; expected latitude between -90 and 90 and longitude between -180 and 180")
+	errFailedUnmarshalling = errors.New("failed unmarshalling Open-Meteo API response body")
+	errFailedRequest       = errors.New("failed Open-Meteo API request")
+	errFailedReadingBody   = errors.New("failed reading Open-Meteo API response body")
+	errMissingReadings     = errors.New("open-Meteo API response is missing current conditions")
+)
+
+// Radiation stores the current solar radiation and cloud cover received from Open-Meteo API. Radiation is the mean
+// over the preceding interval of the model, in W/m².
+type Radiation struct {
+	// Shortwave is the global horizontal irradiance, the sum of direct and diffuse radiation.
+	Shortwave  float64 `json:"shortwave_radiation"`
+	Direct     float64 `json:"direct_radiation"`
+	Diffuse    float64 `json:"diffuse_radiation"`
+	CloudCover float64 `json:"cloud_cover"`
+
+	// UpdatedAt is the time the reading was fetched from the API.
+	UpdatedAt time.Time `json:"-"`
+}
+
+// Config provides the configuration necessary to create the Collector.
+// Logger is optional, if it's nil the Collector doesn't log anything.
+//
+// Deprecated: Config is kept for backward compatibility only, use New with Options instead.
+type Config struct {
+	Logger    log.Logger
+	Timeout   int
+	APIURL    string
+	Latitude  float64
+	Longitude float64
+	Transport http.RoundTripper
+}
+
+// Collector implements the Collector interface, collecting solar radiation from Open-Meteo API.
+type Collector struct {
+	ctx     context.Context
+	client  *httpx.Client
+	url     string
+	logger  log.Logger
+	metrics *Metrics
+}
+
+// Metrics contains the metrics collected by the Collector.
+type Metrics struct {
+	up         *prometheus.Desc
+	shortwave  *prometheus.Desc
+	direct     *prometheus.Desc
+	diffuse    *prometheus.Desc
+	cloudCover *prometheus.Desc
+}
+
+// NewFromConfig creates a Collector using the given Config.
+//
+// Deprecated: NewFromConfig is kept for backward compatibility only, use New with Options instead.
+func NewFromConfig(cfg Config) (*Collector, error) {
+	return New(cfg.Latitude, cfg.Longitude, configOptions(cfg)...)
+}
+
+// NewWithContext creates a Collector using the given Config. Cancelling the context aborts all in-flight API requests.
+//
+// Deprecated: NewWithContext is kept for backward compatibility only, use New with WithContext and other Options
+// instead.
+func NewWithContext(ctx context.Context, cfg Config) (*Collector, error) {
+	return New(cfg.Latitude, cfg.Longitude, append(configOptions(cfg), WithContext(ctx))...)
+}
+
+// configOptions returns the Options equivalent to the Config.
+func configOptions(cfg Config) []Option {
+	return []Option{
+		WithLogger(cfg.Logger),
+		WithTimeout(time.Duration(cfg.Timeout) * time.Millisecond),
+		WithAPIURL(cfg.APIURL),
+		WithTransport(cfg.Transport),
+	}
+}
+
+// New creates a Collector for the solar radiation and cloud cover at the location.
+func New(latitude, longitude float64, opts ...Option) (*Collector, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errInvalidLocation
+	}
+
+	rawurl := fmt.Sprintf("%s?latitude=%s&longitude=%s&current=%s", o.apiURL,
+		strconv.FormatFloat(latitude, 'f', -1, 64), strconv.FormatFloat(longitude, 'f', -1, 64), variables)
+	if _, err := url.ParseRequestURI(rawurl); err != nil {
+		return nil, errors.Wrap(errFailedParsingURL, err.Error())
+	}
+
+	client := httpx.New(httpx.Config{
+		Transport:    o.transport,
+		Timeout:      o.timeout,
+		Retries:      retries,
+		Errors:       httpx.Errors{Request: errFailedRequest, ReadingBody: errFailedReadingBody, Non200: errNon200Response},
+		Requests:     "nest_solar_api_requests_total",
+		RequestsHelp: "Open-Meteo API requests by status code, or error if they weren't answered.",
+	})
+
+	collector := &Collector{
+		ctx:     o.ctx,
+		client:  client,
+		url:     rawurl,
+		logger:  o.logger,
+		metrics: buildMetrics(),
+	}
+
+	return collector, nil
+}
+
+func buildMetrics() *Metrics {
+	return &Metrics{
+		up:         prometheus.NewDesc(strings.Join([]string{"nest", "solar", "up"}, "_"), "Was talking to Open-Meteo API successful.", nil, nil),
+		shortwave:  prometheus.NewDesc(strings.Join([]string{"nest", "solar", "shortwave", "radiation", "watts", "per", "square", "meter"}, "_"), "Global horizontal irradiance, the sum of direct and diffuse radiation.", nil, nil),
+		direct:     prometheus.NewDesc(strings.Join([]string{"nest", "solar", "direct", "radiation", "watts", "per", "square", "meter"}, "_"), "Direct solar radiation on the horizontal plane.", nil, nil),
+		diffuse:    prometheus.NewDesc(strings.Join([]string{"nest", "solar", "diffuse", "radiation", "watts", "per", "square", "meter"}, "_"), "Diffuse solar radiation.", nil, nil),
+		cloudCover: prometheus.NewDesc(strings.Join([]string{"nest", "solar", "cloud", "cover", "percent"}, "_"), "Total cloud cover.", nil, nil),
+	}
+}
+
+// Describe implements the prometheus.Describe interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metrics.up
+	ch <- c.metrics.shortwave
+	ch <- c.metrics.direct
+	ch <- c.metrics.diffuse
+	ch <- c.metrics.cloudCover
+	c.client.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	defer c.client.Collect(ch)
+
+	radiation, err := c.getRadiation(c.ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 0)
+		c.logger.Log("level", "error", "message", "Failed collecting Open-Meteo data", "stack", errors.WithStack(err))
+		return
+	}
+
+	c.logger.Log("level", "debug", "message", "Successfully collected Open-Meteo data")
+
+	ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.metrics.shortwave, prometheus.GaugeValue, radiation.Shortwave)
+	ch <- prometheus.MustNewConstMetric(c.metrics.direct, prometheus.GaugeValue, radiation.Direct)
+	ch <- prometheus.MustNewConstMetric(c.metrics.diffuse, prometheus.GaugeValue, radiation.Diffuse)
+	ch <- prometheus.MustNewConstMetric(c.metrics.cloudCover, prometheus.GaugeValue, radiation.CloudCover)
+}
+
+// Radiation returns the current solar radiation and cloud cover for the configured location.
+func (c *Collector) Radiation(ctx context.Context) (*Radiation, error) {
+	return c.getRadiation(ctx)
+}
+
+func (c *Collector) getRadiation(ctx context.Context) (*Radiation, error) {
+	body, err := c.client.Get(ctx, c.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Current *Radiation `json:"current"`
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+	}
+
+	if data.Current == nil {
+		return nil, errMissingReadings
+	}
+
+	data.Current.UpdatedAt = time.Now()
+	return data.Current, nil
+}
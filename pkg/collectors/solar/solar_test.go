@@ -0,0 +1,123 @@
+package solar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pronestheus/test"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRadiation(t *testing.T) {
+	var query string
+	serv := test.SolarServer()
+	c, err := New(52.37, 4.89,
+		WithAPIURL(serv.URL),
+		WithTransport(roundTripper(func(r *http.Request) (*http.Response, error) {
+			query = r.URL.RawQuery
+			return http.DefaultTransport.RoundTrip(r)
+		})),
+	)
+	assert.NoError(t, err)
+
+	radiation, err := c.Radiation(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "latitude=52.37&longitude=4.89&current=shortwave_radiation,direct_radiation,diffuse_radiation,cloud_cover", query)
+
+	assert.WithinDuration(t, time.Now(), radiation.UpdatedAt, time.Minute)
+	radiation.UpdatedAt = time.Time{}
+	assert.Equal(t, &Radiation{Shortwave: 512, Direct: 380, Diffuse: 132, CloudCover: 37}, radiation)
+}
+
+func TestServerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"error response", http.StatusBadRequest, `{"error": true, "reason": "Latitude must be in range of -90 to 90°."}`, errNon200Response},
+		{"invalid JSON response", http.StatusOK, `{"current": [`, errFailedUnmarshalling},
+		{"missing current conditions", http.StatusOK, `{"latitude": 52.36}`, errMissingReadings},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer serv.Close()
+
+			c, err := New(0, 0, WithAPIURL(serv.URL))
+			assert.NoError(t, err)
+
+			radiation, err := c.Radiation(context.Background())
+			assert.Nil(t, radiation)
+			assert.True(t, errors.Is(err, tt.wantErr), "%v", err)
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New(0, 0, WithAPIURL("https/////this.is.not.a.valid.url"))
+	assert.True(t, errors.Is(err, errFailedParsingURL))
+
+	_, err = New(91, 0, WithAPIURL("https://example.com"))
+	assert.True(t, errors.Is(err, errInvalidLocation))
+
+	_, err = New(0, -181, WithAPIURL("https://example.com"))
+	assert.True(t, errors.Is(err, errInvalidLocation))
+}
+
+func TestMetrics(t *testing.T) {
+	c, err := New(0, 0, WithAPIURL(test.SolarServer().URL))
+	assert.NoError(t, err)
+
+	expected := `
+# HELP nest_solar_api_requests_total Open-Meteo API requests by status code, or error if they weren't answered.
+# TYPE nest_solar_api_requests_total counter
+nest_solar_api_requests_total{code="200"} 1
+# HELP nest_solar_cloud_cover_percent Total cloud cover.
+# TYPE nest_solar_cloud_cover_percent gauge
+nest_solar_cloud_cover_percent 37
+# HELP nest_solar_diffuse_radiation_watts_per_square_meter Diffuse solar radiation.
+# TYPE nest_solar_diffuse_radiation_watts_per_square_meter gauge
+nest_solar_diffuse_radiation_watts_per_square_meter 132
+# HELP nest_solar_direct_radiation_watts_per_square_meter Direct solar radiation on the horizontal plane.
+# TYPE nest_solar_direct_radiation_watts_per_square_meter gauge
+nest_solar_direct_radiation_watts_per_square_meter 380
+# HELP nest_solar_shortwave_radiation_watts_per_square_meter Global horizontal irradiance, the sum of direct and diffuse radiation.
+# TYPE nest_solar_shortwave_radiation_watts_per_square_meter gauge
+nest_solar_shortwave_radiation_watts_per_square_meter 512
+# HELP nest_solar_up Was talking to Open-Meteo API successful.
+# TYPE nest_solar_up gauge
+nest_solar_up 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	c, err = New(0, 0, WithAPIURL(test.WeatherServerInvalidToken().URL))
+	assert.NoError(t, err)
+
+	expected = `
+# HELP nest_solar_api_requests_total Open-Meteo API requests by status code, or error if they weren't answered.
+# TYPE nest_solar_api_requests_total counter
+nest_solar_api_requests_total{code="401"} 1
+# HELP nest_solar_up Was talking to Open-Meteo API successful.
+# TYPE nest_solar_up gauge
+nest_solar_up 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+type roundTripper func(r *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
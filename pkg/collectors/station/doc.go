@@ -0,0 +1,21 @@
+// Package station implements a Prometheus collector for readings uploaded by a personal weather station, as
+// hyper-local alternative to the OpenWeatherMap collector.
+//
+// Ecowitt and Ambient Weather stations can upload their readings to a custom server every few seconds to minutes,
+// in the protocol of their own cloud services: Ecowitt stations POST a form, Ambient Weather stations send the same
+// fields in the query of a GET request. The Collector serves the uploads on Path and exports the latest readings,
+// converted from imperial units. Outdoor readings are passed to weather listeners like the readings of the
+// OpenWeatherMap collector.
+//
+// The Collector is both an http.Handler and a prometheus.Collector:
+//
+//	collector, err := station.New(station.Config{Unit: "celsius"})
+//	if err != nil {
+//		return err
+//	}
+//
+//	http.Handle(station.Path, collector)
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+package station
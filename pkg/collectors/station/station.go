@@ -0,0 +1,220 @@
+package station
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+// Path is the path receiving uploads, the default path of customized uploads of Ecowitt stations.
+const Path = "/data/report/"
+
+// maxAge is the age after which the latest upload is too old to be exported. Stations upload at least every few
+// minutes.
+const maxAge = 10 * time.Minute
+
+// Conversions from the imperial units of uploads.
+const (
+	hectopascalPerInHg   = 33.8639
+	metersPerSecondByMph = 0.44704
+	millimetersPerInch   = 25.4
+)
+
+var (
+	errMissingReading = errors.New("upload doesn't contain the outdoor temperature")
+	errInvalidPasskey = errors.New("upload of unknown station")
+)
+
+// readings are the exported readings of uploads besides the temperature, by field, with the conversion from the
+// imperial unit of the field. Ambient Weather stations upload the rain rate as hourlyrainin.
+var readings = []struct {
+	fields  []string
+	name    string
+	help    string
+	convert float64
+}{
+	{[]string{"humidity"}, "humidity_percent", "Outside humidity measured by the weather station.", 1},
+	{[]string{"baromrelin"}, "pressure_hectopascal", "Relative pressure measured by the weather station.", hectopascalPerInHg},
+	{[]string{"windspeedmph"}, "wind_speed_meters_per_second", "Wind speed measured by the weather station.", metersPerSecondByMph},
+	{[]string{"windgustmph"}, "wind_gust_meters_per_second", "Wind gust speed measured by the weather station.", metersPerSecondByMph},
+	{[]string{"winddir"}, "wind_direction_degrees", "Wind direction measured by the weather station.", 1},
+	{[]string{"rainratein", "hourlyrainin"}, "rain_rate_millimeters_per_hour", "Rain rate measured by the weather station.", millimetersPerInch},
+	{[]string{"dailyrainin"}, "rain_daily_millimeters", "Rain since midnight measured by the weather station.", millimetersPerInch},
+	{[]string{"solarradiation"}, "solar_radiation_watts_per_square_meter", "Solar radiation measured by the weather station.", 1},
+	{[]string{"uv"}, "uv_index", "UV index measured by the weather station.", 1},
+}
+
+// Config provides the configuration necessary to create the Collector. Logger is optional, if it's nil the Collector
+// doesn't log anything. Unit is the temperature unit of metrics: celsius (default), fahrenheit, kelvin or both. If Passkey is
+// set, only uploads with this PASSKEY (Ecowitt) or MAC (Ambient Weather) are accepted.
+type Config struct {
+	Logger    log.Logger
+	Unit      string
+	Passkey   string
+	Listeners []weather.Listener
+}
+
+// Collector receives uploads of a weather station and exports the latest readings.
+type Collector struct {
+	logger    log.Logger
+	units     []string
+	passkey   string
+	listeners []weather.Listener
+	now       func() time.Time
+
+	mu       sync.Mutex
+	upload   map[string]float64
+	uploaded time.Time
+
+	up         *prometheus.Desc
+	lastUpload *prometheus.Desc
+	temp       map[string]*prometheus.Desc
+	readings   map[string]*prometheus.Desc
+}
+
+// New creates a Collector using the given Config.
+func New(cfg Config) (*Collector, error) {
+	exported, err := units.Parse(cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	c := &Collector{
+		logger:     cfg.Logger,
+		units:      exported,
+		passkey:    cfg.Passkey,
+		listeners:  cfg.Listeners,
+		now:        time.Now,
+		up:         prometheus.NewDesc(strings.Join([]string{"nest", "station", "up"}, "_"), "Did the weather station upload readings recently.", nil, nil),
+		lastUpload: prometheus.NewDesc(strings.Join([]string{"nest", "station", "last", "upload", "timestamp", "seconds"}, "_"), "Time of the latest upload of the weather station.", nil, nil),
+		temp:       make(map[string]*prometheus.Desc),
+		readings:   make(map[string]*prometheus.Desc),
+	}
+
+	for _, unit := range exported {
+		c.temp[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "station", "temperature", unit}, "_"), "Outside temperature measured by the weather station.", nil, nil)
+	}
+	for _, r := range readings {
+		c.readings[r.name] = prometheus.NewDesc(strings.Join([]string{"nest", "station", r.name}, "_"), r.help, nil, nil)
+	}
+
+	return c, nil
+}
+
+// ServeHTTP implements the http.Handler interface, receiving uploads in the query or a form.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.receive(r); err != nil {
+		c.logger.Log("level", "warn", "message", "Rejected weather station upload", "stack", errors.WithStack(err))
+		code := http.StatusBadRequest
+		if errors.Is(err, errInvalidPasskey) {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.Write([]byte("OK"))
+}
+
+// receive stores the readings of the upload and passes the outdoor readings to the listeners.
+func (c *Collector) receive(r *http.Request) error {
+	if c.passkey != "" && r.Form.Get("PASSKEY") != c.passkey && r.Form.Get("MAC") != c.passkey {
+		return errInvalidPasskey
+	}
+
+	tempF, err := strconv.ParseFloat(r.Form.Get("tempf"), 64)
+	if err != nil {
+		return errMissingReading
+	}
+
+	upload := map[string]float64{"temp": units.ToCelsius(tempF, units.Fahrenheit)}
+	for _, reading := range readings {
+		for _, field := range reading.fields {
+			if value, err := strconv.ParseFloat(r.Form.Get(field), 64); err == nil {
+				upload[reading.name] = value * reading.convert
+				break
+			}
+		}
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	c.upload, c.uploaded = upload, now
+	c.mu.Unlock()
+
+	w := &weather.Weather{
+		Temperature: upload["temp"],
+		Humidity:    upload["humidity_percent"],
+		Pressure:    upload["pressure_hectopascal"],
+		Unit:        units.Celsius,
+		UpdatedAt:   now,
+	}
+	for _, listener := range c.listeners {
+		listener(w)
+	}
+
+	return nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.lastUpload
+	for _, unit := range c.units {
+		ch <- c.temp[unit]
+	}
+	for _, r := range readings {
+		ch <- c.readings[r.name]
+	}
+}
+
+// Collect implements the prometheus.Collector interface. Readings are only exported if the station uploaded them
+// recently.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.uploaded.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastUpload, prometheus.GaugeValue, float64(c.uploaded.UnixNano())/1e9)
+	}
+
+	if c.upload == nil || c.now().Sub(c.uploaded) > maxAge {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	for _, unit := range c.units {
+		ch <- prometheus.MustNewConstMetric(c.temp[unit], prometheus.GaugeValue, units.FromCelsius(c.upload["temp"], unit))
+	}
+
+	for _, r := range readings {
+		if value, ok := c.upload[r.name]; ok {
+			ch <- prometheus.MustNewConstMetric(c.readings[r.name], prometheus.GaugeValue, value)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package station
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/weather"
+)
+
+// ecowittUpload is the form of an upload of an Ecowitt GW1000 gateway.
+const ecowittUpload = "PASSKEY=ABCDEF0123456789&stationtype=GW1000B_V1.6.8&dateutc=2021-03-01+10:00:00&tempinf=71.2&humidityin=42&baromrelin=29.920&baromabsin=29.801&tempf=50.0&humidity=81&winddir=225&windspeedmph=6.9&windgustmph=10.3&maxdailygust=15.0&rainratein=0.040&eventrainin=0.091&hourlyrainin=0.020&dailyrainin=0.091&weeklyrainin=0.512&monthlyrainin=0.512&yearlyrainin=3.217&totalrainin=3.217&solarradiation=120.45&uv=1&wh65batt=0&freq=868M&model=GW1000_Pro"
+
+// value returns the value of the nest_station_NAME metric.
+func value(c *Collector, name string) float64 {
+	ch := make(chan prometheus.Metric, 20)
+	c.Collect(ch)
+	close(ch)
+
+	for metric := range ch {
+		if strings.Contains(metric.Desc().String(), `"nest_station_`+name+`"`) {
+			var m dto.Metric
+			metric.Write(&m)
+			return m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestEcowittUpload(t *testing.T) {
+	var received *weather.Weather
+	c, err := New(Config{Unit: "both", Passkey: "ABCDEF0123456789", Listeners: []weather.Listener{func(w *weather.Weather) { received = w }}})
+	assert.NoError(t, err)
+
+	at := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return at }
+
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(ecowittUpload))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	pressure := 29.92
+	assert.Equal(t, &weather.Weather{Temperature: 10, Humidity: 81, Pressure: pressure * hectopascalPerInHg, Unit: "celsius", UpdatedAt: at}, received, "outdoor readings are passed to listeners in Celsius")
+
+	expected := `
+# HELP nest_station_humidity_percent Outside humidity measured by the weather station.
+# TYPE nest_station_humidity_percent gauge
+nest_station_humidity_percent 81
+# HELP nest_station_last_upload_timestamp_seconds Time of the latest upload of the weather station.
+# TYPE nest_station_last_upload_timestamp_seconds gauge
+nest_station_last_upload_timestamp_seconds 1.6145928e+09
+# HELP nest_station_rain_daily_millimeters Rain since midnight measured by the weather station.
+# TYPE nest_station_rain_daily_millimeters gauge
+nest_station_rain_daily_millimeters 2.3114
+# HELP nest_station_rain_rate_millimeters_per_hour Rain rate measured by the weather station.
+# TYPE nest_station_rain_rate_millimeters_per_hour gauge
+nest_station_rain_rate_millimeters_per_hour 1.016
+# HELP nest_station_solar_radiation_watts_per_square_meter Solar radiation measured by the weather station.
+# TYPE nest_station_solar_radiation_watts_per_square_meter gauge
+nest_station_solar_radiation_watts_per_square_meter 120.45
+# HELP nest_station_temperature_celsius Outside temperature measured by the weather station.
+# TYPE nest_station_temperature_celsius gauge
+nest_station_temperature_celsius 10
+# HELP nest_station_temperature_fahrenheit Outside temperature measured by the weather station.
+# TYPE nest_station_temperature_fahrenheit gauge
+nest_station_temperature_fahrenheit 50
+# HELP nest_station_up Did the weather station upload readings recently.
+# TYPE nest_station_up gauge
+nest_station_up 1
+# HELP nest_station_uv_index UV index measured by the weather station.
+# TYPE nest_station_uv_index gauge
+nest_station_uv_index 1
+# HELP nest_station_wind_direction_degrees Wind direction measured by the weather station.
+# TYPE nest_station_wind_direction_degrees gauge
+nest_station_wind_direction_degrees 225
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"nest_station_humidity_percent", "nest_station_last_upload_timestamp_seconds", "nest_station_rain_daily_millimeters",
+		"nest_station_rain_rate_millimeters_per_hour", "nest_station_solar_radiation_watts_per_square_meter",
+		"nest_station_temperature_celsius", "nest_station_temperature_fahrenheit", "nest_station_up",
+		"nest_station_uv_index", "nest_station_wind_direction_degrees"))
+
+	// Imperial readings are converted.
+	assert.InDelta(t, 3.0846, value(c, "wind_speed_meters_per_second"), 0.0001)
+	assert.InDelta(t, 1013.25, value(c, "pressure_hectopascal"), 0.1)
+
+	// Readings of a station which stopped uploading aren't exported.
+	c.now = func() time.Time { return at.Add(maxAge + time.Minute) }
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP nest_station_up Did the weather station upload readings recently.
+# TYPE nest_station_up gauge
+nest_station_up 0
+`), "nest_station_up", "nest_station_temperature_celsius"))
+}
+
+func TestAmbientWeatherUpload(t *testing.T) {
+	c, err := New(Config{})
+	assert.NoError(t, err)
+
+	query := url.Values{"MAC": {"00:11:22:33:44:55"}, "tempf": {"68"}, "humidity": {"40"}, "hourlyrainin": {"0.1"}}
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, Path+"?"+query.Encode(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, 20.0, value(c, "temperature_celsius"))
+	assert.InDelta(t, 2.54, value(c, "rain_rate_millimeters_per_hour"), 0.0001, "the hourly rain is the rate")
+}
+
+func TestRejectedUploads(t *testing.T) {
+	c, err := New(Config{Passkey: "ABCDEF0123456789"})
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		method string
+		query  string
+		code   int
+	}{
+		{http.MethodGet, "PASSKEY=0000&tempf=50", http.StatusForbidden},
+		{http.MethodGet, "PASSKEY=ABCDEF0123456789&humidity=50", http.StatusBadRequest},
+		{http.MethodDelete, "PASSKEY=ABCDEF0123456789&tempf=50", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, httptest.NewRequest(tc.method, Path+"?"+tc.query, nil))
+		assert.Equal(t, tc.code, w.Code, tc.query)
+	}
+
+	assert.Equal(t, 1, testutil.CollectAndCount(c), "only nest_station_up is exported without uploads")
+}
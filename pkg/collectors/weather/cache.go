@@ -0,0 +1,69 @@
+package weather
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cachedResponse is the body of a successful API response, with the validators needed to revalidate it.
+type cachedResponse struct {
+	body         []byte
+	etag         string
+	lastModified string
+	expires      time.Time
+}
+
+// cached returns the cached response of the URL, or nil if there isn't one.
+func (c *Collector) cached(rawurl string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache[rawurl]
+}
+
+// store caches the response of the URL if it can be reused, either because it's still fresh or because it can be
+// revalidated with a conditional request.
+func (c *Collector) store(rawurl string, header http.Header, body []byte) {
+	res := &cachedResponse{
+		body:         body,
+		etag:         header.Get("ETag"),
+		lastModified: header.Get("Last-Modified"),
+		expires:      c.now().Add(maxAge(header)),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if res.etag == "" && res.lastModified == "" && !res.expires.After(c.now()) {
+		delete(c.cache, rawurl)
+		return
+	}
+	c.cache[rawurl] = res
+}
+
+// hit counts an API request answered from the cache.
+func (c *Collector) hit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheHits++
+}
+
+// maxAge returns how long a response stays fresh according to its Cache-Control header. Responses which must be
+// revalidated are never fresh.
+func maxAge(header http.Header) time.Duration {
+	var age time.Duration
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds > 0 {
+				age = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return age
+}
@@ -0,0 +1,18 @@
+// Package weather implements a Prometheus collector for the current weather conditions reported by OpenWeatherMap API,
+// failing over to further API keys or Open-Meteo API if it fails.
+//
+// The collector doesn't depend on any global state, so it can be embedded in any Go program and registered in its own
+// Prometheus registry:
+//
+//	collector, err := weather.New(token, "2759794",
+//		weather.WithTimeout(5*time.Second),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	registry := prometheus.NewRegistry()
+//	registry.MustRegister(collector)
+//
+// Readings can also be fetched directly, without going through Prometheus, using Collector.Weather.
+package weather
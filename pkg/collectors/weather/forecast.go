@@ -0,0 +1,106 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/units"
+)
+
+// maxForecastHours is the furthest horizon of the 5 day / 3 hour forecast of OpenWeatherMap API.
+const maxForecastHours = 120
+
+// Forecast is the forecast weather at a horizon.
+type Forecast struct {
+	HoursAhead  int
+	Temperature float64
+
+	// Unit is the unit of Temperature, celsius or fahrenheit.
+	Unit string
+}
+
+// forecastEntry is a single step of the forecast returned by the API.
+type forecastEntry struct {
+	Time int64 `json:"dt"`
+	Main struct {
+		Temp float64 `json:"temp"`
+	} `json:"main"`
+}
+
+// Forecast returns the forecast weather at the configured horizons. Horizons beyond the last step of the forecast
+// are left out.
+func (c *Collector) Forecast(ctx context.Context) ([]*Forecast, error) {
+	return c.getForecast(ctx)
+}
+
+func (c *Collector) collectForecast(ch chan<- prometheus.Metric) {
+	forecasts, err := c.getForecast(c.ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics.forecastUp, prometheus.GaugeValue, 0)
+		c.logger.Log("level", "error", "message", "Failed collecting OpenWeatherMap forecast", "stack", errors.WithStack(err))
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.metrics.forecastUp, prometheus.GaugeValue, 1)
+	for _, forecast := range forecasts {
+		for _, unit := range c.units {
+			ch <- prometheus.MustNewConstMetric(c.metrics.forecastTemp[unit], prometheus.GaugeValue, units.Convert(forecast.Temperature, c.apiUnit, unit), strconv.Itoa(forecast.HoursAhead))
+		}
+	}
+}
+
+func (c *Collector) getForecast(ctx context.Context) ([]*Forecast, error) {
+	var body []byte
+	err := c.failover(ctx, true, func(p *provider) (err error) {
+		body, err = c.get(ctx, p.client, p.forecastURL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		List []forecastEntry `json:"list"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+	}
+
+	entries := data.List
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time < entries[j].Time })
+
+	now := c.now()
+	var forecasts []*Forecast
+	for _, hours := range c.forecastHours {
+		temp, ok := interpolate(entries, now.Add(time.Duration(hours)*time.Hour).Unix())
+		if !ok {
+			continue
+		}
+		forecasts = append(forecasts, &Forecast{HoursAhead: hours, Temperature: temp, Unit: c.apiUnit})
+	}
+
+	return forecasts, nil
+}
+
+// interpolate returns the temperature at the time, interpolated linearly between the surrounding steps of the
+// forecast. Times before the first step get its temperature, since the first step is at most 3 hours ahead.
+func interpolate(entries []forecastEntry, t int64) (float64, bool) {
+	if len(entries) == 0 || t > entries[len(entries)-1].Time {
+		return 0, false
+	}
+
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].Time >= t })
+	if i == 0 || entries[i].Time == t {
+		return entries[i].Main.Temp, true
+	}
+
+	prev, next := entries[i-1], entries[i]
+	ratio := float64(t-prev.Time) / float64(next.Time-prev.Time)
+	return prev.Main.Temp + ratio*(next.Main.Temp-prev.Main.Temp), true
+}
@@ -0,0 +1,136 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"pronestheus/pkg/units"
+)
+
+// DefaultAPIURL is the URL of the OpenWeatherMap current weather API.
+const DefaultAPIURL = "http://api.openweathermap.org/data/2.5/weather"
+
+// DefaultForecastURL is the URL of the OpenWeatherMap 5 day / 3 hour forecast API.
+const DefaultForecastURL = "http://api.openweathermap.org/data/2.5/forecast"
+
+// DefaultOpenMeteoURL is the URL of the Open-Meteo forecast API, which serves the current weather as well.
+const DefaultOpenMeteoURL = "https://api.open-meteo.com/v1/forecast"
+
+// Option configures the Collector created by New.
+type Option func(*options)
+
+type options struct {
+	ctx            context.Context
+	logger         log.Logger
+	timeout        time.Duration
+	unit           string
+	apiURL         string
+	forecastURL    string
+	forecastHours  []int
+	transport      http.RoundTripper
+	listeners      []Listener
+	fallbackTokens []string
+	fallbackURL    string
+	latitude       float64
+	longitude      float64
+}
+
+func defaultOptions() *options {
+	return &options{
+		ctx:         context.Background(),
+		logger:      log.NewNopLogger(),
+		timeout:     5 * time.Second,
+		unit:        units.Celsius,
+		apiURL:      DefaultAPIURL,
+		forecastURL: DefaultForecastURL,
+	}
+}
+
+// WithContext sets the context controlling the lifetime of the Collector. Cancelling it aborts all in-flight API requests.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger used by the Collector. By default, the Collector doesn't log anything.
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithTimeout sets the time to wait for each weather API to respond. Defaults to 5 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithUnit sets the unit of exported temperatures. Valid values are "celsius" (default), "fahrenheit", "kelvin" and
+// "both", which exports Celsius and Fahrenheit.
+func WithUnit(unit string) Option {
+	return func(o *options) {
+		o.unit = unit
+	}
+}
+
+// WithAPIURL sets the URL of the OpenWeatherMap current weather API. Defaults to DefaultAPIURL.
+func WithAPIURL(apiURL string) Option {
+	return func(o *options) {
+		o.apiURL = apiURL
+	}
+}
+
+// WithForecast exports the forecast temperature the given hours ahead, up to 120. The forecast is fetched from
+// DefaultForecastURL, unless WithForecastURL is used.
+func WithForecast(hours ...int) Option {
+	return func(o *options) {
+		o.forecastHours = append(o.forecastHours, hours...)
+	}
+}
+
+// WithForecastURL sets the URL of the OpenWeatherMap forecast API. Defaults to DefaultForecastURL.
+func WithForecastURL(forecastURL string) Option {
+	return func(o *options) {
+		o.forecastURL = forecastURL
+	}
+}
+
+// WithTransport sets the http.RoundTripper used to call the weather APIs. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithListener registers a listener notified with the current weather whenever it's fetched. Can be used multiple
+// times to register several listeners.
+func WithListener(listener Listener) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, listener)
+	}
+}
+
+// WithFallbackTokens sets OpenWeatherMap API keys tried in order if fetching the weather fails with the previous ones,
+// eg. because their quota is exhausted.
+func WithFallbackTokens(tokens ...string) Option {
+	return func(o *options) {
+		o.fallbackTokens = append(o.fallbackTokens, tokens...)
+	}
+}
+
+// WithOpenMeteoFallback fetches the weather of the location from Open-Meteo API at apiURL, eg. DefaultOpenMeteoURL,
+// if all OpenWeatherMap API keys fail. Open-Meteo doesn't require an API key.
+func WithOpenMeteoFallback(apiURL string, latitude, longitude float64) Option {
+	return func(o *options) {
+		o.fallbackURL = apiURL
+		o.latitude = latitude
+		o.longitude = longitude
+	}
+}
@@ -0,0 +1,211 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/internal/httpx"
+	"pronestheus/pkg/units"
+)
+
+// Provider names, exported as the provider label. Fallback OpenWeatherMap API keys are numbered from 2, eg.
+// openweathermap-2.
+const (
+	providerOpenWeatherMap = "openweathermap"
+	providerOpenMeteo      = "open-meteo"
+)
+
+// failoverCooldown is how long a failed provider is skipped, while the next one serves the readings. Afterwards the
+// provider is tried again, so the primary provider takes over once it recovers, eg. when its quota resets.
+const failoverCooldown = 5 * time.Minute
+
+// openMeteoVariables are the current conditions requested from Open-Meteo API.
+const openMeteoVariables = "temperature_2m,relative_humidity_2m,pressure_msl"
+
+var (
+	errInvalidLocation      = errors.New("invalid fallback location; expected latitude between -90 and 90 and longitude between -180 and 180")
+	errOpenMeteoNon200      = errors.New("open-Meteo API responded with non-200 code")
+	errOpenMeteoRequest     = errors.New("failed Open-Meteo API request")
+	errOpenMeteoReadingBody = errors.New("failed reading Open-Meteo API response body")
+	errOpenMeteoMissing     = errors.New("open-Meteo API response is missing current conditions")
+)
+
+// provider is an API serving the current weather. Providers are tried in order until one of them succeeds.
+type provider struct {
+	name   string
+	client *httpx.Client
+	url    string
+	// forecastURL is empty if the provider doesn't serve the forecast.
+	forecastURL string
+	parse       func(body []byte) (*Weather, error)
+
+	// failedUntil is the end of the cooldown after the provider failed.
+	failedUntil time.Time
+	failures    float64
+}
+
+// buildProviders returns the providers of the options: OpenWeatherMap with the API token and each fallback token, and
+// Open-Meteo if the fallback URL is set.
+func (o *options) buildProviders(apiToken string, client *httpx.Client, query func(token string) string) ([]*provider, error) {
+	tokens := append([]string{apiToken}, o.fallbackTokens...)
+
+	var providers []*provider
+	for i, token := range tokens {
+		p := &provider{
+			name:   providerOpenWeatherMap,
+			client: client,
+			url:    o.apiURL + query(token),
+			parse:  parseOpenWeatherMap,
+		}
+		if i > 0 {
+			p.name = fmt.Sprintf("%s-%d", providerOpenWeatherMap, i+1)
+		}
+		if _, err := url.ParseRequestURI(p.url); err != nil {
+			return nil, errors.Wrap(errFailedParsingURL, err.Error())
+		}
+
+		if len(o.forecastHours) > 0 {
+			p.forecastURL = o.forecastURL + query(token)
+			if _, err := url.ParseRequestURI(p.forecastURL); err != nil {
+				return nil, errors.Wrap(errFailedParsingURL, err.Error())
+			}
+		}
+
+		providers = append(providers, p)
+	}
+
+	if o.fallbackURL == "" {
+		return providers, nil
+	}
+
+	if o.latitude < -90 || o.latitude > 90 || o.longitude < -180 || o.longitude > 180 {
+		return nil, errInvalidLocation
+	}
+
+	rawurl := fmt.Sprintf("%s?latitude=%s&longitude=%s&current=%s", o.fallbackURL,
+		strconv.FormatFloat(o.latitude, 'f', -1, 64), strconv.FormatFloat(o.longitude, 'f', -1, 64), openMeteoVariables)
+	if o.unit == units.Fahrenheit {
+		rawurl += "&temperature_unit=fahrenheit"
+	}
+	if _, err := url.ParseRequestURI(rawurl); err != nil {
+		return nil, errors.Wrap(errFailedParsingURL, err.Error())
+	}
+
+	// Open-Meteo requests aren't counted with the OpenWeatherMap ones, and their errors name Open-Meteo.
+	openMeteo := httpx.New(httpx.Config{
+		Transport: o.transport,
+		Timeout:   o.timeout,
+		Retries:   retries,
+		Errors:    httpx.Errors{Request: errOpenMeteoRequest, ReadingBody: errOpenMeteoReadingBody, Non200: errOpenMeteoNon200},
+	})
+
+	return append(providers, &provider{
+		name:   providerOpenMeteo,
+		client: openMeteo,
+		url:    rawurl,
+		parse:  parseOpenMeteo,
+	}), nil
+}
+
+// parseOpenWeatherMap returns the readings of an OpenWeatherMap current weather response.
+func parseOpenWeatherMap(body []byte) (*Weather, error) {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+	}
+
+	var weather *Weather
+	if err := json.Unmarshal(data["main"], &weather); err != nil {
+		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+	}
+	return weather, nil
+}
+
+// parseOpenMeteo returns the readings of an Open-Meteo forecast response with current conditions.
+func parseOpenMeteo(body []byte) (*Weather, error) {
+	var data struct {
+		Current *struct {
+			Temperature float64 `json:"temperature_2m"`
+			Humidity    float64 `json:"relative_humidity_2m"`
+			Pressure    float64 `json:"pressure_msl"`
+		} `json:"current"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+	}
+
+	if data.Current == nil {
+		return nil, errOpenMeteoMissing
+	}
+	return &Weather{Temperature: data.Current.Temperature, Humidity: data.Current.Humidity, Pressure: data.Current.Pressure}, nil
+}
+
+// failover calls fn with each provider in turn until it succeeds, and returns the error of the last one otherwise.
+// Providers cooling down after a failure are tried last, so a provider whose quota is exhausted isn't hammered. If
+// forecast is true, only providers serving the forecast are tried.
+func (c *Collector) failover(ctx context.Context, forecast bool, fn func(p *provider) error) error {
+	var err error
+	for _, p := range c.order() {
+		if forecast && p.forecastURL == "" {
+			continue
+		}
+
+		if err = fn(p); err == nil {
+			c.mu.Lock()
+			p.failedUntil = time.Time{}
+			c.mu.Unlock()
+			return nil
+		}
+
+		c.mu.Lock()
+		p.failedUntil = c.now().Add(failoverCooldown)
+		p.failures++
+		c.mu.Unlock()
+
+		if len(c.providers) > 1 {
+			c.logger.Log("level", "warn", "message", "Failed fetching weather from the provider, failing over to the next one", "provider", p.name, "stack", errors.WithStack(err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+// order returns the providers in the configured order, with the ones cooling down after a failure moved last.
+func (c *Collector) order() []*provider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var available, cooling []*provider
+	for _, p := range c.providers {
+		if now.Before(p.failedUntil) {
+			cooling = append(cooling, p)
+		} else {
+			available = append(available, p)
+		}
+	}
+	return append(available, cooling...)
+}
+
+func (c *Collector) collectProviders(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range c.providers {
+		var active float64
+		if p == c.served {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics.providerActive, prometheus.GaugeValue, active, p.name)
+		ch <- prometheus.MustNewConstMetric(c.metrics.providerFailures, prometheus.CounterValue, p.failures, p.name)
+	}
+}
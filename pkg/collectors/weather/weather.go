@@ -1,32 +1,33 @@
 package weather
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
-)
 
-const (
-	celsius    string = "celsius"
-	fahrenheit string = "fahrenheit"
+	"pronestheus/pkg/collectors/internal/httpx"
+	"pronestheus/pkg/units"
 )
 
+// retries is the number of retries of transient OpenWeatherMap API failures, eg. when it's rate limited.
+const retries = 2
+
 var (
 	errNon200Response      = errors.New("openWeatherMap API responded with non-200 code")
 	errFailedParsingURL    = errors.New("failed parsing OpenWeatherMap API URL")
-	errInvalidTempUnit     = errors.New("invalid temperature unit; valid values: [celsius, fahrenheit]")
 	errFailedUnmarshalling = errors.New("failed unmarshalling OpenWeatherMap API response body")
 	errFailedRequest       = errors.New("failed OpenWeatherMap API request")
 	errFailedReadingBody   = errors.New("failed reading OpenWeatherMap API response body")
+	errInvalidForecastHour = errors.New("invalid forecast horizon; expected hours ahead between 1 and 120")
 )
 
 // Weather stores weather data received from OpenWeatherMap API.
@@ -34,9 +35,27 @@ type Weather struct {
 	Temperature float64 `json:"temp"`
 	Humidity    float64 `json:"humidity"`
 	Pressure    float64 `json:"pressure"`
+
+	// Unit is the unit of Temperature, celsius or fahrenheit.
+	Unit string `json:"-"`
+	// Provider is the name of the provider which served the readings, eg. openweathermap.
+	Provider string `json:"-"`
+	// UpdatedAt is the time the reading was fetched from the API.
+	UpdatedAt time.Time `json:"-"`
 }
 
+// Listener is notified with the current weather whenever it's fetched from the API.
+// Listeners are called synchronously, so they should return quickly and must not modify the readings.
+type Listener func(weather *Weather)
+
 // Config provides the configuration necessary to create the Collector.
+// Logger is optional, if it's nil the Collector doesn't log anything. Forecasts are only fetched from ForecastURL if
+// ForecastHours contains the horizons to export, in hours ahead.
+//
+// If fetching the weather fails with the APIToken, eg. because its quota is exhausted, the FallbackTokens are tried in
+// order, and then Open-Meteo API at FallbackURL for the Latitude and Longitude, if FallbackURL is set.
+//
+// Deprecated: Config is kept for backward compatibility only, use New with Options instead.
 type Config struct {
 	Logger        log.Logger
 	Timeout       int
@@ -44,79 +63,206 @@ type Config struct {
 	APIURL        string
 	APIToken      string
 	APILocationID string
+	ForecastURL   string
+	ForecastHours []int
+	Transport     http.RoundTripper
+	Listeners     []Listener
+
+	FallbackTokens []string
+	FallbackURL    string
+	Latitude       float64
+	Longitude      float64
 }
 
 // Collector implements the Collector interface, collecting weather data from OpenWeatherMap API.
 type Collector struct {
-	client  *http.Client
-	url     string
+	ctx     context.Context
+	client  *httpx.Client
 	logger  log.Logger
+	apiUnit string
+	units   []string
 	metrics *Metrics
+
+	forecast      bool
+	forecastHours []int
+	now           func() time.Time
+
+	listeners []Listener
+
+	mu        sync.Mutex
+	providers []*provider
+	served    *provider
+	cache     map[string]*cachedResponse
+	cacheHits float64
 }
 
 // Metrics contains the metrics collected by the Collector.
 type Metrics struct {
 	up       *prometheus.Desc
-	temp     *prometheus.Desc
+	temp     map[string]*prometheus.Desc
 	humidity *prometheus.Desc
 	pressure *prometheus.Desc
+
+	forecastUp   *prometheus.Desc
+	forecastTemp map[string]*prometheus.Desc
+
+	cacheHits *prometheus.Desc
+
+	providerActive   *prometheus.Desc
+	providerFailures *prometheus.Desc
 }
 
-// New creates a Collector using the given Config.
-func New(cfg Config) (*Collector, error) {
-	var units string
-	switch cfg.Unit {
-	case "", celsius:
-		units = "metric"
-	case fahrenheit:
-		units = "imperial"
-	default:
-		return nil, errInvalidTempUnit
+// NewFromConfig creates a Collector using the given Config.
+//
+// Deprecated: NewFromConfig is kept for backward compatibility only, use New with Options instead.
+func NewFromConfig(cfg Config) (*Collector, error) {
+	return New(cfg.APIToken, cfg.APILocationID, configOptions(cfg)...)
+}
+
+// NewWithContext creates a Collector using the given Config. Cancelling the context aborts all in-flight API requests.
+//
+// Deprecated: NewWithContext is kept for backward compatibility only, use New with WithContext and other Options
+// instead.
+func NewWithContext(ctx context.Context, cfg Config) (*Collector, error) {
+	return New(cfg.APIToken, cfg.APILocationID, append(configOptions(cfg), WithContext(ctx))...)
+}
+
+// configOptions returns the Options equivalent to the Config.
+func configOptions(cfg Config) []Option {
+	opts := []Option{
+		WithLogger(cfg.Logger),
+		WithTimeout(time.Duration(cfg.Timeout) * time.Millisecond),
+		WithUnit(cfg.Unit),
+		WithAPIURL(cfg.APIURL),
+		WithForecastURL(cfg.ForecastURL),
+		WithForecast(cfg.ForecastHours...),
+		WithTransport(cfg.Transport),
+		WithFallbackTokens(cfg.FallbackTokens...),
 	}
 
-	rawurl := fmt.Sprintf("%s?id=%s&appid=%s&units=%s", cfg.APIURL, cfg.APILocationID, cfg.APIToken, units)
-	if _, err := url.ParseRequestURI(rawurl); err != nil {
-		return nil, errors.Wrap(errFailedParsingURL, err.Error())
+	for _, listener := range cfg.Listeners {
+		opts = append(opts, WithListener(listener))
 	}
 
-	client := &http.Client{
-		Timeout: time.Duration(cfg.Timeout) * time.Millisecond,
+	if cfg.FallbackURL != "" {
+		opts = append(opts, WithOpenMeteoFallback(cfg.FallbackURL, cfg.Latitude, cfg.Longitude))
+	}
+
+	return opts
+}
+
+// New creates a Collector for the weather at the OpenWeatherMap location ID, fetched with the API key.
+func New(apiToken, locationID string, opts ...Option) (*Collector, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	exported, err := units.Parse(o.unit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Temperature is requested in Celsius and converted to the exported units, unless only Fahrenheit is exported.
+	system, apiUnit := "metric", units.Celsius
+	if o.unit == units.Fahrenheit {
+		system, apiUnit = "imperial", units.Fahrenheit
+	}
+
+	for _, hours := range o.forecastHours {
+		if hours < 1 || hours > maxForecastHours {
+			return nil, errors.Wrap(errInvalidForecastHour, strconv.Itoa(hours))
+		}
+	}
+
+	client := httpx.New(httpx.Config{
+		Transport:    o.transport,
+		Timeout:      o.timeout,
+		Retries:      retries,
+		Errors:       httpx.Errors{Request: errFailedRequest, ReadingBody: errFailedReadingBody, Non200: errNon200Response},
+		Requests:     "nest_weather_api_requests_total",
+		RequestsHelp: "OpenWeatherMap API requests by status code, or error if they weren't answered.",
+	})
+
+	providers, err := o.buildProviders(apiToken, client, func(token string) string {
+		return fmt.Sprintf("?id=%s&appid=%s&units=%s", locationID, token, system)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	collector := &Collector{
+		ctx:     o.ctx,
 		client:  client,
-		url:     rawurl,
-		logger:  cfg.Logger,
-		metrics: buildMetrics(cfg.Unit),
+		logger:  o.logger,
+		apiUnit: apiUnit,
+		units:   exported,
+		metrics: buildMetrics(exported),
+
+		forecast:      len(o.forecastHours) > 0,
+		forecastHours: o.forecastHours,
+		now:           time.Now,
+
+		listeners: o.listeners,
+		providers: providers,
+		cache:     make(map[string]*cachedResponse),
 	}
 
 	return collector, nil
 }
 
-func buildMetrics(unit string) *Metrics {
-	if unit == "" {
-		unit = "celsius"
-	}
-
-	return &Metrics{
+func buildMetrics(units []string) *Metrics {
+	metrics := &Metrics{
 		up:       prometheus.NewDesc(strings.Join([]string{"nest", "weather", "up"}, "_"), "Was talking to OpenWeatherMap API successful.", nil, nil),
-		temp:     prometheus.NewDesc(strings.Join([]string{"nest", "weather", "temperature", unit}, "_"), "Outside temperature.", nil, nil),
+		temp:     make(map[string]*prometheus.Desc),
 		humidity: prometheus.NewDesc(strings.Join([]string{"nest", "weather", "humidity", "percent"}, "_"), "Outside humidity.", nil, nil),
 		pressure: prometheus.NewDesc(strings.Join([]string{"nest", "weather", "pressure", "hectopascal"}, "_"), "Outside pressure.", nil, nil),
+
+		forecastUp:   prometheus.NewDesc(strings.Join([]string{"nest", "weather", "forecast", "up"}, "_"), "Was fetching the forecast from OpenWeatherMap API successful.", nil, nil),
+		forecastTemp: make(map[string]*prometheus.Desc),
+
+		cacheHits: prometheus.NewDesc(strings.Join([]string{"nest", "weather", "api", "cache", "hits", "total"}, "_"), "OpenWeatherMap API requests answered from the cache.", nil, nil),
+
+		providerActive:   prometheus.NewDesc(strings.Join([]string{"nest", "weather", "provider", "active"}, "_"), "Whether the provider served the latest weather readings.", []string{"provider"}, nil),
+		providerFailures: prometheus.NewDesc(strings.Join([]string{"nest", "weather", "provider", "failures", "total"}, "_"), "Failed attempts to fetch the weather from the provider, each failing over to the next provider.", []string{"provider"}, nil),
 	}
+
+	for _, unit := range units {
+		metrics.temp[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "weather", "temperature", unit}, "_"), "Outside temperature.", nil, nil)
+		metrics.forecastTemp[unit] = prometheus.NewDesc(strings.Join([]string{"nest", "weather", "forecast", "temperature", unit}, "_"), "Forecast outside temperature.", []string{"hours_ahead"}, nil)
+	}
+
+	return metrics
 }
 
 // Describe implements the prometheus.Describe interface.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.metrics.up
-	ch <- c.metrics.temp
+	for _, unit := range c.units {
+		ch <- c.metrics.temp[unit]
+	}
 	ch <- c.metrics.humidity
 	ch <- c.metrics.pressure
+
+	if c.forecast {
+		ch <- c.metrics.forecastUp
+		for _, unit := range c.units {
+			ch <- c.metrics.forecastTemp[unit]
+		}
+	}
+	ch <- c.metrics.cacheHits
+	ch <- c.metrics.providerActive
+	ch <- c.metrics.providerFailures
+	c.client.Describe(ch)
 }
 
-// Collect implements the prometheus.Describe interface.
+// Collect implements the prometheus.Collector interface.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	weather, err := c.getWeatherReadings()
+	defer c.client.Collect(ch)
+	defer c.collectCacheHits(ch)
+	defer c.collectProviders(ch)
+
+	weather, err := c.getWeatherReadings(c.ctx)
 	if err != nil {
 		ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 0)
 		c.logger.Log("level", "error", "message", "Failed collecting OpenWeatherMap data", "stack", errors.WithStack(err))
@@ -126,39 +272,106 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	c.logger.Log("level", "debug", "message", "Successfully collected OpenWeatherMap data")
 
 	ch <- prometheus.MustNewConstMetric(c.metrics.up, prometheus.GaugeValue, 1)
-	ch <- prometheus.MustNewConstMetric(c.metrics.temp, prometheus.GaugeValue, weather.Temperature)
+	for _, unit := range c.units {
+		ch <- prometheus.MustNewConstMetric(c.metrics.temp[unit], prometheus.GaugeValue, units.Convert(weather.Temperature, c.apiUnit, unit))
+	}
 	ch <- prometheus.MustNewConstMetric(c.metrics.humidity, prometheus.GaugeValue, weather.Humidity)
 	ch <- prometheus.MustNewConstMetric(c.metrics.pressure, prometheus.GaugeValue, weather.Pressure)
-}
 
-func (c *Collector) getWeatherReadings() (weather *Weather, err error) {
-	res, err := c.client.Get(c.url)
-	if err != nil {
-		return nil, errors.Wrap(errFailedRequest, err.Error())
+	if c.forecast {
+		c.collectForecast(ch)
 	}
+}
+
+func (c *Collector) collectCacheHits(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(c.metrics.cacheHits, prometheus.CounterValue, c.cacheHits)
+}
+
+// Weather returns the current weather readings for the configured location.
+func (c *Collector) Weather(ctx context.Context) (*Weather, error) {
+	return c.getWeatherReadings(ctx)
+}
 
-	defer res.Body.Close()
+func (c *Collector) getWeatherReadings(ctx context.Context) (weather *Weather, err error) {
+	err = c.failover(ctx, false, func(p *provider) error {
+		body, err := c.get(ctx, p.client, p.url)
+		if err != nil {
+			return err
+		}
 
-	body, err := ioutil.ReadAll(res.Body)
+		weather, err = p.parse(body)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.served = p
+		c.mu.Unlock()
+		weather.Provider = p.name
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(errFailedReadingBody, err.Error())
+		return nil, err
 	}
 
-	if res.StatusCode != 200 {
-		return nil, errors.Wrap(errNon200Response, fmt.Sprintf("code: %d", res.StatusCode))
+	weather.Unit = c.apiUnit
+	weather.UpdatedAt = time.Now()
+	for _, listener := range c.listeners {
+		listener(weather)
 	}
 
-	var data map[string]json.RawMessage
+	return weather, nil
+}
 
-	err = json.Unmarshal(body, &data)
+// get requests the URL and returns the body of a successful response. Responses are cached: fresh responses are
+// reused without a request, and stale ones are revalidated with a conditional request, reusing the body if the API
+// responds that it's not modified.
+func (c *Collector) get(ctx context.Context, client *httpx.Client, rawurl string) ([]byte, error) {
+	cached := c.cached(rawurl)
+	if cached != nil && c.now().Before(cached.expires) {
+		c.hit()
+		return cached.body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
 	if err != nil {
-		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+		return nil, errors.Wrap(errFailedRequest, err.Error())
 	}
 
-	err = json.Unmarshal(data["main"], &weather)
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	res, body, err := client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(errFailedUnmarshalling, err.Error())
+		return nil, err
 	}
 
-	return weather, nil
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		// A 304 response may update the validators and freshness, the body stays the same.
+		header := res.Header.Clone()
+		if header.Get("ETag") == "" {
+			header.Set("ETag", cached.etag)
+		}
+		if header.Get("Last-Modified") == "" {
+			header.Set("Last-Modified", cached.lastModified)
+		}
+		c.store(rawurl, header, cached.body)
+		c.hit()
+		return cached.body, nil
+	}
+
+	if res.StatusCode != 200 {
+		return nil, errors.Wrap(errNon200Response, fmt.Sprintf("code: %d", res.StatusCode))
+	}
+
+	c.store(rawurl, res.Header, body)
+	return body, nil
 }
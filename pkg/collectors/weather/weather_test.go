@@ -1,10 +1,20 @@
 package weather
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pronestheus/pkg/units"
 	"pronestheus/test"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,6 +33,8 @@ func TestServerResponses(t *testing.T) {
 				Humidity:    float64(88),
 				Pressure:    float64(1021),
 				Temperature: float64(20.26),
+				Unit:        units.Celsius,
+				Provider:    providerOpenWeatherMap,
 			},
 		}, {
 			name:    "valid response fahrenheit",
@@ -32,6 +44,8 @@ func TestServerResponses(t *testing.T) {
 				Humidity:    float64(88),
 				Pressure:    float64(1021),
 				Temperature: float64(68.36),
+				Unit:        units.Celsius,
+				Provider:    providerOpenWeatherMap,
 			},
 		}, {
 			name:    "missing location id",
@@ -58,18 +72,18 @@ func TestServerResponses(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			c, err := New(Config{
-				APIURL: test.url,
-			})
+			c, err := New("", "", WithAPIURL(test.url))
 			assert.NoError(t, err)
 
-			weather, err := c.getWeatherReadings()
+			weather, err := c.getWeatherReadings(context.Background())
 
 			if test.wantErr != nil {
 				assert.Nil(t, weather)
 				assert.True(t, errors.Is(err, test.wantErr))
 			} else {
 				assert.NoError(t, err)
+				assert.WithinDuration(t, time.Now(), weather.UpdatedAt, time.Minute)
+				weather.UpdatedAt = time.Time{}
 				assert.Equal(t, weather, test.want)
 			}
 		})
@@ -99,9 +113,7 @@ func TestAPIURLParsing(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			c, err := New(Config{
-				APIURL: test.rawurl,
-			})
+			c, err := New("", "", WithAPIURL(test.rawurl))
 
 			if test.wantErr != nil {
 				assert.Nil(t, c)
@@ -131,6 +143,16 @@ func TestAPIURLUnits(t *testing.T) {
 			unit:    "fahrenheit",
 			wantURL: "https://example.com?id=123&appid=abc&units=imperial",
 			wantErr: nil,
+		}, {
+			name:    "valid both",
+			unit:    "both",
+			wantURL: "https://example.com?id=123&appid=abc&units=metric",
+			wantErr: nil,
+		}, {
+			name:    "valid kelvin",
+			unit:    "kelvin",
+			wantURL: "https://example.com?id=123&appid=abc&units=metric",
+			wantErr: nil,
 		}, {
 			name:    "valid empty",
 			unit:    "",
@@ -140,26 +162,294 @@ func TestAPIURLUnits(t *testing.T) {
 			name:    "invalid",
 			unit:    "furlong",
 			wantURL: "",
-			wantErr: errInvalidTempUnit,
+			wantErr: units.ErrInvalidUnit,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			c, err := New(Config{
-				APIURL:        "https://example.com",
-				APILocationID: "123",
-				APIToken:      "abc",
-				Unit:          test.unit,
-			})
+			c, err := New("abc", "123", WithAPIURL("https://example.com"), WithUnit(test.unit))
 
 			if test.wantErr != nil {
 				assert.Nil(t, c)
 				assert.True(t, errors.Is(err, test.wantErr))
 			} else {
-				assert.Equal(t, c.url, test.wantURL)
+				assert.Equal(t, c.providers[0].url, test.wantURL)
 				assert.NoError(t, err)
 			}
 		})
 	}
 }
+
+func TestEmbeddedRegistry(t *testing.T) {
+	c, err := New("", "", WithAPIURL(test.WeatherServerMetric().URL))
+	assert.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(c))
+
+	count, err := testutil.GatherAndCount(registry, "nest_weather_up", "nest_weather_temperature_celsius")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestBothUnits(t *testing.T) {
+	c, err := New("", "", WithAPIURL(test.WeatherServerMetric().URL), WithUnit("both"))
+	assert.NoError(t, err)
+
+	expected := `
+# HELP nest_weather_temperature_celsius Outside temperature.
+# TYPE nest_weather_temperature_celsius gauge
+nest_weather_temperature_celsius 20.26
+# HELP nest_weather_temperature_fahrenheit Outside temperature.
+# TYPE nest_weather_temperature_fahrenheit gauge
+nest_weather_temperature_fahrenheit 68.468
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_weather_temperature_celsius", "nest_weather_temperature_fahrenheit")
+	assert.NoError(t, err)
+}
+
+func TestListeners(t *testing.T) {
+	var notified []*Weather
+
+	c, err := New("", "",
+		WithAPIURL(test.WeatherServerImperial().URL),
+		WithUnit(units.Fahrenheit),
+		WithListener(func(weather *Weather) { notified = append(notified, weather) }),
+	)
+	assert.NoError(t, err)
+
+	_, err = c.Weather(context.Background())
+	assert.NoError(t, err)
+
+	assert.Len(t, notified, 1)
+	assert.Equal(t, 68.36, notified[0].Temperature)
+	assert.Equal(t, units.Fahrenheit, notified[0].Unit)
+
+	// Failed requests aren't readings.
+	c, err = New("", "",
+		WithAPIURL(test.WeatherServerInvalidToken().URL),
+		WithListener(func(weather *Weather) { notified = append(notified, weather) }),
+	)
+	assert.NoError(t, err)
+
+	_, err = c.Weather(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, notified, 1)
+}
+
+func TestForecast(t *testing.T) {
+	c, err := New("", "",
+		WithAPIURL(test.WeatherServerForecast().URL+"/weather"),
+		WithForecastURL(test.WeatherServerForecast().URL+"/forecast"),
+		WithForecast(1, 3, 4, 12, 13),
+	)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2020, 7, 17, 12, 0, 0, 0, time.UTC) }
+
+	forecasts, err := c.Forecast(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, forecasts, 4, "horizons beyond the forecast are left out")
+
+	want := map[int]float64{
+		1:  19.5, // before the first step
+		3:  19.5,
+		4:  18.667, // interpolated between 19.5 at 15:00 and 17.0 at 18:00
+		12: 16.4,
+	}
+	for _, forecast := range forecasts {
+		assert.InDelta(t, want[forecast.HoursAhead], forecast.Temperature, 0.001, "%d hours ahead", forecast.HoursAhead)
+		assert.Equal(t, units.Celsius, forecast.Unit)
+	}
+}
+
+func TestForecastMetrics(t *testing.T) {
+	c, err := New("", "",
+		WithAPIURL(test.WeatherServerForecast().URL+"/weather"),
+		WithForecastURL(test.WeatherServerForecast().URL+"/forecast"),
+		WithForecast(3, 6),
+		WithUnit("both"),
+	)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2020, 7, 17, 12, 0, 0, 0, time.UTC) }
+
+	expected := `
+# HELP nest_weather_forecast_temperature_celsius Forecast outside temperature.
+# TYPE nest_weather_forecast_temperature_celsius gauge
+nest_weather_forecast_temperature_celsius{hours_ahead="3"} 19.5
+nest_weather_forecast_temperature_celsius{hours_ahead="6"} 17
+# HELP nest_weather_forecast_temperature_fahrenheit Forecast outside temperature.
+# TYPE nest_weather_forecast_temperature_fahrenheit gauge
+nest_weather_forecast_temperature_fahrenheit{hours_ahead="3"} 67.1
+nest_weather_forecast_temperature_fahrenheit{hours_ahead="6"} 62.6
+# HELP nest_weather_forecast_up Was fetching the forecast from OpenWeatherMap API successful.
+# TYPE nest_weather_forecast_up gauge
+nest_weather_forecast_up 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_weather_forecast_temperature_celsius", "nest_weather_forecast_temperature_fahrenheit", "nest_weather_forecast_up")
+	assert.NoError(t, err)
+
+	// A failed forecast doesn't affect the current weather.
+	c, err = New("", "",
+		WithAPIURL(test.WeatherServerMetric().URL),
+		WithForecastURL(test.WeatherServerInvalidToken().URL),
+		WithForecast(3),
+	)
+	assert.NoError(t, err)
+
+	expected = `
+# HELP nest_weather_forecast_up Was fetching the forecast from OpenWeatherMap API successful.
+# TYPE nest_weather_forecast_up gauge
+nest_weather_forecast_up 0
+# HELP nest_weather_up Was talking to OpenWeatherMap API successful.
+# TYPE nest_weather_up gauge
+nest_weather_up 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_weather_forecast_up", "nest_weather_up")
+	assert.NoError(t, err)
+}
+
+func TestForecastDisabled(t *testing.T) {
+	c, err := New("", "",
+		WithAPIURL(test.WeatherServerMetric().URL),
+		WithForecastURL("https/////this.is.not.a.valid.url"),
+	)
+	assert.NoError(t, err, "the forecast URL isn't used without horizons")
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(c))
+
+	count, err := testutil.GatherAndCount(registry, "nest_weather_forecast_up")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = New("", "",
+		WithAPIURL(test.WeatherServerMetric().URL),
+		WithForecastURL(test.WeatherServerMetric().URL),
+		WithForecast(121),
+	)
+	assert.True(t, errors.Is(err, errInvalidForecastHour))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	var requests int32
+	c, err := New("", "", WithAPIURL(test.WeatherServerConditional("", &requests).URL))
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		weather, err := c.Weather(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 20.26, weather.Temperature, "not modified responses reuse the cached body")
+	}
+	assert.Equal(t, int32(3), requests, "responses without freshness are revalidated")
+
+	// Collecting revalidates once more.
+	expected := `
+# HELP nest_weather_api_cache_hits_total OpenWeatherMap API requests answered from the cache.
+# TYPE nest_weather_api_cache_hits_total counter
+nest_weather_api_cache_hits_total 3
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_weather_api_cache_hits_total")
+	assert.NoError(t, err)
+}
+
+func TestCachedResponses(t *testing.T) {
+	var requests int32
+	c, err := New("", "", WithAPIURL(test.WeatherServerConditional("public, max-age=600", &requests).URL))
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 7, 17, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Weather(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests, "fresh responses are reused without a request")
+
+	now = now.Add(10 * time.Minute)
+	weather, err := c.Weather(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 20.26, weather.Temperature)
+	assert.Equal(t, int32(2), requests, "stale responses are revalidated")
+	assert.Equal(t, float64(3), c.cacheHits)
+}
+
+func TestFailover(t *testing.T) {
+	var failing int32
+	owm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") == "exhausted" || atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintln(w, `{"main": {"temp": 20.26, "humidity": 88, "pressure": 1021}}`)
+	}))
+	defer owm.Close()
+
+	openMeteo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "52.37", r.URL.Query().Get("latitude"))
+		fmt.Fprintln(w, `{"current": {"temperature_2m": 18.5, "relative_humidity_2m": 75, "pressure_msl": 1015.2}}`)
+	}))
+	defer openMeteo.Close()
+
+	c, err := New("exhausted", "",
+		WithAPIURL(owm.URL),
+		WithFallbackTokens("valid"),
+		WithOpenMeteoFallback(openMeteo.URL, 52.37, 4.89),
+	)
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 7, 17, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	weather, err := c.Weather(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "openweathermap-2", weather.Provider, "the fallback API key is used if the first one fails")
+	assert.Equal(t, 20.26, weather.Temperature)
+
+	atomic.StoreInt32(&failing, 1)
+	weather, err = c.Weather(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, providerOpenMeteo, weather.Provider, "Open-Meteo is used if all API keys fail")
+	assert.Equal(t, 18.5, weather.Temperature)
+	assert.Equal(t, 1015.2, weather.Pressure)
+
+	expected := `
+# HELP nest_weather_provider_active Whether the provider served the latest weather readings.
+# TYPE nest_weather_provider_active gauge
+nest_weather_provider_active{provider="open-meteo"} 1
+nest_weather_provider_active{provider="openweathermap"} 0
+nest_weather_provider_active{provider="openweathermap-2"} 0
+# HELP nest_weather_provider_failures_total Failed attempts to fetch the weather from the provider, each failing over to the next provider.
+# TYPE nest_weather_provider_failures_total counter
+nest_weather_provider_failures_total{provider="open-meteo"} 0
+nest_weather_provider_failures_total{provider="openweathermap"} 1
+nest_weather_provider_failures_total{provider="openweathermap-2"} 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "nest_weather_provider_active", "nest_weather_provider_failures_total")
+	assert.NoError(t, err, "failed providers are skipped until their cooldown ends")
+
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(failoverCooldown)
+	weather, err = c.Weather(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "openweathermap-2", weather.Provider, "providers are tried again after their cooldown")
+}
+
+func TestInvalidFallbackLocation(t *testing.T) {
+	_, err := New("", "", WithAPIURL("https://example.com"), WithOpenMeteoFallback("https://example.com", 91, 0))
+	assert.True(t, errors.Is(err, errInvalidLocation))
+}
+
+func TestNewFromConfig(t *testing.T) {
+	c, err := NewFromConfig(Config{
+		APIURL:        test.WeatherServerForecast().URL + "/weather",
+		ForecastURL:   test.WeatherServerForecast().URL + "/forecast",
+		ForecastHours: []int{3},
+	})
+	assert.NoError(t, err)
+	assert.True(t, c.forecast)
+
+	_, err = NewFromConfig(Config{APIURL: "https/////this.is.not.a.valid.url"})
+	assert.True(t, errors.Is(err, errFailedParsingURL))
+}
@@ -0,0 +1,197 @@
+// Package comfort estimates the thermal comfort of people inside with the PMV/PPD model of ISO 7730.
+//
+// The Predicted Mean Vote (PMV) predicts how a group of people would rate the thermal sensation on a scale from -3
+// (cold) to +3 (hot), 0 being neutral. The Predicted Percentage of Dissatisfied (PPD) derived from it is the share of
+// people who would feel too cold or too warm, at least 5%. ISO 7730 considers -0.5 < PMV < 0.5, or PPD below 10%,
+// comfortable.
+//
+// Thermostats only measure the air temperature and humidity, so the model is simplified: the mean radiant
+// temperature is assumed to equal the air temperature, and the clothing, metabolic rate and air speed are
+// configured assumptions rather than measurements.
+package comfort
+
+import (
+	"math"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+const (
+	// DefaultClothing is the clothing insulation in clo of trousers and a long-sleeved shirt.
+	DefaultClothing = 1.0
+
+	// DefaultMetabolicRate is the metabolic rate in met of seated, relaxed activity at home.
+	DefaultMetabolicRate = 1.1
+
+	// DefaultAirSpeed is the air speed in m/s of still indoor air.
+	DefaultAirSpeed = 0.1
+
+	// maxIterations limits the iterations computing the clothing surface temperature.
+	maxIterations = 150
+)
+
+var (
+	errInvalidAssumptions = errors.New("invalid comfort assumptions; expected positive metabolic rate, clothing and air speed")
+	errNotConverged       = errors.New("clothing surface temperature didn't converge")
+)
+
+// Config provides the configuration necessary to create the Estimator. Logger is optional, if it's nil the Estimator
+// doesn't log anything. Clothing, MetabolicRate and AirSpeed default to DefaultClothing, DefaultMetabolicRate and
+// DefaultAirSpeed. Labels are the labels of thermostats in the PMV and PPD metrics.
+type Config struct {
+	Logger        log.Logger
+	Clothing      float64
+	MetabolicRate float64
+	AirSpeed      float64
+	Labels        nest.MetricLabels
+}
+
+// Estimator computes the comfort at the latest readings of thermostats and exports it.
+type Estimator struct {
+	logger        log.Logger
+	clothing      float64
+	metabolicRate float64
+	airSpeed      float64
+	labels        nest.MetricLabels
+
+	mu          sync.Mutex
+	thermostats map[string]*nest.Thermostat
+
+	pmv *prometheus.Desc
+	ppd *prometheus.Desc
+}
+
+// New creates an Estimator using the given Config. It returns an error if the assumptions are negative.
+func New(cfg Config) (*Estimator, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Clothing == 0 {
+		cfg.Clothing = DefaultClothing
+	}
+	if cfg.MetabolicRate == 0 {
+		cfg.MetabolicRate = DefaultMetabolicRate
+	}
+	if cfg.AirSpeed == 0 {
+		cfg.AirSpeed = DefaultAirSpeed
+	}
+	if cfg.Clothing < 0 || cfg.MetabolicRate < 0 || cfg.AirSpeed < 0 {
+		return nil, errInvalidAssumptions
+	}
+
+	return &Estimator{
+		logger:        cfg.Logger,
+		clothing:      cfg.Clothing,
+		metabolicRate: cfg.MetabolicRate,
+		airSpeed:      cfg.AirSpeed,
+		labels:        cfg.Labels,
+		thermostats:   make(map[string]*nest.Thermostat),
+		pmv:           prometheus.NewDesc("nest_comfort_pmv", "Predicted Mean Vote of the thermal sensation inside, from -3 (cold) to +3 (hot).", cfg.Labels.Names(), nil),
+		ppd:           prometheus.NewDesc("nest_comfort_ppd_percent", "Predicted Percentage of Dissatisfied with the thermal comfort inside.", cfg.Labels.Names(), nil),
+	}, nil
+}
+
+// Listener returns a nest.Listener keeping the latest reading of every thermostat.
+func (e *Estimator) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		for _, therm := range thermostats {
+			e.thermostats[therm.ID] = therm
+		}
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (e *Estimator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.pmv
+	ch <- e.ppd
+}
+
+// Collect implements the prometheus.Collector interface. Thermostats without a humidity reading are left out.
+func (e *Estimator) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, therm := range e.thermostats {
+		if therm.Humidity <= 0 {
+			continue
+		}
+
+		vote, err := PMV(therm.AmbientTemp, therm.AmbientTemp, therm.Humidity, e.airSpeed, e.metabolicRate, e.clothing)
+		if err != nil {
+			e.logger.Log("level", "warn", "message", "Failed estimating thermal comfort", "id", therm.ID, "stack", errors.WithStack(err))
+			continue
+		}
+
+		labels := e.labels.Values(therm)
+		ch <- prometheus.MustNewConstMetric(e.pmv, prometheus.GaugeValue, vote, labels...)
+		ch <- prometheus.MustNewConstMetric(e.ppd, prometheus.GaugeValue, PPD(vote), labels...)
+	}
+}
+
+// PMV returns the Predicted Mean Vote from the air temperature and mean radiant temperature in Celsius, the relative
+// humidity in percent, the air speed in m/s, the metabolic rate in met and the clothing insulation in clo, following
+// the reference implementation of ISO 7730 without external work.
+func PMV(airTemp, radiantTemp, humidity, airSpeed, metabolicRate, clothing float64) (float64, error) {
+	// Partial water vapour pressure in Pa.
+	pa := humidity * 10 * math.Exp(16.6536-4030.183/(airTemp+235))
+
+	icl := 0.155 * clothing
+	m := metabolicRate * 58.15
+
+	fcl := 1.05 + 0.645*icl
+	if icl <= 0.078 {
+		fcl = 1 + 1.29*icl
+	}
+
+	hcf := 12.1 * math.Sqrt(airSpeed)
+	taa := airTemp + 273
+	tra := radiantTemp + 273
+
+	// The clothing surface temperature is found iteratively, in hundreds of Kelvin.
+	tcla := taa + (35.5-airTemp)/(3.5*icl+0.1)
+	p1 := icl * fcl
+	p2 := p1 * 3.96
+	p3 := p1 * 100
+	p4 := p1 * taa
+	p5 := 308.7 - 0.028*m + p2*math.Pow(tra/100, 4)
+
+	xn, xf := tcla/100, tcla/50
+	var hc float64
+	for i := 0; math.Abs(xn-xf) > 0.00015; i++ {
+		if i == maxIterations {
+			return 0, errNotConverged
+		}
+		xf = (xf + xn) / 2
+		hc = math.Max(hcf, 2.38*math.Pow(math.Abs(100*xf-taa), 0.25))
+		xn = (p5 + p4*hc - p2*math.Pow(xf, 4)) / (100 + p3*hc)
+	}
+	tcl := 100*xn - 273
+
+	// Heat losses through the skin, by sweating, latent and dry respiration, radiation and convection.
+	hl1 := 3.05 * 0.001 * (5733 - 6.99*m - pa)
+	hl2 := 0.0
+	if m > 58.15 {
+		hl2 = 0.42 * (m - 58.15)
+	}
+	hl3 := 1.7 * 0.00001 * m * (5867 - pa)
+	hl4 := 0.0014 * m * (34 - airTemp)
+	hl5 := 3.96 * fcl * (math.Pow(xn, 4) - math.Pow(tra/100, 4))
+	hl6 := fcl * hc * (tcl - airTemp)
+
+	ts := 0.303*math.Exp(-0.036*m) + 0.028
+	return ts * (m - hl1 - hl2 - hl3 - hl4 - hl5 - hl6), nil
+}
+
+// PPD returns the Predicted Percentage of Dissatisfied from the Predicted Mean Vote.
+func PPD(pmv float64) float64 {
+	return 100 - 95*math.Exp(-0.03353*math.Pow(pmv, 4)-0.2179*math.Pow(pmv, 2))
+}
@@ -0,0 +1,62 @@
+package comfort
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func TestPMV(t *testing.T) {
+	// Examples from Table D.1 of ISO 7730.
+	tests := []struct {
+		airTemp, radiantTemp, airSpeed, humidity, metabolicRate, clothing float64
+		pmv, ppd                                                          float64
+	}{
+		{22, 22, 0.1, 60, 1.2, 0.5, -0.75, 17},
+		{27, 27, 0.1, 60, 1.2, 0.5, 0.77, 17},
+		{27, 27, 0.3, 60, 1.2, 0.5, 0.44, 9},
+		{23.5, 25.5, 0.1, 60, 1.2, 0.5, -0.01, 5},
+		{19, 19, 0.1, 40, 1.2, 1.0, -0.60, 13},
+	}
+
+	for _, test := range tests {
+		pmv, err := PMV(test.airTemp, test.radiantTemp, test.humidity, test.airSpeed, test.metabolicRate, test.clothing)
+		assert.NoError(t, err)
+		assert.InDelta(t, test.pmv, pmv, 0.01, "%+v", test)
+		assert.InDelta(t, test.ppd, PPD(pmv), 0.5, "%+v", test)
+	}
+}
+
+func TestEstimator(t *testing.T) {
+	e, err := New(Config{Clothing: 0.5, MetabolicRate: 1.2})
+	assert.NoError(t, err)
+
+	e.Listener()([]*nest.Thermostat{
+		{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID", DeviceID: "DEVICE_ID", Label: "Living-Room", AmbientTemp: 22, Humidity: 60},
+		{ID: "enterprises/PROJECT_ID/devices/NO_HUMIDITY", DeviceID: "NO_HUMIDITY", Label: "Attic", AmbientTemp: 22},
+	})
+
+	// The radiant temperature is the air temperature and the air speed defaults to still air.
+	pmv, err := PMV(22, 22, 60, DefaultAirSpeed, 1.2, 0.5)
+	assert.NoError(t, err)
+
+	expected := fmt.Sprintf(`
+# HELP nest_comfort_pmv Predicted Mean Vote of the thermal sensation inside, from -3 (cold) to +3 (hot).
+# TYPE nest_comfort_pmv gauge
+nest_comfort_pmv{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} %v
+# HELP nest_comfort_ppd_percent Predicted Percentage of Dissatisfied with the thermal comfort inside.
+# TYPE nest_comfort_ppd_percent gauge
+nest_comfort_ppd_percent{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} %v
+`, pmv, PPD(pmv))
+	assert.NoError(t, testutil.CollectAndCompare(e, strings.NewReader(expected)), "thermostats without humidity are left out")
+}
+
+func TestInvalidAssumptions(t *testing.T) {
+	_, err := New(Config{Clothing: -1})
+	assert.Equal(t, errInvalidAssumptions, err)
+}
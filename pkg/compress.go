@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errInvalidGzipLevel = errors.New("invalid metrics gzip level; expected 0 to disable compression, or 1 (fastest) to 9 (smallest)")
+
+// compressHandler compresses responses of the metrics handler with gzip at the configured level, if the scraper
+// accepts it. Responses smaller than the minimum size are sent uncompressed, since compressing them saves little.
+// Responses are buffered and compressed with pooled buffers and writers, so scrapes don't allocate them every time.
+// The size of the latest response body, as sent, is kept in the pronestheus_metrics_response_bytes gauge.
+type compressHandler struct {
+	handler  http.Handler
+	level    int
+	minBytes int
+	size     prometheus.Gauge
+
+	buffers sync.Pool
+	writers sync.Pool
+}
+
+// newCompressHandler creates the compression of the metrics handler from the config.
+func newCompressHandler(cfg *ExporterConfig, handler http.Handler) (*compressHandler, error) {
+	h := &compressHandler{
+		handler: handler,
+		level:   gzip.DefaultCompression,
+		size: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pronestheus_metrics_response_bytes",
+			Help: "Size of the body of the latest metrics response in bytes, after compression.",
+		}),
+	}
+
+	if cfg.MetricsGzipLevel != nil {
+		h.level = *cfg.MetricsGzipLevel
+	}
+	if h.level < gzip.DefaultCompression || h.level > gzip.BestCompression {
+		return nil, errors.Wrap(errInvalidGzipLevel, strconv.Itoa(h.level))
+	}
+
+	if cfg.MetricsGzipMinBytes != nil {
+		h.minBytes = *cfg.MetricsGzipMinBytes
+	}
+
+	h.buffers.New = func() interface{} {
+		return new(bytes.Buffer)
+	}
+	h.writers.New = func() interface{} {
+		gz, _ := gzip.NewWriterLevel(ioutil.Discard, h.level)
+		return gz
+	}
+
+	return h, nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *compressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	compress := h.level != gzip.NoCompression && acceptsGzip(r.Header.Get("Accept-Encoding"))
+
+	// The handler would compress the response itself, it's requested uncompressed and compressed here instead.
+	r = r.Clone(r.Context())
+	r.Header.Del("Accept-Encoding")
+
+	buf := h.buffers.Get().(*bytes.Buffer)
+	defer h.buffers.Put(buf)
+	buf.Reset()
+
+	res := &responseBuffer{header: w.Header(), code: http.StatusOK, body: buf}
+	h.handler.ServeHTTP(res, r)
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !compress || buf.Len() < h.minBytes {
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(res.code)
+		w.Write(buf.Bytes())
+		h.size.Set(float64(buf.Len()))
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(res.code)
+
+	out := &countingWriter{w: w}
+	gz := h.writers.Get().(*gzip.Writer)
+	defer h.writers.Put(gz)
+	gz.Reset(out)
+	gz.Write(buf.Bytes())
+	gz.Close()
+	h.size.Set(float64(out.n))
+}
+
+// acceptsGzip returns true if the Accept-Encoding header accepts gzip, either by name or with the * wildcard, with a
+// non-zero quality.
+func acceptsGzip(header string) bool {
+	accepts := false
+	for _, part := range strings.Split(header, ",") {
+		coding, quality := part, ""
+		if i := strings.Index(part, ";"); i >= 0 {
+			coding, quality = part[:i], part[i+1:]
+		}
+
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+
+		ok := true
+		if q := strings.TrimSpace(quality); strings.HasPrefix(q, "q=") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64)
+			ok = err == nil && value > 0
+		}
+
+		// An explicit gzip coding overrides the wildcard.
+		if coding != "*" {
+			return ok
+		}
+		accepts = ok
+	}
+	return accepts
+}
+
+// responseBuffer keeps the response of a handler in a buffer.
+type responseBuffer struct {
+	header http.Header
+	code   int
+	body   *bytes.Buffer
+}
+
+// Header implements the http.ResponseWriter interface.
+func (r *responseBuffer) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (r *responseBuffer) WriteHeader(code int) {
+	r.code = code
+}
+
+// Write implements the http.ResponseWriter interface.
+func (r *responseBuffer) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+// Write implements the io.Writer interface.
+func (c *countingWriter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.n += n
+	return n, err
+}
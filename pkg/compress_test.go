@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressHandler(t *testing.T) {
+	body := strings.Repeat("nest_up 1\n", 200)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Accept-Encoding"), "the response is requested uncompressed")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	})
+
+	level, minBytes := 9, 1024
+	h, err := newCompressHandler(&ExporterConfig{MetricsGzipLevel: &level, MetricsGzipMinBytes: &minBytes}, handler)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		size := float64(w.Body.Len())
+		gz, err := gzip.NewReader(w.Body)
+		assert.NoError(t, err)
+		got, err := ioutil.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(got), "pooled buffers and writers are reset")
+		assert.Equal(t, size, testutil.ToFloat64(h.size))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, identity")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+	assert.Equal(t, float64(len(body)), testutil.ToFloat64(h.size))
+
+	minBytes = 4096
+	h, err = newCompressHandler(&ExporterConfig{MetricsGzipMinBytes: &minBytes}, handler)
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "small responses are sent uncompressed")
+	assert.Equal(t, "2000", w.Header().Get("Content-Length"))
+
+	level = 0
+	h, err = newCompressHandler(&ExporterConfig{MetricsGzipLevel: &level}, handler)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "compression is disabled")
+}
+
+func TestInvalidGzipLevel(t *testing.T) {
+	level := 10
+	_, err := newCompressHandler(&ExporterConfig{MetricsGzipLevel: &level}, http.NotFoundHandler())
+	assert.True(t, errors.Is(err, errInvalidGzipLevel))
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "", want: false},
+		{header: "gzip", want: true},
+		{header: "deflate, GZIP;q=0.5", want: true},
+		{header: "x-gzip", want: true},
+		{header: "*", want: true},
+		{header: "gzip;q=0", want: false},
+		{header: "*, gzip;q=0", want: false},
+		{header: "identity", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, acceptsGzip(tt.header), tt.header)
+	}
+}
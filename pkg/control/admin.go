@@ -0,0 +1,30 @@
+package control
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAdmin serves requests sending the admin token as a bearer token, or as the basic auth password while the
+// server requires basic auth, with the handler, and responds to other requests with 401 Unauthorized. Requests are never authorized with an empty token. All admin endpoints of the
+// exporter are served through it.
+func RequireAdmin(token string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authorized returns true if the request sends the token as a bearer token or as the basic auth password. Requests
+// are never authorized with an empty token.
+func authorized(r *http.Request, token string) bool {
+	sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		sent = password
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
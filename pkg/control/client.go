@@ -0,0 +1,56 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var errFailedRequest = errors.New("failed admin endpoint request")
+
+// Send posts the request to the admin endpoint of the exporter at the URL, eg. http://localhost:9777, authorized with
+// the token, and returns the result. The HTTP client is http.DefaultClient if it's nil.
+func Send(ctx context.Context, client *http.Client, exporterURL, token string, req Request) (*Result, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(exporterURL, "/")+Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&failure); err != nil || failure.Error == "" {
+			failure.Error = res.Status
+		}
+		return nil, errors.Wrap(errFailedRequest, failure.Error)
+	}
+
+	var result Result
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+	return &result, nil
+}
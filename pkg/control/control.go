@@ -0,0 +1,243 @@
+// Package control changes settings of thermostats on request, for scripts and cron jobs, eg.
+// `pronestheus set --device Living-Room --mode HEAT --setpoint 20.5`.
+//
+// Settings are changed with Nest API commands, either directly or by a running exporter through the admin endpoint
+// served by the Handler. The Handler finds thermostats in the latest readings of the exporter, so only the commands
+// call the API, sharing the OAuth2 token and the rate limits of the exporter.
+//
+// The Scheduler holds settings for a time, eg. the eco mode from Friday 18:00 to Sunday 15:00 for second homes, and
+// restores the previous settings afterwards.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// Path is the path of the admin endpoint.
+const Path = "/api/v1/control"
+
+var (
+	errNothingToSet     = errors.New("nothing to set; set the mode, the eco mode or the setpoint")
+	errMissingDevice    = errors.New("the device to set is missing")
+	errInvalidMode      = errors.New("invalid mode; valid values: [HEAT, COOL, HEATCOOL, OFF]")
+	errInvalidEcoMode   = errors.New("invalid eco mode; valid values: [MANUAL_ECO, OFF]")
+	errUnknownDevice    = errors.New("unknown thermostat")
+	errAmbiguousDevice  = errors.New("several thermostats match the device, use its device ID")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errUnauthorized     = errors.New("unauthorized, set the admin token")
+	errInvalidRequest   = errors.New("invalid request")
+	errInvalidSetting   = errors.New("invalid setting; valid values: [eco, heat, cool, heatcool, off] or a heat setpoint")
+)
+
+// Controller executes commands on thermostats. It's implemented by nest.Collector.
+type Controller interface {
+	SetEcoMode(ctx context.Context, id, mode string) error
+	SetMode(ctx context.Context, id, mode string) error
+	SetHeat(ctx context.Context, id string, celsius float64) error
+}
+
+// Request contains the settings to change on the thermostat given by Device: its device ID, its full resource name,
+// its label or its custom name. Empty settings are left unchanged. The setpoint is in Celsius.
+type Request struct {
+	Device   string   `json:"device"`
+	Mode     string   `json:"mode,omitempty"`
+	EcoMode  string   `json:"eco_mode,omitempty"`
+	Setpoint *float64 `json:"setpoint_celsius,omitempty"`
+}
+
+// Validate returns an error if the request doesn't name a device, has nothing to set or has invalid modes.
+func (r *Request) Validate() error {
+	if r.Device == "" {
+		return errMissingDevice
+	}
+	if r.Mode == "" && r.EcoMode == "" && r.Setpoint == nil {
+		return errNothingToSet
+	}
+
+	switch r.Mode {
+	case "", "HEAT", "COOL", "HEATCOOL", "OFF":
+	default:
+		return errors.Wrap(errInvalidMode, r.Mode)
+	}
+
+	switch r.EcoMode {
+	case "", "MANUAL_ECO", "OFF":
+	default:
+		return errors.Wrap(errInvalidEcoMode, r.EcoMode)
+	}
+
+	return nil
+}
+
+// ParseSettings returns the request changing the settings of the device, given as space separated fields: eco,
+// a mode (heat, cool, heatcool or off) or a heat setpoint in Celsius, eg. "heat 20.5".
+func ParseSettings(device string, settings []string) (Request, error) {
+	req := Request{Device: device}
+	for _, setting := range settings {
+		switch value := strings.ToUpper(setting); value {
+		case "ECO":
+			req.EcoMode = "MANUAL_ECO"
+		case "HEAT", "COOL", "HEATCOOL", "OFF":
+			req.Mode = value
+		default:
+			setpoint, err := strconv.ParseFloat(setting, 64)
+			if err != nil {
+				return req, errors.Wrap(errInvalidSetting, setting)
+			}
+			req.Setpoint = &setpoint
+		}
+	}
+
+	return req, nil
+}
+
+// Result describes the thermostat whose settings were changed, and the commands executed in order, eg. "mode HEAT".
+type Result struct {
+	ID       string   `json:"id"`
+	DeviceID string   `json:"device_id"`
+	Label    string   `json:"label"`
+	Applied  []string `json:"applied"`
+}
+
+// Find returns the thermostat matching the device, by its device ID or full resource name, or else by its label,
+// given by the label function, or its custom name, ignoring case.
+func Find(thermostats []*nest.Thermostat, device string, label func(*nest.Thermostat) string) (*nest.Thermostat, error) {
+	var named []*nest.Thermostat
+	for _, therm := range thermostats {
+		if therm.DeviceID == device || therm.ID == device {
+			return therm, nil
+		}
+		if strings.EqualFold(label(therm), device) || strings.EqualFold(therm.Label, device) {
+			named = append(named, therm)
+		}
+	}
+
+	switch len(named) {
+	case 0:
+		return nil, errors.Wrap(errUnknownDevice, device)
+	case 1:
+		return named[0], nil
+	default:
+		return nil, errors.Wrap(errAmbiguousDevice, device)
+	}
+}
+
+// Apply changes the settings of the thermostat: the eco mode first, as it overrides the mode, then the mode and
+// the setpoint last, as the thermostat must be in the HEAT mode to accept it. It stops at the first failed command,
+// the result lists the commands executed before.
+func Apply(ctx context.Context, controller Controller, therm *nest.Thermostat, req Request) (*Result, error) {
+	result := &Result{ID: therm.ID, DeviceID: therm.DeviceID, Label: therm.Label, Applied: []string{}}
+
+	if req.EcoMode != "" {
+		if err := controller.SetEcoMode(ctx, therm.ID, req.EcoMode); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, "eco mode "+req.EcoMode)
+	}
+
+	if req.Mode != "" {
+		if err := controller.SetMode(ctx, therm.ID, req.Mode); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, "mode "+req.Mode)
+	}
+
+	if req.Setpoint != nil {
+		if err := controller.SetHeat(ctx, therm.ID, *req.Setpoint); err != nil {
+			return result, err
+		}
+		result.Applied = append(result.Applied, "setpoint "+formatCelsius(*req.Setpoint))
+	}
+
+	return result, nil
+}
+
+// Config provides the configuration necessary to create the Handler. Logger is optional, if it's nil the Handler
+// doesn't log anything. Thermostats returns the latest readings and Label the label of a thermostat. Requests must be
+// authorized with Token as a bearer token.
+type Config struct {
+	Logger      log.Logger
+	Controller  Controller
+	Thermostats func() []*nest.Thermostat
+	Label       func(*nest.Thermostat) string
+	Token       string
+}
+
+// Handler serves the admin endpoint, changing settings of thermostats with POSTed Requests and responding with
+// the Result.
+type Handler struct {
+	cfg Config
+}
+
+// NewHandler creates a Handler using the given Config.
+func NewHandler(cfg Config) *Handler {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+	return &Handler{cfg: cfg}
+}
+
+// ServeHTTP implements the http.Handler interface. Requests must send the admin token, see RequireAdmin.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	RequireAdmin(h.cfg.Token, http.HandlerFunc(h.serve)).ServeHTTP(w, r)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(errInvalidRequest, err.Error()))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	therm, err := Find(h.cfg.Thermostats(), req.Device, h.cfg.Label)
+	switch {
+	case errors.Is(err, errUnknownDevice):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	result, err := Apply(r.Context(), h.cfg.Controller, therm, req)
+	if err != nil {
+		h.cfg.Logger.Log("level", "error", "message", "Failed changing thermostat settings", "id", therm.ID, "applied", strings.Join(result.Applied, ", "), "stack", errors.WithStack(err))
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	h.cfg.Logger.Log("level", "info", "message", "Changed thermostat settings", "id", therm.ID, "applied", strings.Join(result.Applied, ", "))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// formatCelsius formats the temperature with at most one decimal, eg. "20.5°C".
+func formatCelsius(celsius float64) string {
+	return strconv.FormatFloat(celsius, 'f', -1, 64) + "°C"
+}
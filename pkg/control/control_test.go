@@ -0,0 +1,177 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type fakeController struct {
+	commands []string
+	err      error
+}
+
+func (c *fakeController) record(command string) error {
+	c.commands = append(c.commands, command)
+	return c.err
+}
+
+func (c *fakeController) SetEcoMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s eco %s", id, mode))
+}
+
+func (c *fakeController) SetMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s mode %s", id, mode))
+}
+
+func (c *fakeController) SetHeat(_ context.Context, id string, celsius float64) error {
+	return c.record(fmt.Sprintf("%s heat %g", id, celsius))
+}
+
+var thermostats = []*nest.Thermostat{
+	{ID: "enterprises/PROJECT_ID/devices/LIVING", DeviceID: "LIVING", Label: "Living Room"},
+	{ID: "enterprises/PROJECT_ID/devices/BED_1", DeviceID: "BED_1", Label: "Bedroom"},
+	{ID: "enterprises/PROJECT_ID/devices/BED_2", DeviceID: "BED_2", Label: "bedroom"},
+}
+
+func label(therm *nest.Thermostat) string {
+	return strings.Replace(therm.Label, " ", "-", -1)
+}
+
+func TestValidate(t *testing.T) {
+	setpoint := 20.5
+	assert.NoError(t, (&Request{Device: "LIVING", Setpoint: &setpoint}).Validate())
+	assert.True(t, errors.Is((&Request{Mode: "HEAT"}).Validate(), errMissingDevice))
+	assert.True(t, errors.Is((&Request{Device: "LIVING"}).Validate(), errNothingToSet))
+	assert.True(t, errors.Is((&Request{Device: "LIVING", Mode: "ECO"}).Validate(), errInvalidMode))
+	assert.True(t, errors.Is((&Request{Device: "LIVING", EcoMode: "ON"}).Validate(), errInvalidEcoMode))
+}
+
+func TestFind(t *testing.T) {
+	therm, err := Find(thermostats, "living-room", label)
+	assert.NoError(t, err)
+	assert.Equal(t, "LIVING", therm.DeviceID)
+
+	therm, err = Find(thermostats, "enterprises/PROJECT_ID/devices/BED_2", label)
+	assert.NoError(t, err)
+	assert.Equal(t, "BED_2", therm.DeviceID)
+
+	_, err = Find(thermostats, "Bedroom", label)
+	assert.True(t, errors.Is(err, errAmbiguousDevice))
+
+	_, err = Find(thermostats, "Kitchen", label)
+	assert.True(t, errors.Is(err, errUnknownDevice))
+}
+
+func TestApply(t *testing.T) {
+	controller := &fakeController{}
+	setpoint := 20.5
+
+	result, err := Apply(context.Background(), controller, thermostats[0], Request{Device: "LIVING", Mode: "HEAT", EcoMode: "OFF", Setpoint: &setpoint})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eco mode OFF", "mode HEAT", "setpoint 20.5°C"}, result.Applied)
+	assert.Equal(t, []string{
+		"enterprises/PROJECT_ID/devices/LIVING eco OFF",
+		"enterprises/PROJECT_ID/devices/LIVING mode HEAT",
+		"enterprises/PROJECT_ID/devices/LIVING heat 20.5",
+	}, controller.commands)
+
+	controller = &fakeController{err: errors.New("FAILED_PRECONDITION")}
+	result, err = Apply(context.Background(), controller, thermostats[0], Request{Device: "LIVING", Mode: "HEAT", Setpoint: &setpoint})
+	assert.Error(t, err)
+	assert.Empty(t, result.Applied)
+	assert.Len(t, controller.commands, 1)
+}
+
+func TestHandler(t *testing.T) {
+	controller := &fakeController{}
+	handler := NewHandler(Config{
+		Controller:  controller,
+		Thermostats: func() []*nest.Thermostat { return thermostats },
+		Label:       label,
+		Token:       "secret",
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	setpoint := 19.0
+	result, err := Send(context.Background(), nil, server.URL+"/", "secret", Request{Device: "Living-Room", Setpoint: &setpoint})
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{
+		ID:       "enterprises/PROJECT_ID/devices/LIVING",
+		DeviceID: "LIVING",
+		Label:    "Living Room",
+		Applied:  []string{"setpoint 19°C"},
+	}, result)
+	assert.Equal(t, []string{"enterprises/PROJECT_ID/devices/LIVING heat 19"}, controller.commands)
+
+	_, err = Send(context.Background(), nil, server.URL, "wrong", Request{Device: "Living-Room", Mode: "OFF"})
+	assert.True(t, errors.Is(err, errFailedRequest))
+	assert.Contains(t, err.Error(), errUnauthorized.Error())
+
+	_, err = Send(context.Background(), nil, server.URL, "secret", Request{Device: "Bedroom", Mode: "OFF"})
+	assert.Contains(t, err.Error(), errAmbiguousDevice.Error())
+	assert.Len(t, controller.commands, 1)
+
+	tests := []struct {
+		method string
+		token  string
+		body   string
+		code   int
+	}{
+		{http.MethodGet, "secret", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "", `{"device":"LIVING","mode":"OFF"}`, http.StatusUnauthorized},
+		{http.MethodPost, "secret", `{"device":`, http.StatusBadRequest},
+		{http.MethodPost, "secret", `{"device":"LIVING"}`, http.StatusBadRequest},
+		{http.MethodPost, "secret", `{"device":"KITCHEN","mode":"OFF"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, Path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, tt.code, w.Code, tt.body)
+	}
+
+	controller.err = errors.New("FAILED_PRECONDITION")
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, Path, strings.NewReader(`{"device":"LIVING","mode":"OFF"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.JSONEq(t, `{"error":"FAILED_PRECONDITION"}`, w.Body.String())
+}
+
+func TestRequireAdmin(t *testing.T) {
+	handler := RequireAdmin("TOKEN", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for token, code := range map[string]int{"": http.StatusUnauthorized, "WRONG": http.StatusUnauthorized, "TOKEN": http.StatusNoContent} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/state", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, token)
+
+		req = httptest.NewRequest(http.MethodGet, "/admin/state", nil)
+		req.SetBasicAuth("admin", token)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, "basic auth "+token)
+	}
+
+	w := httptest.NewRecorder()
+	RequireAdmin("", handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/state", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "requests are never authorized with an empty token")
+}
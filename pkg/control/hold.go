@@ -0,0 +1,490 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+const (
+	// HoldsPath is the path of the holds endpoint.
+	HoldsPath = "/api/v1/holds"
+
+	// DefaultHoldInterval is the default interval of checking whether holds start or end.
+	DefaultHoldInterval = time.Minute
+)
+
+// dateLayout is the layout of hold times on a date, in the timezone of the Scheduler.
+const dateLayout = "2006-01-02T15:04"
+
+var (
+	errInvalidHold         = errors.New("invalid hold; expected format: \"DEVICE@FROM to TO SETTINGS\", eg. \"Living-Room@fri 18:00 to sun 15:00 eco\"")
+	errInvalidHoldTime     = errors.New("invalid hold time; expected format: \"DAY HH:MM\" or \"YYYY-MM-DDTHH:MM\"")
+	errInvalidHoldWindow   = errors.New("invalid hold window; both times must be weekly or on dates, and the hold must end after it starts")
+	errEndedHold           = errors.New("the hold already ended")
+	errInvalidHoldTimezone = errors.New("invalid hold timezone")
+	errUnknownHold         = errors.New("unknown hold")
+)
+
+// weekdays maps abbreviated day names used in hold times to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Hold changes settings of a thermostat from one time to another, eg. to the eco mode from Friday 18:00 to Sunday
+// 15:00, and restores the previous settings afterwards. Times are either weekly, as "DAY HH:MM", or on a date,
+// as "YYYY-MM-DDTHH:MM". Holds on dates are removed after they end.
+type Hold struct {
+	ID string `json:"id"`
+	Request
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Active bool   `json:"active"`
+
+	from, to holdTime
+	restore  *Request
+}
+
+// holdTime is a minute of the week, counted from Sunday midnight, or a time on a date.
+type holdTime struct {
+	weekly bool
+	minute int
+	at     time.Time
+}
+
+// ParseHold parses a hold in the "DEVICE@FROM to TO SETTINGS" format, eg. "Living-Room@fri 18:00 to sun 15:00 eco".
+// Settings are parsed with ParseSettings.
+func ParseHold(entry string) (*Hold, error) {
+	i := strings.Index(entry, "@")
+	if i <= 0 {
+		return nil, errors.Wrap(errInvalidHold, entry)
+	}
+	device, rest := entry[:i], entry[i+1:]
+
+	parts := strings.SplitN(rest, " to ", 2)
+	if len(parts) != 2 {
+		return nil, errors.Wrap(errInvalidHold, entry)
+	}
+
+	// The end time is followed by the settings.
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return nil, errors.Wrap(errInvalidHold, entry)
+	}
+	n := 1
+	if _, ok := weekdays[strings.ToLower(fields[0])]; ok {
+		n = 2
+	}
+	if len(fields) <= n {
+		return nil, errors.Wrap(errInvalidHold, entry)
+	}
+
+	req, err := ParseSettings(device, fields[n:])
+	if err != nil {
+		return nil, errors.Wrap(errInvalidHold, entry)
+	}
+
+	return &Hold{Request: req, From: strings.TrimSpace(parts[0]), To: strings.Join(fields[:n], " ")}, nil
+}
+
+func parseHoldTime(text string, loc *time.Location) (holdTime, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 2 {
+		day, ok := weekdays[strings.ToLower(fields[0])]
+		at, err := time.Parse("15:04", fields[1])
+		if !ok || err != nil {
+			return holdTime{}, errors.Wrap(errInvalidHoldTime, text)
+		}
+		return holdTime{weekly: true, minute: int(day)*24*60 + at.Hour()*60 + at.Minute()}, nil
+	}
+
+	at, err := time.ParseInLocation(dateLayout, text, loc)
+	if err != nil {
+		return holdTime{}, errors.Wrap(errInvalidHoldTime, text)
+	}
+	return holdTime{at: at}, nil
+}
+
+// active returns true if the hold applies at the time. Weekly holds may wrap around the week, eg. from Saturday to
+// Monday.
+func (h *Hold) active(now time.Time, loc *time.Location) bool {
+	if !h.from.weekly {
+		return !now.Before(h.from.at) && now.Before(h.to.at)
+	}
+
+	now = now.In(loc)
+	minute := int(now.Weekday())*24*60 + now.Hour()*60 + now.Minute()
+	if h.from.minute < h.to.minute {
+		return h.from.minute <= minute && minute < h.to.minute
+	}
+	return minute >= h.from.minute || minute < h.to.minute
+}
+
+// expired returns true if the hold is on dates and ended before the time.
+func (h *Hold) expired(now time.Time) bool {
+	return !h.from.weekly && !now.Before(h.to.at)
+}
+
+// restoreRequest returns the request restoring the settings of the thermostat changed by the hold. Thermostats in
+// the eco mode are only switched back to it, as the mode under it isn't reported.
+func restoreRequest(therm *nest.Thermostat, hold Request) Request {
+	restore := Request{Device: therm.ID}
+	if therm.Mode == "ECO" {
+		if hold.EcoMode != "MANUAL_ECO" {
+			restore.EcoMode = "MANUAL_ECO"
+		}
+		return restore
+	}
+
+	if hold.EcoMode == "MANUAL_ECO" {
+		restore.EcoMode = "OFF"
+	}
+	if hold.Mode != "" && hold.Mode != therm.Mode {
+		restore.Mode = therm.Mode
+	}
+	if hold.Setpoint != nil && therm.Mode == "HEAT" {
+		setpoint := therm.SetpointTemp
+		restore.Setpoint = &setpoint
+	}
+	return restore
+}
+
+// SchedulerConfig provides the configuration necessary to create the Scheduler. Logger is optional, if it's nil
+// the Scheduler doesn't log anything. Thermostats returns current readings, it's only called when holds start or end.
+// Holds are parsed with ParseHold, their times are in the Timezone, which defaults to the local one. Interval defaults
+// to DefaultHoldInterval. Requests to the holds endpoint must be authorized with Token as a bearer token.
+type SchedulerConfig struct {
+	Logger      log.Logger
+	Controller  Controller
+	Thermostats func(ctx context.Context) ([]*nest.Thermostat, error)
+	Label       func(*nest.Thermostat) string
+	Holds       []string
+	Timezone    string
+	Interval    time.Duration
+	Token       string
+}
+
+// Scheduler starts and ends holds, and serves the holds endpoint listing, adding and removing them. Holds are kept
+// in memory, the ones added with the endpoint are lost on restarts.
+type Scheduler struct {
+	cfg      SchedulerConfig
+	location *time.Location
+
+	mu     sync.Mutex
+	holds  []*Hold
+	nextID int
+	now    func() time.Time
+
+	active      *prometheus.Desc
+	transitions *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+}
+
+// NewScheduler creates a Scheduler using the given Config. It returns an error if a hold or the timezone is invalid.
+func NewScheduler(cfg SchedulerConfig) (*Scheduler, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultHoldInterval
+	}
+	if cfg.Timezone == "" {
+		cfg.Timezone = "Local"
+	}
+
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidHoldTimezone, err.Error())
+	}
+
+	s := &Scheduler{
+		cfg:      cfg,
+		location: loc,
+		now:      time.Now,
+		active: prometheus.NewDesc("nest_hold_active",
+			"Whether the hold changed the settings of the thermostat.", []string{"hold", "device"}, nil),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nest_hold_transitions_total",
+			Help: "Number of times holds changed the settings of thermostats, by transition: start or end.",
+		}, []string{"hold", "device", "transition"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nest_hold_failures_total",
+			Help: "Number of times holds failed changing the settings of thermostats.",
+		}, []string{"hold", "device"}),
+	}
+
+	for _, entry := range cfg.Holds {
+		hold, err := ParseHold(entry)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.parse(hold); err != nil {
+			return nil, err
+		}
+
+		// Holds on past dates are left in config files after vacations, they don't prevent starting.
+		if hold.expired(s.now()) {
+			cfg.Logger.Log("level", "info", "message", "Skipped ended hold", "hold", entry)
+			continue
+		}
+		s.add(hold)
+	}
+
+	return s, nil
+}
+
+// parse validates the hold and parses its times.
+func (s *Scheduler) parse(hold *Hold) error {
+	if err := hold.Request.Validate(); err != nil {
+		return err
+	}
+
+	var err error
+	if hold.from, err = parseHoldTime(hold.From, s.location); err != nil {
+		return err
+	}
+	if hold.to, err = parseHoldTime(hold.To, s.location); err != nil {
+		return err
+	}
+
+	if hold.from.weekly != hold.to.weekly || (hold.from.weekly && hold.from.minute == hold.to.minute) ||
+		(!hold.from.weekly && !hold.to.at.After(hold.from.at)) {
+		return errors.Wrap(errInvalidHoldWindow, hold.From+" to "+hold.To)
+	}
+	return nil
+}
+
+// add adds the parsed hold with the next ID.
+func (s *Scheduler) add(hold *Hold) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	hold.ID = strconv.Itoa(s.nextID)
+	hold.Active = false
+	hold.restore = nil
+	s.holds = append(s.holds, hold)
+}
+
+// Holds returns copies of the current holds.
+func (s *Scheduler) Holds() []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holds := make([]Hold, 0, len(s.holds))
+	for _, hold := range s.holds {
+		holds = append(holds, *hold)
+	}
+	return holds
+}
+
+// Remove removes the hold, restoring the previous settings of the thermostat if it's active. The hold is kept if
+// they can't be restored.
+func (s *Scheduler) Remove(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, hold := range s.holds {
+		if hold.ID != id {
+			continue
+		}
+
+		if hold.Active {
+			if err := s.end(ctx, hold); err != nil {
+				return err
+			}
+		}
+		s.holds = append(s.holds[:i], s.holds[i+1:]...)
+		return nil
+	}
+
+	return errors.Wrap(errUnknownHold, id)
+}
+
+// Run checks whether holds start or end every interval until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.check(ctx)
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.check(ctx)
+		}
+	}
+}
+
+// check starts holds which became active and ends the ones which aren't anymore. Failed holds are retried on
+// the next check. Holds on dates are removed once they ended.
+func (s *Scheduler) check(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	holds := make([]*Hold, 0, len(s.holds))
+	for _, hold := range s.holds {
+		active := hold.active(now, s.location)
+		switch {
+		case active && !hold.Active:
+			if err := s.start(ctx, hold); err != nil {
+				s.fail(hold, "Failed starting hold", err)
+			}
+		case !active && hold.Active:
+			if err := s.end(ctx, hold); err != nil {
+				s.fail(hold, "Failed ending hold", err)
+			}
+		}
+
+		if hold.expired(now) && !hold.Active {
+			s.cfg.Logger.Log("level", "info", "message", "Removed ended hold", "hold", hold.ID, "device", hold.Device)
+			continue
+		}
+		holds = append(holds, hold)
+	}
+	s.holds = holds
+}
+
+// start remembers the settings of the thermostat, the first time the hold is started, and changes them.
+func (s *Scheduler) start(ctx context.Context, hold *Hold) error {
+	therm, err := s.find(ctx, hold.Device)
+	if err != nil {
+		return err
+	}
+
+	if hold.restore == nil {
+		restore := restoreRequest(therm, hold.Request)
+		hold.restore = &restore
+	}
+
+	result, err := Apply(ctx, s.cfg.Controller, therm, hold.Request)
+	if err != nil {
+		return err
+	}
+
+	hold.Active = true
+	s.transitions.WithLabelValues(hold.ID, hold.Device, "start").Inc()
+	s.cfg.Logger.Log("level", "info", "message", "Started hold", "hold", hold.ID, "id", therm.ID, "applied", strings.Join(result.Applied, ", "))
+	return nil
+}
+
+// end restores the settings of the thermostat remembered when the hold started.
+func (s *Scheduler) end(ctx context.Context, hold *Hold) error {
+	therm, err := s.find(ctx, hold.Device)
+	if err != nil {
+		return err
+	}
+
+	result, err := Apply(ctx, s.cfg.Controller, therm, *hold.restore)
+	if err != nil {
+		return err
+	}
+
+	hold.Active = false
+	hold.restore = nil
+	s.transitions.WithLabelValues(hold.ID, hold.Device, "end").Inc()
+	s.cfg.Logger.Log("level", "info", "message", "Ended hold", "hold", hold.ID, "id", therm.ID, "applied", strings.Join(result.Applied, ", "))
+	return nil
+}
+
+func (s *Scheduler) find(ctx context.Context, device string) (*nest.Thermostat, error) {
+	thermostats, err := s.cfg.Thermostats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Find(thermostats, device, s.cfg.Label)
+}
+
+func (s *Scheduler) fail(hold *Hold, message string, err error) {
+	s.failures.WithLabelValues(hold.ID, hold.Device).Inc()
+	s.cfg.Logger.Log("level", "error", "message", message, "hold", hold.ID, "device", hold.Device, "stack", errors.WithStack(err))
+}
+
+// ServeHTTP lists holds on GET requests, adds the POSTed Hold and removes the hold from the "id" parameter on DELETE
+// requests. Holds which should be active are started right away. Requests must send the admin token, see
+// RequireAdmin.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	RequireAdmin(s.cfg.Token, http.HandlerFunc(s.serve)).ServeHTTP(w, r)
+}
+
+func (s *Scheduler) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Holds())
+
+	case http.MethodPost:
+		var hold Hold
+		if err := json.NewDecoder(r.Body).Decode(&hold); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(errInvalidRequest, err.Error()))
+			return
+		}
+		if err := s.parse(&hold); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if hold.expired(s.now()) {
+			writeError(w, http.StatusBadRequest, errors.Wrap(errEndedHold, hold.To))
+			return
+		}
+		s.add(&hold)
+		s.check(r.Context())
+
+		s.mu.Lock()
+		added := hold
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(added)
+
+	case http.MethodDelete:
+		err := s.Remove(r.Context(), r.URL.Query().Get("id"))
+		switch {
+		case errors.Is(err, errUnknownHold):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusBadGateway, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.active
+	s.transitions.Describe(ch)
+	s.failures.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	for _, hold := range s.Holds() {
+		active := 0.0
+		if hold.Active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(s.active, prometheus.GaugeValue, active, hold.ID, hold.Device)
+	}
+	s.transitions.Collect(ch)
+	s.failures.Collect(ch)
+}
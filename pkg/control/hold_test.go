@@ -0,0 +1,191 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func TestParseHold(t *testing.T) {
+	hold, err := ParseHold("Living-Room@fri 18:00 to sun 15:00 eco")
+	assert.NoError(t, err)
+	assert.Equal(t, &Hold{Request: Request{Device: "Living-Room", EcoMode: "MANUAL_ECO"}, From: "fri 18:00", To: "sun 15:00"}, hold)
+
+	hold, err = ParseHold("LIVING@2026-12-20T10:00 to 2027-01-03T18:00 heat 12")
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-12-20T10:00", hold.From)
+	assert.Equal(t, "2027-01-03T18:00", hold.To)
+	assert.Equal(t, "HEAT", hold.Mode)
+	assert.Equal(t, 12.0, *hold.Setpoint)
+
+	for _, entry := range []string{
+		"fri 18:00 to sun 15:00 eco",
+		"Living-Room@fri 18:00 eco",
+		"Living-Room@fri 18:00 to sun 15:00",
+		"Living-Room@fri 18:00 to sun 15:00 warm",
+		"Living-Room@fri 18:00 to ",
+	} {
+		_, err := ParseHold(entry)
+		assert.True(t, errors.Is(err, errInvalidHold), entry)
+	}
+}
+
+func TestHoldActive(t *testing.T) {
+	s, err := NewScheduler(SchedulerConfig{Timezone: "UTC"})
+	assert.NoError(t, err)
+
+	weekend := &Hold{Request: Request{Device: "LIVING", EcoMode: "MANUAL_ECO"}, From: "sat 18:00", To: "mon 06:00"}
+	assert.NoError(t, s.parse(weekend))
+
+	// 2020-01-03 was a Friday.
+	assert.False(t, weekend.active(time.Date(2020, 1, 4, 17, 59, 0, 0, time.UTC), s.location))
+	assert.True(t, weekend.active(time.Date(2020, 1, 4, 18, 0, 0, 0, time.UTC), s.location))
+	assert.True(t, weekend.active(time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC), s.location))
+	assert.False(t, weekend.active(time.Date(2020, 1, 6, 6, 0, 0, 0, time.UTC), s.location))
+
+	for _, hold := range []*Hold{
+		{Request: Request{Device: "LIVING", Mode: "OFF"}, From: "sat 18:00", To: "2020-01-06T06:00"},
+		{Request: Request{Device: "LIVING", Mode: "OFF"}, From: "2020-01-06T06:00", To: "2020-01-04T18:00"},
+		{Request: Request{Device: "LIVING", Mode: "OFF"}, From: "sat 18:00", To: "sat 18:00"},
+	} {
+		assert.True(t, errors.Is(s.parse(hold), errInvalidHoldWindow), hold.From)
+	}
+	assert.True(t, errors.Is(s.parse(&Hold{Request: Request{Device: "LIVING", Mode: "OFF"}, From: "friday", To: "sat 18:00"}), errInvalidHoldTime))
+	assert.True(t, errors.Is(s.parse(&Hold{Request: Request{Device: "LIVING"}, From: "fri 18:00", To: "sat 18:00"}), errNothingToSet))
+
+	_, err = NewScheduler(SchedulerConfig{Timezone: "Mars/Olympus"})
+	assert.True(t, errors.Is(err, errInvalidHoldTimezone))
+}
+
+func testScheduler(t *testing.T, controller *fakeController, holds ...string) *Scheduler {
+	therm := &nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/LIVING", DeviceID: "LIVING", Label: "Living Room", Mode: "HEAT", SetpointTemp: 21}
+	s, err := NewScheduler(SchedulerConfig{
+		Controller:  controller,
+		Thermostats: func(context.Context) ([]*nest.Thermostat, error) { return []*nest.Thermostat{therm}, nil },
+		Label:       label,
+		Holds:       holds,
+		Timezone:    "UTC",
+		Token:       "secret",
+	})
+	assert.NoError(t, err)
+	return s
+}
+
+func TestScheduler(t *testing.T) {
+	controller := &fakeController{}
+	s := testScheduler(t, controller, "LIVING@fri 18:00 to sun 15:00 off")
+
+	now := time.Date(2020, 1, 3, 17, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	hold, err := ParseHold("Living-Room@2020-01-03T18:00 to 2020-01-05T15:00 eco")
+	assert.NoError(t, err)
+	assert.NoError(t, s.parse(hold))
+	s.add(hold)
+
+	s.check(context.Background())
+	assert.Empty(t, controller.commands)
+
+	now = now.Add(time.Hour)
+	s.check(context.Background())
+	assert.Equal(t, []string{
+		"enterprises/PROJECT_ID/devices/LIVING mode OFF",
+		"enterprises/PROJECT_ID/devices/LIVING eco MANUAL_ECO",
+	}, controller.commands)
+
+	metrics := `
+# HELP nest_hold_active Whether the hold changed the settings of the thermostat.
+# TYPE nest_hold_active gauge
+nest_hold_active{device="LIVING",hold="1"} 1
+nest_hold_active{device="Living-Room",hold="2"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(s, strings.NewReader(metrics), "nest_hold_active"))
+
+	// Failed commands are retried on the next check.
+	controller.commands = nil
+	controller.err = errors.New("UNAVAILABLE")
+	now = time.Date(2020, 1, 5, 15, 0, 0, 0, time.UTC)
+	s.check(context.Background())
+	assert.Len(t, s.Holds(), 2)
+
+	controller.commands = nil
+	controller.err = nil
+	s.check(context.Background())
+	assert.Equal(t, []string{
+		"enterprises/PROJECT_ID/devices/LIVING mode HEAT",
+		"enterprises/PROJECT_ID/devices/LIVING eco OFF",
+	}, controller.commands)
+
+	metrics = `
+# HELP nest_hold_active Whether the hold changed the settings of the thermostat.
+# TYPE nest_hold_active gauge
+nest_hold_active{device="LIVING",hold="1"} 0
+# HELP nest_hold_failures_total Number of times holds failed changing the settings of thermostats.
+# TYPE nest_hold_failures_total counter
+nest_hold_failures_total{device="LIVING",hold="1"} 1
+nest_hold_failures_total{device="Living-Room",hold="2"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(s, strings.NewReader(metrics), "nest_hold_active", "nest_hold_failures_total"))
+}
+
+func TestSchedulerSkipsEndedHolds(t *testing.T) {
+	s := testScheduler(t, &fakeController{}, "LIVING@2020-01-03T18:00 to 2020-01-05T15:00 eco")
+	assert.Empty(t, s.Holds())
+}
+
+func TestSchedulerHandler(t *testing.T) {
+	controller := &fakeController{}
+	s := testScheduler(t, controller)
+	s.now = func() time.Time { return time.Date(2020, 1, 3, 18, 0, 0, 0, time.UTC) }
+
+	request := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodPost, HoldsPath, `{"device":"LIVING","setpoint_celsius":15,"from":"2020-01-03T12:00","to":"2020-01-10T12:00"}`, "secret")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id":"1","device":"LIVING","setpoint_celsius":15,"from":"2020-01-03T12:00","to":"2020-01-10T12:00","active":true}`, w.Body.String())
+	assert.Equal(t, []string{"enterprises/PROJECT_ID/devices/LIVING heat 15"}, controller.commands)
+
+	w = request(http.MethodGet, HoldsPath, "", "secret")
+	var holds []Hold
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &holds))
+	assert.Len(t, holds, 1)
+
+	w = request(http.MethodDelete, HoldsPath+"?id=1", "", "secret")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"enterprises/PROJECT_ID/devices/LIVING heat 15", "enterprises/PROJECT_ID/devices/LIVING heat 21"}, controller.commands)
+	assert.Empty(t, s.Holds())
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		token  string
+		code   int
+	}{
+		{http.MethodGet, HoldsPath, "", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, HoldsPath, `{"device":"LIVING","mode":"OFF","from":"2020-01-01T12:00","to":"2020-01-02T12:00"}`, "secret", http.StatusBadRequest},
+		{http.MethodPost, HoldsPath, `{"device":"LIVING","mode":"OFF","from":"fri 18:00"}`, "secret", http.StatusBadRequest},
+		{http.MethodPost, HoldsPath, `{`, "secret", http.StatusBadRequest},
+		{http.MethodDelete, HoldsPath + "?id=1", "", "secret", http.StatusNotFound},
+		{http.MethodPut, HoldsPath, "", "secret", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, request(tt.method, tt.target, tt.body, tt.token).Code, tt.method+" "+tt.body)
+	}
+}
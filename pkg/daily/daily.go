@@ -0,0 +1,460 @@
+// Package daily accumulates the HVAC runtime of thermostats and the degree days of the outside temperature, both as
+// counters since the start and as gauges of the current day in the timezone of the home.
+//
+// The runtime is the time thermostats report the HEATING or COOLING status, measured between consecutive readings
+// like the runtime of the filter package. Degree days integrate the difference between the outside temperature and a
+// base temperature over time: a day 5°C below the base adds 5 heating degree days. The day starts at the reset time,
+// midnight by default, in the configured timezone, so the "today" gauges match the days of utility bills and
+// dashboards in the local time.
+//
+// The lowest and highest inside temperature and humidity of each thermostat within the current day are kept as well,
+// so they don't have to be queried with min_over_time, which depends on the retention and resolution of Prometheus.
+package daily
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+const (
+	// DefaultBaseTemperature is the base temperature of degree days in Celsius, the outside temperature above which
+	// buildings usually don't need heating.
+	DefaultBaseTemperature = 15.5
+
+	// DefaultResetTime is the local time of day at which the daily gauges reset.
+	DefaultResetTime = "00:00"
+
+	// maxGap is the longest time between readings of a thermostat which is counted as runtime. Longer gaps mean the
+	// exporter wasn't running or scraped, so it's unknown what the HVAC was doing.
+	maxGap = 30 * time.Minute
+
+	// maxWeatherGap is the longest time between outside temperatures which is counted in degree days.
+	maxWeatherGap = 2 * time.Hour
+)
+
+var (
+	errInvalidTimezone  = errors.New("invalid timezone")
+	errInvalidResetTime = errors.New("invalid daily reset time, expected HH:MM")
+)
+
+// Config provides the configuration necessary to create the Tracker. Logger is optional, if it's nil the Tracker
+// doesn't log anything. Unit is the temperature unit of degree days: celsius (default), fahrenheit, kelvin or both.
+// ThermostatUnit is the unit of the daily inside temperatures, with the same values. Timezone
+// is the IANA name of the timezone of the home, the local timezone if empty. ResetTime is the local time of day at
+// which the daily gauges reset as HH:MM, DefaultResetTime if empty. BaseTemperature is the base of degree days in
+// Celsius, DefaultBaseTemperature if 0. Labels are the labels of thermostats in the runtime and extremes metrics,
+// degree days aren't by thermostat.
+type Config struct {
+	Logger          log.Logger
+	Unit            string
+	ThermostatUnit  string
+	Timezone        string
+	ResetTime       string
+	BaseTemperature float64
+	Labels          nest.MetricLabels
+}
+
+// Tracker accumulates the runtime of thermostats and degree days and exports them.
+type Tracker struct {
+	logger     log.Logger
+	units      []string
+	thermUnits []string
+	location   *time.Location
+	resetAt    time.Duration
+	base       float64
+	labels     nest.MetricLabels
+	now        func() time.Time
+
+	mu          sync.Mutex
+	thermostats map[string]*thermostat
+	outside     *weather.Weather
+	degreeDays  map[string]*accumulator
+	extremes    map[string]*extremes
+
+	// restored contains runtimes restored for thermostats without readings yet, by ID and action.
+	restored map[string]map[string]*accumulator
+
+	runtime         *prometheus.Desc
+	runtimeToday    *prometheus.Desc
+	degreeDaysTotal map[string]*prometheus.Desc
+	degreeDaysToday map[string]*prometheus.Desc
+	tempMinToday    map[string]*prometheus.Desc
+	tempMaxToday    map[string]*prometheus.Desc
+	humidityMin     *prometheus.Desc
+	humidityMax     *prometheus.Desc
+}
+
+// thermostat is the latest reading of a thermostat and its runtime by action.
+type thermostat struct {
+	therm   *nest.Thermostat
+	at      time.Time
+	runtime map[string]*accumulator
+}
+
+// accumulator is a total since the start and the part of it within the day starting at day.
+type accumulator struct {
+	total float64
+	today float64
+	day   time.Time
+}
+
+// extremes are the lowest and highest readings of a thermostat within the day starting at day. Temperatures are in
+// Celsius.
+type extremes struct {
+	day         time.Time
+	tempMin     float64
+	tempMax     float64
+	humidityMin float64
+	humidityMax float64
+}
+
+// add updates the extremes with the reading of the day, they start over with the first reading of a new day.
+func (e *extremes) add(therm *nest.Thermostat, day time.Time) {
+	if !day.Equal(e.day) {
+		*e = extremes{day: day, tempMin: therm.AmbientTemp, tempMax: therm.AmbientTemp, humidityMin: therm.Humidity, humidityMax: therm.Humidity}
+		return
+	}
+	e.tempMin = math.Min(e.tempMin, therm.AmbientTemp)
+	e.tempMax = math.Max(e.tempMax, therm.AmbientTemp)
+	e.humidityMin = math.Min(e.humidityMin, therm.Humidity)
+	e.humidityMax = math.Max(e.humidityMax, therm.Humidity)
+}
+
+// New creates a Tracker using the given Config.
+func New(cfg Config) (*Tracker, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	exported, err := units.Parse(cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	thermUnits, err := units.Parse(cfg.ThermostatUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if cfg.Timezone == "" {
+		location, err = time.Local, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errInvalidTimezone, err.Error())
+	}
+
+	if cfg.ResetTime == "" {
+		cfg.ResetTime = DefaultResetTime
+	}
+	resetAt, err := time.Parse("15:04", cfg.ResetTime)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidResetTime, cfg.ResetTime)
+	}
+
+	if cfg.BaseTemperature == 0 {
+		cfg.BaseTemperature = DefaultBaseTemperature
+	}
+
+	t := &Tracker{
+		logger:          cfg.Logger,
+		units:           exported,
+		thermUnits:      thermUnits,
+		location:        location,
+		resetAt:         time.Duration(resetAt.Hour())*time.Hour + time.Duration(resetAt.Minute())*time.Minute,
+		base:            cfg.BaseTemperature,
+		labels:          cfg.Labels,
+		now:             time.Now,
+		thermostats:     make(map[string]*thermostat),
+		restored:        make(map[string]map[string]*accumulator),
+		degreeDays:      map[string]*accumulator{"heating": {}, "cooling": {}},
+		extremes:        make(map[string]*extremes),
+		runtime:         prometheus.NewDesc("nest_hvac_runtime_seconds_total", "HVAC runtime of the thermostat since the start.", cfg.Labels.Names("action"), nil),
+		runtimeToday:    prometheus.NewDesc("nest_hvac_runtime_today_seconds", "HVAC runtime of the thermostat since the start of the local day.", cfg.Labels.Names("action"), nil),
+		degreeDaysTotal: make(map[string]*prometheus.Desc),
+		degreeDaysToday: make(map[string]*prometheus.Desc),
+		tempMinToday:    make(map[string]*prometheus.Desc),
+		tempMaxToday:    make(map[string]*prometheus.Desc),
+		humidityMin:     prometheus.NewDesc("nest_humidity_min_today_percent", "Lowest inside humidity since the start of the local day, exported with --daily-metrics.", cfg.Labels.Names(), nil),
+		humidityMax:     prometheus.NewDesc("nest_humidity_max_today_percent", "Highest inside humidity since the start of the local day, exported with --daily-metrics.", cfg.Labels.Names(), nil),
+	}
+
+	for _, unit := range exported {
+		t.degreeDaysTotal[unit] = prometheus.NewDesc("nest_degree_days_"+unit+"_total", "Degree days of the outside temperature since the start.", []string{"kind"}, nil)
+		t.degreeDaysToday[unit] = prometheus.NewDesc("nest_degree_days_today_"+unit, "Degree days of the outside temperature since the start of the local day.", []string{"kind"}, nil)
+	}
+	for _, unit := range thermUnits {
+		t.tempMinToday[unit] = prometheus.NewDesc("nest_ambient_temperature_min_today_"+unit, "Lowest inside temperature since the start of the local day, exported with --daily-metrics.", cfg.Labels.Names(), nil)
+		t.tempMaxToday[unit] = prometheus.NewDesc("nest_ambient_temperature_max_today_"+unit, "Highest inside temperature since the start of the local day, exported with --daily-metrics.", cfg.Labels.Names(), nil)
+	}
+
+	return t, nil
+}
+
+// dayStart returns the start of the local day containing the given time, at the reset time in the timezone of the
+// home. On days with a daylight saving time change, the reset time is the wall clock time.
+func (t *Tracker) dayStart(at time.Time) time.Time {
+	local := at.In(t.location)
+	hour, minute := int(t.resetAt/time.Hour), int(t.resetAt%time.Hour/time.Minute)
+
+	start := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, t.location)
+	if start.After(at) {
+		start = time.Date(local.Year(), local.Month(), local.Day()-1, hour, minute, 0, 0, t.location)
+	}
+	return start
+}
+
+// add adds the given rate per second over the time between from and to to the accumulator. Only the part after the
+// start of the day of to counts towards today, the daily part resets when a new day starts.
+func (t *Tracker) add(acc *accumulator, from, to time.Time, rate float64) {
+	acc.total += to.Sub(from).Seconds() * rate
+
+	day := t.dayStart(to)
+	if !day.Equal(acc.day) {
+		acc.today = 0
+		acc.day = day
+	}
+	if from.Before(day) {
+		from = day
+	}
+	acc.today += to.Sub(from).Seconds() * rate
+}
+
+// today returns the part of the accumulator within the current day, which is 0 if nothing was added since it started.
+func (t *Tracker) today(acc *accumulator, now time.Time) float64 {
+	if !t.dayStart(now).Equal(acc.day) {
+		return 0
+	}
+	return acc.today
+}
+
+// ThermostatListener returns a nest.Listener adding the time since the previous reading to the runtime of
+// thermostats which were heating or cooling, and updating their daily extremes. It must be registered with
+// nest.WithUpdateListener, as only new readings add runtime.
+func (t *Tracker) ThermostatListener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, therm := range thermostats {
+			at := therm.UpdatedAt
+			if at.IsZero() {
+				at = t.now()
+			}
+
+			prev, ok := t.thermostats[therm.ID]
+			if !ok {
+				prev = &thermostat{runtime: map[string]*accumulator{"heating": {}, "cooling": {}}}
+				if runtime, restored := t.restored[therm.ID]; restored {
+					prev.runtime = runtime
+					delete(t.restored, therm.ID)
+				}
+				t.thermostats[therm.ID] = prev
+			}
+
+			if ok && at.Sub(prev.at) <= maxGap {
+				switch prev.therm.Status {
+				case "HEATING":
+					t.add(prev.runtime["heating"], prev.at, at, 1)
+				case "COOLING":
+					t.add(prev.runtime["cooling"], prev.at, at, 1)
+				}
+			}
+			prev.therm, prev.at = therm, at
+
+			ext, ok := t.extremes[therm.ID]
+			if !ok {
+				ext = &extremes{}
+				t.extremes[therm.ID] = ext
+			}
+			ext.add(therm, t.dayStart(at))
+		}
+	}
+}
+
+// WeatherListener returns a weather.Listener adding the degree days of the previous outside temperature until the
+// time of the reading.
+func (t *Tracker) WeatherListener() weather.Listener {
+	return func(w *weather.Weather) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		prev := t.outside
+		if prev != nil && !w.UpdatedAt.After(prev.UpdatedAt) {
+			return
+		}
+		t.outside = w
+
+		if prev == nil || w.UpdatedAt.Sub(prev.UpdatedAt) > maxWeatherGap {
+			return
+		}
+
+		temp := units.ToCelsius(prev.Temperature, prev.Unit)
+
+		// Degree days are accumulated per second, a day has 86400 seconds.
+		if temp < t.base {
+			t.add(t.degreeDays["heating"], prev.UpdatedAt, w.UpdatedAt, (t.base-temp)/86400)
+		} else {
+			t.add(t.degreeDays["cooling"], prev.UpdatedAt, w.UpdatedAt, (temp-t.base)/86400)
+		}
+	}
+}
+
+// State contains the runtimes and degree days of a Tracker, so they can be moved to another exporter.
+type State struct {
+	Runtime    map[string]map[string]AccumulatorState `json:"runtime_seconds"`
+	DegreeDays map[string]AccumulatorState            `json:"degree_days_celsius"`
+	Extremes   map[string]ExtremesState               `json:"extremes,omitempty"`
+}
+
+// AccumulatorState is a total since the start and the part of it within the day starting at Day.
+type AccumulatorState struct {
+	Total float64   `json:"total"`
+	Today float64   `json:"today"`
+	Day   time.Time `json:"day"`
+}
+
+// ExtremesState contains the lowest and highest readings of a thermostat within the day starting at Day.
+// Temperatures are in Celsius.
+type ExtremesState struct {
+	Day         time.Time `json:"day"`
+	TempMin     float64   `json:"ambient_temperature_min_celsius"`
+	TempMax     float64   `json:"ambient_temperature_max_celsius"`
+	HumidityMin float64   `json:"humidity_min_percent"`
+	HumidityMax float64   `json:"humidity_max_percent"`
+}
+
+// MarshalState returns the runtimes of thermostats by ID and action, the degree days by kind and the daily extremes
+// of thermostats by ID, encoded as JSON.
+func (t *Tracker) MarshalState() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := State{
+		Runtime:    make(map[string]map[string]AccumulatorState),
+		DegreeDays: accumulatorStates(t.degreeDays),
+		Extremes:   make(map[string]ExtremesState, len(t.extremes)),
+	}
+	for id, ext := range t.extremes {
+		s.Extremes[id] = ExtremesState{Day: ext.day, TempMin: ext.tempMin, TempMax: ext.tempMax, HumidityMin: ext.humidityMin, HumidityMax: ext.humidityMax}
+	}
+	for id, runtime := range t.restored {
+		s.Runtime[id] = accumulatorStates(runtime)
+	}
+	for id, therm := range t.thermostats {
+		s.Runtime[id] = accumulatorStates(therm.runtime)
+	}
+	return json.Marshal(s)
+}
+
+// RestoreState replaces the runtimes and degree days with the ones encoded by MarshalState, ignoring unknown actions
+// and kinds. Runtimes of thermostats without readings yet are used once their first reading arrives.
+func (t *Tracker) RestoreState(data []byte) error {
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, states := range s.Runtime {
+		runtime := map[string]*accumulator{"heating": {}, "cooling": {}}
+		for action, state := range states {
+			if _, ok := runtime[action]; ok {
+				runtime[action] = &accumulator{total: state.Total, today: state.Today, day: state.Day}
+			}
+		}
+
+		if therm, ok := t.thermostats[id]; ok {
+			therm.runtime = runtime
+		} else {
+			t.restored[id] = runtime
+		}
+	}
+	for kind, state := range s.DegreeDays {
+		if _, ok := t.degreeDays[kind]; ok {
+			t.degreeDays[kind] = &accumulator{total: state.Total, today: state.Today, day: state.Day}
+		}
+	}
+	for id, state := range s.Extremes {
+		t.extremes[id] = &extremes{day: state.Day, tempMin: state.TempMin, tempMax: state.TempMax, humidityMin: state.HumidityMin, humidityMax: state.HumidityMax}
+	}
+	return nil
+}
+
+func accumulatorStates(accumulators map[string]*accumulator) map[string]AccumulatorState {
+	states := make(map[string]AccumulatorState, len(accumulators))
+	for name, acc := range accumulators {
+		states[name] = AccumulatorState{Total: acc.total, Today: acc.today, Day: acc.day}
+	}
+	return states
+}
+
+// Describe implements the prometheus.Collector interface.
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.runtime
+	ch <- t.runtimeToday
+	for _, unit := range t.units {
+		ch <- t.degreeDaysTotal[unit]
+		ch <- t.degreeDaysToday[unit]
+	}
+	for _, unit := range t.thermUnits {
+		ch <- t.tempMinToday[unit]
+		ch <- t.tempMaxToday[unit]
+	}
+	ch <- t.humidityMin
+	ch <- t.humidityMax
+}
+
+// Collect implements the prometheus.Collector interface. The runtime is only exported for the actions the HVAC of a
+// thermostat is capable of or ran, daily extremes only after the first reading of the day, and degree days only after
+// the first outside temperature.
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for id, latest := range t.thermostats {
+		labels := t.labels.Values(latest.therm)
+		for action, acc := range latest.runtime {
+			capable := (action == "heating" && latest.therm.CanHeat()) || (action == "cooling" && latest.therm.CanCool())
+			if !capable && acc.total == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(t.runtime, prometheus.CounterValue, acc.total, append(labels, action)...)
+			ch <- prometheus.MustNewConstMetric(t.runtimeToday, prometheus.GaugeValue, t.today(acc, now), append(labels, action)...)
+		}
+
+		if ext, ok := t.extremes[id]; ok && ext.day.Equal(t.dayStart(now)) {
+			for _, unit := range t.thermUnits {
+				ch <- prometheus.MustNewConstMetric(t.tempMinToday[unit], prometheus.GaugeValue, units.FromCelsius(ext.tempMin, unit), labels...)
+				ch <- prometheus.MustNewConstMetric(t.tempMaxToday[unit], prometheus.GaugeValue, units.FromCelsius(ext.tempMax, unit), labels...)
+			}
+			ch <- prometheus.MustNewConstMetric(t.humidityMin, prometheus.GaugeValue, ext.humidityMin, labels...)
+			ch <- prometheus.MustNewConstMetric(t.humidityMax, prometheus.GaugeValue, ext.humidityMax, labels...)
+		}
+	}
+
+	if t.outside == nil {
+		return
+	}
+
+	for kind, acc := range t.degreeDays {
+		for _, unit := range t.units {
+			// Degree days are temperature differences, so they're converted without an offset.
+			ch <- prometheus.MustNewConstMetric(t.degreeDaysTotal[unit], prometheus.CounterValue, units.DiffFromCelsius(acc.total, unit), kind)
+			ch <- prometheus.MustNewConstMetric(t.degreeDaysToday[unit], prometheus.GaugeValue, units.DiffFromCelsius(t.today(acc, now), unit), kind)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package daily
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+// reading returns a reading of the thermostat with the given status at the given time.
+func reading(status string, at time.Time) []*nest.Thermostat {
+	return []*nest.Thermostat{{
+		ID:             "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:       "DEVICE_ID",
+		Label:          "Living Room",
+		Status:         status,
+		AvailableModes: []string{"HEAT", "OFF"},
+		UpdatedAt:      at,
+	}}
+}
+
+var runtimeMetrics = []string{"nest_hvac_runtime_seconds_total", "nest_hvac_runtime_today_seconds"}
+
+func TestRuntime(t *testing.T) {
+	tracker, err := New(Config{Timezone: "Europe/Berlin", Labels: nest.MetricLabels{Label: func(therm *nest.Thermostat) string { return strings.Replace(therm.Label, " ", "-", -1) }}})
+	assert.NoError(t, err)
+
+	// 22:50 UTC is 23:50 in Berlin, the heating runs for 10 minutes before and after the local midnight.
+	start := time.Date(2021, 1, 1, 22, 50, 0, 0, time.UTC)
+	tracker.ThermostatListener()(reading("HEATING", start))
+	tracker.ThermostatListener()(reading("HEATING", start.Add(20*time.Minute)))
+	tracker.now = func() time.Time { return start.Add(20 * time.Minute) }
+
+	expected := `
+# HELP nest_hvac_runtime_seconds_total HVAC runtime of the thermostat since the start.
+# TYPE nest_hvac_runtime_seconds_total counter
+nest_hvac_runtime_seconds_total{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 1200
+# HELP nest_hvac_runtime_today_seconds HVAC runtime of the thermostat since the start of the local day.
+# TYPE nest_hvac_runtime_today_seconds gauge
+nest_hvac_runtime_today_seconds{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 600
+`
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(expected), runtimeMetrics...), "the cooling runtime of a heat-only system isn't exported")
+
+	// The daily runtime resets at the next local midnight even without readings, the total keeps counting.
+	tracker.now = func() time.Time { return start.Add(26 * time.Hour) }
+	tracker.ThermostatListener()(reading("OFF", start.Add(40*time.Minute)))
+	expected = `
+# HELP nest_hvac_runtime_seconds_total HVAC runtime of the thermostat since the start.
+# TYPE nest_hvac_runtime_seconds_total counter
+nest_hvac_runtime_seconds_total{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 2400
+# HELP nest_hvac_runtime_today_seconds HVAC runtime of the thermostat since the start of the local day.
+# TYPE nest_hvac_runtime_today_seconds gauge
+nest_hvac_runtime_today_seconds{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(expected), runtimeMetrics...))
+
+	// Gaps longer than maxGap aren't counted.
+	tracker.ThermostatListener()(reading("HEATING", start.Add(time.Hour)))
+	tracker.ThermostatListener()(reading("HEATING", start.Add(2*time.Hour)))
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(expected), runtimeMetrics...))
+}
+
+func TestExtremes(t *testing.T) {
+	tracker, err := New(Config{ThermostatUnit: "both", Timezone: "UTC"})
+	assert.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 22, 0, 0, 0, time.UTC)
+	for i, temp := range []float64{20, 18.5, 21, 19} {
+		therm := reading("OFF", start.Add(time.Duration(i)*time.Hour))
+		therm[0].AmbientTemp, therm[0].Humidity = temp, 40+temp
+		tracker.ThermostatListener()(therm)
+	}
+	tracker.now = func() time.Time { return start.Add(3 * time.Hour) }
+
+	labels := `device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"`
+	expected := `
+# HELP nest_ambient_temperature_max_today_celsius Highest inside temperature since the start of the local day, exported with --daily-metrics.
+# TYPE nest_ambient_temperature_max_today_celsius gauge
+nest_ambient_temperature_max_today_celsius{` + labels + `} 21
+# HELP nest_ambient_temperature_min_today_fahrenheit Lowest inside temperature since the start of the local day, exported with --daily-metrics.
+# TYPE nest_ambient_temperature_min_today_fahrenheit gauge
+nest_ambient_temperature_min_today_fahrenheit{` + labels + `} 66.2
+# HELP nest_humidity_min_today_percent Lowest inside humidity since the start of the local day, exported with --daily-metrics.
+# TYPE nest_humidity_min_today_percent gauge
+nest_humidity_min_today_percent{` + labels + `} 59
+`
+	metrics := []string{"nest_ambient_temperature_max_today_celsius", "nest_ambient_temperature_min_today_fahrenheit", "nest_humidity_min_today_percent"}
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(expected), metrics...), "readings of the previous day don't count")
+
+	// Extremes are restored, and aren't exported once the day is over.
+	data, err := tracker.MarshalState()
+	assert.NoError(t, err)
+	restored, err := New(Config{Timezone: "UTC"})
+	assert.NoError(t, err)
+	assert.NoError(t, restored.RestoreState(data))
+	restored.ThermostatListener()(reading("OFF", start.Add(4*time.Hour)))
+	restored.now = func() time.Time { return start.Add(4 * time.Hour) }
+	expected = `
+# HELP nest_ambient_temperature_max_today_celsius Highest inside temperature since the start of the local day, exported with --daily-metrics.
+# TYPE nest_ambient_temperature_max_today_celsius gauge
+nest_ambient_temperature_max_today_celsius{` + labels + `} 21
+# HELP nest_ambient_temperature_min_today_celsius Lowest inside temperature since the start of the local day, exported with --daily-metrics.
+# TYPE nest_ambient_temperature_min_today_celsius gauge
+nest_ambient_temperature_min_today_celsius{` + labels + `} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(restored, strings.NewReader(expected), "nest_ambient_temperature_max_today_celsius", "nest_ambient_temperature_min_today_celsius"))
+
+	restored.now = func() time.Time { return start.Add(26 * time.Hour) }
+	assert.NoError(t, testutil.CollectAndCompare(restored, strings.NewReader(""), "nest_ambient_temperature_max_today_celsius"), "extremes of a past day aren't exported")
+}
+
+func TestResetTime(t *testing.T) {
+	tracker, err := New(Config{Timezone: "UTC", ResetTime: "06:00"})
+	assert.NoError(t, err)
+
+	at := time.Date(2021, 1, 2, 5, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, 1, 1, 6, 0, 0, 0, time.UTC), tracker.dayStart(at).UTC(), "the day before the reset time belongs to the previous day")
+	assert.Equal(t, time.Date(2021, 1, 2, 6, 0, 0, 0, time.UTC), tracker.dayStart(at.Add(time.Hour)).UTC())
+
+	for _, cfg := range []Config{{ResetTime: "6am"}, {Timezone: "Mars/Olympus_Mons"}, {Unit: "rankine"}} {
+		_, err := New(cfg)
+		assert.Error(t, err)
+	}
+}
+
+func TestDegreeDays(t *testing.T) {
+	tracker, err := New(Config{Unit: "both", Timezone: "UTC"})
+	assert.NoError(t, err)
+
+	// 12 hours at 5.5°C, 10 degrees below the base, then 6 hours at 50°F.
+	start := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	for hour := 0; hour <= 18; hour++ {
+		w := &weather.Weather{Temperature: 5.5, Unit: units.Celsius, UpdatedAt: start.Add(time.Duration(hour) * time.Hour)}
+		if hour >= 12 {
+			w.Temperature, w.Unit = 50, units.Fahrenheit
+		}
+		tracker.WeatherListener()(w)
+	}
+	tracker.now = func() time.Time { return start.Add(18 * time.Hour) }
+
+	// 10 * 12/24 + 5.5 * 6/24 degree days, of which the 6 hours after midnight count today.
+	assert.InDelta(t, 6.375, value(tracker, "nest_degree_days_celsius_total", "heating"), 1e-9)
+	assert.InDelta(t, 6.375*9/5, value(tracker, "nest_degree_days_fahrenheit_total", "heating"), 1e-9)
+	assert.InDelta(t, 1.375, value(tracker, "nest_degree_days_today_celsius", "heating"), 1e-9)
+	assert.Equal(t, 0.0, value(tracker, "nest_degree_days_today_celsius", "cooling"))
+}
+
+// value returns the value of the metric with the given name and kind.
+func value(tracker *Tracker, name, kind string) float64 {
+	ch := make(chan prometheus.Metric, 20)
+	tracker.Collect(ch)
+	close(ch)
+
+	for metric := range ch {
+		var m dto.Metric
+		metric.Write(&m)
+		if strings.Contains(metric.Desc().String(), `"`+name+`"`) && m.GetLabel()[0].GetValue() == kind {
+			if m.GetCounter() != nil {
+				return m.GetCounter().GetValue()
+			}
+			return m.GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestState(t *testing.T) {
+	tracker, err := New(Config{Timezone: "Europe/Berlin"})
+	assert.NoError(t, err)
+
+	start := time.Date(2021, 1, 1, 22, 50, 0, 0, time.UTC)
+	tracker.ThermostatListener()(reading("HEATING", start))
+	tracker.ThermostatListener()(reading("HEATING", start.Add(20*time.Minute)))
+	data, err := tracker.MarshalState()
+	assert.NoError(t, err)
+
+	// Runtimes are restored in another tracker once the thermostat is read.
+	restored, err := New(Config{Timezone: "Europe/Berlin"})
+	assert.NoError(t, err)
+	assert.NoError(t, restored.RestoreState(data))
+	restored.ThermostatListener()(reading("OFF", start.Add(30*time.Minute)))
+	restored.now = func() time.Time { return start.Add(30 * time.Minute) }
+
+	expected := `
+# HELP nest_hvac_runtime_seconds_total HVAC runtime of the thermostat since the start.
+# TYPE nest_hvac_runtime_seconds_total counter
+nest_hvac_runtime_seconds_total{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"} 1200
+# HELP nest_hvac_runtime_today_seconds HVAC runtime of the thermostat since the start of the local day.
+# TYPE nest_hvac_runtime_today_seconds gauge
+nest_hvac_runtime_today_seconds{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living Room"} 600
+`
+	assert.NoError(t, testutil.CollectAndCompare(restored, strings.NewReader(expected), runtimeMetrics...))
+
+	again, err := restored.MarshalState()
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(data), string(again))
+
+	assert.Error(t, restored.RestoreState([]byte(`[]`)))
+}
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errRemoteDebugAddr      = errors.New("debug endpoints must listen on a loopback address, eg. localhost:6060, unless remote access is allowed")
+	errFailedListeningDebug = errors.New("failed listening for debug requests")
+)
+
+// debugExporter is the exporter described by the "pronestheus" expvar. Variables can't be unpublished, so the
+// variable is published once and describes the latest exporter with debug endpoints.
+var debugExporter struct {
+	sync.Once
+	sync.Mutex
+	exporter *Exporter
+}
+
+// startDebugServer serves pprof profiles and expvar variables on a separate address, so they're never exposed next to
+// metrics. Unless remote access is allowed, the address must be a loopback address.
+func (e *Exporter) startDebugServer(cfg *ExporterConfig) error {
+	if cfg.DebugListenAddr == nil || *cfg.DebugListenAddr == "" {
+		return nil
+	}
+
+	if !(cfg.DebugAllowRemote != nil && *cfg.DebugAllowRemote) && !loopback(*cfg.DebugListenAddr) {
+		return errors.Wrap(errRemoteDebugAddr, *cfg.DebugListenAddr)
+	}
+
+	listener, err := net.Listen("tcp", *cfg.DebugListenAddr)
+	if err != nil {
+		return errors.Wrap(errFailedListeningDebug, err.Error())
+	}
+
+	debugExporter.Lock()
+	debugExporter.exporter = e
+	debugExporter.Unlock()
+	debugExporter.Do(func() { expvar.Publish("pronestheus", expvar.Func(debugVars)) })
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-e.ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			e.logger.Log("level", "error", "msg", "Failed serving debug endpoints", "stack", errors.WithStack(err))
+		}
+	}()
+
+	e.logger.Log("level", "info", "msg", "Serving debug endpoints", "addr", listener.Addr().String())
+	return nil
+}
+
+// loopback returns true if the host of the address is localhost or a loopback IP. An empty host listens on all
+// interfaces.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// debugVars returns the state of the exporter published as the "pronestheus" expvar.
+func debugVars() interface{} {
+	debugExporter.Lock()
+	e := debugExporter.exporter
+	debugExporter.Unlock()
+
+	routes := make([]string, 0, len(e.routes))
+	for path := range e.routes {
+		routes = append(routes, path)
+	}
+	sort.Strings(routes)
+
+	vars := map[string]interface{}{
+		"started_at":  e.startedAt,
+		"goroutines":  runtime.NumGoroutine(),
+		"thermostats": len(e.api.Thermostats()),
+		"weather":     e.api.Weather() != nil,
+		"routes":      routes,
+	}
+	if e.elector != nil {
+		vars["leader"] = e.elector.IsLeader()
+	}
+
+	return vars
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// Output formats supported by ListDevices.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+var errInvalidFormat = errors.New("invalid output format; valid values: [table, json]")
+
+// ListDevices prints all devices available in the Device Access project, with their rooms and supported traits,
+// in the given format.
+func ListDevices(cfg *ExporterConfig, out io.Writer, format string) error {
+	if format != FormatTable && format != FormatJSON {
+		return errInvalidFormat
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	nestCollector, err := nest.New(*cfg.NestProjectID, nestOptions(cfg, nil)...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	devices, err := nestCollector.Devices(ctx)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(devices)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tROOM\tTRAITS")
+	for _, device := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", device.ID, device.Type, device.Room, strings.Join(device.Traits, ","))
+	}
+
+	return w.Flush()
+}
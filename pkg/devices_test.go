@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/test"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDevicesTable(t *testing.T) {
+	nestServ := test.NestServer()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+
+	var out bytes.Buffer
+	err := ListDevices(cfg, &out, FormatTable)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "ID")
+	assert.Contains(t, out.String(), "enterprises/PROJECT_ID/devices/DEVICE_ID")
+	assert.Contains(t, out.String(), "Living Room")
+	assert.Contains(t, out.String(), "sdm.devices.traits.Connectivity,sdm.devices.traits.Fan")
+}
+
+func TestListDevicesJSON(t *testing.T) {
+	nestServ := test.NestServer()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+
+	var out bytes.Buffer
+	err := ListDevices(cfg, &out, FormatJSON)
+	assert.NoError(t, err)
+
+	var devices []*nest.Device
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &devices))
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "sdm.devices.types.THERMOSTAT", devices[0].Type)
+	assert.Equal(t, "Living Room", devices[0].Room)
+	assert.Len(t, devices[0].Traits, 10)
+}
+
+func TestListDevicesInvalidFormat(t *testing.T) {
+	var out bytes.Buffer
+	err := ListDevices(testConfig(), &out, "yaml")
+
+	assert.True(t, errors.Is(err, errInvalidFormat))
+}
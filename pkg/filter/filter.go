@@ -0,0 +1,312 @@
+// Package filter accumulates the HVAC runtime of thermostats since their furnace filter was last changed, so users
+// can be reminded to change it.
+//
+// The runtime is the time thermostats report the HEATING or COOLING status, measured between consecutive readings.
+// The Smart Device Management API doesn't report when only the fan is running, so fan-only runtime isn't counted.
+// Runtimes are stored in a JSON file to survive restarts, and reset with a POST request to ResetPath once the filter
+// is changed.
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// ResetPath is the path of the endpoint resetting runtimes.
+const ResetPath = "/-/filter/reset"
+
+// DefaultFlushInterval is the interval of writing changed runtimes to the state file.
+const DefaultFlushInterval = time.Minute
+
+// maxGap is the longest time between readings which is counted as runtime. Longer gaps mean the exporter wasn't
+// running or scraped, so it's unknown what the HVAC was doing.
+const maxGap = 30 * time.Minute
+
+var (
+	errFailedLoading  = errors.New("failed loading filter runtime state file")
+	errFailedWriting  = errors.New("failed writing filter runtime state file")
+	errUnknownDevice  = errors.New("unknown thermostat")
+	errInvalidRequest = errors.New("runtimes are only reset with POST requests")
+)
+
+// Config provides the configuration necessary to create the Tracker. Logger is optional, if it's nil the Tracker
+// doesn't log anything. FlushInterval defaults to DefaultFlushInterval. Runtimes are saved by resource name, whatever
+// the Labels of their metrics.
+type Config struct {
+	Logger        log.Logger
+	Path          string
+	FlushInterval time.Duration
+	Labels        nest.MetricLabels
+}
+
+// Tracker accumulates the runtime of thermostats and exports it.
+type Tracker struct {
+	logger        log.Logger
+	path          string
+	flushInterval time.Duration
+	labels        nest.MetricLabels
+	now           func() time.Time
+
+	mu          sync.Mutex
+	runtimes    map[string]*Runtime
+	thermostats map[string]*reading
+	dirty       bool
+
+	runtime   *prometheus.Desc
+	lastReset *prometheus.Desc
+}
+
+// Runtime is the accumulated runtime of a thermostat, as stored in the state file.
+type Runtime struct {
+	Seconds float64   `json:"runtime_seconds"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// reading is the latest reading of a thermostat, runtime is accumulated between readings.
+type reading struct {
+	therm *nest.Thermostat
+	at    time.Time
+}
+
+// New creates a Tracker using the given Config, loading runtimes from its state file if it exists.
+func New(cfg Config) (*Tracker, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+
+	t := &Tracker{
+		logger:        cfg.Logger,
+		path:          cfg.Path,
+		flushInterval: cfg.FlushInterval,
+		labels:        cfg.Labels,
+		now:           time.Now,
+		runtimes:      make(map[string]*Runtime),
+		thermostats:   make(map[string]*reading),
+		runtime:       prometheus.NewDesc("nest_filter_runtime_hours", "HVAC runtime since the filter runtime was last reset.", cfg.Labels.Names(), nil),
+		lastReset:     prometheus.NewDesc("nest_filter_last_reset_timestamp_seconds", "Time the filter runtime was last reset.", cfg.Labels.Names(), nil),
+	}
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(errFailedLoading, err.Error())
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &t.runtimes); err != nil {
+			return nil, errors.Wrap(errFailedLoading, err.Error())
+		}
+	}
+
+	return t, nil
+}
+
+// Listener returns a nest.Listener adding the time since the previous reading to the runtime of thermostats which
+// were heating or cooling. It must be registered with nest.WithUpdateListener, as only new readings add runtime.
+func (t *Tracker) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, therm := range thermostats {
+			at := therm.UpdatedAt
+			if at.IsZero() {
+				at = t.now()
+			}
+
+			r, ok := t.runtimes[therm.ID]
+			if !ok {
+				r = &Runtime{ResetAt: at.UTC()}
+				t.runtimes[therm.ID] = r
+				t.dirty = true
+			}
+
+			prev, ok := t.thermostats[therm.ID]
+			if ok && running(prev.therm.Status) {
+				if gap := at.Sub(prev.at); gap <= maxGap {
+					r.Seconds += gap.Seconds()
+					t.dirty = true
+				}
+			}
+			t.thermostats[therm.ID] = &reading{therm: therm, at: at}
+		}
+	}
+}
+
+// running returns true if the HVAC status means the equipment is running.
+func running(status string) bool {
+	return status == "HEATING" || status == "COOLING"
+}
+
+// Reset resets the runtime of the thermostat with the given ID or device ID, or of all thermostats if it's empty.
+func (t *Tracker) Reset(device string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	reset := false
+	for id, r := range t.runtimes {
+		if device != "" && id != device && !t.matchesDevice(id, device) {
+			continue
+		}
+		r.Seconds = 0
+		r.ResetAt = now
+		reset = true
+	}
+
+	if !reset && device != "" {
+		return errors.Wrap(errUnknownDevice, device)
+	}
+
+	t.logger.Log("level", "info", "message", "Reset filter runtime", "device", device)
+	return t.save()
+}
+
+// matchesDevice returns true if the thermostat with the given ID has the device ID.
+func (t *Tracker) matchesDevice(id, device string) bool {
+	r, ok := t.thermostats[id]
+	return ok && r.therm.DeviceID == device
+}
+
+// Run writes changed runtimes to the state file on the flush interval until the context is cancelled, and once more
+// before returning.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.flush()
+			return
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// flush writes runtimes to the state file if they changed since the last write, logging errors.
+func (t *Tracker) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.dirty {
+		return
+	}
+
+	if err := t.save(); err != nil {
+		t.logger.Log("level", "error", "message", "Failed saving filter runtime", "stack", errors.WithStack(err))
+	}
+}
+
+// save atomically replaces the state file with the current runtimes. The caller must hold the lock.
+func (t *Tracker) save() error {
+	data, err := json.MarshalIndent(t.runtimes, "", "  ")
+	if err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	tmp := t.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	if err := os.Rename(tmp, t.path); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	t.dirty = false
+	return nil
+}
+
+// ServeHTTP resets runtimes on POST requests, of the thermostat from the "device" parameter or of all thermostats.
+// It doesn't authorize requests, the exporter serves it behind control.RequireAdmin.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errInvalidRequest)
+		return
+	}
+
+	err := t.Reset(r.URL.Query().Get("device"))
+	if errors.Is(err, errUnknownDevice) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// MarshalState returns the runtimes of all thermostats encoded as JSON, like in the state file.
+func (t *Tracker) MarshalState() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return json.Marshal(t.runtimes)
+}
+
+// RestoreState replaces the runtimes of thermostats with the ones encoded by MarshalState. Runtimes of thermostats
+// missing in the data are kept. The state file is written on the next flush.
+func (t *Tracker) RestoreState(data []byte) error {
+	var runtimes map[string]*Runtime
+	if err := json.Unmarshal(data, &runtimes); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, r := range runtimes {
+		t.runtimes[id] = r
+	}
+	t.dirty = true
+	return nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.runtime
+	ch <- t.lastReset
+}
+
+// Collect implements the prometheus.Collector interface. Only thermostats with readings since the start are
+// exported, so thermostats removed from the account disappear.
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, latest := range t.thermostats {
+		r := t.runtimes[id]
+		labels := t.labels.Values(latest.therm)
+		ch <- prometheus.MustNewConstMetric(t.runtime, prometheus.GaugeValue, r.Seconds/3600, labels...)
+		ch <- prometheus.MustNewConstMetric(t.lastReset, prometheus.GaugeValue, float64(r.ResetAt.Unix()), labels...)
+	}
+}
@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func newTestTracker(t *testing.T) (*Tracker, string) {
+	dir, err := ioutil.TempDir("", "filter")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "filter.json")
+	tracker, err := New(Config{Path: path})
+	assert.NoError(t, err)
+
+	return tracker, path
+}
+
+func thermostats(status string, at time.Time) []*nest.Thermostat {
+	return []*nest.Thermostat{{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID", DeviceID: "DEVICE_ID", Label: "Living-Room", Status: status, UpdatedAt: at}}
+}
+
+func TestRuntime(t *testing.T) {
+	tracker, path := newTestTracker(t)
+	listener := tracker.Listener()
+	start := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	listener(thermostats("HEATING", start))
+	listener(thermostats("HEATING", start.Add(30*time.Minute)))
+	listener(thermostats("HEATING", start.Add(30*time.Minute)))
+	listener(thermostats("OFF", start.Add(90*time.Minute)))
+	listener(thermostats("COOLING", start.Add(2*time.Hour)))
+	// The gap is too long to be counted.
+	listener(thermostats("OFF", start.Add(5*time.Hour)))
+
+	metrics := `
+		# HELP nest_filter_runtime_hours HVAC runtime since the filter runtime was last reset.
+		# TYPE nest_filter_runtime_hours gauge
+		nest_filter_runtime_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 0.5
+	`
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(metrics), "nest_filter_runtime_hours"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tracker.Run(ctx)
+
+	restored, err := New(Config{Path: path})
+	assert.NoError(t, err)
+	assert.Equal(t, &Runtime{Seconds: 1800, ResetAt: start}, restored.runtimes["enterprises/PROJECT_ID/devices/DEVICE_ID"])
+}
+
+func TestReset(t *testing.T) {
+	tracker, path := newTestTracker(t)
+	now := time.Date(2020, 12, 2, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+
+	listener := tracker.Listener()
+	listener(thermostats("HEATING", now.Add(-time.Hour)))
+	listener(thermostats("HEATING", now.Add(-30*time.Minute)))
+
+	w := httptest.NewRecorder()
+	tracker.ServeHTTP(w, httptest.NewRequest(http.MethodPost, ResetPath+"?device=UNKNOWN", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	tracker.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ResetPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	tracker.ServeHTTP(w, httptest.NewRequest(http.MethodPost, ResetPath+"?device=DEVICE_ID", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	metrics := `
+		# HELP nest_filter_last_reset_timestamp_seconds Time the filter runtime was last reset.
+		# TYPE nest_filter_last_reset_timestamp_seconds gauge
+		nest_filter_last_reset_timestamp_seconds{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 1.6069032e+09
+		# HELP nest_filter_runtime_hours HVAC runtime since the filter runtime was last reset.
+		# TYPE nest_filter_runtime_hours gauge
+		nest_filter_runtime_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 0
+	`
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(metrics)))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"reset_at": "2020-12-02T10:00:00Z"`, "resets are saved right away")
+}
+
+func TestRestoreState(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	start := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	tracker.Listener()(thermostats("HEATING", start))
+
+	err := tracker.RestoreState([]byte(`{"enterprises/PROJECT_ID/devices/DEVICE_ID":{"runtime_seconds":7200,"reset_at":"2020-11-01T00:00:00Z"}}`))
+	assert.NoError(t, err)
+	tracker.Listener()(thermostats("OFF", start.Add(30*time.Minute)))
+
+	metrics := `
+		# HELP nest_filter_runtime_hours HVAC runtime since the filter runtime was last reset.
+		# TYPE nest_filter_runtime_hours gauge
+		nest_filter_runtime_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} 2.5
+	`
+	assert.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(metrics), "nest_filter_runtime_hours"))
+
+	data, err := tracker.MarshalState()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"enterprises/PROJECT_ID/devices/DEVICE_ID":{"runtime_seconds":9000,"reset_at":"2020-11-01T00:00:00Z"}}`, string(data))
+}
+
+func TestInvalidStateFile(t *testing.T) {
+	_, path := newTestTracker(t)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	_, err := New(Config{Path: path})
+	assert.True(t, errors.Is(err, errFailedLoading))
+}
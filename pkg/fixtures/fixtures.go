@@ -0,0 +1,186 @@
+// Package fixtures records responses of Nest and OpenWeatherMap APIs into fixture files and replays them with
+// a mock server. It makes bug reports reproducible and allows running the exporter offline.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the fixture files.
+const (
+	NestFile    = "nest_devices.json"
+	WeatherFile = "weather.json"
+)
+
+var (
+	errFailedWritingFixture = errors.New("failed writing fixture file")
+	errFailedReadingFixture = errors.New("failed reading fixture file")
+)
+
+// resourceID matches the IDs of Device Access resources in resource names, eg. "enterprises/PROJECT_ID".
+var resourceID = regexp.MustCompile(`(enterprises|devices|structures|rooms)/([^/"]+)`)
+
+// Sanitizer removes sensitive data from a response body before it's saved.
+type Sanitizer func(body []byte) []byte
+
+// SanitizeNest replaces IDs of the project, devices, structures and rooms with stable placeholders,
+// eg. "enterprises/PROJECT_ID/devices/DEVICE_1".
+func SanitizeNest() Sanitizer {
+	var mu sync.Mutex
+	ids := make(map[string]string)
+	counters := make(map[string]int)
+
+	return func(body []byte) []byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return resourceID.ReplaceAllFunc(body, func(match []byte) []byte {
+			parts := strings.SplitN(string(match), "/", 2)
+			kind, id := parts[0], parts[1]
+
+			if kind == "enterprises" {
+				return []byte("enterprises/PROJECT_ID")
+			}
+
+			key := kind + "/" + id
+			if _, ok := ids[key]; !ok {
+				counters[kind]++
+				singular := strings.ToUpper(strings.TrimSuffix(kind, "s"))
+				ids[key] = fmt.Sprintf("%s/%s_%d", kind, singular, counters[kind])
+			}
+
+			return []byte(ids[key])
+		})
+	}
+}
+
+// SanitizeWeather replaces the location of OpenWeatherMap responses, the coordinates, city ID, city name and
+// country, with placeholders. Bodies which aren't JSON objects are returned unchanged.
+func SanitizeWeather() Sanitizer {
+	return func(body []byte) []byte {
+		var response map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&response); err != nil {
+			return body
+		}
+
+		replace := func(fields map[string]interface{}, key string, placeholder interface{}) {
+			if _, ok := fields[key]; ok {
+				fields[key] = placeholder
+			}
+		}
+		replace(response, "coord", map[string]float64{"lon": 0, "lat": 0})
+		replace(response, "id", 0)
+		replace(response, "name", "CITY")
+		if sys, ok := response["sys"].(map[string]interface{}); ok {
+			replace(sys, "country", "COUNTRY")
+		}
+
+		sanitized, err := json.Marshal(response)
+		if err != nil {
+			return body
+		}
+		return sanitized
+	}
+}
+
+// Recorder is a http.RoundTripper saving bodies of successful responses into a fixture file.
+type Recorder struct {
+	base     http.RoundTripper
+	path     string
+	sanitize Sanitizer
+}
+
+// NewRecorder creates a Recorder saving responses into the file in dir. If base is nil, http.DefaultTransport is used.
+// If sanitize is nil, responses are saved as they are.
+func NewRecorder(dir string, file string, sanitize Sanitizer, base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Recorder{
+		base:     base,
+		path:     filepath.Join(dir, file),
+		sanitize: sanitize,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.base.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Restore the original body so the caller can still read it.
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if r.sanitize != nil {
+		body = r.sanitize(body)
+	}
+
+	if err := ioutil.WriteFile(r.path, body, 0644); err != nil {
+		return nil, errors.Wrap(errFailedWritingFixture, err.Error())
+	}
+
+	return res, nil
+}
+
+// NewReplayServer returns a http.Handler mocking Nest and OpenWeatherMap APIs with responses from fixture files in dir.
+// It also mocks the OAuth2 token endpoint, always returning a dummy access token.
+//
+// Nest API is served under "/v1/", OpenWeatherMap API under "/weather" and the token endpoint under "/token".
+func NewReplayServer(dir string) http.Handler {
+	return newServer(serveFile(filepath.Join(dir, NestFile)), serveFile(filepath.Join(dir, WeatherFile)))
+}
+
+// newServer returns a http.Handler serving the Nest and OpenWeatherMap API handlers along with a dummy token endpoint.
+func newServer(nest http.Handler, weather http.Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"replay","token_type":"Bearer","expires_in":3600}`))
+	})
+
+	mux.Handle("/v1/", nest)
+	mux.Handle("/weather", weather)
+
+	return mux
+}
+
+func serveFile(path string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.NotFound(w, r)
+				return
+			}
+
+			http.Error(w, errors.Wrap(errFailedReadingFixture, err.Error()).Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,93 @@
+package fixtures
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const devicesBody = `{"devices":[{"name":"enterprises/abc-123/devices/AVPHwEu","assignee":"enterprises/abc-123/structures/XYZ/rooms/R1"},` +
+	`{"name":"enterprises/abc-123/devices/BQxyz","assignee":"enterprises/abc-123/structures/XYZ/rooms/R2"}]}`
+
+const sanitizedBody = `{"devices":[{"name":"enterprises/PROJECT_ID/devices/DEVICE_1","assignee":"enterprises/PROJECT_ID/structures/STRUCTURE_1/rooms/ROOM_1"},` +
+	`{"name":"enterprises/PROJECT_ID/devices/DEVICE_2","assignee":"enterprises/PROJECT_ID/structures/STRUCTURE_1/rooms/ROOM_2"}]}`
+
+func TestSanitizeNest(t *testing.T) {
+	sanitize := SanitizeNest()
+
+	assert.Equal(t, sanitizedBody, string(sanitize([]byte(devicesBody))))
+	// IDs must be stable between calls.
+	assert.Equal(t, sanitizedBody, string(sanitize([]byte(devicesBody))))
+}
+
+func TestSanitizeWeather(t *testing.T) {
+	sanitize := SanitizeWeather()
+
+	body := `{"coord":{"lon":4.89,"lat":52.37},"main":{"temp":11.3},"id":2759794,"name":"Amsterdam","sys":{"country":"NL","sunrise":1602741600}}`
+	assert.Equal(t,
+		`{"coord":{"lat":0,"lon":0},"id":0,"main":{"temp":11.3},"name":"CITY","sys":{"country":"COUNTRY","sunrise":1602741600}}`,
+		string(sanitize([]byte(body))))
+
+	assert.Equal(t, "not json", string(sanitize([]byte("not json"))))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	assert.NoError(t, err)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(devicesBody))
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: NewRecorder(dir, NestFile, SanitizeNest(), nil)}
+
+	res, err := client.Get(upstream.URL)
+	assert.NoError(t, err)
+
+	// The caller must still receive the original response.
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, devicesBody, string(body))
+
+	saved, err := ioutil.ReadFile(filepath.Join(dir, NestFile))
+	assert.NoError(t, err)
+	assert.Equal(t, sanitizedBody, string(saved))
+
+	replay := httptest.NewServer(NewReplayServer(dir))
+	defer replay.Close()
+
+	res, err = http.Get(replay.URL + "/v1/enterprises/PROJECT_ID/devices/")
+	assert.NoError(t, err)
+	body, err = ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, sanitizedBody, string(body))
+
+	res, err = http.Get(replay.URL + "/weather")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Post(replay.URL+"/token", "application/x-www-form-urlencoded", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestSandboxServer(t *testing.T) {
+	sandbox := httptest.NewServer(NewSandboxServer())
+	defer sandbox.Close()
+
+	for path, want := range map[string]string{
+		"/v1/enterprises/SANDBOX/devices/": SandboxNest,
+		"/weather":                         SandboxWeather,
+	} {
+		res, err := http.Get(sandbox.URL + path)
+		assert.NoError(t, err)
+		body, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, want, string(body))
+	}
+}
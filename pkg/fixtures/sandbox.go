@@ -0,0 +1,81 @@
+package fixtures
+
+import (
+	"net/http"
+)
+
+// SandboxNest is a sample response of the Nest API devices.list endpoint for a home with two thermostats and a camera.
+// One thermostat is heating, the other one is in the eco mode.
+const SandboxNest = `{
+  "devices": [
+    {
+      "name": "enterprises/SANDBOX/devices/THERMOSTAT_1",
+      "type": "sdm.devices.types.THERMOSTAT",
+      "assignee": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_1",
+      "traits": {
+        "sdm.devices.traits.Info": {"customName": "Living Room"},
+        "sdm.devices.traits.Humidity": {"ambientHumidityPercent": 48},
+        "sdm.devices.traits.Connectivity": {"status": "ONLINE"},
+        "sdm.devices.traits.ThermostatMode": {"mode": "HEAT", "availableModes": ["HEAT", "OFF"]},
+        "sdm.devices.traits.ThermostatEco": {"availableModes": ["OFF", "MANUAL_ECO"], "mode": "OFF", "heatCelsius": 16, "coolCelsius": 25},
+        "sdm.devices.traits.ThermostatHvac": {"status": "HEATING"},
+        "sdm.devices.traits.Settings": {"temperatureScale": "CELSIUS"},
+        "sdm.devices.traits.ThermostatTemperatureSetpoint": {"heatCelsius": 21.5},
+        "sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 20.4}
+      },
+      "parentRelations": [{"parent": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_1", "displayName": "Living Room"}]
+    },
+    {
+      "name": "enterprises/SANDBOX/devices/THERMOSTAT_2",
+      "type": "sdm.devices.types.THERMOSTAT",
+      "assignee": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_2",
+      "traits": {
+        "sdm.devices.traits.Info": {"customName": "Bedroom"},
+        "sdm.devices.traits.Humidity": {"ambientHumidityPercent": 55},
+        "sdm.devices.traits.Connectivity": {"status": "ONLINE"},
+        "sdm.devices.traits.ThermostatMode": {"mode": "HEAT", "availableModes": ["HEAT", "OFF"]},
+        "sdm.devices.traits.ThermostatEco": {"availableModes": ["OFF", "MANUAL_ECO"], "mode": "MANUAL_ECO", "heatCelsius": 16, "coolCelsius": 25},
+        "sdm.devices.traits.ThermostatHvac": {"status": "OFF"},
+        "sdm.devices.traits.Settings": {"temperatureScale": "CELSIUS"},
+        "sdm.devices.traits.ThermostatTemperatureSetpoint": {"heatCelsius": 18},
+        "sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 18.7}
+      },
+      "parentRelations": [{"parent": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_2", "displayName": "Bedroom"}]
+    },
+    {
+      "name": "enterprises/SANDBOX/devices/CAMERA_1",
+      "type": "sdm.devices.types.CAMERA",
+      "assignee": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_3",
+      "traits": {
+        "sdm.devices.traits.Info": {"customName": "Front Door"},
+        "sdm.devices.traits.CameraLiveStream": {"maxVideoResolution": {"width": 640, "height": 480}}
+      },
+      "parentRelations": [{"parent": "enterprises/SANDBOX/structures/STRUCTURE_1/rooms/ROOM_3", "displayName": "Entryway"}]
+    }
+  ]
+}`
+
+// SandboxWeather is a sample response of the OpenWeatherMap API current weather endpoint.
+const SandboxWeather = `{
+  "weather": [{"id": 500, "main": "Rain", "description": "light rain", "icon": "10d"}],
+  "main": {"temp": 11.3, "feels_like": 9.8, "temp_min": 10.6, "temp_max": 12.2, "pressure": 1009, "humidity": 81},
+  "wind": {"speed": 4.6, "deg": 230},
+  "clouds": {"all": 90},
+  "id": 2759794,
+  "name": "Amsterdam",
+  "cod": 200
+}`
+
+// NewSandboxServer returns a http.Handler mocking Nest and OpenWeatherMap APIs with the built-in sandbox fixtures,
+// so the exporter can be tried out without a Device Access registration. It's served under the same paths as
+// the replay server.
+func NewSandboxServer() http.Handler {
+	return newServer(serveBody(SandboxNest), serveBody(SandboxWeather))
+}
+
+func serveBody(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
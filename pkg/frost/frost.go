@@ -0,0 +1,171 @@
+// Package frost protects homes from freezing by switching thermostats to heating when it gets too cold inside.
+//
+// The Watchdog checks every reading of thermostats in the OFF or ECO mode. When the inside temperature drops below
+// the floor, it turns the eco mode off, sets the HEAT mode and the safe setpoint with Nest API commands. Actions are
+// logged and counted in the nest_frost_protection_actions_total metric.
+package frost
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultCooldown is the minimum time between actions on the same thermostat, so the watchdog doesn't repeat
+// commands while readings still show the old mode.
+const DefaultCooldown = 15 * time.Minute
+
+// queueSize limits the number of thermostats waiting for an action.
+const queueSize = 16
+
+var errInvalidSetpoint = errors.New("frost protection setpoint must be higher than the floor")
+
+// Controller executes commands on thermostats. It's implemented by nest.Collector.
+type Controller interface {
+	SetEcoMode(ctx context.Context, id, mode string) error
+	SetMode(ctx context.Context, id, mode string) error
+	SetHeat(ctx context.Context, id string, celsius float64) error
+}
+
+// Config provides the configuration necessary to create the Watchdog. Temperatures are in Celsius.
+// Logger is optional, if it's nil the Watchdog doesn't log anything. Cooldown defaults to DefaultCooldown. Labels are
+// the labels of thermostats in the action and failure counters.
+type Config struct {
+	Logger   log.Logger
+	Floor    float64
+	Setpoint float64
+	Cooldown time.Duration
+	Labels   nest.MetricLabels
+}
+
+// Watchdog raises the setpoint of thermostats which are off while it's too cold.
+type Watchdog struct {
+	logger   log.Logger
+	floor    float64
+	setpoint float64
+	cooldown time.Duration
+	labels   nest.MetricLabels
+	queue    chan *nest.Thermostat
+
+	mu         sync.Mutex
+	lastAction map[string]time.Time
+	now        func() time.Time
+
+	actions  *prometheus.CounterVec
+	failures *prometheus.CounterVec
+}
+
+// New creates a Watchdog using the given Config. It returns an error if the setpoint isn't higher than the floor.
+func New(cfg Config) (*Watchdog, error) {
+	if cfg.Setpoint <= cfg.Floor {
+		return nil, errInvalidSetpoint
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCooldown
+	}
+
+	return &Watchdog{
+		logger:     cfg.Logger,
+		floor:      cfg.Floor,
+		setpoint:   cfg.Setpoint,
+		cooldown:   cfg.Cooldown,
+		labels:     cfg.Labels,
+		queue:      make(chan *nest.Thermostat, queueSize),
+		lastAction: make(map[string]time.Time),
+		now:        time.Now,
+		actions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nest_frost_protection_actions_total",
+			Help: "Number of times frost protection switched a thermostat to heating.",
+		}, cfg.Labels.Names()),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nest_frost_protection_failures_total",
+			Help: "Number of times frost protection failed switching a thermostat to heating.",
+		}, cfg.Labels.Names()),
+	}, nil
+}
+
+// Listener returns a nest.Listener queueing thermostats which need protection.
+func (w *Watchdog) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		now := w.now()
+		for _, therm := range thermostats {
+			if therm.Mode != "OFF" && therm.Mode != "ECO" {
+				continue
+			}
+			if therm.AmbientTemp >= w.floor {
+				continue
+			}
+			if last, ok := w.lastAction[therm.ID]; ok && now.Sub(last) < w.cooldown {
+				continue
+			}
+
+			select {
+			case w.queue <- therm:
+				w.lastAction[therm.ID] = now
+			default:
+				w.logger.Log("level", "warn", "message", "Frost protection queue is full", "id", therm.ID)
+			}
+		}
+	}
+}
+
+// Run executes the commands switching queued thermostats to heating until the context is cancelled.
+func (w *Watchdog) Run(ctx context.Context, controller Controller) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case therm := <-w.queue:
+			w.logger.Log("level", "warn", "message", "Inside temperature below the frost protection floor, switching to heating",
+				"id", therm.ID, "label", therm.Label, "mode", therm.Mode, "ambient_temperature_celsius", therm.AmbientTemp, "setpoint_celsius", w.setpoint)
+
+			if err := w.protect(ctx, controller, therm); err != nil {
+				w.failures.WithLabelValues(w.labels.Values(therm)...).Inc()
+				w.logger.Log("level", "error", "message", "Failed switching thermostat to heating", "id", therm.ID, "stack", errors.WithStack(err))
+				continue
+			}
+			w.actions.WithLabelValues(w.labels.Values(therm)...).Inc()
+		}
+	}
+}
+
+// protect turns the eco mode off, if it's on, and sets the HEAT mode with the safe setpoint.
+func (w *Watchdog) protect(ctx context.Context, controller Controller, therm *nest.Thermostat) error {
+	if therm.Mode == "ECO" {
+		if err := controller.SetEcoMode(ctx, therm.ID, "OFF"); err != nil {
+			return err
+		}
+	}
+
+	if err := controller.SetMode(ctx, therm.ID, "HEAT"); err != nil {
+		return err
+	}
+
+	return controller.SetHeat(ctx, therm.ID, w.setpoint)
+}
+
+// Describe implements the prometheus.Collector interface.
+func (w *Watchdog) Describe(ch chan<- *prometheus.Desc) {
+	w.actions.Describe(ch)
+	w.failures.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (w *Watchdog) Collect(ch chan<- prometheus.Metric) {
+	w.actions.Collect(ch)
+	w.failures.Collect(ch)
+}
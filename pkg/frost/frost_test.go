@@ -0,0 +1,138 @@
+package frost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type fakeController struct {
+	mu       sync.Mutex
+	commands []string
+	err      error
+	done     chan struct{}
+}
+
+func (c *fakeController) record(command string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands = append(c.commands, command)
+	return c.err
+}
+
+func (c *fakeController) SetEcoMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s eco %s", id, mode))
+}
+
+func (c *fakeController) SetMode(_ context.Context, id, mode string) error {
+	return c.record(fmt.Sprintf("%s mode %s", id, mode))
+}
+
+func (c *fakeController) SetHeat(_ context.Context, id string, celsius float64) error {
+	defer func() { c.done <- struct{}{} }()
+	return c.record(fmt.Sprintf("%s heat %g", id, celsius))
+}
+
+func TestInvalidSetpoint(t *testing.T) {
+	_, err := New(Config{Floor: 7, Setpoint: 5})
+	assert.True(t, errors.Is(err, errInvalidSetpoint))
+}
+
+func TestListener(t *testing.T) {
+	w, err := New(Config{Floor: 5, Setpoint: 8, Cooldown: time.Hour})
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	thermostats := []*nest.Thermostat{
+		{ID: "HEATING", Mode: "HEAT", AmbientTemp: 3},
+		{ID: "WARM", Mode: "OFF", AmbientTemp: 5},
+		{ID: "OFF", Mode: "OFF", AmbientTemp: 4.9},
+		{ID: "ECO", Mode: "ECO", AmbientTemp: 2},
+	}
+
+	queued := func() []string {
+		var ids []string
+		for len(w.queue) > 0 {
+			ids = append(ids, (<-w.queue).ID)
+		}
+		return ids
+	}
+
+	w.Listener()(thermostats)
+	assert.Equal(t, []string{"OFF", "ECO"}, queued())
+
+	now = now.Add(30 * time.Minute)
+	w.Listener()(thermostats)
+	assert.Empty(t, queued(), "cooldown")
+
+	now = now.Add(30 * time.Minute)
+	w.Listener()(thermostats)
+	assert.Equal(t, []string{"OFF", "ECO"}, queued())
+}
+
+func TestRun(t *testing.T) {
+	w, err := New(Config{Floor: 5, Setpoint: 8})
+	assert.NoError(t, err)
+
+	controller := &fakeController{done: make(chan struct{}, 2)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, controller)
+
+	w.Listener()([]*nest.Thermostat{
+		{ID: "OFF", DeviceID: "1", Label: "Cellar", Mode: "OFF", AmbientTemp: 4},
+		{ID: "ECO", DeviceID: "2", Label: "Attic", Mode: "ECO", AmbientTemp: 3},
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-controller.done:
+		case <-time.After(time.Second):
+			t.Fatal("commands weren't executed")
+		}
+	}
+
+	controller.mu.Lock()
+	assert.Equal(t, []string{"OFF mode HEAT", "OFF heat 8", "ECO eco OFF", "ECO mode HEAT", "ECO heat 8"}, controller.commands)
+	controller.mu.Unlock()
+
+	want := `
+# HELP nest_frost_protection_actions_total Number of times frost protection switched a thermostat to heating.
+# TYPE nest_frost_protection_actions_total counter
+nest_frost_protection_actions_total{device_id="2",id="ECO",label="Attic"} 1
+nest_frost_protection_actions_total{device_id="1",id="OFF",label="Cellar"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(w, strings.NewReader(want), "nest_frost_protection_actions_total"))
+}
+
+func TestFailedCommand(t *testing.T) {
+	w, err := New(Config{Floor: 5, Setpoint: 8})
+	assert.NoError(t, err)
+
+	controller := &fakeController{err: errors.New("command failed"), done: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w.Listener()([]*nest.Thermostat{{ID: "OFF", Mode: "OFF", AmbientTemp: 4}})
+	w.queue <- &nest.Thermostat{ID: "ECO", Mode: "ECO", AmbientTemp: 4}
+	go w.Run(ctx, controller)
+
+	// The failing SetMode command stops protecting the first thermostat, SetHeat isn't called. Eco mode of the
+	// second thermostat fails as well, so wait until the metric is updated for both.
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(w.failures.WithLabelValues("OFF", "", "")) == 1 &&
+			testutil.ToFloat64(w.failures.WithLabelValues("ECO", "", "")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, testutil.CollectAndCount(w.actions))
+}
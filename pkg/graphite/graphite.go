@@ -0,0 +1,123 @@
+// Package graphite sends thermostat readings to Graphite with the carbon plaintext protocol.
+//
+// Every reading is a line "<prefix>.<thermostat>.<metric> <value> <timestamp>", where thermostat is the custom name
+// of the thermostat with characters other than letters, digits, dashes and underscores replaced by underscores.
+//
+// See https://graphite.readthedocs.io/en/latest/feeding-carbon.html#the-plaintext-protocol for the protocol.
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultPort is the port of the carbon plaintext receiver.
+const DefaultPort = "2003"
+
+// DefaultPrefix is the first component of metric paths if it isn't configured.
+const DefaultPrefix = "nest"
+
+// invalidPathChars matches characters which aren't allowed in components of metric paths.
+var invalidPathChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+var (
+	errFailedConnecting = errors.New("failed connecting to Graphite")
+	errFailedSending    = errors.New("failed sending data to Graphite")
+)
+
+// Config provides the configuration necessary to create the Sender.
+// Address is the address of the carbon receiver, DefaultPort is used if it doesn't have one. Prefix defaults to
+// DefaultPrefix, it may contain dots.
+type Config struct {
+	Address string
+	Prefix  string
+	Timeout time.Duration
+}
+
+// Sender sends readings to Graphite. It implements sink.Sender.
+type Sender struct {
+	address string
+	prefix  string
+	timeout time.Duration
+}
+
+// New creates a Sender using the given Config.
+func New(cfg Config) *Sender {
+	address := cfg.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+
+	return &Sender{
+		address: address,
+		prefix:  cfg.Prefix,
+		timeout: cfg.Timeout,
+	}
+}
+
+// Send sends readings of thermostats to Graphite.
+func (s *Sender) Send(ctx context.Context, thermostats []*nest.Thermostat) error {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return errors.Wrap(errFailedConnecting, err.Error())
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	if _, err := conn.Write(s.format(thermostats, time.Now())); err != nil {
+		return errors.Wrap(errFailedSending, err.Error())
+	}
+
+	return nil
+}
+
+// format returns the plaintext lines with readings of thermostats. Readings without the time they were updated at
+// get the current time.
+func (s *Sender) format(thermostats []*nest.Thermostat, now time.Time) []byte {
+	var buf bytes.Buffer
+	for _, therm := range thermostats {
+		timestamp := now
+		if !therm.UpdatedAt.IsZero() {
+			timestamp = therm.UpdatedAt
+		}
+
+		name := therm.Label
+		if name == "" {
+			name = therm.DeviceID
+		}
+		path := s.prefix + "." + invalidPathChars.ReplaceAllString(name, "_")
+
+		heating := 0.0
+		if therm.Status == "HEATING" {
+			heating = 1
+		}
+
+		write := func(metric string, value float64) {
+			fmt.Fprintf(&buf, "%s.%s %s %d\n", path, metric, strconv.FormatFloat(value, 'f', -1, 64), timestamp.Unix())
+		}
+
+		write("ambient_temperature_celsius", therm.AmbientTemp)
+		write("setpoint_temperature_celsius", therm.SetpointTemp)
+		write("humidity_percent", therm.Humidity)
+		write("heating", heating)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,118 @@
+package graphite
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var thermostats = []*nest.Thermostat{
+	{
+		DeviceID:     "DEVICE_1",
+		Label:        "Living Room",
+		AmbientTemp:  20.5,
+		SetpointTemp: 19,
+		Humidity:     45,
+		Status:       "HEATING",
+		UpdatedAt:    time.Unix(1577836800, 0),
+	},
+	{
+		DeviceID:     "DEVICE_2",
+		Label:        "",
+		AmbientTemp:  18,
+		SetpointTemp: 17.5,
+		Humidity:     50,
+		Status:       "OFF",
+	},
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{
+			name: "default prefix",
+			want: `nest.Living_Room.ambient_temperature_celsius 20.5 1577836800
+nest.Living_Room.setpoint_temperature_celsius 19 1577836800
+nest.Living_Room.humidity_percent 45 1577836800
+nest.Living_Room.heating 1 1577836800
+nest.DEVICE_2.ambient_temperature_celsius 18 1577840400
+nest.DEVICE_2.setpoint_temperature_celsius 17.5 1577840400
+nest.DEVICE_2.humidity_percent 50 1577840400
+nest.DEVICE_2.heating 0 1577840400
+`,
+		}, {
+			name:   "nested prefix",
+			prefix: "home.heating",
+			want: `home.heating.Living_Room.ambient_temperature_celsius 20.5 1577836800
+home.heating.Living_Room.setpoint_temperature_celsius 19 1577836800
+home.heating.Living_Room.humidity_percent 45 1577836800
+home.heating.Living_Room.heating 1 1577836800
+home.heating.DEVICE_2.ambient_temperature_celsius 18 1577840400
+home.heating.DEVICE_2.setpoint_temperature_celsius 17.5 1577840400
+home.heating.DEVICE_2.humidity_percent 50 1577840400
+home.heating.DEVICE_2.heating 0 1577840400
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(Config{Address: "graphite", Prefix: tt.prefix})
+			assert.Equal(t, tt.want, string(s.format(thermostats, time.Unix(1577840400, 0))))
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	s := New(Config{Address: l.Addr().String(), Timeout: time.Second})
+	assert.NoError(t, s.Send(context.Background(), thermostats[:1]))
+
+	select {
+	case data := <-received:
+		assert.Contains(t, data, "nest.Living_Room.ambient_temperature_celsius 20.5 1577836800\n")
+	case <-time.After(time.Second):
+		t.Fatal("readings weren't received")
+	}
+}
+
+func TestFailedConnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s := New(Config{Address: addr, Timeout: time.Second})
+	err = s.Send(context.Background(), thermostats)
+	assert.True(t, errors.Is(err, errFailedConnecting))
+}
+
+func TestDefaultPort(t *testing.T) {
+	assert.Equal(t, "graphite:2003", New(Config{Address: "graphite"}).address)
+	assert.Equal(t, "graphite:2004", New(Config{Address: "graphite:2004"}).address)
+}
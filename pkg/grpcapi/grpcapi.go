@@ -0,0 +1,179 @@
+// Package grpcapi serves the latest readings of thermostats and weather with gRPC, so services written in any
+// language can consume the normalized model of the exporter. The service is defined in
+// proto/pronestheus/v1/readings.proto, readings.pb.go and readings_grpc.pb.go are generated from it.
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=pronestheus --go-grpc_out=../.. --go-grpc_opt=module=pronestheus pronestheus/v1/readings.proto
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"pronestheus/pkg/api"
+	"pronestheus/pkg/collectors/nest"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "pronestheus.v1.ReadingsService"
+
+// maxMessageSize limits the size of request messages, which are tiny.
+const maxMessageSize = 64 * 1024
+
+// shutdownTimeout limits waiting for active calls when the Server stops.
+const shutdownTimeout = 5 * time.Second
+
+var errFailedListening = errors.New("failed listening for gRPC requests")
+
+// Source provides the latest readings. It's implemented by api.Server.
+type Source interface {
+	Thermostats() []*nest.Thermostat
+	Weather() *api.Weather
+}
+
+// Config provides the configuration necessary to create the Server. Logger is optional, if it's nil the Server
+// doesn't log anything. ID returns the id of a thermostat in responses, if it's nil the resource name of the
+// thermostat is used.
+type Config struct {
+	Logger log.Logger
+	Addr   string
+	Source Source
+	ID     func(therm *nest.Thermostat) string
+}
+
+// Server answers gRPC calls with the readings of the Source. It implements ReadingsServiceServer.
+type Server struct {
+	UnimplementedReadingsServiceServer
+
+	logger   log.Logger
+	listener net.Listener
+	server   *grpc.Server
+	source   Source
+	id       func(therm *nest.Thermostat) string
+}
+
+// New creates a Server listening on the address from the Config.
+func New(cfg Config) (*Server, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+	if cfg.ID == nil {
+		cfg.ID = func(therm *nest.Thermostat) string { return therm.ID }
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrap(errFailedListening, err.Error())
+	}
+
+	s := &Server{
+		logger:   cfg.Logger,
+		listener: listener,
+		server:   grpc.NewServer(grpc.MaxRecvMsgSize(maxMessageSize)),
+		source:   cfg.Source,
+		id:       cfg.ID,
+	}
+	RegisterReadingsServiceServer(s.server, s)
+
+	return s, nil
+}
+
+// Addr returns the address the Server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Run serves gRPC calls until the context is cancelled.
+func (s *Server) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			s.server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			s.server.Stop()
+		}
+	}()
+
+	if err := s.server.Serve(s.listener); err != nil && err != grpc.ErrServerStopped {
+		s.logger.Log("level", "error", "message", "Failed serving gRPC requests", "stack", errors.WithStack(err))
+	}
+}
+
+// ListThermostats implements ReadingsServiceServer.
+func (s *Server) ListThermostats(_ context.Context, _ *ListThermostatsRequest) (*ListThermostatsResponse, error) {
+	response := &ListThermostatsResponse{}
+	for _, therm := range s.source.Thermostats() {
+		response.Thermostats = append(response.Thermostats, s.thermostat(therm))
+	}
+	return response, nil
+}
+
+// GetThermostat implements ReadingsServiceServer.
+func (s *Server) GetThermostat(_ context.Context, request *GetThermostatRequest) (*Thermostat, error) {
+	id := request.GetId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is missing")
+	}
+
+	for _, therm := range s.source.Thermostats() {
+		if therm.ID == id || therm.DeviceID == id || s.id(therm) == id {
+			return s.thermostat(therm), nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "unknown thermostat "+id)
+}
+
+// GetWeather implements ReadingsServiceServer.
+func (s *Server) GetWeather(_ context.Context, _ *GetWeatherRequest) (*Weather, error) {
+	weather := s.source.Weather()
+	if weather == nil {
+		return nil, status.Error(codes.NotFound, "no weather readings available")
+	}
+
+	return &Weather{
+		TemperatureCelsius:  weather.Temperature,
+		HumidityPercent:     weather.Humidity,
+		PressureHectopascal: weather.Pressure,
+		UpdatedAt:           timestamp(weather.UpdatedAt),
+	}, nil
+}
+
+// thermostat converts the reading into its message, with the id returned by the id function of the Config.
+func (s *Server) thermostat(therm *nest.Thermostat) *Thermostat {
+	return &Thermostat{
+		Id:                         s.id(therm),
+		DeviceId:                   therm.DeviceID,
+		Label:                      therm.Label,
+		Room:                       therm.Room,
+		AmbientTemperatureCelsius:  therm.AmbientTemp,
+		SetpointTemperatureCelsius: therm.SetpointTemp,
+		HumidityPercent:            therm.Humidity,
+		HvacStatus:                 therm.Status,
+		Mode:                       therm.Mode,
+		TemperatureScale:           therm.TemperatureScale,
+		Connectivity:               therm.Connectivity,
+		UpdatedAt:                  timestamp(therm.UpdatedAt),
+	}
+}
+
+// timestamp converts the time into its message, zero times are left unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,136 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"pronestheus/pkg/api"
+	"pronestheus/pkg/collectors/nest"
+)
+
+type source struct {
+	thermostats []*nest.Thermostat
+	weather     *api.Weather
+}
+
+func (s *source) Thermostats() []*nest.Thermostat { return s.thermostats }
+func (s *source) Weather() *api.Weather           { return s.weather }
+
+var updatedAt = time.Date(2020, 12, 1, 10, 0, 0, 500, time.UTC)
+
+func testSource() *source {
+	return &source{thermostats: []*nest.Thermostat{
+		{
+			ID:               "enterprises/project-id/devices/device-1",
+			DeviceID:         "device-1",
+			Label:            "Living-Room",
+			AmbientTemp:      21.5,
+			SetpointTemp:     22,
+			Humidity:         40,
+			Status:           "HEATING",
+			Mode:             "HEAT",
+			TemperatureScale: "CELSIUS",
+			Connectivity:     "ONLINE",
+			UpdatedAt:        updatedAt,
+		},
+		{ID: "enterprises/project-id/devices/device-2", DeviceID: "device-2", Label: "Bedroom"},
+	}}
+}
+
+// startServer runs a Server with the source and returns a client calling it.
+func startServer(t *testing.T, src Source) ReadingsServiceClient {
+	s, err := New(Config{Addr: "127.0.0.1:0", Source: src})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Run(ctx)
+
+	conn, err := grpc.Dial(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return NewReadingsServiceClient(conn)
+}
+
+func TestListThermostats(t *testing.T) {
+	client := startServer(t, testSource())
+
+	response, err := client.ListThermostats(context.Background(), &ListThermostatsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, response.Thermostats, 2)
+
+	therm := response.Thermostats[0]
+	assert.Equal(t, "enterprises/project-id/devices/device-1", therm.Id)
+	assert.Equal(t, "device-1", therm.DeviceId)
+	assert.Equal(t, "Living-Room", therm.Label)
+	assert.Equal(t, 21.5, therm.AmbientTemperatureCelsius)
+	assert.Equal(t, 22.0, therm.SetpointTemperatureCelsius)
+	assert.Equal(t, 40.0, therm.HumidityPercent)
+	assert.Equal(t, "HEATING", therm.HvacStatus)
+	assert.Equal(t, "HEAT", therm.Mode)
+	assert.Equal(t, "CELSIUS", therm.TemperatureScale)
+	assert.Equal(t, "ONLINE", therm.Connectivity)
+	assert.Equal(t, updatedAt, therm.UpdatedAt.AsTime())
+
+	therm = response.Thermostats[1]
+	assert.Equal(t, "Bedroom", therm.Label)
+	assert.Nil(t, therm.UpdatedAt, "zero times aren't set")
+}
+
+func TestGetThermostat(t *testing.T) {
+	client := startServer(t, testSource())
+
+	for _, id := range []string{"device-2", "enterprises/project-id/devices/device-2"} {
+		therm, err := client.GetThermostat(context.Background(), &GetThermostatRequest{Id: id})
+		assert.NoError(t, err)
+		assert.Equal(t, "device-2", therm.DeviceId)
+	}
+
+	_, err := client.GetThermostat(context.Background(), &GetThermostatRequest{Id: "device-3"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "unknown thermostat device-3", status.Convert(err).Message())
+
+	_, err = client.GetThermostat(context.Background(), &GetThermostatRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "the id is required")
+}
+
+func TestGetWeather(t *testing.T) {
+	src := testSource()
+	client := startServer(t, src)
+
+	_, err := client.GetWeather(context.Background(), &GetWeatherRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err), "the weather isn't available before the first collection")
+
+	src.weather = &api.Weather{Temperature: 4.5, Humidity: 80, Pressure: 1013, UpdatedAt: updatedAt}
+	weather, err := client.GetWeather(context.Background(), &GetWeatherRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.5, weather.TemperatureCelsius)
+	assert.Equal(t, 80.0, weather.HumidityPercent)
+	assert.Equal(t, 1013.0, weather.PressureHectopascal)
+	assert.Equal(t, updatedAt, weather.UpdatedAt.AsTime())
+}
+
+func TestID(t *testing.T) {
+	s, err := New(Config{Addr: "127.0.0.1:0", Source: testSource(), ID: func(therm *nest.Thermostat) string {
+		return nest.IDLabel(nest.IDHash, therm.ID)
+	}})
+	assert.NoError(t, err)
+	defer s.listener.Close()
+
+	response, err := s.ListThermostats(context.Background(), &ListThermostatsRequest{})
+	assert.NoError(t, err)
+	id := response.Thermostats[0].Id
+	assert.Len(t, id, 12)
+
+	therm, err := s.GetThermostat(context.Background(), &GetThermostatRequest{Id: id})
+	assert.NoError(t, err, "thermostats can be found by the id in responses")
+	assert.Equal(t, "device-1", therm.DeviceId)
+}
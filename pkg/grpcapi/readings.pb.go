@@ -0,0 +1,632 @@
+// Readings of Nest thermostats and the weather, as normalized by ProNestheus.
+//
+// The service is served by the exporter with --grpc-listen-addr. It doesn't call Nest or OpenWeatherMap APIs, it
+// returns the readings of the last collection, like the JSON API. Temperatures are always in Celsius.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: pronestheus/v1/readings.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ListThermostatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListThermostatsRequest) Reset() {
+	*x = ListThermostatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListThermostatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListThermostatsRequest) ProtoMessage() {}
+
+func (x *ListThermostatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListThermostatsRequest.ProtoReflect.Descriptor instead.
+func (*ListThermostatsRequest) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{0}
+}
+
+type ListThermostatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Thermostats []*Thermostat `protobuf:"bytes,1,rep,name=thermostats,proto3" json:"thermostats,omitempty"`
+}
+
+func (x *ListThermostatsResponse) Reset() {
+	*x = ListThermostatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListThermostatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListThermostatsResponse) ProtoMessage() {}
+
+func (x *ListThermostatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListThermostatsResponse.ProtoReflect.Descriptor instead.
+func (*ListThermostatsResponse) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListThermostatsResponse) GetThermostats() []*Thermostat {
+	if x != nil {
+		return x.Thermostats
+	}
+	return nil
+}
+
+type GetThermostatRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Device ID of the thermostat, or its full resource name enterprises/PROJECT_ID/devices/DEVICE_ID.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *GetThermostatRequest) Reset() {
+	*x = GetThermostatRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetThermostatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetThermostatRequest) ProtoMessage() {}
+
+func (x *GetThermostatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetThermostatRequest.ProtoReflect.Descriptor instead.
+func (*GetThermostatRequest) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetThermostatRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type GetWeatherRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetWeatherRequest) Reset() {
+	*x = GetWeatherRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetWeatherRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetWeatherRequest) ProtoMessage() {}
+
+func (x *GetWeatherRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetWeatherRequest.ProtoReflect.Descriptor instead.
+func (*GetWeatherRequest) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{3}
+}
+
+type Thermostat struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Resource name of the thermostat: enterprises/PROJECT_ID/devices/DEVICE_ID.
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	DeviceId string `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	// Value of the label label of metrics: the alias or custom name, normalized with the label policy.
+	Label                      string  `protobuf:"bytes,3,opt,name=label,proto3" json:"label,omitempty"`
+	Room                       string  `protobuf:"bytes,4,opt,name=room,proto3" json:"room,omitempty"`
+	AmbientTemperatureCelsius  float64 `protobuf:"fixed64,5,opt,name=ambient_temperature_celsius,json=ambientTemperatureCelsius,proto3" json:"ambient_temperature_celsius,omitempty"`
+	SetpointTemperatureCelsius float64 `protobuf:"fixed64,6,opt,name=setpoint_temperature_celsius,json=setpointTemperatureCelsius,proto3" json:"setpoint_temperature_celsius,omitempty"`
+	HumidityPercent            float64 `protobuf:"fixed64,7,opt,name=humidity_percent,json=humidityPercent,proto3" json:"humidity_percent,omitempty"`
+	// HVAC status: HEATING, COOLING or OFF.
+	HvacStatus string `protobuf:"bytes,8,opt,name=hvac_status,json=hvacStatus,proto3" json:"hvac_status,omitempty"`
+	// Thermostat mode: HEAT, COOL, HEATCOOL, OFF or ECO.
+	Mode string `protobuf:"bytes,9,opt,name=mode,proto3" json:"mode,omitempty"`
+	// Scale shown on the thermostat: CELSIUS or FAHRENHEIT.
+	TemperatureScale string `protobuf:"bytes,10,opt,name=temperature_scale,json=temperatureScale,proto3" json:"temperature_scale,omitempty"`
+	// ONLINE or OFFLINE, empty if the thermostat doesn't report it.
+	Connectivity string                 `protobuf:"bytes,11,opt,name=connectivity,proto3" json:"connectivity,omitempty"`
+	UpdatedAt    *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+}
+
+func (x *Thermostat) Reset() {
+	*x = Thermostat{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Thermostat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Thermostat) ProtoMessage() {}
+
+func (x *Thermostat) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Thermostat.ProtoReflect.Descriptor instead.
+func (*Thermostat) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Thermostat) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Thermostat) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *Thermostat) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Thermostat) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+func (x *Thermostat) GetAmbientTemperatureCelsius() float64 {
+	if x != nil {
+		return x.AmbientTemperatureCelsius
+	}
+	return 0
+}
+
+func (x *Thermostat) GetSetpointTemperatureCelsius() float64 {
+	if x != nil {
+		return x.SetpointTemperatureCelsius
+	}
+	return 0
+}
+
+func (x *Thermostat) GetHumidityPercent() float64 {
+	if x != nil {
+		return x.HumidityPercent
+	}
+	return 0
+}
+
+func (x *Thermostat) GetHvacStatus() string {
+	if x != nil {
+		return x.HvacStatus
+	}
+	return ""
+}
+
+func (x *Thermostat) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *Thermostat) GetTemperatureScale() string {
+	if x != nil {
+		return x.TemperatureScale
+	}
+	return ""
+}
+
+func (x *Thermostat) GetConnectivity() string {
+	if x != nil {
+		return x.Connectivity
+	}
+	return ""
+}
+
+func (x *Thermostat) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type Weather struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TemperatureCelsius  float64                `protobuf:"fixed64,1,opt,name=temperature_celsius,json=temperatureCelsius,proto3" json:"temperature_celsius,omitempty"`
+	HumidityPercent     float64                `protobuf:"fixed64,2,opt,name=humidity_percent,json=humidityPercent,proto3" json:"humidity_percent,omitempty"`
+	PressureHectopascal float64                `protobuf:"fixed64,3,opt,name=pressure_hectopascal,json=pressureHectopascal,proto3" json:"pressure_hectopascal,omitempty"`
+	UpdatedAt           *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+}
+
+func (x *Weather) Reset() {
+	*x = Weather{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_pronestheus_v1_readings_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Weather) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Weather) ProtoMessage() {}
+
+func (x *Weather) ProtoReflect() protoreflect.Message {
+	mi := &file_pronestheus_v1_readings_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Weather.ProtoReflect.Descriptor instead.
+func (*Weather) Descriptor() ([]byte, []int) {
+	return file_pronestheus_v1_readings_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Weather) GetTemperatureCelsius() float64 {
+	if x != nil {
+		return x.TemperatureCelsius
+	}
+	return 0
+}
+
+func (x *Weather) GetHumidityPercent() float64 {
+	if x != nil {
+		return x.HumidityPercent
+	}
+	return 0
+}
+
+func (x *Weather) GetPressureHectopascal() float64 {
+	if x != nil {
+		return x.PressureHectopascal
+	}
+	return 0
+}
+
+func (x *Weather) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+var File_pronestheus_v1_readings_proto protoreflect.FileDescriptor
+
+var file_pronestheus_v1_readings_proto_rawDesc = []byte{
+	0x0a, 0x1d, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2f, 0x76, 0x31,
+	0x2f, 0x72, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
+	0x0e, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2e, 0x76, 0x31, 0x1a,
+	0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0x18, 0x0a, 0x16, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74,
+	0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x57, 0x0a, 0x17, 0x4c, 0x69,
+	0x73, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3c, 0x0a, 0x0b, 0x74, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73,
+	0x74, 0x61, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x70, 0x72, 0x6f,
+	0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x68, 0x65, 0x72,
+	0x6d, 0x6f, 0x73, 0x74, 0x61, 0x74, 0x52, 0x0b, 0x74, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74,
+	0x61, 0x74, 0x73, 0x22, 0x26, 0x0a, 0x14, 0x47, 0x65, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f,
+	0x73, 0x74, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x22, 0x13, 0x0a, 0x11, 0x47,
+	0x65, 0x74, 0x57, 0x65, 0x61, 0x74, 0x68, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0xd1, 0x03, 0x0a, 0x0a, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74, 0x61, 0x74, 0x12,
+	0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12,
+	0x1b, 0x0a, 0x09, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05,
+	0x6c, 0x61, 0x62, 0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6c, 0x61, 0x62,
+	0x65, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x6f, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x72, 0x6f, 0x6f, 0x6d, 0x12, 0x3e, 0x0a, 0x1b, 0x61, 0x6d, 0x62, 0x69, 0x65, 0x6e,
+	0x74, 0x5f, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x63, 0x65,
+	0x6c, 0x73, 0x69, 0x75, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x19, 0x61, 0x6d, 0x62,
+	0x69, 0x65, 0x6e, 0x74, 0x54, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43,
+	0x65, 0x6c, 0x73, 0x69, 0x75, 0x73, 0x12, 0x40, 0x0a, 0x1c, 0x73, 0x65, 0x74, 0x70, 0x6f, 0x69,
+	0x6e, 0x74, 0x5f, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x63,
+	0x65, 0x6c, 0x73, 0x69, 0x75, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x1a, 0x73, 0x65,
+	0x74, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x54, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72,
+	0x65, 0x43, 0x65, 0x6c, 0x73, 0x69, 0x75, 0x73, 0x12, 0x29, 0x0a, 0x10, 0x68, 0x75, 0x6d, 0x69,
+	0x64, 0x69, 0x74, 0x79, 0x5f, 0x70, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x0f, 0x68, 0x75, 0x6d, 0x69, 0x64, 0x69, 0x74, 0x79, 0x50, 0x65, 0x72, 0x63,
+	0x65, 0x6e, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x68, 0x76, 0x61, 0x63, 0x5f, 0x73, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x68, 0x76, 0x61, 0x63, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x6d, 0x6f, 0x64, 0x65, 0x12, 0x2b, 0x0a, 0x11, 0x74, 0x65, 0x6d, 0x70,
+	0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x73, 0x63, 0x61, 0x6c, 0x65, 0x18, 0x0a, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x10, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x53, 0x63, 0x61, 0x6c, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74,
+	0x69, 0x76, 0x69, 0x74, 0x79, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x6f, 0x6e,
+	0x6e, 0x65, 0x63, 0x74, 0x69, 0x76, 0x69, 0x74, 0x79, 0x12, 0x39, 0x0a, 0x0a, 0x75, 0x70, 0x64,
+	0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x75, 0x70, 0x64, 0x61, 0x74,
+	0x65, 0x64, 0x41, 0x74, 0x22, 0xd3, 0x01, 0x0a, 0x07, 0x57, 0x65, 0x61, 0x74, 0x68, 0x65, 0x72,
+	0x12, 0x2f, 0x0a, 0x13, 0x74, 0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f,
+	0x63, 0x65, 0x6c, 0x73, 0x69, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x12, 0x74,
+	0x65, 0x6d, 0x70, 0x65, 0x72, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43, 0x65, 0x6c, 0x73, 0x69, 0x75,
+	0x73, 0x12, 0x29, 0x0a, 0x10, 0x68, 0x75, 0x6d, 0x69, 0x64, 0x69, 0x74, 0x79, 0x5f, 0x70, 0x65,
+	0x72, 0x63, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0f, 0x68, 0x75, 0x6d,
+	0x69, 0x64, 0x69, 0x74, 0x79, 0x50, 0x65, 0x72, 0x63, 0x65, 0x6e, 0x74, 0x12, 0x31, 0x0a, 0x14,
+	0x70, 0x72, 0x65, 0x73, 0x73, 0x75, 0x72, 0x65, 0x5f, 0x68, 0x65, 0x63, 0x74, 0x6f, 0x70, 0x61,
+	0x73, 0x63, 0x61, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x13, 0x70, 0x72, 0x65, 0x73,
+	0x73, 0x75, 0x72, 0x65, 0x48, 0x65, 0x63, 0x74, 0x6f, 0x70, 0x61, 0x73, 0x63, 0x61, 0x6c, 0x12,
+	0x39, 0x0a, 0x0a, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x09, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x32, 0x92, 0x02, 0x0a, 0x0f, 0x52,
+	0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x73, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x62,
+	0x0a, 0x0f, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74, 0x61, 0x74,
+	0x73, 0x12, 0x26, 0x2e, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2e,
+	0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74, 0x61,
+	0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x27, 0x2e, 0x70, 0x72, 0x6f, 0x6e,
+	0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x54,
+	0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x51, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73,
+	0x74, 0x61, 0x74, 0x12, 0x24, 0x2e, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x54, 0x68, 0x65, 0x72, 0x6d, 0x6f, 0x73, 0x74,
+	0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x70, 0x72, 0x6f, 0x6e,
+	0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x68, 0x65, 0x72, 0x6d,
+	0x6f, 0x73, 0x74, 0x61, 0x74, 0x12, 0x48, 0x0a, 0x0a, 0x47, 0x65, 0x74, 0x57, 0x65, 0x61, 0x74,
+	0x68, 0x65, 0x72, 0x12, 0x21, 0x2e, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x57, 0x65, 0x61, 0x74, 0x68, 0x65, 0x72, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74,
+	0x68, 0x65, 0x75, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x57, 0x65, 0x61, 0x74, 0x68, 0x65, 0x72, 0x42,
+	0x19, 0x5a, 0x17, 0x70, 0x72, 0x6f, 0x6e, 0x65, 0x73, 0x74, 0x68, 0x65, 0x75, 0x73, 0x2f, 0x70,
+	0x6b, 0x67, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_pronestheus_v1_readings_proto_rawDescOnce sync.Once
+	file_pronestheus_v1_readings_proto_rawDescData = file_pronestheus_v1_readings_proto_rawDesc
+)
+
+func file_pronestheus_v1_readings_proto_rawDescGZIP() []byte {
+	file_pronestheus_v1_readings_proto_rawDescOnce.Do(func() {
+		file_pronestheus_v1_readings_proto_rawDescData = protoimpl.X.CompressGZIP(file_pronestheus_v1_readings_proto_rawDescData)
+	})
+	return file_pronestheus_v1_readings_proto_rawDescData
+}
+
+var file_pronestheus_v1_readings_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_pronestheus_v1_readings_proto_goTypes = []interface{}{
+	(*ListThermostatsRequest)(nil),  // 0: pronestheus.v1.ListThermostatsRequest
+	(*ListThermostatsResponse)(nil), // 1: pronestheus.v1.ListThermostatsResponse
+	(*GetThermostatRequest)(nil),    // 2: pronestheus.v1.GetThermostatRequest
+	(*GetWeatherRequest)(nil),       // 3: pronestheus.v1.GetWeatherRequest
+	(*Thermostat)(nil),              // 4: pronestheus.v1.Thermostat
+	(*Weather)(nil),                 // 5: pronestheus.v1.Weather
+	(*timestamppb.Timestamp)(nil),   // 6: google.protobuf.Timestamp
+}
+var file_pronestheus_v1_readings_proto_depIdxs = []int32{
+	4, // 0: pronestheus.v1.ListThermostatsResponse.thermostats:type_name -> pronestheus.v1.Thermostat
+	6, // 1: pronestheus.v1.Thermostat.updated_at:type_name -> google.protobuf.Timestamp
+	6, // 2: pronestheus.v1.Weather.updated_at:type_name -> google.protobuf.Timestamp
+	0, // 3: pronestheus.v1.ReadingsService.ListThermostats:input_type -> pronestheus.v1.ListThermostatsRequest
+	2, // 4: pronestheus.v1.ReadingsService.GetThermostat:input_type -> pronestheus.v1.GetThermostatRequest
+	3, // 5: pronestheus.v1.ReadingsService.GetWeather:input_type -> pronestheus.v1.GetWeatherRequest
+	1, // 6: pronestheus.v1.ReadingsService.ListThermostats:output_type -> pronestheus.v1.ListThermostatsResponse
+	4, // 7: pronestheus.v1.ReadingsService.GetThermostat:output_type -> pronestheus.v1.Thermostat
+	5, // 8: pronestheus.v1.ReadingsService.GetWeather:output_type -> pronestheus.v1.Weather
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_pronestheus_v1_readings_proto_init() }
+func file_pronestheus_v1_readings_proto_init() {
+	if File_pronestheus_v1_readings_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_pronestheus_v1_readings_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListThermostatsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pronestheus_v1_readings_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListThermostatsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pronestheus_v1_readings_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetThermostatRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pronestheus_v1_readings_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetWeatherRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pronestheus_v1_readings_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Thermostat); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_pronestheus_v1_readings_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Weather); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_pronestheus_v1_readings_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pronestheus_v1_readings_proto_goTypes,
+		DependencyIndexes: file_pronestheus_v1_readings_proto_depIdxs,
+		MessageInfos:      file_pronestheus_v1_readings_proto_msgTypes,
+	}.Build()
+	File_pronestheus_v1_readings_proto = out.File
+	file_pronestheus_v1_readings_proto_rawDesc = nil
+	file_pronestheus_v1_readings_proto_goTypes = nil
+	file_pronestheus_v1_readings_proto_depIdxs = nil
+}
@@ -0,0 +1,200 @@
+// Readings of Nest thermostats and the weather, as normalized by ProNestheus.
+//
+// The service is served by the exporter with --grpc-listen-addr. It doesn't call Nest or OpenWeatherMap APIs, it
+// returns the readings of the last collection, like the JSON API. Temperatures are always in Celsius.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: pronestheus/v1/readings.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ReadingsService_ListThermostats_FullMethodName = "/pronestheus.v1.ReadingsService/ListThermostats"
+	ReadingsService_GetThermostat_FullMethodName   = "/pronestheus.v1.ReadingsService/GetThermostat"
+	ReadingsService_GetWeather_FullMethodName      = "/pronestheus.v1.ReadingsService/GetWeather"
+)
+
+// ReadingsServiceClient is the client API for ReadingsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ReadingsServiceClient interface {
+	// ListThermostats returns all thermostats with their latest readings. The list is empty until the first
+	// collection.
+	ListThermostats(ctx context.Context, in *ListThermostatsRequest, opts ...grpc.CallOption) (*ListThermostatsResponse, error)
+	// GetThermostat returns a thermostat with its latest readings. It fails with NOT_FOUND if there's no such
+	// thermostat.
+	GetThermostat(ctx context.Context, in *GetThermostatRequest, opts ...grpc.CallOption) (*Thermostat, error)
+	// GetWeather returns the current weather. It fails with NOT_FOUND until the first collection or if the weather
+	// isn't collected at all.
+	GetWeather(ctx context.Context, in *GetWeatherRequest, opts ...grpc.CallOption) (*Weather, error)
+}
+
+type readingsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReadingsServiceClient(cc grpc.ClientConnInterface) ReadingsServiceClient {
+	return &readingsServiceClient{cc}
+}
+
+func (c *readingsServiceClient) ListThermostats(ctx context.Context, in *ListThermostatsRequest, opts ...grpc.CallOption) (*ListThermostatsResponse, error) {
+	out := new(ListThermostatsResponse)
+	err := c.cc.Invoke(ctx, ReadingsService_ListThermostats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readingsServiceClient) GetThermostat(ctx context.Context, in *GetThermostatRequest, opts ...grpc.CallOption) (*Thermostat, error) {
+	out := new(Thermostat)
+	err := c.cc.Invoke(ctx, ReadingsService_GetThermostat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *readingsServiceClient) GetWeather(ctx context.Context, in *GetWeatherRequest, opts ...grpc.CallOption) (*Weather, error) {
+	out := new(Weather)
+	err := c.cc.Invoke(ctx, ReadingsService_GetWeather_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReadingsServiceServer is the server API for ReadingsService service.
+// All implementations must embed UnimplementedReadingsServiceServer
+// for forward compatibility
+type ReadingsServiceServer interface {
+	// ListThermostats returns all thermostats with their latest readings. The list is empty until the first
+	// collection.
+	ListThermostats(context.Context, *ListThermostatsRequest) (*ListThermostatsResponse, error)
+	// GetThermostat returns a thermostat with its latest readings. It fails with NOT_FOUND if there's no such
+	// thermostat.
+	GetThermostat(context.Context, *GetThermostatRequest) (*Thermostat, error)
+	// GetWeather returns the current weather. It fails with NOT_FOUND until the first collection or if the weather
+	// isn't collected at all.
+	GetWeather(context.Context, *GetWeatherRequest) (*Weather, error)
+	mustEmbedUnimplementedReadingsServiceServer()
+}
+
+// UnimplementedReadingsServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedReadingsServiceServer struct {
+}
+
+func (UnimplementedReadingsServiceServer) ListThermostats(context.Context, *ListThermostatsRequest) (*ListThermostatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListThermostats not implemented")
+}
+func (UnimplementedReadingsServiceServer) GetThermostat(context.Context, *GetThermostatRequest) (*Thermostat, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetThermostat not implemented")
+}
+func (UnimplementedReadingsServiceServer) GetWeather(context.Context, *GetWeatherRequest) (*Weather, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWeather not implemented")
+}
+func (UnimplementedReadingsServiceServer) mustEmbedUnimplementedReadingsServiceServer() {}
+
+// UnsafeReadingsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReadingsServiceServer will
+// result in compilation errors.
+type UnsafeReadingsServiceServer interface {
+	mustEmbedUnimplementedReadingsServiceServer()
+}
+
+func RegisterReadingsServiceServer(s grpc.ServiceRegistrar, srv ReadingsServiceServer) {
+	s.RegisterService(&ReadingsService_ServiceDesc, srv)
+}
+
+func _ReadingsService_ListThermostats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListThermostatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingsServiceServer).ListThermostats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReadingsService_ListThermostats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingsServiceServer).ListThermostats(ctx, req.(*ListThermostatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReadingsService_GetThermostat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetThermostatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingsServiceServer).GetThermostat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReadingsService_GetThermostat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingsServiceServer).GetThermostat(ctx, req.(*GetThermostatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReadingsService_GetWeather_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWeatherRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReadingsServiceServer).GetWeather(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReadingsService_GetWeather_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReadingsServiceServer).GetWeather(ctx, req.(*GetWeatherRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ReadingsService_ServiceDesc is the grpc.ServiceDesc for ReadingsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ReadingsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pronestheus.v1.ReadingsService",
+	HandlerType: (*ReadingsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListThermostats",
+			Handler:    _ReadingsService_ListThermostats_Handler,
+		},
+		{
+			MethodName: "GetThermostat",
+			Handler:    _ReadingsService_GetThermostat_Handler,
+		},
+		{
+			MethodName: "GetWeather",
+			Handler:    _ReadingsService_GetWeather_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pronestheus/v1/readings.proto",
+}
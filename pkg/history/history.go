@@ -0,0 +1,266 @@
+// Package history keeps a local history of thermostat readings and serves it as JSON, for setups without
+// a time series database.
+//
+// Readings are kept in an SQLite database, so they survive restarts. It's opened with a pure Go driver, so the
+// exporter doesn't need cgo. Readings are indexed by device and time, and readings older than the retention are
+// deleted as new ones are added.
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	// Registers the "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// defaultRange is the time range of a query without the "from" parameter.
+const defaultRange = 24 * time.Hour
+
+// schema creates the tables of the database. Devices keep every resource name and label a device had, so queries
+// can look up devices by name and use the index of readings on device and time.
+const schema = `
+CREATE TABLE IF NOT EXISTS devices (
+	device_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	label TEXT NOT NULL,
+	PRIMARY KEY (device_id, id, label)
+);
+CREATE TABLE IF NOT EXISTS readings (
+	timestamp INTEGER NOT NULL,
+	device_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	label TEXT NOT NULL,
+	ambient_temperature_celsius REAL NOT NULL,
+	setpoint_temperature_celsius REAL NOT NULL,
+	humidity_percent REAL NOT NULL,
+	hvac_status TEXT NOT NULL,
+	mode TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS readings_device_timestamp ON readings (device_id, timestamp);
+`
+
+const (
+	insertDevice  = `INSERT OR IGNORE INTO devices (device_id, id, label) VALUES (?, ?, ?)`
+	insertReading = `INSERT INTO readings (timestamp, device_id, id, label, ambient_temperature_celsius,
+	setpoint_temperature_celsius, humidity_percent, hvac_status, mode) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	deleteOutdated = `DELETE FROM readings WHERE device_id IN (SELECT device_id FROM devices) AND timestamp < ?`
+	selectColumns  = `SELECT timestamp, device_id, id, label, ambient_temperature_celsius, setpoint_temperature_celsius,
+	humidity_percent, hvac_status, mode FROM readings`
+	selectAll    = selectColumns + ` WHERE timestamp BETWEEN ? AND ? ORDER BY timestamp, rowid`
+	selectDevice = selectColumns + ` WHERE device_id IN (
+	SELECT device_id FROM devices WHERE device_id = ?1 OR id = ?1 OR label = ?1
+) AND timestamp BETWEEN ?2 AND ?3 ORDER BY timestamp, rowid`
+)
+
+var (
+	errFailedOpening  = errors.New("failed opening history database")
+	errFailedWriting  = errors.New("failed writing history database")
+	errFailedQuerying = errors.New("failed querying history database")
+	errInvalidTime    = errors.New("invalid time; expected RFC 3339, eg. 2020-01-01T00:00:00Z")
+)
+
+// Reading is a single reading of a thermostat.
+type Reading struct {
+	Timestamp    time.Time `json:"timestamp"`
+	ID           string    `json:"id"`
+	DeviceID     string    `json:"device_id"`
+	Label        string    `json:"label"`
+	AmbientTemp  float64   `json:"ambient_temperature_celsius"`
+	SetpointTemp float64   `json:"setpoint_temperature_celsius"`
+	Humidity     float64   `json:"humidity_percent"`
+	Status       string    `json:"hvac_status"`
+	Mode         string    `json:"mode"`
+}
+
+// Config provides the configuration necessary to create the Store.
+// Logger is optional, if it's nil the Store doesn't log anything. Readings are kept forever if Retention is 0.
+type Config struct {
+	Logger    log.Logger
+	Path      string
+	Retention time.Duration
+}
+
+// Store keeps the history of readings.
+type Store struct {
+	db        *sql.DB
+	retention time.Duration
+	logger    log.Logger
+	now       func() time.Time
+}
+
+// New creates a Store using the given Config, creating its database if it doesn't exist.
+func New(cfg Config) (*Store, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	db, err := sql.Open("sqlite", cfg.Path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	// SQLite allows a single writer, so share one connection rather than waiting for locks.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	return &Store{
+		db:        db,
+		retention: cfg.Retention,
+		logger:    cfg.Logger,
+		now:       time.Now,
+	}, nil
+}
+
+// Close closes the history database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Listener returns a nest.Listener adding readings to the history, logging errors instead of returning them.
+func (s *Store) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		if err := s.Add(thermostats); err != nil {
+			s.logger.Log("level", "error", "message", "Failed storing readings in history", "stack", errors.WithStack(err))
+		}
+	}
+}
+
+// Add adds current readings of thermostats to the history and deletes readings older than the retention.
+func (s *Store) Add(thermostats []*nest.Thermostat) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+	defer tx.Rollback()
+
+	for _, therm := range thermostats {
+		timestamp := therm.UpdatedAt
+		if timestamp.IsZero() {
+			timestamp = s.now()
+		}
+
+		if _, err := tx.Exec(insertDevice, therm.DeviceID, therm.ID, therm.Label); err != nil {
+			return errors.Wrap(errFailedWriting, err.Error())
+		}
+
+		_, err := tx.Exec(insertReading, timestamp.UnixNano(), therm.DeviceID, therm.ID, therm.Label,
+			therm.AmbientTemp, therm.SetpointTemp, therm.Humidity, therm.Status, therm.Mode)
+		if err != nil {
+			return errors.Wrap(errFailedWriting, err.Error())
+		}
+	}
+
+	if s.retention > 0 {
+		if _, err := tx.Exec(deleteOutdated, s.now().Add(-s.retention).UnixNano()); err != nil {
+			return errors.Wrap(errFailedWriting, err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	return nil
+}
+
+// Query returns readings of the device between from and to, inclusive, in chronological order.
+// The device matches the resource name, device ID or label of thermostats. Readings of all devices are returned if
+// it's empty. Errors are logged and return no readings.
+func (s *Store) Query(device string, from, to time.Time) []Reading {
+	readings, err := s.query(device, from, to)
+	if err != nil {
+		s.logger.Log("level", "error", "message", "Failed querying history", "stack", errors.WithStack(err))
+		return []Reading{}
+	}
+
+	return readings
+}
+
+func (s *Store) query(device string, from, to time.Time) ([]Reading, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if device == "" {
+		rows, err = s.db.Query(selectAll, from.UnixNano(), to.UnixNano())
+	} else {
+		rows, err = s.db.Query(selectDevice, device, from.UnixNano(), to.UnixNano())
+	}
+	if err != nil {
+		return nil, errors.Wrap(errFailedQuerying, err.Error())
+	}
+	defer rows.Close()
+
+	readings := []Reading{}
+	for rows.Next() {
+		var (
+			r         Reading
+			timestamp int64
+		)
+		err := rows.Scan(&timestamp, &r.DeviceID, &r.ID, &r.Label, &r.AmbientTemp, &r.SetpointTemp, &r.Humidity,
+			&r.Status, &r.Mode)
+		if err != nil {
+			return nil, errors.Wrap(errFailedQuerying, err.Error())
+		}
+
+		r.Timestamp = time.Unix(0, timestamp).UTC()
+		readings = append(readings, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(errFailedQuerying, err.Error())
+	}
+
+	return readings, nil
+}
+
+// ServeHTTP serves readings matching the "device", "from" and "to" query parameters as a JSON array.
+// Times are in RFC 3339 format. By default readings of the last day are returned.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	to := s.now()
+	if value := query.Get("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, errors.Wrap(errInvalidTime, "to"))
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, errors.Wrap(errInvalidTime, "from"))
+			return
+		}
+		from = t
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Query(query.Get("device"), from, to))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
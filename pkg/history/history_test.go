@@ -0,0 +1,193 @@
+package history
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func thermostat(deviceID, label string, temp float64, updatedAt time.Time) *nest.Thermostat {
+	return &nest.Thermostat{
+		ID:          "enterprises/PROJECT_ID/devices/" + deviceID,
+		DeviceID:    deviceID,
+		Label:       label,
+		AmbientTemp: temp,
+		Status:      "OFF",
+		Mode:        "HEAT",
+		UpdatedAt:   updatedAt,
+	}
+}
+
+func newStore(t *testing.T, path string, retention time.Duration, now time.Time) *Store {
+	s, err := New(Config{Path: path, Retention: retention})
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newStore(t, filepath.Join(dir, "history.db"), 0, start)
+	defer s.Close()
+
+	assert.NoError(t, s.Add([]*nest.Thermostat{
+		thermostat("DEVICE_1", "Living-Room", 20, start),
+		thermostat("DEVICE_2", "Bedroom", 18, start),
+	}))
+	assert.NoError(t, s.Add([]*nest.Thermostat{
+		thermostat("DEVICE_1", "Living-Room", 21, start.Add(time.Hour)),
+	}))
+
+	tests := map[string]struct {
+		device string
+		from   time.Time
+		to     time.Time
+		want   []float64
+	}{
+		"all devices":      {"", start, start.Add(time.Hour), []float64{20, 18, 21}},
+		"by device ID":     {"DEVICE_1", start, start.Add(time.Hour), []float64{20, 21}},
+		"by label":         {"Bedroom", start, start.Add(time.Hour), []float64{18}},
+		"by resource name": {"enterprises/PROJECT_ID/devices/DEVICE_2", start, start.Add(time.Hour), []float64{18}},
+		"time range":       {"", start.Add(time.Minute), start.Add(2 * time.Hour), []float64{21}},
+		"unknown device":   {"DEVICE_3", start, start.Add(time.Hour), []float64{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			temps := []float64{}
+			for _, r := range s.Query(tt.device, tt.from, tt.to) {
+				temps = append(temps, r.AmbientTemp)
+			}
+			assert.Equal(t, tt.want, temps)
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history", "history.db")
+	base := time.Now().Add(-3 * time.Hour)
+
+	s := newStore(t, path, 150*time.Minute, base.Add(2*time.Hour))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Add([]*nest.Thermostat{thermostat("DEVICE_1", "Living-Room", float64(20+i), base.Add(time.Duration(i)*time.Hour))}))
+	}
+	assert.NoError(t, s.Close())
+
+	s, err = New(Config{Path: path, Retention: 150 * time.Minute})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.Len(t, s.Query("Living-Room", time.Time{}, time.Now()), 3)
+
+	// After a restart one hour later, the first reading is outside of the retention once a new one is added.
+	assert.NoError(t, s.Add([]*nest.Thermostat{thermostat("DEVICE_1", "Living-Room", 23, time.Now())}))
+
+	readings := s.Query("", time.Time{}, time.Now())
+	assert.Len(t, readings, 3)
+	assert.Equal(t, 21.0, readings[0].AmbientTemp)
+}
+
+func TestRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := start
+	s := newStore(t, filepath.Join(dir, "history.db"), time.Hour, now)
+	defer s.Close()
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		now = start.Add(time.Duration(i) * 30 * time.Minute)
+		assert.NoError(t, s.Add([]*nest.Thermostat{
+			thermostat("DEVICE_1", "Living-Room", 20, now),
+			thermostat("DEVICE_2", "Bedroom", 18, now),
+		}))
+	}
+
+	// Only readings within the last hour are kept.
+	var count int
+	assert.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM readings").Scan(&count))
+	assert.Equal(t, 6, count)
+	assert.Len(t, s.Query("Bedroom", time.Time{}, now), 3)
+}
+
+func TestInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.db")
+	err = ioutil.WriteFile(path, []byte(`{"timestamp":"2020-01-01T00:00:00Z","device_id":"DEVICE_1","ambient_temperature_celsius":20}`+"\n"), 0644)
+	assert.NoError(t, err)
+
+	_, err = New(Config{Path: path})
+	assert.Error(t, err)
+	assert.Equal(t, errFailedOpening, errors.Cause(err))
+}
+
+func TestServeHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := newStore(t, filepath.Join(dir, "history.db"), 0, start.Add(time.Hour))
+	defer s.Close()
+
+	assert.NoError(t, s.Add([]*nest.Thermostat{
+		thermostat("DEVICE_1", "Living-Room", 20, start),
+		thermostat("DEVICE_2", "Bedroom", 18, start),
+	}))
+
+	tests := map[string]struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		"default range": {
+			query:    "device=DEVICE_1",
+			wantCode: http.StatusOK,
+			wantBody: `[{"timestamp":"2020-01-01T00:00:00Z","id":"enterprises/PROJECT_ID/devices/DEVICE_1","device_id":"DEVICE_1","label":"Living-Room","ambient_temperature_celsius":20,"setpoint_temperature_celsius":0,"humidity_percent":0,"hvac_status":"OFF","mode":"HEAT"}]`,
+		},
+		"outside of range": {
+			query:    "from=2020-01-01T00:30:00Z&to=2020-01-02T00:00:00Z",
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		"invalid time": {
+			query:    "from=yesterday",
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":"from: invalid time; expected RFC 3339, eg. 2020-01-01T00:00:00Z"}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?"+tt.query, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Package homekit exposes thermostats as read-only accessories over the HomeKit Accessory Protocol (HAP), so their
+// readings show up in the Apple Home app without another integration calling the Device Access API.
+//
+// Thermostats are published by a single bridge accessory, which is paired once with the PIN. The bridge starts with
+// the thermostats from the first readings, thermostats added later are only published after a restart.
+package homekit
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/brutella/hc"
+	"github.com/brutella/hc/accessory"
+	"github.com/brutella/hc/characteristic"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultName is the name of the bridge shown in the Home app.
+const DefaultName = "ProNestheus"
+
+// Range of setpoint temperatures supported by Nest thermostats, in Celsius.
+const (
+	minSetpoint  = 9
+	maxSetpoint  = 32
+	setpointStep = 0.5
+)
+
+var (
+	errInvalidPin      = errors.New("invalid HomeKit PIN; expected 8 digits")
+	errFailedStarting  = errors.New("failed starting HomeKit bridge")
+	errNoThermostats   = errors.New("no thermostats to publish")
+	errUnknownReadings = errors.New("readings of unpublished thermostat")
+)
+
+// Config provides the configuration necessary to create the Bridge.
+// Logger is optional, if it's nil the Bridge doesn't log anything. Name defaults to DefaultName and Port to a random
+// port. StoragePath is the directory keeping pairings, which must be kept between restarts.
+type Config struct {
+	Logger      log.Logger
+	Name        string
+	Pin         string
+	Port        string
+	StoragePath string
+}
+
+// Bridge publishes thermostats as HomeKit accessories.
+type Bridge struct {
+	mu          sync.Mutex
+	cfg         Config
+	logger      log.Logger
+	thermostats map[string]*accessory.Thermostat
+	transport   hc.Transport
+
+	// start starts the HAP server, it's replaced in tests.
+	start func(bridge *accessory.Bridge, thermostats []*accessory.Accessory) (hc.Transport, error)
+}
+
+// New creates a Bridge using the given Config. It isn't started until the first readings.
+func New(cfg Config) (*Bridge, error) {
+	if _, err := hc.ValidatePin(cfg.Pin); err != nil {
+		return nil, errors.Wrap(errInvalidPin, err.Error())
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = DefaultName
+	}
+
+	b := &Bridge{
+		cfg:         cfg,
+		logger:      cfg.Logger,
+		thermostats: make(map[string]*accessory.Thermostat),
+	}
+	b.start = b.startTransport
+
+	return b, nil
+}
+
+// Listener returns a nest.Listener publishing readings, logging errors instead of returning them.
+func (b *Bridge) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		if err := b.Update(thermostats); err != nil {
+			b.logger.Log("level", "error", "message", "Failed publishing readings to HomeKit", "stack", errors.WithStack(err))
+		}
+	}
+}
+
+// Update publishes current readings of thermostats, starting the bridge with the first ones.
+func (b *Bridge) Update(thermostats []*nest.Thermostat) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.transport == nil {
+		if err := b.publish(thermostats); err != nil {
+			return err
+		}
+	}
+
+	var unknown []string
+	for _, therm := range thermostats {
+		acc, ok := b.thermostats[therm.ID]
+		if !ok {
+			unknown = append(unknown, therm.ID)
+			continue
+		}
+		update(acc, therm)
+	}
+
+	if len(unknown) > 0 {
+		return errors.Wrapf(errUnknownReadings, "%v; restart the exporter to publish new thermostats", unknown)
+	}
+
+	return nil
+}
+
+// Stop stops the bridge, if it was started.
+func (b *Bridge) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.transport != nil {
+		<-b.transport.Stop()
+	}
+}
+
+// publish creates accessories for the thermostats and starts the bridge.
+func (b *Bridge) publish(thermostats []*nest.Thermostat) error {
+	if len(thermostats) == 0 {
+		return errNoThermostats
+	}
+
+	bridge := accessory.NewBridge(accessory.Info{Name: b.cfg.Name, Manufacturer: "ProNestheus"})
+
+	var accessories []*accessory.Accessory
+	for _, therm := range thermostats {
+		acc := newThermostat(therm)
+		b.thermostats[therm.ID] = acc
+		accessories = append(accessories, acc.Accessory)
+	}
+
+	transport, err := b.start(bridge, accessories)
+	if err != nil {
+		return errors.Wrap(errFailedStarting, err.Error())
+	}
+	b.transport = transport
+
+	b.logger.Log("level", "info", "message", "Started HomeKit bridge", "thermostats", len(accessories))
+	return nil
+}
+
+func (b *Bridge) startTransport(bridge *accessory.Bridge, thermostats []*accessory.Accessory) (hc.Transport, error) {
+	transport, err := hc.NewIPTransport(hc.Config{
+		Pin:         b.cfg.Pin,
+		Port:        b.cfg.Port,
+		StoragePath: b.cfg.StoragePath,
+	}, bridge.Accessory, thermostats...)
+	if err != nil {
+		return nil, err
+	}
+
+	go transport.Start()
+	return transport, nil
+}
+
+// newThermostat creates a read-only accessory for the thermostat. Its ID is derived from the resource name of the
+// thermostat, so it doesn't change between restarts even if thermostats are discovered in a different order.
+func newThermostat(therm *nest.Thermostat) *accessory.Thermostat {
+	id := fnv.New32a()
+	id.Write([]byte(therm.ID))
+
+	acc := accessory.NewThermostat(accessory.Info{
+		Name:         therm.Label,
+		SerialNumber: therm.DeviceID,
+		Manufacturer: "Google Nest",
+		Model:        "Thermostat",
+		// IDs 0 and 1 are reserved for automatic assignment and the bridge.
+		ID: uint64(id.Sum32()) | 2,
+	}, therm.AmbientTemp, minSetpoint, maxSetpoint, setpointStep)
+
+	acc.Thermostat.CurrentTemperature.SetMinValue(-50)
+	acc.Thermostat.CurrentTemperature.SetMaxValue(100)
+	acc.Thermostat.CurrentTemperature.SetStepValue(0.1)
+
+	humidity := characteristic.NewCurrentRelativeHumidity()
+	acc.Thermostat.AddCharacteristic(humidity.Characteristic)
+
+	// The Home app must not offer controls, the exporter only reads the thermostats.
+	acc.Thermostat.TargetTemperature.Perms = characteristic.PermsRead()
+	acc.Thermostat.TargetHeatingCoolingState.Perms = characteristic.PermsRead()
+	acc.Thermostat.TemperatureDisplayUnits.Perms = characteristic.PermsRead()
+
+	update(acc, therm)
+	return acc
+}
+
+// update sets characteristics of the accessory to the readings of the thermostat.
+func update(acc *accessory.Thermostat, therm *nest.Thermostat) {
+	acc.Thermostat.CurrentTemperature.SetValue(therm.AmbientTemp)
+	acc.Thermostat.TargetTemperature.SetValue(therm.SetpointTemp)
+	acc.Thermostat.CurrentHeatingCoolingState.SetValue(currentState(therm.Status))
+	acc.Thermostat.TargetHeatingCoolingState.SetValue(targetState(therm.Mode))
+
+	for _, c := range acc.Thermostat.Characteristics {
+		if c.Type == characteristic.TypeCurrentRelativeHumidity {
+			c.UpdateValue(therm.Humidity)
+		}
+	}
+}
+
+// currentState maps the HVAC status of a thermostat to the current heating cooling state.
+func currentState(status string) int {
+	switch status {
+	case "HEATING":
+		return characteristic.CurrentHeatingCoolingStateHeat
+	case "COOLING":
+		return characteristic.CurrentHeatingCoolingStateCool
+	default:
+		return characteristic.CurrentHeatingCoolingStateOff
+	}
+}
+
+// targetState maps the mode of a thermostat to the target heating cooling state. HomeKit doesn't have an eco mode,
+// in which the thermostat keeps the temperature in a range, the closest is auto.
+func targetState(mode string) int {
+	switch mode {
+	case "HEAT":
+		return characteristic.TargetHeatingCoolingStateHeat
+	case "COOL":
+		return characteristic.TargetHeatingCoolingStateCool
+	case "HEATCOOL", "ECO":
+		return characteristic.TargetHeatingCoolingStateAuto
+	default:
+		return characteristic.TargetHeatingCoolingStateOff
+	}
+}
@@ -0,0 +1,120 @@
+package homekit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/brutella/hc"
+	"github.com/brutella/hc/accessory"
+	"github.com/brutella/hc/characteristic"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type fakeTransport struct {
+	stopped bool
+}
+
+func (t *fakeTransport) Start() {}
+
+func (t *fakeTransport) Stop() <-chan struct{} {
+	t.stopped = true
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		wantErr error
+	}{
+		{name: "valid PIN", pin: "12344321"},
+		{name: "too short PIN", pin: "1234", wantErr: errInvalidPin},
+		{name: "trivial PIN", pin: "12345678", wantErr: errInvalidPin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(Config{Pin: tt.pin})
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	b, err := New(Config{Pin: "12344321"})
+	assert.NoError(t, err)
+
+	transport := &fakeTransport{}
+	var published []*accessory.Accessory
+	b.start = func(bridge *accessory.Bridge, thermostats []*accessory.Accessory) (hc.Transport, error) {
+		assert.Equal(t, DefaultName, bridge.Info.Name.GetValue())
+		published = thermostats
+		return transport, nil
+	}
+
+	// Nothing is published until there are readings.
+	assert.True(t, errors.Is(b.Update(nil), errNoThermostats))
+	assert.Nil(t, published)
+
+	therm := &nest.Thermostat{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:     "DEVICE_ID",
+		Label:        "Living Room",
+		AmbientTemp:  20.5,
+		SetpointTemp: 19,
+		Humidity:     45,
+		Status:       "HEATING",
+		Mode:         "HEAT",
+	}
+	assert.NoError(t, b.Update([]*nest.Thermostat{therm}))
+	assert.Len(t, published, 1)
+
+	acc := b.thermostats[therm.ID]
+	assert.Equal(t, published[0], acc.Accessory)
+	assert.Equal(t, "Living Room", acc.Info.Name.GetValue())
+	assert.Equal(t, "DEVICE_ID", acc.Info.SerialNumber.GetValue())
+	assert.Equal(t, 20.5, acc.Thermostat.CurrentTemperature.GetValue())
+	assert.Equal(t, 19.0, acc.Thermostat.TargetTemperature.GetValue())
+	assert.Equal(t, characteristic.CurrentHeatingCoolingStateHeat, acc.Thermostat.CurrentHeatingCoolingState.GetValue())
+	assert.Equal(t, characteristic.TargetHeatingCoolingStateHeat, acc.Thermostat.TargetHeatingCoolingState.GetValue())
+	assert.False(t, acc.Thermostat.TargetTemperature.IsWritable())
+	assert.False(t, acc.Thermostat.TargetHeatingCoolingState.IsWritable())
+
+	updated := *therm
+	updated.AmbientTemp = 21
+	updated.Humidity = 50
+	updated.Status = "OFF"
+	updated.Mode = "ECO"
+	other := &nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/OTHER_ID"}
+
+	// Thermostats discovered later aren't published, but known ones are still updated.
+	assert.True(t, errors.Is(b.Update([]*nest.Thermostat{&updated, other}), errUnknownReadings))
+	assert.Equal(t, 21.0, acc.Thermostat.CurrentTemperature.GetValue())
+	assert.Equal(t, characteristic.CurrentHeatingCoolingStateOff, acc.Thermostat.CurrentHeatingCoolingState.GetValue())
+	assert.Equal(t, characteristic.TargetHeatingCoolingStateAuto, acc.Thermostat.TargetHeatingCoolingState.GetValue())
+	for _, c := range acc.Thermostat.Characteristics {
+		if c.Type == characteristic.TypeCurrentRelativeHumidity {
+			assert.Equal(t, 50.0, c.GetValue())
+		}
+	}
+
+	b.Stop()
+	assert.True(t, transport.stopped)
+}
+
+func TestStableIDs(t *testing.T) {
+	first := newThermostat(&nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/DEVICE_1"})
+	second := newThermostat(&nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/DEVICE_2"})
+
+	assert.Equal(t, first.ID, newThermostat(&nest.Thermostat{ID: "enterprises/PROJECT_ID/devices/DEVICE_1"}).ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.True(t, first.ID > 1)
+}
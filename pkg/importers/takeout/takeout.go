@@ -0,0 +1,266 @@
+// Package takeout parses Nest data exported with Google Takeout into the thermostat model of the nest collector.
+//
+// Takeout archives contain a directory for every thermostat, with monthly sensor and summary files:
+//
+//	Takeout/Nest/thermostats/DEVICE_ID/2020/01/2020-01-sensors.csv
+//	Takeout/Nest/thermostats/DEVICE_ID/2020/01/2020-01-summary.json
+//
+// Sensor files contain the inside temperature and humidity every 15 minutes. Summary files contain, among others,
+// HVAC cycles: periods when the thermostat was heating or cooling.
+package takeout
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var (
+	errFailedOpening  = errors.New("failed opening Takeout archive")
+	errFailedReading  = errors.New("failed reading Takeout file")
+	errInvalidSensors = errors.New("invalid Takeout sensors file")
+	errInvalidSummary = errors.New("invalid Takeout summary file")
+)
+
+// Cycle is a period when the thermostat was running the HVAC system.
+type Cycle struct {
+	Start   time.Time
+	End     time.Time
+	Heating bool
+	Cooling bool
+}
+
+// Device contains the history of a single thermostat. Readings and cycles are sorted by time.
+//
+// Sensor files only contain the inside temperature and humidity, other fields of the readings are empty.
+// Temperature or humidity is NaN if it's missing in the file.
+type Device struct {
+	ID       string
+	Readings []*nest.Thermostat
+	Cycles   []Cycle
+}
+
+// Archive contains the history of all thermostats found in a Takeout archive, sorted by device ID.
+type Archive struct {
+	Devices []*Device
+}
+
+// Open parses the Takeout archive at path, either a zip file or an extracted directory. Local dates and times
+// in sensor files are interpreted in the given location.
+func Open(archivePath string, loc *time.Location) (*Archive, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, errors.Wrap(errFailedOpening, err.Error())
+	}
+
+	p := newParser(loc)
+
+	if info.IsDir() {
+		err = filepath.Walk(archivePath, func(name string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			return p.add(filepath.ToSlash(name), func() (io.ReadCloser, error) { return os.Open(name) })
+		})
+	} else {
+		var r *zip.ReadCloser
+		if r, err = zip.OpenReader(archivePath); err != nil {
+			return nil, errors.Wrap(errFailedOpening, err.Error())
+		}
+		defer r.Close()
+
+		for _, f := range r.File {
+			if err = p.add(f.Name, f.Open); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.archive(), nil
+}
+
+// parser collects the history of devices from files of the archive.
+type parser struct {
+	loc     *time.Location
+	devices map[string]*Device
+}
+
+func newParser(loc *time.Location) *parser {
+	return &parser{loc: loc, devices: make(map[string]*Device)}
+}
+
+// add parses the file if it's a sensors or summary file of a thermostat. Other files are ignored.
+func (p *parser) add(name string, open func() (io.ReadCloser, error)) error {
+	deviceID := deviceIDFromPath(name)
+	base := path.Base(name)
+	isSensors := strings.HasSuffix(base, "-sensors.csv")
+	isSummary := strings.HasSuffix(base, "-summary.json")
+
+	if deviceID == "" || !(isSensors || isSummary) {
+		return nil
+	}
+
+	f, err := open()
+	if err != nil {
+		return errors.Wrap(errFailedReading, err.Error())
+	}
+	defer f.Close()
+
+	device, ok := p.devices[deviceID]
+	if !ok {
+		device = &Device{ID: deviceID}
+		p.devices[deviceID] = device
+	}
+
+	if isSensors {
+		readings, err := ParseSensors(f, deviceID, p.loc)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+		device.Readings = append(device.Readings, readings...)
+	} else {
+		cycles, err := ParseSummary(f)
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+		device.Cycles = append(device.Cycles, cycles...)
+	}
+
+	return nil
+}
+
+func (p *parser) archive() *Archive {
+	archive := &Archive{}
+	for _, device := range p.devices {
+		sort.SliceStable(device.Readings, func(i, j int) bool { return device.Readings[i].UpdatedAt.Before(device.Readings[j].UpdatedAt) })
+		sort.SliceStable(device.Cycles, func(i, j int) bool { return device.Cycles[i].Start.Before(device.Cycles[j].Start) })
+		archive.Devices = append(archive.Devices, device)
+	}
+
+	sort.Slice(archive.Devices, func(i, j int) bool { return archive.Devices[i].ID < archive.Devices[j].ID })
+	return archive
+}
+
+// deviceIDFromPath returns the device ID from the path of a file in the thermostats directory,
+// eg. "Takeout/Nest/thermostats/DEVICE_ID/2020/01/2020-01-sensors.csv". It returns an empty string for other files.
+func deviceIDFromPath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if part == "thermostats" && i+2 < len(parts) {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// IsSensorsHeader returns true if the CSV header is the header of a Takeout sensors file.
+func IsSensorsHeader(header []string) bool {
+	return len(header) >= 3 && header[0] == "Date" && header[1] == "Time" && header[2] == "avg(temp)"
+}
+
+// ParseSensors parses a sensors CSV file of the thermostat. Empty rows are skipped.
+func ParseSensors(r io.Reader, deviceID string, loc *time.Location) ([]*nest.Thermostat, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(errInvalidSensors, err.Error())
+	}
+
+	if len(rows) == 0 || !IsSensorsHeader(rows[0]) {
+		return nil, errors.Wrap(errInvalidSensors, "unexpected header")
+	}
+
+	var readings []*nest.Thermostat
+	for i, row := range rows[1:] {
+		values := []float64{math.NaN(), math.NaN()}
+		empty := true
+
+		for j := range values {
+			if len(row) <= j+2 || strings.TrimSpace(row[j+2]) == "" {
+				continue
+			}
+
+			if values[j], err = strconv.ParseFloat(strings.TrimSpace(row[j+2]), 64); err != nil {
+				return nil, errors.Wrap(errInvalidSensors, fmt.Sprintf("line %d: %s", i+2, err))
+			}
+			empty = false
+		}
+
+		if empty {
+			continue
+		}
+
+		t, err := time.ParseInLocation("2006-01-02 15:04", row[0]+" "+row[1], loc)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidSensors, fmt.Sprintf("line %d: %s", i+2, err))
+		}
+
+		readings = append(readings, &nest.Thermostat{
+			ID:          deviceID,
+			DeviceID:    deviceID,
+			AmbientTemp: values[0],
+			Humidity:    values[1],
+			UpdatedAt:   t,
+		})
+	}
+
+	return readings, nil
+}
+
+// ParseSummary parses HVAC cycles from a summary JSON file. The file maps days to their summaries,
+// each containing a list of cycles with RFC 3339 start and end timestamps.
+func ParseSummary(r io.Reader) ([]Cycle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(errFailedReading, err.Error())
+	}
+
+	if !gjson.ValidBytes(data) {
+		return nil, errors.Wrap(errInvalidSummary, "malformed JSON")
+	}
+
+	var cycles []Cycle
+	gjson.ParseBytes(data).ForEach(func(_, day gjson.Result) bool {
+		day.Get("cycles").ForEach(func(_, c gjson.Result) bool {
+			start, errStart := time.Parse(time.RFC3339Nano, c.Get("startTs").String())
+			end, errEnd := time.Parse(time.RFC3339Nano, c.Get("endTs").String())
+			if errStart != nil || errEnd != nil {
+				err = errors.Wrap(errInvalidSummary, "invalid cycle timestamps")
+				return false
+			}
+
+			cycles = append(cycles, Cycle{
+				Start:   start,
+				End:     end,
+				Heating: c.Get("heat1").Bool() || c.Get("heat2").Bool() || c.Get("heat3").Bool() || c.Get("heatAux").Bool(),
+				Cooling: c.Get("cool1").Bool() || c.Get("cool2").Bool(),
+			})
+			return true
+		})
+		return err == nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cycles, nil
+}
@@ -0,0 +1,110 @@
+package takeout
+
+import (
+	"archive/zip"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	archive, err := Open("testdata", time.UTC)
+	assert.NoError(t, err)
+	assertArchive(t, archive)
+}
+
+func TestOpenZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "takeout")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	zipPath := filepath.Join(dir, "takeout.zip")
+	f, err := os.Create(zipPath)
+	assert.NoError(t, err)
+
+	w := zip.NewWriter(f)
+	err = filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		entry, err := w.Create(filepath.ToSlash(strings.TrimPrefix(path, "testdata"+string(filepath.Separator))))
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+
+	archive, err := Open(zipPath, time.UTC)
+	assert.NoError(t, err)
+	assertArchive(t, archive)
+}
+
+func assertArchive(t *testing.T, archive *Archive) {
+	assert.Len(t, archive.Devices, 2)
+
+	device := archive.Devices[0]
+	assert.Equal(t, "DEVICE_1", device.ID)
+	assert.Len(t, device.Readings, 2)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), device.Readings[0].UpdatedAt)
+	assert.Equal(t, 20.5, device.Readings[0].AmbientTemp)
+	assert.Equal(t, 45.0, device.Readings[0].Humidity)
+	assert.Equal(t, 20.6, device.Readings[1].AmbientTemp)
+	assert.Equal(t, []Cycle{{
+		Start:   time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC),
+		End:     time.Date(2020, 1, 1, 6, 45, 0, 0, time.UTC),
+		Heating: true,
+	}}, device.Cycles)
+
+	assert.Equal(t, "DEVICE_2", archive.Devices[1].ID)
+	assert.Len(t, archive.Devices[1].Readings, 1)
+	assert.Empty(t, archive.Devices[1].Cycles)
+}
+
+func TestParseSensors(t *testing.T) {
+	readings, err := ParseSensors(strings.NewReader("Date,Time,avg(temp),avg(humidity)\n2020-01-01,00:00,,45\n"), "DEVICE_1", time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, readings, 1)
+	assert.True(t, math.IsNaN(readings[0].AmbientTemp))
+	assert.Equal(t, 45.0, readings[0].Humidity)
+
+	tests := []struct {
+		name string
+		csv  string
+	}{
+		{"unexpected header", "timestamp,temp\n"},
+		{"invalid time", "Date,Time,avg(temp),avg(humidity)\n2020-01-01,noon,20,45\n"},
+		{"invalid value", "Date,Time,avg(temp),avg(humidity)\n2020-01-01,00:00,warm,45\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseSensors(strings.NewReader(test.csv), "DEVICE_1", time.UTC)
+			assert.True(t, errors.Is(err, errInvalidSensors))
+		})
+	}
+}
+
+func TestParseSummaryInvalid(t *testing.T) {
+	_, err := ParseSummary(strings.NewReader(`{"2020-01-01T00:00:00Z":{"cycles":[{"startTs":"yesterday"}]}}`))
+	assert.True(t, errors.Is(err, errInvalidSummary))
+
+	_, err = ParseSummary(strings.NewReader(`{"cycles":`))
+	assert.True(t, errors.Is(err, errInvalidSummary))
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errInvalidCollectorTimeout = errors.New("invalid collector timeout; expected COLLECTOR=DURATION with a collector of [nest, weather, solar, sensors, awair]")
+
+// collectorNames are the names of collectors which can have their own timeout.
+var collectorNames = map[string]bool{"nest": true, "weather": true, "solar": true, "sensors": true, "awair": true}
+
+// timedCollector wraps a collector and exports the duration of its Collect calls.
+type timedCollector struct {
+	collector prometheus.Collector
+	duration  *prometheus.Desc
+}
+
+func newTimedCollector(name string, collector prometheus.Collector) *timedCollector {
+	return &timedCollector{
+		collector: collector,
+		duration: prometheus.NewDesc(
+			"pronestheus_collector_duration_seconds",
+			"Duration of a collector scrape.",
+			nil,
+			prometheus.Labels{"collector": name},
+		),
+	}
+}
+
+// Describe implements the prometheus.Describe interface.
+func (t *timedCollector) Describe(ch chan<- *prometheus.Desc) {
+	t.collector.Describe(ch)
+	ch <- t.duration
+}
+
+// Collect implements the prometheus.Collector interface.
+func (t *timedCollector) Collect(ch chan<- prometheus.Metric) {
+	start := time.Now()
+	t.collector.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(t.duration, prometheus.GaugeValue, time.Since(start).Seconds())
+}
+
+// timeoutCollector wraps a collector and stops waiting for its metrics once the timeout passes, so a hanging
+// collector can't delay the scrape of the others. Metrics collected before the timeout are still exported. Whether
+// the collection timed out is exported unless timedOut is nil.
+type timeoutCollector struct {
+	name      string
+	collector prometheus.Collector
+	timeout   time.Duration
+	logger    log.Logger
+	timedOut  *prometheus.Desc
+}
+
+func newTimeoutCollector(name string, collector prometheus.Collector, timeout time.Duration, logger log.Logger, exported bool) *timeoutCollector {
+	t := &timeoutCollector{
+		name:      name,
+		collector: collector,
+		timeout:   timeout,
+		logger:    logger,
+	}
+
+	if exported {
+		t.timedOut = prometheus.NewDesc(
+			"pronestheus_collector_timed_out",
+			"Whether the last collector scrape was abandoned after its timeout.",
+			nil,
+			prometheus.Labels{"collector": name},
+		)
+	}
+
+	return t
+}
+
+// Describe implements the prometheus.Describe interface.
+func (t *timeoutCollector) Describe(ch chan<- *prometheus.Desc) {
+	t.collector.Describe(ch)
+	if t.timedOut != nil {
+		ch <- t.timedOut
+	}
+}
+
+// Collect implements the prometheus.Collector interface.
+func (t *timeoutCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		t.collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case metric, ok := <-metrics:
+			if !ok {
+				t.collectTimedOut(ch, 0)
+				return
+			}
+			ch <- metric
+		case <-timer.C:
+			// The abandoned collection keeps running until its requests time out, its metrics are discarded.
+			go func() {
+				for range metrics {
+				}
+			}()
+			t.logger.Log("level", "warn", "msg", "Collector timed out", "collector", t.name, "timeout", t.timeout)
+			t.collectTimedOut(ch, 1)
+			return
+		}
+	}
+}
+
+func (t *timeoutCollector) collectTimedOut(ch chan<- prometheus.Metric, value float64) {
+	if t.timedOut != nil {
+		ch <- prometheus.MustNewConstMetric(t.timedOut, prometheus.GaugeValue, value)
+	}
+}
+
+// collectorTimeout returns the timeout of the named collector, which defaults to the scrape timeout.
+func (cfg *ExporterConfig) collectorTimeout(name string) time.Duration {
+	if cfg.CollectorTimeouts != nil {
+		if timeout, err := time.ParseDuration((*cfg.CollectorTimeouts)[name]); err == nil && timeout > 0 {
+			return timeout
+		}
+	}
+
+	return time.Duration(*cfg.Timeout) * time.Millisecond
+}
+
+// validateCollectorTimeouts returns an error if a collector timeout is given for an unknown collector or isn't a
+// positive duration.
+func validateCollectorTimeouts(cfg *ExporterConfig) error {
+	if cfg.CollectorTimeouts == nil {
+		return nil
+	}
+
+	for name, value := range *cfg.CollectorTimeouts {
+		if !collectorNames[name] {
+			return errors.Wrap(errInvalidCollectorTimeout, name)
+		}
+		if timeout, err := time.ParseDuration(value); err != nil || timeout <= 0 {
+			return errors.Wrap(errInvalidCollectorTimeout, name+"="+value)
+		}
+	}
+
+	return nil
+}
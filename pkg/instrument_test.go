@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// hangingCollector exports a metric and then blocks until it's released.
+type hangingCollector struct {
+	desc    *prometheus.Desc
+	release chan struct{}
+}
+
+func (c *hangingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *hangingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+	<-c.release
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 2)
+}
+
+func TestTimeoutCollector(t *testing.T) {
+	hanging := &hangingCollector{
+		desc:    prometheus.NewDesc("test_hanging", "Metric of a hanging collector.", nil, nil),
+		release: make(chan struct{}),
+	}
+	defer close(hanging.release)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, registry.Register(newTimeoutCollector("hanging", hanging, 20*time.Millisecond, log.NewNopLogger(), true)))
+
+	start := time.Now()
+	expected := `
+# HELP pronestheus_collector_timed_out Whether the last collector scrape was abandoned after its timeout.
+# TYPE pronestheus_collector_timed_out gauge
+pronestheus_collector_timed_out{collector="hanging"} 1
+# HELP test_hanging Metric of a hanging collector.
+# TYPE test_hanging gauge
+test_hanging 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)), "metrics before the timeout are exported")
+	assert.Less(t, time.Since(start).Seconds(), time.Second.Seconds())
+}
+
+func TestCollectorTimeouts(t *testing.T) {
+	cfg := testConfig()
+	assert.Equal(t, 5*time.Second, cfg.collectorTimeout("weather"))
+
+	timeouts := map[string]string{"weather": "2s"}
+	cfg.CollectorTimeouts = &timeouts
+	assert.NoError(t, validateCollectorTimeouts(cfg))
+	assert.Equal(t, 2*time.Second, cfg.collectorTimeout("weather"))
+	assert.Equal(t, 5*time.Second, cfg.collectorTimeout("nest"))
+
+	for _, invalid := range []map[string]string{{"thermostat": "2s"}, {"nest": "2"}, {"nest": "-1s"}} {
+		cfg.CollectorTimeouts = &invalid
+		assert.True(t, errors.Is(validateCollectorTimeouts(cfg), errInvalidCollectorTimeout), "%v", invalid)
+	}
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/leader"
+)
+
+const (
+	leaderElectionNone       = "none"
+	leaderElectionFile       = "file"
+	leaderElectionKubernetes = "kubernetes"
+)
+
+// defaultLeaseName is the name of the Kubernetes Lease if it isn't configured.
+const defaultLeaseName = "pronestheus"
+
+var (
+	errInvalidLeaderElection = errors.New("invalid leader election method")
+	errMissingLockFile       = errors.New("leader election lock file is missing")
+)
+
+// elected returns true if only the leader of the replicas should consume Pub/Sub messages and push readings.
+func (cfg *ExporterConfig) elected() bool {
+	return cfg.LeaderElection != nil && *cfg.LeaderElection != "" && *cfg.LeaderElection != leaderElectionNone
+}
+
+// newElector creates the Elector with the lock given by the config. Locks are acquired or renewed three times per
+// lease duration, so a Kubernetes lease is renewed long before it expires.
+func newElector(cfg *ExporterConfig, logger log.Logger) (*leader.Elector, error) {
+	identity, err := leaderIdentity(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	electorCfg := leader.Config{Logger: logger}
+	if cfg.LeaderElectionLease != nil {
+		electorCfg.RetryPeriod = *cfg.LeaderElectionLease / 3
+	}
+
+	switch *cfg.LeaderElection {
+	case leaderElectionFile:
+		if cfg.LeaderElectionLock == nil || *cfg.LeaderElectionLock == "" {
+			return nil, errMissingLockFile
+		}
+		electorCfg.Lock = leader.NewFileLock(*cfg.LeaderElectionLock, identity)
+	case leaderElectionKubernetes:
+		leaseCfg := leader.KubernetesConfig{Name: defaultLeaseName, Identity: identity}
+		if cfg.LeaderElectionLock != nil && *cfg.LeaderElectionLock != "" {
+			leaseCfg.Name = *cfg.LeaderElectionLock
+		}
+		if i := strings.Index(leaseCfg.Name, "/"); i >= 0 {
+			leaseCfg.Namespace, leaseCfg.Name = leaseCfg.Name[:i], leaseCfg.Name[i+1:]
+		}
+		if cfg.LeaderElectionLease != nil {
+			leaseCfg.LeaseDuration = *cfg.LeaderElectionLease
+		}
+
+		lease, err := leader.NewKubernetesLease(leaseCfg)
+		if err != nil {
+			return nil, err
+		}
+		electorCfg.Lock = lease
+	default:
+		return nil, errors.Wrap(errInvalidLeaderElection, *cfg.LeaderElection)
+	}
+
+	return leader.New(electorCfg)
+}
+
+// leaderIdentity returns the identity of the replica from the config, defaulting to the hostname, which is the name
+// of the pod in Kubernetes.
+func leaderIdentity(cfg *ExporterConfig) (string, error) {
+	if cfg.LeaderElectionID != nil && *cfg.LeaderElectionID != "" {
+		return *cfg.LeaderElectionID, nil
+	}
+
+	return os.Hostname()
+}
+
+// setupLeaderElection creates the Elector if leader election is enabled. Leader tasks are only started by
+// startLeaderElection, after all of them are added.
+func (e *Exporter) setupLeaderElection(cfg *ExporterConfig) error {
+	if !cfg.elected() {
+		return nil
+	}
+
+	elector, err := newElector(cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.exporterMetricsDisabled() {
+		if err := prometheus.Register(elector); err != nil {
+			return err
+		}
+	}
+
+	e.elector = elector
+	return nil
+}
+
+// startLeaderElection starts the leader election in the background. Shutdown waits for it to release the lock.
+func (e *Exporter) startLeaderElection() {
+	if e.elector == nil {
+		return
+	}
+
+	tasks := e.leaderTasks
+	e.runUntilShutdown(func(ctx context.Context) { e.elector.Run(ctx, tasks...) })
+	e.logger.Log("level", "info", "msg", "Leader election enabled, Pub/Sub consumption and push outputs only run on the leader")
+}
+
+// runAsLeader runs the task in the background. With leader election, it only runs while this replica is the leader.
+func (e *Exporter) runAsLeader(task func(ctx context.Context)) {
+	if e.elector == nil {
+		go task(e.ctx)
+		return
+	}
+
+	e.leaderTasks = append(e.leaderTasks, task)
+}
+
+// leaderListener returns a nest.Listener passing readings to the listener only while this replica is the leader, so
+// followers don't queue notifications or commands which only the leader sends.
+func (e *Exporter) leaderListener(listener nest.Listener) nest.Listener {
+	if e.elector == nil {
+		return listener
+	}
+
+	return func(thermostats []*nest.Thermostat) {
+		if e.elector.IsLeader() {
+			listener(thermostats)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package leader
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var errFailedLockingFile = errors.New("failed locking file")
+
+// FileLock is a Lock held with an exclusive flock on a file, eg. on a volume shared by replicas. The lock is released
+// by the operating system when the process exits, so it never has to expire.
+type FileLock struct {
+	path     string
+	identity string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileLock creates a FileLock on the file at path. The identity of the holder is written into the file, to see
+// which replica is the leader.
+func NewFileLock(path, identity string) *FileLock {
+	return &FileLock{path: path, identity: identity}
+}
+
+// Acquire implements the Lock interface.
+func (l *FileLock) Acquire(_ context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, errors.Wrap(errFailedLockingFile, err.Error())
+	}
+
+	locked, err := lockFile(file)
+	if err != nil || !locked {
+		file.Close()
+		return false, err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		unlockFile(file)
+		file.Close()
+		return false, errors.Wrap(errFailedLockingFile, err.Error())
+	}
+	if _, err := file.WriteAt([]byte(l.identity+"\n"), 0); err != nil {
+		unlockFile(file)
+		file.Close()
+		return false, errors.Wrap(errFailedLockingFile, err.Error())
+	}
+
+	l.file = file
+	return true, nil
+}
+
+// Release implements the Lock interface.
+func (l *FileLock) Release(_ context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+
+	return err
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package leader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "leader.lock")
+	ctx := context.Background()
+	first := NewFileLock(path, "replica-1")
+	second := NewFileLock(path, "replica-2")
+
+	acquired, err := first.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = first.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the lock is renewed by its holder")
+
+	acquired, err = second.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "replica-1\n", string(data))
+
+	assert.NoError(t, first.Release(ctx))
+
+	acquired, err = second.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	assert.NoError(t, second.Release(ctx))
+}
+
+func TestFileLockInvalidPath(t *testing.T) {
+	_, err := NewFileLock(filepath.Join("missing", "dir", "leader.lock"), "replica-1").Acquire(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,17 @@
+package leader
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var errFileLockUnsupported = errors.New("file locks aren't supported on Windows, use a Kubernetes lease")
+
+func lockFile(_ *os.File) (bool, error) {
+	return false, errFileLockUnsupported
+}
+
+func unlockFile(_ *os.File) error {
+	return errFileLockUnsupported
+}
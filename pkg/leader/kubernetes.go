@@ -0,0 +1,301 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLeaseDuration is the time after which a lease which isn't renewed can be taken over by another replica.
+const DefaultLeaseDuration = 15 * time.Second
+
+// serviceAccountDir is where Kubernetes mounts the credentials of the service account of the pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the format of times in Leases.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+const requestTimeout = 10 * time.Second
+
+var (
+	errNotInCluster       = errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST is missing")
+	errNoLeaseName        = errors.New("lease name is missing")
+	errNoIdentity         = errors.New("leader election identity is missing")
+	errFailedReadingCreds = errors.New("failed reading service account credentials")
+	errFailedLeaseRequest = errors.New("failed calling Kubernetes Lease API")
+	errUnexpectedStatus   = errors.New("unexpected status of Kubernetes Lease API")
+)
+
+// KubernetesConfig provides the configuration necessary to create the KubernetesLease. Only Name and Identity are
+// required, the rest defaults to the in-cluster configuration: the API server given by the KUBERNETES_SERVICE_HOST
+// and KUBERNETES_SERVICE_PORT environment variables and the token, CA certificate and namespace of the service
+// account of the pod. LeaseDuration defaults to DefaultLeaseDuration.
+type KubernetesConfig struct {
+	APIURL        string
+	Client        *http.Client
+	TokenFile     string
+	Namespace     string
+	Name          string
+	Identity      string
+	LeaseDuration time.Duration
+}
+
+// KubernetesLease is a Lock held by renewing a coordination.k8s.io/v1 Lease, like the leader election of Kubernetes
+// controllers. The service account of the pod needs permissions to get, create and update the Lease.
+type KubernetesLease struct {
+	url           string
+	name          string
+	client        *http.Client
+	tokenFile     string
+	identity      string
+	leaseDuration time.Duration
+	now           func() time.Time
+
+	// The expiration of leases held by others is measured with the local clock, from the time their renewal was
+	// observed, so it isn't affected by clock skew between replicas.
+	mu         sync.Mutex
+	observed   leaseSpec
+	observedAt time.Time
+}
+
+// lease is the coordination.k8s.io/v1 Lease. Metadata is kept as it is, so updates don't drop labels or annotations.
+type lease struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Spec       leaseSpec              `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+// NewKubernetesLease creates a KubernetesLease using the given KubernetesConfig. It returns an error if the
+// in-cluster configuration is needed but not available.
+func NewKubernetesLease(cfg KubernetesConfig) (*KubernetesLease, error) {
+	if cfg.Name == "" {
+		return nil, errNoLeaseName
+	}
+
+	if cfg.Identity == "" {
+		return nil, errNoIdentity
+	}
+
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = DefaultLeaseDuration
+	}
+
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = filepath.Join(serviceAccountDir, "token")
+	}
+
+	if cfg.Namespace == "" {
+		namespace, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, errors.Wrap(errFailedReadingCreds, err.Error())
+		}
+		cfg.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	if cfg.APIURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, errNotInCluster
+		}
+		cfg.APIURL = "https://" + net.JoinHostPort(host, port)
+	}
+
+	if cfg.Client == nil {
+		client, err := inClusterClient()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Client = client
+	}
+
+	return &KubernetesLease{
+		url:           fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", strings.TrimSuffix(cfg.APIURL, "/"), cfg.Namespace),
+		name:          cfg.Name,
+		client:        cfg.Client,
+		tokenFile:     cfg.TokenFile,
+		identity:      cfg.Identity,
+		leaseDuration: cfg.LeaseDuration,
+		now:           time.Now,
+	}, nil
+}
+
+// inClusterClient returns a client trusting the CA certificate of the cluster.
+func inClusterClient() (*http.Client, error) {
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, errors.Wrap(errFailedReadingCreds, err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Wrap(errFailedReadingCreds, "invalid CA certificate")
+	}
+
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// Acquire implements the Lock interface. The lease is created if it doesn't exist. A lease held by another replica
+// is taken over when it hasn't been renewed for its duration. Conflicting updates by other replicas aren't errors,
+// the lease just isn't acquired.
+func (l *KubernetesLease) Acquire(ctx context.Context) (bool, error) {
+	current, found, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	now := l.now()
+	if !found {
+		current = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   map[string]interface{}{"name": l.name},
+		}
+	} else if l.heldByOther(current.Spec, now) {
+		return false, nil
+	}
+
+	spec := &current.Spec
+	if spec.HolderIdentity != l.identity {
+		if found {
+			spec.LeaseTransitions++
+		}
+		spec.AcquireTime = now.UTC().Format(microTime)
+	}
+	spec.HolderIdentity = l.identity
+	spec.LeaseDurationSeconds = int(l.leaseDuration.Seconds())
+	spec.RenewTime = now.UTC().Format(microTime)
+
+	if found {
+		return l.write(ctx, http.MethodPut, l.url+"/"+l.name, current)
+	}
+	return l.write(ctx, http.MethodPost, l.url, current)
+}
+
+// heldByOther returns true if the lease is held by another replica and didn't expire.
+func (l *KubernetesLease) heldByOther(spec leaseSpec, now time.Time) bool {
+	if spec.HolderIdentity == "" || spec.HolderIdentity == l.identity {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if spec != l.observed {
+		l.observed = spec
+		l.observedAt = now
+	}
+
+	duration := time.Duration(spec.LeaseDurationSeconds) * time.Second
+	return now.Sub(l.observedAt) < duration
+}
+
+// Release implements the Lock interface. The holder is removed from the lease, so another replica takes it over
+// right away.
+func (l *KubernetesLease) Release(ctx context.Context) error {
+	current, found, err := l.get(ctx)
+	if err != nil || !found || current.Spec.HolderIdentity != l.identity {
+		return err
+	}
+
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = l.now().UTC().Format(microTime)
+
+	_, err = l.write(ctx, http.MethodPut, l.url+"/"+l.name, current)
+	return err
+}
+
+// get returns the lease. It returns false if the lease doesn't exist.
+func (l *KubernetesLease) get(ctx context.Context) (*lease, bool, error) {
+	resp, err := l.call(ctx, http.MethodGet, l.url+"/"+l.name, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, errors.Wrap(errUnexpectedStatus, resp.Status)
+	}
+
+	var current lease
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		return nil, false, errors.Wrap(errFailedLeaseRequest, err.Error())
+	}
+
+	return &current, true, nil
+}
+
+// write creates or updates the lease. It returns false if another replica changed the lease in the meantime.
+func (l *KubernetesLease) write(ctx context.Context, method, url string, body *lease) (bool, error) {
+	resp, err := l.call(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return false, nil
+	case resp.StatusCode/100 != 2:
+		return false, errors.Wrap(errUnexpectedStatus, resp.Status)
+	default:
+		return true, nil
+	}
+}
+
+func (l *KubernetesLease) call(ctx context.Context, method, url string, body *lease) (*http.Response, error) {
+	token, err := ioutil.ReadFile(l.tokenFile)
+	if err != nil {
+		return nil, errors.Wrap(errFailedReadingCreds, err.Error())
+	}
+
+	var data []byte
+	if body != nil {
+		if data, err = json.Marshal(body); err != nil {
+			return nil, errors.Wrap(errFailedLeaseRequest, err.Error())
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(errFailedLeaseRequest, err.Error())
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(errFailedLeaseRequest, err.Error())
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,189 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const leasePath = "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases"
+
+// leaseServer is a fake Kubernetes API server keeping a single Lease, with optimistic concurrency of updates.
+type leaseServer struct {
+	mu    sync.Mutex
+	lease *lease
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer TOKEN" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var body lease
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == leasePath+"/nest":
+		if s.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(s.lease)
+
+	case r.Method == http.MethodPost && r.URL.Path == leasePath:
+		if s.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		body.Metadata["resourceVersion"] = "1"
+		s.lease = &body
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && r.URL.Path == leasePath+"/nest":
+		if s.lease == nil || body.Metadata["resourceVersion"] != s.lease.Metadata["resourceVersion"] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		version, _ := strconv.Atoi(s.lease.Metadata["resourceVersion"].(string))
+		body.Metadata["resourceVersion"] = strconv.Itoa(version + 1)
+		s.lease = &body
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *leaseServer) spec() leaseSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lease.Spec
+}
+
+func newTestLease(t *testing.T, url, identity string, now *time.Time) *KubernetesLease {
+	dir, err := ioutil.TempDir("", "leader")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	tokenFile := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("TOKEN\n"), 0600))
+
+	l, err := NewKubernetesLease(KubernetesConfig{
+		APIURL:        url,
+		Client:        http.DefaultClient,
+		TokenFile:     tokenFile,
+		Namespace:     "monitoring",
+		Name:          "nest",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+	})
+	assert.NoError(t, err)
+
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestKubernetesLease(t *testing.T) {
+	server := &leaseServer{}
+	serv := httptest.NewServer(server)
+	defer serv.Close()
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	first := newTestLease(t, serv.URL, "replica-1", &now)
+	second := newTestLease(t, serv.URL, "replica-2", &now)
+	ctx := context.Background()
+
+	acquired, err := first.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the lease is created")
+	assert.Equal(t, leaseSpec{
+		HolderIdentity:       "replica-1",
+		LeaseDurationSeconds: 15,
+		AcquireTime:          "2020-12-01T10:00:00.000000Z",
+		RenewTime:            "2020-12-01T10:00:00.000000Z",
+	}, server.spec())
+
+	acquired, err = second.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	now = now.Add(10 * time.Second)
+	acquired, err = first.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the lease is renewed")
+	assert.Equal(t, "2020-12-01T10:00:10.000000Z", server.spec().RenewTime)
+
+	// The second replica observed the renewal now, so the lease expires for it 15 seconds later.
+	now = now.Add(10 * time.Second)
+	acquired, err = second.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	now = now.Add(16 * time.Second)
+	acquired, err = second.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the expired lease is taken over")
+	assert.Equal(t, "replica-2", server.spec().HolderIdentity)
+	assert.Equal(t, 1, server.spec().LeaseTransitions)
+
+	assert.NoError(t, second.Release(ctx))
+	assert.Equal(t, "", server.spec().HolderIdentity)
+
+	acquired, err = first.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.True(t, acquired, "the released lease is taken over right away")
+}
+
+func TestKubernetesLeaseConflict(t *testing.T) {
+	server := &leaseServer{}
+	serv := httptest.NewServer(server)
+	defer serv.Close()
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	l := newTestLease(t, serv.URL, "replica-1", &now)
+
+	acquired, err := l.write(context.Background(), http.MethodPut, serv.URL+leasePath+"/nest", &lease{Metadata: map[string]interface{}{}})
+	assert.NoError(t, err)
+	assert.False(t, acquired, "conflicting updates aren't errors")
+}
+
+func TestKubernetesLeaseFailed(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer serv.Close()
+
+	now := time.Now()
+	acquired, err := newTestLease(t, serv.URL, "replica-1", &now).Acquire(context.Background())
+	assert.False(t, acquired)
+	assert.True(t, errors.Is(err, errUnexpectedStatus))
+}
+
+func TestKubernetesLeaseNotInCluster(t *testing.T) {
+	os.Unsetenv("KUBERNETES_SERVICE_HOST")
+
+	_, err := NewKubernetesLease(KubernetesConfig{Name: "nest", Identity: "replica-1", Namespace: "monitoring"})
+	assert.True(t, errors.Is(err, errNotInCluster))
+
+	_, err = NewKubernetesLease(KubernetesConfig{Identity: "replica-1"})
+	assert.True(t, errors.Is(err, errNoLeaseName))
+}
@@ -0,0 +1,161 @@
+// Package leader elects one of several replicas of the exporter as the leader, so work with side effects, like
+// consuming Pub/Sub messages or pushing readings to external systems, runs only once while all replicas serve
+// metrics.
+//
+// The Elector tries to acquire a Lock on every retry period. Locks are either file locks on a volume shared by the
+// replicas, or Kubernetes Leases. While the Elector holds the lock, it runs the leader tasks. When it loses the lock,
+// the tasks are cancelled until the lock is acquired again.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultRetryPeriod is the interval of acquiring or renewing the lock.
+const DefaultRetryPeriod = 5 * time.Second
+
+// releaseTimeout limits the time of releasing the lock on shutdown.
+const releaseTimeout = 5 * time.Second
+
+var errNoLock = errors.New("leader election lock is missing")
+
+// Lock is held by at most one replica at a time.
+type Lock interface {
+	// Acquire acquires the lock, or renews it if it's already held. It returns false if another replica holds it.
+	Acquire(ctx context.Context) (bool, error)
+	// Release releases the lock if it's held, so other replicas don't have to wait until it expires.
+	Release(ctx context.Context) error
+}
+
+// Config provides the configuration necessary to create the Elector. Logger is optional, if it's nil the Elector
+// doesn't log anything. RetryPeriod defaults to DefaultRetryPeriod, it must be shorter than the duration of leases.
+type Config struct {
+	Logger      log.Logger
+	Lock        Lock
+	RetryPeriod time.Duration
+}
+
+// Elector runs leader tasks while it holds the lock.
+type Elector struct {
+	logger      log.Logger
+	lock        Lock
+	retryPeriod time.Duration
+
+	mu     sync.Mutex
+	leader bool
+
+	leaderDesc *prometheus.Desc
+}
+
+// New creates an Elector using the given Config.
+func New(cfg Config) (*Elector, error) {
+	if cfg.Lock == nil {
+		return nil, errNoLock
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.RetryPeriod <= 0 {
+		cfg.RetryPeriod = DefaultRetryPeriod
+	}
+
+	return &Elector{
+		logger:      cfg.Logger,
+		lock:        cfg.Lock,
+		retryPeriod: cfg.RetryPeriod,
+		leaderDesc: prometheus.NewDesc(
+			"pronestheus_leader",
+			"Whether this replica is the leader running Pub/Sub consumption and push outputs.",
+			nil, nil,
+		),
+	}, nil
+}
+
+// Run acquires the lock on every retry period until the context is cancelled. Each task is started in a goroutine
+// when the lock is acquired and its context is cancelled when the lock is lost. Errors of the lock are treated as
+// losing it, so two replicas never run the tasks at the same time. The lock is released when Run returns.
+func (e *Elector) Run(ctx context.Context, tasks ...func(context.Context)) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	var cancel context.CancelFunc
+	for {
+		acquired, err := e.lock.Acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.Log("level", "error", "message", "Failed acquiring leader election lock", "stack", errors.WithStack(err))
+		}
+
+		if acquired && cancel == nil {
+			var leaderCtx context.Context
+			leaderCtx, cancel = context.WithCancel(ctx)
+			for _, task := range tasks {
+				go task(leaderCtx)
+			}
+			e.setLeader(true)
+			e.logger.Log("level", "info", "message", "Became the leader")
+		}
+
+		if !acquired && cancel != nil {
+			cancel()
+			cancel = nil
+			e.setLeader(false)
+			e.logger.Log("level", "warn", "message", "Lost leadership")
+		}
+
+		select {
+		case <-ctx.Done():
+			if cancel != nil {
+				cancel()
+				e.setLeader(false)
+				e.release()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	if err := e.lock.Release(ctx); err != nil {
+		e.logger.Log("level", "error", "message", "Failed releasing leader election lock", "stack", errors.WithStack(err))
+	}
+}
+
+// IsLeader returns true if the Elector holds the lock.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
+
+// Describe implements the prometheus.Collector interface.
+func (e *Elector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.leaderDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (e *Elector) Collect(ch chan<- prometheus.Metric) {
+	var leader float64
+	if e.IsLeader() {
+		leader = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(e.leaderDesc, prometheus.GaugeValue, leader)
+}
@@ -0,0 +1,108 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLock returns the results of Acquire in order, repeating the last one.
+type fakeLock struct {
+	mu       sync.Mutex
+	results  []error
+	released bool
+}
+
+var errNotAcquired = errors.New("not acquired")
+
+func (l *fakeLock) Acquire(_ context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := l.results[0]
+	if len(l.results) > 1 {
+		l.results = l.results[1:]
+	}
+
+	if result == errNotAcquired {
+		return false, nil
+	}
+	return result == nil, result
+}
+
+func (l *fakeLock) Release(_ context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released = true
+	return nil
+}
+
+func TestNoLock(t *testing.T) {
+	_, err := New(Config{})
+	assert.True(t, errors.Is(err, errNoLock))
+}
+
+func TestRun(t *testing.T) {
+	lock := &fakeLock{results: []error{errNotAcquired, nil, nil, errors.New("API unavailable"), nil}}
+	e, err := New(Config{Lock: lock, RetryPeriod: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	events := make(chan string, 10)
+	task := func(ctx context.Context) {
+		events <- "started"
+		<-ctx.Done()
+		events <- "stopped"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, task)
+		close(done)
+	}()
+
+	// The task runs after the lock is acquired, stops when acquiring it fails and runs again when it's reacquired.
+	for _, want := range []string{"started", "stopped", "started"} {
+		select {
+		case event := <-events:
+			assert.Equal(t, want, event)
+		case <-time.After(time.Second):
+			t.Fatalf("task wasn't %s", want)
+		}
+	}
+	assert.True(t, e.IsLeader())
+
+	metrics := `
+		# HELP pronestheus_leader Whether this replica is the leader running Pub/Sub consumption and push outputs.
+		# TYPE pronestheus_leader gauge
+		pronestheus_leader 1
+	`
+	assert.NoError(t, testutil.CollectAndCompare(e, strings.NewReader(metrics)))
+
+	cancel()
+	<-done
+	assert.Equal(t, "stopped", <-events)
+	assert.False(t, e.IsLeader())
+	assert.True(t, lock.released, "the lock is released on shutdown")
+}
+
+func TestRunFollower(t *testing.T) {
+	lock := &fakeLock{results: []error{errNotAcquired}}
+	e, err := New(Config{Lock: lock, RetryPeriod: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := false
+	e.Run(ctx, func(context.Context) { started = true })
+
+	assert.False(t, started)
+	assert.False(t, lock.released, "followers don't release the lock")
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/metriclint"
+	"pronestheus/pkg/metricnames"
+)
+
+var errMetricProblems = errors.New("found problems with metrics")
+
+// lintExceptions are problems reported by promlint by mistake, by metric. Degree days are a unit of heating demand,
+// not a duration which could be converted to seconds.
+var lintExceptions = map[string]string{
+	"nest_degree_days_celsius_total": `use base unit "seconds" instead of "days"`,
+	"nest_degree_days_today_celsius": `use base unit "seconds" instead of "days"`,
+	"nest_degree_days_kelvin_total":  `use base unit "seconds" instead of "days"`,
+	"nest_degree_days_today_kelvin":  `use base unit "seconds" instead of "days"`,
+}
+
+// LintMetrics creates the exporter with the configured collectors against the sandbox fixtures, or the simulator in
+// the simulation mode, collects all metrics once and prints problems found by metriclint to out: metrics collected
+// but not described and families breaking the Prometheus naming rules. Families are linted under their new names,
+// legacy families are deprecated and not checked. It returns an error if any problems are found.
+func LintMetrics(cfg *ExporterConfig, out io.Writer) error {
+	if !cfg.simulated() {
+		env := envSandbox
+		cfg.NestEnvironment = &env
+	}
+
+	reg := metriclint.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	registerer, gatherer := prometheus.DefaultRegisterer, prometheus.DefaultGatherer
+	prometheus.DefaultRegisterer, prometheus.DefaultGatherer = reg, reg
+	defer func() {
+		prometheus.DefaultRegisterer, prometheus.DefaultGatherer = registerer, gatherer
+	}()
+
+	e, err := NewExporter(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		e.Shutdown(ctx)
+	}()
+
+	renamed, err := metricnames.NewGatherer(reg, metricnames.CompatNew)
+	if err != nil {
+		return err
+	}
+
+	problems, err := reg.Lint(renamed)
+	if err != nil {
+		return err
+	}
+
+	found := problems[:0]
+	for _, p := range problems {
+		if text, ok := lintExceptions[p.Metric]; ok && text == p.Text {
+			continue
+		}
+		found = append(found, p)
+	}
+	problems = found
+
+	for _, p := range problems {
+		if p.Metric == "" {
+			fmt.Fprintf(out, "%s\n", p.Text)
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", p.Metric, p.Text)
+	}
+
+	if len(problems) > 0 {
+		return errors.Wrap(errMetricProblems, fmt.Sprintf("%d problems", len(problems)))
+	}
+	fmt.Fprintln(out, "No problems found")
+	return nil
+}
@@ -0,0 +1,27 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func TestLintMetrics(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	enabled := true
+	modeMetrics := nest.ModeMetricsBoth
+	cfg := testConfig()
+	cfg.NestModeMetrics = &modeMetrics
+	cfg.Comfort = &enabled
+	cfg.WindowOpenDetection = &enabled
+	cfg.AnomalyDetection = &enabled
+	cfg.DailyMetrics = &enabled
+
+	var out bytes.Buffer
+	assert.NoError(t, LintMetrics(cfg, &out))
+	assert.Equal(t, "No problems found\n", out.String())
+}
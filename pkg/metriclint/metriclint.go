@@ -0,0 +1,191 @@
+// Package metriclint checks metrics of the exporter before they're exposed to Prometheus.
+//
+// Every metric emitted by a collector must have a descriptor sent by its Describe method, otherwise the registry
+// can't detect conflicting collectors, and families must follow the Prometheus naming rules checked by promtool.
+// The Registry records registered collectors, so all of them can be collected once, eg. against the sandbox fixtures,
+// and checked with Lint.
+package metriclint
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil/promlint"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fqNamePattern extracts the name of the metric from the description, as descriptors don't expose it.
+var fqNamePattern = regexp.MustCompile(`fqName: "([^"]*)"`)
+
+// Problem is an issue with the metric, eg. a missing descriptor or a name breaking naming rules.
+type Problem struct {
+	Metric string
+	Text   string
+}
+
+// Check describes and collects the collector once and returns problems with emitted metrics which weren't described
+// or can't be written.
+func Check(collector prometheus.Collector) []Problem {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(descs)
+		close(descs)
+	}()
+
+	described := make(map[string]bool)
+	for desc := range descs {
+		described[desc.String()] = true
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(metrics)
+		close(metrics)
+	}()
+
+	var problems []Problem
+	reported := make(map[string]bool)
+	for metric := range metrics {
+		desc := metric.Desc().String()
+		if err := metric.Write(&dto.Metric{}); err != nil {
+			problems = append(problems, Problem{Metric: metricName(desc), Text: err.Error()})
+			continue
+		}
+
+		if !described[desc] && !reported[desc] {
+			reported[desc] = true
+			problems = append(problems, Problem{Metric: metricName(desc), Text: "metric is collected but not described"})
+		}
+	}
+
+	return problems
+}
+
+// Lint returns problems with names, help and types of the metric families found by promlint.
+func Lint(families []*dto.MetricFamily) ([]Problem, error) {
+	found, err := promlint.NewWithMetricFamilies(families).Lint()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]Problem, 0, len(found))
+	for _, p := range found {
+		problems = append(problems, Problem{Metric: p.Metric, Text: p.Text})
+	}
+	return problems, nil
+}
+
+// Registry is a Prometheus registry recording registered collectors, so they can be checked.
+type Registry struct {
+	*prometheus.Registry
+
+	mu         sync.Mutex
+	collectors []prometheus.Collector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{Registry: prometheus.NewRegistry()}
+}
+
+// Register implements the prometheus.Registerer interface.
+func (r *Registry) Register(collector prometheus.Collector) error {
+	if err := r.Registry.Register(collector); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector)
+	return nil
+}
+
+// MustRegister implements the prometheus.Registerer interface.
+func (r *Registry) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		if err := r.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements the prometheus.Registerer interface.
+func (r *Registry) Unregister(collector prometheus.Collector) bool {
+	if !r.Registry.Unregister(collector) {
+		return false
+	}
+
+	// Collectors are compared by their descriptors, like in the wrapped registry.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, c := range r.collectors {
+		if sameDescs(c, collector) {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Lint checks all registered collectors and lints the families gathered with the gatherer, which may rename them, eg.
+// the metricnames Gatherer. Inconsistent metrics reported by the gatherer are problems too. Problems are sorted by
+// metric name.
+func (r *Registry) Lint(gatherer prometheus.Gatherer) ([]Problem, error) {
+	r.mu.Lock()
+	collectors := append([]prometheus.Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var problems []Problem
+	for _, collector := range collectors {
+		problems = append(problems, Check(collector)...)
+	}
+
+	families, err := gatherer.Gather()
+	if multi, ok := err.(prometheus.MultiError); ok {
+		for _, err := range multi {
+			problems = append(problems, Problem{Text: err.Error()})
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	found, err := Lint(families)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, found...)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Metric < problems[j].Metric
+	})
+	return problems, nil
+}
+
+func metricName(desc string) string {
+	if m := fqNamePattern.FindStringSubmatch(desc); m != nil {
+		return m[1]
+	}
+	return desc
+}
+
+func sameDescs(a, b prometheus.Collector) bool {
+	return describe(a) == describe(b)
+}
+
+func describe(collector prometheus.Collector) string {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		collector.Describe(descs)
+		close(descs)
+	}()
+
+	var all []string
+	for desc := range descs {
+		all = append(all, desc.String())
+	}
+	sort.Strings(all)
+	return strings.Join(all, "\n")
+}
@@ -0,0 +1,60 @@
+package metriclint
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// partialCollector emits the mode metric without describing it.
+type partialCollector struct {
+	up   *prometheus.Desc
+	mode *prometheus.Desc
+}
+
+func newPartialCollector() *partialCollector {
+	return &partialCollector{
+		up:   prometheus.NewDesc("nest_up", "Was talking to Nest API successful.", nil, nil),
+		mode: prometheus.NewDesc("nest_thermostat_mode", "Current mode of the thermostat.", []string{"mode"}, nil),
+	}
+}
+
+func (c *partialCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+}
+
+func (c *partialCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.mode, prometheus.GaugeValue, 1, "HEAT")
+	ch <- prometheus.MustNewConstMetric(c.mode, prometheus.GaugeValue, 0, "OFF")
+}
+
+func TestCheck(t *testing.T) {
+	assert.Equal(t, []Problem{
+		{Metric: "nest_thermostat_mode", Text: "metric is collected but not described"},
+	}, Check(newPartialCollector()))
+
+	assert.Empty(t, Check(prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_up", Help: "Up."})))
+}
+
+func TestRegistryLint(t *testing.T) {
+	reg := NewRegistry()
+	reg.MustRegister(newPartialCollector())
+
+	requests := prometheus.NewCounter(prometheus.CounterOpts{Name: "nest_apiRequests", Help: "API requests."})
+	reg.MustRegister(requests)
+
+	problems, err := reg.Lint(reg)
+	assert.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{Metric: "nest_apiRequests", Text: "counter metrics should have \"_total\" suffix"},
+		{Metric: "nest_apiRequests", Text: "metric names should be written in 'snake_case' not 'camelCase'"},
+		{Metric: "nest_thermostat_mode", Text: "metric is collected but not described"},
+	}, problems)
+
+	assert.True(t, reg.Unregister(requests))
+	problems, err = reg.Lint(reg)
+	assert.NoError(t, err)
+	assert.Len(t, problems, 1)
+}
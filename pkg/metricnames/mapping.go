@@ -0,0 +1,113 @@
+package metricnames
+
+import (
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+var (
+	errInvalidMappingName = errors.New("invalid metric name in the metrics mapping")
+	errInvalidDropPattern = errors.New("invalid pattern of dropped metrics")
+	errDuplicateMapping   = errors.New("metrics mapping renames several families to the same name")
+	errMappingConflict    = errors.New("renamed metric family conflicts with an exported family")
+)
+
+// Mapping renames or drops exported families, eg. to follow the naming convention of an organization or to drop
+// families nobody queries, without relabeling in Prometheus. Rename maps names of exported families to their new
+// names. Drop contains names of dropped families or patterns matching them, with the syntax of path.Match, eg.
+// nest_thermostat_mode_*.
+type Mapping struct {
+	Rename map[string]string
+	Drop   []string
+}
+
+// MappingGatherer exports the families of the wrapped gatherer with the Mapping applied.
+type MappingGatherer struct {
+	gatherer prometheus.Gatherer
+	rename   map[string]string
+	drop     []string
+}
+
+// NewMappingGatherer returns a MappingGatherer applying the mapping to the families of the gatherer. Families are
+// renamed after being dropped, so patterns match the names they're exported under by the collectors.
+func NewMappingGatherer(gatherer prometheus.Gatherer, mapping Mapping) (*MappingGatherer, error) {
+	targets := make(map[string]string, len(mapping.Rename))
+	for from, to := range mapping.Rename {
+		if !metricName.MatchString(from) {
+			return nil, errors.Wrap(errInvalidMappingName, from)
+		}
+		if !metricName.MatchString(to) {
+			return nil, errors.Wrap(errInvalidMappingName, to)
+		}
+		if other, ok := targets[to]; ok {
+			return nil, errors.Wrapf(errDuplicateMapping, "%s and %s to %s", other, from, to)
+		}
+		targets[to] = from
+	}
+
+	for _, pattern := range mapping.Drop {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrap(errInvalidDropPattern, pattern)
+		}
+	}
+
+	return &MappingGatherer{gatherer: gatherer, rename: mapping.Rename, drop: mapping.Drop}, nil
+}
+
+// Gather implements the prometheus.Gatherer interface. Families are sorted by name, like the ones of registries. A
+// family renamed to the name of another exported family is an error, both families are exported unchanged then.
+func (g *MappingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	if len(g.rename) == 0 && len(g.drop) == 0 {
+		return families, err
+	}
+
+	exported := make(map[string]bool, len(families))
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if g.dropped(family.GetName()) {
+			continue
+		}
+		exported[family.GetName()] = true
+		result = append(result, family)
+	}
+
+	errs := prometheus.MultiError{}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for i, family := range result {
+		to, ok := g.rename[family.GetName()]
+		if !ok {
+			continue
+		}
+		// The target may be exported by another family, unless that family is renamed as well.
+		if _, renamed := g.rename[to]; exported[to] && !renamed {
+			errs = append(errs, errors.Wrapf(errMappingConflict, "%s renamed to %s", family.GetName(), to))
+			continue
+		}
+
+		name := to
+		result[i] = &dto.MetricFamily{Name: &name, Help: family.Help, Type: family.Type, Metric: family.Metric}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, errs.MaybeUnwrap()
+}
+
+// dropped returns true if the family name matches one of the dropped names or patterns.
+func (g *MappingGatherer) dropped(name string) bool {
+	for _, pattern := range g.drop {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package metricnames
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingGatherer(t *testing.T) {
+	g, err := NewMappingGatherer(testRegistry(), Mapping{
+		Rename: map[string]string{"nest_up": "home_nest_up"},
+		Drop:   []string{"nest_filter_*"},
+	})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP home_nest_up Was talking to Nest API successful.
+# TYPE home_nest_up gauge
+home_nest_up 1
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{id="DEVICE_ID"} 57
+`
+	assert.NoError(t, testutil.GatherAndCompare(g, strings.NewReader(expected)))
+}
+
+func TestMappingConflict(t *testing.T) {
+	g, err := NewMappingGatherer(testRegistry(), Mapping{Rename: map[string]string{"nest_up": "nest_humidity_percent"}})
+	assert.NoError(t, err)
+
+	families, err := g.Gather()
+	assert.True(t, errors.Is(err, errMappingConflict))
+	assert.Len(t, families, 3, "conflicting families are exported unchanged")
+
+	g, err = NewMappingGatherer(testRegistry(), Mapping{Rename: map[string]string{"nest_up": "nest_humidity_percent", "nest_humidity_percent": "nest_up"}})
+	assert.NoError(t, err)
+	_, err = g.Gather()
+	assert.NoError(t, err, "families can swap names")
+}
+
+func TestInvalidMapping(t *testing.T) {
+	_, err := NewMappingGatherer(testRegistry(), Mapping{Rename: map[string]string{"nest_up": "nest-up"}})
+	assert.True(t, errors.Is(err, errInvalidMappingName))
+
+	_, err = NewMappingGatherer(testRegistry(), Mapping{Rename: map[string]string{"nest_up": "up", "nest_humidity_percent": "up"}})
+	assert.True(t, errors.Is(err, errDuplicateMapping))
+
+	_, err = NewMappingGatherer(testRegistry(), Mapping{Drop: []string{"nest_[up"}})
+	assert.True(t, errors.Is(err, errInvalidDropPattern))
+}
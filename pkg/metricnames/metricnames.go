@@ -0,0 +1,151 @@
+// Package metricnames exports metric families following the Prometheus naming best practices.
+//
+// A few families were named with units which aren't base units, eg. nest_humidity_percent or
+// nest_filter_runtime_hours. The Gatherer exports them under names with base units, eg. nest_humidity_ratio or
+// nest_filter_runtime_seconds, with their values converted. During the deprecation window the legacy families can
+// be exported along with them, or instead of them, so dashboards and alerts can be migrated gradually before they're
+// removed.
+//
+// OpenMetrics additionally declares units with the UNIT metadata, which the Prometheus client doesn't write.
+// UnitHandler adds it to OpenMetrics responses for families named with a base unit.
+//
+// The MappingGatherer renames or drops families as configured by users, eg. to follow their naming convention.
+package metricnames
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Compatibility modes selecting the exported families.
+const (
+	// CompatLegacy exports the legacy families only, as before they were renamed.
+	CompatLegacy = "legacy"
+	// CompatBoth exports the renamed families and the legacy ones, marked deprecated.
+	CompatBoth = "both"
+	// CompatNew exports the renamed families only.
+	CompatNew = "new"
+)
+
+var errInvalidCompat = errors.New("invalid metrics compatibility mode; valid values: [legacy, both, new]")
+
+// Rename is a family exported under a new name with values converted to a base unit, by multiplying them with Factor
+// or dividing them by Divisor, so percents are converted exactly. Help replaces the help of the legacy family if
+// the unit is part of it.
+type Rename struct {
+	Legacy  string
+	Name    string
+	Factor  float64
+	Divisor float64
+	Help    string
+}
+
+// convert returns the value converted to the base unit.
+func (r Rename) convert(value float64) float64 {
+	if r.Divisor != 0 {
+		return value / r.Divisor
+	}
+	return value * r.Factor
+}
+
+// Renames are the families renamed to base units.
+var Renames = []Rename{
+	{Legacy: "awair_humidity_percent", Name: "awair_humidity_ratio", Divisor: 100},
+	{Legacy: "awair_pm25_micrograms_per_cubic_meter", Name: "awair_pm25_grams_per_cubic_meter", Divisor: 1e6},
+	{Legacy: "nest_balance_point_hours", Name: "nest_balance_point_readings_seconds", Factor: 3600, Help: "Duration of heating readings the balance point is estimated from."},
+	{Legacy: "nest_comfort_ppd_percent", Name: "nest_comfort_ppd_ratio", Divisor: 100},
+	{Legacy: "nest_filter_runtime_hours", Name: "nest_filter_runtime_seconds", Factor: 3600},
+	{Legacy: "nest_humidity_max_today_percent", Name: "nest_humidity_max_today_ratio", Divisor: 100},
+	{Legacy: "nest_humidity_min_today_percent", Name: "nest_humidity_min_today_ratio", Divisor: 100},
+	{Legacy: "nest_humidity_percent", Name: "nest_humidity_ratio", Divisor: 100},
+	{Legacy: "nest_solar_cloud_cover_percent", Name: "nest_solar_cloud_cover_ratio", Divisor: 100},
+	{Legacy: "nest_station_humidity_percent", Name: "nest_station_humidity_ratio", Divisor: 100},
+	{Legacy: "nest_station_pressure_hectopascal", Name: "nest_station_pressure_pascals", Factor: 100},
+	{Legacy: "nest_station_rain_daily_millimeters", Name: "nest_station_rain_daily_meters", Divisor: 1000},
+	{Legacy: "nest_station_rain_rate_millimeters_per_hour", Name: "nest_station_rain_rate_meters_per_second", Divisor: 1000 * 3600},
+	{Legacy: "nest_weather_humidity_percent", Name: "nest_weather_humidity_ratio", Divisor: 100},
+	{Legacy: "nest_weather_pressure_hectopascal", Name: "nest_weather_pressure_pascals", Factor: 100},
+}
+
+// Gatherer exports the families of the wrapped gatherer with the renames applied.
+type Gatherer struct {
+	gatherer prometheus.Gatherer
+	compat   string
+	renames  map[string]Rename
+}
+
+// NewGatherer returns a Gatherer exporting the families of the gatherer selected by the compatibility mode:
+// CompatLegacy, CompatBoth or CompatNew. With CompatBoth the help of the legacy families marks them deprecated.
+func NewGatherer(gatherer prometheus.Gatherer, compat string) (*Gatherer, error) {
+	switch compat {
+	case CompatLegacy, CompatBoth, CompatNew:
+	default:
+		return nil, errors.Wrap(errInvalidCompat, compat)
+	}
+
+	renames := make(map[string]Rename, len(Renames))
+	for _, rename := range Renames {
+		renames[rename.Legacy] = rename
+	}
+	return &Gatherer{gatherer: gatherer, compat: compat, renames: renames}, nil
+}
+
+// Gather implements the prometheus.Gatherer interface. Families are sorted by name, like the ones of registries.
+func (g *Gatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	if g.compat == CompatLegacy {
+		return families, err
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		rename, ok := g.renames[family.GetName()]
+		if !ok {
+			result = append(result, family)
+			continue
+		}
+
+		result = append(result, renamed(family, rename))
+		if g.compat == CompatBoth {
+			help := family.GetHelp() + " Deprecated, use " + rename.Name + "."
+			result = append(result, &dto.MetricFamily{Name: family.Name, Help: &help, Type: family.Type, Metric: family.Metric})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	return result, err
+}
+
+// renamed returns a copy of the family with the new name and converted values. Only counters, gauges and untyped
+// metrics are converted, none of the renamed families is a histogram or summary.
+func renamed(family *dto.MetricFamily, rename Rename) *dto.MetricFamily {
+	name := rename.Name
+	help := family.GetHelp()
+	if rename.Help != "" {
+		help = rename.Help
+	}
+
+	metrics := make([]*dto.Metric, 0, len(family.Metric))
+	for _, metric := range family.Metric {
+		converted := &dto.Metric{Label: metric.Label, TimestampMs: metric.TimestampMs}
+		switch {
+		case metric.Gauge != nil:
+			value := rename.convert(metric.Gauge.GetValue())
+			converted.Gauge = &dto.Gauge{Value: &value}
+		case metric.Counter != nil:
+			value := rename.convert(metric.Counter.GetValue())
+			converted.Counter = &dto.Counter{Value: &value}
+		case metric.Untyped != nil:
+			value := rename.convert(metric.Untyped.GetValue())
+			converted.Untyped = &dto.Untyped{Value: &value}
+		default:
+			continue
+		}
+		metrics = append(metrics, converted)
+	}
+
+	return &dto.MetricFamily{Name: &name, Help: &help, Type: family.Type, Metric: metrics}
+}
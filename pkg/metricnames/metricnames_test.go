@@ -0,0 +1,110 @@
+package metricnames
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegistry() *prometheus.Registry {
+	humidity := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "nest_humidity_percent", Help: "Inside humidity."}, []string{"id"})
+	humidity.WithLabelValues("DEVICE_ID").Set(57)
+	runtime := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_filter_runtime_hours", Help: "HVAC runtime since the filter runtime was last reset."})
+	runtime.Set(2)
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_up", Help: "Was talking to Nest API successful."})
+	up.Set(1)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(humidity, runtime, up)
+	return reg
+}
+
+func TestGatherer(t *testing.T) {
+	expected := `
+# HELP nest_filter_runtime_seconds HVAC runtime since the filter runtime was last reset.
+# TYPE nest_filter_runtime_seconds gauge
+nest_filter_runtime_seconds 7200
+# HELP nest_humidity_ratio Inside humidity.
+# TYPE nest_humidity_ratio gauge
+nest_humidity_ratio{id="DEVICE_ID"} 0.57
+# HELP nest_up Was talking to Nest API successful.
+# TYPE nest_up gauge
+nest_up 1
+`
+	gatherer, err := NewGatherer(testRegistry(), CompatNew)
+	assert.NoError(t, err)
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(expected)))
+}
+
+func TestGathererBoth(t *testing.T) {
+	expected := `
+# HELP nest_humidity_percent Inside humidity. Deprecated, use nest_humidity_ratio.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{id="DEVICE_ID"} 57
+# HELP nest_humidity_ratio Inside humidity.
+# TYPE nest_humidity_ratio gauge
+nest_humidity_ratio{id="DEVICE_ID"} 0.57
+`
+	gatherer, err := NewGatherer(testRegistry(), CompatBoth)
+	assert.NoError(t, err)
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(expected), "nest_humidity_percent", "nest_humidity_ratio"))
+}
+
+func TestGathererLegacy(t *testing.T) {
+	expected := `
+# HELP nest_humidity_percent Inside humidity.
+# TYPE nest_humidity_percent gauge
+nest_humidity_percent{id="DEVICE_ID"} 57
+`
+	gatherer, err := NewGatherer(testRegistry(), CompatLegacy)
+	assert.NoError(t, err)
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(expected), "nest_humidity_percent", "nest_humidity_ratio"))
+
+	_, err = NewGatherer(testRegistry(), "old")
+	assert.True(t, errors.Is(err, errInvalidCompat))
+}
+
+func TestUnit(t *testing.T) {
+	assert.Equal(t, "seconds", Unit("nest_hvac_runtime_seconds"))
+	assert.Equal(t, "meters_per_second", Unit("nest_station_wind_speed_meters_per_second"))
+	assert.Equal(t, "celsius", Unit("nest_ambient_temperature_celsius"))
+	assert.Equal(t, "kelvin", Unit("nest_ambient_temperature_kelvin"))
+	assert.Equal(t, "", Unit("nest_up"))
+	assert.Equal(t, "", Unit("nest_humidity_percent"))
+}
+
+func TestUnitHandler(t *testing.T) {
+	gatherer, err := NewGatherer(testRegistry(), CompatNew)
+	assert.NoError(t, err)
+	handler := UnitHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "# TYPE nest_humidity_ratio gauge\n# UNIT nest_humidity_ratio ratio\n")
+	assert.Contains(t, string(body), "# TYPE nest_up gauge\nnest_up 1.0\n")
+	assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+
+	// The text format has no units.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.NotContains(t, w.Body.String(), "# UNIT")
+	assert.Contains(t, w.Body.String(), "nest_humidity_ratio")
+}
@@ -0,0 +1,119 @@
+package metricnames
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// openMetricsType is the content type of OpenMetrics responses.
+const openMetricsType = "application/openmetrics-text"
+
+// units are the base units declared with the UNIT metadata of families named with them. Compound units come before
+// their last part, eg. meters_per_second before seconds.
+var units = []string{
+	"watts_per_square_meter",
+	"grams_per_cubic_meter",
+	"meters_per_second",
+	"seconds",
+	"celsius",
+	"kelvin",
+	"ratio",
+	"pascals",
+	"meters",
+	"bytes",
+	"lux",
+}
+
+// Unit returns the base unit the family is named with, eg. "seconds" for nest_filter_runtime_seconds, or an empty
+// string if it's named without one. Counters are passed without the _total suffix, as they're named in OpenMetrics.
+func Unit(family string) string {
+	for _, unit := range units {
+		if strings.HasSuffix(family, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// UnitHandler adds the UNIT metadata to OpenMetrics responses of the handler, after the TYPE metadata of families
+// named with a base unit. Other responses are passed through unchanged.
+func UnitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), openMetricsType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The response is requested uncompressed to add lines to it, and compressed here afterwards.
+		compress := strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+
+		res := &bufferedResponse{header: w.Header(), code: http.StatusOK}
+		next.ServeHTTP(res, r)
+
+		body := res.body.Bytes()
+		if strings.HasPrefix(res.header.Get("Content-Type"), openMetricsType) {
+			body = addUnits(body)
+		}
+
+		res.header.Del("Content-Length")
+		if !compress {
+			w.WriteHeader(res.code)
+			w.Write(body)
+			return
+		}
+
+		res.header.Set("Content-Encoding", "gzip")
+		w.WriteHeader(res.code)
+		gz := gzip.NewWriter(w)
+		gz.Write(body)
+		gz.Close()
+	})
+}
+
+// addUnits adds the UNIT metadata after the TYPE metadata of families named with a base unit.
+func addUnits(body []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		out.WriteString(line)
+		out.WriteByte('\n')
+
+		// TYPE metadata is "# TYPE name type".
+		fields := strings.Fields(line)
+		if len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			if unit := Unit(fields[2]); unit != "" {
+				out.WriteString("# UNIT " + fields[2] + " " + unit + "\n")
+			}
+		}
+	}
+	return out.Bytes()
+}
+
+// bufferedResponse keeps the response of a handler in memory.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+// Header implements the http.ResponseWriter interface.
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (r *bufferedResponse) WriteHeader(code int) {
+	r.code = code
+}
+
+// Write implements the http.ResponseWriter interface.
+func (r *bufferedResponse) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
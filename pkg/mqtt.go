@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/mqtt"
+)
+
+// registerMQTTCollector registers the collector of MQTT topics and subscribes to the broker in the background if
+// a broker is configured. Every replica subscribes, as each exports the values.
+func (e *Exporter) registerMQTTCollector(cfg *ExporterConfig) error {
+	if cfg.MQTTBroker == nil || *cfg.MQTTBroker == "" {
+		return nil
+	}
+
+	mqttCfg, err := mqttConfig(cfg, e.logger)
+	if err != nil {
+		return err
+	}
+
+	mqttCollector, err := mqtt.New(mqttCfg)
+	if err != nil {
+		return err
+	}
+
+	if err := prometheus.Register(mqttCollector); err != nil {
+		return err
+	}
+
+	e.runUntilShutdown(mqttCollector.Run)
+	return nil
+}
+
+// mqttConfig converts the ExporterConfig into the MQTT collector Config.
+func mqttConfig(cfg *ExporterConfig, logger log.Logger) (mqtt.Config, error) {
+	mqttCfg := mqtt.Config{
+		Logger: logger,
+		Broker: *cfg.MQTTBroker,
+	}
+
+	if cfg.MQTTExpiry != nil {
+		mqttCfg.Expiry = *cfg.MQTTExpiry
+	}
+
+	if cfg.MQTTGauges != nil {
+		for _, text := range *cfg.MQTTGauges {
+			gauge, err := mqtt.ParseGauge(text)
+			if err != nil {
+				return mqttCfg, err
+			}
+			mqttCfg.Gauges = append(mqttCfg.Gauges, gauge)
+		}
+	}
+
+	return mqttCfg, nil
+}
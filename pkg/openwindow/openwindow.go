@@ -0,0 +1,199 @@
+// Package openwindow flags thermostats in rooms which probably have a window open, wasting heating.
+//
+// An open window is suspected when the inside temperature drops quickly while the thermostat is heating: the drop
+// from the warmest reading within the period must reach the threshold. With the OpenWeatherMap collector, the outside
+// temperature must also be far enough below the setpoint for an open window to cool the room, which rules out
+// drops on mild days, eg. after the setpoint was lowered. The heuristic can't tell an open window from an open door
+// to a cold room or a failing boiler, so it's a suspicion to alert on rather than a fact.
+package openwindow
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/units"
+)
+
+const (
+	// DefaultPeriod is the time range of readings in which the inside temperature must drop.
+	DefaultPeriod = 10 * time.Minute
+
+	// DefaultDrop is the drop of the inside temperature in Celsius within the period suggesting an open window.
+	DefaultDrop = 1.0
+
+	// DefaultOutsideDifference is how much colder than the setpoint it must be outside, in Celsius.
+	DefaultOutsideDifference = 10.0
+
+	// maxWeatherAge is the age after which the outside temperature is too old to be compared with the setpoint.
+	maxWeatherAge = 2 * time.Hour
+)
+
+var errInvalidThresholds = errors.New("invalid open window thresholds; expected positive period, drop and outside difference")
+
+// Config provides the configuration necessary to create the Detector. Temperatures are in Celsius. Logger is
+// optional, if it's nil the Detector doesn't log anything. Period, Drop and OutsideDifference default to
+// DefaultPeriod, DefaultDrop and DefaultOutsideDifference. Labels identify thermostats in nest_window_open_suspected.
+type Config struct {
+	Logger            log.Logger
+	Period            time.Duration
+	Drop              float64
+	OutsideDifference float64
+	Labels            nest.MetricLabels
+}
+
+// Detector checks readings of thermostats for a probably open window and exports the suspicion.
+type Detector struct {
+	logger            log.Logger
+	period            time.Duration
+	drop              float64
+	outsideDifference float64
+	labels            nest.MetricLabels
+	now               func() time.Time
+
+	mu          sync.Mutex
+	outside     *weather.Weather
+	thermostats map[string]*history
+
+	suspected *prometheus.Desc
+}
+
+// history contains the readings of a thermostat within the period, ordered by time.
+type history struct {
+	therm     *nest.Thermostat
+	readings  []reading
+	suspected bool
+}
+
+type reading struct {
+	at   time.Time
+	temp float64
+}
+
+// New creates a Detector using the given Config. It returns an error if a threshold is negative.
+func New(cfg Config) (*Detector, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Period == 0 {
+		cfg.Period = DefaultPeriod
+	}
+	if cfg.Drop == 0 {
+		cfg.Drop = DefaultDrop
+	}
+	if cfg.OutsideDifference == 0 {
+		cfg.OutsideDifference = DefaultOutsideDifference
+	}
+	if cfg.Period < 0 || cfg.Drop < 0 || cfg.OutsideDifference < 0 {
+		return nil, errInvalidThresholds
+	}
+
+	return &Detector{
+		logger:            cfg.Logger,
+		period:            cfg.Period,
+		drop:              cfg.Drop,
+		outsideDifference: cfg.OutsideDifference,
+		labels:            cfg.Labels,
+		now:               time.Now,
+		thermostats:       make(map[string]*history),
+		suspected:         prometheus.NewDesc("nest_window_open_suspected", "Whether a window is probably open, as the inside temperature drops quickly while heating.", cfg.Labels.Names(), nil),
+	}, nil
+}
+
+// WeatherListener returns a weather.Listener keeping the latest outside temperature.
+func (d *Detector) WeatherListener() weather.Listener {
+	return func(w *weather.Weather) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.outside = w
+	}
+}
+
+// ThermostatListener returns a nest.Listener checking new readings of thermostats for an open window. It's meant for
+// nest.WithUpdateListener, which passes every reading once.
+func (d *Detector) ThermostatListener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		now := d.now()
+		for _, therm := range thermostats {
+			at := therm.UpdatedAt
+			if at.IsZero() {
+				at = now
+			}
+
+			h, ok := d.thermostats[therm.ID]
+			if !ok {
+				h = &history{}
+				d.thermostats[therm.ID] = h
+			}
+			h.therm = therm
+			h.readings = append(h.readings, reading{at: at, temp: therm.AmbientTemp})
+			h.prune(at.Add(-d.period))
+
+			suspected := therm.Status == "HEATING" && h.drop() >= d.drop && d.coldOutside(therm, now)
+			if suspected && !h.suspected {
+				d.logger.Log("level", "info", "message", "Open window suspected", "id", therm.ID, "drop", h.drop())
+			}
+			h.suspected = suspected
+		}
+	}
+}
+
+// prune drops readings older than the cutoff.
+func (h *history) prune(cutoff time.Time) {
+	i := 0
+	for i < len(h.readings) && h.readings[i].at.Before(cutoff) {
+		i++
+	}
+	h.readings = h.readings[i:]
+}
+
+// drop returns how much the latest reading is below the warmest reading.
+func (h *history) drop() float64 {
+	latest := h.readings[len(h.readings)-1].temp
+	warmest := latest
+	for _, r := range h.readings {
+		if r.temp > warmest {
+			warmest = r.temp
+		}
+	}
+	return warmest - latest
+}
+
+// coldOutside returns true if it's cold enough outside for an open window to cool the room. Without a recent
+// outside temperature, the condition is skipped.
+func (d *Detector) coldOutside(therm *nest.Thermostat, now time.Time) bool {
+	if d.outside == nil || now.Sub(d.outside.UpdatedAt) > maxWeatherAge {
+		return true
+	}
+
+	outside := units.ToCelsius(d.outside.Temperature, d.outside.Unit)
+	return therm.SetpointTemp-outside >= d.outsideDifference
+}
+
+// Describe implements the prometheus.Collector interface.
+func (d *Detector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.suspected
+}
+
+// Collect implements the prometheus.Collector interface.
+func (d *Detector) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, h := range d.thermostats {
+		value := 0.0
+		if h.suspected {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(d.suspected, prometheus.GaugeValue, value, d.labels.Values(h.therm)...)
+	}
+}
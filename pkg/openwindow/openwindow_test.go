@@ -0,0 +1,80 @@
+package openwindow
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+)
+
+func thermostat(temp float64, status string, at time.Time) []*nest.Thermostat {
+	return []*nest.Thermostat{{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:     "DEVICE_ID",
+		Label:        "Living-Room",
+		AmbientTemp:  temp,
+		SetpointTemp: 21,
+		Status:       status,
+		UpdatedAt:    at,
+	}}
+}
+
+func suspected(value string) string {
+	return `
+# HELP nest_window_open_suspected Whether a window is probably open, as the inside temperature drops quickly while heating.
+# TYPE nest_window_open_suspected gauge
+nest_window_open_suspected{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"} ` + value + "\n"
+}
+
+func TestDetector(t *testing.T) {
+	d, err := New(Config{})
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	listener := d.ThermostatListener()
+
+	listener(thermostat(20.5, "HEATING", now))
+	listener(thermostat(20.0, "HEATING", now.Add(5*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("0"))))
+
+	listener(thermostat(19.4, "HEATING", now.Add(10*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("1"))))
+
+	// Once the window is closed, the temperature stops dropping.
+	listener(thermostat(19.5, "HEATING", now.Add(25*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("0"))))
+
+	// Drops while not heating, eg. after the setpoint was lowered, are expected.
+	listener(thermostat(18.0, "OFF", now.Add(30*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("0"))))
+}
+
+func TestOutsideDifference(t *testing.T) {
+	d, err := New(Config{})
+	assert.NoError(t, err)
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	// It's 52°F (11.1°C) outside, less than 10°C below the setpoint.
+	d.WeatherListener()(&weather.Weather{Temperature: 52, Unit: "fahrenheit", UpdatedAt: now})
+	listener := d.ThermostatListener()
+	listener(thermostat(20.5, "HEATING", now))
+	listener(thermostat(19.0, "HEATING", now.Add(5*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("0"))))
+
+	d.WeatherListener()(&weather.Weather{Temperature: 5, Unit: "celsius", UpdatedAt: now})
+	listener(thermostat(18.5, "HEATING", now.Add(10*time.Minute)))
+	assert.NoError(t, testutil.CollectAndCompare(d, strings.NewReader(suspected("1"))))
+}
+
+func TestInvalidThresholds(t *testing.T) {
+	_, err := New(Config{Drop: -1})
+	assert.Equal(t, errInvalidThresholds, err)
+}
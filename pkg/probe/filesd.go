@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var errFailedWritingFileSD = errors.New("failed writing file_sd file")
+
+// targetGroup is a group of targets in the file_sd format.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// FileSD writes device IDs of thermostats into a file in the Prometheus file_sd format. Every thermostat is a
+// separate target group with the __meta_nest_label and __meta_nest_room labels, which can be used in relabeling.
+type FileSD struct {
+	path   string
+	logger log.Logger
+
+	mu      sync.Mutex
+	written []byte
+}
+
+// NewFileSD creates a FileSD writing targets into the file at path. Logger is optional, if it's nil the FileSD
+// doesn't log anything.
+func NewFileSD(path string, logger log.Logger) *FileSD {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return &FileSD{path: path, logger: logger}
+}
+
+// Listener returns a nest.Listener writing the targets whenever they change.
+func (f *FileSD) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		if err := f.Write(thermostats); err != nil {
+			f.logger.Log("level", "error", "message", "Failed writing file_sd targets", "stack", errors.WithStack(err))
+		}
+	}
+}
+
+// Write writes the thermostats as targets into the file, unless they're the same as the last written ones. The file
+// is replaced atomically, so Prometheus never reads a partially written file.
+func (f *FileSD) Write(thermostats []*nest.Thermostat) error {
+	groups := make([]targetGroup, 0, len(thermostats))
+	for _, therm := range thermostats {
+		groups = append(groups, targetGroup{
+			Targets: []string{therm.DeviceID},
+			Labels: map[string]string{
+				"__meta_nest_label": therm.Label,
+				"__meta_nest_room":  therm.Room,
+			},
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Targets[0] < groups[j].Targets[0] })
+
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if bytes.Equal(data, f.written) {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+
+	// Temporary files are only readable by the owner, Prometheus often runs as another user.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Wrap(errFailedWritingFileSD, err.Error())
+	}
+
+	f.written = data
+	f.logger.Log("level", "info", "message", "Updated file_sd targets", "path", f.path, "targets", len(groups))
+
+	return nil
+}
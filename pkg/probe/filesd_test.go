@@ -0,0 +1,69 @@
+package probe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func TestFileSD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nest.json")
+	f := NewFileSD(path, nil)
+
+	f.Listener()([]*nest.Thermostat{
+		{DeviceID: "DEVICE_2", Label: "Attic"},
+		{DeviceID: "DEVICE_1", Label: "Hallway", Room: "Hall"},
+	})
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"targets": ["DEVICE_1"], "labels": {"__meta_nest_label": "Hallway", "__meta_nest_room": "Hall"}},
+		{"targets": ["DEVICE_2"], "labels": {"__meta_nest_label": "Attic", "__meta_nest_room": ""}}
+	]`, string(data))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files are removed")
+}
+
+func TestFileSDUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nest.json")
+	f := NewFileSD(path, nil)
+
+	thermostats := []*nest.Thermostat{{DeviceID: "DEVICE_1", Label: "Hallway"}}
+	assert.NoError(t, f.Write(thermostats))
+
+	// Unchanged targets aren't written again, so the removed file isn't recreated.
+	assert.NoError(t, os.Remove(path))
+	assert.NoError(t, f.Write(thermostats))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, f.Write(append(thermostats, &nest.Thermostat{DeviceID: "DEVICE_2"})))
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestFileSDFailed(t *testing.T) {
+	f := NewFileSD(filepath.Join("missing", "dir", "nest.json"), nil)
+	err := f.Write([]*nest.Thermostat{{DeviceID: "DEVICE_1"}})
+	assert.Error(t, err)
+}
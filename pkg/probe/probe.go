@@ -0,0 +1,87 @@
+// Package probe serves metrics of a single thermostat, so every thermostat can be scraped by Prometheus as a separate
+// target, like with the blackbox exporter.
+//
+// The Handler serves /probe?target=DEVICE_ID with the metrics of the thermostat with the given device ID. The
+// FileSD writer keeps a file_sd file listing all thermostats as targets, so new thermostats are picked up
+// automatically.
+package probe
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Path is the path of the probe endpoint.
+const Path = "/probe"
+
+// Handler serves metrics of the thermostat given by the target parameter.
+type Handler struct {
+	gatherer prometheus.Gatherer
+}
+
+// NewHandler creates a Handler serving metrics gathered by the gatherer. Only metrics with the id or device_id label
+// matching the target are served.
+func NewHandler(gatherer prometheus.Gatherer) *Handler {
+	return &Handler{gatherer: gatherer}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		http.Error(w, "failed gathering metrics: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filtered := filter(families, target)
+	if len(filtered) == 0 {
+		http.Error(w, "unknown target: "+target, http.StatusNotFound)
+		return
+	}
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return filtered, nil })
+	promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// filter returns the metric families with only the metrics of the target.
+func filter(families []*dto.MetricFamily, target string) []*dto.MetricFamily {
+	var filtered []*dto.MetricFamily
+	for _, family := range families {
+		var metrics []*dto.Metric
+		for _, metric := range family.Metric {
+			if matches(metric, target) {
+				metrics = append(metrics, metric)
+			}
+		}
+
+		if len(metrics) > 0 {
+			filtered = append(filtered, &dto.MetricFamily{
+				Name:   family.Name,
+				Help:   family.Help,
+				Type:   family.Type,
+				Metric: metrics,
+			})
+		}
+	}
+
+	return filtered
+}
+
+// matches returns true if the id or device_id label of the metric is the target.
+func matches(metric *dto.Metric, target string) bool {
+	for _, label := range metric.Label {
+		if (label.GetName() == "id" || label.GetName() == "device_id") && label.GetValue() == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRegistry() *prometheus.Registry {
+	ambient := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "nest_ambient_temperature_celsius", Help: "Inside temperature."}, []string{"id", "device_id", "label"})
+	ambient.WithLabelValues("enterprises/PROJECT_ID/devices/DEVICE_1", "DEVICE_1", "Hallway").Set(20)
+	ambient.WithLabelValues("enterprises/PROJECT_ID/devices/DEVICE_2", "DEVICE_2", "Attic").Set(15)
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_up", Help: "Was talking to Nest API successful."})
+	up.Set(1)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(ambient, up)
+
+	return reg
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		want     string
+		wantMiss []string
+	}{
+		{
+			name:     "device ID",
+			url:      "/probe?target=DEVICE_1",
+			wantCode: http.StatusOK,
+			want:     `nest_ambient_temperature_celsius{device_id="DEVICE_1",id="enterprises/PROJECT_ID/devices/DEVICE_1",label="Hallway"} 20`,
+			wantMiss: []string{"DEVICE_2", "nest_up"},
+		}, {
+			name:     "resource name",
+			url:      "/probe?target=enterprises/PROJECT_ID/devices/DEVICE_2",
+			wantCode: http.StatusOK,
+			want:     `nest_ambient_temperature_celsius{device_id="DEVICE_2",id="enterprises/PROJECT_ID/devices/DEVICE_2",label="Attic"} 15`,
+			wantMiss: []string{"DEVICE_1", "nest_up"},
+		}, {
+			name:     "unknown target",
+			url:      "/probe?target=DEVICE_3",
+			wantCode: http.StatusNotFound,
+			want:     "unknown target: DEVICE_3",
+		}, {
+			name:     "missing target",
+			url:      "/probe",
+			wantCode: http.StatusBadRequest,
+			want:     "target parameter is missing",
+		},
+	}
+
+	h := NewHandler(newRegistry())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.want)
+			for _, miss := range tt.wantMiss {
+				assert.NotContains(t, w.Body.String(), miss)
+			}
+		})
+	}
+}
@@ -1,121 +1,1508 @@
 package pkg
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 
+	"pronestheus/pkg/alert"
+	"pronestheus/pkg/anomaly"
+	"pronestheus/pkg/api"
+	"pronestheus/pkg/archiver"
+	"pronestheus/pkg/balance"
+	"pronestheus/pkg/bot"
+	"pronestheus/pkg/breaker"
+	"pronestheus/pkg/cardinality"
 	"pronestheus/pkg/collectors/nest"
 	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/comfort"
+	"pronestheus/pkg/control"
+	"pronestheus/pkg/daily"
+	"pronestheus/pkg/filter"
+	"pronestheus/pkg/frost"
+	"pronestheus/pkg/graphite"
+	"pronestheus/pkg/grpcapi"
+	"pronestheus/pkg/history"
+	"pronestheus/pkg/homekit"
+	"pronestheus/pkg/leader"
+	"pronestheus/pkg/metricnames"
+	"pronestheus/pkg/openwindow"
+	"pronestheus/pkg/probe"
+	"pronestheus/pkg/remoteread"
+	"pronestheus/pkg/scheduler"
+	"pronestheus/pkg/sink"
+	"pronestheus/pkg/smoothing"
+	"pronestheus/pkg/snmp"
+	"pronestheus/pkg/state"
+	"pronestheus/pkg/statsd"
+	"pronestheus/pkg/useragent"
+	"pronestheus/pkg/webhook"
+	"pronestheus/pkg/zabbix"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const authADC = "adc"
+
+// shutdownTimeout limits how long RunContext waits for requests and background tasks when the context is cancelled.
+const shutdownTimeout = 10 * time.Second
+
 // ExporterConfig contains configuration for the Exporter.
 type ExporterConfig struct {
-	ListenAddr            *string
-	MetricsPath           *string
-	Timeout               *int
-	NestURL               *string
-	NestOAuthClientID     *string
-	NestOAuthClientSecret *string
-	NestOAuthToken        *oauth2.Token // Only used to mock a dummy token in tests
-	NestProjectID         *string
-	NestRefreshToken      *string
-	WeatherLocation       *string
-	WeatherURL            *string
-	WeatherToken          *string
+	ListenAddr              *string
+	MetricsPath             *string
+	Timeout                 *int
+	CollectorTimeouts       *map[string]string
+	BreakerFailures         *int
+	BreakerCooldown         *time.Duration
+	NestURL                 *string
+	NestOAuthClientID       *string
+	NestOAuthClientSecret   *string
+	NestOAuthToken          *oauth2.Token // Only used to mock a dummy token in tests
+	NestProjectID           *string
+	NestRefreshToken        *string
+	NestAuth                *string
+	NestEnvironment         *string
+	NestTokenURL            *string
+	NestReadOnlyScopes      *[]string
+	NestUnit                *string
+	NestLabelPolicy         *string
+	NestModeMetrics         *string
+	NestAliases             *map[string]string
+	NestSchedule            *[]string
+	NestScheduleTimezone    *string
+	NestShortCycle          *time.Duration
+	NestMaxConcurrent       *int
+	NestRateLimit           *float64
+	NestRateBurst           *int
+	NestQuota               *float64
+	NestDeviceFallback      *bool
+	NestDeviceFallbackTTL   *time.Duration
+	WeatherLocation         *string
+	WeatherURL              *string
+	WeatherToken            *string
+	WeatherUnit             *string
+	WeatherForecastURL      *string
+	WeatherForecastHours    *[]int
+	WeatherFallbackTokens   *[]string
+	WeatherFallbackURL      *string
+	WeatherFallbackLocation *string
+	SolarURL                *string
+	SolarLocation           *string
+	LocalSensors            *[]string
+	AwairDevices            *[]string
+	Station                 *bool
+	StationPasskey          *string
+	MQTTBroker              *string
+	MQTTGauges              *[]string
+	MQTTExpiry              *time.Duration
+	Simulate                *bool
+	SimulateThermostats     *int
+	SimulatePeriod          *time.Duration
+	SimulateFailureRate     *float64
+	CollectInterval         *time.Duration
+	PubSubSubscription      *string
+	PubSubURL               *string
+	PubSubToken             *oauth2.Token // Only used to mock a dummy token in tests
+	PubSubResyncInterval    *time.Duration
+	PubSubTimestamps        *bool
+	ArchiveDir              *string
+	ArchiveMaxSize          *int64
+	ArchiveMaxFiles         *int
+	HistoryFile             *string
+	HistoryRetention        *time.Duration
+	HomeKitPin              *string
+	HomeKitPort             *string
+	HomeKitStoragePath      *string
+	SNMPListenAddr          *string
+	SNMPCommunity           *string
+	SNMPBaseOID             *string
+	ZabbixServer            *string
+	ZabbixHost              *string
+	ZabbixInterval          *time.Duration
+	GraphiteAddress         *string
+	GraphitePrefix          *string
+	GraphiteInterval        *time.Duration
+	StatsDAddress           *string
+	StatsDPrefix            *string
+	StatsDTags              *[]string
+	StatsDInterval          *time.Duration
+	WebhookURL              *string
+	WebhookTemplate         *string
+	WebhookHeaders          *[]string
+	WebhookInterval         *time.Duration
+	EventWebhooks           *[]string
+	EventTemplate           *string
+	EventHeaders            *[]string
+	EventThresholds         *[]string
+	AlertRules              *[]string
+	AlertPushoverToken      *string
+	AlertPushoverUser       *string
+	AlertTelegramToken      *string
+	AlertTelegramChatID     *string
+	AlertNtfyURL            *string
+	AlertSMTPAddr           *string
+	AlertSMTPFrom           *string
+	AlertSMTPTo             *[]string
+	AlertSMTPUsername       *string
+	AlertSMTPPassword       *string
+	FrostFloor              *float64
+	BalancePointWindow      *time.Duration
+	Comfort                 *bool
+	ComfortClothing         *float64
+	ComfortMetabolicRate    *float64
+	ComfortAirSpeed         *float64
+	WindowOpenDetection     *bool
+	WindowOpenPeriod        *time.Duration
+	WindowOpenDrop          *float64
+	WindowOpenOutsideDiff   *float64
+	AnomalyDetection        *bool
+	AnomalyThreshold        *float64
+	AnomalyAlpha            *float64
+	Smoothing               *bool
+	SmoothingAlpha          *float64
+	SmoothingWindow         *time.Duration
+	DailyMetrics            *bool
+	HomeTimezone            *string
+	DailyResetTime          *string
+	DegreeDayBase           *float64
+	FilterStateFile         *string
+	StateFile               *string
+	StateFlushInterval      *time.Duration
+	FrostSetpoint           *float64
+	FileSDOutput            *string
+	ConfigFiles             *[]string
+	SelfTest                *bool
+	FailFast                *bool
+	ConfigReloadInterval    *time.Duration
+	ReloadConfig            func() error // Re-reads values of the config from config files, set by the command
+	LeaderElection          *string
+	LeaderElectionLock      *string
+	LeaderElectionID        *string
+	LeaderElectionLease     *time.Duration
+	GRPCListenAddr          *string
+	DebugListenAddr         *string
+	DebugAllowRemote        *bool
+	UserAgent               *string
+	UserAgentContact        *string
+	AccessLogSampleRate     *float64
+	AccessLogSlowThreshold  *time.Duration
+	AdminToken              *string
+	WebConfigFile           *string
+	ControlHolds            *[]string
+	ControlHoldTimezone     *string
+	BotTelegramToken        *string
+	BotDiscordPublicKey     *string
+	BotAllowedChats         *[]string
+	DisableExporterMetrics  *bool
+	DisableGoMetrics        *bool
+	MetricsCompat           *string
+	MetricsRename           *map[string]string
+	MetricsDrop             *[]string
+	MetricsIDLabel          *string
+	MetricsGzipLevel        *int
+	MetricsGzipMinBytes     *int
+	MetricsMaxSeries        *int
+	MetricsTruncateSeries   *bool
 }
 
 // Exporter is a Prometheus exporter.
 type Exporter struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
 	logger      log.Logger
-	listenAddr  string
+	server      *http.Server
 	metricsPath string
-}
+	handler     http.Handler
+	routes      map[string]http.Handler
+	api         *api.Server
+	startedAt   time.Time
+	accessLog   *accessLog
+	webFlags    *web.FlagConfig
+
+	nest          *reloadableCollector
+	nestListeners []nest.Option
+	weather       *reloadableCollector
+	balance       *balance.Analyzer
+	openWindow    *openwindow.Detector
+	daily         *daily.Tracker
+	filter        *filter.Tracker
+	checkpointer  *state.Checkpointer
+	breakers      map[string]*breaker.Breaker
+	switches      *collectorSwitches
 
-var logger log.Logger
+	elector     *leader.Elector
+	leaderTasks []func(context.Context)
+
+	// background contains tasks which save data when they stop, Shutdown waits for them.
+	background sync.WaitGroup
+}
 
 // NewExporter creates a Prometheus exporter using the ExporterConfig and registers the collectors.
 func NewExporter(cfg *ExporterConfig) (*Exporter, error) {
-	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
 
-	if err := registerNestCollector(cfg); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := &Exporter{
+		ctx:         ctx,
+		cancel:      cancel,
+		logger:      logger,
+		server:      &http.Server{Addr: *cfg.ListenAddr},
+		metricsPath: *cfg.MetricsPath,
+		routes:      map[string]http.Handler{},
+		api:         api.New(api.Config{ID: cfg.idLabel}),
+		startedAt:   time.Now(),
+	}
+
+	e.routes[api.ThermostatsPath] = e.api
+	e.routes[api.WeatherPath] = e.api
+	e.routes[api.StreamPath] = e.api
+	e.server.RegisterOnShutdown(e.api.Close)
+
+	if err := e.setupWeb(cfg); err != nil {
 		return nil, err
 	}
 
-	if err := registerWeatherCollector(cfg); err != nil {
+	if err := e.registerSelfMetrics(cfg); err != nil {
 		return nil, err
 	}
 
-	return &Exporter{
-		logger:      logger,
-		listenAddr:  *cfg.ListenAddr,
-		metricsPath: *cfg.MetricsPath,
-	}, nil
+	if err := validateCollectorTimeouts(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.setupBreakers(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.setupCollectorSwitches(cfg); err != nil {
+		return nil, err
+	}
+
+	accessLog, err := newAccessLog(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	e.accessLog = accessLog
+
+	if cfg.GRPCListenAddr != nil && *cfg.GRPCListenAddr != "" {
+		server, err := grpcapi.New(grpcapi.Config{Logger: logger, Addr: *cfg.GRPCListenAddr, Source: e.api, ID: cfg.idLabel})
+		if err != nil {
+			return nil, err
+		}
+		go server.Run(ctx)
+	}
+
+	if err := e.startDebugServer(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.setupLeaderElection(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.simulated() {
+		if err := startSimulator(cfg); err != nil {
+			return nil, err
+		}
+		logger.Log("level", "info", "msg", "Simulation mode enabled, readings are synthetic")
+	}
+
+	if cfg.sandboxed() {
+		if err := startSandbox(cfg); err != nil {
+			return nil, err
+		}
+		logger.Log("level", "info", "msg", "Sandbox environment enabled, readings come from built-in fixtures")
+	}
+
+	if err := e.setupState(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerNestCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerWeatherCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerSolarCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerStationCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerSensorCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerAwairCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := e.registerMQTTCollector(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.reloadable() {
+		if err := e.watchConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	e.startLeaderElection()
+	e.startState()
+
+	return e, nil
+}
+
+// userAgent returns the User-Agent of outbound API calls.
+func (cfg *ExporterConfig) userAgent() string {
+	var product, contact string
+	if cfg.UserAgent != nil {
+		product = *cfg.UserAgent
+	}
+	if cfg.UserAgentContact != nil {
+		contact = *cfg.UserAgentContact
+	}
+
+	return useragent.Format(product, contact)
+}
+
+// transport returns a transport setting the User-Agent of requests sent with the base transport.
+func (cfg *ExporterConfig) transport(base http.RoundTripper) http.RoundTripper {
+	return &useragent.Transport{Base: base, UserAgent: cfg.userAgent()}
+}
+
+// defaultCredentials returns true if the Nest API should be authenticated with Application Default Credentials.
+func (cfg *ExporterConfig) defaultCredentials() bool {
+	return cfg.NestAuth != nil && *cfg.NestAuth == authADC
+}
+
+// controlEnabled returns true if features changing thermostat settings are enabled: the admin endpoints, holds and
+// frost protection. Otherwise the Nest collector of the exporter is read-only.
+func (cfg *ExporterConfig) controlEnabled() bool {
+	return isSet(cfg.AdminToken) || (cfg.ControlHolds != nil && len(*cfg.ControlHolds) > 0) ||
+		(cfg.FrostFloor != nil && *cfg.FrostFloor != 0)
 }
 
 // Run starts the exporter server and listens for incoming scraping requests.
 func (e *Exporter) Run() error {
 	e.logger.Log("level", "debug", "msg", "Started ProNestheus - Nest Thermostat Prometheus Exporter")
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>ProNestheus</title></head>
-			<body>
-			<h1>ProNestheus - Nest Thermostat Prometheus Exporter</h1>
-			<p><a href="` + e.metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
-
-	http.Handle(e.metricsPath, promhttp.Handler())
-	return http.ListenAndServe(e.listenAddr, nil)
-}
-
-func registerNestCollector(cfg *ExporterConfig) error {
-	nestConfig := nest.Config{
-		Logger:            logger,
-		Timeout:           *cfg.Timeout,
-		APIURL:            *cfg.NestURL,
-		OAuthClientID:     *cfg.NestOAuthClientID,
-		OAuthClientSecret: *cfg.NestOAuthClientSecret,
-		RefreshToken:      *cfg.NestRefreshToken,
-		ProjectID:         *cfg.NestProjectID,
-		OAuthToken:        cfg.NestOAuthToken,
-	}
-
-	nestCollector, err := nest.New(nestConfig)
+	// Handlers registered on the default mux by imported packages, like pprof, must not be exposed with metrics.
+	mux := http.NewServeMux()
+	landing, err := landingPage(e.metricsPath)
 	if err != nil {
 		return err
 	}
+	mux.Handle("/", landing)
+
+	mux.Handle(e.metricsPath, e.handler)
+	for path, handler := range e.routes {
+		mux.Handle(path, handler)
+	}
+
+	e.server.Handler = mux
+	if e.accessLog != nil {
+		e.accessLog.handler = mux
+		e.server.Handler = e.accessLog
+	}
+
+	if err := sdNotify("READY=1"); err != nil {
+		e.logger.Log("level", "warn", "msg", "Failed notifying systemd", "err", err)
+	}
+
+	err = web.ListenAndServe(e.server, e.webFlags, e.logger)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// RunContext runs the exporter like Run until the context is cancelled, eg. by SIGTERM, and then shuts it down,
+// saving the state file and releasing the leader election lock.
+func (e *Exporter) RunContext(ctx context.Context) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.Run()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
 
-	return prometheus.Register(nestCollector)
+	return <-errs
 }
 
-func registerWeatherCollector(cfg *ExporterConfig) error {
+// Shutdown gracefully stops the exporter server, waiting for active requests to finish until the context expires.
+// It also stops all background collections.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	sdNotify("STOPPING=1")
+	e.cancel()
+	err := e.server.Shutdown(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		e.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// runUntilShutdown runs the task in the background. Shutdown waits for it to return after the context is cancelled.
+func (e *Exporter) runUntilShutdown(task func(ctx context.Context)) {
+	e.background.Add(1)
+	go func() {
+		defer e.background.Done()
+		task(e.ctx)
+	}()
+}
+
+// registerSelfMetrics removes internal metrics of the exporter disabled in the config from the default registry and
+// creates the metrics and probe handlers. Go runtime and process metrics are registered there by the Prometheus
+// client, metrics of the HTTP handler are only registered if exporter metrics are enabled. Families named with units
+// other than base units are renamed according to the compatibility mode, families are renamed or dropped according to
+// the metrics mapping, see the metricnames package, and families exceeding the series limit are reported, see the
+// cardinality package. Responses are compressed by the compressHandler, and the quotaHandler estimates the rate of
+// Nest API requests caused by scrapes.
+func (e *Exporter) registerSelfMetrics(cfg *ExporterConfig) error {
+	if cfg.DisableGoMetrics != nil && *cfg.DisableGoMetrics {
+		prometheus.Unregister(prometheus.NewGoCollector())
+	}
+
+	compat := metricnames.CompatBoth
+	if cfg.MetricsCompat != nil {
+		compat = *cfg.MetricsCompat
+	}
+	renamed, err := metricnames.NewGatherer(prometheus.DefaultGatherer, compat)
+	if err != nil {
+		return err
+	}
+	mapped, err := metricnames.NewMappingGatherer(renamed, metricsMapping(cfg))
+	if err != nil {
+		return err
+	}
+	gatherer := cardinality.NewGatherer(mapped, cardinalityConfig(cfg, e.logger))
+	e.handler = promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+
+	if cfg.exporterMetricsDisabled() {
+		prometheus.Unregister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	} else {
+		e.handler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, e.handler)
+	}
+
+	e.handler = metricnames.UnitHandler(e.handler)
+
+	compress, err := newCompressHandler(cfg, e.handler)
+	if err != nil {
+		return err
+	}
+	if !cfg.exporterMetricsDisabled() {
+		if err := prometheus.Register(compress.size); err != nil {
+			return err
+		}
+	}
+	e.handler = compress
+
+	quota := newQuotaHandler(cfg, e.handler, e.logger)
+	if quota.quota > 0 {
+		if err := prometheus.Register(quota.risk); err != nil {
+			return err
+		}
+	}
+	if !cfg.exporterMetricsDisabled() {
+		if err := prometheus.Register(quota.interval); err != nil {
+			return err
+		}
+	}
+	e.handler = quota
+
+	e.routes[probe.Path] = probe.NewHandler(gatherer)
+	return nil
+}
+
+// metricsMapping returns the families renamed or dropped by the config.
+func metricsMapping(cfg *ExporterConfig) metricnames.Mapping {
+	var mapping metricnames.Mapping
+	if cfg.MetricsRename != nil {
+		mapping.Rename = *cfg.MetricsRename
+	}
+	if cfg.MetricsDrop != nil {
+		mapping.Drop = *cfg.MetricsDrop
+	}
+	return mapping
+}
+
+// cardinalityConfig converts the ExporterConfig into the cardinality Config.
+func cardinalityConfig(cfg *ExporterConfig, logger log.Logger) cardinality.Config {
+	cardinalityCfg := cardinality.Config{
+		Logger: logger,
+		Report: !cfg.exporterMetricsDisabled(),
+	}
+
+	if cfg.MetricsMaxSeries != nil {
+		cardinalityCfg.MaxSeries = *cfg.MetricsMaxSeries
+	}
+	if cfg.MetricsTruncateSeries != nil {
+		cardinalityCfg.Truncate = *cfg.MetricsTruncateSeries
+	}
+
+	return cardinalityCfg
+}
+
+// idPolicy returns the policy of the id label of thermostats, see nest.WithIDPolicy.
+func (cfg *ExporterConfig) idPolicy() string {
+	if cfg.MetricsIDLabel == nil {
+		return nest.IDFull
+	}
+	return *cfg.MetricsIDLabel
+}
+
+// idLabel returns the value of the id label of the thermostat, so outputs other than the Nest collector identify
+// thermostats like its metrics do.
+func (cfg *ExporterConfig) idLabel(therm *nest.Thermostat) string {
+	return nest.IDLabel(cfg.idPolicy(), therm.ID)
+}
+
+// metricLabels returns the labels of thermostats in metrics of the derived collectors and remote read, with the id
+// policy and the aliases and label policy of the current Nest collector, which is replaced on reloads.
+func (e *Exporter) metricLabels(cfg *ExporterConfig) nest.MetricLabels {
+	return nest.MetricLabels{
+		IDPolicy: cfg.idPolicy(),
+		Label:    func(therm *nest.Thermostat) string { return nestController{e.nest}.MetricLabel(therm) },
+	}
+}
+
+func (cfg *ExporterConfig) exporterMetricsDisabled() bool {
+	return cfg.DisableExporterMetrics != nil && *cfg.DisableExporterMetrics
+}
+
+// register registers the collector in the Prometheus registry. Collection is abandoned after the timeout of the
+// collector. Unless exporter metrics are disabled, the duration of collection and whether it timed out are exported.
+// If the collection interval is set, the collector is wrapped in a scheduler collecting its metrics in the background,
+// instead of on every scrape. Collectors can be disabled at runtime, see collectorSwitches.
+func (e *Exporter) register(cfg *ExporterConfig, name string, collector prometheus.Collector) error {
+	collector = e.switches.wrap(name, collector)
+	collector = newTimeoutCollector(name, collector, cfg.collectorTimeout(name), e.logger, !cfg.exporterMetricsDisabled())
+
+	if !cfg.exporterMetricsDisabled() {
+		collector = newTimedCollector(name, collector)
+	}
+
+	if cfg.CollectInterval != nil && *cfg.CollectInterval > 0 {
+		s := scheduler.New(collector, *cfg.CollectInterval)
+		s.Start(e.ctx)
+		collector = s
+	}
+
+	return prometheus.Register(collector)
+}
+
+func (e *Exporter) registerNestCollector(cfg *ExporterConfig) error {
+	opts := []nest.Option{nest.WithListener(e.api.ThermostatListener())}
+
+	if cfg.ArchiveDir != nil && *cfg.ArchiveDir != "" {
+		a, err := archiver.New(archiverConfig(cfg, e.logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(a.Listener()))
+	}
+
+	if cfg.FileSDOutput != nil && *cfg.FileSDOutput != "" {
+		opts = append(opts, nest.WithListener(probe.NewFileSD(*cfg.FileSDOutput, e.logger).Listener()))
+	}
+
+	if cfg.HistoryFile != nil && *cfg.HistoryFile != "" {
+		store, err := history.New(historyConfig(cfg, e.logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(store.Listener()))
+		e.routes["/api/history"] = store
+
+		reader, err := remoteread.New(e.remoteReadConfig(cfg, store))
+		if err != nil {
+			return err
+		}
+		e.routes[remoteread.Path] = reader
+	}
+
+	if cfg.HomeKitPin != nil && *cfg.HomeKitPin != "" {
+		bridge, err := homekit.New(homeKitConfig(cfg, e.logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(bridge.Listener()))
+		e.server.RegisterOnShutdown(bridge.Stop)
+	}
+
+	if cfg.SNMPListenAddr != nil && *cfg.SNMPListenAddr != "" {
+		agent, err := snmp.New(snmpConfig(cfg, e.logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(agent.Listener()))
+		go agent.Run(e.ctx)
+	}
+
+	if cfg.ZabbixServer != nil && *cfg.ZabbixServer != "" {
+		pusher := sink.NewPusher("Zabbix", zabbix.New(zabbixConfig(cfg)), *cfg.ZabbixInterval, e.logger)
+		opts = append(opts, nest.WithListener(pusher.Listener()))
+		e.runAsLeader(pusher.Run)
+	}
+
+	if cfg.GraphiteAddress != nil && *cfg.GraphiteAddress != "" {
+		pusher := sink.NewPusher("Graphite", graphite.New(graphiteConfig(cfg)), *cfg.GraphiteInterval, e.logger)
+		opts = append(opts, nest.WithListener(pusher.Listener()))
+		e.runAsLeader(pusher.Run)
+	}
+
+	if cfg.StatsDAddress != nil && *cfg.StatsDAddress != "" {
+		pusher := sink.NewPusher("StatsD", statsd.New(statsDConfig(cfg)), *cfg.StatsDInterval, e.logger)
+		opts = append(opts, nest.WithListener(pusher.Listener()))
+		e.runAsLeader(pusher.Run)
+	}
+
+	if cfg.WebhookURL != nil && *cfg.WebhookURL != "" {
+		sender, err := webhook.New(webhookConfig(cfg))
+		if err != nil {
+			return err
+		}
+		pusher := sink.NewPusher("webhook", sender, *cfg.WebhookInterval, e.logger)
+		opts = append(opts, nest.WithListener(pusher.Listener()))
+		e.runAsLeader(pusher.Run)
+	}
+
+	if (cfg.EventWebhooks != nil && len(*cfg.EventWebhooks) > 0) || (cfg.EventThresholds != nil && len(*cfg.EventThresholds) > 0) {
+		events, err := webhook.NewEvents(eventsConfig(cfg, e.logger))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(events.Listener()))
+		e.runAsLeader(events.Run)
+	}
+
+	if cfg.AlertRules != nil && len(*cfg.AlertRules) > 0 {
+		alertCfg, err := alertConfig(cfg, e.logger)
+		if err != nil {
+			return err
+		}
+		engine, err := alert.New(alertCfg)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(e.leaderListener(engine.Listener())))
+		e.runAsLeader(engine.Run)
+	}
+
+	var watchdog *frost.Watchdog
+	if cfg.FrostFloor != nil && *cfg.FrostFloor != 0 {
+		var err error
+		watchdog, err = frost.New(e.frostConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(watchdog); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(e.leaderListener(watchdog.Listener())))
+	}
+
+	// The balance point needs the outside temperature, so it's only estimated with the weather collector.
+	if cfg.BalancePointWindow != nil && *cfg.BalancePointWindow > 0 && *cfg.WeatherToken != "" {
+		analyzer, err := balance.New(e.balanceConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(analyzer); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(analyzer.ThermostatListener()))
+		e.balance = analyzer
+	}
+
+	if cfg.Comfort != nil && *cfg.Comfort {
+		estimator, err := comfort.New(e.comfortConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(estimator); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithListener(estimator.Listener()))
+	}
+
+	if cfg.WindowOpenDetection != nil && *cfg.WindowOpenDetection {
+		detector, err := openwindow.New(e.openWindowConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(detector); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithUpdateListener(detector.ThermostatListener()))
+		e.openWindow = detector
+	}
+
+	if cfg.AnomalyDetection != nil && *cfg.AnomalyDetection {
+		detector, err := anomaly.New(e.anomalyConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(detector); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithUpdateListener(detector.Listener()))
+	}
+
+	if cfg.Smoothing != nil && *cfg.Smoothing {
+		smoother, err := smoothing.New(e.smoothingConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(smoother); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithUpdateListener(smoother.Listener()))
+	}
+
+	if cfg.DailyMetrics != nil && *cfg.DailyMetrics {
+		tracker, err := daily.New(e.dailyConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(tracker); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithUpdateListener(tracker.ThermostatListener()))
+		e.daily = tracker
+	}
+
+	if cfg.FilterStateFile != nil && *cfg.FilterStateFile != "" {
+		tracker, err := filter.New(e.filterConfig(cfg))
+		if err != nil {
+			return err
+		}
+		if err := prometheus.Register(tracker); err != nil {
+			return err
+		}
+		opts = append(opts, nest.WithUpdateListener(tracker.Listener()))
+		if isSet(cfg.AdminToken) {
+			e.routes[filter.ResetPath] = control.RequireAdmin(*cfg.AdminToken, tracker)
+		}
+		e.runUntilShutdown(tracker.Run)
+		e.filter = tracker
+	}
+
+	e.nestListeners = opts
+	nestCollector, err := e.newNestCollector(cfg)
+	if err != nil {
+		return err
+	}
+	e.nest = &reloadableCollector{collector: nestCollector}
+
+	if e.checkpointer != nil {
+		if err := e.checkpointer.Add("nest", nestState{e.nest}); err != nil {
+			return err
+		}
+		if e.daily != nil {
+			if err := e.checkpointer.Add("daily", e.daily); err != nil {
+				return err
+			}
+		}
+	}
+
+	if watchdog != nil {
+		e.runAsLeader(func(ctx context.Context) { watchdog.Run(ctx, nestController{e.nest}) })
+	}
+
+	e.registerStateHandler(cfg)
+
+	if cfg.AdminToken != nil && *cfg.AdminToken != "" {
+		e.routes[control.Path] = control.NewHandler(control.Config{
+			Logger:      e.logger,
+			Controller:  nestController{e.nest},
+			Thermostats: e.api.Thermostats,
+			Label:       func(therm *nest.Thermostat) string { return nestController{e.nest}.MetricLabel(therm) },
+			Token:       *cfg.AdminToken,
+		})
+	}
+
+	if (cfg.ControlHolds != nil && len(*cfg.ControlHolds) > 0) || isSet(cfg.AdminToken) {
+		if err := e.registerHolds(cfg); err != nil {
+			return err
+		}
+	}
+
+	if isSet(cfg.BotTelegramToken) || isSet(cfg.BotDiscordPublicKey) {
+		if err := e.registerBot(cfg); err != nil {
+			return err
+		}
+	}
+
+	if cfg.subscribed() {
+		handler := func(data []byte) error { return nestController{e.nest}.current().HandleEvent(data) }
+		if err := e.subscribe(cfg, handler); err != nil {
+			return err
+		}
+	}
+
+	return e.register(cfg, "nest", e.nest)
+}
+
+// registerHolds starts the scheduler of holds, serving the holds endpoint if the admin token is set.
+func (e *Exporter) registerHolds(cfg *ExporterConfig) error {
+	holdsCfg := control.SchedulerConfig{
+		Logger:      e.logger,
+		Controller:  nestController{e.nest},
+		Thermostats: nestController{e.nest}.Thermostats,
+		Label:       nestController{e.nest}.MetricLabel,
+	}
+	if cfg.ControlHolds != nil {
+		holdsCfg.Holds = *cfg.ControlHolds
+	}
+	if cfg.ControlHoldTimezone != nil {
+		holdsCfg.Timezone = *cfg.ControlHoldTimezone
+	}
+	if cfg.AdminToken != nil {
+		holdsCfg.Token = *cfg.AdminToken
+	}
+
+	scheduler, err := control.NewScheduler(holdsCfg)
+	if err != nil {
+		return err
+	}
+	if err := prometheus.Register(scheduler); err != nil {
+		return err
+	}
+
+	if holdsCfg.Token != "" {
+		e.routes[control.HoldsPath] = scheduler
+	}
+	e.runAsLeader(scheduler.Run)
+	return nil
+}
+
+// registerBot starts the Telegram bot and serves the Discord interactions endpoint. The bot only changes settings if
+// the control API is enabled with the admin token.
+func (e *Exporter) registerBot(cfg *ExporterConfig) error {
+	botCfg := bot.Config{
+		Logger:      e.logger,
+		Thermostats: e.api.Thermostats,
+		Label:       nestController{e.nest}.MetricLabel,
+	}
+	if isSet(cfg.AdminToken) {
+		botCfg.Controller = nestController{e.nest}
+	}
+	if cfg.BotAllowedChats != nil {
+		botCfg.AllowedChats = *cfg.BotAllowedChats
+	}
+
+	chatBot, err := bot.New(botCfg)
+	if err != nil {
+		return err
+	}
+
+	if isSet(cfg.BotDiscordPublicKey) {
+		discord, err := bot.NewDiscord(*cfg.BotDiscordPublicKey, chatBot)
+		if err != nil {
+			return err
+		}
+		e.routes[bot.DiscordPath] = discord
+	}
+
+	// Only one client may poll updates of a Telegram bot, so replicas poll only as the leader.
+	if isSet(cfg.BotTelegramToken) {
+		client := &http.Client{Transport: cfg.transport(nil)}
+		e.runAsLeader(bot.NewTelegram(*cfg.BotTelegramToken, chatBot, client, e.logger).Run)
+	}
+
+	return nil
+}
+
+// newNestCollector creates the Nest collector from the config, passing readings to the listeners of the exporter.
+func (e *Exporter) newNestCollector(cfg *ExporterConfig) (*nest.Collector, error) {
+	opts := append(nestOptions(cfg, e.logger), e.nestListeners...)
+	opts = append(opts, nest.WithTransport(e.breakerTransport("nest", nil)))
+	if cfg.subscribed() {
+		opts = append(opts, pubSubOptions(cfg)...)
+	}
+	if !cfg.controlEnabled() {
+		var scopes []string
+		if cfg.NestReadOnlyScopes != nil {
+			scopes = *cfg.NestReadOnlyScopes
+		}
+		opts = append(opts, nest.WithReadOnly(scopes...))
+	}
+
+	return nest.New(*cfg.NestProjectID, opts...)
+}
+
+// nestOptions converts the ExporterConfig into options for the Nest collector.
+func nestOptions(cfg *ExporterConfig, logger log.Logger) []nest.Option {
+	opts := []nest.Option{
+		nest.WithLogger(logger),
+		nest.WithTimeout(cfg.collectorTimeout("nest")),
+		nest.WithAPIURL(*cfg.NestURL),
+		nest.WithOAuthClient(*cfg.NestOAuthClientID, *cfg.NestOAuthClientSecret),
+		nest.WithRefreshToken(*cfg.NestRefreshToken),
+		nest.WithUserAgent(cfg.userAgent()),
+	}
+
+	if cfg.NestUnit != nil {
+		opts = append(opts, nest.WithUnit(*cfg.NestUnit))
+	}
+
+	if cfg.NestLabelPolicy != nil {
+		opts = append(opts, nest.WithLabelPolicy(*cfg.NestLabelPolicy))
+	}
+
+	if cfg.MetricsIDLabel != nil {
+		opts = append(opts, nest.WithIDPolicy(*cfg.MetricsIDLabel))
+	}
+
+	if cfg.NestModeMetrics != nil {
+		opts = append(opts, nest.WithModeMetrics(*cfg.NestModeMetrics))
+	}
+
+	if cfg.NestAliases != nil && len(*cfg.NestAliases) > 0 {
+		opts = append(opts, nest.WithAliases(*cfg.NestAliases))
+	}
+
+	if cfg.NestSchedule != nil && len(*cfg.NestSchedule) > 0 {
+		var timezone string
+		if cfg.NestScheduleTimezone != nil {
+			timezone = *cfg.NestScheduleTimezone
+		}
+		opts = append(opts, nest.WithSchedule(*cfg.NestSchedule, timezone))
+	}
+
+	if cfg.NestShortCycle != nil {
+		opts = append(opts, nest.WithShortCycleThreshold(*cfg.NestShortCycle))
+	}
+
+	if cfg.NestMaxConcurrent != nil {
+		opts = append(opts, nest.WithMaxConcurrentRequests(*cfg.NestMaxConcurrent))
+	}
+
+	if cfg.NestRateLimit != nil {
+		burst := 1
+		if cfg.NestRateBurst != nil {
+			burst = *cfg.NestRateBurst
+		}
+		opts = append(opts, nest.WithRateLimit(*cfg.NestRateLimit, burst))
+	}
+
+	if cfg.NestDeviceFallback != nil && *cfg.NestDeviceFallback {
+		var ttl time.Duration
+		if cfg.NestDeviceFallbackTTL != nil {
+			ttl = *cfg.NestDeviceFallbackTTL
+		}
+		opts = append(opts, nest.WithDeviceFallback(ttl))
+	}
+
+	if cfg.defaultCredentials() {
+		opts = append(opts, nest.WithDefaultCredentials())
+	}
+
+	if cfg.NestTokenURL != nil && *cfg.NestTokenURL != "" {
+		opts = append(opts, nest.WithTokenURL(*cfg.NestTokenURL))
+	}
+
+	if cfg.NestOAuthToken != nil {
+		opts = append(opts, nest.WithToken(cfg.NestOAuthToken))
+	}
+
+	return opts
+}
+
+func (e *Exporter) registerWeatherCollector(cfg *ExporterConfig) error {
 	// Don't create weather collector if WeatherToken is empty.
 	if *cfg.WeatherToken == "" {
 		return nil
 	}
 
-	weatherConfig := weather.Config{
-		Logger:        logger,
-		Timeout:       *cfg.Timeout,
-		APIURL:        *cfg.WeatherURL,
-		APIToken:      *cfg.WeatherToken,
-		APILocationID: *cfg.WeatherLocation,
+	weatherCollector, err := e.newWeatherCollector(cfg)
+	if err != nil {
+		return err
 	}
+	e.weather = &reloadableCollector{collector: weatherCollector}
 
-	weatherCollector, err := weather.New(weatherConfig)
+	return e.register(cfg, "weather", e.weather)
+}
+
+// newWeatherCollector creates the OpenWeatherMap collector from the config, passing readings to the API.
+func (e *Exporter) newWeatherCollector(cfg *ExporterConfig) (*weather.Collector, error) {
+	opts, err := weatherOptions(cfg, e.logger)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	opts = append(opts, weather.WithTransport(e.breakerTransport("weather", cfg.transport(nil))))
+	for _, listener := range e.weatherListeners() {
+		opts = append(opts, weather.WithListener(listener))
+	}
+
+	return weather.New(*cfg.WeatherToken, *cfg.WeatherLocation, opts...)
+}
+
+// weatherListeners returns the listeners of outside readings, from OpenWeatherMap or a weather station.
+func (e *Exporter) weatherListeners() []weather.Listener {
+	listeners := []weather.Listener{e.api.WeatherListener()}
+	if e.balance != nil {
+		listeners = append(listeners, e.balance.WeatherListener())
+	}
+	if e.openWindow != nil {
+		listeners = append(listeners, e.openWindow.WeatherListener())
+	}
+	if e.daily != nil {
+		listeners = append(listeners, e.daily.WeatherListener())
+	}
+	return listeners
+}
+
+// archiverConfig converts the ExporterConfig into the archiver Config.
+func archiverConfig(cfg *ExporterConfig, logger log.Logger) archiver.Config {
+	archiverCfg := archiver.Config{
+		Logger: logger,
+		Dir:    *cfg.ArchiveDir,
+	}
+
+	if cfg.ArchiveMaxSize != nil {
+		archiverCfg.MaxSize = *cfg.ArchiveMaxSize
+	}
+
+	if cfg.ArchiveMaxFiles != nil {
+		archiverCfg.MaxFiles = *cfg.ArchiveMaxFiles
+	}
+
+	return archiverCfg
+}
+
+// remoteReadConfig converts the ExporterConfig into the remote read Config. The Nest collector is created later and
+// replaced on reloads, so the label of thermostats is looked up on every request.
+func (e *Exporter) remoteReadConfig(cfg *ExporterConfig, store *history.Store) remoteread.Config {
+	readCfg := remoteread.Config{
+		Logger: e.logger,
+		Store:  store,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.NestUnit != nil {
+		readCfg.Unit = *cfg.NestUnit
+	}
+
+	return readCfg
+}
+
+// historyConfig converts the ExporterConfig into the history Config.
+func historyConfig(cfg *ExporterConfig, logger log.Logger) history.Config {
+	historyCfg := history.Config{
+		Logger: logger,
+		Path:   *cfg.HistoryFile,
+	}
+
+	if cfg.HistoryRetention != nil {
+		historyCfg.Retention = *cfg.HistoryRetention
+	}
+
+	return historyCfg
+}
+
+// homeKitConfig converts the ExporterConfig into the HomeKit bridge Config.
+func homeKitConfig(cfg *ExporterConfig, logger log.Logger) homekit.Config {
+	homeKitCfg := homekit.Config{
+		Logger: logger,
+		Pin:    *cfg.HomeKitPin,
+	}
+
+	if cfg.HomeKitPort != nil {
+		homeKitCfg.Port = *cfg.HomeKitPort
+	}
+
+	if cfg.HomeKitStoragePath != nil {
+		homeKitCfg.StoragePath = *cfg.HomeKitStoragePath
+	}
+
+	return homeKitCfg
+}
+
+// snmpConfig converts the ExporterConfig into the SNMP agent Config.
+func snmpConfig(cfg *ExporterConfig, logger log.Logger) snmp.Config {
+	snmpCfg := snmp.Config{
+		Logger: logger,
+		Addr:   *cfg.SNMPListenAddr,
+	}
+
+	if cfg.SNMPCommunity != nil {
+		snmpCfg.Community = *cfg.SNMPCommunity
+	}
+
+	if cfg.SNMPBaseOID != nil {
+		snmpCfg.BaseOID = *cfg.SNMPBaseOID
+	}
+
+	return snmpCfg
+}
+
+// zabbixConfig converts the ExporterConfig into the Zabbix sender Config.
+func zabbixConfig(cfg *ExporterConfig) zabbix.Config {
+	zabbixCfg := zabbix.Config{
+		Server:  *cfg.ZabbixServer,
+		Timeout: time.Duration(*cfg.Timeout) * time.Millisecond,
+	}
+
+	if cfg.ZabbixHost != nil {
+		zabbixCfg.Host = *cfg.ZabbixHost
+	}
+
+	return zabbixCfg
+}
+
+// graphiteConfig converts the ExporterConfig into the Graphite sender Config.
+func graphiteConfig(cfg *ExporterConfig) graphite.Config {
+	graphiteCfg := graphite.Config{
+		Address: *cfg.GraphiteAddress,
+		Timeout: time.Duration(*cfg.Timeout) * time.Millisecond,
+	}
+
+	if cfg.GraphitePrefix != nil {
+		graphiteCfg.Prefix = *cfg.GraphitePrefix
+	}
+
+	return graphiteCfg
+}
+
+// statsDConfig converts the ExporterConfig into the StatsD sender Config.
+func statsDConfig(cfg *ExporterConfig) statsd.Config {
+	statsDCfg := statsd.Config{
+		Address: *cfg.StatsDAddress,
+		Timeout: time.Duration(*cfg.Timeout) * time.Millisecond,
+	}
+
+	if cfg.StatsDPrefix != nil {
+		statsDCfg.Prefix = *cfg.StatsDPrefix
+	}
+
+	if cfg.StatsDTags != nil {
+		statsDCfg.Tags = *cfg.StatsDTags
+	}
+
+	return statsDCfg
+}
+
+// webhookConfig converts the ExporterConfig into the webhook sender Config.
+func webhookConfig(cfg *ExporterConfig) webhook.Config {
+	webhookCfg := webhook.Config{
+		URL:       *cfg.WebhookURL,
+		Timeout:   time.Duration(*cfg.Timeout) * time.Millisecond,
+		Transport: cfg.transport(nil),
+		ID:        cfg.idLabel,
+	}
+
+	if cfg.WebhookTemplate != nil {
+		webhookCfg.Template = *cfg.WebhookTemplate
+	}
+
+	if cfg.WebhookHeaders != nil {
+		webhookCfg.Headers = *cfg.WebhookHeaders
+	}
+
+	return webhookCfg
+}
+
+// eventsConfig converts the ExporterConfig into the webhook Events config.
+func eventsConfig(cfg *ExporterConfig, logger log.Logger) webhook.EventsConfig {
+	eventsCfg := webhook.EventsConfig{
+		Logger:    logger,
+		Timeout:   time.Duration(*cfg.Timeout) * time.Millisecond,
+		Transport: cfg.transport(nil),
+		ID:        cfg.idLabel,
+	}
+
+	if cfg.EventWebhooks != nil {
+		eventsCfg.Webhooks = *cfg.EventWebhooks
+	}
+
+	if cfg.EventThresholds != nil {
+		eventsCfg.Thresholds = *cfg.EventThresholds
+	}
+
+	if cfg.EventTemplate != nil {
+		eventsCfg.Template = *cfg.EventTemplate
+	}
+
+	if cfg.EventHeaders != nil {
+		eventsCfg.Headers = *cfg.EventHeaders
+	}
+
+	return eventsCfg
+}
+
+// alertConfig converts the ExporterConfig into the alert engine Config. It returns an error if any rule is invalid.
+func alertConfig(cfg *ExporterConfig, logger log.Logger) (alert.Config, error) {
+	alertCfg := alert.Config{Logger: logger}
+	client := &http.Client{Timeout: time.Duration(*cfg.Timeout) * time.Millisecond, Transport: cfg.transport(nil)}
+
+	for _, text := range *cfg.AlertRules {
+		rule, err := alert.ParseRule(text)
+		if err != nil {
+			return alert.Config{}, err
+		}
+		alertCfg.Rules = append(alertCfg.Rules, rule)
+	}
+
+	if isSet(cfg.AlertPushoverToken) && isSet(cfg.AlertPushoverUser) {
+		alertCfg.Notifiers = append(alertCfg.Notifiers, alert.NewPushover(*cfg.AlertPushoverToken, *cfg.AlertPushoverUser, client))
+	}
+
+	if isSet(cfg.AlertTelegramToken) && isSet(cfg.AlertTelegramChatID) {
+		alertCfg.Notifiers = append(alertCfg.Notifiers, alert.NewTelegram(*cfg.AlertTelegramToken, *cfg.AlertTelegramChatID, client))
+	}
+
+	if isSet(cfg.AlertNtfyURL) {
+		alertCfg.Notifiers = append(alertCfg.Notifiers, alert.NewNtfy(*cfg.AlertNtfyURL, client))
+	}
+
+	if isSet(cfg.AlertSMTPAddr) && isSet(cfg.AlertSMTPFrom) && cfg.AlertSMTPTo != nil && len(*cfg.AlertSMTPTo) > 0 {
+		var username, password string
+		if cfg.AlertSMTPUsername != nil {
+			username = *cfg.AlertSMTPUsername
+		}
+		if cfg.AlertSMTPPassword != nil {
+			password = *cfg.AlertSMTPPassword
+		}
+		alertCfg.Notifiers = append(alertCfg.Notifiers, alert.NewSMTP(*cfg.AlertSMTPAddr, *cfg.AlertSMTPFrom, *cfg.AlertSMTPTo, username, password))
+	}
+
+	return alertCfg, nil
+}
+
+// balanceConfig converts the ExporterConfig into the balance point analyzer Config. Thermostats are labelled like by
+// the current Nest collector.
+func (e *Exporter) balanceConfig(cfg *ExporterConfig) balance.Config {
+	balanceCfg := balance.Config{
+		Logger: e.logger,
+		Window: *cfg.BalancePointWindow,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.NestUnit != nil {
+		balanceCfg.Unit = *cfg.NestUnit
+	}
+
+	return balanceCfg
+}
+
+// comfortConfig converts the ExporterConfig into the comfort Estimator Config.
+func (e *Exporter) comfortConfig(cfg *ExporterConfig) comfort.Config {
+	comfortCfg := comfort.Config{
+		Logger: e.logger,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.ComfortClothing != nil {
+		comfortCfg.Clothing = *cfg.ComfortClothing
+	}
+
+	if cfg.ComfortMetabolicRate != nil {
+		comfortCfg.MetabolicRate = *cfg.ComfortMetabolicRate
+	}
+
+	if cfg.ComfortAirSpeed != nil {
+		comfortCfg.AirSpeed = *cfg.ComfortAirSpeed
+	}
+
+	return comfortCfg
+}
+
+// openWindowConfig converts the ExporterConfig into the open window Detector Config.
+func (e *Exporter) openWindowConfig(cfg *ExporterConfig) openwindow.Config {
+	openWindowCfg := openwindow.Config{
+		Logger: e.logger,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.WindowOpenPeriod != nil {
+		openWindowCfg.Period = *cfg.WindowOpenPeriod
+	}
+
+	if cfg.WindowOpenDrop != nil {
+		openWindowCfg.Drop = *cfg.WindowOpenDrop
+	}
+
+	if cfg.WindowOpenOutsideDiff != nil {
+		openWindowCfg.OutsideDifference = *cfg.WindowOpenOutsideDiff
+	}
+
+	return openWindowCfg
+}
+
+// anomalyConfig converts the ExporterConfig into the anomaly Detector Config.
+func (e *Exporter) anomalyConfig(cfg *ExporterConfig) anomaly.Config {
+	anomalyCfg := anomaly.Config{
+		Logger: e.logger,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.AnomalyThreshold != nil {
+		anomalyCfg.Threshold = *cfg.AnomalyThreshold
+	}
+
+	if cfg.AnomalyAlpha != nil {
+		anomalyCfg.Alpha = *cfg.AnomalyAlpha
+	}
+
+	return anomalyCfg
+}
+
+// smoothingConfig converts the ExporterConfig into the smoothing Smoother Config.
+func (e *Exporter) smoothingConfig(cfg *ExporterConfig) smoothing.Config {
+	smoothingCfg := smoothing.Config{
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.SmoothingAlpha != nil {
+		smoothingCfg.Alpha = *cfg.SmoothingAlpha
+	}
+
+	if cfg.SmoothingWindow != nil {
+		smoothingCfg.Window = *cfg.SmoothingWindow
+	}
+
+	if cfg.NestUnit != nil {
+		smoothingCfg.Unit = *cfg.NestUnit
+	}
+
+	return smoothingCfg
+}
+
+// dailyConfig converts the ExporterConfig into the daily runtime, degree days and extremes Tracker Config.
+func (e *Exporter) dailyConfig(cfg *ExporterConfig) daily.Config {
+	dailyCfg := daily.Config{
+		Logger: e.logger,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.WeatherUnit != nil {
+		dailyCfg.Unit = *cfg.WeatherUnit
+	}
+
+	if cfg.NestUnit != nil {
+		dailyCfg.ThermostatUnit = *cfg.NestUnit
+	}
+
+	if cfg.HomeTimezone != nil {
+		dailyCfg.Timezone = *cfg.HomeTimezone
+	}
+
+	if cfg.DailyResetTime != nil {
+		dailyCfg.ResetTime = *cfg.DailyResetTime
+	}
+
+	if cfg.DegreeDayBase != nil {
+		dailyCfg.BaseTemperature = *cfg.DegreeDayBase
+	}
+
+	return dailyCfg
+}
+
+// filterConfig converts the ExporterConfig into the filter runtime Tracker Config.
+func (e *Exporter) filterConfig(cfg *ExporterConfig) filter.Config {
+	filterCfg := filter.Config{
+		Logger: e.logger,
+		Path:   *cfg.FilterStateFile,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.StateFlushInterval != nil {
+		filterCfg.FlushInterval = *cfg.StateFlushInterval
+	}
+
+	return filterCfg
+}
+
+// frostConfig converts the ExporterConfig into the frost protection watchdog Config.
+func (e *Exporter) frostConfig(cfg *ExporterConfig) frost.Config {
+	frostCfg := frost.Config{
+		Logger: e.logger,
+		Floor:  *cfg.FrostFloor,
+		Labels: e.metricLabels(cfg),
+	}
+
+	if cfg.FrostSetpoint != nil {
+		frostCfg.Setpoint = *cfg.FrostSetpoint
+	}
+
+	return frostCfg
+}
+
+// isSet returns true if the optional string flag is set and not empty.
+func isSet(value *string) bool {
+	return value != nil && *value != ""
+}
+
+// weatherOptions converts the ExporterConfig into options for the weather collector. The fallback location is given
+// as "latitude,longitude".
+func weatherOptions(cfg *ExporterConfig, logger log.Logger) ([]weather.Option, error) {
+	opts := []weather.Option{
+		weather.WithLogger(logger),
+		weather.WithTimeout(cfg.collectorTimeout("weather")),
+		weather.WithAPIURL(*cfg.WeatherURL),
+		weather.WithTransport(cfg.transport(nil)),
+	}
+
+	if cfg.WeatherUnit != nil {
+		opts = append(opts, weather.WithUnit(*cfg.WeatherUnit))
+	}
+
+	if cfg.WeatherForecastHours != nil && len(*cfg.WeatherForecastHours) > 0 {
+		opts = append(opts, weather.WithForecastURL(*cfg.WeatherForecastURL), weather.WithForecast(*cfg.WeatherForecastHours...))
+	}
+
+	if cfg.WeatherFallbackTokens != nil {
+		opts = append(opts, weather.WithFallbackTokens(*cfg.WeatherFallbackTokens...))
+	}
+
+	if isSet(cfg.WeatherFallbackLocation) {
+		latitude, longitude, err := parseLocation(*cfg.WeatherFallbackLocation, errInvalidWeatherFallbackLocation)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, weather.WithOpenMeteoFallback(*cfg.WeatherFallbackURL, latitude, longitude))
 	}
 
-	return prometheus.Register(weatherCollector)
+	return opts, nil
 }
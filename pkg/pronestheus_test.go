@@ -1,13 +1,30 @@
 package pkg
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/control"
+	"pronestheus/pkg/leader"
+	"pronestheus/pkg/remoteread"
+	"pronestheus/pkg/state"
 	"pronestheus/test"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,10 +48,10 @@ func TestAllMetrics(t *testing.T) {
 
 	assert.Equal(t, w.Code, http.StatusOK)
 	assert.Contains(t, w.Body.String(), "nest_up 1")
-	assert.Contains(t, w.Body.String(), `nest_setpoint_temperature_celsius{id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 19.17838`)
-	assert.Contains(t, w.Body.String(), `nest_ambient_temperature_celsius{id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 20.23999`)
-	assert.Contains(t, w.Body.String(), `nest_humidity_percent{id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 57`)
-	assert.Contains(t, w.Body.String(), `nest_heating{id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 0`)
+	assert.Contains(t, w.Body.String(), `nest_setpoint_temperature_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 19.17838`)
+	assert.Contains(t, w.Body.String(), `nest_ambient_temperature_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 20.23999`)
+	assert.Contains(t, w.Body.String(), `nest_humidity_percent{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 57`)
+	assert.Contains(t, w.Body.String(), `nest_heating{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 0`)
 	assert.Contains(t, w.Body.String(), "nest_weather_up 1")
 	assert.Contains(t, w.Body.String(), "nest_weather_temperature_celsius 20.26")
 	assert.Contains(t, w.Body.String(), "nest_weather_humidity_percent 88")
@@ -88,25 +105,540 @@ func TestFailedScraping(t *testing.T) {
 	assert.NotContains(t, w.Body.String(), "nest_weather_up 1")
 }
 
+func TestSimulation(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	simulate := true
+	thermostats := 2
+	period := time.Hour
+	failureRate := 0.0
+
+	cfg := testConfig()
+	cfg.Simulate = &simulate
+	cfg.SimulateThermostats = &thermostats
+	cfg.SimulatePeriod = &period
+	cfg.SimulateFailureRate = &failureRate
+	location := "52.37,4.89"
+	cfg.SolarLocation = &location
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	promhttp.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Contains(t, w.Body.String(), "nest_up 1")
+	assert.Contains(t, w.Body.String(), `nest_heating{device_id="THERMOSTAT_2",id="enterprises/SIMULATED/devices/THERMOSTAT_2",label="Thermostat-2"}`)
+	assert.Contains(t, w.Body.String(), "nest_weather_up 1")
+	assert.Contains(t, w.Body.String(), "nest_solar_up 1")
+}
+
+func TestSandbox(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	empty := ""
+	sandbox := "sandbox"
+
+	cfg := testConfig()
+	cfg.NestEnvironment = &sandbox
+	cfg.NestRefreshToken = &empty
+	assert.NoError(t, cfg.Validate())
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	promhttp.Handler().ServeHTTP(w, req)
+
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Contains(t, w.Body.String(), "nest_up 1")
+	assert.Contains(t, w.Body.String(), `nest_heating{device_id="THERMOSTAT_1",id="enterprises/SANDBOX/devices/THERMOSTAT_1",label="Living-Room"} 1`)
+	assert.Contains(t, w.Body.String(), "nest_home_thermostats 2")
+	assert.Contains(t, w.Body.String(), "nest_weather_temperature_celsius 11.3")
+}
+
+func TestSelfMetrics(t *testing.T) {
+	tests := []struct {
+		name            string
+		disableExporter bool
+		disableGo       bool
+		wantSeen        []string
+		wantMiss        []string
+	}{
+		{
+			name:     "all metrics",
+			wantSeen: []string{"go_goroutines", "process_start_time_seconds", "promhttp_metric_handler_requests_total", `pronestheus_collector_duration_seconds{collector="nest"}`},
+		}, {
+			name:      "no go metrics",
+			disableGo: true,
+			wantSeen:  []string{"process_start_time_seconds", "pronestheus_collector_duration_seconds"},
+			wantMiss:  []string{"go_goroutines"},
+		}, {
+			name:            "no exporter metrics",
+			disableExporter: true,
+			wantSeen:        []string{"go_goroutines"},
+			wantMiss:        []string{"process_start_time_seconds", "promhttp_metric_handler_requests_total", "pronestheus_collector_duration_seconds"},
+		}, {
+			name:            "thermostat metrics only",
+			disableExporter: true,
+			disableGo:       true,
+			wantMiss:        []string{"go_", "process_", "promhttp_", "pronestheus_"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Cleanup(resetRegistry)
+
+			// Mimic the default registry of the Prometheus client.
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+			prometheus.DefaultRegisterer = reg
+			prometheus.DefaultGatherer = reg
+
+			cfg := testConfig()
+			cfg.DisableExporterMetrics = &test.disableExporter
+			cfg.DisableGoMetrics = &test.disableGo
+
+			e, err := NewExporter(cfg)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, w.Code, http.StatusOK)
+			assert.Contains(t, w.Body.String(), "nest_up")
+			for _, metric := range test.wantSeen {
+				assert.Contains(t, w.Body.String(), metric)
+			}
+			for _, metric := range test.wantMiss {
+				assert.NotContains(t, w.Body.String(), "\n"+metric)
+			}
+		})
+	}
+}
+
+func TestMetricsMaxSeries(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	defer nestServ.Close()
+
+	// The mode is exported with a series per mode.
+	maxSeries, truncate := 2, true
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.MetricsMaxSeries = &maxSeries
+	cfg.MetricsTruncateSeries = &truncate
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, w.Body.String(), `pronestheus_series_over_limit{family="nest_thermostat_mode"} 3`)
+	assert.Contains(t, w.Body.String(), `nest_thermostat_mode{device_id="_overflow",id="_overflow",label="_overflow",mode="_overflow"} 1`)
+	assert.NotContains(t, w.Body.String(), `mode="OFF"`)
+}
+
+func TestMetricsMapping(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	defer nestServ.Close()
+
+	rename, drop := map[string]string{"nest_up": "home_nest_up"}, []string{"nest_thermostat_mode*"}
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.MetricsRename = &rename
+	cfg.MetricsDrop = &drop
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, w.Body.String(), "\nhome_nest_up 1")
+	assert.NotContains(t, w.Body.String(), "\nnest_up ")
+	assert.NotContains(t, w.Body.String(), "nest_thermostat_mode")
+}
+
+func TestMetricsIDLabel(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	defer nestServ.Close()
+
+	policy := "short"
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.MetricsIDLabel = &policy
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, w.Body.String(), `nest_humidity_ratio{device_id="DEVICE_ID",id="DEVICE_ID",label="Custom-Name"}`)
+	assert.NotContains(t, w.Body.String(), "enterprises/PROJECT_ID/devices")
+
+	w = httptest.NewRecorder()
+	e.api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/thermostats", nil))
+
+	assert.Contains(t, w.Body.String(), `"id":"DEVICE_ID"`)
+	assert.NotContains(t, w.Body.String(), "enterprises/PROJECT_ID/devices")
+}
+
+func TestMetricsIDLabelNone(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	defer nestServ.Close()
+
+	policy := "none"
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.MetricsIDLabel = &policy
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, w.Body.String(), `nest_humidity_ratio{device_id="DEVICE_ID",label="Custom-Name"}`)
+	assert.NotContains(t, w.Body.String(), `,id="`)
+	assert.NotContains(t, w.Body.String(), `{id="`)
+
+	w = httptest.NewRecorder()
+	e.api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/thermostats", nil))
+
+	assert.Contains(t, w.Body.String(), `"id":"enterprises/PROJECT_ID/devices/DEVICE_ID"`)
+}
+
+func TestMetricsCompat(t *testing.T) {
+	tests := []struct {
+		compat   string
+		wantSeen []string
+		wantMiss []string
+	}{
+		{compat: "legacy", wantSeen: []string{"nest_humidity_percent", "nest_humidity_min_today_percent"}, wantMiss: []string{"nest_humidity_ratio", "nest_humidity_min_today_ratio"}},
+		{compat: "both", wantSeen: []string{"nest_humidity_percent", "nest_humidity_ratio", "nest_humidity_min_today_percent", "nest_humidity_min_today_ratio"}},
+		{compat: "new", wantSeen: []string{"nest_humidity_ratio", "nest_humidity_min_today_ratio"}, wantMiss: []string{"nest_humidity_percent", "nest_humidity_min_today_percent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compat, func(t *testing.T) {
+			t.Cleanup(resetRegistry)
+
+			nestServ := test.NestServer()
+			defer nestServ.Close()
+
+			cfg := testConfig()
+			cfg.NestURL = &nestServ.URL
+			cfg.MetricsCompat = &tt.compat
+			dailyMetrics := true
+			cfg.DailyMetrics = &dailyMetrics
+
+			e, err := NewExporter(cfg)
+			assert.NoError(t, err)
+
+			// The daily extremes are exported from the readings of the previous scrape.
+			e.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			w := httptest.NewRecorder()
+			e.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			for _, metric := range tt.wantSeen {
+				assert.Contains(t, w.Body.String(), "\n"+metric+"{")
+			}
+			for _, metric := range tt.wantMiss {
+				assert.NotContains(t, w.Body.String(), "\n"+metric)
+			}
+		})
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	ready := make(chan struct{})
+	acked := make(chan struct{})
+	var pulled int32
+
+	event := base64.StdEncoding.EncodeToString([]byte(`{
+		"timestamp": "2030-01-02T03:04:05Z",
+		"resourceUpdate": {
+			"name": "enterprises/PROJECT_ID/devices/DEVICE_ID",
+			"traits": {"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 22.5}}
+		}
+	}`))
+
+	pubsubServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/PROJECT/subscriptions/SUB:pull":
+			select {
+			case <-ready:
+				if atomic.AddInt32(&pulled, 1) == 1 {
+					w.Write([]byte(`{"receivedMessages":[{"ackId":"ACK","message":{"data":"` + event + `"}}]}`))
+					return
+				}
+			default:
+			}
+			w.Write([]byte(`{}`))
+		case "/projects/PROJECT/subscriptions/SUB:acknowledge":
+			w.Write([]byte(`{}`))
+			close(acked)
+		}
+	}))
+	defer pubsubServ.Close()
+
+	subscription := "projects/PROJECT/subscriptions/SUB"
+	resync := time.Hour
+	timestamps := true
+
+	nestServ := test.NestServer()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.PubSubSubscription = &subscription
+	cfg.PubSubURL = &pubsubServ.URL
+	cfg.PubSubToken = test.ValidToken()
+	cfg.PubSubResyncInterval = &resync
+	cfg.PubSubTimestamps = &timestamps
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Body.String()
+	}
+
+	// Events are only applied to thermostats already known from the API.
+	assert.Contains(t, scrape(), `label="Custom-Name"} 20.23999`)
+
+	close(ready)
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not received")
+	}
+
+	metrics := scrape()
+	assert.Contains(t, metrics, `nest_ambient_temperature_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 22.5 1893553445000`)
+	assert.Contains(t, metrics, `nest_events_received_total{type="resource_update"} 1`)
+	assert.Contains(t, metrics, "nest_pubsub_messages_received_total 1")
+}
+
+func TestCollectInterval(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	var calls int32
+	nestServ := test.NestServerWithCounter(&calls)
+	interval := time.Hour
+	weatherToken := ""
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherToken = &weatherToken
+	cfg.CollectInterval = &interval
+
+	exporter, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer exporter.Shutdown(context.Background())
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		promhttp.Handler().ServeHTTP(w, req)
+
+		assert.Contains(t, w.Body.String(), "nest_up 1")
+	}
+
+	// Scrapes are served from the snapshot collected when the exporter was created.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHistory(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	nestServ := test.NestServer()
+	historyFile := filepath.Join(dir, "history.db")
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.HistoryFile = &historyFile
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	e.routes["/api/history"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?device=DEVICE_ID", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"label":"Custom Name","ambient_temperature_celsius":20.23999`)
+
+	// An empty snappy-compressed ReadRequest.
+	w = httptest.NewRecorder()
+	e.routes[remoteread.Path].ServeHTTP(w, httptest.NewRequest(http.MethodPost, remoteread.Path, strings.NewReader("\x00")))
+	assert.Equal(t, http.StatusOK, w.Code, "the remote read API is served with the history")
+}
+
+func TestJSONAPI(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	weatherServ := test.WeatherServerMetric()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	e.routes["/api/v1/thermostats"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/thermostats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"device_id":"DEVICE_ID","label":"Custom Name","room":"Living Room","ambient_temperature_celsius":20.23999`)
+
+	w = httptest.NewRecorder()
+	e.routes["/api/v1/weather"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/weather", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"temperature_celsius":20.26`)
+}
+
+func TestControl(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	token := "secret"
+	cfg.AdminToken = &token
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, control.Path, strings.NewReader(`{"device":"Custom-Name","mode":"HEAT","setpoint_celsius":20.5}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	e.routes[control.Path].ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"enterprises/PROJECT_ID/devices/DEVICE_ID","device_id":"DEVICE_ID","label":"Custom Name","applied":["mode HEAT","setpoint 20.5°C"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, control.HoldsPath, strings.NewReader(`{"device":"DEVICE_ID","eco_mode":"MANUAL_ECO","from":"2020-01-01T00:00","to":"2099-01-01T00:00"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	e.routes[control.HoldsPath].ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":true`)
+}
+
+func TestStateSnapshot(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	token := "secret"
+	cfg.AdminToken = &token
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, state.Path, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	e.routes[state.Path].ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	snapshot := w.Body.String()
+	assert.Contains(t, snapshot, `"label": "Custom Name"`)
+
+	// The snapshot is restored in another exporter.
+	resetRegistry()
+	restored, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, state.Path, strings.NewReader(snapshot))
+	req.Header.Set("Authorization", "Bearer secret")
+	restored.routes[state.Path].ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "Custom Name", nestController{restored.nest}.current().Readings()[0].Label)
+}
+
+func TestInvalidControlHold(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	cfg := testConfig()
+	holds := []string{"DEVICE_ID@fri 18:00 to sun 15:00 warm"}
+	cfg.ControlHolds = &holds
+
+	_, err := NewExporter(cfg)
+	assert.Error(t, err)
+}
+
+func TestInvalidBot(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	cfg := testConfig()
+	key := "invalid"
+	cfg.BotDiscordPublicKey = &key
+	chats := []string{"42"}
+
+	_, err := NewExporter(cfg)
+	assert.Error(t, err, "no allowed chats")
+
+	resetRegistry()
+	cfg.BotAllowedChats = &chats
+	_, err = NewExporter(cfg)
+	assert.Error(t, err, "invalid public key")
+}
+
 func testConfig() *ExporterConfig {
 	listenAddr := ":9999"
 	metricsPath := "/metrics"
 	timeout := 5000
 	// Using dummy value to avoid nil-reference errors when creating test collectors.
 	dummy := "dummy"
+	dummyURL := "https://example.com"
 
 	return &ExporterConfig{
 		ListenAddr:            &listenAddr,
 		MetricsPath:           &metricsPath,
 		Timeout:               &timeout,
-		NestURL:               &dummy,
+		NestURL:               &dummyURL,
 		NestOAuthClientID:     &dummy,
 		NestOAuthClientSecret: &dummy,
 		NestProjectID:         &dummy,
 		NestRefreshToken:      &dummy,
 		NestOAuthToken:        test.ValidToken(),
 		WeatherLocation:       &dummy,
-		WeatherURL:            &dummy,
+		WeatherURL:            &dummyURL,
 		WeatherToken:          &dummy,
 	}
 }
@@ -118,3 +650,565 @@ func resetRegistry() {
 	prometheus.DefaultRegisterer = reg
 	prometheus.DefaultGatherer = reg
 }
+
+func TestInvalidAlertRule(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	rules := []string{"ambient_temperature_celsius below 5"}
+	ntfyURL := "https://ntfy.sh/nest"
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.AlertRules = &rules
+	cfg.AlertNtfyURL = &ntfyURL
+
+	_, err := NewExporter(cfg)
+	assert.Error(t, err)
+}
+
+func TestProbe(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "filesd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	nestServ := test.NestServer()
+	fileSDOutput := filepath.Join(dir, "nest.json")
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.FileSDOutput = &fileSDOutput
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.routes["/probe"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/probe?target=DEVICE_ID", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `nest_ambient_temperature_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 20.23999`)
+	assert.NotContains(t, w.Body.String(), "nest_up")
+
+	data, err := ioutil.ReadFile(fileSDOutput)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"targets": [
+      "DEVICE_ID"
+    ]`)
+}
+
+func TestReload(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte("nest-alias: {}"), 0644))
+
+	nestServ := test.NestServer()
+	weatherServ := test.WeatherServerMetric()
+	weatherToken := ""
+	interval := 10 * time.Millisecond
+	aliases := map[string]string{}
+	reloaded := make(chan struct{}, 1)
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+	cfg.WeatherToken = &weatherToken
+	cfg.NestAliases = &aliases
+	cfg.ConfigFiles = &[]string{configFile}
+	cfg.ConfigReloadInterval = &interval
+	cfg.ReloadConfig = func() error {
+		aliases["DEVICE_ID"] = "Hall"
+		weatherToken = "token"
+		reloaded <- struct{}{}
+		return nil
+	}
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer e.cancel()
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `label="Custom-Name"`)
+	assert.NotContains(t, w.Body.String(), "nest_weather_up")
+
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte("nest-alias: {DEVICE_ID: Hall}"), 0644))
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("configuration wasn't reloaded")
+	}
+
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return strings.Contains(w.Body.String(), `label="Hall"`) &&
+			strings.Contains(w.Body.String(), "nest_weather_up 1") &&
+			strings.Contains(w.Body.String(), "pronestheus_config_last_reload_successful 1")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	empty := ""
+	cfg.NestProjectID = &empty
+	assert.Error(t, e.reload(cfg))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), "nest_up 1", "collectors are kept if the config is invalid")
+}
+
+func TestLeaderElection(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "leader")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lockFile := filepath.Join(dir, "leader.lock")
+	other := leader.NewFileLock(lockFile, "other-replica")
+	acquired, err := other.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	var pushes int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&pushes, 1)
+			conn.Close()
+		}
+	}()
+
+	nestServ := test.NestServer()
+	method := "file"
+	identity := "replica-1"
+	lease := 30 * time.Millisecond
+	graphiteAddress := listener.Addr().String()
+	graphiteInterval := 10 * time.Millisecond
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.LeaderElection = &method
+	cfg.LeaderElectionLock = &lockFile
+	cfg.LeaderElectionID = &identity
+	cfg.LeaderElectionLease = &lease
+	cfg.GraphiteAddress = &graphiteAddress
+	cfg.GraphiteInterval = &graphiteInterval
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer e.cancel()
+
+	// Readings are collected by all replicas, but only the leader pushes them.
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, e.elector.IsLeader())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&pushes))
+
+	assert.NoError(t, other.Release(context.Background()))
+	assert.Eventually(t, func() bool {
+		return e.elector.IsLeader() && atomic.LoadInt32(&pushes) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), "pronestheus_leader 1")
+}
+
+func TestLeaderListener(t *testing.T) {
+	var calls int
+	listener := func([]*nest.Thermostat) { calls++ }
+
+	e := &Exporter{}
+	e.leaderListener(listener)(nil)
+	assert.Equal(t, 1, calls, "readings are passed on without leader election")
+
+	elector, err := leader.New(leader.Config{Lock: leader.NewFileLock(filepath.Join(t.TempDir(), "leader.lock"), "replica-1")})
+	assert.NoError(t, err)
+
+	e.elector = elector
+	e.leaderListener(listener)(nil)
+	assert.Equal(t, 1, calls, "followers drop readings")
+}
+
+func TestInvalidLeaderElection(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	method := "etcd"
+	cfg := testConfig()
+	cfg.LeaderElection = &method
+
+	_, err := NewExporter(cfg)
+	assert.Error(t, err)
+}
+
+func TestGRPCAPI(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	addr := "127.0.0.1:0"
+	cfg := testConfig()
+	cfg.GRPCListenAddr = &addr
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	resetRegistry()
+	addr = "invalid:address:9779"
+	_, err = NewExporter(cfg)
+	assert.Error(t, err)
+}
+
+func TestInvalidSolarLocation(t *testing.T) {
+	for _, location := range []string{"52.37", "north,4.89", "52.37,east", "91,4.89"} {
+		resetRegistry()
+
+		cfg := testConfig()
+		cfg.SolarURL = cfg.WeatherURL
+		cfg.SolarLocation = &location
+
+		_, err := NewExporter(cfg)
+		assert.Error(t, err, location)
+	}
+	resetRegistry()
+}
+
+func TestInvalidWeatherFallbackLocation(t *testing.T) {
+	for _, location := range []string{"52.37", "north,4.89", "91,4.89"} {
+		resetRegistry()
+
+		cfg := testConfig()
+		cfg.WeatherFallbackURL = cfg.WeatherURL
+		cfg.WeatherFallbackLocation = &location
+
+		_, err := NewExporter(cfg)
+		assert.Error(t, err, location)
+	}
+	resetRegistry()
+}
+
+func TestBalancePoint(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	weatherServ := test.WeatherServerMetric()
+	window := 24 * time.Hour
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+	cfg.BalancePointWindow = &window
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	// Collectors run concurrently, so the outside temperature is only known after the first scrape.
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Contains(t, w.Body.String(), `nest_temperature_differential_celsius{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} -0.02`)
+	assert.Contains(t, w.Body.String(), `nest_balance_point_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"}`)
+}
+
+func TestFilterRuntime(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "filter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	nestServ := test.NestServer()
+	stateFile := filepath.Join(dir, "filter.json")
+
+	token := "secret"
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.FilterStateFile = &stateFile
+	cfg.AdminToken = &token
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	// Collectors run concurrently, so thermostats are only known after the first scrape.
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `nest_filter_runtime_hours{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 0`)
+
+	w = httptest.NewRecorder()
+	e.routes["/-/filter/reset"].ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/-/filter/reset?device=DEVICE_ID", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/-/filter/reset?device=DEVICE_ID", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	e.routes["/-/filter/reset"].ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, err = os.Stat(stateFile)
+	assert.NoError(t, err)
+}
+
+func TestComfort(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	enabled := true
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.Comfort = &enabled
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	// Collectors run concurrently, so thermostats are only known after the first scrape.
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `nest_comfort_pmv{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"}`)
+	assert.Contains(t, w.Body.String(), `nest_comfort_ppd_percent{device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"}`)
+}
+
+func TestDailyMetrics(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	enabled := true
+	timezone := "Europe/Berlin"
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.DailyMetrics = &enabled
+	cfg.HomeTimezone = &timezone
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	// Collectors run concurrently, so thermostats are only known after the first scrape.
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `nest_hvac_runtime_seconds_total{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"}`)
+	assert.Contains(t, w.Body.String(), `nest_hvac_runtime_today_seconds{action="heating",device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"}`)
+
+	resetRegistry()
+	timezone = "Europe/Nowhere"
+	_, err = NewExporter(cfg)
+	assert.Error(t, err)
+}
+
+func TestStateFile(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	nestServ := test.NestServer()
+	stateFile := filepath.Join(dir, "state.json")
+	saved := `{"nest": {"thermostats": {"enterprises/PROJECT_ID/devices/DEVICE_ID": {"setpoint_changes": {"up": 5, "down": 2}}}},
+		"daily": {"degree_days_celsius": {"heating": {"total": 12.5}}}}`
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte(saved), 0644))
+
+	dailyMetrics := true
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.StateFile = &stateFile
+	cfg.DailyMetrics = &dailyMetrics
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `nest_setpoint_changes_total{device_id="DEVICE_ID",direction="up",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Custom-Name"} 5`)
+
+	assert.NoError(t, e.Shutdown(context.Background()))
+
+	data, err := ioutil.ReadFile(stateFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"mode_durations_seconds": {`, "the state is saved on shutdown")
+	assert.Contains(t, string(data), `"total": 12.5`, "the daily runtimes and degree days are restored and saved")
+}
+
+func TestRunContext(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	listenAddr := "127.0.0.1:0"
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.StateFile = &stateFile
+	cfg.ListenAddr = &listenAddr
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.RunContext(ctx)
+	}()
+
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	_, err = os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+	cancel()
+
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the exporter didn't stop")
+	}
+
+	data, err := ioutil.ReadFile(stateFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"nest":`, "the state is saved when the context is cancelled")
+}
+
+func TestDebugServer(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	remote, local := ":0", "127.0.0.1:0"
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.DebugListenAddr = &remote
+
+	_, err := NewExporter(cfg)
+	assert.True(t, errors.Is(err, errRemoteDebugAddr))
+
+	resetRegistry()
+	cfg.DebugListenAddr = &local
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer e.Shutdown(context.Background())
+
+	assert.Contains(t, expvar.Get("pronestheus").String(), `"routes":["/api/v1/thermostats","/api/v1/weather","/probe","/stream"]`)
+
+	assert.True(t, loopback("localhost:6060"))
+	assert.True(t, loopback("[::1]:6060"))
+	assert.False(t, loopback("0.0.0.0:6060"))
+}
+
+func TestUserAgent(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	userAgents := make(chan string, 2)
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.UserAgent()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serv.Close()
+
+	product, contact := "pronestheus/1.2.0", "admin@example.com"
+
+	cfg := testConfig()
+	cfg.NestURL = &serv.URL
+	cfg.WeatherURL = &serv.URL
+	cfg.UserAgent = &product
+	cfg.UserAgentContact = &contact
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "pronestheus/1.2.0 (admin@example.com)", <-userAgents)
+	assert.Equal(t, "pronestheus/1.2.0 (admin@example.com)", <-userAgents)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	var requests int32
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer serv.Close()
+
+	failures := 1
+	cfg := testConfig()
+	cfg.NestURL = &serv.URL
+	cfg.WeatherURL = &serv.URL
+	cfg.BreakerFailures = &failures
+
+	_, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		promhttp.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "APIs are skipped after the breakers open")
+
+	expected := `
+# HELP pronestheus_circuit_breaker_state State of the circuit breaker of the API: 0 closed, 1 open, 2 half-open.
+# TYPE pronestheus_circuit_breaker_state gauge
+pronestheus_circuit_breaker_state{api="nest"} 1
+pronestheus_circuit_breaker_state{api="weather"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected), "pronestheus_circuit_breaker_state"))
+}
+
+func TestStation(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	nestServ := test.NestServer()
+	enabled, empty := true, ""
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherToken = &empty
+	cfg.Station = &enabled
+
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	e.routes["/data/report/"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/report/?tempf=50&humidity=81", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	e.routes["/api/v1/weather"].ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/weather", nil))
+	assert.Contains(t, w.Body.String(), `"temperature_celsius":10`, "station readings replace OpenWeatherMap readings")
+
+	expected := `
+# HELP nest_station_temperature_celsius Outside temperature measured by the weather station.
+# TYPE nest_station_temperature_celsius gauge
+nest_station_temperature_celsius 10
+`
+	assert.NoError(t, testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected), "nest_station_temperature_celsius"))
+}
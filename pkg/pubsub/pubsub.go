@@ -0,0 +1,278 @@
+// Package pubsub receives messages from a Google Cloud Pub/Sub subscription using the REST API pull method.
+//
+// Device Access publishes device events, eg. temperature changes, to a Pub/Sub topic. Subscribing to it lets
+// the exporter receive readings as soon as they change, without polling the Nest API.
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+// DefaultAPIURL is the URL of the Google Cloud Pub/Sub API.
+const DefaultAPIURL = "https://pubsub.googleapis.com/v1/"
+
+// Scope is the OAuth2 scope required to pull messages from a subscription.
+const Scope = "https://www.googleapis.com/auth/pubsub"
+
+// idleDelay is the time to wait before pulling again when the previous pull returned no messages.
+const idleDelay = time.Second
+
+var (
+	errNon200Response      = errors.New("pub/Sub API responded with non-200 code")
+	errFailedParsingURL    = errors.New("failed parsing Pub/Sub API URL")
+	errInvalidSubscription = errors.New("invalid subscription name; expected projects/PROJECT/subscriptions/SUBSCRIPTION")
+	errFailedRequest       = errors.New("failed Pub/Sub API request")
+	errFailedReadingBody   = errors.New("failed reading Pub/Sub API response body")
+)
+
+// Handler processes the data of a received message. Messages are acknowledged no matter if the handler succeeds,
+// because redelivering a message which can't be processed doesn't help.
+type Handler func(data []byte) error
+
+// Config provides the configuration necessary to create the Subscriber.
+// Logger is optional, if it's nil the Subscriber doesn't log anything.
+// Client must authenticate requests with the Pub/Sub scope, eg. created with google.DefaultClient.
+type Config struct {
+	Logger       log.Logger
+	Client       *http.Client
+	APIURL       string
+	Subscription string
+	MaxMessages  int
+	RetryDelay   time.Duration
+}
+
+// Subscriber pulls messages from a Pub/Sub subscription. It implements prometheus.Collector, exporting metrics about
+// the health of the subscription.
+type Subscriber struct {
+	client      *http.Client
+	url         string
+	logger      log.Logger
+	maxMessages int
+	retryDelay  time.Duration
+	now         func() time.Time
+
+	mu              sync.Mutex
+	received        float64
+	unparseable     float64
+	age             float64
+	requestFailures map[string]float64
+
+	receivedDesc        *prometheus.Desc
+	unparseableDesc     *prometheus.Desc
+	ageDesc             *prometheus.Desc
+	requestFailuresDesc *prometheus.Desc
+	ackLatency          prometheus.Histogram
+}
+
+// New creates a Subscriber using the given Config.
+func New(cfg Config) (*Subscriber, error) {
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+
+	if _, err := url.ParseRequestURI(cfg.APIURL); err != nil {
+		return nil, errors.Wrap(errFailedParsingURL, err.Error())
+	}
+
+	parts := strings.Split(cfg.Subscription, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "subscriptions" || parts[1] == "" || parts[3] == "" {
+		return nil, errInvalidSubscription
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+
+	if cfg.MaxMessages <= 0 {
+		cfg.MaxMessages = 100
+	}
+
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 10 * time.Second
+	}
+
+	return &Subscriber{
+		client:      cfg.Client,
+		url:         strings.TrimRight(cfg.APIURL, "/") + "/" + cfg.Subscription,
+		logger:      cfg.Logger,
+		maxMessages: cfg.MaxMessages,
+		retryDelay:  cfg.RetryDelay,
+		now:         time.Now,
+
+		requestFailures: map[string]float64{"pull": 0, "acknowledge": 0},
+
+		receivedDesc:        prometheus.NewDesc("nest_pubsub_messages_received_total", "Number of messages pulled from the Pub/Sub subscription.", nil, nil),
+		unparseableDesc:     prometheus.NewDesc("nest_pubsub_messages_unparseable_total", "Number of pulled messages whose data couldn't be decoded or handled.", nil, nil),
+		ageDesc:             prometheus.NewDesc("nest_pubsub_message_age_seconds", "Age of the oldest message in the latest pull, 0 if it returned no messages. Grows while the subscription has a backlog.", nil, nil),
+		requestFailuresDesc: prometheus.NewDesc("nest_pubsub_request_failures_total", "Number of failed Pub/Sub API requests by method.", []string{"method"}, nil),
+		ackLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nest_pubsub_ack_latency_seconds",
+			Help:    "Time from pulling messages until they're acknowledged, including handling them.",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}),
+	}, nil
+}
+
+// Run pulls messages and passes them to the handler until the context is cancelled.
+// Failed requests are retried after the retry delay.
+func (s *Subscriber) Run(ctx context.Context, handler Handler) {
+	for ctx.Err() == nil {
+		received, err := s.Pull(ctx, handler)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Log("level", "error", "message", "Failed pulling Pub/Sub messages", "stack", errors.WithStack(err))
+		}
+
+		// The API holds pull requests until messages are available, but it may also return nothing after a timeout.
+		delay := time.Duration(0)
+		if err != nil {
+			delay = s.retryDelay
+		} else if received == 0 {
+			delay = idleDelay
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Pull pulls a single batch of messages, passes them to the handler and acknowledges them.
+// It returns the number of received messages.
+func (s *Subscriber) Pull(ctx context.Context, handler Handler) (int, error) {
+	body, err := s.call(ctx, "pull", map[string]interface{}{"maxMessages": s.maxMessages})
+	if err != nil {
+		return 0, err
+	}
+	pulled := s.now()
+
+	var (
+		ackIDs      []string
+		unparseable int
+		oldest      time.Time
+	)
+	gjson.GetBytes(body, "receivedMessages").ForEach(func(_, received gjson.Result) bool {
+		ackIDs = append(ackIDs, received.Get("ackId").String())
+
+		if published, err := time.Parse(time.RFC3339Nano, received.Get("message.publishTime").String()); err == nil {
+			if oldest.IsZero() || published.Before(oldest) {
+				oldest = published
+			}
+		}
+
+		data, err := base64.StdEncoding.DecodeString(received.Get("message.data").String())
+		if err == nil {
+			err = handler(data)
+		}
+
+		if err != nil {
+			unparseable++
+			s.logger.Log("level", "warn", "message", "Failed handling Pub/Sub message", "id", received.Get("message.messageId").String(), "err", err)
+		}
+		return true
+	})
+
+	s.mu.Lock()
+	s.received += float64(len(ackIDs))
+	s.unparseable += float64(unparseable)
+	s.age = 0
+	if !oldest.IsZero() && pulled.After(oldest) {
+		s.age = pulled.Sub(oldest).Seconds()
+	}
+	s.mu.Unlock()
+
+	if len(ackIDs) == 0 {
+		return 0, nil
+	}
+
+	if _, err = s.call(ctx, "acknowledge", map[string]interface{}{"ackIds": ackIDs}); err != nil {
+		return len(ackIDs), err
+	}
+	s.ackLatency.Observe(s.now().Sub(pulled).Seconds())
+	return len(ackIDs), nil
+}
+
+// call calls the method of the subscription and returns the response body. Failed calls are counted by method.
+func (s *Subscriber) call(ctx context.Context, method string, payload interface{}) ([]byte, error) {
+	body, err := s.request(ctx, method, payload)
+	if err != nil && ctx.Err() == nil {
+		s.mu.Lock()
+		s.requestFailures[method]++
+		s.mu.Unlock()
+	}
+	return body, err
+}
+
+// request sends the request calling the method of the subscription.
+func (s *Subscriber) request(ctx context.Context, method string, payload interface{}) ([]byte, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+":"+method, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(errFailedRequest, err.Error())
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, errors.Wrap(errNon200Response, fmt.Sprintf("code: %d", res.StatusCode))
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrap(errFailedReadingBody, err.Error())
+	}
+
+	return body, nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *Subscriber) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.receivedDesc
+	ch <- s.unparseableDesc
+	ch <- s.ageDesc
+	ch <- s.requestFailuresDesc
+	s.ackLatency.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *Subscriber) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(s.receivedDesc, prometheus.CounterValue, s.received)
+	ch <- prometheus.MustNewConstMetric(s.unparseableDesc, prometheus.CounterValue, s.unparseable)
+	ch <- prometheus.MustNewConstMetric(s.ageDesc, prometheus.GaugeValue, s.age)
+	for method, failures := range s.requestFailures {
+		ch <- prometheus.MustNewConstMetric(s.requestFailuresDesc, prometheus.CounterValue, failures, method)
+	}
+	s.ackLatency.Collect(ch)
+}
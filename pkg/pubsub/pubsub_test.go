@@ -0,0 +1,123 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestPull(t *testing.T) {
+	var acked []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/PROJECT/subscriptions/SUB:pull":
+			w.Write([]byte(`{"receivedMessages":[
+				{"ackId":"ACK_1","message":{"messageId":"1","publishTime":"2030-01-02T03:03:00Z","data":"` + base64.StdEncoding.EncodeToString([]byte(`{"eventId":"1"}`)) + `"}},
+				{"ackId":"ACK_2","message":{"messageId":"2","publishTime":"2030-01-02T03:03:30.5Z","data":"not base64!"}}
+			]}`))
+		case "/projects/PROJECT/subscriptions/SUB:acknowledge":
+			body, _ := ioutil.ReadAll(r.Body)
+			gjson.GetBytes(body, "ackIds").ForEach(func(_, id gjson.Result) bool {
+				acked = append(acked, id.String())
+				return true
+			})
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s, err := New(Config{APIURL: server.URL, Subscription: "projects/PROJECT/subscriptions/SUB"})
+	assert.NoError(t, err)
+	s.now = func() time.Time { return time.Date(2030, 1, 2, 3, 4, 30, 0, time.UTC) }
+
+	var received []string
+	n, err := s.Pull(context.Background(), func(data []byte) error {
+		received = append(received, string(data))
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{`{"eventId":"1"}`}, received)
+	// Messages which can't be handled are acknowledged too, redelivering them wouldn't help.
+	assert.Equal(t, []string{"ACK_1", "ACK_2"}, acked)
+
+	want := `
+# HELP nest_pubsub_message_age_seconds Age of the oldest message in the latest pull, 0 if it returned no messages. Grows while the subscription has a backlog.
+# TYPE nest_pubsub_message_age_seconds gauge
+nest_pubsub_message_age_seconds 90
+# HELP nest_pubsub_messages_received_total Number of messages pulled from the Pub/Sub subscription.
+# TYPE nest_pubsub_messages_received_total counter
+nest_pubsub_messages_received_total 2
+# HELP nest_pubsub_messages_unparseable_total Number of pulled messages whose data couldn't be decoded or handled.
+# TYPE nest_pubsub_messages_unparseable_total counter
+nest_pubsub_messages_unparseable_total 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(s, strings.NewReader(want),
+		"nest_pubsub_message_age_seconds", "nest_pubsub_messages_received_total", "nest_pubsub_messages_unparseable_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(s, "nest_pubsub_ack_latency_seconds"))
+}
+
+func TestPullFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	s, err := New(Config{APIURL: server.URL, Subscription: "projects/PROJECT/subscriptions/SUB"})
+	assert.NoError(t, err)
+
+	_, err = s.Pull(context.Background(), func(data []byte) error { return nil })
+	assert.True(t, errors.Is(err, errNon200Response))
+
+	want := `
+# HELP nest_pubsub_request_failures_total Number of failed Pub/Sub API requests by method.
+# TYPE nest_pubsub_request_failures_total counter
+nest_pubsub_request_failures_total{method="acknowledge"} 0
+nest_pubsub_request_failures_total{method="pull"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(s, strings.NewReader(want), "nest_pubsub_request_failures_total"))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{
+			name:    "missing subscription",
+			cfg:     Config{},
+			wantErr: errInvalidSubscription,
+		}, {
+			name:    "subscription without project",
+			cfg:     Config{Subscription: "subscriptions/SUB"},
+			wantErr: errInvalidSubscription,
+		}, {
+			name:    "invalid url",
+			cfg:     Config{APIURL: "https/////this.is.not.a.valid.url", Subscription: "projects/PROJECT/subscriptions/SUB"},
+			wantErr: errFailedParsingURL,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.cfg)
+			assert.Nil(t, s)
+			assert.True(t, errors.Is(err, test.wantErr))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeWindow is the number of latest Prometheus scrapes the scrape interval is estimated from. Several Prometheus
+// servers scraping the exporter are observed as one server scraping more often, like the Nest API sees them.
+const scrapeWindow = 10
+
+// quotaHandler observes scrapes of the metrics handler by Prometheus servers, recognized by the
+// X-Prometheus-Scrape-Timeout-Seconds header they send, and estimates the rate of Nest API requests they cause. The
+// ratio of that rate to the Device Access quota is exported as nest_quota_risk; a warning is logged when it's above
+// 1, suggesting to collect in the background or to cache readings instead.
+type quotaHandler struct {
+	handler http.Handler
+	logger  log.Logger
+	quota   float64
+	now     func() time.Time
+
+	// collectInterval is set if the Nest API is called in the background, regardless of scrapes. cacheTTL is set
+	// if scrapes only call the Nest API once the cached readings are older than it.
+	collectInterval time.Duration
+	cacheTTL        time.Duration
+
+	risk     prometheus.Gauge
+	interval prometheus.Gauge
+
+	mu      sync.Mutex
+	scrapes []time.Time
+	warned  bool
+}
+
+// newQuotaHandler creates the observation of scrapes of the metrics handler from the config.
+func newQuotaHandler(cfg *ExporterConfig, handler http.Handler, logger log.Logger) *quotaHandler {
+	h := &quotaHandler{
+		handler: handler,
+		logger:  logger,
+		now:     time.Now,
+		risk: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nest_quota_risk",
+			Help: "Ratio of the Nest API request rate implied by the observed scrape interval to the Device Access quota, over 1 the quota is exceeded.",
+		}),
+		interval: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pronestheus_scrape_interval_seconds",
+			Help: "Mean interval between the latest scrapes by Prometheus servers.",
+		}),
+	}
+
+	if cfg.NestQuota != nil {
+		h.quota = *cfg.NestQuota
+	}
+	if cfg.CollectInterval != nil {
+		h.collectInterval = *cfg.CollectInterval
+	}
+	if cfg.subscribed() && cfg.PubSubResyncInterval != nil {
+		h.cacheTTL = *cfg.PubSubResyncInterval
+	}
+
+	return h
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *quotaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if timeout := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); timeout != "" {
+		if _, err := strconv.ParseFloat(timeout, 64); err == nil {
+			h.observe()
+		}
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// observe records a scrape by a Prometheus server and updates the estimated request rate.
+func (h *quotaHandler) observe() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.scrapes = append(h.scrapes, h.now())
+	if len(h.scrapes) > scrapeWindow {
+		h.scrapes = h.scrapes[len(h.scrapes)-scrapeWindow:]
+	}
+	if len(h.scrapes) < 2 {
+		return
+	}
+
+	interval := h.scrapes[len(h.scrapes)-1].Sub(h.scrapes[0]) / time.Duration(len(h.scrapes)-1)
+	h.interval.Set(interval.Seconds())
+
+	perMinute := h.requestsPerMinute(interval)
+	if h.quota <= 0 || perMinute < 0 {
+		return
+	}
+
+	risk := perMinute / h.quota
+	h.risk.Set(risk)
+
+	if risk > 1 && !h.warned {
+		h.logger.Log("level", "warn", "msg", "Scrapes call the Nest API more often than the Device Access quota allows, set --collect-interval or increase the scrape interval",
+			"scrape_interval", interval, "requests_per_minute", perMinute, "quota", h.quota)
+		h.warned = true
+	} else if risk <= 1 && h.warned {
+		h.logger.Log("level", "info", "msg", "Nest API request rate is within the Device Access quota again", "scrape_interval", interval, "requests_per_minute", perMinute, "quota", h.quota)
+		h.warned = false
+	}
+}
+
+// requestsPerMinute returns the number of Nest API requests per minute caused by scrapes at the given interval. It's
+// negative if the interval is unknown.
+func (h *quotaHandler) requestsPerMinute(interval time.Duration) float64 {
+	if h.collectInterval > 0 {
+		return time.Minute.Seconds() / h.collectInterval.Seconds()
+	}
+	if interval <= 0 {
+		return -1
+	}
+	if interval < h.cacheTTL {
+		interval = h.cacheTTL
+	}
+	return time.Minute.Seconds() / interval.Seconds()
+}
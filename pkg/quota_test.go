@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaHandler(t *testing.T) {
+	var logs bytes.Buffer
+	quota := 10.0
+	h := newQuotaHandler(&ExporterConfig{NestQuota: &quota}, http.NotFoundHandler(), log.NewLogfmtLogger(&logs))
+
+	now := time.Now()
+	h.now = func() time.Time { return now }
+	scrape := func(interval time.Duration, prometheus bool) {
+		now = now.Add(interval)
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if prometheus {
+			req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "10")
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	scrape(0, true)
+	scrape(time.Second, false)
+	scrape(14*time.Second, true)
+	assert.Equal(t, 15.0, testutil.ToFloat64(h.interval), "scrapes by other clients aren't observed")
+	assert.Equal(t, 0.4, testutil.ToFloat64(h.risk))
+	assert.Empty(t, logs.String())
+
+	for i := 0; i < scrapeWindow; i++ {
+		scrape(3*time.Second, true)
+	}
+	assert.Equal(t, 3.0, testutil.ToFloat64(h.interval))
+	assert.Equal(t, 2.0, testutil.ToFloat64(h.risk))
+	assert.Contains(t, logs.String(), "level=warn")
+
+	for i := 0; i < scrapeWindow; i++ {
+		scrape(time.Minute, true)
+	}
+	assert.Equal(t, 0.1, testutil.ToFloat64(h.risk))
+	assert.Contains(t, logs.String(), "level=info")
+}
+
+func TestQuotaHandlerCached(t *testing.T) {
+	quota, subscription, resync, collect := 10.0, "projects/PROJECT/subscriptions/SUBSCRIPTION", time.Minute, time.Duration(0)
+	cfg := &ExporterConfig{NestQuota: &quota, PubSubSubscription: &subscription, PubSubResyncInterval: &resync, CollectInterval: &collect}
+
+	h := newQuotaHandler(cfg, http.NotFoundHandler(), log.NewNopLogger())
+	assert.Equal(t, 1.0, h.requestsPerMinute(time.Second), "scrapes within the cache TTL don't call the API")
+	assert.Equal(t, 0.5, h.requestsPerMinute(2*time.Minute))
+
+	collect = 30 * time.Second
+	h = newQuotaHandler(cfg, http.NotFoundHandler(), log.NewNopLogger())
+	assert.Equal(t, 2.0, h.requestsPerMinute(time.Second), "background collection doesn't depend on scrapes")
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/collectors/weather"
+	"pronestheus/pkg/fixtures"
+)
+
+// Record calls Nest and OpenWeatherMap APIs once and saves their sanitized responses as fixture files in dir.
+// The fixtures can be served with Replay.
+func Record(cfg *ExporterConfig, dir string, out io.Writer) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	nestRecorder := fixtures.NewRecorder(dir, fixtures.NestFile, fixtures.SanitizeNest(), nil)
+	opts := append(nestOptions(cfg, nil), nest.WithTransport(nestRecorder))
+
+	nestCollector, err := nest.New(*cfg.NestProjectID, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := nestCollector.Devices(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Recorded Nest API response into %s\n", fixtures.NestFile)
+
+	if *cfg.WeatherToken == "" {
+		return nil
+	}
+
+	weatherOpts, err := weatherOptions(cfg, nil)
+	if err != nil {
+		return err
+	}
+	weatherOpts = append(weatherOpts, weather.WithTransport(cfg.transport(fixtures.NewRecorder(dir, fixtures.WeatherFile, fixtures.SanitizeWeather(), nil))))
+
+	weatherCollector, err := weather.New(*cfg.WeatherToken, *cfg.WeatherLocation, weatherOpts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := weatherCollector.Weather(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Recorded OpenWeatherMap API response into %s\n", fixtures.WeatherFile)
+
+	return nil
+}
+
+// Replay starts a server mocking Nest and OpenWeatherMap APIs with fixture files from dir, recorded with Record.
+func Replay(addr string, dir string) error {
+	return http.ListenAndServe(addr, fixtures.NewReplayServer(dir))
+}
@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/reload"
+)
+
+// reloadableCollector is a registered collector which can be replaced when the configuration is reloaded. If it's
+// empty, it doesn't collect anything.
+type reloadableCollector struct {
+	mu        sync.RWMutex
+	collector prometheus.Collector
+}
+
+func (r *reloadableCollector) get() prometheus.Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.collector
+}
+
+func (r *reloadableCollector) set(collector prometheus.Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collector = collector
+}
+
+// Describe implements the prometheus.Collector interface.
+func (r *reloadableCollector) Describe(ch chan<- *prometheus.Desc) {
+	if collector := r.get(); collector != nil {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements the prometheus.Collector interface.
+func (r *reloadableCollector) Collect(ch chan<- prometheus.Metric) {
+	if collector := r.get(); collector != nil {
+		collector.Collect(ch)
+	}
+}
+
+// nestController passes commands to the current Nest collector, so the frost protection keeps working after reloads.
+type nestController struct {
+	collector *reloadableCollector
+}
+
+func (c nestController) current() *nest.Collector {
+	return c.collector.get().(*nest.Collector)
+}
+
+func (c nestController) SetEcoMode(ctx context.Context, id, mode string) error {
+	return c.current().SetEcoMode(ctx, id, mode)
+}
+
+func (c nestController) SetMode(ctx context.Context, id, mode string) error {
+	return c.current().SetMode(ctx, id, mode)
+}
+
+func (c nestController) SetHeat(ctx context.Context, id string, celsius float64) error {
+	return c.current().SetHeat(ctx, id, celsius)
+}
+
+func (c nestController) Thermostats(ctx context.Context) ([]*nest.Thermostat, error) {
+	return c.current().Thermostats(ctx)
+}
+
+func (c nestController) MetricLabel(therm *nest.Thermostat) string {
+	return c.current().MetricLabel(therm)
+}
+
+// reloadable returns true if config files should be watched for changes.
+func (cfg *ExporterConfig) reloadable() bool {
+	return cfg.ReloadConfig != nil && cfg.ConfigFiles != nil && len(*cfg.ConfigFiles) > 0 &&
+		cfg.ConfigReloadInterval != nil && *cfg.ConfigReloadInterval > 0
+}
+
+// watchConfig starts checking config files for changes in the background. When they change, the config is re-read
+// and the collectors are reloaded.
+func (e *Exporter) watchConfig(cfg *ExporterConfig) error {
+	watcher, err := reload.New(reload.Config{
+		Logger:   e.logger,
+		Paths:    *cfg.ConfigFiles,
+		Interval: *cfg.ConfigReloadInterval,
+		Reload: func() error {
+			if err := cfg.ReloadConfig(); err != nil {
+				return err
+			}
+			return e.reload(cfg)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !cfg.exporterMetricsDisabled() {
+		if err := prometheus.Register(watcher); err != nil {
+			return err
+		}
+	}
+
+	go watcher.Run(e.ctx)
+
+	e.logger.Log("level", "info", "msg", "Watching config files for changes", "paths", len(*cfg.ConfigFiles))
+	return nil
+}
+
+// reload replaces the Nest and OpenWeatherMap collectors with ones created from the config. Listeners, sinks and the
+// server keep running with the configuration they were started with. If the config is invalid, the collectors are
+// kept.
+func (e *Exporter) reload(cfg *ExporterConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	nestCollector, err := e.newNestCollector(cfg)
+	if err != nil {
+		return err
+	}
+
+	var weatherCollector prometheus.Collector
+	if *cfg.WeatherToken != "" {
+		c, err := e.newWeatherCollector(cfg)
+		if err != nil {
+			return err
+		}
+		weatherCollector = c
+	}
+
+	// Counters continue from the replaced collector, instead of starting over.
+	nestCollector.RestoreState(nestController{e.nest}.current().State())
+	e.nest.set(nestCollector)
+
+	if e.weather != nil {
+		e.weather.set(weatherCollector)
+	} else if weatherCollector != nil {
+		e.weather = &reloadableCollector{collector: weatherCollector}
+		if err := e.register(cfg, "weather", e.weather); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
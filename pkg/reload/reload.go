@@ -0,0 +1,179 @@
+// Package reload watches configuration files and reloads the configuration when their content changes, so a
+// ConfigMap or Secret mounted in a Kubernetes pod can be updated without restarting the pod.
+//
+// Files are polled instead of watched with inotify. Kubernetes updates mounted ConfigMaps and Secrets by atomically
+// swapping a symlink to a new directory, so the watched files themselves never change and events are easily missed.
+// Comparing content on every poll follows the symlinks and also works for files edited in place.
+package reload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultInterval is the interval of checking the files for changes.
+const DefaultInterval = 30 * time.Second
+
+var (
+	errNoPaths           = errors.New("no files to watch")
+	errNoReload          = errors.New("reload function is missing")
+	errFailedReadingFile = errors.New("failed reading watched file")
+)
+
+// Config provides the configuration necessary to create the Watcher. Logger is optional, if it's nil the Watcher
+// doesn't log anything. Interval defaults to DefaultInterval.
+type Config struct {
+	Logger   log.Logger
+	Paths    []string
+	Interval time.Duration
+	Reload   func() error
+}
+
+// Watcher calls the reload function whenever the content of the watched files changes.
+type Watcher struct {
+	logger   log.Logger
+	paths    []string
+	interval time.Duration
+	reload   func() error
+
+	mu          sync.Mutex
+	checksum    []byte
+	successful  bool
+	lastSuccess time.Time
+
+	successfulDesc  *prometheus.Desc
+	lastSuccessDesc *prometheus.Desc
+}
+
+// New creates a Watcher using the given Config. It returns an error if there are no files to watch or they can't be
+// read.
+func New(cfg Config) (*Watcher, error) {
+	if len(cfg.Paths) == 0 {
+		return nil, errNoPaths
+	}
+
+	if cfg.Reload == nil {
+		return nil, errNoReload
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	w := &Watcher{
+		logger:      cfg.Logger,
+		paths:       cfg.Paths,
+		interval:    cfg.Interval,
+		reload:      cfg.Reload,
+		successful:  true,
+		lastSuccess: time.Now(),
+		successfulDesc: prometheus.NewDesc(
+			"pronestheus_config_last_reload_successful",
+			"Whether the last configuration reload attempt was successful.",
+			nil, nil,
+		),
+		lastSuccessDesc: prometheus.NewDesc(
+			"pronestheus_config_last_reload_success_timestamp_seconds",
+			"Timestamp of the last successful configuration reload.",
+			nil, nil,
+		),
+	}
+
+	checksum, err := w.sum()
+	if err != nil {
+		return nil, err
+	}
+	w.checksum = checksum
+
+	return w, nil
+}
+
+// Run checks the files for changes on every interval until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Check reloads the configuration if the content of the files changed since the last check. A failed reload isn't
+// retried until the files change again.
+func (w *Watcher) Check() {
+	checksum, err := w.sum()
+	if err != nil {
+		w.logger.Log("level", "warn", "message", "Failed checking config files for changes", "stack", errors.WithStack(err))
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if bytes.Equal(checksum, w.checksum) {
+		return
+	}
+	w.checksum = checksum
+
+	if err := w.reload(); err != nil {
+		w.successful = false
+		w.logger.Log("level", "error", "message", "Failed reloading configuration", "stack", errors.WithStack(err))
+		return
+	}
+
+	w.successful = true
+	w.lastSuccess = time.Now()
+	w.logger.Log("level", "info", "message", "Reloaded configuration", "paths", len(w.paths))
+}
+
+// sum returns the checksum of the content of all files.
+func (w *Watcher) sum() ([]byte, error) {
+	h := sha256.New()
+	for _, path := range w.paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(errFailedReadingFile, err.Error())
+		}
+		h.Write([]byte(path))
+		h.Write(data)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (w *Watcher) Describe(ch chan<- *prometheus.Desc) {
+	ch <- w.successfulDesc
+	ch <- w.lastSuccessDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (w *Watcher) Collect(ch chan<- prometheus.Metric) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var successful float64
+	if w.successful {
+		successful = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(w.successfulDesc, prometheus.GaugeValue, successful)
+	ch <- prometheus.MustNewConstMetric(w.lastSuccessDesc, prometheus.GaugeValue, float64(w.lastSuccess.Unix()))
+}
@@ -0,0 +1,125 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestInvalidConfig(t *testing.T) {
+	reload := func() error { return nil }
+
+	_, err := New(Config{Reload: reload})
+	assert.True(t, errors.Is(err, errNoPaths))
+
+	_, err = New(Config{Paths: []string{tempFile(t, "")}})
+	assert.True(t, errors.Is(err, errNoReload))
+
+	_, err = New(Config{Paths: []string{filepath.Join("missing", "config.yaml")}, Reload: reload})
+	assert.True(t, errors.Is(err, errFailedReadingFile))
+}
+
+func TestCheck(t *testing.T) {
+	path := tempFile(t, "scrape-timeout: 1000")
+
+	var reloads int
+	var reloadErr error
+	w, err := New(Config{Paths: []string{path}, Reload: func() error {
+		reloads++
+		return reloadErr
+	}})
+	assert.NoError(t, err)
+
+	w.Check()
+	assert.Equal(t, 0, reloads, "unchanged files aren't reloaded")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("scrape-timeout: 2000"), 0644))
+	w.Check()
+	w.Check()
+	assert.Equal(t, 1, reloads)
+
+	reloadErr = errors.New("invalid config")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("scrape-timeout: abc"), 0644))
+	w.Check()
+	w.Check()
+	assert.Equal(t, 2, reloads, "failed reloads aren't retried until the files change")
+
+	metrics := `
+		# HELP pronestheus_config_last_reload_successful Whether the last configuration reload attempt was successful.
+		# TYPE pronestheus_config_last_reload_successful gauge
+		pronestheus_config_last_reload_successful 0
+	`
+	assert.NoError(t, testutil.CollectAndCompare(w, strings.NewReader(metrics), "pronestheus_config_last_reload_successful"))
+}
+
+func TestCheckMissingFile(t *testing.T) {
+	path := tempFile(t, "scrape-timeout: 1000")
+
+	var reloads int
+	w, err := New(Config{Paths: []string{path}, Reload: func() error {
+		reloads++
+		return nil
+	}})
+	assert.NoError(t, err)
+
+	// Files missing for a moment while they're replaced don't trigger a reload.
+	assert.NoError(t, os.Remove(path))
+	w.Check()
+	assert.Equal(t, 0, reloads)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("scrape-timeout: 1000"), 0644))
+	w.Check()
+	assert.Equal(t, 0, reloads)
+}
+
+func TestSymlinkSwap(t *testing.T) {
+	// Kubernetes mounts the keys of ConfigMaps as symlinks to a ..data symlink, which is swapped on updates.
+	dir, err := ioutil.TempDir("", "reload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, version := range []string{"v1", "v2"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, version), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte("nest-project-id: "+version), 0644))
+	}
+	assert.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")))
+
+	reloaded := make(chan struct{}, 1)
+	w, err := New(Config{Paths: []string{filepath.Join(dir, "config.yaml")}, Interval: 10 * time.Millisecond, Reload: func() error {
+		reloaded <- struct{}{}
+		return nil
+	}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	assert.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("configuration wasn't reloaded")
+	}
+}
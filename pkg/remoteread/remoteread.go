@@ -0,0 +1,302 @@
+// Package remoteread implements the Prometheus remote read API on top of the local history of readings, so
+// a Prometheus server can query samples older than its own retention.
+//
+// Readings are returned as the same series the Nest collector exports: nest_ambient_temperature_<unit>,
+// nest_setpoint_temperature_<unit>, nest_humidity_percent and nest_heating, labelled with id, device_id and label.
+// Only the SAMPLES response type is supported, which Prometheus requests by default.
+package remoteread
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/history"
+	"pronestheus/pkg/units"
+)
+
+// Path is the path of the remote read endpoint, the same as in Prometheus.
+const Path = "/api/v1/read"
+
+const (
+	// maxRequestSize limits the size of compressed and decoded requests, which only contain a few matchers.
+	maxRequestSize = 1 << 20
+
+	// nameLabel is the label containing the metric name.
+	nameLabel = "__name__"
+)
+
+var (
+	errNoStore         = errors.New("history store is missing")
+	errInvalidRequest  = errors.New("invalid read request")
+	errInvalidMatcher  = errors.New("invalid label matcher")
+	errUnsupportedType = errors.New("only the SAMPLES response type is supported")
+)
+
+// Store provides the history of readings. It's implemented by history.Store.
+type Store interface {
+	Query(device string, from, to time.Time) []history.Reading
+}
+
+// Config provides the configuration necessary to create the Handler. Logger is optional, if it's nil the Handler
+// doesn't log anything. Unit is the temperature unit of series: celsius (default), fahrenheit, kelvin or both.
+// Labels should use the same id policy, aliases and label policy as the Nest collector, so the series continue the
+// live ones.
+type Config struct {
+	Logger log.Logger
+	Store  Store
+	Unit   string
+	Labels nest.MetricLabels
+}
+
+// Handler answers remote read requests with readings from the history.
+type Handler struct {
+	logger log.Logger
+	store  Store
+	units  []string
+	labels nest.MetricLabels
+	names  []string
+}
+
+// New creates a Handler using the given Config.
+func New(cfg Config) (*Handler, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Store == nil {
+		return nil, errNoStore
+	}
+
+	h := &Handler{
+		logger: cfg.Logger,
+		store:  cfg.Store,
+		labels: cfg.Labels,
+		names:  cfg.Labels.Names(),
+	}
+
+	exported, err := units.Parse(cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+	h.units = exported
+
+	return h, nil
+}
+
+// ServeHTTP implements the http.Handler interface, answering a snappy-compressed protobuf ReadRequest.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := decodeReadRequest(compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !acceptsSamples(req.AcceptedResponseTypes) {
+		http.Error(w, errUnsupportedType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := &prompb.ReadResponse{Results: make([]*prompb.QueryResult, len(req.Queries))}
+	for i, q := range req.Queries {
+		timeseries, err := h.query(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp.Results[i] = &prompb.QueryResult{Timeseries: timeseries}
+	}
+
+	data, err := resp.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	if _, err := w.Write(snappy.Encode(nil, data)); err != nil {
+		h.logger.Log("level", "error", "message", "Failed writing remote read response", "stack", errors.WithStack(err))
+	}
+}
+
+// decodeReadRequest decodes a snappy-compressed ReadRequest. Requests decoding to more than maxRequestSize bytes are
+// rejected before decoding them.
+func decodeReadRequest(compressed []byte) (*prompb.ReadRequest, error) {
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidRequest, err.Error())
+	}
+	if size > maxRequestSize {
+		return nil, errors.Wrapf(errInvalidRequest, "decoded request is larger than %d bytes", maxRequestSize)
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidRequest, err.Error())
+	}
+
+	req := &prompb.ReadRequest{}
+	if err := req.Unmarshal(data); err != nil {
+		return nil, errors.Wrap(errInvalidRequest, err.Error())
+	}
+	return req, nil
+}
+
+// acceptsSamples returns true if the client accepts the SAMPLES response type, which is the default.
+func acceptsSamples(types []prompb.ReadRequest_ResponseType) bool {
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range types {
+		if t == prompb.ReadRequest_SAMPLES {
+			return true
+		}
+	}
+
+	return false
+}
+
+// query returns series with readings in the time range of the query, matching all its matchers.
+func (h *Handler) query(q *prompb.Query) ([]*prompb.TimeSeries, error) {
+	matches, err := newMatchers(q.Matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Unix(0, q.StartTimestampMs*int64(time.Millisecond))
+	to := time.Unix(0, q.EndTimestampMs*int64(time.Millisecond))
+
+	var result []*prompb.TimeSeries
+	index := map[string]int{}
+	for _, r := range h.store.Query("", from, to) {
+		therm := &nest.Thermostat{ID: r.ID, DeviceID: r.DeviceID, Label: r.Label}
+		values := h.labels.Values(therm)
+		ts := r.Timestamp.UnixNano() / int64(time.Millisecond)
+
+		for _, v := range h.values(r) {
+			labels := []prompb.Label{{Name: nameLabel, Value: v.name}}
+			for i, name := range h.names {
+				labels = append(labels, prompb.Label{Name: name, Value: values[i]})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+			if !matches(labels) {
+				continue
+			}
+
+			key := v.name + "\xff" + r.ID + "\xff" + strings.Join(values, "\xff")
+			i, ok := index[key]
+			if !ok {
+				i = len(result)
+				index[key] = i
+				result = append(result, &prompb.TimeSeries{Labels: labels})
+			}
+			result[i].Samples = append(result[i].Samples, prompb.Sample{Value: v.value, Timestamp: ts})
+		}
+	}
+
+	// Readings are added roughly in chronological order, but Prometheus requires sorted samples.
+	for _, s := range result {
+		sort.SliceStable(s.Samples, func(a, b int) bool { return s.Samples[a].Timestamp < s.Samples[b].Timestamp })
+	}
+	sort.Slice(result, func(a, b int) bool { return seriesKey(result[a]) < seriesKey(result[b]) })
+
+	return result, nil
+}
+
+type value struct {
+	name  string
+	value float64
+}
+
+// values converts a reading into values of metrics, named like the metrics of the Nest collector.
+func (h *Handler) values(r history.Reading) []value {
+	var values []value
+	for _, unit := range h.units {
+		values = append(values,
+			value{"nest_ambient_temperature_" + unit, units.FromCelsius(r.AmbientTemp, unit)},
+			value{"nest_setpoint_temperature_" + unit, units.FromCelsius(r.SetpointTemp, unit)},
+		)
+	}
+
+	heating := 0.0
+	if r.Status == "HEATING" {
+		heating = 1
+	}
+
+	return append(values,
+		value{"nest_humidity_percent", r.Humidity},
+		value{"nest_heating", heating},
+	)
+}
+
+func seriesKey(s *prompb.TimeSeries) string {
+	var b strings.Builder
+	for _, l := range s.Labels {
+		b.WriteString(l.Value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// newMatchers returns a function checking if labels match all matchers. Like in Prometheus, regular expressions are
+// anchored and a missing label has an empty value.
+func newMatchers(matchers []*prompb.LabelMatcher) (func(labels []prompb.Label) bool, error) {
+	checks := make([]func(string) bool, len(matchers))
+	for i, m := range matchers {
+		value := m.Value
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+			checks[i] = func(v string) bool { return v == value }
+		case prompb.LabelMatcher_NEQ:
+			checks[i] = func(v string) bool { return v != value }
+		case prompb.LabelMatcher_RE, prompb.LabelMatcher_NRE:
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, errors.Wrap(errInvalidMatcher, err.Error())
+			}
+			negate := m.Type == prompb.LabelMatcher_NRE
+			checks[i] = func(v string) bool { return re.MatchString(v) != negate }
+		default:
+			return nil, errors.Wrapf(errInvalidMatcher, "unknown type %d", m.Type)
+		}
+	}
+
+	return func(labels []prompb.Label) bool {
+		for i, m := range matchers {
+			v := ""
+			for _, l := range labels {
+				if l.Name == m.Name {
+					v = l.Value
+					break
+				}
+			}
+			if !checks[i](v) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
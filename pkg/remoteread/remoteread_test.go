@@ -0,0 +1,175 @@
+package remoteread
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/history"
+	"pronestheus/pkg/units"
+)
+
+type store []history.Reading
+
+func (s store) Query(device string, from, to time.Time) []history.Reading {
+	var readings []history.Reading
+	for _, r := range s {
+		if !r.Timestamp.Before(from) && !r.Timestamp.After(to) {
+			readings = append(readings, r)
+		}
+	}
+	return readings
+}
+
+var start = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func testStore() store {
+	return store{
+		{Timestamp: start.Add(time.Minute), ID: "enterprises/p/devices/1", DeviceID: "1", Label: "Living Room", AmbientTemp: 20, SetpointTemp: 21, Humidity: 40, Status: "HEATING"},
+		{Timestamp: start, ID: "enterprises/p/devices/1", DeviceID: "1", Label: "Living Room", AmbientTemp: 19.5, SetpointTemp: 21, Humidity: 41, Status: "OFF"},
+		{Timestamp: start, ID: "enterprises/p/devices/2", DeviceID: "2", Label: "Bedroom", AmbientTemp: 18, SetpointTemp: 17, Humidity: 50, Status: "OFF"},
+		{Timestamp: start.Add(time.Hour), ID: "enterprises/p/devices/2", DeviceID: "2", Label: "Bedroom", AmbientTemp: 17, SetpointTemp: 17, Humidity: 50, Status: "OFF"},
+	}
+}
+
+// encodeRequest encodes a snappy-compressed ReadRequest with a single query.
+func encodeRequest(t *testing.T, from, to time.Time, matchers ...*prompb.LabelMatcher) []byte {
+	req := &prompb.ReadRequest{
+		Queries: []*prompb.Query{{
+			StartTimestampMs: from.UnixNano() / int64(time.Millisecond),
+			EndTimestampMs:   to.UnixNano() / int64(time.Millisecond),
+			Matchers:         matchers,
+		}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_SAMPLES},
+	}
+
+	data, err := req.Marshal()
+	assert.NoError(t, err)
+	return snappy.Encode(nil, data)
+}
+
+func matcher(typ prompb.LabelMatcher_Type, name, value string) *prompb.LabelMatcher {
+	return &prompb.LabelMatcher{Type: typ, Name: name, Value: value}
+}
+
+// decodeResponse decodes the series of the first query result into lines like `name{labels} value@timestamp`.
+func decodeResponse(t *testing.T, body []byte) []string {
+	data, err := snappy.Decode(nil, body)
+	assert.NoError(t, err)
+
+	resp := &prompb.ReadResponse{}
+	assert.NoError(t, resp.Unmarshal(data))
+	assert.Len(t, resp.Results, 1)
+
+	var lines []string
+	for _, ts := range resp.Results[0].Timeseries {
+		var labels []string
+		for _, l := range ts.Labels {
+			labels = append(labels, l.Name+"="+l.Value)
+		}
+
+		for _, s := range ts.Samples {
+			at := time.Unix(0, s.Timestamp*int64(time.Millisecond)).UTC().Format("15:04")
+			lines = append(lines, strings.Join(labels, ",")+" "+strconv.FormatFloat(s.Value, 'f', -1, 64)+"@"+at)
+		}
+	}
+	return lines
+}
+
+func serve(t *testing.T, h *Handler, body []byte) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(body)))
+	return rec
+}
+
+func TestRead(t *testing.T) {
+	h, err := New(Config{Store: testStore()})
+	assert.NoError(t, err)
+
+	rec := serve(t, h, encodeRequest(t, start, start.Add(30*time.Minute),
+		matcher(prompb.LabelMatcher_RE, nameLabel, "nest_(ambient_temperature_celsius|heating)"),
+		matcher(prompb.LabelMatcher_EQ, "label", "Living Room"),
+	))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-protobuf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "snappy", rec.Header().Get("Content-Encoding"))
+
+	assert.Equal(t, []string{
+		"__name__=nest_ambient_temperature_celsius,device_id=1,id=enterprises/p/devices/1,label=Living Room 19.5@10:00",
+		"__name__=nest_ambient_temperature_celsius,device_id=1,id=enterprises/p/devices/1,label=Living Room 20@10:01",
+		"__name__=nest_heating,device_id=1,id=enterprises/p/devices/1,label=Living Room 0@10:00",
+		"__name__=nest_heating,device_id=1,id=enterprises/p/devices/1,label=Living Room 1@10:01",
+	}, decodeResponse(t, rec.Body.Bytes()))
+}
+
+func TestReadLabelAndUnit(t *testing.T) {
+	h, err := New(Config{
+		Store: testStore(),
+		Unit:  units.Fahrenheit,
+		Labels: nest.MetricLabels{
+			IDPolicy: nest.IDNone,
+			Label:    func(therm *nest.Thermostat) string { return strings.Replace(therm.Label, " ", "-", -1) },
+		},
+	})
+	assert.NoError(t, err)
+
+	rec := serve(t, h, encodeRequest(t, start, start.Add(2*time.Hour),
+		matcher(prompb.LabelMatcher_EQ, nameLabel, "nest_setpoint_temperature_fahrenheit"),
+		matcher(prompb.LabelMatcher_NRE, "device_id", "2"),
+		matcher(prompb.LabelMatcher_EQ, "room", ""),
+	))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.Equal(t, []string{
+		"__name__=nest_setpoint_temperature_fahrenheit,device_id=1,label=Living-Room 69.8@10:00",
+		"__name__=nest_setpoint_temperature_fahrenheit,device_id=1,label=Living-Room 69.8@10:01",
+	}, decodeResponse(t, rec.Body.Bytes()))
+}
+
+func TestReadInvalidRequests(t *testing.T) {
+	h, err := New(Config{Store: testStore()})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serve(t, h, []byte("not snappy"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(t, h, snappy.Encode(nil, []byte{0xff}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(t, h, snappy.Encode(nil, make([]byte, maxRequestSize+1)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "decoded requests are limited")
+
+	rec = serve(t, h, encodeRequest(t, start, start.Add(time.Hour), matcher(prompb.LabelMatcher_RE, nameLabel, "(")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	chunked, err := (&prompb.ReadRequest{
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	}).Marshal()
+	assert.NoError(t, err)
+	rec = serve(t, h, snappy.Encode(nil, chunked))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	body, _ := ioutil.ReadAll(rec.Body)
+	assert.Contains(t, string(body), errUnsupportedType.Error())
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New(Config{})
+	assert.Equal(t, errNoStore, err)
+
+	_, err = New(Config{Store: testStore(), Unit: "rankine"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+// Package scheduler decouples collection of metrics from Prometheus scrapes.
+//
+// A Scheduler wraps a prometheus.Collector, collects its metrics on a fixed interval and serves the latest snapshot
+// on every scrape. No matter how many Prometheus servers (or humans) hit the metrics endpoint, the remote APIs are
+// called only once per interval.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scheduler implements the prometheus.Collector interface, serving the latest snapshot of metrics collected
+// in the background from the wrapped collector.
+type Scheduler struct {
+	collector prometheus.Collector
+	interval  time.Duration
+
+	mu      sync.RWMutex
+	metrics []prometheus.Metric
+}
+
+// New creates a Scheduler collecting metrics from the collector every interval.
+func New(collector prometheus.Collector, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		collector: collector,
+		interval:  interval,
+	}
+}
+
+// Start collects the metrics once and then keeps collecting them in the background every interval,
+// until the context is cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.refresh()
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refresh()
+			}
+		}
+	}()
+}
+
+// refresh collects metrics from the wrapped collector and replaces the snapshot.
+func (s *Scheduler) refresh() {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		s.collector.Collect(ch)
+		close(ch)
+	}()
+
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+
+	s.mu.Lock()
+	s.metrics = metrics
+	s.mu.Unlock()
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, metric := range s.metrics {
+		ch <- metric
+	}
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCollector reports how many times it was collected.
+type countingCollector struct {
+	desc  *prometheus.Desc
+	calls int32
+}
+
+func (c *countingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *countingCollector) Collect(ch chan<- prometheus.Metric) {
+	calls := atomic.AddInt32(&c.calls, 1)
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(calls))
+}
+
+func TestScrapesServeSnapshot(t *testing.T) {
+	inner := &countingCollector{desc: prometheus.NewDesc("test_calls", "Number of calls.", nil, nil)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(inner, time.Hour)
+	s.Start(ctx)
+
+	// Scrapes don't trigger any collection, they always return the first snapshot.
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, float64(1), testutil.ToFloat64(s))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&inner.calls))
+}
+
+func TestBackgroundCollection(t *testing.T) {
+	inner := &countingCollector{desc: prometheus.NewDesc("test_calls", "Number of calls.", nil, nil)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(inner, 10*time.Millisecond)
+	s.Start(ctx)
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(s) >= 3
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	time.Sleep(30 * time.Millisecond)
+	calls := atomic.LoadInt32(&inner.calls)
+	time.Sleep(30 * time.Millisecond)
+
+	// No more collections after the context is cancelled.
+	assert.Equal(t, calls, atomic.LoadInt32(&inner.calls))
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import "pronestheus/pkg/collectors/sensor"
+
+// registerSensorCollector registers the collector of local sensors if any sensor is configured.
+func (e *Exporter) registerSensorCollector(cfg *ExporterConfig) error {
+	if cfg.LocalSensors == nil || len(*cfg.LocalSensors) == 0 {
+		return nil
+	}
+
+	sources, err := sensorSources(cfg)
+	if err != nil {
+		return err
+	}
+
+	opts := []sensor.Option{
+		sensor.WithContext(e.ctx),
+		sensor.WithLogger(e.logger),
+		sensor.WithTimeout(cfg.collectorTimeout("sensors")),
+		sensor.WithTransport(cfg.transport(nil)),
+	}
+
+	if cfg.NestUnit != nil {
+		opts = append(opts, sensor.WithUnit(*cfg.NestUnit))
+	}
+
+	sensorCollector, err := sensor.New(sources, opts...)
+	if err != nil {
+		return err
+	}
+
+	return e.register(cfg, "sensors", sensorCollector)
+}
+
+// sensorSources parses the local sensors of the ExporterConfig.
+func sensorSources(cfg *ExporterConfig) ([]sensor.Source, error) {
+	var sources []sensor.Source
+	for _, text := range *cfg.LocalSensors {
+		source, err := sensor.ParseSource(text)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
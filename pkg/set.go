@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/control"
+)
+
+// Set changes settings of a thermostat, eg. for scheduled changes from cron jobs. With the URL of a running exporter
+// the request is sent to its admin endpoint, authorized with the admin token of the config. Otherwise the commands
+// are executed with the Nest API directly, using the credentials of the config.
+func Set(cfg *ExporterConfig, exporterURL string, req control.Request, out io.Writer) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	var result *control.Result
+	if exporterURL != "" {
+		var token string
+		if cfg.AdminToken != nil {
+			token = *cfg.AdminToken
+		}
+
+		var err error
+		if result, err = control.Send(ctx, nil, exporterURL, token, req); err != nil {
+			return err
+		}
+	} else {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		nestCollector, err := nest.New(*cfg.NestProjectID, nestOptions(cfg, nil)...)
+		if err != nil {
+			return err
+		}
+
+		thermostats, err := nestCollector.Thermostats(ctx)
+		if err != nil {
+			return err
+		}
+
+		therm, err := control.Find(thermostats, req.Device, nestCollector.MetricLabel)
+		if err != nil {
+			return err
+		}
+
+		if result, err = control.Apply(ctx, nestCollector, therm, req); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(out, "Set %s on %s (%s)\n", strings.Join(result.Applied, ", "), result.Label, result.DeviceID)
+	return err
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"pronestheus/pkg/control"
+	"pronestheus/test"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDirect(t *testing.T) {
+	nestServ := test.NestServer()
+	defer nestServ.Close()
+
+	cfg := testConfig()
+	cfg.NestURL = &nestServ.URL
+
+	setpoint := 20.5
+	var out bytes.Buffer
+	err := Set(cfg, "", control.Request{Device: "custom-name", Mode: "HEAT", Setpoint: &setpoint}, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Set mode HEAT, setpoint 20.5°C on Custom Name (DEVICE_ID)\n", out.String())
+}
+
+func TestSetExporter(t *testing.T) {
+	var auth string
+	exporter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"id":"enterprises/PROJECT_ID/devices/DEVICE_ID","device_id":"DEVICE_ID","label":"Living-Room","applied":["eco mode MANUAL_ECO"]}`))
+	}))
+	defer exporter.Close()
+
+	cfg := testConfig()
+	token := "secret"
+	cfg.AdminToken = &token
+
+	var out bytes.Buffer
+	err := Set(cfg, exporter.URL, control.Request{Device: "Living-Room", EcoMode: "MANUAL_ECO"}, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", auth)
+	assert.Equal(t, "Set eco mode MANUAL_ECO on Living-Room (DEVICE_ID)\n", out.String())
+}
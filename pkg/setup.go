@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"gopkg.in/yaml.v3"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+const (
+	// partnerConnectionsURL is the URL of the Partner Connections Manager, where users authorize access to their
+	// devices, with the Device Access project ID as the placeholder.
+	partnerConnectionsURL = "https://nestservices.google.com/partnerconnections/%s/auth"
+
+	// setupRedirectURL is the redirect URI of the OAuth2 client suggested by the Device Access guide. Users copy the
+	// authorization code from the address bar after the redirect.
+	setupRedirectURL = "https://www.google.com"
+)
+
+var (
+	errSetupAborted      = errors.New("setup aborted")
+	errMissingAuthCode   = errors.New("no authorization code in the input")
+	errFailedAuthorizing = errors.New("failed exchanging the authorization code for a refresh token")
+)
+
+// prompter reads answers to questions from the input.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints the question and returns the answer, or the default value if the answer is empty. Values which are
+// required are asked again until they're answered.
+func (p *prompter) ask(question, def string, required bool) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errSetupAborted
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if answer != "" || !required {
+			return answer, nil
+		}
+	}
+}
+
+// Setup interactively asks for the Device Access project and OAuth2 client, runs the authorization flow to get
+// a refresh token, lists the thermostats available with it, asks for and tests the OpenWeatherMap API key and writes
+// a config file with the answers to path. Values of cfg, eg. from flags, are the defaults of the answers and the
+// API URLs.
+func Setup(cfg *ExporterConfig, in io.Reader, out io.Writer, path string) error {
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	setupCfg := *cfg
+	values := map[string]interface{}{}
+
+	fmt.Fprintln(out, "Create a Device Access project on https://console.nest.google.com/device-access with the OAuth client ID")
+	fmt.Fprintln(out, "of a Web application created on https://console.cloud.google.com/apis/credentials, with "+setupRedirectURL)
+	fmt.Fprintln(out, "as the authorized redirect URI.")
+	fmt.Fprintln(out)
+
+	for _, q := range []struct {
+		flag     string
+		question string
+		value    **string
+		secret   bool
+	}{
+		{"nest-project-id", "Device Access project ID", &setupCfg.NestProjectID, false},
+		{"nest-client-id", "OAuth2 client ID", &setupCfg.NestOAuthClientID, false},
+		{"nest-client-secret", "OAuth2 client secret", &setupCfg.NestOAuthClientSecret, true},
+	} {
+		// Secrets aren't printed as defaults.
+		def := stringValue(*q.value)
+		if q.secret {
+			def = ""
+		}
+
+		answer, err := p.ask(q.question, def, true)
+		if err != nil {
+			return err
+		}
+		*q.value = &answer
+		values[q.flag] = answer
+	}
+
+	refreshToken, err := authorize(&setupCfg, p)
+	if err != nil {
+		return err
+	}
+	setupCfg.NestRefreshToken = &refreshToken
+	values["nest-refresh-token"] = refreshToken
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	if !checkNest(ctx, &setupCfg, out) {
+		fmt.Fprintln(out, "The config file is written anyway, fix it and run `pronestheus check`.")
+	}
+	fmt.Fprintln(out)
+
+	weatherToken, err := p.ask("OpenWeatherMap API key, empty to skip the weather", "", false)
+	if err != nil {
+		return err
+	}
+	setupCfg.WeatherToken = &weatherToken
+	if weatherToken != "" {
+		location, err := p.ask("OpenWeatherMap location ID", stringValue(cfg.WeatherLocation), true)
+		if err != nil {
+			return err
+		}
+		setupCfg.WeatherLocation = &location
+		values["owm-auth"] = weatherToken
+		values["owm-location"] = location
+
+		checkWeather(ctx, &setupCfg, out)
+	}
+
+	return writeSetupConfig(p, path, values)
+}
+
+// authorize prints the authorization URL of the Partner Connections Manager, reads the authorization code, or the
+// URL redirected to with the code, and exchanges it for a refresh token.
+func authorize(cfg *ExporterConfig, p *prompter) (string, error) {
+	tokenURL := endpoints.Google.TokenURL
+	if cfg.NestTokenURL != nil && *cfg.NestTokenURL != "" {
+		tokenURL = *cfg.NestTokenURL
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     *cfg.NestOAuthClientID,
+		ClientSecret: *cfg.NestOAuthClientSecret,
+		RedirectURL:  setupRedirectURL,
+		Scopes:       []string{nest.Scope},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  fmt.Sprintf(partnerConnectionsURL, *cfg.NestProjectID),
+			TokenURL: tokenURL,
+		},
+	}
+
+	fmt.Fprintln(p.out)
+	fmt.Fprintln(p.out, "Open this URL, select the thermostats to share and allow access:")
+	fmt.Fprintln(p.out, oauthConfig.AuthCodeURL("pronestheus", oauth2.AccessTypeOffline, oauth2.ApprovalForce))
+	fmt.Fprintln(p.out)
+
+	answer, err := p.ask("Address of the page you were redirected to, or its code parameter", "", true)
+	if err != nil {
+		return "", err
+	}
+
+	code := answer
+	if redirect, err := url.Parse(answer); err == nil && redirect.Query().Get("code") != "" {
+		code = redirect.Query().Get("code")
+	} else if strings.Contains(answer, "://") {
+		return "", errMissingAuthCode
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*cfg.Timeout)*time.Millisecond)
+	defer cancel()
+
+	token, err := oauthConfig.Exchange(ctx, code)
+	if err != nil {
+		return "", errors.Wrap(errFailedAuthorizing, err.Error())
+	}
+	if token.RefreshToken == "" {
+		return "", errors.Wrap(errFailedAuthorizing, "no refresh token in the response")
+	}
+	fmt.Fprintln(p.out, "[OK]   Received a refresh token")
+
+	return token.RefreshToken, nil
+}
+
+// writeSetupConfig writes the values as a config file to path, asking before an existing file is overwritten. The
+// file contains credentials, so only its owner can read it.
+func writeSetupConfig(p *prompter, path string, values map[string]interface{}) error {
+	if _, err := os.Stat(path); err == nil {
+		answer, err := p.ask(fmt.Sprintf("%s exists, overwrite it? (y/N)", path), "", false)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return errSetupAborted
+		}
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of existing files.
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p.out, "\nWrote %s, start the exporter with:\n\n  pronestheus --config-file=%s\n", path, path)
+	return nil
+}
+
+// stringValue returns the value of an optional string flag.
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pronestheus/test"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenServer returns a mock OAuth2 token endpoint exchanging the authorization code AUTH_CODE for the refresh token
+// REFRESH_TOKEN, and refreshing access tokens with it.
+func tokenServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exchanged := r.FormValue("code") == "AUTH_CODE" && r.FormValue("redirect_uri") == setupRedirectURL
+		if !exchanged && r.FormValue("refresh_token") != "REFRESH_TOKEN" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "ACCESS_TOKEN", "refresh_token": "REFRESH_TOKEN", "token_type": "Bearer", "expires_in": 3600}`))
+	}))
+}
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "setup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenServ := tokenServer()
+	nestServ := test.NestServer()
+	weatherServ := test.WeatherServerMetric()
+
+	cfg := testConfig()
+	cfg.NestTokenURL = &tokenServ.URL
+	cfg.NestURL = &nestServ.URL
+	cfg.WeatherURL = &weatherServ.URL
+	cfg.NestOAuthToken = nil
+	empty := ""
+	cfg.NestProjectID = &empty
+
+	// The project ID is asked again until it's answered, the client ID keeps its default.
+	input := strings.Join([]string{
+		"",
+		"PROJECT_ID",
+		"",
+		"CLIENT_SECRET",
+		"https://www.google.com/?state=pronestheus&code=AUTH_CODE&scope=https://www.googleapis.com/auth/sdm.service",
+		"OWM_KEY",
+		"2759794",
+	}, "\n")
+
+	path := filepath.Join(dir, "pronestheus.yml")
+	var out bytes.Buffer
+	assert.NoError(t, Setup(cfg, strings.NewReader(input), &out, path))
+
+	assert.Contains(t, out.String(), "https://nestservices.google.com/partnerconnections/PROJECT_ID/auth?access_type=offline")
+	assert.Contains(t, out.String(), "[OK]   Received a refresh token")
+	assert.Contains(t, out.String(), "[OK]   Found 1 thermostats")
+	assert.Contains(t, out.String(), "[OK]   OpenWeatherMap API responded")
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `nest-client-id: dummy
+nest-client-secret: CLIENT_SECRET
+nest-project-id: PROJECT_ID
+nest-refresh-token: REFRESH_TOKEN
+owm-auth: OWM_KEY
+owm-location: "2759794"
+`, string(data))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the config file contains credentials")
+
+	// Existing config files are only overwritten when confirmed.
+	input = "PROJECT_ID\nCLIENT_ID\nCLIENT_SECRET\nAUTH_CODE\n\nn\n"
+	err = Setup(cfg, strings.NewReader(input), &out, path)
+	assert.True(t, errors.Is(err, errSetupAborted))
+}
+
+func TestSetupInvalidCode(t *testing.T) {
+	tokenServ := tokenServer()
+
+	cfg := testConfig()
+	cfg.NestTokenURL = &tokenServ.URL
+
+	input := "PROJECT_ID\nCLIENT_ID\nCLIENT_SECRET\nWRONG_CODE\n"
+	err := Setup(cfg, strings.NewReader(input), ioutil.Discard, filepath.Join(os.TempDir(), "unused.yml"))
+	assert.True(t, errors.Is(err, errFailedAuthorizing))
+
+	input = "PROJECT_ID\nCLIENT_ID\nCLIENT_SECRET\nhttps://www.google.com/?error=access_denied\n"
+	err = Setup(cfg, strings.NewReader(input), ioutil.Discard, filepath.Join(os.TempDir(), "unused.yml"))
+	assert.True(t, errors.Is(err, errMissingAuthCode))
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+
+	"pronestheus/pkg/fixtures"
+	"pronestheus/pkg/simulator"
+)
+
+// Nest API environments.
+const (
+	envProd    = "prod"
+	envSandbox = "sandbox"
+	envMock    = "mock"
+)
+
+// simulated returns true if the exporter should generate synthetic readings instead of calling the real APIs.
+func (cfg *ExporterConfig) simulated() bool {
+	return (cfg.Simulate != nil && *cfg.Simulate) || (cfg.NestEnvironment != nil && *cfg.NestEnvironment == envMock)
+}
+
+// sandboxed returns true if the exporter should serve the built-in sandbox fixtures instead of calling the real APIs.
+func (cfg *ExporterConfig) sandboxed() bool {
+	return cfg.NestEnvironment != nil && *cfg.NestEnvironment == envSandbox && !cfg.simulated()
+}
+
+// offline returns true if the exporter doesn't call the real APIs, so credentials aren't required.
+func (cfg *ExporterConfig) offline() bool {
+	return cfg.simulated() || cfg.sandboxed()
+}
+
+// startSimulator starts the simulator on a random local port and points the collectors at it,
+// replacing the credentials with dummy values.
+func startSimulator(cfg *ExporterConfig) error {
+	sim := simulator.New(simulator.Config{
+		Thermostats: *cfg.SimulateThermostats,
+		Period:      *cfg.SimulatePeriod,
+		Amplitude:   2,
+		FailureRate: *cfg.SimulateFailureRate,
+	})
+
+	return startFakeAPI(cfg, sim, "simulated")
+}
+
+// startSandbox starts a server with the sandbox fixtures on a random local port and points the collectors at it,
+// replacing the credentials with dummy values.
+func startSandbox(cfg *ExporterConfig) error {
+	return startFakeAPI(cfg, fixtures.NewSandboxServer(), "sandbox")
+}
+
+// startFakeAPI serves the handler on a random local port and points the collectors at it.
+func startFakeAPI(cfg *ExporterConfig, handler http.Handler, dummy string) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	go http.Serve(listener, handler)
+
+	baseURL := "http://" + listener.Addr().String()
+	nestURL := baseURL + "/v1/"
+	tokenURL := baseURL + "/token"
+	weatherURL := baseURL + "/weather"
+	forecastURL := baseURL + "/forecast"
+	solarURL := baseURL + "/solar"
+	refreshToken := "refresh-token"
+
+	cfg.NestURL = &nestURL
+	cfg.NestTokenURL = &tokenURL
+	cfg.NestAuth = &refreshToken
+	cfg.NestOAuthClientID = &dummy
+	cfg.NestOAuthClientSecret = &dummy
+	cfg.NestProjectID = &dummy
+	cfg.NestRefreshToken = &dummy
+	cfg.WeatherURL = &weatherURL
+	cfg.WeatherForecastURL = &forecastURL
+	cfg.SolarURL = &solarURL
+	cfg.WeatherToken = &dummy
+
+	return nil
+}
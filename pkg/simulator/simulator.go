@@ -0,0 +1,222 @@
+// Package simulator implements a fake Nest and OpenWeatherMap API generating synthetic readings.
+// It allows building and testing dashboards and alerts without real hardware.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The forecast has the steps of the OpenWeatherMap 5 day / 3 hour forecast.
+const (
+	forecastStep  = 3 * time.Hour
+	forecastSteps = 40
+)
+
+// Config provides the configuration of the Simulator.
+type Config struct {
+	// Thermostats is the number of simulated thermostats.
+	Thermostats int
+	// Period is the period of the sinusoidal temperature and humidity changes.
+	Period time.Duration
+	// Amplitude is the amplitude of ambient temperature changes, in Celsius.
+	Amplitude float64
+	// FailureRate is the probability (0-1) of an API request failing with 503 Service Unavailable.
+	FailureRate float64
+	// Seed initializes the random generator, making the simulation reproducible.
+	Seed int64
+}
+
+// Simulator is a http.Handler mocking Nest and OpenWeatherMap APIs with synthetic readings.
+//
+// Nest API is served under "/v1/", OpenWeatherMap API under "/weather" and "/forecast", Open-Meteo API under "/solar"
+// and the OAuth2 token endpoint under "/token".
+type Simulator struct {
+	cfg   Config
+	mux   *http.ServeMux
+	now   func() time.Time
+	start time.Time
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	heating []bool
+}
+
+// New creates a Simulator using the given Config.
+func New(cfg Config) *Simulator {
+	if cfg.Thermostats <= 0 {
+		cfg.Thermostats = 1
+	}
+
+	if cfg.Period <= 0 {
+		cfg.Period = 24 * time.Hour
+	}
+
+	s := &Simulator{
+		cfg:     cfg,
+		mux:     http.NewServeMux(),
+		now:     time.Now,
+		start:   time.Now(),
+		rand:    rand.New(rand.NewSource(cfg.Seed)),
+		heating: make([]bool, cfg.Thermostats),
+	}
+
+	s.mux.HandleFunc("/token", s.token)
+	s.mux.HandleFunc("/v1/", s.failing(s.devices))
+	s.mux.HandleFunc("/weather", s.failing(s.weather))
+	s.mux.HandleFunc("/forecast", s.failing(s.forecast))
+	s.mux.HandleFunc("/solar", s.failing(s.solar))
+
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// failing makes the handler fail randomly, according to the configured FailureRate.
+func (s *Simulator) failing(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		fail := s.rand.Float64() < s.cfg.FailureRate
+		s.mu.Unlock()
+
+		if fail {
+			http.Error(w, `{"error":{"code":503,"message":"Simulated failure","status":"UNAVAILABLE"}}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Simulator) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"access_token":"simulated","token_type":"Bearer","expires_in":3600}`))
+}
+
+func (s *Simulator) devices(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var devices []interface{}
+	for i := 0; i < s.cfg.Thermostats; i++ {
+		// Shift the phase of each thermostat so they don't report identical readings.
+		phase := float64(i) * math.Pi / 4
+		setpoint := 19.0 + float64(i%3)
+		ambient := setpoint + s.cfg.Amplitude*s.wave(phase) + s.rand.NormFloat64()*0.1
+		humidity := 50 + 10*s.wave(phase+math.Pi/2)
+
+		// Heating randomly turns on below the setpoint and off above it, simulating HVAC cycling.
+		if ambient < setpoint && s.rand.Float64() < 0.5 {
+			s.heating[i] = true
+		} else if ambient > setpoint && s.rand.Float64() < 0.5 {
+			s.heating[i] = false
+		}
+
+		status := "OFF"
+		if s.heating[i] {
+			status = "HEATING"
+		}
+
+		devices = append(devices, map[string]interface{}{
+			"name": fmt.Sprintf("enterprises/SIMULATED/devices/THERMOSTAT_%d", i+1),
+			"type": "sdm.devices.types.THERMOSTAT",
+			"traits": map[string]interface{}{
+				"sdm.devices.traits.Info":                          map[string]interface{}{"customName": fmt.Sprintf("Thermostat %d", i+1)},
+				"sdm.devices.traits.Humidity":                      map[string]interface{}{"ambientHumidityPercent": round(humidity)},
+				"sdm.devices.traits.Connectivity":                  map[string]interface{}{"status": "ONLINE"},
+				"sdm.devices.traits.ThermostatMode":                map[string]interface{}{"mode": "HEAT", "availableModes": []string{"HEAT", "OFF"}},
+				"sdm.devices.traits.ThermostatHvac":                map[string]interface{}{"status": status},
+				"sdm.devices.traits.ThermostatTemperatureSetpoint": map[string]interface{}{"heatCelsius": setpoint},
+				"sdm.devices.traits.Temperature":                   map[string]interface{}{"ambientTemperatureCelsius": round(ambient)},
+			},
+			"parentRelations": []interface{}{
+				map[string]interface{}{
+					"parent":      fmt.Sprintf("enterprises/SIMULATED/structures/HOME/rooms/ROOM_%d", i+1),
+					"displayName": fmt.Sprintf("Room %d", i+1),
+				},
+			},
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"devices": devices})
+}
+
+func (s *Simulator) weather(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	temp := 10 + 2*s.cfg.Amplitude*s.wave(0) + s.rand.NormFloat64()*0.2
+	humidity := 75 - 15*s.wave(0)
+
+	writeJSON(w, map[string]interface{}{
+		"main": map[string]interface{}{
+			"temp":     round(temp),
+			"humidity": round(humidity),
+			"pressure": 1013,
+		},
+		"name": "Simulated",
+	})
+}
+
+// forecast serves the 5 day / 3 hour forecast, following the wave of the outside temperature without noise.
+func (s *Simulator) forecast(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []interface{}
+	for t, i := s.now().Truncate(forecastStep), 0; i < forecastSteps; i++ {
+		t = t.Add(forecastStep)
+		list = append(list, map[string]interface{}{
+			"dt":   t.Unix(),
+			"main": map[string]interface{}{"temp": round(10 + 2*s.cfg.Amplitude*s.waveAt(t, 0))},
+		})
+	}
+
+	writeJSON(w, map[string]interface{}{"list": list})
+}
+
+// solar serves the current solar radiation, peaking with the outside temperature and zero during the "night".
+func (s *Simulator) solar(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shortwave := math.Max(0, 600*s.wave(0))
+	cloudCover := math.Round(50 - 40*s.wave(0))
+
+	writeJSON(w, map[string]interface{}{
+		"current": map[string]interface{}{
+			"shortwave_radiation": round(shortwave),
+			"direct_radiation":    round(shortwave * 0.7),
+			"diffuse_radiation":   round(shortwave * 0.3),
+			"cloud_cover":         cloudCover,
+		},
+	})
+}
+
+// wave returns the value of the sine wave, with the configured period, at the current time.
+func (s *Simulator) wave(phase float64) float64 {
+	return s.waveAt(s.now(), phase)
+}
+
+// waveAt returns the value of the sine wave, with the configured period, at the given time.
+func (s *Simulator) waveAt(t time.Time, phase float64) float64 {
+	elapsed := t.Sub(s.start).Seconds()
+	return math.Sin(2*math.Pi*elapsed/s.cfg.Period.Seconds() + phase)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
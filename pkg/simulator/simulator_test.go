@@ -0,0 +1,89 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestDevices(t *testing.T) {
+	sim := New(Config{Thermostats: 3, Period: time.Hour, Amplitude: 2})
+
+	w := httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/enterprises/SIMULATED/devices/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	devices := gjson.Get(w.Body.String(), "devices").Array()
+	assert.Len(t, devices, 3)
+
+	for _, device := range devices {
+		ambient := device.Get("traits.sdm\\.devices\\.traits\\.Temperature.ambientTemperatureCelsius").Float()
+		setpoint := device.Get("traits.sdm\\.devices\\.traits\\.ThermostatTemperatureSetpoint.heatCelsius").Float()
+		assert.InDelta(t, setpoint, ambient, 3)
+	}
+}
+
+func TestSinusoidalTemperature(t *testing.T) {
+	sim := New(Config{Thermostats: 1, Period: time.Hour, Amplitude: 2})
+
+	// A quarter of the period after the start, the sine wave is at its peak.
+	sim.now = func() time.Time { return sim.start.Add(15 * time.Minute) }
+	assert.InDelta(t, 1, sim.wave(0), 0.0001)
+
+	sim.now = func() time.Time { return sim.start.Add(45 * time.Minute) }
+	assert.InDelta(t, -1, sim.wave(0), 0.0001)
+}
+
+func TestWeather(t *testing.T) {
+	sim := New(Config{Period: time.Hour, Amplitude: 2})
+
+	w := httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/weather?id=1&appid=2&units=metric", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, gjson.Get(w.Body.String(), "main.temp").Exists())
+	assert.Equal(t, float64(1013), gjson.Get(w.Body.String(), "main.pressure").Float())
+}
+
+func TestForecast(t *testing.T) {
+	sim := New(Config{Period: time.Hour, Amplitude: 2})
+
+	w := httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/forecast?id=1&appid=2&units=metric", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	list := gjson.Get(w.Body.String(), "list").Array()
+	assert.Len(t, list, 40)
+	assert.Equal(t, int64(3*60*60), list[1].Get("dt").Int()-list[0].Get("dt").Int())
+	assert.True(t, list[0].Get("main.temp").Exists())
+}
+
+func TestSolar(t *testing.T) {
+	sim := New(Config{Period: time.Hour})
+
+	w := httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/solar?latitude=52.37&longitude=4.89", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	shortwave := gjson.Get(w.Body.String(), "current.shortwave_radiation").Float()
+	assert.True(t, shortwave >= 0 && shortwave <= 600)
+	assert.True(t, gjson.Get(w.Body.String(), "current.cloud_cover").Exists())
+}
+
+func TestFailures(t *testing.T) {
+	sim := New(Config{FailureRate: 1})
+
+	w := httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/enterprises/SIMULATED/devices/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Token endpoint never fails.
+	w = httptest.NewRecorder()
+	sim.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/token", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
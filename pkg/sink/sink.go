@@ -0,0 +1,92 @@
+// Package sink periodically pushes the latest thermostat readings to external systems, eg. Zabbix or Graphite.
+//
+// A Pusher keeps the readings passed to its listener by the Nest collector and hands them to a Sender on every
+// interval, so the external system receives regular values no matter how often the readings change.
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultInterval is the interval of pushing readings if it isn't configured.
+const DefaultInterval = time.Minute
+
+// Sender sends readings to an external system.
+type Sender interface {
+	Send(ctx context.Context, thermostats []*nest.Thermostat) error
+}
+
+// Pusher sends the latest readings with a Sender on a fixed interval.
+type Pusher struct {
+	name     string
+	sender   Sender
+	interval time.Duration
+	logger   log.Logger
+
+	mu          sync.Mutex
+	thermostats []*nest.Thermostat
+}
+
+// NewPusher creates a Pusher sending readings with the sender on the interval. The name of the external system is
+// used in logs. Logger is optional, if it's nil the Pusher doesn't log anything.
+func NewPusher(name string, sender Sender, interval time.Duration, logger log.Logger) *Pusher {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Pusher{
+		name:     name,
+		sender:   sender,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Listener returns a nest.Listener keeping the latest readings, which are sent on the next interval.
+func (p *Pusher) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.thermostats = thermostats
+	}
+}
+
+// Run sends the latest readings on every interval until the context is cancelled. Nothing is sent until the first
+// readings are collected.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			thermostats := p.thermostats
+			p.mu.Unlock()
+
+			if len(thermostats) == 0 {
+				continue
+			}
+
+			if err := p.sender.Send(ctx, thermostats); err != nil {
+				p.logger.Log("level", "error", "message", "Failed sending readings to "+p.name, "stack", errors.WithStack(err))
+				continue
+			}
+			p.logger.Log("level", "debug", "message", "Successfully sent readings to "+p.name)
+		}
+	}
+}
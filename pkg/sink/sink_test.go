@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+type senderFunc func(ctx context.Context, thermostats []*nest.Thermostat) error
+
+func (f senderFunc) Send(ctx context.Context, thermostats []*nest.Thermostat) error {
+	return f(ctx, thermostats)
+}
+
+func TestPusher(t *testing.T) {
+	sent := make(chan []*nest.Thermostat, 10)
+	failing := true
+	sender := senderFunc(func(ctx context.Context, thermostats []*nest.Thermostat) error {
+		sent <- thermostats
+		if failing {
+			failing = false
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	p := NewPusher("test", sender, 10*time.Millisecond, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	// Nothing is sent before the first readings.
+	select {
+	case <-sent:
+		t.Fatal("unexpected send without readings")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	readings := []*nest.Thermostat{{ID: "enterprises/PROJECT_ID/devices/DEVICE_ID"}}
+	p.Listener()(readings)
+
+	// The same readings are sent on every interval, failures don't stop the pusher.
+	for i := 0; i < 2; i++ {
+		select {
+		case thermostats := <-sent:
+			assert.Equal(t, readings, thermostats)
+		case <-time.After(time.Second):
+			t.Fatal("readings weren't sent")
+		}
+	}
+}
+
+func TestDefaultInterval(t *testing.T) {
+	assert.Equal(t, DefaultInterval, NewPusher("test", nil, 0, nil).interval)
+}
@@ -0,0 +1,8 @@
+// Package slogadapter connects the go-kit loggers used by the exporter and its collectors with log/slog.
+//
+// Collectors take a go-kit log.Logger, so applications logging with slog pass NewLogger(slogLogger) to them, and
+// their lines end up in the slog handlers of the application, with keys like "device" as attributes. The other way
+// round, NewHandler lets code written against slog log to an existing go-kit logger.
+//
+// log/slog requires Go 1.21, the package is empty when built with older versions.
+package slogadapter
@@ -0,0 +1,153 @@
+//go:build go1.21
+// +build go1.21
+
+package slogadapter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// NewLogger returns a go-kit logger passing log lines to the handler of the slog logger. The "level" key selects the
+// level of the record, "message" or "msg" its message, the other keys become attributes. Lines without a level are
+// logged at the info level, lines below the level enabled by the handler are dropped.
+func NewLogger(logger *slog.Logger) log.Logger {
+	return &slogLogger{handler: logger.Handler()}
+}
+
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// Log implements the log.Logger interface.
+func (l *slogLogger) Log(keyvals ...interface{}) error {
+	level := slog.LevelInfo
+	var message string
+	attrs := make([]slog.Attr, 0, len(keyvals)/2)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = log.ErrMissingValue
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		switch key {
+		case "level":
+			level = parseLevel(fmt.Sprint(value))
+		case "message", "msg":
+			message = fmt.Sprint(value)
+		default:
+			attrs = append(attrs, slog.Any(key, value))
+		}
+	}
+
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	record := slog.NewRecord(time.Now(), level, message, 0)
+	record.AddAttrs(attrs...)
+	return l.handler.Handle(ctx, record)
+}
+
+// parseLevel returns the slog level of a go-kit level, eg. "warn" from level.Warn().
+func parseLevel(value string) slog.Level {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// NewHandler returns a slog handler logging records to the go-kit logger, with the "level" and "message" keys used
+// by the exporter followed by the attributes. Attributes in groups are prefixed with the group names, eg. "scrape.id".
+// All levels are enabled, filter them with the go-kit logger.
+func NewHandler(logger log.Logger) slog.Handler {
+	return &kitHandler{logger: logger}
+}
+
+type kitHandler struct {
+	logger log.Logger
+	prefix string
+	attrs  []interface{}
+}
+
+// Enabled implements the slog.Handler interface.
+func (h *kitHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements the slog.Handler interface.
+func (h *kitHandler) Handle(_ context.Context, record slog.Record) error {
+	keyvals := make([]interface{}, 0, 4+len(h.attrs)+2*record.NumAttrs())
+	keyvals = append(keyvals, "level", levelName(record.Level), "message", record.Message)
+	keyvals = append(keyvals, h.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		keyvals = appendAttr(keyvals, h.prefix, attr)
+		return true
+	})
+	return h.logger.Log(keyvals...)
+}
+
+// WithAttrs implements the slog.Handler interface.
+func (h *kitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	keyvals := append([]interface{}{}, h.attrs...)
+	for _, attr := range attrs {
+		keyvals = appendAttr(keyvals, h.prefix, attr)
+	}
+	return &kitHandler{logger: h.logger, prefix: h.prefix, attrs: keyvals}
+}
+
+// WithGroup implements the slog.Handler interface.
+func (h *kitHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &kitHandler{logger: h.logger, prefix: h.prefix + name + ".", attrs: h.attrs}
+}
+
+// appendAttr appends the key and value of the attribute to keyvals, flattening groups into prefixed keys.
+func appendAttr(keyvals []interface{}, prefix string, attr slog.Attr) []interface{} {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		// Attributes of inlined groups without a key keep the current prefix.
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			keyvals = appendAttr(keyvals, prefix, groupAttr)
+		}
+		return keyvals
+	}
+	if attr.Equal(slog.Attr{}) {
+		return keyvals
+	}
+	return append(keyvals, prefix+attr.Key, value.Any())
+}
+
+// levelName returns the go-kit level of a slog level. Levels in between are rounded down, eg. slog.LevelInfo+2 is
+// "info".
+func levelName(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warn"
+	case level >= slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
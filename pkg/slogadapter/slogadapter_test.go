@@ -0,0 +1,58 @@
+//go:build go1.21
+// +build go1.21
+
+package slogadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	logger := NewLogger(slog.New(handler).With("scrape", "nest"))
+
+	assert.NoError(t, logger.Log("level", "warn", "message", "Failed fetching Nest device", "device", "DEVICE_ID"))
+	assert.NoError(t, level.Error(logger).Log("msg", "Failed collecting", "odd"))
+	assert.NoError(t, logger.Log("level", "debug", "message", "Dropped below the level of the handler"))
+
+	var lines []map[string]interface{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var line map[string]interface{}
+		assert.NoError(t, decoder.Decode(&line))
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "WARN", "msg": "Failed fetching Nest device", "scrape": "nest", "device": "DEVICE_ID"},
+		{"level": "ERROR", "msg": "Failed collecting", "scrape": "nest", "odd": log.ErrMissingValue.Error()},
+	}, lines)
+}
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(log.NewLogfmtLogger(&buf)))
+
+	logger.With("scrape", 1).WithGroup("device").Warn("Thermostat offline", "id", "DEVICE_ID", slog.Group("traits", "count", 2))
+	logger.Debug("Collected")
+
+	assert.Equal(t, `level=warn message="Thermostat offline" scrape=1 device.id=DEVICE_ID device.traits.count=2
+level=debug message=Collected
+`, buf.String())
+}
@@ -0,0 +1,143 @@
+// Package smoothing exports smoothed ambient temperature and humidity readings of thermostats, along with the raw
+// readings exported by the Nest collector.
+//
+// Thermostats round their readings and they jitter around thresholds, which makes alerts on the raw readings flap.
+// Readings are smoothed with an exponentially weighted moving average (EWMA). Alpha is the weight of a new reading. With
+// a window, the weight depends on the time since the previous reading instead, so readings received in bursts, eg.
+// from events, don't weigh more than readings of a steady scrape interval: a reading after a full window replaces
+// about 63% of the average.
+package smoothing
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/units"
+)
+
+// DefaultAlpha is the weight of a new reading in the moving average.
+const DefaultAlpha = 0.3
+
+var errInvalidParameters = errors.New("invalid smoothing parameters; expected smoothing factor between 0 and 1 and positive window")
+
+// Config provides the configuration necessary to create the Smoother. Alpha defaults to DefaultAlpha, it's ignored if
+// Window is set. Unit is the unit of the smoothed temperatures: celsius (default), fahrenheit, kelvin or both. Labels
+// identify thermostats like the metrics of the Nest collector.
+type Config struct {
+	Alpha  float64
+	Window time.Duration
+	Unit   string
+	Labels nest.MetricLabels
+}
+
+// Smoother smooths readings of thermostats and exports the moving averages.
+type Smoother struct {
+	alpha  float64
+	window time.Duration
+	units  []string
+	labels nest.MetricLabels
+
+	mu          sync.Mutex
+	thermostats map[string]*average
+
+	temperature map[string]*prometheus.Desc
+	humidity    *prometheus.Desc
+}
+
+// average contains the moving averages of the readings of a thermostat. The temperature is in Celsius.
+type average struct {
+	therm       *nest.Thermostat
+	at          time.Time
+	temperature float64
+	humidity    float64
+}
+
+// New creates a Smoother using the given Config. It returns an error if the smoothing factor isn't between 0 and 1 or
+// the window is negative.
+func New(cfg Config) (*Smoother, error) {
+	if cfg.Alpha == 0 {
+		cfg.Alpha = DefaultAlpha
+	}
+	if cfg.Alpha < 0 || cfg.Alpha > 1 || cfg.Window < 0 {
+		return nil, errInvalidParameters
+	}
+
+	exported, err := units.Parse(cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := cfg.Labels.Names()
+	s := &Smoother{
+		alpha:       cfg.Alpha,
+		window:      cfg.Window,
+		units:       exported,
+		labels:      cfg.Labels,
+		thermostats: make(map[string]*average),
+		temperature: make(map[string]*prometheus.Desc),
+		humidity:    prometheus.NewDesc("nest_humidity_smoothed_ratio", "Exponentially weighted moving average of the inside humidity.", labels, nil),
+	}
+
+	for _, unit := range exported {
+		s.temperature[unit] = prometheus.NewDesc("nest_ambient_temperature_smoothed_"+unit, "Exponentially weighted moving average of the inside temperature.", labels, nil)
+	}
+
+	return s, nil
+}
+
+// Listener returns a nest.Listener adding new readings of thermostats to their moving averages. It must be registered
+// with nest.WithUpdateListener, so every reading is added once.
+func (s *Smoother) Listener() nest.Listener {
+	return func(thermostats []*nest.Thermostat) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, therm := range thermostats {
+			avg, ok := s.thermostats[therm.ID]
+			if !ok {
+				s.thermostats[therm.ID] = &average{therm: therm, at: therm.UpdatedAt, temperature: therm.AmbientTemp, humidity: therm.Humidity}
+				continue
+			}
+
+			alpha := s.weight(therm.UpdatedAt.Sub(avg.at))
+			avg.temperature += alpha * (therm.AmbientTemp - avg.temperature)
+			avg.humidity += alpha * (therm.Humidity - avg.humidity)
+			avg.therm, avg.at = therm, therm.UpdatedAt
+		}
+	}
+}
+
+// weight returns the weight of a reading taken the given time after the previous one.
+func (s *Smoother) weight(elapsed time.Duration) float64 {
+	if s.window == 0 {
+		return s.alpha
+	}
+	return 1 - math.Exp(-elapsed.Seconds()/s.window.Seconds())
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *Smoother) Describe(ch chan<- *prometheus.Desc) {
+	for _, unit := range s.units {
+		ch <- s.temperature[unit]
+	}
+	ch <- s.humidity
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *Smoother) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, avg := range s.thermostats {
+		labels := s.labels.Values(avg.therm)
+		for _, unit := range s.units {
+			ch <- prometheus.MustNewConstMetric(s.temperature[unit], prometheus.GaugeValue, units.FromCelsius(avg.temperature, unit), labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(s.humidity, prometheus.GaugeValue, avg.humidity/100, labels...)
+	}
+}
@@ -0,0 +1,66 @@
+package smoothing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func thermostat(temp, humidity float64, at time.Time) []*nest.Thermostat {
+	return []*nest.Thermostat{{
+		ID:          "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:    "DEVICE_ID",
+		Label:       "Living-Room",
+		AmbientTemp: temp,
+		Humidity:    humidity,
+		UpdatedAt:   at,
+	}}
+}
+
+func TestSmoother(t *testing.T) {
+	s, err := New(Config{Alpha: 0.5, Unit: "both"})
+	assert.NoError(t, err)
+	listener := s.Listener()
+
+	now := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	listener(thermostat(20, 40, now))
+	listener(thermostat(21, 50, now.Add(time.Minute)))
+
+	labels := `device_id="DEVICE_ID",id="enterprises/PROJECT_ID/devices/DEVICE_ID",label="Living-Room"`
+	expected := `
+# HELP nest_ambient_temperature_smoothed_celsius Exponentially weighted moving average of the inside temperature.
+# TYPE nest_ambient_temperature_smoothed_celsius gauge
+nest_ambient_temperature_smoothed_celsius{` + labels + `} 20.5
+# HELP nest_ambient_temperature_smoothed_fahrenheit Exponentially weighted moving average of the inside temperature.
+# TYPE nest_ambient_temperature_smoothed_fahrenheit gauge
+nest_ambient_temperature_smoothed_fahrenheit{` + labels + `} 68.9
+# HELP nest_humidity_smoothed_ratio Exponentially weighted moving average of the inside humidity.
+# TYPE nest_humidity_smoothed_ratio gauge
+nest_humidity_smoothed_ratio{` + labels + `} 0.45
+`
+	assert.NoError(t, testutil.CollectAndCompare(s, strings.NewReader(expected)))
+}
+
+func TestWindow(t *testing.T) {
+	s, err := New(Config{Window: 10 * time.Minute})
+	assert.NoError(t, err)
+
+	assert.InDelta(t, 0.632, s.weight(10*time.Minute), 0.001)
+	assert.InDelta(t, 0.095, s.weight(time.Minute), 0.001, "readings in quick succession weigh less")
+	assert.Equal(t, 0.0, s.weight(0))
+}
+
+func TestInvalidParameters(t *testing.T) {
+	for _, cfg := range []Config{{Alpha: 1.5}, {Alpha: -0.1}, {Window: -time.Minute}} {
+		_, err := New(cfg)
+		assert.Error(t, err)
+	}
+
+	_, err := New(Config{Unit: "rankine"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,404 @@
+// Package snmp serves thermostat readings with an embedded SNMP agent, for legacy monitoring systems which poll SNMP
+// instead of scraping Prometheus metrics.
+//
+// The agent answers SNMPv1 and SNMPv2c Get, GetNext and GetBulk requests of the configured community. Objects are
+// described in docs/PRONESTHEUS-MIB.txt: the number of thermostats and a table with a row per thermostat, under the
+// base OID. Temperatures are in tenths of a degree Celsius, because SNMP doesn't have floating point numbers.
+package snmp
+
+import (
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gosnmp/gosnmp"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultBaseOID is the OID of the MIB module. It's in the experimental arc, because the project doesn't have
+// a private enterprise number.
+const DefaultBaseOID = "1.3.6.1.3.9777"
+
+// maxPacketSize is the maximum size of a UDP datagram.
+const maxPacketSize = 65507
+
+// Columns of the thermostat table.
+const (
+	columnIndex = iota + 1
+	columnID
+	columnDeviceID
+	columnLabel
+	columnAmbientTemp
+	columnSetpointTemp
+	columnHumidity
+	columnHeating
+	columnStatus
+	columnMode
+)
+
+var (
+	errInvalidOID         = errors.New("invalid OID")
+	errFailedListening    = errors.New("failed listening for SNMP requests")
+	errFailedDecoding     = errors.New("failed decoding SNMP request")
+	errFailedEncoding     = errors.New("failed encoding SNMP response")
+	errUnsupportedPDU     = errors.New("unsupported SNMP request type")
+	errUnsupportedVersion = errors.New("unsupported SNMP version; only v1 and v2c are supported")
+)
+
+// Config provides the configuration necessary to create the Agent.
+// Logger is optional, if it's nil the Agent doesn't log anything. BaseOID defaults to DefaultBaseOID.
+type Config struct {
+	Logger    log.Logger
+	Addr      string
+	Community string
+	BaseOID   string
+}
+
+// Agent answers SNMP requests with the latest readings of thermostats.
+type Agent struct {
+	conn      net.PacketConn
+	community string
+	base      oid
+	logger    log.Logger
+
+	mu      sync.RWMutex
+	objects []object
+}
+
+// oid is a parsed object identifier.
+type oid []int
+
+// object is a value in the MIB.
+type object struct {
+	oid   oid
+	typ   gosnmp.Asn1BER
+	value interface{}
+}
+
+// New creates an Agent using the given Config and starts listening on its address. It doesn't answer requests until
+// Run is called.
+func New(cfg Config) (*Agent, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.BaseOID == "" {
+		cfg.BaseOID = DefaultBaseOID
+	}
+
+	base, err := parseOID(cfg.BaseOID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenPacket("udp", cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrap(errFailedListening, err.Error())
+	}
+
+	a := &Agent{
+		conn:      conn,
+		community: cfg.Community,
+		base:      base,
+		logger:    cfg.Logger,
+	}
+	a.Update(nil)
+
+	return a, nil
+}
+
+// Addr returns the address the Agent listens on.
+func (a *Agent) Addr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// Listener returns a nest.Listener updating the readings served by the Agent.
+func (a *Agent) Listener() nest.Listener {
+	return a.Update
+}
+
+// Update replaces the served readings with current readings of thermostats. Rows of the thermostat table are ordered
+// by the resource names of thermostats, so indexes only change when thermostats are added or removed.
+func (a *Agent) Update(thermostats []*nest.Thermostat) {
+	sorted := make([]*nest.Thermostat, len(thermostats))
+	copy(sorted, thermostats)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	objects := []object{
+		{oid: a.base.child(1, 0), typ: gosnmp.Gauge32, value: uint32(len(sorted))},
+	}
+
+	for i, therm := range sorted {
+		heating := 0
+		if therm.Status == "HEATING" {
+			heating = 1
+		}
+
+		index := i + 1
+		row := func(column int, typ gosnmp.Asn1BER, value interface{}) object {
+			return object{oid: a.base.child(2, 1, column, index), typ: typ, value: value}
+		}
+
+		objects = append(objects,
+			row(columnIndex, gosnmp.Integer, index),
+			row(columnID, gosnmp.OctetString, therm.ID),
+			row(columnDeviceID, gosnmp.OctetString, therm.DeviceID),
+			row(columnLabel, gosnmp.OctetString, therm.Label),
+			row(columnAmbientTemp, gosnmp.Integer, tenths(therm.AmbientTemp)),
+			row(columnSetpointTemp, gosnmp.Integer, tenths(therm.SetpointTemp)),
+			row(columnHumidity, gosnmp.Integer, int(math.Round(therm.Humidity))),
+			row(columnHeating, gosnmp.Integer, heating),
+			row(columnStatus, gosnmp.OctetString, therm.Status),
+			row(columnMode, gosnmp.OctetString, therm.Mode),
+		)
+	}
+
+	// GetNext requests walk objects in lexicographic order of their OIDs, eg. columns before rows.
+	sort.Slice(objects, func(i, j int) bool { return objects[i].oid.less(objects[j].oid) })
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.objects = objects
+}
+
+// Run answers requests until the context is cancelled.
+func (a *Agent) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		a.conn.Close()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.logger.Log("level", "error", "message", "Failed reading SNMP request", "err", err)
+			continue
+		}
+
+		res, err := a.handle(buf[:n])
+		if err != nil {
+			a.logger.Log("level", "warn", "message", "Failed handling SNMP request", "from", addr, "err", err)
+			continue
+		}
+
+		if res == nil {
+			continue
+		}
+
+		if _, err := a.conn.WriteTo(res, addr); err != nil {
+			a.logger.Log("level", "error", "message", "Failed sending SNMP response", "to", addr, "err", err)
+		}
+	}
+}
+
+// handle returns the encoded response to the request, or nil if it should be dropped.
+func (a *Agent) handle(data []byte) ([]byte, error) {
+	req, err := (&gosnmp.GoSNMP{}).SnmpDecodePacket(data)
+	if err != nil {
+		return nil, errors.Wrap(errFailedDecoding, err.Error())
+	}
+
+	if req.Version != gosnmp.Version1 && req.Version != gosnmp.Version2c {
+		return nil, errUnsupportedVersion
+	}
+
+	// Agents silently drop requests with a wrong community.
+	if req.Community != a.community {
+		return nil, nil
+	}
+
+	res := &gosnmp.SnmpPacket{
+		Version:   req.Version,
+		Community: req.Community,
+		PDUType:   gosnmp.GetResponse,
+		RequestID: req.RequestID,
+	}
+
+	if err := a.respond(req, res); err != nil {
+		return nil, err
+	}
+
+	out, err := res.MarshalMsg()
+	if err != nil {
+		return nil, errors.Wrap(errFailedEncoding, err.Error())
+	}
+
+	return out, nil
+}
+
+// respond sets variables of the response to the request.
+func (a *Agent) respond(req, res *gosnmp.SnmpPacket) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	switch req.PDUType {
+	case gosnmp.GetRequest:
+		res.Variables, res.Error, res.ErrorIndex = a.get(req)
+	case gosnmp.GetNextRequest:
+		res.Variables, res.Error, res.ErrorIndex = a.getNext(req)
+	case gosnmp.GetBulkRequest:
+		res.Variables = a.getBulk(req)
+	default:
+		return errors.Wrapf(errUnsupportedPDU, "%#x", byte(req.PDUType))
+	}
+
+	return nil
+}
+
+// get returns the requested objects. SNMPv1 reports missing objects with an error, SNMPv2c with exceptions.
+func (a *Agent) get(req *gosnmp.SnmpPacket) ([]gosnmp.SnmpPDU, gosnmp.SNMPError, uint8) {
+	variables := make([]gosnmp.SnmpPDU, len(req.Variables))
+	for i, v := range req.Variables {
+		name, err := parseOID(v.Name)
+		if err == nil {
+			if obj, ok := a.find(name); ok {
+				variables[i] = obj.pdu()
+				continue
+			}
+		}
+
+		if req.Version == gosnmp.Version1 {
+			return req.Variables, gosnmp.NoSuchName, uint8(i + 1)
+		}
+		variables[i] = gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject}
+	}
+
+	return variables, gosnmp.NoError, 0
+}
+
+// getNext returns the objects following the requested ones.
+func (a *Agent) getNext(req *gosnmp.SnmpPacket) ([]gosnmp.SnmpPDU, gosnmp.SNMPError, uint8) {
+	variables := make([]gosnmp.SnmpPDU, len(req.Variables))
+	for i, v := range req.Variables {
+		pdu, ok := a.next(v.Name)
+		if !ok && req.Version == gosnmp.Version1 {
+			return req.Variables, gosnmp.NoSuchName, uint8(i + 1)
+		}
+		variables[i] = pdu
+	}
+
+	return variables, gosnmp.NoError, 0
+}
+
+// getBulk returns the objects following the non-repeaters once and up to max repetitions of objects following
+// the rest, as described in RFC 3416.
+func (a *Agent) getBulk(req *gosnmp.SnmpPacket) []gosnmp.SnmpPDU {
+	nonRepeaters := int(req.NonRepeaters)
+	if nonRepeaters > len(req.Variables) {
+		nonRepeaters = len(req.Variables)
+	}
+
+	var variables []gosnmp.SnmpPDU
+	for _, v := range req.Variables[:nonRepeaters] {
+		pdu, _ := a.next(v.Name)
+		variables = append(variables, pdu)
+	}
+
+	names := make([]string, 0, len(req.Variables)-nonRepeaters)
+	for _, v := range req.Variables[nonRepeaters:] {
+		names = append(names, v.Name)
+	}
+
+	for r := 0; r < int(req.MaxRepetitions) && len(names) > 0; r++ {
+		ended := true
+		for i, name := range names {
+			pdu, ok := a.next(name)
+			variables = append(variables, pdu)
+			names[i] = pdu.Name
+			ended = ended && !ok
+		}
+
+		if ended {
+			break
+		}
+	}
+
+	return variables
+}
+
+// find returns the object with the OID.
+func (a *Agent) find(name oid) (object, bool) {
+	i := sort.Search(len(a.objects), func(i int) bool { return !a.objects[i].oid.less(name) })
+	if i < len(a.objects) && a.objects[i].oid.equal(name) {
+		return a.objects[i], true
+	}
+	return object{}, false
+}
+
+// next returns the object following the OID, or the end of MIB view exception if there isn't any.
+func (a *Agent) next(name string) (gosnmp.SnmpPDU, bool) {
+	parsed, err := parseOID(name)
+	if err == nil {
+		i := sort.Search(len(a.objects), func(i int) bool { return parsed.less(a.objects[i].oid) })
+		if i < len(a.objects) {
+			return a.objects[i].pdu(), true
+		}
+	}
+
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.EndOfMibView}, false
+}
+
+func (o object) pdu() gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: o.oid.String(), Type: o.typ, Value: o.value}
+}
+
+// parseOID parses an OID in dotted notation, with or without the leading dot.
+func parseOID(s string) (oid, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	parsed := make(oid, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, errors.Wrap(errInvalidOID, s)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// child returns the OID of a descendant of the OID.
+func (o oid) child(arcs ...int) oid {
+	child := make(oid, 0, len(o)+len(arcs))
+	child = append(child, o...)
+	return append(child, arcs...)
+}
+
+// less returns true if the OID precedes the other one in lexicographic order.
+func (o oid) less(other oid) bool {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] != other[i] {
+			return o[i] < other[i]
+		}
+	}
+	return len(o) < len(other)
+}
+
+func (o oid) equal(other oid) bool {
+	return !o.less(other) && !other.less(o)
+}
+
+// String returns the OID in dotted notation with the leading dot, as used by gosnmp.
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.Itoa(n)
+	}
+	return "." + strings.Join(parts, ".")
+}
+
+// tenths converts a temperature into tenths of a degree.
+func tenths(temp float64) int {
+	return int(math.Round(temp * 10))
+}
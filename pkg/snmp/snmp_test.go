@@ -0,0 +1,179 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var thermostats = []*nest.Thermostat{
+	{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_2",
+		DeviceID:     "DEVICE_2",
+		Label:        "Bedroom",
+		AmbientTemp:  18.04,
+		SetpointTemp: 17,
+		Humidity:     51.6,
+		Status:       "OFF",
+		Mode:         "ECO",
+	},
+	{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_1",
+		DeviceID:     "DEVICE_1",
+		Label:        "Living Room",
+		AmbientTemp:  20.55,
+		SetpointTemp: 21,
+		Humidity:     45,
+		Status:       "HEATING",
+		Mode:         "HEAT",
+	},
+}
+
+func startAgent(t *testing.T) (*Agent, func()) {
+	a, err := New(Config{Addr: "127.0.0.1:0", Community: "secret", BaseOID: ".1.3.6.1.3.9777"})
+	assert.NoError(t, err)
+	a.Update(thermostats)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.Run(ctx)
+
+	return a, cancel
+}
+
+func client(t *testing.T, a *Agent, version gosnmp.SnmpVersion, community string) *gosnmp.GoSNMP {
+	addr := a.Addr().(*net.UDPAddr)
+	c := &gosnmp.GoSNMP{
+		Target:    addr.IP.String(),
+		Port:      uint16(addr.Port),
+		Community: community,
+		Version:   version,
+		Timeout:   time.Second,
+		Retries:   0,
+	}
+	assert.NoError(t, c.Connect())
+
+	return c
+}
+
+func TestGet(t *testing.T) {
+	a, stop := startAgent(t)
+	defer stop()
+
+	c := client(t, a, gosnmp.Version2c, "secret")
+	defer c.Conn.Close()
+
+	res, err := c.Get([]string{
+		".1.3.6.1.3.9777.1.0",
+		".1.3.6.1.3.9777.2.1.4.1",
+		".1.3.6.1.3.9777.2.1.5.1",
+		".1.3.6.1.3.9777.2.1.7.1",
+		".1.3.6.1.3.9777.2.1.8.1",
+		".1.3.6.1.3.9777.2.1.5.2",
+		".1.3.6.1.3.9777.2.1.5.3",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint(2), res.Variables[0].Value)
+	assert.Equal(t, []byte("Living Room"), res.Variables[1].Value)
+	assert.Equal(t, 206, res.Variables[2].Value)
+	assert.Equal(t, 45, res.Variables[3].Value)
+	assert.Equal(t, 1, res.Variables[4].Value)
+	assert.Equal(t, 180, res.Variables[5].Value)
+	assert.Equal(t, gosnmp.NoSuchObject, res.Variables[6].Type)
+}
+
+func TestGetV1(t *testing.T) {
+	a, stop := startAgent(t)
+	defer stop()
+
+	c := client(t, a, gosnmp.Version1, "secret")
+	defer c.Conn.Close()
+
+	res, err := c.Get([]string{".1.3.6.1.3.9777.2.1.10.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ECO"), res.Variables[0].Value)
+
+	res, err = c.Get([]string{".1.3.6.1.3.9777.1.0", ".1.3.6.1.3.9777.3.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, gosnmp.NoSuchName, res.Error)
+	assert.Equal(t, uint8(2), res.ErrorIndex)
+}
+
+func TestWalk(t *testing.T) {
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		t.Run(version.String(), func(t *testing.T) {
+			a, stop := startAgent(t)
+			defer stop()
+
+			c := client(t, a, version, "secret")
+			defer c.Conn.Close()
+
+			// The client walks with GetNext in SNMPv1 and GetBulk in SNMPv2c.
+			var names []string
+			err := c.BulkWalk(".1.3.6.1.3.9777.2.1.3", func(pdu gosnmp.SnmpPDU) error {
+				names = append(names, pdu.Name+"="+string(pdu.Value.([]byte)))
+				return nil
+			})
+			assert.NoError(t, err)
+
+			assert.Equal(t, []string{
+				".1.3.6.1.3.9777.2.1.3.1=DEVICE_1",
+				".1.3.6.1.3.9777.2.1.3.2=DEVICE_2",
+			}, names)
+		})
+	}
+}
+
+func TestWalkAll(t *testing.T) {
+	a, stop := startAgent(t)
+	defer stop()
+
+	c := client(t, a, gosnmp.Version2c, "secret")
+	defer c.Conn.Close()
+
+	pdus, err := c.BulkWalkAll(".1.3.6.1.3.9777")
+	assert.NoError(t, err)
+	// The count and 10 columns of 2 thermostats.
+	assert.Len(t, pdus, 21)
+}
+
+func TestWrongCommunity(t *testing.T) {
+	a, stop := startAgent(t)
+	defer stop()
+
+	c := client(t, a, gosnmp.Version2c, "public")
+	defer c.Conn.Close()
+
+	_, err := c.Get([]string{".1.3.6.1.3.9777.1.0"})
+	assert.Error(t, err)
+}
+
+func TestOIDOrder(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.3.6", "1.3.6.1", true},
+		{"1.3.6.1", "1.3.6", false},
+		{"1.3.6.2", "1.3.6.10", true},
+		{"1.3.6.1", "1.3.6.1", false},
+	}
+
+	for _, tt := range tests {
+		a, err := parseOID(tt.a)
+		assert.NoError(t, err)
+		b, err := parseOID(tt.b)
+		assert.NoError(t, err)
+
+		assert.Equal(t, tt.want, a.less(b), "%s < %s", tt.a, tt.b)
+	}
+
+	_, err := parseOID("1.3.six")
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/solar"
+)
+
+var (
+	errInvalidSolarLocation           = errors.New("invalid solar location; expected latitude,longitude, eg. 52.37,4.89")
+	errInvalidWeatherFallbackLocation = errors.New("invalid weather fallback location; expected latitude,longitude, eg. 52.37,4.89")
+)
+
+// registerSolarCollector registers the Open-Meteo collector if the location of the home is configured.
+func (e *Exporter) registerSolarCollector(cfg *ExporterConfig) error {
+	if cfg.SolarLocation == nil || *cfg.SolarLocation == "" {
+		return nil
+	}
+
+	latitude, longitude, err := parseLocation(*cfg.SolarLocation, errInvalidSolarLocation)
+	if err != nil {
+		return err
+	}
+
+	solarCollector, err := solar.New(latitude, longitude,
+		solar.WithContext(e.ctx),
+		solar.WithLogger(e.logger),
+		solar.WithTimeout(cfg.collectorTimeout("solar")),
+		solar.WithAPIURL(*cfg.SolarURL),
+		solar.WithTransport(cfg.transport(nil)),
+	)
+	if err != nil {
+		return err
+	}
+
+	return e.register(cfg, "solar", solarCollector)
+}
+
+// parseLocation parses a location given as "latitude,longitude", wrapping errInvalid if it's malformed.
+func parseLocation(location string, errInvalid error) (latitude, longitude float64, err error) {
+	parts := strings.Split(location, ",")
+	if len(parts) != 2 {
+		return 0, 0, errors.Wrap(errInvalid, location)
+	}
+
+	if latitude, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64); err != nil {
+		return 0, 0, errors.Wrap(errInvalid, location)
+	}
+	if longitude, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil {
+		return 0, 0, errors.Wrap(errInvalid, location)
+	}
+
+	return latitude, longitude, nil
+}
@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"encoding/json"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/control"
+	"pronestheus/pkg/state"
+)
+
+// nestState saves and restores counters of the current Nest collector, which is replaced on reloads.
+type nestState struct {
+	collector *reloadableCollector
+}
+
+func (s nestState) MarshalState() ([]byte, error) {
+	return json.Marshal(nestController{s.collector}.current().State())
+}
+
+func (s nestState) RestoreState(data []byte) error {
+	var st nest.State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	nestController{s.collector}.current().RestoreState(&st)
+	return nil
+}
+
+// nestReadings saves and restores the latest readings of the current Nest collector.
+type nestReadings struct {
+	collector *reloadableCollector
+}
+
+func (s nestReadings) MarshalState() ([]byte, error) {
+	return json.Marshal(nestController{s.collector}.current().Readings())
+}
+
+func (s nestReadings) RestoreState(data []byte) error {
+	var thermostats []*nest.Thermostat
+	if err := json.Unmarshal(data, &thermostats); err != nil {
+		return err
+	}
+	nestController{s.collector}.current().RestoreReadings(thermostats)
+	return nil
+}
+
+// setupState creates the Checkpointer if the state file is configured. Sources are added as they're created and
+// restored right away, the Checkpointer only starts saving them in startState.
+func (e *Exporter) setupState(cfg *ExporterConfig) error {
+	if cfg.StateFile == nil || *cfg.StateFile == "" {
+		return nil
+	}
+
+	stateCfg := state.Config{Logger: e.logger, Path: *cfg.StateFile}
+	if cfg.StateFlushInterval != nil {
+		stateCfg.Interval = *cfg.StateFlushInterval
+	}
+
+	checkpointer, err := state.New(stateCfg)
+	if err != nil {
+		return err
+	}
+
+	e.checkpointer = checkpointer
+	return nil
+}
+
+// startState starts saving the state file in the background.
+func (e *Exporter) startState() {
+	if e.checkpointer == nil {
+		return
+	}
+
+	e.runUntilShutdown(e.checkpointer.Run)
+	e.logger.Log("level", "info", "msg", "Saving counters to the state file")
+}
+
+// registerStateHandler serves the state snapshot endpoint with the admin token, exporting and restoring the Nest
+// readings and counters and the accumulators of the daily and filter runtimes.
+func (e *Exporter) registerStateHandler(cfg *ExporterConfig) {
+	if !isSet(cfg.AdminToken) {
+		return
+	}
+
+	handler := state.NewHandler(state.HandlerConfig{Logger: e.logger})
+	handler.Add("nest", nestState{e.nest})
+	handler.Add("nest_readings", nestReadings{e.nest})
+	if e.daily != nil {
+		handler.Add("daily", e.daily)
+	}
+	if e.filter != nil {
+		handler.Add("filter", e.filter)
+	}
+	e.routes[state.Path] = control.RequireAdmin(*cfg.AdminToken, handler)
+}
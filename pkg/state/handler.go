@@ -0,0 +1,138 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// Path is the path of the admin endpoint exporting and restoring the state.
+const Path = "/admin/state"
+
+var (
+	errMethodNotAllowed = errors.New("method not allowed")
+	errInvalidSnapshot  = errors.New("invalid state snapshot")
+	errUnknownSource    = errors.New("unknown state source")
+)
+
+// HandlerConfig provides the configuration necessary to create the Handler. Logger is optional, if it's nil the
+// Handler doesn't log anything.
+type HandlerConfig struct {
+	Logger log.Logger
+}
+
+// Handler exports the state of all sources as a JSON object of their states by name on GET requests, and restores
+// it on PUT requests, eg. to move the exporter to another host without resetting counters. It doesn't authorize
+// requests, the exporter serves it behind control.RequireAdmin.
+type Handler struct {
+	logger log.Logger
+
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// NewHandler creates a Handler using the given HandlerConfig.
+func NewHandler(cfg HandlerConfig) *Handler {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	return &Handler{
+		logger:  cfg.Logger,
+		sources: make(map[string]Source),
+	}
+}
+
+// Add adds the source under the name.
+func (h *Handler) Add(name string, source Source) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sources[name] = source
+}
+
+// Snapshot returns the current state of all sources by name.
+func (h *Handler) Snapshot() (map[string]json.RawMessage, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := make(map[string]json.RawMessage, len(h.sources))
+	for name, source := range h.sources {
+		data, err := source.MarshalState()
+		if err != nil {
+			return nil, errors.Wrap(errFailedWriting, name+": "+err.Error())
+		}
+		snapshot[name] = data
+	}
+	return snapshot, nil
+}
+
+// Restore restores the sources from the snapshot. Sources missing in the snapshot are left unchanged, the snapshot
+// is rejected before restoring anything if it contains unknown sources.
+func (h *Handler) Restore(snapshot map[string]json.RawMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		if _, ok := h.sources[name]; !ok {
+			return errors.Wrap(errUnknownSource, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := h.sources[name].RestoreState(snapshot[name]); err != nil {
+			return errors.Wrap(errFailedRestoring, name+": "+err.Error())
+		}
+	}
+
+	h.logger.Log("level", "info", "message", "Restored state snapshot", "sources", strings.Join(names, ","))
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshot, err := h.Snapshot()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(snapshot)
+
+	case http.MethodPut:
+		var snapshot map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(errInvalidSnapshot, err.Error()))
+			return
+		}
+
+		if err := h.Restore(snapshot); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
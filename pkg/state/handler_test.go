@@ -0,0 +1,59 @@
+package state
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failing is a Source which can't be restored.
+type failing struct{}
+
+func (failing) MarshalState() ([]byte, error) { return []byte(`{}`), nil }
+
+func (failing) RestoreState(data []byte) error { return errors.New("broken") }
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(HandlerConfig{})
+	first, second := &counter{Value: 3}, &counter{Value: 5}
+	h.Add("first", first)
+	h.Add("second", second)
+
+	request := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, Path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"first":{"value":3},"second":{"value":5}}`, w.Body.String())
+
+	// Sources missing in the snapshot are left unchanged.
+	w = request(http.MethodPut, `{"first":{"value":7}}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 7.0, first.Value)
+	assert.Equal(t, 5.0, second.Value)
+
+	w = request(http.MethodPut, `{"first":{"value":1},"third":{}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown state source")
+	assert.Equal(t, 7.0, first.Value, "nothing is restored from snapshots with unknown sources")
+
+	w = request(http.MethodPut, `[`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	h.Add("failing", failing{})
+	w = request(http.MethodPut, `{"failing":{}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "failing: broken")
+
+	w = request(http.MethodPost, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PUT", w.Header().Get("Allow"))
+}
@@ -0,0 +1,169 @@
+// Package state checkpoints counters and accumulators to a file, so _total metrics don't reset on every restart.
+//
+// Every Source is saved under its name in a single JSON file. The file is written on an interval and once more when
+// the Checkpointer stops, replacing the previous file atomically. Sources are restored from the file when they're
+// added, so they should be added before they start counting.
+//
+// The Handler serves the state of sources over HTTP, to export it from one exporter and restore it in another.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// DefaultInterval is the interval of writing the state file.
+const DefaultInterval = time.Minute
+
+var (
+	errFailedLoading   = errors.New("failed loading state file")
+	errFailedWriting   = errors.New("failed writing state file")
+	errFailedRestoring = errors.New("failed restoring state")
+)
+
+// Source is a component with counters which should survive restarts.
+type Source interface {
+	// MarshalState returns the current counters encoded as JSON.
+	MarshalState() ([]byte, error)
+	// RestoreState replaces the counters with ones encoded by MarshalState.
+	RestoreState(data []byte) error
+}
+
+// Config provides the configuration necessary to create the Checkpointer. Logger is optional, if it's nil the
+// Checkpointer doesn't log anything. Interval defaults to DefaultInterval.
+type Config struct {
+	Logger   log.Logger
+	Path     string
+	Interval time.Duration
+}
+
+// Checkpointer saves the state of sources to a file.
+type Checkpointer struct {
+	logger   log.Logger
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	loaded  map[string]json.RawMessage
+	sources map[string]Source
+}
+
+// New creates a Checkpointer using the given Config, loading the state file if it exists.
+func New(cfg Config) (*Checkpointer, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	c := &Checkpointer{
+		logger:   cfg.Logger,
+		path:     cfg.Path,
+		interval: cfg.Interval,
+		loaded:   make(map[string]json.RawMessage),
+		sources:  make(map[string]Source),
+	}
+
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(errFailedLoading, err.Error())
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.loaded); err != nil {
+			return nil, errors.Wrap(errFailedLoading, err.Error())
+		}
+	}
+
+	return c, nil
+}
+
+// Add adds the source under the name, restoring its state from the file if it was saved before.
+func (c *Checkpointer) Add(name string, source Source) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if data, ok := c.loaded[name]; ok {
+		if err := source.RestoreState(data); err != nil {
+			return errors.Wrap(errFailedRestoring, name+": "+err.Error())
+		}
+		c.logger.Log("level", "info", "message", "Restored state", "source", name)
+	}
+
+	c.sources[name] = source
+	return nil
+}
+
+// Run writes the state file on the interval until the context is cancelled, and once more before returning.
+func (c *Checkpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush()
+			return
+		case <-ticker.C:
+			c.flush()
+		}
+	}
+}
+
+// flush writes the state file, logging errors.
+func (c *Checkpointer) flush() {
+	if err := c.Save(); err != nil {
+		c.logger.Log("level", "error", "message", "Failed saving state", "stack", errors.WithStack(err))
+	}
+}
+
+// Save atomically replaces the state file with the current state of all sources. States of sources saved before,
+// which weren't added since the start, are kept.
+func (c *Checkpointer) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.sources))
+	for name := range c.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := c.sources[name].MarshalState()
+		if err != nil {
+			return errors.Wrap(errFailedWriting, name+": "+err.Error())
+		}
+		c.loaded[name] = data
+	}
+
+	data, err := json.MarshalIndent(c.loaded, "", "  ")
+	if err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		return errors.Wrap(errFailedWriting, err.Error())
+	}
+
+	return nil
+}
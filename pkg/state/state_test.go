@@ -0,0 +1,96 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// counter is a Source with a single counter.
+type counter struct {
+	mu    sync.Mutex
+	Value float64 `json:"value"`
+}
+
+func (c *counter) MarshalState() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Marshal(c)
+}
+
+func (c *counter) RestoreState(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return json.Unmarshal(data, c)
+}
+
+func (c *counter) set(value float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Value = value
+}
+
+func tempPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "state.json")
+}
+
+func TestCheckpointer(t *testing.T) {
+	path := tempPath(t)
+
+	c, err := New(Config{Path: path, Interval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	first, second := &counter{Value: 3}, &counter{Value: 5}
+	assert.NoError(t, c.Add("first", first))
+	assert.NoError(t, c.Add("second", second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	first.set(4)
+	cancel()
+	<-done
+
+	restored, err := New(Config{Path: path})
+	assert.NoError(t, err)
+
+	// Sources which aren't added anymore keep their saved state.
+	restoredFirst := &counter{}
+	assert.NoError(t, restored.Add("first", restoredFirst))
+	assert.Equal(t, float64(4), restoredFirst.Value, "the state is saved when the checkpointer stops")
+	assert.NoError(t, restored.Save())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"first": {"value": 4}, "second": {"value": 5}}`, string(data))
+}
+
+func TestInvalidState(t *testing.T) {
+	path := tempPath(t)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"first": "not a counter"}`), 0644))
+	c, err := New(Config{Path: path})
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(c.Add("first", &counter{}), errFailedRestoring))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = New(Config{Path: path})
+	assert.True(t, errors.Is(err, errFailedLoading))
+}
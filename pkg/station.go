@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/collectors/station"
+)
+
+// registerStationCollector registers the collector of weather station uploads and serves them on station.Path if
+// it's enabled. Outside readings of the station are passed to the same listeners as OpenWeatherMap readings.
+func (e *Exporter) registerStationCollector(cfg *ExporterConfig) error {
+	if cfg.Station == nil || !*cfg.Station {
+		return nil
+	}
+
+	stationCfg := station.Config{
+		Logger:    e.logger,
+		Listeners: e.weatherListeners(),
+	}
+
+	if cfg.WeatherUnit != nil {
+		stationCfg.Unit = *cfg.WeatherUnit
+	}
+
+	if cfg.StationPasskey != nil {
+		stationCfg.Passkey = *cfg.StationPasskey
+	}
+
+	stationCollector, err := station.New(stationCfg)
+	if err != nil {
+		return err
+	}
+
+	if err := prometheus.Register(stationCollector); err != nil {
+		return err
+	}
+
+	e.routes[station.Path] = stationCollector
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package statsd sends thermostat readings to a StatsD server as gauges, with DogStatsD tags.
+//
+// Every reading is a gauge like "nest.ambient_temperature_celsius:20.5|g|#device_id:DEVICE_ID,label:Hallway,room:Hall"
+// followed by the configured global tags. Servers without tag support, eg. the original Etsy StatsD, ignore the tags
+// or reject the packets, so the DogStatsD agent or another server understanding the extension is required.
+//
+// See https://docs.datadoghq.com/developers/dogstatsd/datagram_shell for the protocol.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultPort is the port of the StatsD server.
+const DefaultPort = "8125"
+
+// DefaultPrefix is prepended to metric names if it isn't configured.
+const DefaultPrefix = "nest"
+
+// maxPacketSize keeps packets within the usual Ethernet MTU, so they aren't fragmented.
+const maxPacketSize = 1432
+
+// invalidTagChars matches characters which have a special meaning in the protocol and can't be used in tags.
+var invalidTagChars = regexp.MustCompile(`[,|#\s]`)
+
+var (
+	errFailedConnecting = errors.New("failed connecting to StatsD server")
+	errFailedSending    = errors.New("failed sending data to StatsD server")
+)
+
+// Config provides the configuration necessary to create the Sender.
+// Address is the address of the StatsD server, DefaultPort is used if it doesn't have one. Prefix defaults to
+// DefaultPrefix. Tags are added to every gauge, eg. "env:home".
+type Config struct {
+	Address string
+	Prefix  string
+	Tags    []string
+	Timeout time.Duration
+}
+
+// Sender sends readings to StatsD. It implements sink.Sender.
+type Sender struct {
+	address string
+	prefix  string
+	tags    []string
+	timeout time.Duration
+}
+
+// New creates a Sender using the given Config.
+func New(cfg Config) *Sender {
+	address := cfg.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+
+	var tags []string
+	for _, tag := range cfg.Tags {
+		if tag = sanitize(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return &Sender{
+		address: address,
+		prefix:  strings.TrimSuffix(cfg.Prefix, "."),
+		tags:    tags,
+		timeout: cfg.Timeout,
+	}
+}
+
+// Send sends readings of thermostats to StatsD. Delivery isn't confirmed by the server, so errors are only returned
+// if the packets couldn't be sent.
+func (s *Sender) Send(ctx context.Context, thermostats []*nest.Thermostat) error {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "udp", s.address)
+	if err != nil {
+		return errors.Wrap(errFailedConnecting, err.Error())
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	for _, packet := range s.packets(thermostats) {
+		if _, err := conn.Write(packet); err != nil {
+			return errors.Wrap(errFailedSending, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// packets returns the gauges with readings of thermostats, batched into packets of at most maxPacketSize bytes.
+func (s *Sender) packets(thermostats []*nest.Thermostat) [][]byte {
+	var packets [][]byte
+	var buf bytes.Buffer
+
+	add := func(line string) {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxPacketSize {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+
+	for _, therm := range thermostats {
+		tags := append([]string{
+			"device_id:" + sanitize(therm.DeviceID),
+			"label:" + sanitize(therm.Label),
+			"room:" + sanitize(therm.Room),
+		}, s.tags...)
+		suffix := "|g|#" + strings.Join(tags, ",")
+
+		heating := 0.0
+		if therm.Status == "HEATING" {
+			heating = 1
+		}
+
+		gauge := func(metric string, value float64) {
+			add(s.prefix + "." + metric + ":" + strconv.FormatFloat(value, 'f', -1, 64) + suffix)
+		}
+
+		gauge("ambient_temperature_celsius", therm.AmbientTemp)
+		gauge("setpoint_temperature_celsius", therm.SetpointTemp)
+		gauge("humidity_percent", therm.Humidity)
+		gauge("heating", heating)
+	}
+
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+
+	return packets
+}
+
+// sanitize replaces characters which can't be used in tags with underscores.
+func sanitize(tag string) string {
+	return invalidTagChars.ReplaceAllString(strings.TrimSpace(tag), "_")
+}
@@ -0,0 +1,117 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var thermostats = []*nest.Thermostat{
+	{
+		DeviceID:     "DEVICE_1",
+		Label:        "Main Thermostat",
+		Room:         "Living Room",
+		AmbientTemp:  20.5,
+		SetpointTemp: 19,
+		Humidity:     45,
+		Status:       "HEATING",
+	},
+	{
+		DeviceID:     "DEVICE_2",
+		AmbientTemp:  18,
+		SetpointTemp: 17.5,
+		Humidity:     50,
+		Status:       "OFF",
+	},
+}
+
+func TestPackets(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "default prefix",
+			want: `nest.ambient_temperature_celsius:20.5|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room
+nest.setpoint_temperature_celsius:19|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room
+nest.humidity_percent:45|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room
+nest.heating:1|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room
+nest.ambient_temperature_celsius:18|g|#device_id:DEVICE_2,label:,room:
+nest.setpoint_temperature_celsius:17.5|g|#device_id:DEVICE_2,label:,room:
+nest.humidity_percent:50|g|#device_id:DEVICE_2,label:,room:
+nest.heating:0|g|#device_id:DEVICE_2,label:,room:`,
+		}, {
+			name: "prefix and global tags",
+			cfg:  Config{Prefix: "home.", Tags: []string{"env:home", " site:main floor ", ""}},
+			want: `home.ambient_temperature_celsius:20.5|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room,env:home,site:main_floor
+home.setpoint_temperature_celsius:19|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room,env:home,site:main_floor
+home.humidity_percent:45|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room,env:home,site:main_floor
+home.heating:1|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room,env:home,site:main_floor
+home.ambient_temperature_celsius:18|g|#device_id:DEVICE_2,label:,room:,env:home,site:main_floor
+home.setpoint_temperature_celsius:17.5|g|#device_id:DEVICE_2,label:,room:,env:home,site:main_floor
+home.humidity_percent:50|g|#device_id:DEVICE_2,label:,room:,env:home,site:main_floor
+home.heating:0|g|#device_id:DEVICE_2,label:,room:,env:home,site:main_floor`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Address = "statsd"
+			packets := New(tt.cfg).packets(thermostats)
+			assert.Len(t, packets, 1)
+			assert.Equal(t, tt.want, string(packets[0]))
+		})
+	}
+}
+
+func TestPacketSize(t *testing.T) {
+	var many []*nest.Thermostat
+	for i := 0; i < 20; i++ {
+		many = append(many, thermostats[0])
+	}
+
+	packets := New(Config{Address: "statsd"}).packets(many)
+	assert.True(t, len(packets) > 1)
+
+	var lines int
+	for _, packet := range packets {
+		assert.True(t, len(packet) <= maxPacketSize)
+		assert.False(t, strings.HasSuffix(string(packet), "\n"))
+		lines += strings.Count(string(packet), "\n") + 1
+	}
+	assert.Equal(t, 80, lines)
+}
+
+func TestSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	s := New(Config{Address: conn.LocalAddr().String(), Timeout: time.Second})
+	assert.NoError(t, s.Send(context.Background(), thermostats[:1]))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, maxPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), "nest.ambient_temperature_celsius:20.5|g|#device_id:DEVICE_1,label:Main_Thermostat,room:Living_Room\n")
+}
+
+func TestFailedConnecting(t *testing.T) {
+	s := New(Config{Address: "invalid host:8125", Timeout: time.Second})
+	err := s.Send(context.Background(), thermostats)
+	assert.True(t, errors.Is(err, errFailedConnecting))
+}
+
+func TestDefaultPort(t *testing.T) {
+	assert.Equal(t, "statsd:8125", New(Config{Address: "statsd"}).address)
+	assert.Equal(t, "statsd:9125", New(Config{Address: "statsd:9125"}).address)
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"pronestheus/pkg/collectors/nest"
+	"pronestheus/pkg/pubsub"
+)
+
+// subscribed returns true if Nest events should be received from a Pub/Sub subscription.
+func (cfg *ExporterConfig) subscribed() bool {
+	return cfg.PubSubSubscription != nil && *cfg.PubSubSubscription != ""
+}
+
+// pubSubOptions returns the options of the Nest collector receiving events. Events keep the readings up to date,
+// so the Nest API only needs to be called once per resync interval.
+func pubSubOptions(cfg *ExporterConfig) []nest.Option {
+	opts := []nest.Option{nest.WithEventMetrics()}
+
+	if cfg.PubSubResyncInterval != nil && *cfg.PubSubResyncInterval > 0 {
+		opts = append(opts, nest.WithCache(*cfg.PubSubResyncInterval))
+	}
+
+	if cfg.PubSubTimestamps != nil && *cfg.PubSubTimestamps {
+		opts = append(opts, nest.WithTimestamps())
+	}
+
+	return opts
+}
+
+// subscribe starts pulling messages from the Pub/Sub subscription in the background, passing them to the handler.
+// Requests are authenticated with Google Application Default Credentials.
+func (e *Exporter) subscribe(cfg *ExporterConfig, handler pubsub.Handler) error {
+	// Pub/Sub API calls and token requests are sent with the base client from the context.
+	ctx := context.WithValue(e.ctx, oauth2.HTTPClient, &http.Client{Transport: cfg.transport(nil)})
+
+	var client *http.Client
+	if cfg.PubSubToken != nil {
+		client = oauth2.NewClient(ctx, oauth2.StaticTokenSource(cfg.PubSubToken))
+	} else {
+		var err error
+		if client, err = google.DefaultClient(ctx, pubsub.Scope); err != nil {
+			return err
+		}
+	}
+
+	pubsubCfg := pubsub.Config{
+		Logger:       e.logger,
+		Client:       client,
+		Subscription: *cfg.PubSubSubscription,
+	}
+
+	if cfg.PubSubURL != nil {
+		pubsubCfg.APIURL = *cfg.PubSubURL
+	}
+
+	subscriber, err := pubsub.New(pubsubCfg)
+	if err != nil {
+		return err
+	}
+
+	if err := prometheus.Register(subscriber); err != nil {
+		return err
+	}
+
+	e.runAsLeader(func(ctx context.Context) { subscriber.Run(ctx, handler) })
+
+	e.logger.Log("level", "info", "msg", "Receiving Nest events from Pub/Sub", "subscription", *cfg.PubSubSubscription)
+	return nil
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pronestheus/pkg/control"
+)
+
+// collectorsPath is the path of the admin endpoint enabling and disabling collectors.
+const collectorsPath = "/admin/collectors"
+
+var (
+	errAdminMethod           = errors.New("method not allowed")
+	errUnknownCollector      = errors.New("unknown collector")
+	errInvalidCollectorState = errors.New("invalid collector state; expected a JSON object of booleans by collector")
+)
+
+// collectorSwitches enables and disables registered collectors at runtime, eg. to pause the weather collector while
+// its API key is expired, without restarting the exporter. Disabled collectors stay registered, but they aren't
+// collected, so their APIs aren't called. Switches outlive collectors, so a collector stays disabled across reloads.
+// Whether collectors are enabled is exported as pronestheus_collector_enabled.
+type collectorSwitches struct {
+	logger log.Logger
+
+	mu       sync.Mutex
+	switches map[string]*switchCollector
+
+	enabled *prometheus.Desc
+}
+
+// switchCollector collects the wrapped collector only while it's enabled.
+type switchCollector struct {
+	collector prometheus.Collector
+	enabled   int32
+}
+
+// Describe implements the prometheus.Collector interface.
+func (s *switchCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (s *switchCollector) Collect(ch chan<- prometheus.Metric) {
+	if atomic.LoadInt32(&s.enabled) == 1 {
+		s.collector.Collect(ch)
+	}
+}
+
+func newCollectorSwitches(logger log.Logger) *collectorSwitches {
+	return &collectorSwitches{
+		logger:   logger,
+		switches: make(map[string]*switchCollector),
+		enabled:  prometheus.NewDesc("pronestheus_collector_enabled", "Whether the collector is enabled, collectors can be disabled at runtime with the admin endpoint.", []string{"collector"}, nil),
+	}
+}
+
+// setupCollectorSwitches creates the switches of collectors, serving the admin endpoint if the admin token is set.
+func (e *Exporter) setupCollectorSwitches(cfg *ExporterConfig) error {
+	e.switches = newCollectorSwitches(e.logger)
+
+	if !cfg.exporterMetricsDisabled() {
+		if err := prometheus.Register(e.switches); err != nil {
+			return err
+		}
+	}
+	if isSet(cfg.AdminToken) {
+		e.routes[collectorsPath] = control.RequireAdmin(*cfg.AdminToken, e.switches)
+	}
+
+	return nil
+}
+
+// wrap returns the collector switched under the name. A collector registered again under the same name, eg. after a
+// reload, keeps the state of the previous one.
+func (c *collectorSwitches) wrap(name string, collector prometheus.Collector) *switchCollector {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &switchCollector{collector: collector, enabled: 1}
+	if prev, ok := c.switches[name]; ok {
+		s.enabled = atomic.LoadInt32(&prev.enabled)
+	}
+	c.switches[name] = s
+	return s
+}
+
+// states returns whether collectors are enabled by name.
+func (c *collectorSwitches) states() map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	states := make(map[string]bool, len(c.switches))
+	for name, s := range c.switches {
+		states[name] = atomic.LoadInt32(&s.enabled) == 1
+	}
+	return states
+}
+
+// set enables or disables the collectors by name. Nothing is changed if any of the collectors is unknown.
+func (c *collectorSwitches) set(states map[string]bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		if _, ok := c.switches[name]; !ok {
+			return errors.Wrap(errUnknownCollector, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var enabled int32
+		if states[name] {
+			enabled = 1
+		}
+		if atomic.SwapInt32(&c.switches[name].enabled, enabled) != enabled {
+			c.logger.Log("level", "info", "msg", "Collector switched", "collector", name, "enabled", states[name])
+		}
+	}
+	return nil
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *collectorSwitches) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.enabled
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *collectorSwitches) Collect(ch chan<- prometheus.Metric) {
+	for name, enabled := range c.states() {
+		var value float64
+		if enabled {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue, value, name)
+	}
+}
+
+// ServeHTTP implements the http.Handler interface. GET returns whether collectors are enabled as a JSON object of
+// booleans by collector, PUT of such an object enables or disables the collectors in it.
+func (c *collectorSwitches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var states map[string]bool
+		if err := json.NewDecoder(r.Body).Decode(&states); err != nil {
+			writeJSONError(w, http.StatusBadRequest, errors.Wrap(errInvalidCollectorState, err.Error()))
+			return
+		}
+		if err := c.set(states); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		writeJSONError(w, http.StatusMethodNotAllowed, errAdminMethod)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.states())
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/control"
+)
+
+func TestCollectorSwitches(t *testing.T) {
+	switches := newCollectorSwitches(log.NewNopLogger())
+	weather := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_weather_up"})
+	switched := switches.wrap("weather", weather)
+	switches.wrap("nest", prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_up"}))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(switched))
+	assert.NoError(t, switches.set(map[string]bool{"weather": false}))
+	assert.Equal(t, 0, testutil.CollectAndCount(switched))
+	assert.Equal(t, map[string]bool{"nest": true, "weather": false}, switches.states())
+
+	assert.Error(t, switches.set(map[string]bool{"nest": false, "solar": false}))
+	assert.True(t, switches.states()["nest"], "nothing is changed with unknown collectors")
+
+	switched = switches.wrap("weather", weather)
+	assert.Equal(t, 0, testutil.CollectAndCount(switched), "reloaded collectors stay disabled")
+
+	expected := `
+# HELP pronestheus_collector_enabled Whether the collector is enabled, collectors can be disabled at runtime with the admin endpoint.
+# TYPE pronestheus_collector_enabled gauge
+pronestheus_collector_enabled{collector="nest"} 1
+pronestheus_collector_enabled{collector="weather"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(switches, strings.NewReader(expected)))
+}
+
+func TestCollectorSwitchesHandler(t *testing.T) {
+	switches := newCollectorSwitches(log.NewNopLogger())
+	switches.wrap("weather", prometheus.NewGauge(prometheus.GaugeOpts{Name: "nest_weather_up"}))
+
+	serve := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, collectorsPath, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		control.RequireAdmin("TOKEN", switches).ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(http.MethodGet, "WRONG", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodGet, "TOKEN", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"weather": true}`, rec.Body.String())
+
+	rec = serve(http.MethodPut, "TOKEN", `{"weather": false}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"weather": false}`, rec.Body.String())
+
+	rec = serve(http.MethodPut, "TOKEN", `{"solar": false}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown collector")
+
+	rec = serve(http.MethodPut, "TOKEN", `["weather"]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodDelete, "TOKEN", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, PUT", rec.Header().Get("Allow"))
+}
@@ -0,0 +1,83 @@
+// Package units converts temperatures into the units of exported metrics.
+//
+// APIs return temperatures in Celsius, or in Fahrenheit if requested, and collectors store them in Celsius. Metrics
+// are exported in Celsius (default), Fahrenheit, Kelvin, the SI base unit, or both Celsius and Fahrenheit, with the
+// unit as the suffix of the family name, eg. nest_ambient_temperature_kelvin.
+package units
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Temperature units.
+const (
+	Celsius    = "celsius"
+	Fahrenheit = "fahrenheit"
+	Kelvin     = "kelvin"
+	// Both exports temperatures in Celsius and Fahrenheit.
+	Both = "both"
+)
+
+// absoluteZero is 0 K in Celsius.
+const absoluteZero = -273.15
+
+// ErrInvalidUnit is returned for unknown temperature unit settings.
+var ErrInvalidUnit = errors.New("invalid temperature unit; valid values: [celsius, fahrenheit, kelvin, both]")
+
+// Parse returns the units of exported temperatures for the unit setting: celsius (default), fahrenheit, kelvin or
+// both.
+func Parse(unit string) ([]string, error) {
+	switch unit {
+	case "", Celsius:
+		return []string{Celsius}, nil
+	case Fahrenheit:
+		return []string{Fahrenheit}, nil
+	case Kelvin:
+		return []string{Kelvin}, nil
+	case Both:
+		return []string{Celsius, Fahrenheit}, nil
+	default:
+		return nil, errors.Wrap(ErrInvalidUnit, unit)
+	}
+}
+
+// FromCelsius converts the temperature in Celsius into the unit.
+func FromCelsius(temp float64, unit string) float64 {
+	switch unit {
+	case Fahrenheit:
+		return temp*9/5 + 32
+	case Kelvin:
+		return temp - absoluteZero
+	default:
+		return temp
+	}
+}
+
+// ToCelsius converts the temperature in the unit into Celsius.
+func ToCelsius(temp float64, unit string) float64 {
+	switch unit {
+	case Fahrenheit:
+		return (temp - 32) * 5 / 9
+	case Kelvin:
+		return temp + absoluteZero
+	default:
+		return temp
+	}
+}
+
+// Convert converts the temperature in the from unit into the to unit.
+func Convert(temp float64, from, to string) float64 {
+	if from == to {
+		return temp
+	}
+	return FromCelsius(ToCelsius(temp, from), to)
+}
+
+// DiffFromCelsius converts a temperature difference in Celsius into the unit. Unlike temperatures, differences don't
+// have an offset, so they're the same in Kelvin.
+func DiffFromCelsius(diff float64, unit string) float64 {
+	if unit == Fahrenheit {
+		return diff * 9 / 5
+	}
+	return diff
+}
@@ -0,0 +1,46 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		unit    string
+		want    []string
+		wantErr error
+	}{
+		{unit: "", want: []string{Celsius}},
+		{unit: "celsius", want: []string{Celsius}},
+		{unit: "fahrenheit", want: []string{Fahrenheit}},
+		{unit: "kelvin", want: []string{Kelvin}},
+		{unit: "both", want: []string{Celsius, Fahrenheit}},
+		{unit: "rankine", wantErr: ErrInvalidUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			got, err := Parse(tt.unit)
+			assert.True(t, errors.Is(err, tt.wantErr))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	assert.Equal(t, 68.0, FromCelsius(20, Fahrenheit))
+	assert.InDelta(t, 293.15, FromCelsius(20, Kelvin), 1e-9)
+	assert.Equal(t, 20.0, FromCelsius(20, Celsius))
+
+	assert.Equal(t, 20.0, ToCelsius(68, Fahrenheit))
+	assert.InDelta(t, 20.0, ToCelsius(293.15, Kelvin), 1e-9)
+
+	assert.InDelta(t, 293.15, Convert(68, Fahrenheit, Kelvin), 1e-9)
+	assert.Equal(t, 68.0, Convert(68, Fahrenheit, Fahrenheit))
+
+	assert.Equal(t, 9.0, DiffFromCelsius(5, Fahrenheit))
+	assert.Equal(t, 5.0, DiffFromCelsius(5, Kelvin))
+}
@@ -0,0 +1,42 @@
+// Package useragent identifies the exporter in outbound API calls with the User-Agent header, as some APIs require
+// and which helps API providers when troubleshooting.
+package useragent
+
+import "net/http"
+
+// Default is the User-Agent of requests if it isn't configured.
+const Default = "pronestheus"
+
+// Format returns the User-Agent from the product, eg. "pronestheus/1.2.0", and the contact, eg. an email address or
+// a URL. The contact is optional.
+func Format(product, contact string) string {
+	if product == "" {
+		product = Default
+	}
+
+	if contact == "" {
+		return product
+	}
+	return product + " (" + contact + ")"
+}
+
+// Transport sets the User-Agent header of requests sent with the Base transport, or with http.DefaultTransport if
+// it's nil. Requests with their own User-Agent, eg. from configured webhook headers, keep it.
+type Transport struct {
+	Base      http.RoundTripper
+	UserAgent string
+}
+
+// RoundTrip implements the http.RoundTripper interface. The request is cloned, as RoundTrip must not modify it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,33 @@
+package useragent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "pronestheus", Format("", ""))
+	assert.Equal(t, "pronestheus/1.2.0 (admin@example.com)", Format("pronestheus/1.2.0", "admin@example.com"))
+}
+
+func TestTransport(t *testing.T) {
+	var userAgent string
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+	}))
+	defer serv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, serv.URL, nil)
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: &Transport{UserAgent: "pronestheus/1.2.0"}}
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, "pronestheus/1.2.0", userAgent)
+	assert.Empty(t, req.Header.Get("User-Agent"), "the original request isn't modified")
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+var errInvalidWebConfig = errors.New("invalid web config file")
+
+// webFlags returns the flags of the exporter-toolkit, which serves the exporter like other exporters: with TLS, basic
+// auth and hardening headers configured in the web config file, see
+// https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md.
+func (cfg *ExporterConfig) webFlags() *web.FlagConfig {
+	systemdSocket := false
+	configFile := ""
+	if cfg.WebConfigFile != nil {
+		configFile = *cfg.WebConfigFile
+	}
+
+	return &web.FlagConfig{
+		WebListenAddresses: &[]string{*cfg.ListenAddr},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &configFile,
+	}
+}
+
+// landingPage links the metrics and the JSON API from the root of the server.
+func landingPage(metricsPath string) (http.Handler, error) {
+	page, err := web.NewLandingPage(web.LandingConfig{
+		Name:        "ProNestheus",
+		Description: "Prometheus exporter of Nest thermostat and weather readings",
+		Links: []web.LandingLinks{
+			{Address: metricsPath, Text: "Metrics"},
+			{Address: "/api/v1/thermostats", Text: "Thermostats"},
+			{Address: "/api/v1/weather", Text: "Weather"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The landing page is served on every path, the mux routes unknown paths to the root.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page.ServeHTTP(w, r)
+	}), nil
+}
+
+// sdNotify sends the state to systemd if the exporter runs in a unit of the notify type, eg. "READY=1" once it's
+// listening. It does nothing otherwise.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// setupWeb validates the web config file, if set, so invalid certificates or users fail the startup instead of the
+// server. The exporter-toolkit reads it again on every connection, so certificates can be rotated without restarts.
+func (e *Exporter) setupWeb(cfg *ExporterConfig) error {
+	e.webFlags = cfg.webFlags()
+	if err := web.Validate(*e.webFlags.WebConfigFile); err != nil {
+		return errors.Wrap(errInvalidWebConfig, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate and its key to the directory.
+func writeCertificate(t *testing.T, dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// adminHash is the bcrypt hash of "TOKEN".
+const adminHash = "$2a$04$hPzrEtklyG/QiV3nDooD6ut25ggwv6l6Rt7ycseHee7ulAj4BbP.W"
+
+func TestWebConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pronestheus")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeCertificate(t, dir)
+
+	write := func(content string) *ExporterConfig {
+		path := filepath.Join(dir, "web.yml")
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		cfg := testConfig()
+		cfg.WebConfigFile = &path
+		return cfg
+	}
+
+	for _, content := range []string{
+		"",
+		`
+tls_server_config:
+  cert_file: cert.pem
+  key_file: key.pem
+  min_version: TLS12
+  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]
+  curve_preferences: [CurveP256]
+  client_auth_type: RequireAndVerifyClientCert
+  client_ca_file: cert.pem
+  client_allowed_sans: [localhost]
+http_server_config:
+  headers:
+    X-Frame-Options: deny
+basic_auth_users:
+  admin: ` + adminHash + `
+`,
+	} {
+		e := &Exporter{}
+		assert.NoError(t, e.setupWeb(write(content)), content)
+	}
+
+	for _, content := range []string{
+		"basic_auth_users:\n  admin: TOKEN\n",
+		"http_server_config:\n  headers:\n    Set-Cookie: session=1\n",
+		"tls_server_config:\n  cert_file: cert.pem\n  key_file: key.pem\n  min_version: SSL3\n",
+		"tls_server_config:\n  cert_file: missing.pem\n  key_file: key.pem\n",
+		"unknown: true\n",
+	} {
+		e := &Exporter{}
+		err := e.setupWeb(write(content))
+		assert.True(t, errors.Is(err, errInvalidWebConfig), content)
+	}
+}
+
+func TestWebServer(t *testing.T) {
+	t.Cleanup(resetRegistry)
+
+	dir, err := ioutil.TempDir("", "pronestheus")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeCertificate(t, dir)
+
+	path := filepath.Join(dir, "web.yml")
+	content := "tls_server_config:\n  cert_file: cert.pem\n  key_file: key.pem\n" +
+		"http_server_config:\n  headers:\n    X-Content-Type-Options: nosniff\n" +
+		"basic_auth_users:\n  admin: " + adminHash + "\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cfg := testConfig()
+	cfg.ListenAddr = &addr
+	cfg.WebConfigFile = &path
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	go e.Run()
+	defer e.Shutdown(context.Background())
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	get := func(path string, auth bool) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "https://"+addr+path, nil)
+		assert.NoError(t, err)
+		if auth {
+			req.SetBasicAuth("admin", "TOKEN")
+		}
+
+		var res *http.Response
+		for i := 0; i < 50; i++ {
+			if res, err = client.Do(req); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/", false).StatusCode)
+
+	res := get("/", true)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "nosniff", res.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, http.StatusNotFound, get("/unknown", true).StatusCode)
+}
+
+func TestLandingPage(t *testing.T) {
+	h, err := landingPage("/metrics")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `href="/metrics"`)
+	assert.Contains(t, w.Body.String(), `href="/api/v1/thermostats"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pronestheus")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	assert.NoError(t, sdNotify("READY=1"))
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "READY=1", string(buf[:n]))
+}
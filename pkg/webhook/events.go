@@ -0,0 +1,272 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/alert"
+	"pronestheus/pkg/collectors/nest"
+)
+
+// Event types.
+const (
+	EventModeChange       = "mode_change"
+	EventHVACStart        = "hvac_start"
+	EventHVACStop         = "hvac_stop"
+	EventDeviceOffline    = "device_offline"
+	EventDeviceOnline     = "device_online"
+	EventThresholdCrossed = "threshold_crossed"
+	EventThresholdCleared = "threshold_cleared"
+)
+
+// eventQueueSize limits the number of events waiting to be sent, newer ones are dropped when it's full.
+const eventQueueSize = 64
+
+// eventTypes are all event types, webhooks without a list of events receive all of them.
+var eventTypes = []string{
+	EventModeChange, EventHVACStart, EventHVACStop, EventDeviceOffline, EventDeviceOnline,
+	EventThresholdCrossed, EventThresholdCleared,
+}
+
+var (
+	errInvalidEventType  = errors.New("invalid webhook event type; valid values: [mode_change, hvac_start, hvac_stop, device_offline, device_online, threshold_crossed, threshold_cleared]")
+	errInvalidThreshold  = errors.New("invalid event threshold; durations aren't supported")
+	errMissingEventHooks = errors.New("event thresholds require at least one event webhook")
+)
+
+// Event is a state transition of a thermostat. From and To are the previous and current mode, HVAC status or
+// connectivity. Threshold events have the rule and the reading instead.
+type Event struct {
+	Type       string           `json:"type"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Thermostat *nest.Thermostat `json:"thermostat"`
+	From       string           `json:"from,omitempty"`
+	To         string           `json:"to,omitempty"`
+	Rule       string           `json:"rule,omitempty"`
+	Value      *float64         `json:"value,omitempty"`
+}
+
+// EventsConfig provides the configuration necessary to create Events. Logger is optional, if it's nil Events don't
+// log anything. Webhooks are URLs, optionally preceded by comma separated event types they receive, as
+// "[EVENTS=]URL", eg. "hvac_start,hvac_stop=https://example.com/hook". Thresholds are rules without durations, see
+// alert.ParseRule. Template, Headers, Timeout, Transport and ID apply to all webhooks like in Config.
+type EventsConfig struct {
+	Logger     log.Logger
+	Webhooks   []string
+	Thresholds []string
+	Template   string
+	Headers    []string
+	Timeout    time.Duration
+	Transport  http.RoundTripper
+	ID         func(therm *nest.Thermostat) string
+}
+
+// eventHook is a webhook receiving events of the types.
+type eventHook struct {
+	url    string
+	types  map[string]bool
+	sender *Sender
+}
+
+// Events detects state transitions by comparing readings with the previous ones and posts them to webhooks.
+// The first readings of a thermostat only set the state to compare with, so restarts don't repeat events.
+type Events struct {
+	logger     log.Logger
+	id         func(therm *nest.Thermostat) string
+	hooks      []eventHook
+	thresholds []alert.Rule
+	queue      chan Event
+
+	mu       sync.Mutex
+	previous map[string]*nest.Thermostat
+	crossed  map[string]bool
+	now      func() time.Time
+}
+
+// NewEvents creates Events using the given Config. It returns an error if a webhook, event type, threshold or
+// the template is invalid.
+func NewEvents(cfg EventsConfig) (*Events, error) {
+	if len(cfg.Thresholds) > 0 && len(cfg.Webhooks) == 0 {
+		return nil, errMissingEventHooks
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = log.NewNopLogger()
+	}
+	if cfg.ID == nil {
+		cfg.ID = func(therm *nest.Thermostat) string { return therm.ID }
+	}
+
+	e := &Events{
+		id:       cfg.ID,
+		logger:   cfg.Logger,
+		queue:    make(chan Event, eventQueueSize),
+		previous: make(map[string]*nest.Thermostat),
+		crossed:  make(map[string]bool),
+		now:      time.Now,
+	}
+
+	for _, webhook := range cfg.Webhooks {
+		hook, err := parseEventHook(webhook)
+		if err != nil {
+			return nil, err
+		}
+
+		hook.sender, err = New(Config{URL: hook.url, Template: cfg.Template, Headers: cfg.Headers, Timeout: cfg.Timeout, Transport: cfg.Transport, ID: cfg.ID})
+		if err != nil {
+			return nil, err
+		}
+		e.hooks = append(e.hooks, hook)
+	}
+
+	for _, threshold := range cfg.Thresholds {
+		rule, err := alert.ParseRule(threshold)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Duration > 0 {
+			return nil, errors.Wrap(errInvalidThreshold, threshold)
+		}
+		e.thresholds = append(e.thresholds, rule)
+	}
+
+	return e, nil
+}
+
+// parseEventHook parses a webhook in the "[EVENTS=]URL" format. URLs may contain "=" in their query, so events are
+// only split off if the part before the first "=" isn't part of the URL.
+func parseEventHook(webhook string) (eventHook, error) {
+	hook := eventHook{url: webhook, types: make(map[string]bool)}
+
+	i := strings.Index(webhook, "=")
+	if i < 0 || strings.Contains(webhook[:i], "://") {
+		for _, eventType := range eventTypes {
+			hook.types[eventType] = true
+		}
+		return hook, nil
+	}
+
+	hook.url = webhook[i+1:]
+	for _, eventType := range strings.Split(webhook[:i], ",") {
+		eventType = strings.TrimSpace(eventType)
+		if !isEventType(eventType) {
+			return hook, errors.Wrap(errInvalidEventType, eventType)
+		}
+		hook.types[eventType] = true
+	}
+	return hook, nil
+}
+
+func isEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener returns a nest.Listener detecting events in the readings.
+func (e *Events) Listener() nest.Listener {
+	return e.Detect
+}
+
+// Detect compares the readings with the previous ones and queues events of state transitions. Events carry a copy
+// of the reading with the id returned by the id function of the EventsConfig.
+func (e *Events) Detect(thermostats []*nest.Thermostat) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now().UTC()
+	for _, therm := range thermostats {
+		prev, ok := e.previous[therm.ID]
+		e.previous[therm.ID] = therm
+		published := therm.WithID(e.id(therm))
+
+		for _, rule := range e.thresholds {
+			key := rule.String() + "\x00" + therm.ID
+			value, matched := rule.Match(therm)
+			wasCrossed := e.crossed[key]
+			e.crossed[key] = matched
+			if !ok || matched == wasCrossed {
+				continue
+			}
+
+			eventType := EventThresholdCrossed
+			if !matched {
+				eventType = EventThresholdCleared
+			}
+			e.enqueue(Event{Type: eventType, Timestamp: now, Thermostat: published, Rule: rule.String(), Value: &value})
+		}
+
+		if !ok {
+			continue
+		}
+
+		if prev.Mode != therm.Mode {
+			e.enqueue(Event{Type: EventModeChange, Timestamp: now, Thermostat: published, From: prev.Mode, To: therm.Mode})
+		}
+
+		if prev.Status != therm.Status {
+			eventType := EventHVACStart
+			if therm.Status == "OFF" {
+				eventType = EventHVACStop
+			}
+			e.enqueue(Event{Type: eventType, Timestamp: now, Thermostat: published, From: prev.Status, To: therm.Status})
+		}
+
+		// Thermostats which don't report their connectivity have an empty one.
+		if prev.Connectivity != therm.Connectivity && prev.Connectivity != "" && therm.Connectivity != "" {
+			eventType := EventDeviceOnline
+			if therm.Connectivity == "OFFLINE" {
+				eventType = EventDeviceOffline
+			}
+			e.enqueue(Event{Type: eventType, Timestamp: now, Thermostat: published, From: prev.Connectivity, To: therm.Connectivity})
+		}
+	}
+}
+
+// Run posts queued events to the webhooks receiving them until the context is cancelled.
+func (e *Events) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-e.queue:
+			for _, hook := range e.hooks {
+				if !hook.types[event.Type] {
+					continue
+				}
+				if err := hook.sender.SendEvent(ctx, event); err != nil {
+					e.logger.Log("level", "error", "message", "Failed sending webhook event", "type", event.Type, "id", event.Thermostat.ID, "stack", errors.WithStack(err))
+					continue
+				}
+				e.logger.Log("level", "debug", "message", "Sent webhook event", "type", event.Type, "id", event.Thermostat.ID)
+			}
+		}
+	}
+}
+
+func (e *Events) enqueue(event Event) {
+	select {
+	case e.queue <- event:
+	default:
+		e.logger.Log("level", "warn", "message", "Webhook event queue is full, dropping event", "type", event.Type, "id", event.Thermostat.ID)
+	}
+}
+
+// SendEvent posts the event to the webhook. It returns an error if the endpoint doesn't respond with 2xx.
+func (s *Sender) SendEvent(ctx context.Context, event Event) error {
+	body, err := s.render(event)
+	if err != nil {
+		return err
+	}
+
+	return s.post(ctx, body)
+}
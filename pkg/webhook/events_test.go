@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+func reading(mode, status, connectivity string, ambient float64) []*nest.Thermostat {
+	return []*nest.Thermostat{{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:     "DEVICE_ID",
+		Label:        "Hallway",
+		AmbientTemp:  ambient,
+		Mode:         mode,
+		Status:       status,
+		Connectivity: connectivity,
+	}}
+}
+
+// queued returns the types of queued events.
+func queued(e *Events) []string {
+	var types []string
+	for {
+		select {
+		case event := <-e.queue:
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	e, err := NewEvents(EventsConfig{Webhooks: []string{"http://localhost"}, Thresholds: []string{"ambient_temperature_celsius < 5"}})
+	assert.NoError(t, err)
+
+	// The first readings only set the state.
+	e.Detect(reading("HEAT", "OFF", "ONLINE", 4))
+	assert.Empty(t, queued(e))
+
+	e.Detect(reading("HEAT", "HEATING", "ONLINE", 4))
+	assert.Equal(t, []string{EventHVACStart}, queued(e))
+
+	e.Detect(reading("ECO", "OFF", "ONLINE", 6))
+	assert.Equal(t, []string{EventThresholdCleared, EventModeChange, EventHVACStop}, queued(e))
+
+	e.Detect(reading("ECO", "OFF", "OFFLINE", 4.5))
+	assert.Equal(t, []string{EventThresholdCrossed, EventDeviceOffline}, queued(e))
+
+	e.Detect(reading("ECO", "OFF", "", 4.5))
+	e.Detect(reading("ECO", "OFF", "ONLINE", 4.5))
+	assert.Empty(t, queued(e))
+}
+
+func TestEvents(t *testing.T) {
+	serv, received := newServer(t, http.StatusOK)
+	defer serv.Close()
+
+	path := writeTemplate(t, `{"value1":{{json .Thermostat.Label}},"value2":{{json .Type}},"value3":{{json .To}}}`)
+	e, err := NewEvents(EventsConfig{Webhooks: []string{"mode_change=" + serv.URL + "?key=KEY"}, Template: path})
+	assert.NoError(t, err)
+	e.now = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Detect(reading("HEAT", "OFF", "ONLINE", 20))
+	e.Detect(reading("HEAT", "HEATING", "ONLINE", 20))
+	e.Detect(reading("OFF", "OFF", "ONLINE", 20))
+
+	req := <-received
+	assert.Equal(t, `{"value1":"Hallway","value2":"mode_change","value3":"OFF"}`, req.body)
+	select {
+	case req := <-received:
+		t.Errorf("unexpected event: %s", req.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	serv, received := newServer(t, http.StatusOK)
+	defer serv.Close()
+
+	s, err := New(Config{URL: serv.URL})
+	assert.NoError(t, err)
+
+	value := 4.5
+	event := Event{Type: EventThresholdCrossed, Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Thermostat: reading("HEAT", "OFF", "", value)[0], Rule: "ambient_temperature_celsius < 5", Value: &value}
+	assert.NoError(t, s.SendEvent(context.Background(), event))
+
+	req := <-received
+	assert.Regexp(t, `^\{"type":"threshold_crossed","timestamp":"2020-01-01T00:00:00Z","thermostat":\{"id":"enterprises/PROJECT_ID/devices/DEVICE_ID",.*\},"rule":"ambient_temperature_celsius \\u003c 5","value":4.5\}$`, req.body)
+}
+
+func TestInvalidEventsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     EventsConfig
+		wantErr error
+	}{
+		{
+			name:    "invalid event type",
+			cfg:     EventsConfig{Webhooks: []string{"hvac_on=http://localhost"}},
+			wantErr: errInvalidEventType,
+		}, {
+			name:    "threshold with duration",
+			cfg:     EventsConfig{Webhooks: []string{"http://localhost"}, Thresholds: []string{"online == 0 for 1h"}},
+			wantErr: errInvalidThreshold,
+		}, {
+			name:    "threshold without webhooks",
+			cfg:     EventsConfig{Thresholds: []string{"online == 0"}},
+			wantErr: errMissingEventHooks,
+		}, {
+			name:    "invalid URL",
+			cfg:     EventsConfig{Webhooks: []string{"mode_change=localhost"}},
+			wantErr: errInvalidWebhookURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEvents(tt.cfg)
+			assert.True(t, errors.Is(err, tt.wantErr))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package webhook posts thermostat readings to an arbitrary HTTP endpoint, for services without a dedicated sink.
+//
+// By default the body is the JSON snapshot {"timestamp": ..., "thermostats": [...]}, with thermostats in the same
+// format as the JSON API. A text/template can replace it to match the format the endpoint expects, eg. events of the
+// New Relic Event API. Templates get the Payload as data and a "json" function encoding any value as JSON.
+//
+// Events post to webhooks on state transitions of thermostats instead, like mode changes, HVAC starts and stops,
+// thermostats going offline or readings crossing thresholds, eg. to trigger IFTTT, n8n or Home Assistant automations.
+// Templates get the Event as data.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// maxErrorBodySize limits the part of error responses included in errors.
+const maxErrorBodySize = 512
+
+var (
+	errInvalidTemplate   = errors.New("invalid webhook template")
+	errInvalidHeader     = errors.New("invalid webhook header; expected format: \"Name: value\"")
+	errFailedRendering   = errors.New("failed rendering webhook payload")
+	errFailedSending     = errors.New("failed sending webhook request")
+	errNon2xxResponse    = errors.New("webhook endpoint returned non-2xx response")
+	errInvalidWebhookURL = errors.New("invalid webhook URL")
+)
+
+// Config provides the configuration necessary to create the Sender.
+// Template is the path to a text/template file rendering the request body, the JSON snapshot is sent if it's empty.
+// Headers are added to every request, in the "Name: value" format. Content-Type defaults to application/json.
+// Transport defaults to http.DefaultTransport. ID returns the id of a thermostat in the payload, if it's nil the
+// resource name of the thermostat is used.
+type Config struct {
+	URL       string
+	Template  string
+	Headers   []string
+	Timeout   time.Duration
+	Transport http.RoundTripper
+	ID        func(therm *nest.Thermostat) string
+}
+
+// Payload is the data passed to templates.
+type Payload struct {
+	Timestamp   time.Time          `json:"timestamp"`
+	Thermostats []*nest.Thermostat `json:"thermostats"`
+}
+
+// Sender posts readings to the webhook. It implements sink.Sender.
+type Sender struct {
+	url      string
+	template *template.Template
+	headers  http.Header
+	client   *http.Client
+	id       func(therm *nest.Thermostat) string
+}
+
+// New creates a Sender using the given Config. It returns an error if the template or headers are invalid.
+func New(cfg Config) (*Sender, error) {
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, errors.Wrap(errInvalidWebhookURL, cfg.URL)
+	}
+	if cfg.ID == nil {
+		cfg.ID = func(therm *nest.Thermostat) string { return therm.ID }
+	}
+
+	s := &Sender{
+		url:     cfg.URL,
+		headers: http.Header{"Content-Type": []string{"application/json"}},
+		client:  &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+		id:      cfg.ID,
+	}
+
+	for _, header := range cfg.Headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Wrap(errInvalidHeader, header)
+		}
+		s.headers.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	if cfg.Template != "" {
+		data, err := ioutil.ReadFile(cfg.Template)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidTemplate, err.Error())
+		}
+
+		s.template, err = template.New(cfg.Template).Funcs(template.FuncMap{"json": toJSON}).Parse(string(data))
+		if err != nil {
+			return nil, errors.Wrap(errInvalidTemplate, err.Error())
+		}
+	}
+
+	return s, nil
+}
+
+// Send posts readings of thermostats to the webhook. It returns an error if the endpoint doesn't respond with 2xx.
+func (s *Sender) Send(ctx context.Context, thermostats []*nest.Thermostat) error {
+	published := make([]*nest.Thermostat, 0, len(thermostats))
+	for _, therm := range thermostats {
+		published = append(published, therm.WithID(s.id(therm)))
+	}
+
+	body, err := s.render(Payload{Timestamp: time.Now().UTC(), Thermostats: published})
+	if err != nil {
+		return err
+	}
+
+	return s.post(ctx, body)
+}
+
+// post sends the body to the webhook. It returns an error if the endpoint doesn't respond with 2xx.
+func (s *Sender) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(errFailedSending, err.Error())
+	}
+	req = req.WithContext(ctx)
+
+	for name, values := range s.headers {
+		req.Header[name] = values
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(errFailedSending, err.Error())
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return errors.Wrap(errNon2xxResponse, fmt.Sprintf("%s: %s", res.Status, bytes.TrimSpace(msg)))
+	}
+	io.Copy(ioutil.Discard, res.Body)
+
+	return nil
+}
+
+// render returns the request body for the data passed to the template, or encoded as JSON without a template.
+func (s *Sender) render(data interface{}) ([]byte, error) {
+	if s.template == nil {
+		body, err := json.Marshal(data)
+		if err != nil {
+			return nil, errors.Wrap(errFailedRendering, err.Error())
+		}
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(errFailedRendering, err.Error())
+	}
+
+	return buf.Bytes(), nil
+}
+
+// toJSON encodes the value as JSON, so templates can safely embed strings and whole objects.
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var thermostats = []*nest.Thermostat{
+	{
+		ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+		DeviceID:     "DEVICE_ID",
+		Label:        "Hallway",
+		AmbientTemp:  20.5,
+		SetpointTemp: 19,
+		Humidity:     45,
+		Status:       "HEATING",
+		Mode:         "HEAT",
+	},
+}
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func newServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	received := make(chan request, 1)
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- request{header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+		w.Write([]byte("response body"))
+	}))
+
+	return serv, received
+}
+
+func writeTemplate(t *testing.T, text string) string {
+	dir, err := ioutil.TempDir("", "webhook")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "payload.tmpl")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(text), 0644))
+
+	return path
+}
+
+func TestSend(t *testing.T) {
+	serv, received := newServer(t, http.StatusAccepted)
+	defer serv.Close()
+
+	s, err := New(Config{URL: serv.URL, Headers: []string{"Authorization: Bearer TOKEN"}, Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(context.Background(), thermostats))
+
+	req := <-received
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "Bearer TOKEN", req.header.Get("Authorization"))
+	assert.Regexp(t, `^\{"timestamp":"[^"]+Z","thermostats":\[\{"id":"enterprises/PROJECT_ID/devices/DEVICE_ID",`, req.body)
+}
+
+func TestSendID(t *testing.T) {
+	serv, received := newServer(t, http.StatusAccepted)
+	defer serv.Close()
+
+	id := func(therm *nest.Thermostat) string { return nest.IDLabel(nest.IDShort, therm.ID) }
+	s, err := New(Config{URL: serv.URL, Timeout: time.Second, ID: id})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(context.Background(), thermostats))
+
+	req := <-received
+	assert.Regexp(t, `"thermostats":\[\{"id":"DEVICE_ID",`, req.body)
+	assert.Equal(t, "enterprises/PROJECT_ID/devices/DEVICE_ID", thermostats[0].ID)
+}
+
+func TestTemplate(t *testing.T) {
+	serv, received := newServer(t, http.StatusOK)
+	defer serv.Close()
+
+	path := writeTemplate(t, `[{{range $i, $t := .Thermostats}}{{if $i}},{{end}}{"eventType":"NestThermostat","label":{{json $t.Label}},"ambient":{{$t.AmbientTemp}}}{{end}}]`)
+	s, err := New(Config{URL: serv.URL, Template: path, Headers: []string{"Content-Type: text/plain"}})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(context.Background(), thermostats))
+
+	req := <-received
+	assert.Equal(t, "text/plain", req.header.Get("Content-Type"))
+	assert.Equal(t, `[{"eventType":"NestThermostat","label":"Hallway","ambient":20.5}]`, req.body)
+}
+
+func TestNon2xxResponse(t *testing.T) {
+	serv, _ := newServer(t, http.StatusForbidden)
+	defer serv.Close()
+
+	s, err := New(Config{URL: serv.URL})
+	assert.NoError(t, err)
+
+	err = s.Send(context.Background(), thermostats)
+	assert.True(t, errors.Is(err, errNon2xxResponse))
+	assert.Contains(t, err.Error(), "403 Forbidden: response body")
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{
+			name:    "invalid URL",
+			cfg:     Config{URL: "localhost:8080"},
+			wantErr: errInvalidWebhookURL,
+		}, {
+			name:    "invalid header",
+			cfg:     Config{URL: "http://localhost", Headers: []string{"Authorization"}},
+			wantErr: errInvalidHeader,
+		}, {
+			name:    "missing template",
+			cfg:     Config{URL: "http://localhost", Template: "missing.tmpl"},
+			wantErr: errInvalidTemplate,
+		}, {
+			name:    "invalid template",
+			cfg:     Config{URL: "http://localhost", Template: writeTemplate(t, "{{.Thermostats")},
+			wantErr: errInvalidTemplate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			assert.True(t, errors.Is(err, tt.wantErr))
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// Package zabbix pushes thermostat readings to a Zabbix server or proxy with the sender protocol, like zabbix_sender.
+//
+// Readings are sent to trapper items of the configured host, one item per reading and thermostat, with keys like
+// nest.ambient_temperature_celsius[DEVICE_ID]. Items must be created in Zabbix beforehand, values of unknown items
+// are rejected by the server.
+//
+// See https://www.zabbix.com/documentation/current/manual/appendix/protocols/zabbix_sender for the protocol.
+package zabbix
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+// DefaultPort is the port of the Zabbix trapper.
+const DefaultPort = "10051"
+
+// maxResponseSize limits the size of server responses, which only contain a short summary.
+const maxResponseSize = 1 << 20
+
+// header starts every message of the Zabbix protocol, followed by the length of the data.
+var header = []byte("ZBXD\x01")
+
+// processed matches the summary of the server response, eg. "processed: 3; failed: 1; total: 4; seconds spent: 0.1".
+var processed = regexp.MustCompile(`processed: (\d+); failed: (\d+)`)
+
+var (
+	errFailedConnecting = errors.New("failed connecting to Zabbix server")
+	errFailedSending    = errors.New("failed sending data to Zabbix server")
+	errInvalidResponse  = errors.New("invalid Zabbix server response")
+	errRejected         = errors.New("zabbix server rejected values")
+)
+
+// Config provides the configuration necessary to create the Sender. Server is the address of the Zabbix server or
+// proxy, DefaultPort is used if it doesn't have one. Host is the name of the host in Zabbix the items belong to.
+type Config struct {
+	Server  string
+	Host    string
+	Timeout time.Duration
+}
+
+// Sender sends readings to Zabbix. It implements sink.Sender.
+type Sender struct {
+	server  string
+	host    string
+	timeout time.Duration
+}
+
+// item is a value of a trapper item.
+type item struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type request struct {
+	Request string `json:"request"`
+	Data    []item `json:"data"`
+	Clock   int64  `json:"clock"`
+}
+
+type response struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// New creates a Sender using the given Config.
+func New(cfg Config) *Sender {
+	server := cfg.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, DefaultPort)
+	}
+
+	return &Sender{
+		server:  server,
+		host:    cfg.Host,
+		timeout: cfg.Timeout,
+	}
+}
+
+// Send sends readings of thermostats to Zabbix. It returns an error if the server rejected any of the values,
+// eg. because the item doesn't exist.
+func (s *Sender) Send(ctx context.Context, thermostats []*nest.Thermostat) error {
+	now := time.Now().Unix()
+	req := request{Request: "sender data", Clock: now}
+	for _, therm := range thermostats {
+		clock := now
+		if !therm.UpdatedAt.IsZero() {
+			clock = therm.UpdatedAt.Unix()
+		}
+
+		heating := "0"
+		if therm.Status == "HEATING" {
+			heating = "1"
+		}
+
+		add := func(name, value string) {
+			key := fmt.Sprintf("nest.%s[%s]", name, therm.DeviceID)
+			req.Data = append(req.Data, item{Host: s.host, Key: key, Value: value, Clock: clock})
+		}
+
+		add("ambient_temperature_celsius", formatFloat(therm.AmbientTemp))
+		add("setpoint_temperature_celsius", formatFloat(therm.SetpointTemp))
+		add("humidity_percent", formatFloat(therm.Humidity))
+		add("heating", heating)
+		add("hvac_status", therm.Status)
+		add("mode", therm.Mode)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(errFailedSending, err.Error())
+	}
+
+	res, err := s.exchange(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return checkResponse(res)
+}
+
+// exchange sends the data in a message and returns the data of the response message.
+func (s *Sender) exchange(ctx context.Context, data []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.server)
+	if err != nil {
+		return nil, errors.Wrap(errFailedConnecting, err.Error())
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.timeout))
+	}
+
+	var msg bytes.Buffer
+	msg.Write(header)
+	binary.Write(&msg, binary.LittleEndian, uint64(len(data)))
+	msg.Write(data)
+
+	if _, err := msg.WriteTo(conn); err != nil {
+		return nil, errors.Wrap(errFailedSending, err.Error())
+	}
+
+	resHeader := make([]byte, len(header)+8)
+	if _, err := io.ReadFull(conn, resHeader); err != nil {
+		return nil, errors.Wrap(errInvalidResponse, err.Error())
+	}
+
+	if !bytes.Equal(resHeader[:len(header)], header) {
+		return nil, errors.Wrap(errInvalidResponse, "missing ZBXD header")
+	}
+
+	length := binary.LittleEndian.Uint64(resHeader[len(header):])
+	if length > maxResponseSize {
+		return nil, errors.Wrap(errInvalidResponse, fmt.Sprintf("response too big: %d bytes", length))
+	}
+
+	res := make([]byte, length)
+	if _, err := io.ReadFull(conn, res); err != nil {
+		return nil, errors.Wrap(errInvalidResponse, err.Error())
+	}
+
+	return res, nil
+}
+
+// checkResponse returns an error if the response isn't successful or any value failed.
+func checkResponse(data []byte) error {
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return errors.Wrap(errInvalidResponse, err.Error())
+	}
+
+	if res.Response != "success" {
+		return errors.Wrap(errRejected, res.Info)
+	}
+
+	if m := processed.FindStringSubmatch(res.Info); m != nil {
+		if failed, _ := strconv.Atoi(m[2]); failed > 0 {
+			return errors.Wrap(errRejected, res.Info)
+		}
+	}
+
+	return nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
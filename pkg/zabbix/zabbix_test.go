@@ -0,0 +1,133 @@
+package zabbix
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"pronestheus/pkg/collectors/nest"
+)
+
+var thermostat = &nest.Thermostat{
+	ID:           "enterprises/PROJECT_ID/devices/DEVICE_ID",
+	DeviceID:     "DEVICE_ID",
+	Label:        "Living Room",
+	AmbientTemp:  20.5,
+	SetpointTemp: 19,
+	Humidity:     45,
+	Status:       "HEATING",
+	Mode:         "HEAT",
+	UpdatedAt:    time.Unix(1577836800, 0),
+}
+
+// zabbixServer accepts a single sender request, passes it to the channel and replies with the response.
+func zabbixServer(t *testing.T, res string) (string, <-chan request) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	requests := make(chan request, 1)
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		head := make([]byte, 13)
+		io.ReadFull(conn, head)
+		data := make([]byte, binary.LittleEndian.Uint64(head[5:]))
+		io.ReadFull(conn, data)
+
+		var req request
+		json.Unmarshal(data, &req)
+		requests <- req
+
+		conn.Write(header)
+		binary.Write(conn, binary.LittleEndian, uint64(len(res)))
+		conn.Write([]byte(res))
+	}()
+
+	return l.Addr().String(), requests
+}
+
+func TestSend(t *testing.T) {
+	addr, requests := zabbixServer(t, `{"response":"success","info":"processed: 6; failed: 0; total: 6; seconds spent: 0.000055"}`)
+
+	s := New(Config{Server: addr, Host: "home", Timeout: time.Second})
+	assert.NoError(t, s.Send(context.Background(), []*nest.Thermostat{thermostat}))
+
+	req := <-requests
+	assert.Equal(t, "sender data", req.Request)
+	assert.Equal(t, []item{
+		{Host: "home", Key: "nest.ambient_temperature_celsius[DEVICE_ID]", Value: "20.5", Clock: 1577836800},
+		{Host: "home", Key: "nest.setpoint_temperature_celsius[DEVICE_ID]", Value: "19", Clock: 1577836800},
+		{Host: "home", Key: "nest.humidity_percent[DEVICE_ID]", Value: "45", Clock: 1577836800},
+		{Host: "home", Key: "nest.heating[DEVICE_ID]", Value: "1", Clock: 1577836800},
+		{Host: "home", Key: "nest.hvac_status[DEVICE_ID]", Value: "HEATING", Clock: 1577836800},
+		{Host: "home", Key: "nest.mode[DEVICE_ID]", Value: "HEAT", Clock: 1577836800},
+	}, req.Data)
+}
+
+func TestResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		res     string
+		wantErr error
+	}{
+		{
+			name: "success",
+			res:  `{"response":"success","info":"processed: 6; failed: 0; total: 6; seconds spent: 0.000055"}`,
+		}, {
+			name:    "failed items",
+			res:     `{"response":"success","info":"processed: 4; failed: 2; total: 6; seconds spent: 0.000055"}`,
+			wantErr: errRejected,
+		}, {
+			name:    "failed request",
+			res:     `{"response":"failed","info":"unknown request"}`,
+			wantErr: errRejected,
+		}, {
+			name:    "invalid JSON",
+			res:     `processed`,
+			wantErr: errInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := zabbixServer(t, tt.res)
+
+			s := New(Config{Server: addr, Host: "home", Timeout: time.Second})
+			err := s.Send(context.Background(), []*nest.Thermostat{thermostat})
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFailedConnecting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	s := New(Config{Server: addr, Host: "home", Timeout: time.Second})
+	err = s.Send(context.Background(), []*nest.Thermostat{thermostat})
+	assert.True(t, errors.Is(err, errFailedConnecting))
+}
+
+func TestDefaultPort(t *testing.T) {
+	assert.Equal(t, "zabbix:10051", New(Config{Server: "zabbix"}).server)
+	assert.Equal(t, "zabbix:10052", New(Config{Server: "zabbix:10052"}).server)
+}
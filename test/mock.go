@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -52,6 +54,45 @@ func WeatherServerInvalidResponse() *httptest.Server {
 	}))
 }
 
+// WeatherServerForecast returns a mock OpenWeatherMap server which returns valid responses in Celsius with the current
+// weather and, on paths ending with /forecast, the 5 day / 3 hour forecast.
+func WeatherServerForecast() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if strings.HasSuffix(r.URL.Path, "/forecast") {
+			fmt.Fprintln(w, readFile(filepath.Join("weather_forecast.json")))
+			return
+		}
+		fmt.Fprintln(w, readFile(filepath.Join("weather_metric.json")))
+	}))
+}
+
+// WeatherServerConditional returns a mock OpenWeatherMap server which returns a valid response in Celsius with an
+// ETag, the given Cache-Control header and a 304 response to conditional requests. Requests are counted in requests.
+func WeatherServerConditional(cacheControl string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("ETag", `"weather-1"`)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		if r.Header.Get("If-None-Match") == `"weather-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, readFile(filepath.Join("weather_metric.json")))
+	}))
+}
+
+// SolarServer returns a mock Open-Meteo server which returns a valid response with current solar radiation.
+func SolarServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, readFile(filepath.Join("solar_valid.json")))
+	}))
+}
+
 // NestServer returns a mock Nest server which returns a valid response.
 func NestServer() *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,6 +101,15 @@ func NestServer() *httptest.Server {
 	}))
 }
 
+// NestServerWithCounter returns a mock Nest server which returns a valid response and counts the received requests.
+func NestServerWithCounter(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, readFile(filepath.Join("nest_valid.json")))
+	}))
+}
+
 // NestServerInvalidToken returns a mock Nest server which returns an error due to invalid authentication token.
 func NestServerInvalidToken() *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {